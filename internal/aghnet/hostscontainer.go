@@ -129,6 +129,12 @@ func (hc *HostsContainer) ByName(name string) (addrs []netip.Addr) {
 	return hc.current.Load().ByName(name)
 }
 
+// RangeAddrs calls f for each hostname and its addresses from the current set
+// of hosts until f returns false.
+func (hc *HostsContainer) RangeAddrs(f func(host string, addrs []netip.Addr) (cont bool)) {
+	hc.current.Load().RangeAddrs(f)
+}
+
 // pathsToPatterns converts paths into patterns compatible with fs.Glob.
 func pathsToPatterns(fsys fs.FS, paths []string) (patterns []string, err error) {
 	for i, p := range paths {
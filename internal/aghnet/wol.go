@@ -0,0 +1,114 @@
+package aghnet
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// WakeOnLANPort is the UDP port Wake-on-LAN magic packets are sent to.
+const WakeOnLANPort uint16 = 9
+
+// magicPacketRepeats is the number of times the MAC address is repeated in the
+// magic packet.
+const magicPacketRepeats = 16
+
+// NewMagicPacket returns the Wake-on-LAN magic packet for the device with mac:
+// six 0xFF bytes followed by sixteen repetitions of the address.
+func NewMagicPacket(mac net.HardwareAddr) (pkt []byte) {
+	pkt = make([]byte, 0, 6+magicPacketRepeats*len(mac))
+	pkt = append(pkt, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	for range magicPacketRepeats {
+		pkt = append(pkt, mac...)
+	}
+
+	return pkt
+}
+
+// WakeOnLAN sends the Wake-on-LAN magic packet for the device with mac as a
+// broadcast to the local IPv4 subnets containing any of targets, which are the
+// known addresses of the device.  If none of the subnets contain the targets,
+// the packet is sent to each non-loopback IPv4 subnet.  mac must be a valid
+// 6-byte MAC address.
+func WakeOnLAN(mac net.HardwareAddr, targets []netip.Addr) (err error) {
+	if len(mac) != 6 {
+		return fmt.Errorf("bad mac address %s: only 6-byte addresses are supported", mac)
+	}
+
+	subnets, err := wakeOnLANSubnets(targets)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	} else if len(subnets) == 0 {
+		return errors.Error("no suitable network interfaces")
+	}
+
+	pkt := NewMagicPacket(mac)
+
+	var errs []error
+	for _, s := range subnets {
+		errs = append(errs, sendBroadcast(pkt, s))
+	}
+
+	return errors.Join(errs...)
+}
+
+// wakeOnLANSubnets returns the local IPv4 subnets to send the magic packet to.
+func wakeOnLANSubnets(targets []netip.Addr) (subnets []netip.Prefix, err error) {
+	addrs, err := netInterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("getting interface addresses: %w", err)
+	}
+
+	var all []netip.Prefix
+	for _, addr := range addrs {
+		n, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip, ok := netip.AddrFromSlice(n.IP)
+		ip = ip.Unmap()
+		if !ok || !ip.Is4() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+
+		ones, _ := n.Mask.Size()
+		p := netip.PrefixFrom(ip, ones)
+		all = append(all, p)
+
+		if slices.ContainsFunc(targets, func(t netip.Addr) (ok bool) {
+			return p.Contains(t.Unmap())
+		}) {
+			subnets = append(subnets, p)
+		}
+	}
+
+	if len(subnets) == 0 {
+		return all, nil
+	}
+
+	return subnets, nil
+}
+
+// sendBroadcast sends pkt to the broadcast address of s from the local address
+// of s.
+func sendBroadcast(pkt []byte, s netip.Prefix) (err error) {
+	laddr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(s.Addr(), 0))
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.Addr(), err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	bc := BroadcastFromPref(s)
+	_, err = conn.WriteToUDPAddrPort(pkt, netip.AddrPortFrom(bc, WakeOnLANPort))
+	if err != nil {
+		return fmt.Errorf("sending to %s: %w", bc, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package aghnet
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMagicPacket(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	pkt := NewMagicPacket(mac)
+	require.Len(t, pkt, 102)
+
+	assert.Equal(t, bytes.Repeat([]byte{0xff}, 6), pkt[:6])
+	assert.Equal(t, bytes.Repeat(mac, 16), pkt[6:])
+}
+
+func TestWakeOnLANSubnets(t *testing.T) {
+	substNetInterfaceAddrs(t, func() (addrs []net.Addr, err error) {
+		return []net.Addr{&net.IPNet{
+			IP:   net.IP{127, 0, 0, 1},
+			Mask: net.CIDRMask(8, 32),
+		}, &net.IPNet{
+			IP:   net.IP{192, 168, 1, 1},
+			Mask: net.CIDRMask(24, 32),
+		}, &net.IPNet{
+			IP:   net.IP{10, 0, 0, 1},
+			Mask: net.CIDRMask(16, 32),
+		}, &net.IPNet{
+			IP:   net.ParseIP("fd00::1"),
+			Mask: net.CIDRMask(64, 128),
+		}}, nil
+	})
+
+	testCases := []struct {
+		name    string
+		targets []netip.Addr
+		want    []netip.Prefix
+	}{{
+		name:    "known",
+		targets: []netip.Addr{netip.MustParseAddr("10.0.3.4")},
+		want:    []netip.Prefix{netip.MustParsePrefix("10.0.0.1/16")},
+	}, {
+		name:    "unknown",
+		targets: []netip.Addr{netip.MustParseAddr("172.16.0.2")},
+		want: []netip.Prefix{
+			netip.MustParsePrefix("192.168.1.1/24"),
+			netip.MustParsePrefix("10.0.0.1/16"),
+		},
+	}, {
+		name:    "none",
+		targets: nil,
+		want: []netip.Prefix{
+			netip.MustParsePrefix("192.168.1.1/24"),
+			netip.MustParsePrefix("10.0.0.1/16"),
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			subnets, err := wakeOnLANSubnets(tc.targets)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, subnets)
+		})
+	}
+}
@@ -1,6 +1,26 @@
 package aghos
 
+import (
+	"io"
+
+	"github.com/AdguardTeam/golibs/log"
+)
+
 // ConfigureSyslog reroutes standard logger output to syslog.
 func ConfigureSyslog(serviceName string) (err error) {
-	return configureSyslog(serviceName)
+	w, err := NewSyslogWriter(serviceName)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	log.SetOutput(w)
+
+	return nil
+}
+
+// NewSyslogWriter returns a writer sending each write to syslog or, on
+// Windows, to the event log.
+func NewSyslogWriter(serviceName string) (w io.Writer, err error) {
+	return newSyslogWriter(serviceName)
 }
@@ -3,20 +3,17 @@
 package aghos
 
 import (
+	"io"
 	"log/syslog"
-
-	"github.com/AdguardTeam/golibs/log"
 )
 
-// configureSyslog sets standard log output to syslog.
-func configureSyslog(serviceName string) (err error) {
-	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, serviceName)
+// newSyslogWriter returns a writer sending each write to syslog.
+func newSyslogWriter(serviceName string) (w io.Writer, err error) {
+	sw, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, serviceName)
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
-		return err
+		return nil, err
 	}
 
-	log.SetOutput(w)
-
-	return nil
+	return sw, nil
 }
@@ -3,9 +3,9 @@
 package aghos
 
 import (
+	"io"
 	"strings"
 
-	"github.com/AdguardTeam/golibs/log"
 	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc/eventlog"
 )
@@ -19,8 +19,8 @@ func (w *eventLogWriter) Write(b []byte) (int, error) {
 	return len(b), w.el.Info(1, string(b))
 }
 
-// configureSyslog sets standard log output to event log.
-func configureSyslog(serviceName string) (err error) {
+// newSyslogWriter returns a writer sending each write to the event log.
+func newSyslogWriter(serviceName string) (w io.Writer, err error) {
 	// Note that the eventlog src is the same as the service name, otherwise we
 	// will get "the description for event id cannot be found" warning in every
 	// log record.
@@ -33,16 +33,14 @@ func configureSyslog(serviceName string) (err error) {
 		!strings.Contains(err.Error(), "registry key already exists") &&
 		err != windows.ERROR_ACCESS_DENIED {
 		// Don't wrap the error, because it's informative enough as is.
-		return err
+		return nil, err
 	}
 
 	el, err := eventlog.Open(serviceName)
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
-		return err
+		return nil, err
 	}
 
-	log.SetOutput(&eventLogWriter{el: el})
-
-	return nil
+	return &eventLogWriter{el: el}, nil
 }
@@ -11,10 +11,13 @@ import (
 	"github.com/AdguardTeam/golibs/errors"
 )
 
+// ErrNotFound is returned by the methods of [DB] when there is no such user.
+const ErrNotFound errors.Error = "user not found"
+
 // DB is an interface that defines methods for interacting with user
-// information.  All methods must be safe for concurrent use.
-//
-// TODO(s.chzhen):  Use this.
+// information.  All methods must be safe for concurrent use.  The read-only
+// implementations, such as the external identity providers, return
+// [errors.ErrUnsupported] from the methods changing the users.
 //
 // TODO(s.chzhen):  Consider updating methods to return a clone.
 type DB interface {
@@ -40,6 +43,16 @@ type DB interface {
 	// an error from the cryptographic randomness reader.  u must not be
 	// modified.
 	Create(ctx context.Context, u *User) (err error)
+
+	// Update replaces the user having the same ID as u.  If there is no such
+	// user, it returns [ErrNotFound].  If the login of u belongs to another
+	// user, it returns the [errors.ErrDuplicated] error.  u must not be
+	// modified.
+	Update(ctx context.Context, u *User) (err error)
+
+	// Delete removes the user with the ID.  If there is no such user, it
+	// returns [ErrNotFound].
+	Delete(ctx context.Context, id UserID) (err error)
 }
 
 // DefaultDB is the default in-memory implementation of the [DB] interface.
@@ -147,3 +160,41 @@ func (db *DefaultDB) Create(ctx context.Context, u *User) (err error) {
 
 	return nil
 }
+
+// Update implements the [DB] interface for *DefaultDB.
+func (db *DefaultDB) Update(ctx context.Context, u *User) (err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	prev, ok := db.userIDToUser[u.ID]
+	if !ok {
+		return fmt.Errorf("userid: %w", ErrNotFound)
+	}
+
+	id, ok := db.loginToUserID[u.Login]
+	if ok && id != u.ID {
+		return fmt.Errorf("login: %w", errors.ErrDuplicated)
+	}
+
+	delete(db.loginToUserID, prev.Login)
+	db.userIDToUser[u.ID] = u
+	db.loginToUserID[u.Login] = u.ID
+
+	return nil
+}
+
+// Delete implements the [DB] interface for *DefaultDB.
+func (db *DefaultDB) Delete(ctx context.Context, id UserID) (err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.userIDToUser[id]
+	if !ok {
+		return fmt.Errorf("userid: %w", ErrNotFound)
+	}
+
+	delete(db.userIDToUser, id)
+	delete(db.loginToUserID, u.Login)
+
+	return nil
+}
@@ -80,4 +80,42 @@ func TestDB(t *testing.T) {
 
 	assert.Len(t, users, 2)
 	assert.Equal(t, []*aghuser.User{userSecond, userWithID}, users)
+
+	renamed := userSecond.Clone()
+	renamed.Login = "user_renamed"
+	renamed.Role = aghuser.RoleReadOnly
+
+	err = db.Update(ctx, renamed)
+	require.NoError(t, err)
+
+	got, err = db.ByLogin(ctx, userSecond.Login)
+	require.NoError(t, err)
+
+	assert.Nil(t, got)
+
+	got, err = db.ByLogin(ctx, renamed.Login)
+	require.NoError(t, err)
+
+	assert.Equal(t, renamed, got)
+
+	renamed = renamed.Clone()
+	renamed.Login = userWithID.Login
+
+	err = db.Update(ctx, renamed)
+	assert.ErrorIs(t, err, errors.ErrDuplicated)
+
+	err = db.Update(ctx, &aghuser.User{ID: aghuser.MustNewUserID(), Login: "missing"})
+	assert.ErrorIs(t, err, aghuser.ErrNotFound)
+
+	err = db.Delete(ctx, userWithID.ID)
+	require.NoError(t, err)
+
+	err = db.Delete(ctx, userWithID.ID)
+	assert.ErrorIs(t, err, aghuser.ErrNotFound)
+
+	users, err = db.All(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+
+	assert.Equal(t, aghuser.Login("user_renamed"), users[0].Login)
 }
@@ -0,0 +1,201 @@
+package aghuser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Access is the kind of access to an area of the HTTP API.
+type Access string
+
+// Access values.
+const (
+	AccessRead  Access = "read"
+	AccessWrite Access = "write"
+)
+
+// Area is a part of the HTTP API grouping the related handlers.
+type Area string
+
+// Area values.
+const (
+	AreaAudit           Area = "audit"
+	AreaBlockedServices Area = "blocked_services"
+	AreaCategories      Area = "categories"
+	AreaClients         Area = "clients"
+	AreaDDNS            Area = "ddns"
+	AreaDHCP            Area = "dhcp"
+	AreaDNS             Area = "dns"
+	AreaFiltering       Area = "filtering"
+	AreaProfile         Area = "profile"
+	AreaProtection      Area = "protection"
+	AreaQueryLog        Area = "querylog"
+	AreaRewrite         Area = "rewrite"
+	AreaStats           Area = "stats"
+	AreaStatus          Area = "status"
+	AreaTLS             Area = "tls"
+	AreaTokens          Area = "tokens"
+	AreaUnblockRequests Area = "unblock_requests"
+	AreaUpdate          Area = "update"
+	AreaUsers           Area = "users"
+)
+
+// Permission is a permission to use a part of the HTTP API.  It has the form
+// "<area>:<access>", for example "querylog:read".
+type Permission string
+
+// NewPermission returns the permission for access to area.
+func NewPermission(area Area, access Access) (p Permission) {
+	return Permission(string(area) + ":" + string(access))
+}
+
+// ParsePermission parses a permission from s.
+func ParsePermission(s string) (p Permission, err error) {
+	area, access, ok := strings.Cut(s, ":")
+	if !ok || area == "" {
+		return "", fmt.Errorf("permission %q: %w", s, errors.ErrBadEnumValue)
+	}
+
+	switch a := Access(access); a {
+	case AccessRead, AccessWrite:
+		return NewPermission(Area(area), a), nil
+	default:
+		return "", fmt.Errorf("permission %q: access: %w", s, errors.ErrBadEnumValue)
+	}
+}
+
+// Role is the role of a web user defining the permissions of the user.
+type Role string
+
+// Role values.
+const (
+	// RoleAdmin allows everything.  It's also used for the users without a
+	// role for compatibility.
+	RoleAdmin Role = "admin"
+
+	// RoleOperator allows the day-to-day management of filtering and clients
+	// but not the changes to the DNS, DHCP, and TLS settings or updates.
+	RoleOperator Role = "operator"
+
+	// RoleReadOnly only allows viewing the dashboard and the settings, except
+	// the sensitive ones.
+	RoleReadOnly Role = "read_only"
+
+	// RoleDDNS only allows managing the rewrites, as required by the DDNS
+	// scripts.
+	RoleDDNS Role = "ddns"
+
+	// RoleParent allows viewing the dashboard and managing the settings of
+	// the particular persistent clients, but not turning the protection off.
+	RoleParent Role = "parent"
+)
+
+// readAreas are the areas available for reading to the non-admin roles viewing
+// the dashboard.
+var readAreas = []Area{
+	AreaBlockedServices,
+	AreaCategories,
+	AreaClients,
+	AreaDHCP,
+	AreaDNS,
+	AreaFiltering,
+	AreaProfile,
+	AreaQueryLog,
+	AreaRewrite,
+	AreaStats,
+	AreaStatus,
+	AreaUnblockRequests,
+}
+
+// rolePermissions maps the roles except [RoleAdmin] to their permissions.
+var rolePermissions = map[Role]*container.MapSet[Permission]{
+	RoleOperator: newPermissionSet(readAreas, []Area{
+		AreaBlockedServices,
+		AreaCategories,
+		AreaClients,
+		AreaFiltering,
+		AreaProfile,
+		AreaProtection,
+		AreaQueryLog,
+		AreaRewrite,
+		AreaStats,
+		AreaUnblockRequests,
+	}),
+	RoleReadOnly: newPermissionSet(readAreas, []Area{AreaProfile}),
+	RoleDDNS: newPermissionSet(
+		[]Area{AreaDDNS, AreaProfile, AreaRewrite, AreaStatus},
+		[]Area{AreaProfile, AreaRewrite},
+	),
+	RoleParent: newPermissionSet(
+		[]Area{
+			AreaBlockedServices,
+			AreaCategories,
+			AreaClients,
+			AreaFiltering,
+			AreaProfile,
+			AreaQueryLog,
+			AreaStats,
+			AreaStatus,
+		},
+		[]Area{AreaClients, AreaProfile},
+	),
+}
+
+// newPermissionSet returns the set of permissions to read the areas from read
+// and to write the areas from write.
+func newPermissionSet(read, write []Area) (set *container.MapSet[Permission]) {
+	set = container.NewMapSet[Permission]()
+	for _, a := range read {
+		set.Add(NewPermission(a, AccessRead))
+	}
+
+	for _, a := range write {
+		set.Add(NewPermission(a, AccessWrite))
+	}
+
+	return set
+}
+
+// Validate returns an error if r is not a known role.  An empty role is valid
+// and means [RoleAdmin].
+func (r Role) Validate() (err error) {
+	if r == "" || r == RoleAdmin {
+		return nil
+	}
+
+	if _, ok := rolePermissions[r]; !ok {
+		return fmt.Errorf("role %q: %w", r, errors.ErrBadEnumValue)
+	}
+
+	return nil
+}
+
+// Allows returns true if r grants p.  An empty role is treated as
+// [RoleAdmin].
+func (r Role) Allows(p Permission) (ok bool) {
+	if r == "" || r == RoleAdmin {
+		return true
+	}
+
+	perms, ok := rolePermissions[r]
+
+	return ok && perms.Has(p)
+}
+
+// Permissions returns the sorted permissions granted by r, or nil for
+// [RoleAdmin], which grants all of them.
+func (r Role) Permissions() (perms []Permission) {
+	set, ok := rolePermissions[r]
+	if !ok {
+		return nil
+	}
+
+	perms = set.Values()
+	slices.Sort(perms)
+
+	return perms
+}
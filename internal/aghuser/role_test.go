@@ -0,0 +1,114 @@
+package aghuser_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRole_Allows(t *testing.T) {
+	var (
+		statsRead      = aghuser.NewPermission(aghuser.AreaStats, aghuser.AccessRead)
+		protectionEdit = aghuser.NewPermission(aghuser.AreaProtection, aghuser.AccessWrite)
+		rewriteEdit    = aghuser.NewPermission(aghuser.AreaRewrite, aghuser.AccessWrite)
+		clientsEdit    = aghuser.NewPermission(aghuser.AreaClients, aghuser.AccessWrite)
+		tlsEdit        = aghuser.NewPermission(aghuser.AreaTLS, aghuser.AccessWrite)
+		updateEdit     = aghuser.NewPermission(aghuser.AreaUpdate, aghuser.AccessWrite)
+	)
+
+	testCases := []struct {
+		role  aghuser.Role
+		allow []aghuser.Permission
+		deny  []aghuser.Permission
+	}{{
+		role:  "",
+		allow: []aghuser.Permission{statsRead, protectionEdit, tlsEdit, updateEdit},
+		deny:  nil,
+	}, {
+		role:  aghuser.RoleAdmin,
+		allow: []aghuser.Permission{statsRead, protectionEdit, tlsEdit, updateEdit},
+		deny:  nil,
+	}, {
+		role:  aghuser.RoleOperator,
+		allow: []aghuser.Permission{statsRead, protectionEdit, rewriteEdit, clientsEdit},
+		deny:  []aghuser.Permission{tlsEdit, updateEdit},
+	}, {
+		role:  aghuser.RoleReadOnly,
+		allow: []aghuser.Permission{statsRead},
+		deny:  []aghuser.Permission{protectionEdit, rewriteEdit, tlsEdit, updateEdit},
+	}, {
+		role:  aghuser.RoleDDNS,
+		allow: []aghuser.Permission{rewriteEdit},
+		deny:  []aghuser.Permission{statsRead, protectionEdit, clientsEdit, updateEdit},
+	}, {
+		role:  aghuser.RoleParent,
+		allow: []aghuser.Permission{statsRead, clientsEdit},
+		deny:  []aghuser.Permission{protectionEdit, rewriteEdit, tlsEdit, updateEdit},
+	}, {
+		role:  "unknown",
+		allow: nil,
+		deny:  []aghuser.Permission{statsRead, protectionEdit},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.role), func(t *testing.T) {
+			for _, p := range tc.allow {
+				assert.Truef(t, tc.role.Allows(p), "permission %s", p)
+			}
+
+			for _, p := range tc.deny {
+				assert.Falsef(t, tc.role.Allows(p), "permission %s", p)
+			}
+		})
+	}
+}
+
+func TestRole_Validate(t *testing.T) {
+	testutil.AssertErrorMsg(t, "", aghuser.Role("").Validate())
+	testutil.AssertErrorMsg(t, "", aghuser.RoleParent.Validate())
+	testutil.AssertErrorMsg(
+		t,
+		`role "superuser": bad enum value`,
+		aghuser.Role("superuser").Validate(),
+	)
+}
+
+func TestParsePermission(t *testing.T) {
+	testCases := []struct {
+		name       string
+		in         string
+		want       aghuser.Permission
+		wantErrMsg string
+	}{{
+		name:       "read",
+		in:         "querylog:read",
+		want:       aghuser.NewPermission(aghuser.AreaQueryLog, aghuser.AccessRead),
+		wantErrMsg: "",
+	}, {
+		name:       "write",
+		in:         "rewrite:write",
+		want:       aghuser.NewPermission(aghuser.AreaRewrite, aghuser.AccessWrite),
+		wantErrMsg: "",
+	}, {
+		name:       "no_access",
+		in:         "rewrite",
+		want:       "",
+		wantErrMsg: `permission "rewrite": bad enum value`,
+	}, {
+		name:       "bad_access",
+		in:         "rewrite:delete",
+		want:       "",
+		wantErrMsg: `permission "rewrite:delete": access: bad enum value`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := aghuser.ParsePermission(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, p)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package aghuser
 
 import (
 	"crypto/rand"
+	"net/netip"
 	"time"
 )
 
@@ -20,11 +21,29 @@ func NewSessionToken() (t SessionToken) {
 	return t
 }
 
-// Session represents a web user session.
+// Session represents a web user session.  The sessions returned by
+// [SessionStorage] must not be modified; use [Session.Clone] and
+// [SessionStorage.Update] instead.
 type Session struct {
+	// Created is the time when the session has been created.  It's zero for
+	// the sessions created by the older versions.
+	Created time.Time
+
 	// Expire indicates when the session will expire.
 	Expire time.Time
 
+	// LastSeen is the time of the last request within the session.  It's zero
+	// for the sessions created by the older versions until they're used.
+	LastSeen time.Time
+
+	// LastIP is the IP address of the last request within the session, if
+	// known.
+	LastIP netip.Addr
+
+	// UserAgent is the User-Agent of the last request within the session, if
+	// known.
+	UserAgent string
+
 	// UserLogin is the login of the web user associated with the session.
 	//
 	// TODO(s.chzhen):  Remove this field and associate the user by UserID.
@@ -36,3 +55,14 @@ type Session struct {
 	// UserID is the identifier of the web user associated with the session.
 	UserID UserID
 }
+
+// Clone returns a copy of s.
+func (s *Session) Clone() (c *Session) {
+	if s == nil {
+		return nil
+	}
+
+	clone := *s
+
+	return &clone
+}
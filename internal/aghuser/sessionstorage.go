@@ -3,8 +3,10 @@ package aghuser
 import (
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"sync"
 	"time"
 
@@ -18,8 +20,6 @@ import (
 
 // SessionStorage is an interface that defines methods for handling web user
 // sessions.  All methods must be safe for concurrent use.
-//
-// TODO(s.chzhen):  Add DeleteAll method.
 type SessionStorage interface {
 	// New creates a new session for the web user.
 	New(ctx context.Context, u *User) (s *Session, err error)
@@ -31,6 +31,15 @@ type SessionStorage interface {
 	// in-memory implementation, as it currently always returns nil for error.
 	FindByToken(ctx context.Context, t SessionToken) (s *Session, err error)
 
+	// FindByUser returns the stored sessions of the web user with the login
+	// which haven't expired yet, in no particular order.
+	FindByUser(ctx context.Context, login Login) (sessions []*Session, err error)
+
+	// Update replaces the stored session having the same token as s, for
+	// example to prolong it.  If there is no such session, it returns
+	// [ErrSessionNotFound].  s must not be modified.
+	Update(ctx context.Context, s *Session) (err error)
+
 	// DeleteByToken removes a stored web user session by the provided token.
 	DeleteByToken(ctx context.Context, t SessionToken) (err error)
 
@@ -49,11 +58,17 @@ type DefaultSessionStorageConfig struct {
 	Clock timeutil.Clock
 
 	// UserDB contains the web user information such as ID, login, and password.
-	// It must not be nil.
+	// If it's not nil, the loaded sessions of the users missing from it are
+	// removed.
 	UserDB DB
 
+	// DB is the opened database to store the sessions in along with other
+	// data.  If it's nil, the database at DBPath is opened and closed by the
+	// storage.
+	DB *bbolt.DB
+
 	// DBPath is the path to the database file where session data is stored.  It
-	// must not be empty.
+	// must not be empty if DB is nil.
 	DBPath string
 
 	// SessionTTL is the default Time-To-Live duration for web user sessions.
@@ -85,6 +100,9 @@ type DefaultSessionStorage struct {
 
 	// sessionTTL is the default Time-To-Live value for web user sessions.
 	sessionTTL time.Duration
+
+	// ownsDB is true if db has been opened by the storage.
+	ownsDB bool
 }
 
 // NewDefaultSessionStorage returns the new properly initialized
@@ -102,7 +120,25 @@ func NewDefaultSessionStorage(
 		sessionTTL: conf.SessionTTL,
 	}
 
-	dbFilename := conf.DBPath
+	ds.db, ds.ownsDB = conf.DB, conf.DB == nil
+	if ds.ownsDB {
+		err = ds.open(ctx, conf.DBPath)
+		if err != nil {
+			// Don't wrap the error because it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	err = ds.loadSessions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading sessions: %w", err)
+	}
+
+	return ds, nil
+}
+
+// open opens the bbolt database at dbFilename.
+func (ds *DefaultSessionStorage) open(ctx context.Context, dbFilename string) (err error) {
 	// TODO(s.chzhen):  Pass logger with options.
 	ds.db, err = bbolt.Open(dbFilename, aghos.DefaultPermFile, nil)
 	if err != nil {
@@ -113,15 +149,10 @@ func NewDefaultSessionStorage(
 			slogutil.PrintLines(ctx, ds.logger, slog.LevelError, "", s)
 		}
 
-		return nil, err
-	}
-
-	err = ds.loadSessions(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("loading sessions: %w", err)
+		return err
 	}
 
-	return ds, nil
+	return nil
 }
 
 // loadSessions loads web user sessions from the bbolt database.
@@ -208,6 +239,13 @@ func (ds *DefaultSessionStorage) bboltSessionHandler(
 	now := ds.clock.Now()
 
 	return func(k, v []byte) (err error) {
+		if len(k) != SessionTokenLength {
+			*invalidSessions = append(*invalidSessions, k)
+			ds.logger.DebugContext(ctx, "bad session token length", "len", len(k))
+
+			return nil
+		}
+
 		s, err := bboltDecode(v)
 		if err != nil {
 			*invalidSessions = append(*invalidSessions, k)
@@ -222,22 +260,23 @@ func (ds *DefaultSessionStorage) bboltSessionHandler(
 			return nil
 		}
 
-		u, err := ds.userDB.ByLogin(ctx, s.UserLogin)
-		if err != nil {
-			// Should not happen, as it currently always returns nil for error.
-			panic(err)
-		}
-
-		if u == nil {
-			*invalidSessions = append(*invalidSessions, k)
-			ds.logger.DebugContext(ctx, "no saved user by name", "name", s.UserLogin)
-
-			return nil
+		if ds.userDB != nil {
+			u, uErr := ds.userDB.ByLogin(ctx, s.UserLogin)
+			if uErr != nil {
+				// Keep the session, since the user may be available later.
+				ds.logger.DebugContext(ctx, "searching user", slogutil.KeyError, uErr)
+			} else if u == nil {
+				*invalidSessions = append(*invalidSessions, k)
+				ds.logger.DebugContext(ctx, "no saved user by name", "name", s.UserLogin)
+
+				return nil
+			} else {
+				s.UserID = u.ID
+			}
 		}
 
 		t := SessionToken(k)
 		s.Token = t
-		s.UserID = u.ID
 		ds.sessions[t] = s
 
 		return nil
@@ -258,6 +297,15 @@ const (
 	bboltSessionNameLen = 2
 )
 
+// bboltSessionMeta is the JSON-encoded part of the binary entry following the
+// login.  The entries stored by the older versions don't have it.
+type bboltSessionMeta struct {
+	Created   time.Time  `json:"created"`
+	LastSeen  time.Time  `json:"last_seen"`
+	LastIP    netip.Addr `json:"last_ip"`
+	UserAgent string     `json:"user_agent"`
+}
+
 // bboltDecode deserializes decodes a binary data into a session.
 func bboltDecode(data []byte) (s *Session, err error) {
 	if len(data) < bboltSessionExpireLen+bboltSessionNameLen {
@@ -269,16 +317,34 @@ func bboltDecode(data []byte) (s *Session, err error) {
 	nameData := data[bboltSessionExpireLen+bboltSessionNameLen:]
 
 	nameLen := binary.BigEndian.Uint16(nameLenData)
-	if len(nameData) != int(nameLen) {
+	if len(nameData) < int(nameLen) {
 		return nil, fmt.Errorf("login: expected length %d, got %d", nameLen, len(nameData))
 	}
 
 	expire := binary.BigEndian.Uint32(expireData)
 
-	return &Session{
+	s = &Session{
 		Expire:    time.Unix(int64(expire), 0),
-		UserLogin: Login(nameData),
-	}, nil
+		UserLogin: Login(nameData[:nameLen]),
+	}
+
+	metaData := nameData[nameLen:]
+	if len(metaData) == 0 {
+		return s, nil
+	}
+
+	meta := &bboltSessionMeta{}
+	err = json.Unmarshal(metaData, meta)
+	if err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+
+	s.Created = meta.Created
+	s.LastSeen = meta.LastSeen
+	s.LastIP = meta.LastIP
+	s.UserAgent = meta.UserAgent
+
+	return s, nil
 }
 
 // bboltEncode serializes a session properties into a binary data.
@@ -294,7 +360,18 @@ func bboltEncode(s *Session) (data []byte) {
 	binary.BigEndian.PutUint16(nameLenData, uint16(len(s.UserLogin)))
 	copy(nameData, []byte(s.UserLogin))
 
-	return data
+	meta, err := json.Marshal(&bboltSessionMeta{
+		Created:   s.Created,
+		LastSeen:  s.LastSeen,
+		LastIP:    s.LastIP,
+		UserAgent: s.UserAgent,
+	})
+	if err != nil {
+		// Should not happen.
+		panic(fmt.Errorf("encoding session metadata: %w", err))
+	}
+
+	return append(data, meta...)
 }
 
 // type check
@@ -302,11 +379,14 @@ var _ SessionStorage = (*DefaultSessionStorage)(nil)
 
 // New implements the [SessionStorage] interface for *DefaultSessionStorage.
 func (ds *DefaultSessionStorage) New(ctx context.Context, u *User) (s *Session, err error) {
+	now := ds.clock.Now()
 	s = &Session{
+		Created:   now,
+		Expire:    now.Add(ds.sessionTTL),
+		LastSeen:  now,
 		Token:     NewSessionToken(),
 		UserID:    u.ID,
 		UserLogin: u.Login,
-		Expire:    ds.clock.Now().Add(ds.sessionTTL),
 	}
 
 	err = ds.store(s)
@@ -378,6 +458,49 @@ func (ds *DefaultSessionStorage) FindByToken(ctx context.Context, t SessionToken
 	return s, nil
 }
 
+// FindByUser implements the [SessionStorage] interface for
+// *DefaultSessionStorage.
+func (ds *DefaultSessionStorage) FindByUser(
+	ctx context.Context,
+	login Login,
+) (sessions []*Session, err error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	now := ds.clock.Now()
+	for _, s := range ds.sessions {
+		if s.UserLogin == login && !now.After(s.Expire) {
+			sessions = append(sessions, s)
+		}
+	}
+
+	return sessions, nil
+}
+
+// ErrSessionNotFound is returned by [SessionStorage.Update] when there is no
+// such session.
+const ErrSessionNotFound errors.Error = "session not found"
+
+// Update implements the [SessionStorage] interface for *DefaultSessionStorage.
+func (ds *DefaultSessionStorage) Update(ctx context.Context, s *Session) (err error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if _, ok := ds.sessions[s.Token]; !ok {
+		return ErrSessionNotFound
+	}
+
+	s = s.Clone()
+	err = ds.store(s)
+	if err != nil {
+		return fmt.Errorf("storing session: %w", err)
+	}
+
+	ds.sessions[s.Token] = s
+
+	return nil
+}
+
 // DeleteByToken implements the [SessionStorage] interface for
 // *DefaultSessionStorage.
 func (ds *DefaultSessionStorage) DeleteByToken(ctx context.Context, t SessionToken) (err error) {
@@ -439,7 +562,12 @@ func (ds *DefaultSessionStorage) remove(ctx context.Context, t SessionToken) (er
 }
 
 // Close implements the [SessionStorage] interface for *DefaultSessionStorage.
+// It doesn't close the database passed in the configuration.
 func (ds *DefaultSessionStorage) Close() (err error) {
+	if !ds.ownsDB {
+		return nil
+	}
+
 	err = ds.db.Close()
 	if err != nil {
 		return fmt.Errorf("closing db: %w", err)
@@ -2,6 +2,7 @@ package aghuser_test
 
 import (
 	"context"
+	"net/netip"
 	"os"
 	"testing"
 	"time"
@@ -146,6 +147,30 @@ func TestDefaultSessionStorage(t *testing.T) {
 		assert.Nil(t, got)
 	}))
 
+	require.True(t, t.Run("update", func(t *testing.T) {
+		s := addSession(t, ctx, ds, userLoginFirst)
+
+		upd := s.Clone()
+		upd.LastIP = netip.MustParseAddr("192.0.2.1")
+		upd.UserAgent = "Browser/1.0"
+
+		err = ds.Update(ctx, upd)
+		require.NoError(t, err)
+
+		var sessions []*aghuser.Session
+		sessions, err = ds.FindByUser(ctx, userLoginFirst)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+
+		assert.Equal(t, upd, sessions[0])
+
+		err = ds.DeleteByToken(ctx, s.Token)
+		require.NoError(t, err)
+
+		err = ds.Update(ctx, upd)
+		assert.ErrorIs(t, err, aghuser.ErrSessionNotFound)
+	}))
+
 	require.True(t, t.Run("expired_session", func(t *testing.T) {
 		testutil.CleanupAndRequireSuccess(t, ds.Close)
 
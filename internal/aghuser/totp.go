@@ -0,0 +1,118 @@
+package aghuser
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// TOTPDigits is the number of digits in TOTP codes.
+	TOTPDigits = 6
+
+	// TOTPPeriod is the validity period of a single TOTP code.
+	TOTPPeriod = 30 * time.Second
+
+	// TOTPSecretSize is the size of TOTP secrets in bytes, as recommended by
+	// RFC 4226 for HMAC-SHA1.
+	TOTPSecretSize = 20
+
+	// totpSkew is the number of periods before and after the current one, the
+	// codes of which are also accepted to account for the clock drift.
+	totpSkew = 1
+)
+
+// NewTOTPSecret returns a new random TOTP secret.
+func NewTOTPSecret() (secret []byte) {
+	secret = make([]byte, TOTPSecretSize)
+
+	// Since Go 1.24, crypto/rand.Read doesn't return an error and crashes
+	// unrecoverably instead.
+	_, _ = rand.Read(secret)
+
+	return secret
+}
+
+// totpStep returns the TOTP time step for t.
+func totpStep(t time.Time) (step int64) {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// hotp returns the HOTP code for secret and counter as defined by RFC 4226.
+func hotp(secret []byte, counter uint64) (code string) {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, secret)
+	_, _ = mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fff_ffff
+
+	mod := uint32(1)
+	for range TOTPDigits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, bin%mod)
+}
+
+// TOTPCode returns the TOTP code for secret at t as defined by RFC 6238.
+func TOTPCode(secret []byte, t time.Time) (code string) {
+	return hotp(secret, uint64(totpStep(t)))
+}
+
+// ValidateTOTP returns the time step of code if it's a valid TOTP code for
+// secret at now.  The codes from the adjacent steps are also accepted.  The
+// steps not greater than last are rejected to prevent the reuse of codes.
+func ValidateTOTP(secret []byte, code string, now time.Time, last int64) (step int64, ok bool) {
+	if len(code) != TOTPDigits {
+		return 0, false
+	} else if _, err := strconv.ParseUint(code, 10, 32); err != nil {
+		return 0, false
+	}
+
+	cur := totpStep(now)
+	for s := cur - totpSkew; s <= cur+totpSkew; s++ {
+		if s <= last {
+			continue
+		}
+
+		want := hotp(secret, uint64(s))
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// TOTPURI returns the otpauth URI for secret, which authenticator apps use to
+// enroll the account, usually from a QR code.
+func TOTPURI(issuer, account string, secret []byte) (uri string) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+
+	q := url.Values{}
+	q.Set("secret", enc)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(TOTPDigits))
+	q.Set("period", strconv.Itoa(int(TOTPPeriod/time.Second)))
+
+	u := &url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+
+	return u.String()
+}
@@ -0,0 +1,73 @@
+package aghuser_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTOTPSecret is the secret from the test vectors of RFC 6238.
+var testTOTPSecret = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// The last six digits of the SHA1 test vectors from RFC 6238, Appendix B.
+	testCases := []struct {
+		want string
+		unix int64
+	}{{
+		want: "287082",
+		unix: 59,
+	}, {
+		want: "081804",
+		unix: 1111111109,
+	}, {
+		want: "050471",
+		unix: 1111111111,
+	}, {
+		want: "005924",
+		unix: 1234567890,
+	}, {
+		want: "279037",
+		unix: 2000000000,
+	}}
+
+	for _, tc := range testCases {
+		got := aghuser.TOTPCode(testTOTPSecret, time.Unix(tc.unix, 0))
+		assert.Equalf(t, tc.want, got, "at %d", tc.unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := aghuser.TOTPCode(testTOTPSecret, now)
+
+	step, ok := aghuser.ValidateTOTP(testTOTPSecret, code, now, 0)
+	assert.True(t, ok)
+
+	_, ok = aghuser.ValidateTOTP(testTOTPSecret, code, now.Add(aghuser.TOTPPeriod), 0)
+	assert.True(t, ok)
+
+	_, ok = aghuser.ValidateTOTP(testTOTPSecret, code, now.Add(3*aghuser.TOTPPeriod), 0)
+	assert.False(t, ok)
+
+	_, ok = aghuser.ValidateTOTP(testTOTPSecret, code, now, step)
+	assert.False(t, ok)
+
+	_, ok = aghuser.ValidateTOTP(testTOTPSecret, "12345", now, 0)
+	assert.False(t, ok)
+
+	_, ok = aghuser.ValidateTOTP(testTOTPSecret, "abcdef", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	got := aghuser.TOTPURI("AdGuard Home", "admin", testTOTPSecret)
+	assert.Equal(
+		t,
+		"otpauth://totp/AdGuard%20Home:admin?algorithm=SHA1&digits=6"+
+			"&issuer=AdGuard+Home&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		got,
+	)
+}
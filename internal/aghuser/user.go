@@ -4,6 +4,7 @@ package aghuser
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/google/uuid"
 )
@@ -39,6 +40,31 @@ type User struct {
 	// Login is the login name of the web user.  It must not be empty.
 	Login Login
 
+	// Role defines the permissions of the web user.  Empty role means
+	// [RoleAdmin].
+	Role Role
+
+	// Clients are the names of the persistent clients the web user may
+	// manage.  It's only used with [RoleParent].
+	Clients []string
+
 	// ID is the unique identifier for the web user.  It must not be empty.
 	ID UserID
+
+	// External is true if the web user is managed by an external identity
+	// provider, such as a directory service.  The passwords of such users
+	// can't be changed, and they aren't saved into the configuration file.
+	External bool
+}
+
+// Clone returns a deep copy of u.
+func (u *User) Clone() (c *User) {
+	if u == nil {
+		return nil
+	}
+
+	clone := *u
+	clone.Clients = slices.Clone(u.Clients)
+
+	return &clone
 }
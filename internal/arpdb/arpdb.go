@@ -38,6 +38,58 @@ type Interface interface {
 	Neighbors() (ns []Neighbor)
 }
 
+// EventType is the type of a change of the network neighborhood.
+type EventType uint8
+
+// Valid event types.
+const (
+	// EventTypeNew means that a device with a hardware address that has never
+	// been seen before appeared on the network.
+	EventTypeNew EventType = iota + 1
+
+	// EventTypeUpdate means that a known device has got a new address or has
+	// become reachable again.
+	EventTypeUpdate
+
+	// EventTypeDelete means that the neighbor has been removed from the
+	// neighborhood.
+	EventTypeDelete
+)
+
+// String implements the [fmt.Stringer] interface for EventType.
+func (t EventType) String() (s string) {
+	switch t {
+	case EventTypeNew:
+		return "new"
+	case EventTypeUpdate:
+		return "update"
+	case EventTypeDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("!bad_event_type_%d", uint8(t))
+	}
+}
+
+// Event is a change of the network neighborhood.
+type Event struct {
+	// Neighbor is the changed neighbor.
+	Neighbor Neighbor
+
+	// Type is the type of the change.
+	Type EventType
+}
+
+// Watcher is the [Interface] that also reports the changes of the network
+// neighborhood as soon as they happen.
+type Watcher interface {
+	Interface
+
+	// Events returns the channel of the neighborhood changes.  The events are
+	// only sent after the first successful call to Refresh.  The channel may
+	// be nil, if the implementation is unable to watch the changes.
+	Events() (ch <-chan Event)
+}
+
 // New returns the [Interface] properly initialized for the OS.
 func New(logger *slog.Logger) (arp Interface) {
 	return newARPDB(logger)
@@ -223,7 +275,7 @@ func newARPDBs(arps ...Interface) (arp *arpdbs) {
 }
 
 // type check
-var _ Interface = (*arpdbs)(nil)
+var _ Watcher = (*arpdbs)(nil)
 
 // Refresh implements the [Interface] interface for *arpdbs.
 func (arp *arpdbs) Refresh() (err error) {
@@ -251,3 +303,15 @@ func (arp *arpdbs) Refresh() (err error) {
 func (arp *arpdbs) Neighbors() (ns []Neighbor) {
 	return arp.clone()
 }
+
+// Events implements the [Watcher] interface for *arpdbs.  It returns the events
+// of the first of arps implementing [Watcher], if any.
+func (arp *arpdbs) Events() (ch <-chan Event) {
+	for _, a := range arp.arps {
+		if w, ok := a.(Watcher); ok {
+			return w.Events()
+		}
+	}
+
+	return nil
+}
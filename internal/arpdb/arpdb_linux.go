@@ -32,7 +32,9 @@ func newARPDB(logger *slog.Logger) (arp *arpdbs) {
 	}
 
 	return newARPDBs(
-		// Try /proc/net/arp first.
+		// Try netlink first, since it also reports the changes.
+		newNetlinkARPDB(logger),
+		// Then, try /proc/net/arp.
 		&fsysARPDB{
 			ns:       ns,
 			fsys:     rootDirFS,
@@ -0,0 +1,395 @@
+//go:build linux
+
+package arpdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ndMsgLen is the length of the ndmsg structure preceding the attributes of
+// the neighbor messages.  See man 7 rtnetlink.
+const ndMsgLen = 12
+
+// eventsBufferSize is the size of the buffer of the neighborhood events
+// channel.
+const eventsBufferSize = 64
+
+// neighConn is the netlink connection used to retrieve the neighbors.
+type neighConn interface {
+	// Execute sends m and returns the replies.
+	Execute(m netlink.Message) (msgs []netlink.Message, err error)
+
+	// Receive returns the messages of the subscribed multicast groups.
+	Receive() (msgs []netlink.Message, err error)
+
+	// Close closes the connection.
+	Close() (err error)
+}
+
+// dialNeighConn is the function to dial the netlink route connection, which is
+// subscribed to the multicast groups from the groups bitmask.  It's a variable
+// to substitute in tests.
+var dialNeighConn = func(groups uint32) (c neighConn, err error) {
+	return netlink.Dial(unix.NETLINK_ROUTE, &netlink.Config{Groups: groups})
+}
+
+// netlinkARPDB is the [Watcher] that dumps the neighbor tables using netlink
+// and then keeps them current by subscribing to the RTM_NEWNEIGH and
+// RTM_DELNEIGH notifications.
+type netlinkARPDB struct {
+	logger *slog.Logger
+
+	// events is the channel of the neighborhood changes.
+	events chan Event
+
+	// mu protects the fields below.
+	mu *sync.Mutex
+
+	// table is the current neighborhood.
+	table map[netip.Addr]Neighbor
+
+	// seen is the set of hardware addresses seen since start.  It's limited
+	// to [maxSeenMACs] addresses.
+	seen *container.MapSet[string]
+
+	// sub is the connection subscribed to the neighbor notifications.  It's
+	// nil if the notifications aren't received.
+	sub neighConn
+
+	// dumped is true if the table has been filled at least once.
+	dumped bool
+}
+
+// newNetlinkARPDB returns a new properly initialized *netlinkARPDB.
+func newNetlinkARPDB(logger *slog.Logger) (arp *netlinkARPDB) {
+	return &netlinkARPDB{
+		logger: logger,
+		events: make(chan Event, eventsBufferSize),
+		mu:     &sync.Mutex{},
+		table:  map[netip.Addr]Neighbor{},
+		seen:   container.NewMapSet[string](),
+	}
+}
+
+// type check
+var _ Watcher = (*netlinkARPDB)(nil)
+
+// Refresh implements the [Interface] interface for *netlinkARPDB.  It
+// subscribes to the neighbor notifications, if not subscribed yet, and
+// synchronizes the table with the kernel, since some notifications may be lost
+// when the socket buffer overflows.
+func (arp *netlinkARPDB) Refresh() (err error) {
+	defer func() { err = errors.Annotate(err, "netlink arpdb: %w") }()
+
+	arp.mu.Lock()
+	defer arp.mu.Unlock()
+
+	if arp.sub == nil {
+		// Subscribe before dumping to not miss the changes made in between.
+		arp.sub, err = dialNeighConn(1 << (unix.RTNLGRP_NEIGH - 1))
+		if err != nil {
+			return fmt.Errorf("subscribing: %w", err)
+		}
+
+		go arp.watch(arp.sub)
+	}
+
+	ns, err := dumpNeighbors()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	arp.resetLocked(ns)
+
+	return nil
+}
+
+// Neighbors implements the [Interface] interface for *netlinkARPDB.
+func (arp *netlinkARPDB) Neighbors() (ns []Neighbor) {
+	arp.mu.Lock()
+	defer arp.mu.Unlock()
+
+	ns = make([]Neighbor, 0, len(arp.table))
+	for _, n := range arp.table {
+		ns = append(ns, n.Clone())
+	}
+
+	slices.SortFunc(ns, func(a, b Neighbor) (res int) { return a.IP.Compare(b.IP) })
+
+	return ns
+}
+
+// Events implements the [Watcher] interface for *netlinkARPDB.
+func (arp *netlinkARPDB) Events() (ch <-chan Event) {
+	return arp.events
+}
+
+// dumpNeighbors returns the current neighbors of all the address families.
+func dumpNeighbors() (ns []Neighbor, err error) {
+	c, err := dialNeighConn(0)
+	if err != nil {
+		return nil, fmt.Errorf("dialing: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, c.Close()) }()
+
+	msgs, err := c.Execute(netlink.Message{
+		Header: netlink.Header{
+			Type:  unix.RTM_GETNEIGH,
+			Flags: netlink.Request | netlink.Dump,
+		},
+		// Use AF_UNSPEC to dump both IPv4 and IPv6 neighbors.
+		Data: make([]byte, ndMsgLen),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dumping neighbors: %w", err)
+	}
+
+	for i, m := range msgs {
+		var n *Neighbor
+		n, err = parseNeighMsg(m)
+		if err != nil {
+			return nil, fmt.Errorf("message at index %d: %w", i, err)
+		} else if n != nil && n.MAC != nil {
+			ns = append(ns, *n)
+		}
+	}
+
+	return ns, nil
+}
+
+// watch receives the neighbor notifications from c and applies those to the
+// table.  It's intended to be used as a goroutine.
+func (arp *netlinkARPDB) watch(c neighConn) {
+	ctx := context.Background()
+	defer slogutil.RecoverAndLog(ctx, arp.logger)
+
+	for {
+		msgs, err := c.Receive()
+		if err != nil {
+			arp.logger.WarnContext(ctx, "receiving neighbors", slogutil.KeyError, err)
+			arp.unsubscribe(c)
+
+			return
+		}
+
+		for _, m := range msgs {
+			arp.handle(ctx, m)
+		}
+	}
+}
+
+// unsubscribe closes c and resets the subscription, so that the next refresh
+// subscribes again.
+func (arp *netlinkARPDB) unsubscribe(c neighConn) {
+	arp.mu.Lock()
+	defer arp.mu.Unlock()
+
+	err := c.Close()
+	if err != nil {
+		arp.logger.Debug("closing subscription", slogutil.KeyError, err)
+	}
+
+	if arp.sub == c {
+		arp.sub = nil
+	}
+}
+
+// handle applies the neighbor notification m to the table.
+func (arp *netlinkARPDB) handle(ctx context.Context, m netlink.Message) {
+	n, err := parseNeighMsg(m)
+	if err != nil {
+		arp.logger.DebugContext(ctx, "parsing neighbor", slogutil.KeyError, err)
+
+		return
+	} else if n == nil {
+		return
+	}
+
+	arp.mu.Lock()
+	defer arp.mu.Unlock()
+
+	if !arp.dumped {
+		// Wait for the table to be filled first.
+		return
+	}
+
+	if n.MAC == nil {
+		arp.removeLocked(n.IP)
+	} else {
+		arp.updateLocked(*n)
+	}
+}
+
+// resetLocked replaces the table with ns, sending the events for the
+// differences.  arp.mu must be locked.
+func (arp *netlinkARPDB) resetLocked(ns []Neighbor) {
+	if !arp.dumped {
+		// Don't report the initial neighborhood as new devices.
+		for _, n := range ns {
+			arp.table[n.IP] = n
+			arp.addSeenLocked(n.MAC.String())
+		}
+
+		arp.dumped = true
+
+		return
+	}
+
+	current := container.NewMapSet[netip.Addr]()
+	for _, n := range ns {
+		current.Add(n.IP)
+		arp.updateLocked(n)
+	}
+
+	for ip := range arp.table {
+		if !current.Has(ip) {
+			arp.removeLocked(ip)
+		}
+	}
+}
+
+// updateLocked stores n in the table and sends the event, if anything has
+// changed.  arp.mu must be locked.
+func (arp *netlinkARPDB) updateLocked(n Neighbor) {
+	prev, ok := arp.table[n.IP]
+	if ok && bytes.Equal(prev.MAC, n.MAC) {
+		return
+	}
+
+	arp.table[n.IP] = n
+
+	typ := EventTypeUpdate
+	if mac := n.MAC.String(); !arp.seen.Has(mac) {
+		arp.addSeenLocked(mac)
+		typ = EventTypeNew
+	}
+
+	arp.send(Event{Neighbor: n.Clone(), Type: typ})
+}
+
+// maxSeenMACs is the maximum number of hardware addresses remembered by
+// [netlinkARPDB].
+const maxSeenMACs = 10_000
+
+// addSeenLocked remembers mac as seen.  When the limit is reached, the set is
+// refilled with the addresses of the current neighbors only, so that the
+// devices that have left the network long ago may be reported as new again.
+// arp.mu must be locked.
+func (arp *netlinkARPDB) addSeenLocked(mac string) {
+	if arp.seen.Len() >= maxSeenMACs {
+		arp.seen.Clear()
+		for _, n := range arp.table {
+			if n.MAC != nil {
+				arp.seen.Add(n.MAC.String())
+			}
+		}
+	}
+
+	arp.seen.Add(mac)
+}
+
+// removeLocked removes the neighbor with ip from the table and sends the event,
+// if there was one.  arp.mu must be locked.
+func (arp *netlinkARPDB) removeLocked(ip netip.Addr) {
+	n, ok := arp.table[ip]
+	if !ok {
+		return
+	}
+
+	delete(arp.table, ip)
+
+	arp.send(Event{Neighbor: n, Type: EventTypeDelete})
+}
+
+// send sends e without blocking, dropping it if nobody receives the events.
+func (arp *netlinkARPDB) send(e Event) {
+	select {
+	case arp.events <- e:
+	default:
+		arp.logger.Debug("dropping event", "type", e.Type, "ip", e.Neighbor.IP)
+	}
+}
+
+// parseNeighMsg parses the RTM_NEWNEIGH or RTM_DELNEIGH message.  n is nil if m
+// should be ignored.  n.MAC is nil if the neighbor has been removed or isn't
+// reachable anymore.
+func parseNeighMsg(m netlink.Message) (n *Neighbor, err error) {
+	typ := m.Header.Type
+	if typ != unix.RTM_NEWNEIGH && typ != unix.RTM_DELNEIGH {
+		return nil, nil
+	}
+
+	if l := len(m.Data); l < ndMsgLen {
+		return nil, fmt.Errorf("ndmsg: bad length %d", l)
+	}
+
+	if fam := m.Data[0]; fam != unix.AF_INET && fam != unix.AF_INET6 {
+		return nil, nil
+	}
+
+	state := binary.NativeEndian.Uint16(m.Data[8:10])
+	if state&unix.NUD_NOARP != 0 {
+		// Skip the entries not related to the actual devices, like multicast
+		// and loopback ones.
+		return nil, nil
+	}
+
+	ip, mac, err := parseNeighAttrs(m.Data[ndMsgLen:])
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	} else if !ip.IsValid() || ip.IsUnspecified() || ip.IsMulticast() {
+		return nil, nil
+	}
+
+	n = &Neighbor{IP: ip}
+	if typ == unix.RTM_NEWNEIGH && state&(unix.NUD_INCOMPLETE|unix.NUD_FAILED) == 0 {
+		n.MAC = mac
+	}
+
+	return n, nil
+}
+
+// parseNeighAttrs parses the destination address and the link-layer address
+// from the attributes of the neighbor message.  mac is nil if it's absent or
+// consists of zeroes.
+func parseNeighAttrs(data []byte) (ip netip.Addr, mac net.HardwareAddr, err error) {
+	ad, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return netip.Addr{}, nil, fmt.Errorf("attributes: %w", err)
+	}
+
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.NDA_DST:
+			ip, _ = netip.AddrFromSlice(ad.Bytes())
+		case unix.NDA_LLADDR:
+			mac = net.HardwareAddr(ad.Bytes())
+		}
+	}
+
+	if err = ad.Err(); err != nil {
+		return netip.Addr{}, nil, fmt.Errorf("attributes: %w", err)
+	}
+
+	if !slices.ContainsFunc(mac, func(b byte) (ok bool) { return b != 0 }) {
+		mac = nil
+	}
+
+	return ip, mac, nil
+}
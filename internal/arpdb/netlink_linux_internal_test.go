@@ -0,0 +1,249 @@
+//go:build linux
+
+package arpdb
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/mdlayher/netlink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testNeighConn is the mock implementation of [neighConn] for tests.
+type testNeighConn struct {
+	onExecute func(m netlink.Message) (msgs []netlink.Message, err error)
+	onReceive func() (msgs []netlink.Message, err error)
+}
+
+// type check
+var _ neighConn = (*testNeighConn)(nil)
+
+// Execute implements the [neighConn] interface for *testNeighConn.
+func (c *testNeighConn) Execute(m netlink.Message) (msgs []netlink.Message, err error) {
+	return c.onExecute(m)
+}
+
+// Receive implements the [neighConn] interface for *testNeighConn.
+func (c *testNeighConn) Receive() (msgs []netlink.Message, err error) {
+	return c.onReceive()
+}
+
+// Close implements the [neighConn] interface for *testNeighConn.
+func (c *testNeighConn) Close() (err error) {
+	return nil
+}
+
+// newNeighMsg returns a new neighbor message with the given parameters.
+func newNeighMsg(
+	tb testing.TB,
+	typ netlink.HeaderType,
+	state uint16,
+	ip netip.Addr,
+	mac net.HardwareAddr,
+) (m netlink.Message) {
+	tb.Helper()
+
+	data := make([]byte, ndMsgLen)
+	data[0] = unix.AF_INET
+	if ip.Is6() {
+		data[0] = unix.AF_INET6
+	}
+
+	binary.NativeEndian.PutUint16(data[8:10], state)
+
+	ae := netlink.NewAttributeEncoder()
+	ae.Bytes(unix.NDA_DST, ip.AsSlice())
+	if mac != nil {
+		ae.Bytes(unix.NDA_LLADDR, mac)
+	}
+
+	attrs, err := ae.Encode()
+	require.NoError(tb, err)
+
+	return netlink.Message{
+		Header: netlink.Header{Type: typ},
+		Data:   append(data, attrs...),
+	}
+}
+
+func TestNetlinkARPDB(t *testing.T) {
+	var (
+		ip1  = netip.MustParseAddr("192.168.1.2")
+		ip2  = netip.MustParseAddr("192.168.1.3")
+		ip6  = netip.MustParseAddr("fe80::1")
+		mac1 = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+		mac2 = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+		mac6 = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x06}
+	)
+
+	dump := []netlink.Message{
+		newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_REACHABLE, ip1, mac1),
+		newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_STALE, ip6, mac6),
+		newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_NOARP, netip.MustParseAddr("224.0.0.1"), nil),
+		newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_INCOMPLETE, netip.MustParseAddr("192.168.1.4"), nil),
+	}
+
+	notifications := make(chan []netlink.Message)
+	dumpConn := &testNeighConn{
+		onExecute: func(_ netlink.Message) (msgs []netlink.Message, err error) { return dump, nil },
+		onReceive: func() (msgs []netlink.Message, err error) { panic("not implemented") },
+	}
+	subConn := &testNeighConn{
+		onExecute: func(_ netlink.Message) (msgs []netlink.Message, err error) {
+			panic("not implemented")
+		},
+		onReceive: func() (msgs []netlink.Message, err error) {
+			msgs, ok := <-notifications
+			if !ok {
+				return nil, net.ErrClosed
+			}
+
+			return msgs, nil
+		},
+	}
+
+	prevDial := dialNeighConn
+	t.Cleanup(func() { dialNeighConn = prevDial })
+	dialNeighConn = func(groups uint32) (c neighConn, err error) {
+		if groups == 0 {
+			return dumpConn, nil
+		}
+
+		return subConn, nil
+	}
+
+	arp := newNetlinkARPDB(slogutil.NewDiscardLogger())
+	t.Cleanup(func() { close(notifications) })
+
+	require.NoError(t, arp.Refresh())
+
+	assert.Equal(t, []Neighbor{{IP: ip1, MAC: mac1}, {IP: ip6, MAC: mac6}}, arp.Neighbors())
+
+	testCases := []struct {
+		msg  netlink.Message
+		want Event
+		name string
+	}{{
+		msg:  newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_REACHABLE, ip2, mac2),
+		want: Event{Neighbor: Neighbor{IP: ip2, MAC: mac2}, Type: EventTypeNew},
+		name: "new",
+	}, {
+		msg:  newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_FAILED, ip1, nil),
+		want: Event{Neighbor: Neighbor{IP: ip1, MAC: mac1}, Type: EventTypeDelete},
+		name: "failed",
+	}, {
+		msg:  newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_REACHABLE, ip1, mac1),
+		want: Event{Neighbor: Neighbor{IP: ip1, MAC: mac1}, Type: EventTypeUpdate},
+		name: "reachable_again",
+	}, {
+		msg:  newNeighMsg(t, unix.RTM_DELNEIGH, unix.NUD_STALE, ip6, mac6),
+		want: Event{Neighbor: Neighbor{IP: ip6, MAC: mac6}, Type: EventTypeDelete},
+		name: "deleted",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.RequireSend(t, notifications, []netlink.Message{tc.msg}, testTimeout)
+
+			e, ok := testutil.RequireReceive(t, arp.Events(), testTimeout)
+			require.True(t, ok)
+
+			assert.Equal(t, tc.want, e)
+		})
+	}
+
+	assert.Equal(t, []Neighbor{{IP: ip1, MAC: mac1}, {IP: ip2, MAC: mac2}}, arp.Neighbors())
+
+	t.Run("resync", func(t *testing.T) {
+		dump = dump[:1]
+
+		require.NoError(t, arp.Refresh())
+
+		e, ok := testutil.RequireReceive(t, arp.Events(), testTimeout)
+		require.True(t, ok)
+
+		want := Event{Neighbor: Neighbor{IP: ip2, MAC: mac2}, Type: EventTypeDelete}
+		assert.Equal(t, want, e)
+	})
+}
+
+func TestParseNeighMsg(t *testing.T) {
+	ip := netip.MustParseAddr("192.168.1.2")
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+	testCases := []struct {
+		want       *Neighbor
+		name       string
+		wantErrMsg string
+		msg        netlink.Message
+	}{{
+		want:       &Neighbor{IP: ip, MAC: mac},
+		name:       "reachable",
+		wantErrMsg: "",
+		msg:        newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_REACHABLE, ip, mac),
+	}, {
+		want:       &Neighbor{IP: ip},
+		name:       "zero_mac",
+		wantErrMsg: "",
+		msg:        newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_STALE, ip, make(net.HardwareAddr, 6)),
+	}, {
+		want:       nil,
+		name:       "noarp",
+		wantErrMsg: "",
+		msg:        newNeighMsg(t, unix.RTM_NEWNEIGH, unix.NUD_NOARP, ip, mac),
+	}, {
+		want:       nil,
+		name:       "other_type",
+		wantErrMsg: "",
+		msg:        newNeighMsg(t, unix.RTM_NEWLINK, unix.NUD_REACHABLE, ip, mac),
+	}, {
+		want:       nil,
+		name:       "bad_length",
+		wantErrMsg: "ndmsg: bad length 1",
+		msg: netlink.Message{
+			Header: netlink.Header{Type: unix.RTM_NEWNEIGH},
+			Data:   []byte{unix.AF_INET},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := parseNeighMsg(tc.msg)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, n)
+		})
+	}
+}
+
+func TestNetlinkARPDB_addSeenLocked(t *testing.T) {
+	ip := netip.MustParseAddr("192.168.1.2")
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+	arp := newNetlinkARPDB(slogutil.NewDiscardLogger())
+	arp.table[ip] = Neighbor{IP: ip, MAC: mac}
+
+	for i := range maxSeenMACs {
+		arp.addSeenLocked(net.HardwareAddr{0x02, 0x01, 0x00, 0x00, byte(i >> 8), byte(i)}.String())
+	}
+
+	require.Equal(t, maxSeenMACs, arp.seen.Len())
+
+	last := net.HardwareAddr{0x02, 0x02, 0x00, 0x00, 0x00, 0x00}.String()
+	arp.addSeenLocked(last)
+
+	assert.Equal(t, 2, arp.seen.Len())
+	assert.True(t, arp.seen.Has(mac.String()))
+	assert.True(t, arp.seen.Has(last))
+}
@@ -0,0 +1,200 @@
+// Package audit implements the append-only log of the configuration changes
+// made through the HTTP API.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// maxValueSize is the maximum size of the JSON representation of a changed
+// value kept in the log.  Larger values are replaced with a placeholder.
+const maxValueSize = 4 * 1024
+
+// Entry is a record about a configuration change.
+type Entry struct {
+	// Time is the time of the change.
+	Time time.Time `json:"time"`
+
+	// IP is the address of the client that has made the change.
+	IP netip.Addr `json:"ip"`
+
+	// User is the name of the web user that has made the change, if any.
+	User string `json:"user,omitempty"`
+
+	// APIToken is the name of the API token used for the change, if any.
+	APIToken string `json:"api_token,omitempty"`
+
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+
+	// Endpoint is the path of the HTTP API, for example
+	// "/control/protection".
+	Endpoint string `json:"endpoint"`
+
+	// Changes are the changes of the configuration.
+	Changes []*Change `json:"changes"`
+}
+
+// Config is the configuration structure for a *Log.
+type Config struct {
+	// Logger is used for logging the operation of the audit log.  It must not
+	// be nil.
+	Logger *slog.Logger
+
+	// Syslog, if not nil, receives a copy of each entry.
+	Syslog io.Writer
+
+	// Path is the path to the log file.  It must not be empty.
+	Path string
+}
+
+// Log is the append-only audit log of the configuration changes.  The entries
+// are stored in a file as JSON lines.
+type Log struct {
+	logger *slog.Logger
+	syslog io.Writer
+
+	// mu protects file.
+	mu   *sync.Mutex
+	file *os.File
+	path string
+}
+
+// New returns a new properly initialized *Log.  c must not be nil and must be
+// valid.
+func New(c *Config) (l *Log, err error) {
+	f, err := os.OpenFile(c.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, aghos.DefaultPermFile)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+
+	return &Log{
+		logger: c.Logger,
+		syslog: c.Syslog,
+		mu:     &sync.Mutex{},
+		file:   f,
+		path:   c.Path,
+	}, nil
+}
+
+// Record appends e to the log.  The values of the changes that are too large
+// are replaced with a placeholder.
+func (l *Log) Record(ctx context.Context, e *Entry) (err error) {
+	for _, c := range e.Changes {
+		c.Old, c.New = capValue(c.Old), capValue(c.New)
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding audit entry: %w", err)
+	}
+
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(data)
+	if err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+
+	if l.syslog != nil {
+		_, err = l.syslog.Write(append([]byte("audit: "), data...))
+		if err != nil {
+			l.logger.WarnContext(ctx, "writing audit entry to syslog", slogutil.KeyError, err)
+		}
+	}
+
+	return nil
+}
+
+// capValue returns v or a placeholder if its JSON representation is longer
+// than [maxValueSize].
+func capValue(v any) (res any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("[unencodable value: %s]", err)
+	} else if len(data) > maxValueSize {
+		return fmt.Sprintf("[%d bytes omitted]", len(data))
+	}
+
+	return v
+}
+
+// Query is the filter for the entries of the log.
+type Query struct {
+	// Before, if not zero, only matches the entries made before it.
+	Before time.Time
+
+	// User, if not empty, only matches the entries made by this user.
+	User string
+
+	// Limit is the maximum number of the returned entries.  It must be
+	// positive.
+	Limit int
+}
+
+// matches returns true if e matches q.
+func (q *Query) matches(e *Entry) (ok bool) {
+	return (q.Before.IsZero() || e.Time.Before(q.Before)) && (q.User == "" || e.User == q.User)
+}
+
+// Query returns the newest entries matching q, newest first.
+func (l *Log) Query(ctx context.Context, q *Query) (entries []*Entry, err error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	r := bufio.NewReader(f)
+	for lineNum := 1; ; lineNum++ {
+		line, readErr := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			e := &Entry{}
+			decErr := json.Unmarshal(line, e)
+			if decErr != nil {
+				l.logger.WarnContext(ctx, "bad audit entry", "line", lineNum, slogutil.KeyError, decErr)
+			} else if q.matches(e) {
+				entries = append(entries, e)
+				if len(entries) > q.Limit {
+					entries = entries[1:]
+				}
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return nil, fmt.Errorf("reading audit log: %w", readErr)
+		}
+	}
+
+	slices.Reverse(entries)
+
+	return entries, nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
@@ -0,0 +1,139 @@
+package audit_test
+
+import (
+	"bytes"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/audit"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	before := map[string]any{
+		"dns": map[string]any{
+			"protection_enabled": true,
+			"upstream_dns":       []any{"1.1.1.1", "8.8.8.8"},
+		},
+		"users": []any{
+			map[string]any{"name": "admin", "password": "hash1"},
+		},
+		"user_rules": []any{"||a.example^", "||b.example^"},
+		"oidc":       map[string]any{"client_secret": "old"},
+		"language":   "en",
+	}
+
+	after := map[string]any{
+		"dns": map[string]any{
+			"protection_enabled": false,
+			"upstream_dns":       []any{"1.1.1.1", "9.9.9.9"},
+		},
+		"users": []any{
+			map[string]any{"name": "admin", "password": "hash2"},
+			map[string]any{"name": "kid", "password": "hash3"},
+		},
+		"user_rules": []any{"||a.example^", "||c.example^", "||d.example^"},
+		"oidc":       map[string]any{"client_secret": "new"},
+		"theme":      "dark",
+	}
+
+	want := []*audit.Change{{
+		Old:  true,
+		New:  false,
+		Path: "dns.protection_enabled",
+	}, {
+		Old:  "8.8.8.8",
+		New:  "9.9.9.9",
+		Path: "dns.upstream_dns[1]",
+	}, {
+		Old:  "en",
+		New:  nil,
+		Path: "language",
+	}, {
+		Old:  audit.Redacted,
+		New:  audit.Redacted,
+		Path: "oidc.client_secret",
+	}, {
+		Old:  nil,
+		New:  "dark",
+		Path: "theme",
+	}, {
+		Old:       []any{"||b.example^"},
+		New:       []any{"||c.example^", "||d.example^"},
+		Path:      "user_rules",
+		ListDelta: true,
+	}, {
+		Old: []any{
+			map[string]any{"name": "admin", "password": audit.Redacted},
+		},
+		New: []any{
+			map[string]any{"name": "admin", "password": audit.Redacted},
+			map[string]any{"name": "kid", "password": audit.Redacted},
+		},
+		Path: "users",
+	}}
+
+	assert.Equal(t, want, audit.Diff(before, after))
+	assert.Empty(t, audit.Diff(before, before))
+}
+
+func TestLog(t *testing.T) {
+	syslog := &bytes.Buffer{}
+	l, err := audit.New(&audit.Config{
+		Logger: slogutil.NewDiscardLogger(),
+		Syslog: syslog,
+		Path:   filepath.Join(t.TempDir(), "audit.log"),
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := []string{"admin", "kid", "admin"}
+	for i, u := range users {
+		err = l.Record(ctx, &audit.Entry{
+			Time:     start.Add(time.Duration(i) * time.Minute),
+			IP:       netip.MustParseAddr("192.0.2.1"),
+			User:     u,
+			Method:   "POST",
+			Endpoint: "/control/protection",
+			Changes: []*audit.Change{{
+				Old:  strings.Repeat("a", 5000),
+				New:  i,
+				Path: "dns.protection_enabled",
+			}},
+		})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, len(users), strings.Count(syslog.String(), "audit: "))
+
+	entries, err := l.Query(ctx, &audit.Query{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, start.Add(2*time.Minute), entries[0].Time)
+	assert.Equal(t, "[5002 bytes omitted]", entries[0].Changes[0].Old)
+
+	entries, err = l.Query(ctx, &audit.Query{User: "admin", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	assert.Equal(t, start.Add(2*time.Minute), entries[0].Time)
+
+	entries, err = l.Query(ctx, &audit.Query{
+		Before: start.Add(2 * time.Minute),
+		Limit:  10,
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "kid", entries[0].User)
+	assert.Equal(t, "admin", entries[1].User)
+}
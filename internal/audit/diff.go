@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/container"
+)
+
+// Redacted replaces the values of the sensitive configuration fields in the
+// changes.
+const Redacted = "[redacted]"
+
+// sensitiveKeys are the keys of the configuration fields containing secrets.
+var sensitiveKeys = container.NewMapSet(
+	"client_secret",
+	"password",
+	"password_hash",
+	"private_key",
+	"secret",
+	"token",
+)
+
+// isSensitive returns true if the field with key contains a secret.
+func isSensitive(key string) (ok bool) {
+	return sensitiveKeys.Has(strings.ToLower(key))
+}
+
+// Change is a change of a configuration field.
+type Change struct {
+	// Old is the previous value of the field.  It's nil if the field has been
+	// added.
+	Old any `json:"old"`
+
+	// New is the new value of the field.  It's nil if the field has been
+	// removed.
+	New any `json:"new"`
+
+	// Path is the dot-separated path to the field, for example
+	// "dns.protection_enabled".  The indexes of list elements are in square
+	// brackets, for example "filters[1].enabled".
+	Path string `json:"path"`
+
+	// ListDelta is true if the field is a list of scalars that has changed
+	// its length.  Old and New then only contain the removed and the added
+	// elements, respectively.
+	ListDelta bool `json:"list_delta,omitempty"`
+}
+
+// Diff returns the changes between the configuration documents before and
+// after, as decoded from YAML or JSON into maps.  The values of the sensitive
+// fields are replaced with [Redacted].  The changes are sorted by path.
+func Diff(before, after map[string]any) (changes []*Change) {
+	changes = diffValues(changes, "", false, before, after)
+	slices.SortFunc(changes, func(a, b *Change) (res int) {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return changes
+}
+
+// diffValues appends the changes between the values a and b at path to
+// changes.  sensitive is true if the values are secrets.
+func diffValues(changes []*Change, path string, sensitive bool, a, b any) (res []*Change) {
+	if reflect.DeepEqual(a, b) {
+		return changes
+	}
+
+	if sensitive {
+		return append(changes, &Change{Old: redactedOrNil(a), New: redactedOrNil(b), Path: path})
+	}
+
+	am, aIsMap := toStringMap(a)
+	bm, bIsMap := toStringMap(b)
+	if aIsMap && bIsMap {
+		return diffMaps(changes, path, am, bm)
+	}
+
+	al, aIsList := a.([]any)
+	bl, bIsList := b.([]any)
+	if aIsList && bIsList {
+		if len(al) == len(bl) {
+			for i := range al {
+				changes = diffValues(changes, fmt.Sprintf("%s[%d]", path, i), false, al[i], bl[i])
+			}
+
+			return changes
+		} else if isScalars(al) && isScalars(bl) {
+			return append(changes, &Change{
+				Old:       listDiff(al, bl),
+				New:       listDiff(bl, al),
+				Path:      path,
+				ListDelta: true,
+			})
+		}
+	}
+
+	return append(changes, &Change{Old: redact(a), New: redact(b), Path: path})
+}
+
+// diffMaps appends the changes between the maps a and b at path to changes.
+func diffMaps(changes []*Change, path string, a, b map[string]any) (res []*Change) {
+	keys := container.NewMapSet[string]()
+	for k := range a {
+		keys.Add(k)
+	}
+
+	for k := range b {
+		keys.Add(k)
+	}
+
+	for _, k := range keys.Values() {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+
+		changes = diffValues(changes, p, isSensitive(k), a[k], b[k])
+	}
+
+	return changes
+}
+
+// isScalars returns true if l only contains scalar values.
+func isScalars(l []any) (ok bool) {
+	for _, v := range l {
+		switch v.(type) {
+		case map[string]any, map[any]any, []any:
+			return false
+		}
+	}
+
+	return true
+}
+
+// listDiff returns the elements of a missing from b.  a and b must only
+// contain scalar values.
+func listDiff(a, b []any) (diff []any) {
+	counts := make(map[any]int, len(b))
+	for _, v := range b {
+		counts[v]++
+	}
+
+	diff = []any{}
+	for _, v := range a {
+		if counts[v] > 0 {
+			counts[v]--
+		} else {
+			diff = append(diff, v)
+		}
+	}
+
+	return diff
+}
+
+// toStringMap converts v into a map with string keys, if it's a map.
+func toStringMap(v any) (m map[string]any, ok bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		return v, true
+	case map[any]any:
+		m = make(map[string]any, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = val
+		}
+
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// redactedOrNil returns [Redacted] if v is not nil.
+func redactedOrNil(v any) (res any) {
+	if v == nil {
+		return nil
+	}
+
+	return Redacted
+}
+
+// redact returns a copy of v with the values of the sensitive fields replaced
+// with [Redacted].
+func redact(v any) (res any) {
+	if m, ok := toStringMap(v); ok {
+		redacted := make(map[string]any, len(m))
+		for k, val := range m {
+			if isSensitive(k) {
+				redacted[k] = redactedOrNil(val)
+			} else {
+				redacted[k] = redact(val)
+			}
+		}
+
+		return redacted
+	}
+
+	if l, ok := v.([]any); ok {
+		redacted := make([]any, len(l))
+		for i, val := range l {
+			redacted[i] = redact(val)
+		}
+
+		return redacted
+	}
+
+	return v
+}
@@ -0,0 +1,98 @@
+// Package blockpage implements the HTTP(S) server showing the page that
+// explains why a domain has been blocked.  It is intended to be used together
+// with the custom IP blocking mode, so that the blocked requests are answered
+// with the address of this server.
+package blockpage
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Reason is the reason for blocking a domain as shown on the block page.
+type Reason string
+
+// Valid reasons.
+const (
+	// ReasonFilterList means that the domain is blocked by a filtering rule.
+	ReasonFilterList Reason = "filter_list"
+
+	// ReasonBlockedService means that the domain belongs to a blocked service.
+	ReasonBlockedService Reason = "blocked_service"
+
+	// ReasonCategory means that the domain belongs to a blocked domain
+	// category.
+	ReasonCategory Reason = "category"
+
+	// ReasonParental means that the domain is blocked by the parental control.
+	ReasonParental Reason = "parental"
+
+	// ReasonSafeBrowsing means that the domain is blocked by the safe browsing.
+	ReasonSafeBrowsing Reason = "safe_browsing"
+
+	// ReasonUnknown means that the reason couldn't be determined, for example
+	// because the rules have changed since the domain had been resolved.
+	ReasonUnknown Reason = "unknown"
+)
+
+// Info is the information about a blocked domain shown on the block page.
+type Info struct {
+	// Host is the blocked domain name.
+	Host string
+
+	// Rule is the text of the rule that blocked the domain, if any.
+	Rule string
+
+	// FilterName is the name of the filter list containing Rule, if any.
+	FilterName string
+
+	// ServiceName is the name of the blocked service, if Reason is
+	// [ReasonBlockedService].
+	ServiceName string
+
+	// Category is the name of the blocked domain category, if Reason is
+	// [ReasonCategory].
+	Category string
+
+	// Reason is the reason for blocking the domain.
+	Reason Reason
+}
+
+// Checker determines why a domain is blocked for a client.
+type Checker interface {
+	// Check returns the information about the blocked host for the client with
+	// the given address.  info must not be nil if err is nil.
+	Check(ctx context.Context, host string, cliAddr netip.Addr) (info *Info, err error)
+}
+
+// UnblockRequest is a request from the user of a client to unblock a domain.
+type UnblockRequest struct {
+	// Host is the domain name to unblock.
+	Host string
+
+	// Comment is the optional comment from the user.
+	Comment string
+
+	// ClientID is the optional ClientID the requester has identified itself
+	// with.  Note that it isn't authenticated in any way.
+	ClientID string
+
+	// Reason is the reason the domain has been blocked with.
+	Reason Reason
+
+	// ClientAddr is the address of the client that requested the unblocking.
+	ClientAddr netip.Addr
+}
+
+// ErrTooManyUnblockRequests is returned by [UnblockRequester.RequestUnblock]
+// when the client has filed too many requests.
+const ErrTooManyUnblockRequests errors.Error = "too many unblock requests"
+
+// UnblockRequester files requests to unblock domains for the administrators.
+type UnblockRequester interface {
+	// RequestUnblock files the request.  req must not be nil.  It returns
+	// [ErrTooManyUnblockRequests] if the client has too many pending requests.
+	RequestUnblock(ctx context.Context, req *UnblockRequest) (err error)
+}
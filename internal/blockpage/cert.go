@@ -0,0 +1,179 @@
+package blockpage
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/bluele/gcache"
+)
+
+// Certificate issuing parameters.
+const (
+	// certValidity is the validity period of the issued certificates.
+	certValidity = 7 * 24 * time.Hour
+
+	// certBackdate is the duration to backdate the issued certificates with
+	// to tolerate the clock skew of the clients.
+	certBackdate = 1 * time.Hour
+
+	// certCacheSize is the maximum number of cached issued certificates.
+	certCacheSize = 1024
+
+	// certCacheTTL is the time the issued certificates are cached for.  It must
+	// be less than certValidity.
+	certCacheTTL = certValidity / 2
+)
+
+// certIssuer issues the certificates for the blocked domains on the fly using
+// a local certificate authority.
+type certIssuer struct {
+	// caCert is the certificate of the local certificate authority.
+	caCert *x509.Certificate
+
+	// caKey is the private key of the local certificate authority.
+	caKey crypto.Signer
+
+	// leafKey is the private key shared by all issued certificates.
+	leafKey *ecdsa.PrivateKey
+
+	// cache contains the issued certificates by the server name.
+	cache gcache.Cache
+
+	// mu serializes the issuing of the certificates, so that the same
+	// certificate isn't issued several times concurrently.
+	mu *sync.Mutex
+}
+
+// newCertIssuer loads the certificate authority from the PEM files and
+// returns a new certificate issuer.
+func newCertIssuer(certPath, keyPath string) (ci *certIssuer, err error) {
+	if certPath == "" || keyPath == "" {
+		return nil, errors.Error("certificate and private key paths must be set")
+	}
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading key pair: %w", err)
+	}
+
+	caCert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	if !caCert.IsCA || caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.Error("certificate is not allowed to sign certificates")
+	}
+
+	caKey, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", pair.PrivateKey)
+	}
+
+	return newCertIssuerFromCA(caCert, caKey)
+}
+
+// newCertIssuerFromCA returns a new certificate issuer with the given
+// certificate authority.
+func newCertIssuerFromCA(caCert *x509.Certificate, caKey crypto.Signer) (ci *certIssuer, err error) {
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating leaf key: %w", err)
+	}
+
+	return &certIssuer{
+		caCert:  caCert,
+		caKey:   caKey,
+		leafKey: leafKey,
+		cache:   gcache.New(certCacheSize).LRU().Build(),
+		mu:      &sync.Mutex{},
+	}, nil
+}
+
+// getCertificate is the [tls.Config.GetCertificate] function issuing the
+// certificate for the server name requested by the client.
+func (ci *certIssuer) getCertificate(hello *tls.ClientHelloInfo) (cert *tls.Certificate, err error) {
+	name := strings.ToLower(hello.ServerName)
+	if name == "" {
+		addr, parseErr := netip.ParseAddrPort(hello.Conn.LocalAddr().String())
+		if parseErr != nil {
+			return nil, fmt.Errorf("getting local address: %w", parseErr)
+		}
+
+		name = addr.Addr().Unmap().String()
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	cached, err := ci.cache.Get(name)
+	if err == nil {
+		return cached.(*tls.Certificate), nil
+	}
+
+	cert, err = ci.issue(name, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("issuing certificate for %q: %w", name, err)
+	}
+
+	err = ci.cache.SetWithExpire(name, cert, certCacheTTL)
+	if err != nil {
+		// Shouldn't happen, since the cache has no loader functions.
+		panic(err)
+	}
+
+	return cert, nil
+}
+
+// issue returns a new certificate for name, which is either a hostname or an
+// IP address, signed by the certificate authority.
+func (ci *certIssuer) issue(name string, now time.Time) (cert *tls.Certificate, err error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-certBackdate),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	if addr, parseErr := netip.ParseAddr(name); parseErr == nil {
+		tmpl.IPAddresses = append(tmpl.IPAddresses, addr.AsSlice())
+	} else {
+		tmpl.DNSNames = append(tmpl.DNSNames, name)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ci.caCert, &ci.leafKey.PublicKey, ci.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ci.caCert.Raw},
+		PrivateKey:  ci.leafKey,
+		Leaf:        leaf,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package blockpage
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCA is a helper that returns a new self-signed certificate authority.
+func newTestCA(t *testing.T) (cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+func TestCertIssuer_issue(t *testing.T) {
+	caCert, caKey := newTestCA(t)
+
+	ci, err := newCertIssuerFromCA(caCert, caKey)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	testCases := []struct {
+		name string
+		host string
+	}{{
+		name: "domain",
+		host: "blocked.example",
+	}, {
+		name: "ip",
+		host: "192.0.2.1",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cert, issueErr := ci.issue(tc.host, time.Now())
+			require.NoError(t, issueErr)
+			require.NotNil(t, cert.Leaf)
+
+			_, verifyErr := cert.Leaf.Verify(x509.VerifyOptions{
+				DNSName: tc.host,
+				Roots:   roots,
+			})
+			assert.NoError(t, verifyErr)
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package blockpage
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// UnblockPath is the path of the block page server handling the requests to
+// unblock a domain.  It's unlikely to clash with the paths of the blocked
+// websites, since those never reach the server.  The requests are POST forms
+// with the fields "host", "comment", and an optional "client_id", so that it
+// also serves as the API for the clients identified by their ClientIDs.
+const UnblockPath = "/.well-known/nullprivate/unblock"
+
+// MaxCommentLen is the maximum length of the comment in an unblock request, in
+// bytes.
+const MaxCommentLen = 512
+
+// maxFormSize is the maximum size of the unblock request form, in bytes.
+const maxFormSize = 4 * MaxCommentLen
+
+// Server timeouts.
+const (
+	readTimeout     = 10 * time.Second
+	writeTimeout    = 10 * time.Second
+	shutdownTimeout = 5 * time.Second
+)
+
+//go:embed templates/default.html
+var templatesFS embed.FS
+
+// defaultTemplateName is the name of the template used when there is no
+// reason-specific one.
+const defaultTemplateName = "default"
+
+// Config is the configuration structure for the block page server.
+type Config struct {
+	// Logger is used for logging the operation of the server.  It must not be
+	// nil.
+	Logger *slog.Logger
+
+	// Checker determines why domains are blocked.  It must not be nil.
+	Checker Checker
+
+	// UnblockRequester files the requests to unblock domains.  If it's nil,
+	// the users aren't offered to request unblocking.
+	UnblockRequester UnblockRequester
+
+	// Messages are the messages shown on the block page for each reason.  The
+	// default messages are used for the missing reasons.
+	Messages map[Reason]string
+
+	// CACertPath is the path to the PEM-encoded certificate of the local
+	// certificate authority used to issue the certificates for the blocked
+	// domains.  It must be set if HTTPSAddr is set.
+	CACertPath string
+
+	// CAKeyPath is the path to the PEM-encoded private key of the local
+	// certificate authority.  It must be set if HTTPSAddr is set.
+	CAKeyPath string
+
+	// TemplatesDir is the optional directory containing custom templates.  The
+	// templates are looked up by the reason, like "parental.html", with the
+	// fallback to "default.html".
+	TemplatesDir string
+
+	// HTTPAddr is the address to serve the plain HTTP block page on.  It's
+	// not served if the address is not valid.
+	HTTPAddr netip.AddrPort
+
+	// HTTPSAddr is the address to serve the HTTPS block page on.  It's not
+	// served if the address is not valid.
+	HTTPSAddr netip.AddrPort
+}
+
+// Server serves the block page.
+type Server struct {
+	// logger is used for logging the operation of the server.
+	logger *slog.Logger
+
+	// checker determines why domains are blocked.
+	checker Checker
+
+	// requester files the requests to unblock domains.  It may be nil.
+	requester UnblockRequester
+
+	// templates are the block page templates by the reason and the
+	// [defaultTemplateName].
+	templates map[string]*template.Template
+
+	// messages are the messages shown on the block page for each reason.
+	messages map[Reason]string
+
+	// mu protects servers.
+	mu *sync.Mutex
+
+	// servers are the running HTTP servers.
+	servers []*http.Server
+
+	// issuer issues the certificates for the blocked domains.  It's nil if
+	// HTTPS isn't served.
+	issuer *certIssuer
+
+	// httpAddr is the address of the plain HTTP server.
+	httpAddr netip.AddrPort
+
+	// httpsAddr is the address of the HTTPS server.
+	httpsAddr netip.AddrPort
+}
+
+// defaultMessages are the messages shown on the block page by default.
+var defaultMessages = map[Reason]string{
+	ReasonFilterList:     "Access to this domain has been blocked by a filtering rule.",
+	ReasonBlockedService: "Access to this service has been blocked by the administrator.",
+	ReasonCategory:       "Access to this category of websites has been blocked by the administrator.",
+	ReasonParental:       "Access to this domain has been blocked by the parental control.",
+	ReasonSafeBrowsing:   "This domain is known to distribute malware or to be used for phishing.",
+	ReasonUnknown:        "Access to this domain has been blocked.",
+}
+
+// New returns a new properly initialized block page server.  conf must not be
+// nil.
+func New(conf *Config) (s *Server, err error) {
+	s = &Server{
+		logger:    conf.Logger,
+		checker:   conf.Checker,
+		requester: conf.UnblockRequester,
+		messages:  make(map[Reason]string, len(defaultMessages)),
+		mu:        &sync.Mutex{},
+		httpAddr:  conf.HTTPAddr,
+		httpsAddr: conf.HTTPSAddr,
+	}
+
+	for r, msg := range defaultMessages {
+		s.messages[r] = cmp.Or(conf.Messages[r], msg)
+	}
+
+	s.templates, err = loadTemplates(conf.TemplatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("loading templates: %w", err)
+	}
+
+	if conf.HTTPSAddr.IsValid() {
+		s.issuer, err = newCertIssuer(conf.CACertPath, conf.CAKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading certificate authority: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// loadTemplates parses the default template and the custom templates from dir,
+// if it's not empty.
+func loadTemplates(dir string) (tmpls map[string]*template.Template, err error) {
+	def, err := template.ParseFS(templatesFS, "templates/default.html")
+	if err != nil {
+		return nil, fmt.Errorf("parsing default template: %w", err)
+	}
+
+	tmpls = map[string]*template.Template{
+		defaultTemplateName: def,
+	}
+
+	if dir == "" {
+		return tmpls, nil
+	}
+
+	names := []string{
+		defaultTemplateName,
+		string(ReasonFilterList),
+		string(ReasonBlockedService),
+		string(ReasonCategory),
+		string(ReasonParental),
+		string(ReasonSafeBrowsing),
+		string(ReasonUnknown),
+	}
+
+	for _, name := range names {
+		fn := filepath.Join(dir, name+".html")
+
+		var t *template.Template
+		t, err = template.ParseFiles(fn)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing template %q: %w", fn, err)
+		}
+
+		tmpls[name] = t
+	}
+
+	return tmpls, nil
+}
+
+// Start starts serving the block page.  It returns an error if any of the
+// listeners couldn't be created.
+func (s *Server) Start(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.httpAddr.IsValid() {
+		err = s.startServer(ctx, s.httpAddr, nil)
+		if err != nil {
+			return fmt.Errorf("starting http server: %w", err)
+		}
+	}
+
+	if s.httpsAddr.IsValid() {
+		tlsConf := &tls.Config{
+			GetCertificate: s.issuer.getCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+
+		err = s.startServer(ctx, s.httpsAddr, tlsConf)
+		if err != nil {
+			return fmt.Errorf("starting https server: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// startServer listens on addr and serves the block page in a separate
+// goroutine.  tlsConf is nil for the plain HTTP.  s.mu must be locked.
+func (s *Server) startServer(ctx context.Context, addr netip.AddrPort, tlsConf *tls.Config) (err error) {
+	l, err := net.Listen("tcp", addr.String())
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
+	if tlsConf != nil {
+		l = tls.NewListener(l, tlsConf)
+	}
+
+	srv := &http.Server{
+		Handler:           s,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readTimeout,
+		WriteTimeout:      writeTimeout,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelDebug),
+	}
+	s.servers = append(s.servers, srv)
+
+	go func() {
+		defer slogutil.RecoverAndLog(ctx, s.logger)
+
+		s.logger.InfoContext(ctx, "listening", "addr", l.Addr(), "tls", tlsConf != nil)
+
+		serveErr := srv.Serve(l)
+		if !errors.Is(serveErr, http.ErrServerClosed) {
+			s.logger.ErrorContext(ctx, "serving", slogutil.KeyError, serveErr)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown gracefully stops the servers.
+func (s *Server) Shutdown(ctx context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, srv := range s.servers {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+
+	s.servers = nil
+
+	return errors.Join(errs...)
+}
+
+// type check
+var _ http.Handler = (*Server)(nil)
+
+// ServeHTTP implements the [http.Handler] interface for *Server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	host := requestHost(r)
+	cliAddr := remoteAddr(r)
+
+	if r.URL.Path == UnblockPath && r.Method == http.MethodPost {
+		s.handleUnblock(ctx, w, r, cliAddr)
+
+		return
+	} else if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	info := s.check(ctx, host, cliAddr)
+	s.render(ctx, w, info, false)
+}
+
+// check returns the information about the blocked host.  It never returns
+// nil.
+func (s *Server) check(ctx context.Context, host string, cliAddr netip.Addr) (info *Info) {
+	if host == "" {
+		return &Info{Reason: ReasonUnknown}
+	}
+
+	info, err := s.checker.Check(ctx, host, cliAddr)
+	if err != nil {
+		s.logger.DebugContext(ctx, "checking host", "host", host, slogutil.KeyError, err)
+
+		return &Info{Host: host, Reason: ReasonUnknown}
+	}
+
+	return info
+}
+
+// handleUnblock handles the form submitted to request unblocking of a domain.
+func (s *Server) handleUnblock(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	cliAddr netip.Addr,
+) {
+	if s.requester == nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+
+		return
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(r.PostForm.Get("host"), "."))
+	if netutil.ValidateHostname(host) != nil {
+		http.Error(w, "bad host", http.StatusBadRequest)
+
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if clientID != "" && client.ValidateClientID(clientID) != nil {
+		http.Error(w, "bad client_id", http.StatusBadRequest)
+
+		return
+	}
+
+	comment := r.PostForm.Get("comment")
+	if len(comment) > MaxCommentLen {
+		comment = comment[:MaxCommentLen]
+	}
+
+	info := s.check(ctx, host, cliAddr)
+	err = s.requester.RequestUnblock(ctx, &UnblockRequest{
+		Host:       host,
+		Comment:    comment,
+		ClientID:   strings.ToLower(clientID),
+		Reason:     info.Reason,
+		ClientAddr: cliAddr,
+	})
+	if err != nil {
+		s.logger.InfoContext(ctx, "requesting unblock", "host", host, slogutil.KeyError, err)
+		writeUnblockError(w, err)
+
+		return
+	}
+
+	s.render(ctx, w, info, true)
+}
+
+// writeUnblockError writes the response for the error of requesting unblock.
+// The error itself isn't sent, since it may contain the details of the
+// filtering.
+func writeUnblockError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrTooManyUnblockRequests) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	} else {
+		code := http.StatusInternalServerError
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+// pageData is the data passed to the block page templates.
+type pageData struct {
+	*Info
+
+	// Title is the title of the page.
+	Title string
+
+	// Message is the message for the reason.
+	Message string
+
+	// UnblockPath is the path of the unblock request form handler.
+	UnblockPath string
+
+	// MaxCommentLen is the maximum length of the comment.
+	MaxCommentLen int
+
+	// CanRequestUnblock is true if the user can request unblocking.
+	CanRequestUnblock bool
+
+	// RequestSent is true if the user has just requested unblocking.
+	RequestSent bool
+}
+
+// render writes the block page for info.
+func (s *Server) render(ctx context.Context, w http.ResponseWriter, info *Info, sent bool) {
+	tmpl, ok := s.templates[string(info.Reason)]
+	if !ok {
+		tmpl = s.templates[defaultTemplateName]
+	}
+
+	data := &pageData{
+		Info:              info,
+		Title:             "Access blocked",
+		Message:           s.messages[info.Reason],
+		UnblockPath:       UnblockPath,
+		MaxCommentLen:     MaxCommentLen,
+		CanRequestUnblock: s.requester != nil && info.Host != "",
+		RequestSent:       sent,
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+
+	err := tmpl.Execute(w, data)
+	if err != nil {
+		s.logger.DebugContext(ctx, "executing template", slogutil.KeyError, err)
+	}
+}
+
+// requestHost returns the normalized hostname the request is sent to.  It
+// returns an empty string if the host is an IP address.
+func requestHost(r *http.Request) (host string) {
+	host = r.Host
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		host = r.TLS.ServerName
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if _, err := netip.ParseAddr(host); err == nil {
+		return ""
+	}
+
+	return host
+}
+
+// remoteAddr returns the address of the client.
+func remoteAddr(r *http.Request) (addr netip.Addr) {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return addrPort.Addr().Unmap()
+}
@@ -0,0 +1,216 @@
+package blockpage_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/blockpage"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testChecker is a [blockpage.Checker] for tests.
+type testChecker struct {
+	onCheck func(ctx context.Context, host string, cliAddr netip.Addr) (info *blockpage.Info, err error)
+}
+
+// type check
+var _ blockpage.Checker = (*testChecker)(nil)
+
+// Check implements the [blockpage.Checker] interface for *testChecker.
+func (c *testChecker) Check(
+	ctx context.Context,
+	host string,
+	cliAddr netip.Addr,
+) (info *blockpage.Info, err error) {
+	return c.onCheck(ctx, host, cliAddr)
+}
+
+// testRequester is a [blockpage.UnblockRequester] for tests.
+type testRequester struct {
+	onRequestUnblock func(ctx context.Context, req *blockpage.UnblockRequest) (err error)
+}
+
+// type check
+var _ blockpage.UnblockRequester = (*testRequester)(nil)
+
+// RequestUnblock implements the [blockpage.UnblockRequester] interface for
+// *testRequester.
+func (r *testRequester) RequestUnblock(ctx context.Context, req *blockpage.UnblockRequest) (err error) {
+	return r.onRequestUnblock(ctx, req)
+}
+
+// testClientAddr is the common client address for tests.
+var testClientAddr = netip.MustParseAddr("192.0.2.1")
+
+// newTestServer is a helper that returns a block page server with a checker
+// blocking every host as a parental one.
+func newTestServer(t *testing.T, req blockpage.UnblockRequester) (s *blockpage.Server) {
+	t.Helper()
+
+	s, err := blockpage.New(&blockpage.Config{
+		Logger: slogutil.NewDiscardLogger(),
+		Checker: &testChecker{
+			onCheck: func(
+				_ context.Context,
+				host string,
+				cliAddr netip.Addr,
+			) (info *blockpage.Info, err error) {
+				assert.Equal(t, testClientAddr, cliAddr)
+
+				return &blockpage.Info{
+					Host:   host,
+					Reason: blockpage.ReasonParental,
+				}, nil
+			},
+		},
+		UnblockRequester: req,
+		Messages: map[blockpage.Reason]string{
+			blockpage.ReasonParental: "Ask your parents.",
+		},
+	})
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "http://blocked.example/some/path", nil)
+	r.RemoteAddr = testClientAddr.String() + ":12345"
+	w := httptest.NewRecorder()
+
+	s.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	body := w.Body.String()
+	assert.Contains(t, body, "blocked.example")
+	assert.Contains(t, body, "Ask your parents.")
+	assert.NotContains(t, body, blockpage.UnblockPath)
+}
+
+func TestServer_ServeHTTP_unblock(t *testing.T) {
+	var got *blockpage.UnblockRequest
+	s := newTestServer(t, &testRequester{
+		onRequestUnblock: func(_ context.Context, req *blockpage.UnblockRequest) (err error) {
+			got = req
+
+			return nil
+		},
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "http://blocked.example/", nil)
+	r.RemoteAddr = testClientAddr.String() + ":12345"
+	w := httptest.NewRecorder()
+
+	s.ServeHTTP(w, r)
+	assert.Contains(t, w.Body.String(), blockpage.UnblockPath)
+
+	form := url.Values{
+		"host":      {"Blocked.Example."},
+		"comment":   {"homework"},
+		"client_id": {"Kids-Laptop"},
+	}
+	r = httptest.NewRequest(
+		http.MethodPost,
+		"http://blocked.example"+blockpage.UnblockPath,
+		strings.NewReader(form.Encode()),
+	)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = testClientAddr.String() + ":12345"
+	w = httptest.NewRecorder()
+
+	s.ServeHTTP(w, r)
+	assert.Contains(t, w.Body.String(), "has been sent")
+
+	require.NotNil(t, got)
+
+	assert.Equal(t, &blockpage.UnblockRequest{
+		Host:       "blocked.example",
+		Comment:    "homework",
+		ClientID:   "kids-laptop",
+		Reason:     blockpage.ReasonParental,
+		ClientAddr: testClientAddr,
+	}, got)
+}
+
+func TestServer_ServeHTTP_unblockError(t *testing.T) {
+	const secret = "filter internals"
+
+	testCases := []struct {
+		err      error
+		name     string
+		wantBody string
+		wantCode int
+	}{{
+		err:      fmt.Errorf("%w: %s", blockpage.ErrTooManyUnblockRequests, secret),
+		name:     "too_many",
+		wantBody: "too many requests\n",
+		wantCode: http.StatusTooManyRequests,
+	}, {
+		err:      errors.Error(secret),
+		name:     "other",
+		wantBody: http.StatusText(http.StatusInternalServerError) + "\n",
+		wantCode: http.StatusInternalServerError,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, &testRequester{
+				onRequestUnblock: func(_ context.Context, _ *blockpage.UnblockRequest) (err error) {
+					return tc.err
+				},
+			})
+
+			form := url.Values{"host": {"blocked.example"}}
+			r := httptest.NewRequest(
+				http.MethodPost,
+				"http://blocked.example"+blockpage.UnblockPath,
+				strings.NewReader(form.Encode()),
+			)
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.RemoteAddr = testClientAddr.String() + ":12345"
+			w := httptest.NewRecorder()
+
+			s.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Equal(t, tc.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestServer_ServeHTTP_unblockBadClientID(t *testing.T) {
+	s := newTestServer(t, &testRequester{
+		onRequestUnblock: func(_ context.Context, _ *blockpage.UnblockRequest) (err error) {
+			panic("not implemented")
+		},
+	})
+
+	form := url.Values{
+		"host":      {"blocked.example"},
+		"client_id": {"kids.laptop"},
+	}
+	r := httptest.NewRequest(
+		http.MethodPost,
+		"http://blocked.example"+blockpage.UnblockPath,
+		strings.NewReader(form.Encode()),
+	)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = testClientAddr.String() + ":12345"
+	w := httptest.NewRecorder()
+
+	s.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/lanname"
 	"github.com/AdguardTeam/AdGuardHome/internal/rdns"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/errors"
@@ -59,6 +60,12 @@ type DefaultAddrProcConfig struct {
 	// address.  It must not be nil.
 	AddressUpdater AddressUpdater
 
+	// LANNameUpdater is used to update the names of the clients discovered in
+	// the local network.  It must not be nil if either
+	// [DefaultAddrProcConfig.UseLLMNR] or [DefaultAddrProcConfig.UseNetBIOS] is
+	// true.
+	LANNameUpdater LANNameUpdater
+
 	// InitialAddresses are the addresses that are queued for processing
 	// immediately by [NewDefaultAddrProc].
 	InitialAddresses []netip.Addr
@@ -79,6 +86,14 @@ type DefaultAddrProcConfig struct {
 
 	// UseWHOIS, if true, enables resolving of client IP addresses using WHOIS.
 	UseWHOIS bool
+
+	// UseLLMNR, if true, enables resolving of private client IP addresses by
+	// querying the LLMNR responders of the clients.
+	UseLLMNR bool
+
+	// UseNetBIOS, if true, enables resolving of private client IPv4 addresses
+	// by querying the NetBIOS name services of the clients.
+	UseNetBIOS bool
 }
 
 // AddressUpdater is the interface for storages of DNS clients that can update
@@ -92,8 +107,17 @@ type AddressUpdater interface {
 	UpdateAddress(ctx context.Context, ip netip.Addr, host string, info *whois.Info)
 }
 
-// DefaultAddrProc processes incoming client addresses with rDNS and WHOIS, if
-// configured, and updates that information in a client storage.
+// LANNameUpdater is the interface for storages of DNS clients that can update
+// the names of the clients discovered in the local network.
+type LANNameUpdater interface {
+	// UpdateAddressSource updates information about an IP address obtained from
+	// src, which must be one of the local network name discovery sources.  host
+	// must not be empty.
+	UpdateAddressSource(ctx context.Context, ip netip.Addr, src Source, host string)
+}
+
+// DefaultAddrProc processes incoming client addresses with rDNS, WHOIS, LLMNR,
+// and NetBIOS, if configured, and updates that information in a client storage.
 type DefaultAddrProc struct {
 	// logger is used to log the operation of address processor.
 	logger *slog.Logger
@@ -110,10 +134,21 @@ type DefaultAddrProc struct {
 	// whois is used to perform WHOIS lookups of clients' IP addresses.
 	whois whois.Interface
 
+	// llmnr is used to perform LLMNR lookups of clients' private IP addresses.
+	llmnr lanname.Interface
+
+	// netbios is used to perform NetBIOS lookups of clients' private IP
+	// addresses.
+	netbios lanname.Interface
+
 	// addrUpdater is used to update the information about a client's IP
 	// address.
 	addrUpdater AddressUpdater
 
+	// lanNameUpdater is used to update the names of the clients discovered in
+	// the local network.
+	lanNameUpdater LANNameUpdater
+
 	// privateSubnets are used to determine if an incoming IP address is
 	// private.
 	privateSubnets netutil.SubnetSet
@@ -136,8 +171,11 @@ const (
 	defaultCacheSize = 10_000
 
 	// defaultIPTTL is the Time to Live duration for IP addresses cached by
-	// rDNS and WHOIS.
+	// rDNS, WHOIS, LLMNR, and NetBIOS.
 	defaultIPTTL = 1 * time.Hour
+
+	// defaultLANNameTimeout is the timeout for LLMNR and NetBIOS queries.
+	defaultLANNameTimeout = 1 * time.Second
 )
 
 // NewDefaultAddrProc returns a new running client address processor.  c must
@@ -149,7 +187,10 @@ func NewDefaultAddrProc(c *DefaultAddrProcConfig) (p *DefaultAddrProc) {
 		clientIPs:      make(chan netip.Addr, defaultQueueSize),
 		rdns:           &rdns.Empty{},
 		addrUpdater:    c.AddressUpdater,
+		lanNameUpdater: c.LANNameUpdater,
 		whois:          &whois.Empty{},
+		llmnr:          lanname.Empty{},
+		netbios:        lanname.Empty{},
 		privateSubnets: c.PrivateSubnets,
 		usePrivateRDNS: c.UsePrivateRDNS,
 	}
@@ -167,6 +208,20 @@ func NewDefaultAddrProc(c *DefaultAddrProcConfig) (p *DefaultAddrProc) {
 		p.whois = newWHOIS(c.BaseLogger.With(slogutil.KeyPrefix, "whois"), c.DialContext)
 	}
 
+	if c.UseLLMNR {
+		p.llmnr = newLANName(c.BaseLogger.With(slogutil.KeyPrefix, "llmnr"), &lanname.LLMNR{
+			Timeout: defaultLANNameTimeout,
+			Port:    lanname.DefaultLLMNRPort,
+		})
+	}
+
+	if c.UseNetBIOS {
+		p.netbios = newLANName(c.BaseLogger.With(slogutil.KeyPrefix, "netbios"), &lanname.NetBIOS{
+			Timeout: defaultLANNameTimeout,
+			Port:    lanname.DefaultNetBIOSPort,
+		})
+	}
+
 	// TODO(s.chzhen):  Pass context.
 	ctx := context.TODO()
 
@@ -212,6 +267,16 @@ func newWHOIS(logger *slog.Logger, dialFunc aghnet.DialContextFunc) (w whois.Int
 	})
 }
 
+// newLANName returns a lanname.Interface instance caching the results of r.
+func newLANName(logger *slog.Logger, r lanname.Resolver) (n lanname.Interface) {
+	return lanname.New(&lanname.Config{
+		Logger:    logger,
+		Resolver:  r,
+		CacheSize: defaultCacheSize,
+		CacheTTL:  defaultIPTTL,
+	})
+}
+
 // type check
 var _ AddressProcessor = (*DefaultAddrProc)(nil)
 
@@ -246,6 +311,9 @@ func (p *DefaultAddrProc) process(ctx context.Context, catchPanics bool) {
 		info := p.processWHOIS(ctx, ip)
 
 		p.addrUpdater.UpdateAddress(ctx, ip, host, info)
+
+		p.processLANName(ctx, ip, SourceLLMNR, p.llmnr)
+		p.processLANName(ctx, ip, SourceNetBIOS, p.netbios)
 	}
 
 	p.logger.InfoContext(ctx, "finished processing addresses")
@@ -279,6 +347,26 @@ func (p *DefaultAddrProc) processRDNS(ctx context.Context, ip netip.Addr) (host
 	return host
 }
 
+// processLANName resolves the clients' private IP addresses using n and
+// updates the information from src, if it has changed.
+func (p *DefaultAddrProc) processLANName(
+	ctx context.Context,
+	ip netip.Addr,
+	src Source,
+	n lanname.Interface,
+) {
+	if ip.IsLoopback() || !p.privateSubnets.Contains(ip) {
+		return
+	}
+
+	host, changed := n.Process(ctx, ip)
+	p.logger.DebugContext(ctx, "processed lan name", "src", src, "ip", ip, "host", host)
+
+	if changed {
+		p.lanNameUpdater.UpdateAddressSource(ctx, ip, src, host)
+	}
+}
+
 // shouldResolve returns false if ip is a loopback address, or ip is private and
 // resolving of private addresses is disabled.
 func (p *DefaultAddrProc) shouldResolve(ip netip.Addr) (ok bool) {
@@ -10,6 +10,7 @@ import (
 	"net/netip"
 	"slices"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/netutil"
@@ -47,6 +48,9 @@ type Source uint8
 const (
 	SourceWHOIS Source = iota + 1
 	SourceARP
+	SourceNetBIOS
+	SourceLLMNR
+	SourceMDNS
 	SourceRDNS
 	SourceDHCP
 	SourceHostsFile
@@ -63,6 +67,12 @@ func (cs Source) String() (s string) {
 		return "WHOIS"
 	case SourceARP:
 		return "ARP"
+	case SourceNetBIOS:
+		return "NetBIOS"
+	case SourceLLMNR:
+		return "LLMNR"
+	case SourceMDNS:
+		return "mDNS"
 	case SourceRDNS:
 		return "rDNS"
 	case SourceDHCP:
@@ -95,6 +105,21 @@ type Runtime struct {
 	// from the source is present, but empty.
 	arp []string
 
+	// netbios is the NetBIOS name service information of a client.  nil
+	// indicates that there is no information from the source.  Empty non-nil
+	// slice indicates that the data from the source is present, but empty.
+	netbios []string
+
+	// llmnr is the LLMNR information of a client.  nil indicates that there is
+	// no information from the source.  Empty non-nil slice indicates that the
+	// data from the source is present, but empty.
+	llmnr []string
+
+	// mdns is the multicast DNS information of a client.  nil indicates that
+	// there is no information from the source.  Empty non-nil slice indicates
+	// that the data from the source is present, but empty.
+	mdns []string
+
 	// rdns is the RDNS information of a client.  nil indicates that there is no
 	// information from the source.  Empty non-nil slice indicates that the data
 	// from the source is present, but empty.
@@ -105,6 +130,10 @@ type Runtime struct {
 	// from the source is present, but empty.
 	dhcp []string
 
+	// device is the device identified by the DHCP fingerprint of a client.  It
+	// is only set along with the DHCP information.
+	device *fingerprint.Device
+
 	// hostsFile is the information from the hosts file.  nil indicates that
 	// there is no information from the source.  Empty non-nil slice indicates
 	// that the data from the source is present, but empty.
@@ -131,6 +160,12 @@ func (r *Runtime) Info() (cs Source, host string) {
 		cs, info = SourceDHCP, r.dhcp
 	case r.rdns != nil:
 		cs, info = SourceRDNS, r.rdns
+	case r.mdns != nil:
+		cs, info = SourceMDNS, r.mdns
+	case r.llmnr != nil:
+		cs, info = SourceLLMNR, r.llmnr
+	case r.netbios != nil:
+		cs, info = SourceNetBIOS, r.netbios
 	case r.arp != nil:
 		cs, info = SourceARP, r.arp
 	case r.whois != nil:
@@ -155,6 +190,12 @@ func (r *Runtime) setInfo(cs Source, hosts []string) {
 	switch cs {
 	case SourceARP:
 		r.arp = hosts
+	case SourceNetBIOS:
+		r.netbios = hosts
+	case SourceLLMNR:
+		r.llmnr = hosts
+	case SourceMDNS:
+		r.mdns = hosts
 	case SourceRDNS:
 		r.rdns = hosts
 	case SourceDHCP:
@@ -174,6 +215,23 @@ func (r *Runtime) setWHOIS(info *whois.Info) {
 	r.whois = info
 }
 
+// Device returns a copy of the device identified by the DHCP fingerprint of
+// the client, if any.
+func (r *Runtime) Device() (d *fingerprint.Device) {
+	if r.device == nil {
+		return nil
+	}
+
+	clone := *r.device
+
+	return &clone
+}
+
+// setDevice sets the device identified by the DHCP fingerprint.
+func (r *Runtime) setDevice(d *fingerprint.Device) {
+	r.device = d
+}
+
 // unset clears a cs information.
 func (r *Runtime) unset(cs Source) {
 	switch cs {
@@ -181,10 +239,17 @@ func (r *Runtime) unset(cs Source) {
 		r.whois = nil
 	case SourceARP:
 		r.arp = nil
+	case SourceNetBIOS:
+		r.netbios = nil
+	case SourceLLMNR:
+		r.llmnr = nil
+	case SourceMDNS:
+		r.mdns = nil
 	case SourceRDNS:
 		r.rdns = nil
 	case SourceDHCP:
 		r.dhcp = nil
+		r.device = nil
 	case SourceHostsFile:
 		r.hostsFile = nil
 	}
@@ -194,6 +259,9 @@ func (r *Runtime) unset(cs Source) {
 func (r *Runtime) isEmpty() (ok bool) {
 	return r.whois == nil &&
 		r.arp == nil &&
+		r.netbios == nil &&
+		r.llmnr == nil &&
+		r.mdns == nil &&
 		r.rdns == nil &&
 		r.dhcp == nil &&
 		r.hostsFile == nil
@@ -214,8 +282,12 @@ func (r *Runtime) clone() (c *Runtime) {
 		ip:        r.ip,
 		whois:     r.whois.Clone(),
 		arp:       slices.Clone(r.arp),
+		netbios:   slices.Clone(r.netbios),
+		llmnr:     slices.Clone(r.llmnr),
+		mdns:      slices.Clone(r.mdns),
 		rdns:      slices.Clone(r.rdns),
 		dhcp:      slices.Clone(r.dhcp),
+		device:    r.Device(),
 		hostsFile: slices.Clone(r.hostsFile),
 	}
 }
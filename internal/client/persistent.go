@@ -9,6 +9,7 @@ import (
 	"net/netip"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -64,6 +65,10 @@ type Persistent struct {
 	// must not be nil after initialization.
 	BlockedServices *filtering.BlockedServices
 
+	// BlockedCategories is the configuration of blocked domain categories of a
+	// client.  It's only used if UseOwnBlockedCategories is true.
+	BlockedCategories *filtering.BlockedCategories
+
 	// Name of the persistent client.  Must not be empty.
 	Name string
 
@@ -115,9 +120,18 @@ type Persistent struct {
 	// ParentalEnabled specifies whether parental control is enabled.
 	ParentalEnabled bool
 
+	// BlockedServicesExpires is the optional time after which the client
+	// stops using its own blocked services and uses the global ones again.
+	// The zero value means that the override never expires.
+	BlockedServicesExpires time.Time
+
 	// UseOwnBlockedServices specifies whether custom services are blocked.
 	UseOwnBlockedServices bool
 
+	// UseOwnBlockedCategories specifies whether BlockedCategories are used
+	// instead of the global blocked categories.
+	UseOwnBlockedCategories bool
+
 	// IgnoreQueryLog specifies whether the client requests are logged.
 	IgnoreQueryLog bool
 
@@ -282,6 +296,13 @@ func (c *Persistent) EqualIDs(prev *Persistent) (equal bool) {
 		slices.Equal(c.ClientIDs, prev.ClientIDs)
 }
 
+// usesOwnBlockedServices returns true if c uses its own blocked services at
+// now.
+func (c *Persistent) usesOwnBlockedServices(now time.Time) (ok bool) {
+	return c.UseOwnBlockedServices &&
+		(c.BlockedServicesExpires.IsZero() || now.Before(c.BlockedServicesExpires))
+}
+
 // ShallowClone returns a deep copy of the client, except upstreamConfig,
 // safeSearchConf, SafeSearch fields, because it's difficult to copy them.
 func (c *Persistent) ShallowClone() (clone *Persistent) {
@@ -289,6 +310,7 @@ func (c *Persistent) ShallowClone() (clone *Persistent) {
 	*clone = *c
 
 	clone.BlockedServices = c.BlockedServices.Clone()
+	clone.BlockedCategories = c.BlockedCategories.Clone()
 	clone.Tags = slices.Clone(c.Tags)
 	clone.Upstreams = slices.Clone(c.Upstreams)
 
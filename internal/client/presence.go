@@ -0,0 +1,335 @@
+package client
+
+import (
+	"hash/maphash"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/container"
+)
+
+// PresenceSource is the kind of the network activity that has shown a
+// persistent client to be online.
+type PresenceSource string
+
+// PresenceSource values.
+const (
+	// PresenceSourceDNS means that the client has sent DNS queries.
+	PresenceSourceDNS PresenceSource = "dns"
+
+	// PresenceSourceARP means that the client is in the network neighborhood.
+	PresenceSourceARP PresenceSource = "arp"
+
+	// PresenceSourceDHCP means that the client has an active DHCP lease.
+	PresenceSourceDHCP PresenceSource = "dhcp"
+)
+
+const (
+	// defaultPresenceTimeout is the duration of inactivity after which a
+	// persistent client is considered offline.
+	defaultPresenceTimeout = 10 * time.Minute
+
+	// defaultPresenceUpdatePeriod is the period of updating the presence of
+	// persistent clients.
+	defaultPresenceUpdatePeriod = 1 * time.Minute
+
+	// defaultPresenceHistorySize is the maximum number of presence transitions
+	// stored for each persistent client.
+	defaultPresenceHistorySize = 50
+
+	// presenceActivityShards is the number of independently locked parts of
+	// the recorded DNS activity.
+	presenceActivityShards = 32
+
+	// maxPresenceActivity is the maximum number of IP addresses the DNS
+	// activity is recorded for between the presence updates.  The activity of
+	// the other addresses is ignored until the next update.
+	maxPresenceActivity = 64 * 1024
+)
+
+// PresenceTransition is a change in the presence of a persistent client.
+type PresenceTransition struct {
+	// Time is the time when the change has been detected.
+	Time time.Time
+
+	// Source is the kind of the activity that has shown the client to be
+	// online.  It's empty for the transitions to offline.
+	Source PresenceSource
+
+	// Online is true if the client has become online.
+	Online bool
+}
+
+// Presence is the presence information of a persistent client.
+type Presence struct {
+	// FirstSeen is the time when the client has been seen for the first time.
+	FirstSeen time.Time
+
+	// LastSeen is the time when the client has been seen for the last time.
+	LastSeen time.Time
+
+	// History are the latest presence transitions of the client, oldest
+	// first.
+	History []*PresenceTransition
+
+	// Online is true if the client is currently considered online.
+	Online bool
+}
+
+// clone returns a deep copy of p.
+func (p *Presence) clone() (c *Presence) {
+	if p == nil {
+		return nil
+	}
+
+	c = &Presence{
+		FirstSeen: p.FirstSeen,
+		LastSeen:  p.LastSeen,
+		History:   make([]*PresenceTransition, 0, len(p.History)),
+		Online:    p.Online,
+	}
+
+	for _, t := range p.History {
+		tc := *t
+		c.History = append(c.History, &tc)
+	}
+
+	return c
+}
+
+// activityShard is a part of the recorded DNS activity.
+type activityShard struct {
+	// mu protects activity.
+	mu *sync.Mutex
+
+	// activity maps the IP addresses of the DNS clients to the time of their
+	// latest query since the last update.
+	activity map[netip.Addr]time.Time
+}
+
+// presenceTracker stores the presence information of persistent clients.
+type presenceTracker struct {
+	// activity is the DNS activity recorded since the last update.  The
+	// addresses are distributed among the shards by their hashes, so that the
+	// concurrent queries rarely contend for the same lock.
+	activity [presenceActivityShards]*activityShard
+
+	// seed is the seed of the hashes of the addresses.
+	seed maphash.Seed
+
+	// presences maps the UIDs of persistent clients to their presence
+	// information.  It's protected by [Storage.mu].
+	presences map[UID]*Presence
+
+	// timeout is the duration of inactivity after which a client is
+	// considered offline.
+	timeout time.Duration
+
+	// historySize is the maximum number of transitions stored for each client.
+	historySize int
+}
+
+// newPresenceTracker returns a new properly initialized *presenceTracker.
+func newPresenceTracker() (t *presenceTracker) {
+	t = &presenceTracker{
+		seed:        maphash.MakeSeed(),
+		presences:   map[UID]*Presence{},
+		timeout:     defaultPresenceTimeout,
+		historySize: defaultPresenceHistorySize,
+	}
+
+	for i := range t.activity {
+		t.activity[i] = &activityShard{
+			mu:       &sync.Mutex{},
+			activity: map[netip.Addr]time.Time{},
+		}
+	}
+
+	return t
+}
+
+// markActive records the DNS activity of ip at now.  It's safe for concurrent
+// use.
+func (t *presenceTracker) markActive(ip netip.Addr, now time.Time) {
+	sh := t.activity[maphash.Comparable(t.seed, ip)%presenceActivityShards]
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	_, ok := sh.activity[ip]
+	if !ok && len(sh.activity) >= maxPresenceActivity/presenceActivityShards {
+		return
+	}
+
+	sh.activity[ip] = now
+}
+
+// takeActivity returns the recorded DNS activity and resets it.
+func (t *presenceTracker) takeActivity() (activity map[netip.Addr]time.Time) {
+	activity = map[netip.Addr]time.Time{}
+	for _, sh := range t.activity {
+		func() {
+			sh.mu.Lock()
+			defer sh.mu.Unlock()
+
+			for ip, at := range sh.activity {
+				activity[ip] = at
+			}
+
+			clear(sh.activity)
+		}()
+	}
+
+	return activity
+}
+
+// presenceSignals contains the network activity observed since the last
+// presence update.
+type presenceSignals struct {
+	// dns maps the IP addresses of the DNS clients to the time of their latest
+	// query.
+	dns map[netip.Addr]time.Time
+
+	// neighIPs are the IP addresses of the network neighbors.
+	neighIPs *container.MapSet[netip.Addr]
+
+	// neighMACs are the MAC addresses of the network neighbors.
+	neighMACs *container.MapSet[macKey]
+
+	// leaseMACs are the MAC addresses of the clients with active dynamic DHCP
+	// leases.
+	leaseMACs *container.MapSet[macKey]
+}
+
+// newPresenceSignals collects the presence signals from the given data.
+func newPresenceSignals(
+	dns map[netip.Addr]time.Time,
+	neighs []arpdb.Neighbor,
+	leases []*dhcpsvc.Lease,
+	now time.Time,
+) (sig *presenceSignals) {
+	sig = &presenceSignals{
+		dns:       dns,
+		neighIPs:  container.NewMapSet[netip.Addr](),
+		neighMACs: container.NewMapSet[macKey](),
+		leaseMACs: container.NewMapSet[macKey](),
+	}
+
+	for _, n := range neighs {
+		sig.neighIPs.Add(n.IP)
+		if isValidMAC(n.MAC) {
+			sig.neighMACs.Add(macToKey(n.MAC))
+		}
+	}
+
+	for _, l := range leases {
+		if !l.IsStatic && l.Expiry.After(now) && isValidMAC(l.HWAddr) {
+			sig.leaseMACs.Add(macToKey(l.HWAddr))
+		}
+	}
+
+	return sig
+}
+
+// isValidMAC returns true if mac has one of the lengths supported by
+// [macToKey].
+func isValidMAC(mac []byte) (ok bool) {
+	switch len(mac) {
+	case 6, 8, 20:
+		return true
+	default:
+		return false
+	}
+}
+
+// seen returns the time c has been seen at and the kind of the activity, if
+// any.  The DNS activity is preferred, since it has the exact time.
+func (sig *presenceSignals) seen(c *Persistent, now time.Time) (at time.Time, src PresenceSource) {
+	for _, ip := range c.IPs {
+		if t, ok := sig.dns[ip]; ok && t.After(at) {
+			at, src = t, PresenceSourceDNS
+		}
+	}
+
+	for addr, t := range sig.dns {
+		if t.After(at) && slices.ContainsFunc(c.Subnets, func(s netip.Prefix) (ok bool) {
+			return s.Contains(addr)
+		}) {
+			at, src = t, PresenceSourceDNS
+		}
+	}
+
+	if src != "" {
+		return at, src
+	}
+
+	for _, mac := range c.MACs {
+		if sig.neighMACs.Has(macToKey(mac)) {
+			return now, PresenceSourceARP
+		}
+	}
+
+	if slices.ContainsFunc(c.IPs, sig.neighIPs.Has) {
+		return now, PresenceSourceARP
+	}
+
+	for _, mac := range c.MACs {
+		if sig.leaseMACs.Has(macToKey(mac)) {
+			return now, PresenceSourceDHCP
+		}
+	}
+
+	return time.Time{}, ""
+}
+
+// update updates the presence of the client with uid.  src is empty if the
+// client hasn't been seen since the last update.
+func (t *presenceTracker) update(uid UID, at time.Time, src PresenceSource, now time.Time) {
+	p := t.presences[uid]
+	if src == "" {
+		if p != nil && p.Online && now.Sub(p.LastSeen) >= t.timeout {
+			p.Online = false
+			t.addTransition(p, &PresenceTransition{Time: now})
+		}
+
+		return
+	}
+
+	if p == nil {
+		p = &Presence{FirstSeen: at}
+		t.presences[uid] = p
+	}
+
+	if at.After(p.LastSeen) {
+		p.LastSeen = at
+	}
+
+	if !p.Online {
+		p.Online = true
+		t.addTransition(p, &PresenceTransition{Time: at, Source: src, Online: true})
+	}
+}
+
+// addTransition appends tr to the history of p, removing the oldest
+// transitions if the history is full.
+func (t *presenceTracker) addTransition(p *Presence, tr *PresenceTransition) {
+	p.History = append(p.History, tr)
+	if over := len(p.History) - t.historySize; over > 0 {
+		p.History = slices.Delete(p.History, 0, over)
+	}
+}
+
+// presence returns a copy of the presence information of the client with uid,
+// or nil if the client has never been seen.
+func (t *presenceTracker) presence(uid UID) (p *Presence) {
+	return t.presences[uid].clone()
+}
+
+// remove removes the presence information of the client with uid.
+func (t *presenceTracker) remove(uid UID) {
+	delete(t.presences, uid)
+}
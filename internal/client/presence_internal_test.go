@@ -0,0 +1,33 @@
+package client
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresenceTracker_markActive(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	tr := newPresenceTracker()
+
+	ip := netip.MustParseAddr("192.0.2.1")
+	tr.markActive(ip, now)
+	tr.markActive(ip, now.Add(time.Second))
+
+	activity := tr.takeActivity()
+	require.Len(t, activity, 1)
+
+	assert.Equal(t, now.Add(time.Second), activity[ip])
+	assert.Empty(t, tr.takeActivity())
+
+	for i := range 2 * maxPresenceActivity {
+		tr.markActive(netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)}), now)
+	}
+
+	assert.LessOrEqual(t, len(tr.takeActivity()), maxPresenceActivity)
+}
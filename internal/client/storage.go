@@ -13,12 +13,15 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
+	"github.com/AdguardTeam/AdGuardHome/internal/lanname"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/hostsfile"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/service"
 	"github.com/AdguardTeam/golibs/timeutil"
 )
 
@@ -86,6 +89,14 @@ type HostsContainer interface {
 	Upd() (updates <-chan *hostsfile.DefaultStorage)
 }
 
+// MDNS is an interface for receiving the names announced using multicast DNS.
+type MDNS interface {
+	service.Interface
+
+	// Upd returns the channel of the received announcements.
+	Upd() (updates <-chan *lanname.Announcement)
+}
+
 // StorageConfig is the client storage configuration structure.
 type StorageConfig struct {
 	// Logger is used for logging the operation of the client storage.  It must
@@ -106,6 +117,14 @@ type StorageConfig struct {
 	// ARPDB is used to update [SourceARP] runtime client information.
 	ARPDB arpdb.Interface
 
+	// MDNS is used to update [SourceMDNS] runtime client information.  If not
+	// nil, it's started and shut down along with the storage.
+	MDNS MDNS
+
+	// Fingerprints is used to identify the devices of [SourceDHCP] runtime
+	// clients.  If nil, the devices aren't identified.
+	Fingerprints *fingerprint.DB
+
 	// InitialClients is a list of persistent clients parsed from the
 	// configuration file.  Each client must not be nil.
 	InitialClients []*Persistent
@@ -117,6 +136,10 @@ type StorageConfig struct {
 	// RuntimeSourceDHCP specifies whether to update [SourceDHCP] information
 	// of runtime clients.
 	RuntimeSourceDHCP bool
+
+	// AutoTags specifies whether to assign the tags of the identified devices
+	// to the new persistent clients without tags and to the runtime clients.
+	AutoTags bool
 }
 
 // Storage contains information about persistent and runtime clients.
@@ -137,6 +160,12 @@ type Storage struct {
 	// upstreamManager stores and updates custom client upstream configurations.
 	upstreamManager *upstreamManager
 
+	// presence tracks the presence of persistent clients in the network.
+	presence *presenceTracker
+
+	// clock is used to retrieve the current time.
+	clock timeutil.Clock
+
 	// dhcp is used to update [SourceDHCP] runtime client information.
 	dhcp DHCP
 
@@ -146,6 +175,18 @@ type Storage struct {
 	// arpDB is used to update [SourceARP] runtime client information.
 	arpDB arpdb.Interface
 
+	// mdns is used to update [SourceMDNS] runtime client information.  It may
+	// be nil.
+	mdns MDNS
+
+	// mdnsExpiry are the moments when the names announced using multicast DNS
+	// expire.  It's protected by mu.
+	mdnsExpiry map[netip.Addr]time.Time
+
+	// fingerprints is used to identify the devices of runtime clients.  It may
+	// be nil.
+	fingerprints *fingerprint.DB
+
 	// done is the shutdown signaling channel.
 	done chan struct{}
 
@@ -162,6 +203,10 @@ type Storage struct {
 	// runtimeSourceDHCP specifies whether to update [SourceDHCP] information
 	// of runtime clients.
 	runtimeSourceDHCP bool
+
+	// autoTags specifies whether to assign the tags of the identified devices
+	// to the clients.
+	autoTags bool
 }
 
 // NewStorage returns initialized client storage.  conf must not be nil.
@@ -175,13 +220,19 @@ func NewStorage(ctx context.Context, conf *StorageConfig) (s *Storage, err error
 		index:                  newIndex(),
 		runtimeIndex:           newRuntimeIndex(),
 		upstreamManager:        newUpstreamManager(conf.Logger, conf.Clock),
+		presence:               newPresenceTracker(),
+		clock:                  conf.Clock,
 		dhcp:                   conf.DHCP,
 		etcHosts:               conf.EtcHosts,
 		arpDB:                  conf.ARPDB,
+		mdns:                   conf.MDNS,
+		mdnsExpiry:             map[netip.Addr]time.Time{},
+		fingerprints:           conf.Fingerprints,
 		done:                   make(chan struct{}),
 		allowedTags:            tags,
 		arpClientsUpdatePeriod: conf.ARPClientsUpdatePeriod,
 		runtimeSourceDHCP:      conf.RuntimeSourceDHCP,
+		autoTags:               conf.AutoTags,
 	}
 
 	for i, p := range conf.InitialClients {
@@ -201,18 +252,39 @@ func NewStorage(ctx context.Context, conf *StorageConfig) (s *Storage, err error
 // TODO(s.chzhen):  Pass context.
 func (s *Storage) Start(ctx context.Context) (err error) {
 	go s.periodicARPUpdate(ctx)
+	go s.periodicPresenceUpdate(ctx)
 	go s.handleHostsUpdates(ctx)
 
+	if w, ok := s.arpDB.(arpdb.Watcher); ok {
+		go s.handleARPEvents(ctx, w.Events())
+	}
+
+	if s.mdns != nil {
+		err = s.mdns.Start(ctx)
+		if err != nil {
+			return fmt.Errorf("starting mdns: %w", err)
+		}
+
+		go s.handleMDNSUpdates(ctx)
+	}
+
 	return nil
 }
 
 // Shutdown gracefully stops the client storage.
 //
 // TODO(s.chzhen):  Pass context.
-func (s *Storage) Shutdown(_ context.Context) (err error) {
+func (s *Storage) Shutdown(ctx context.Context) (err error) {
 	close(s.done)
 
-	return s.upstreamManager.close()
+	var errs []error
+	if s.mdns != nil {
+		errs = append(errs, s.mdns.Shutdown(ctx))
+	}
+
+	errs = append(errs, s.upstreamManager.close())
+
+	return errors.Join(errs...)
 }
 
 // periodicARPUpdate periodically reloads runtime clients from ARP.  It is
@@ -232,6 +304,135 @@ func (s *Storage) periodicARPUpdate(ctx context.Context) {
 	}
 }
 
+// periodicPresenceUpdate periodically updates the presence of persistent
+// clients.  It is intended to be used as a goroutine.
+func (s *Storage) periodicPresenceUpdate(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	t := time.NewTicker(defaultPresenceUpdatePeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.UpdatePresence(ctx)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// UpdatePresence updates the presence of persistent clients using the DNS
+// activity recorded since the last update, the network neighborhood, and the
+// DHCP leases.
+func (s *Storage) UpdatePresence(ctx context.Context) {
+	now := s.clock.Now()
+	activity := s.presence.takeActivity()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var neighs []arpdb.Neighbor
+	if s.arpDB != nil {
+		neighs = s.arpDB.Neighbors()
+	}
+
+	var leases []*dhcpsvc.Lease
+	if s.dhcp != nil {
+		leases = s.dhcp.Leases()
+	}
+
+	sig := newPresenceSignals(activity, neighs, leases, now)
+
+	online := 0
+	s.index.rangeByName(func(c *Persistent) (cont bool) {
+		at, src := sig.seen(c, now)
+		s.presence.update(c.UID, at, src, now)
+		if p := s.presence.presences[c.UID]; p != nil && p.Online {
+			online++
+		}
+
+		return true
+	})
+
+	s.logger.DebugContext(ctx, "updated client presence", "online", online)
+}
+
+// MarkActive records the DNS activity of the client with ip.  It's safe for
+// concurrent use and doesn't block on the other storage operations.
+func (s *Storage) MarkActive(ip netip.Addr) {
+	s.presence.markActive(ip, s.clock.Now())
+}
+
+// HasClientID implements the [dnsforward.ClientsContainer] interface for
+// *Storage.
+func (s *Storage) HasClientID(id string) (ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok = s.index.findByClientID(ClientID(id))
+
+	return ok
+}
+
+// Presence returns a copy of the presence information of the persistent client
+// with name.  p is nil if the client hasn't been seen yet.  ok is false if no
+// such client exists.
+func (s *Storage) Presence(name string) (p *Presence, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.index.findByName(name)
+	if !ok {
+		return nil, false
+	}
+
+	return s.presence.presence(c.UID), true
+}
+
+// KnownAddrs returns the MAC addresses of the persistent client with name and
+// the IP addresses it's known to use: the configured ones as well as the ones
+// from the network neighborhood and the DHCP leases matching its MAC
+// addresses.  ok is false if no such client exists.
+func (s *Storage) KnownAddrs(name string) (macs []net.HardwareAddr, ips []netip.Addr, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.index.findByName(name)
+	if !ok {
+		return nil, nil, false
+	}
+
+	macs = slices.Clone(c.MACs)
+	ips = slices.Clone(c.IPs)
+
+	hasMAC := func(mac net.HardwareAddr) (ok bool) {
+		return slices.ContainsFunc(macs, func(m net.HardwareAddr) (eq bool) {
+			return slices.Equal(m, mac)
+		})
+	}
+
+	if s.arpDB != nil {
+		for _, n := range s.arpDB.Neighbors() {
+			if hasMAC(n.MAC) {
+				ips = append(ips, n.IP)
+			}
+		}
+	}
+
+	if s.dhcp != nil {
+		for _, l := range s.dhcp.Leases() {
+			if hasMAC(l.HWAddr) {
+				ips = append(ips, l.IP)
+			}
+		}
+	}
+
+	slices.SortFunc(ips, netip.Addr.Compare)
+
+	return macs, slices.Compact(ips), true
+}
+
 // ReloadARP reloads runtime clients from ARP, if configured.
 func (s *Storage) ReloadARP(ctx context.Context) {
 	if s.arpDB != nil {
@@ -276,6 +477,139 @@ func (s *Storage) addFromSystemARP(ctx context.Context) {
 	)
 }
 
+// handleARPEvents receives the changes of the network neighborhood and updates
+// [SourceARP] runtime client information.  It is intended to be used as a
+// goroutine.
+func (s *Storage) handleARPEvents(ctx context.Context, events <-chan arpdb.Event) {
+	if events == nil {
+		return
+	}
+
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+
+			s.applyARPEvent(ctx, e)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// applyARPEvent updates [SourceARP] runtime client information according to e.
+func (s *Storage) applyARPEvent(ctx context.Context, e arpdb.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := e.Neighbor
+	switch e.Type {
+	case arpdb.EventTypeNew:
+		s.logger.InfoContext(ctx, "new device on network", "ip", n.IP, "mac", n.MAC)
+		s.runtimeIndex.setInfo(n.IP, SourceARP, []string{n.Name})
+	case arpdb.EventTypeUpdate:
+		s.runtimeIndex.setInfo(n.IP, SourceARP, []string{n.Name})
+	case arpdb.EventTypeDelete:
+		if rc := s.runtimeIndex.client(n.IP); rc != nil {
+			rc.unset(SourceARP)
+			s.runtimeIndex.removeEmpty()
+		}
+	default:
+		s.logger.WarnContext(ctx, "unexpected arp event", "type", e.Type)
+	}
+
+	s.logger.DebugContext(ctx, "applied arp event", "type", e.Type, "ip", n.IP)
+}
+
+// mdnsExpiryCheckPeriod is the period of removing the expired names announced
+// using multicast DNS.
+const mdnsExpiryCheckPeriod = 1 * time.Minute
+
+// handleMDNSUpdates receives the names announced using multicast DNS and
+// updates [SourceMDNS] runtime client information.  It is intended to be used
+// as a goroutine.
+func (s *Storage) handleMDNSUpdates(ctx context.Context) {
+	defer slogutil.RecoverAndLog(ctx, s.logger)
+
+	t := time.NewTicker(mdnsExpiryCheckPeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case a, ok := <-s.mdns.Upd():
+			if !ok {
+				return
+			}
+
+			s.addFromMDNS(ctx, a)
+		case <-t.C:
+			s.removeExpiredMDNS(ctx)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// addFromMDNS updates [SourceMDNS] runtime client information according to a.
+// It also removes the names with expired TTL.
+func (s *Storage) addFromMDNS(ctx context.Context, a *lanname.Announcement) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a.TTL > 0 {
+		s.runtimeIndex.setInfo(a.Addr, SourceMDNS, []string{a.Host})
+		s.mdnsExpiry[a.Addr] = now.Add(a.TTL)
+	} else {
+		// The device is leaving the network.
+		s.unsetMDNSLocked(a.Addr)
+	}
+
+	s.logger.DebugContext(ctx, "updating client alias from mdns", "ip", a.Addr, "host", a.Host)
+
+	s.removeExpiredMDNSLocked(ctx, now)
+}
+
+// removeExpiredMDNS removes [SourceMDNS] runtime client information with
+// expired TTL.
+func (s *Storage) removeExpiredMDNS(ctx context.Context) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpiredMDNSLocked(ctx, now)
+}
+
+// removeExpiredMDNSLocked removes [SourceMDNS] runtime client information,
+// which has expired at now.  s.mu must be locked.
+func (s *Storage) removeExpiredMDNSLocked(ctx context.Context, now time.Time) {
+	for ip, exp := range s.mdnsExpiry {
+		if now.Before(exp) {
+			continue
+		}
+
+		s.unsetMDNSLocked(ip)
+		s.logger.DebugContext(ctx, "mdns name expired", "ip", ip)
+	}
+}
+
+// unsetMDNSLocked removes [SourceMDNS] runtime client information for ip.
+// s.mu must be locked.
+func (s *Storage) unsetMDNSLocked(ip netip.Addr) {
+	delete(s.mdnsExpiry, ip)
+
+	if rc := s.runtimeIndex.client(ip); rc != nil {
+		rc.unset(SourceMDNS)
+		s.runtimeIndex.removeEmpty()
+	}
+}
+
 // handleHostsUpdates receives the updates from the hosts container and adds
 // them to the clients storage.  It is intended to be used as a goroutine.
 func (s *Storage) handleHostsUpdates(ctx context.Context) {
@@ -351,6 +685,16 @@ func (s *Storage) UpdateAddress(ctx context.Context, ip netip.Addr, host string,
 	}
 }
 
+// UpdateAddressSource implements the [LANNameUpdater] interface for *Storage.
+func (s *Storage) UpdateAddressSource(ctx context.Context, ip netip.Addr, src Source, host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runtimeIndex.setInfo(ip, src, []string{host})
+
+	s.logger.DebugContext(ctx, "updating client alias", "src", src, "ip", ip, "host", host)
+}
+
 // UpdateDHCP updates [SourceDHCP] runtime client information.
 func (s *Storage) UpdateDHCP(ctx context.Context) {
 	if s.dhcp == nil || !s.runtimeSourceDHCP {
@@ -365,7 +709,8 @@ func (s *Storage) UpdateDHCP(ctx context.Context) {
 
 	added := 0
 	for _, l := range s.dhcp.Leases() {
-		s.runtimeIndex.setInfo(l.IP, src, []string{l.Hostname})
+		rc := s.runtimeIndex.setInfo(l.IP, src, []string{l.Hostname})
+		rc.setDevice(s.identify(l.Fingerprint))
 		added++
 	}
 
@@ -378,6 +723,54 @@ func (s *Storage) UpdateDHCP(ctx context.Context) {
 	)
 }
 
+// identify returns the device identified by p, if any.  p may be nil.
+func (s *Storage) identify(p *fingerprint.Params) (d *fingerprint.Device) {
+	if s.fingerprints == nil || p == nil {
+		return nil
+	}
+
+	d, _ = s.fingerprints.Match(p)
+
+	return d
+}
+
+// deviceTags returns the sorted allowed tags of d.  d may be nil.
+func (s *Storage) deviceTags(d *fingerprint.Device) (tags []string) {
+	if d == nil {
+		return nil
+	}
+
+	for _, t := range d.Tags() {
+		if _, ok := slices.BinarySearch(s.allowedTags, t); ok {
+			tags = append(tags, t)
+		}
+	}
+
+	slices.Sort(tags)
+
+	return tags
+}
+
+// autoTagsFor returns the tags of the device identified for the persistent
+// client p by its DHCP lease, if any.
+func (s *Storage) autoTagsFor(p *Persistent) (tags []string) {
+	if s.fingerprints == nil {
+		return nil
+	}
+
+	for _, l := range s.dhcp.Leases() {
+		matches := slices.Contains(p.IPs, l.IP) ||
+			slices.ContainsFunc(p.MACs, func(mac net.HardwareAddr) (ok bool) {
+				return slices.Equal(mac, l.HWAddr)
+			})
+		if matches && l.Fingerprint != nil {
+			return s.deviceTags(s.identify(l.Fingerprint))
+		}
+	}
+
+	return nil
+}
+
 // setWHOISInfo sets the WHOIS information for a runtime client.
 func (s *Storage) setWHOISInfo(ctx context.Context, ip netip.Addr, wi *whois.Info) {
 	_, ok := s.index.findByIP(ip)
@@ -427,6 +820,10 @@ func (s *Storage) Add(ctx context.Context, p *Persistent) (err error) {
 		return err
 	}
 
+	if s.autoTags && len(p.Tags) == 0 {
+		p.Tags = s.autoTagsFor(p)
+	}
+
 	s.index.add(p)
 	s.upstreamManager.updateCustomUpstreamConfig(p)
 
@@ -555,6 +952,20 @@ func (s *Storage) Find(params *FindParams) (p *Persistent, ok bool) {
 	}
 }
 
+// FindByName returns a shallow copy of the persistent client with name.  ok is
+// false if no such client exists.
+func (s *Storage) FindByName(name string) (p *Persistent, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok = s.index.findByName(name)
+	if !ok {
+		return nil, false
+	}
+
+	return p.ShallowClone(), true
+}
+
 // findByIP finds persistent client by IP address.  s.mu is expected to be
 // locked.
 func (s *Storage) findByIP(addr netip.Addr) (p *Persistent, ok bool) {
@@ -614,6 +1025,7 @@ func (s *Storage) RemoveByName(ctx context.Context, name string) (ok bool) {
 	}
 
 	s.index.remove(p)
+	s.presence.remove(p.UID)
 
 	err := s.upstreamManager.remove(p.UID)
 	if err != nil {
@@ -661,6 +1073,38 @@ func (s *Storage) Update(ctx context.Context, name string, p *Persistent) (err e
 	return nil
 }
 
+// ExpireBlockedServices makes the persistent clients with the blocked services
+// overrides expired by now use the global blocked services again.  It returns
+// the number of changed clients.
+func (s *Storage) ExpireBlockedServices(ctx context.Context, now time.Time) (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []*Persistent
+	s.index.rangeByName(func(c *Persistent) (cont bool) {
+		if c.UseOwnBlockedServices && !c.usesOwnBlockedServices(now) {
+			expired = append(expired, c)
+		}
+
+		return true
+	})
+
+	for _, c := range expired {
+		// Replace the client instead of modifying it, since it may be used
+		// concurrently.
+		updated := c.ShallowClone()
+		updated.UseOwnBlockedServices = false
+		updated.BlockedServicesExpires = time.Time{}
+
+		s.index.remove(c)
+		s.index.add(updated)
+
+		s.logger.InfoContext(ctx, "blocked services override expired", "name", c.Name)
+	}
+
+	return len(expired)
+}
+
 // RangeByName calls f for each persistent client sorted by name, unless cont is
 // false.
 func (s *Storage) RangeByName(f func(c *Persistent) (cont bool)) {
@@ -778,16 +1222,25 @@ func (s *Storage) ApplyClientFiltering(id string, addr netip.Addr, setts *filter
 
 	if !ok {
 		s.logger.Debug("no client filtering settings found", "clientid", id, "addr", addr)
+		s.applyRuntimeTags(addr, setts)
 
 		return
 	}
 
 	s.logger.Debug("applying custom client filtering settings", "client_name", c.Name)
 
-	if c.UseOwnBlockedServices {
+	if c.usesOwnBlockedServices(time.Now()) {
 		setts.BlockedServices = c.BlockedServices.Clone()
 	}
 
+	if c.UseOwnBlockedCategories {
+		setts.BlockedCategories = c.BlockedCategories.Clone()
+		if setts.BlockedCategories == nil {
+			// Block no categories instead of the global ones.
+			setts.BlockedCategories = &filtering.BlockedCategories{}
+		}
+	}
+
 	setts.ClientName = c.Name
 	setts.ClientTags = slices.Clone(c.Tags)
 	if !c.UseOwnSettings {
@@ -800,3 +1253,21 @@ func (s *Storage) ApplyClientFiltering(id string, addr netip.Addr, setts *filter
 	setts.SafeBrowsingEnabled = c.SafeBrowsingEnabled
 	setts.ParentalEnabled = c.ParentalEnabled
 }
+
+// applyRuntimeTags sets the tags of the device identified for the runtime
+// client with addr, if any, into setts.
+func (s *Storage) applyRuntimeTags(addr netip.Addr, setts *filtering.Settings) {
+	if !s.autoTags {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rc := s.runtimeIndex.client(addr)
+	if rc == nil || rc.device == nil {
+		return
+	}
+
+	setts.ClientTags = s.deviceTags(rc.device)
+}
@@ -1,6 +1,7 @@
 package client_test
 
 import (
+	"context"
 	"net"
 	"net/netip"
 	"runtime"
@@ -14,6 +15,10 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
+	"github.com/AdguardTeam/AdGuardHome/internal/lanname"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/hostsfile"
@@ -86,6 +91,37 @@ func (c *testARPDB) Neighbors() (ns []arpdb.Neighbor) {
 	return c.onNeighbors()
 }
 
+// testARPWatcher is a mock implementation of the [arpdb.Watcher].
+type testARPWatcher struct {
+	testARPDB
+	events chan arpdb.Event
+}
+
+// type check
+var _ arpdb.Watcher = (*testARPWatcher)(nil)
+
+// Events implements the [arpdb.Watcher] interface for *testARPWatcher.
+func (w *testARPWatcher) Events() (ch <-chan arpdb.Event) {
+	return w.events
+}
+
+// testMDNS is a mock implementation of the [client.MDNS].
+type testMDNS struct {
+	upd chan *lanname.Announcement
+}
+
+// type check
+var _ client.MDNS = (*testMDNS)(nil)
+
+// Start implements the [client.MDNS] interface for *testMDNS.
+func (m *testMDNS) Start(_ context.Context) (err error) { return nil }
+
+// Shutdown implements the [client.MDNS] interface for *testMDNS.
+func (m *testMDNS) Shutdown(_ context.Context) (err error) { return nil }
+
+// Upd implements the [client.MDNS] interface for *testMDNS.
+func (m *testMDNS) Upd() (updates <-chan *lanname.Announcement) { return m.upd }
+
 // testDHCP is a mock implementation of the [client.DHCP].
 type testDHCP struct {
 	OnLeases func() (leases []*dhcpsvc.Lease)
@@ -288,6 +324,140 @@ func TestStorage_Add_arp(t *testing.T) {
 	})
 }
 
+func TestStorage_Add_arpEvents(t *testing.T) {
+	var (
+		cliIP   = netip.MustParseAddr("1.1.1.1")
+		cliName = "client_one"
+		cliMAC  = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	)
+
+	events := make(chan arpdb.Event, 1)
+	w := &testARPWatcher{
+		testARPDB: testARPDB{
+			onRefresh:   func() (err error) { return nil },
+			onNeighbors: func() (ns []arpdb.Neighbor) { return nil },
+		},
+		events: events,
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	storage, err := client.NewStorage(ctx, &client.StorageConfig{
+		Logger: slogutil.NewDiscardLogger(),
+		DHCP:   client.EmptyDHCP{},
+		ARPDB:  w,
+		// Make sure the periodic updates don't interfere.
+		ARPClientsUpdatePeriod: time.Hour,
+	})
+	require.NoError(t, err)
+
+	err = storage.Start(testutil.ContextWithTimeout(t, testTimeout))
+	require.NoError(t, err)
+
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		return storage.Shutdown(testutil.ContextWithTimeout(t, testTimeout))
+	})
+
+	n := arpdb.Neighbor{
+		Name: cliName,
+		IP:   cliIP,
+		MAC:  cliMAC,
+	}
+
+	t.Run("new", func(t *testing.T) {
+		testutil.RequireSend(t, events, arpdb.Event{Neighbor: n, Type: arpdb.EventTypeNew}, testTimeout)
+
+		require.Eventually(t, func() (ok bool) {
+			cli := storage.ClientRuntime(cliIP)
+			if cli == nil {
+				return false
+			}
+
+			assert.True(t, compareRuntimeInfo(cli, client.SourceARP, cliName))
+
+			return true
+		}, testTimeout, testTimeout/10)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		testutil.RequireSend(t, events, arpdb.Event{Neighbor: n, Type: arpdb.EventTypeDelete}, testTimeout)
+
+		require.Eventually(t, func() (ok bool) {
+			return storage.ClientRuntime(cliIP) == nil
+		}, testTimeout, testTimeout/10)
+	})
+}
+
+func TestStorage_Add_mdns(t *testing.T) {
+	var (
+		ip      = netip.MustParseAddr("192.0.2.1")
+		otherIP = netip.MustParseAddr("192.0.2.2")
+	)
+
+	now := time.Now()
+	clock := &faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	}
+
+	mdns := &testMDNS{
+		upd: make(chan *lanname.Announcement),
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	storage, err := client.NewStorage(ctx, &client.StorageConfig{
+		Logger: slogutil.NewDiscardLogger(),
+		Clock:  clock,
+		DHCP:   client.EmptyDHCP{},
+		ARPDB: &testARPDB{
+			onRefresh:   func() (err error) { return nil },
+			onNeighbors: func() (ns []arpdb.Neighbor) { return nil },
+		},
+		MDNS:                   mdns,
+		ARPClientsUpdatePeriod: time.Hour,
+	})
+	require.NoError(t, err)
+
+	err = storage.Start(testutil.ContextWithTimeout(t, testTimeout))
+	require.NoError(t, err)
+
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		return storage.Shutdown(testutil.ContextWithTimeout(t, testTimeout))
+	})
+
+	testutil.RequireSend(t, mdns.upd, &lanname.Announcement{
+		Addr: ip,
+		Host: "host.local",
+		TTL:  time.Minute,
+	}, testTimeout)
+
+	require.Eventually(t, func() (ok bool) {
+		rc := storage.ClientRuntime(ip)
+
+		return rc != nil && compareRuntimeInfo(rc, client.SourceMDNS, "host.local")
+	}, testTimeout, testTimeout/10)
+
+	now = now.Add(2 * time.Minute)
+	testutil.RequireSend(t, mdns.upd, &lanname.Announcement{
+		Addr: otherIP,
+		Host: "other.local",
+		TTL:  time.Hour,
+	}, testTimeout)
+
+	require.Eventually(t, func() (ok bool) {
+		return storage.ClientRuntime(otherIP) != nil
+	}, testTimeout, testTimeout/10)
+
+	assert.Nil(t, storage.ClientRuntime(ip))
+
+	testutil.RequireSend(t, mdns.upd, &lanname.Announcement{
+		Addr: otherIP,
+		Host: "other.local",
+	}, testTimeout)
+
+	require.Eventually(t, func() (ok bool) {
+		return storage.ClientRuntime(otherIP) == nil
+	}, testTimeout, testTimeout/10)
+}
+
 func TestStorage_Add_whois(t *testing.T) {
 	var (
 		cliIP1 = netip.MustParseAddr("1.1.1.1")
@@ -345,6 +515,39 @@ func TestStorage_Add_whois(t *testing.T) {
 	})
 }
 
+func TestStorage_UpdateAddressSource(t *testing.T) {
+	const (
+		netbiosName = "DESKTOP-1"
+		llmnrName   = "desktop-1"
+		rdnsName    = "desktop-1.lan"
+	)
+
+	ip := netip.MustParseAddr("192.168.1.2")
+	storage := newStorage(t, nil)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	storage.UpdateAddressSource(ctx, ip, client.SourceNetBIOS, netbiosName)
+
+	rc := storage.ClientRuntime(ip)
+	require.NotNil(t, rc)
+
+	assert.True(t, compareRuntimeInfo(rc, client.SourceNetBIOS, netbiosName))
+
+	storage.UpdateAddressSource(ctx, ip, client.SourceLLMNR, llmnrName)
+
+	rc = storage.ClientRuntime(ip)
+	require.NotNil(t, rc)
+
+	assert.True(t, compareRuntimeInfo(rc, client.SourceLLMNR, llmnrName))
+
+	storage.UpdateAddress(ctx, ip, rdnsName, nil)
+
+	rc = storage.ClientRuntime(ip)
+	require.NotNil(t, rc)
+
+	assert.True(t, compareRuntimeInfo(rc, client.SourceRDNS, rdnsName))
+}
+
 func TestClientsDHCP(t *testing.T) {
 	var (
 		cliIP1   = netip.MustParseAddr("1.1.1.1")
@@ -561,6 +764,99 @@ func TestClientsDHCP(t *testing.T) {
 	}))
 }
 
+func TestStorage_fingerprint(t *testing.T) {
+	var (
+		phoneIP  = netip.MustParseAddr("192.168.0.2")
+		phoneMAC = net.HardwareAddr{0x1, 0x2, 0x3, 0x4, 0x5, 0x6}
+
+		otherIP = netip.MustParseAddr("192.168.0.3")
+	)
+
+	dhcp := &testDHCP{
+		OnLeases: func() (ls []*dhcpsvc.Lease) {
+			return []*dhcpsvc.Lease{{
+				IP:       phoneIP,
+				Hostname: "phone",
+				HWAddr:   phoneMAC,
+				Fingerprint: &fingerprint.Params{
+					MAC:         phoneMAC,
+					VendorClass: "android-dhcp-14",
+				},
+			}, {
+				IP:       otherIP,
+				Hostname: "other",
+				HWAddr:   net.HardwareAddr{0x6, 0x5, 0x4, 0x3, 0x2, 0x1},
+			}}
+		},
+		OnHostBy: func(_ netip.Addr) (host string) { return "" },
+		OnMACBy:  func(_ netip.Addr) (mac net.HardwareAddr) { return nil },
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	storage, err := client.NewStorage(ctx, &client.StorageConfig{
+		Logger:            slogutil.NewDiscardLogger(),
+		DHCP:              dhcp,
+		Fingerprints:      fingerprint.NewDefaultDB(),
+		RuntimeSourceDHCP: true,
+		AutoTags:          true,
+	})
+	require.NoError(t, err)
+
+	storage.UpdateDHCP(ctx)
+
+	wantTags := []string{"device_phone", "os_android"}
+
+	t.Run("runtime", func(t *testing.T) {
+		rc := storage.ClientRuntime(phoneIP)
+		require.NotNil(t, rc)
+
+		assert.Equal(t, &fingerprint.Device{
+			Name: "Android",
+			Type: "phone",
+			OS:   "android",
+		}, rc.Device())
+
+		rc = storage.ClientRuntime(otherIP)
+		require.NotNil(t, rc)
+
+		assert.Nil(t, rc.Device())
+	})
+
+	t.Run("runtime_tags", func(t *testing.T) {
+		setts := &filtering.Settings{}
+		storage.ApplyClientFiltering("", phoneIP, setts)
+		assert.Equal(t, wantTags, setts.ClientTags)
+
+		setts = &filtering.Settings{}
+		storage.ApplyClientFiltering("", otherIP, setts)
+		assert.Empty(t, setts.ClientTags)
+	})
+
+	t.Run("persistent_tags", func(t *testing.T) {
+		p := &client.Persistent{
+			Name: "phone",
+			MACs: []net.HardwareAddr{phoneMAC},
+			UID:  client.MustNewUID(),
+		}
+		require.NoError(t, storage.Add(ctx, p))
+
+		found, ok := storage.Find(&client.FindParams{MAC: phoneMAC})
+		require.True(t, ok)
+
+		assert.Equal(t, wantTags, found.Tags)
+
+		tagged := &client.Persistent{
+			Name: "tagged",
+			IPs:  []netip.Addr{otherIP},
+			Tags: []string{"user_child"},
+			UID:  client.MustNewUID(),
+		}
+		require.NoError(t, storage.Add(ctx, tagged))
+
+		assert.Equal(t, []string{"user_child"}, tagged.Tags)
+	})
+}
+
 func TestClientsAddExisting(t *testing.T) {
 	ctx := testutil.ContextWithTimeout(t, testTimeout)
 
@@ -1167,6 +1463,47 @@ func TestStorage_RangeByName(t *testing.T) {
 	}
 }
 
+func TestStorage_ExpireBlockedServices(t *testing.T) {
+	now := time.Now()
+	cliAddr := netip.MustParseAddr("192.0.2.1")
+
+	blocked := &filtering.BlockedServices{
+		Schedule: schedule.EmptyWeekly(),
+		IDs:      []string{"youtube"},
+	}
+
+	s := newStorage(t, []*client.Persistent{{
+		Name:                   "temporary",
+		IPs:                    []netip.Addr{cliAddr},
+		BlockedServices:        blocked,
+		BlockedServicesExpires: now.Add(time.Hour),
+		UseOwnBlockedServices:  true,
+	}, {
+		Name:                  "permanent",
+		ClientIDs:             []client.ClientID{"permanent"},
+		BlockedServices:       blocked.Clone(),
+		UseOwnBlockedServices: true,
+	}})
+
+	setts := &filtering.Settings{}
+	s.ApplyClientFiltering("", cliAddr, setts)
+	assert.Equal(t, blocked, setts.BlockedServices)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	assert.Zero(t, s.ExpireBlockedServices(ctx, now))
+	assert.Equal(t, 1, s.ExpireBlockedServices(ctx, now.Add(2*time.Hour)))
+
+	p, ok := s.Find(&client.FindParams{RemoteIP: cliAddr})
+	require.True(t, ok)
+
+	assert.False(t, p.UseOwnBlockedServices)
+	assert.True(t, p.BlockedServicesExpires.IsZero())
+
+	setts = &filtering.Settings{}
+	s.ApplyClientFiltering("", cliAddr, setts)
+	assert.Nil(t, setts.BlockedServices)
+}
+
 func TestStorage_CustomUpstreamConfig(t *testing.T) {
 	const (
 		existingClientID    = "existing_client_id"
@@ -1483,3 +1820,128 @@ func BenchmarkStorage_Find(b *testing.B) {
 	//	BenchmarkStorage_Find/subnet-8            	 7209050	       167.5 ns/op	     256 B/op	       2 allocs/op
 	//	BenchmarkStorage_Find/mac_address-8       	 5776131	       199.7 ns/op	     256 B/op	       3 allocs/op
 }
+
+func TestStorage_UpdatePresence(t *testing.T) {
+	var (
+		dnsIP   = netip.MustParseAddr("192.0.2.1")
+		arpMAC  = errors.Must(net.ParseMAC("02:00:00:00:00:01"))
+		dhcpMAC = errors.Must(net.ParseMAC("02:00:00:00:00:02"))
+		offMAC  = errors.Must(net.ParseMAC("02:00:00:00:00:03"))
+	)
+
+	start := time.Now()
+	now := start
+	clock := &faketime.Clock{
+		OnNow: func() (n time.Time) { return now },
+	}
+
+	neighbors := []arpdb.Neighbor{{
+		IP:  netip.MustParseAddr("192.0.2.2"),
+		MAC: arpMAC,
+	}}
+
+	a := &testARPDB{
+		onRefresh:   func() (err error) { return nil },
+		onNeighbors: func() (ns []arpdb.Neighbor) { return neighbors },
+	}
+
+	dhcp := &testDHCP{
+		OnLeases: func() (ls []*dhcpsvc.Lease) {
+			return []*dhcpsvc.Lease{{
+				IP:     netip.MustParseAddr("192.0.2.3"),
+				HWAddr: dhcpMAC,
+				Expiry: start.Add(time.Hour),
+			}}
+		},
+		OnHostBy: func(_ netip.Addr) (host string) { panic("not implemented") },
+		OnMACBy:  func(_ netip.Addr) (mac net.HardwareAddr) { panic("not implemented") },
+	}
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	s, err := client.NewStorage(ctx, &client.StorageConfig{
+		Logger: slogutil.NewDiscardLogger(),
+		Clock:  clock,
+		DHCP:   dhcp,
+		ARPDB:  a,
+		InitialClients: []*client.Persistent{{
+			Name: "dns",
+			UID:  client.MustNewUID(),
+			IPs:  []netip.Addr{dnsIP},
+		}, {
+			Name: "arp",
+			UID:  client.MustNewUID(),
+			MACs: []net.HardwareAddr{arpMAC},
+		}, {
+			Name: "dhcp",
+			UID:  client.MustNewUID(),
+			MACs: []net.HardwareAddr{dhcpMAC},
+		}, {
+			Name: "offline",
+			UID:  client.MustNewUID(),
+			MACs: []net.HardwareAddr{offMAC},
+		}},
+	})
+	require.NoError(t, err)
+
+	s.MarkActive(dnsIP)
+	s.UpdatePresence(ctx)
+
+	testCases := []struct {
+		name    string
+		wantSrc client.PresenceSource
+	}{{
+		name:    "dns",
+		wantSrc: client.PresenceSourceDNS,
+	}, {
+		name:    "arp",
+		wantSrc: client.PresenceSourceARP,
+	}, {
+		name:    "dhcp",
+		wantSrc: client.PresenceSourceDHCP,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, ok := s.Presence(tc.name)
+			require.True(t, ok)
+			require.NotNil(t, p)
+
+			assert.True(t, p.Online)
+			assert.Equal(t, start, p.FirstSeen)
+			assert.Equal(t, start, p.LastSeen)
+
+			require.Len(t, p.History, 1)
+			assert.Equal(t, tc.wantSrc, p.History[0].Source)
+		})
+	}
+
+	p, ok := s.Presence("offline")
+	require.True(t, ok)
+	assert.Nil(t, p)
+
+	_, ok = s.Presence("unknown")
+	assert.False(t, ok)
+
+	t.Run("timeout", func(t *testing.T) {
+		now = start.Add(time.Hour)
+		s.UpdatePresence(ctx)
+
+		p, ok = s.Presence("dns")
+		require.True(t, ok)
+		require.NotNil(t, p)
+
+		assert.False(t, p.Online)
+		assert.Equal(t, start, p.LastSeen)
+
+		require.Len(t, p.History, 2)
+		assert.False(t, p.History[1].Online)
+		assert.Equal(t, now, p.History[1].Time)
+
+		p, ok = s.Presence("arp")
+		require.True(t, ok)
+		require.NotNil(t, p)
+
+		assert.True(t, p.Online)
+		assert.Equal(t, now, p.LastSeen)
+	})
+}
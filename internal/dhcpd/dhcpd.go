@@ -2,6 +2,7 @@
 package dhcpd
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"net/netip"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/timeutil"
 )
@@ -83,6 +85,11 @@ type Interface interface {
 	// due to an assumption that a DHCP client must always have an IP address.
 	IPByHost(host string) (ip netip.Addr)
 
+	// ImportStaticLeases adds the static leases, skipping the ones conflicting
+	// with the existing static leases or the configuration.  errs describe the
+	// skipped leases.
+	ImportStaticLeases(leases []*dhcpsvc.Lease) (added int, errs []error)
+
 	WriteDiskConfig(c *ServerConfig)
 }
 
@@ -300,6 +307,74 @@ func (s *server) IPByHost(host string) (ip netip.Addr) {
 	return s.srv4.IPByHost(host)
 }
 
+// ImportStaticLeases implements the [Interface] interface for *server.
+func (s *server) ImportStaticLeases(leases []*dhcpsvc.Lease) (added int, errs []error) {
+	for _, l := range leases {
+		err := s.importStaticLease(l)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("lease %s (%s): %w", l.IP, l.HWAddr, err))
+
+			continue
+		}
+
+		added++
+	}
+
+	return added, errs
+}
+
+// importStaticLease adds the static lease l unless it conflicts with the
+// existing static leases or is outside of the network of the DHCP server.
+func (s *server) importStaticLease(l *dhcpsvc.Lease) (err error) {
+	srv := s.srv4
+	if l.IP.Is6() {
+		err = s.validateStaticIP6(l.IP)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		srv = s.srv6
+	}
+
+	for _, existing := range srv.GetLeases(LeasesStatic) {
+		sameIP, sameMAC := existing.IP == l.IP, bytes.Equal(existing.HWAddr, l.HWAddr)
+		switch {
+		case sameIP && sameMAC:
+			return errors.Error("static lease already exists")
+		case sameIP:
+			return fmt.Errorf("ip is already leased to %s", existing.HWAddr)
+		case sameMAC:
+			return fmt.Errorf("hardware address already has a static lease for %s", existing.IP)
+		}
+	}
+
+	return srv.AddStaticLease(l)
+}
+
+// staticPrefixLen6 is the length of the prefix of the DHCPv6 range start the
+// imported static leases must be within.
+const staticPrefixLen6 = 64
+
+// validateStaticIP6 returns an error if the IPv6 address ip is outside of the
+// network of the DHCPv6 range start.
+func (s *server) validateStaticIP6(ip netip.Addr) (err error) {
+	conf := &V6ServerConf{}
+	s.srv6.WriteDiskConfig6(conf)
+
+	start, ok := netip.AddrFromSlice(conf.RangeStart)
+	if !ok {
+		return errors.Error("dhcpv6 range is not configured")
+	}
+
+	pref := netip.PrefixFrom(start.Unmap(), staticPrefixLen6).Masked()
+	if !pref.Contains(ip) {
+		return fmt.Errorf("ip is outside of dhcpv6 network %s", pref)
+	}
+
+	return nil
+}
+
 // AddStaticLease - add static v4 lease
 func (s *server) AddStaticLease(l *dhcpsvc.Lease) error {
 	return s.srv4.AddStaticLease(l)
@@ -3,6 +3,7 @@
 package dhcpd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"net/netip"
 	"os"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
@@ -18,6 +20,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 )
@@ -665,6 +668,95 @@ func (s *server) handleDHCPUpdateStaticLease(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// staticLeasesImportReq is the request for the POST
+// /control/dhcp/import_static_leases HTTP API.
+type staticLeasesImportReq struct {
+	// Format is the format of Data.
+	Format dhcpsvc.ReservationFormat `json:"format"`
+
+	// Data is the configuration of another DHCP server containing the static
+	// leases.
+	Data string `json:"data"`
+}
+
+// staticLeasesImportResp is the response for the POST
+// /control/dhcp/import_static_leases HTTP API.
+type staticLeasesImportResp struct {
+	// Errors describe the static leases which haven't been imported.
+	Errors []string `json:"errors"`
+
+	// Added is the number of imported static leases.
+	Added int `json:"added"`
+}
+
+// handleDHCPImportStaticLeases is the handler for the POST
+// /control/dhcp/import_static_leases HTTP API.
+func (s *server) handleDHCPImportStaticLeases(w http.ResponseWriter, r *http.Request) {
+	req := &staticLeasesImportReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding json: %s", err)
+
+		return
+	}
+
+	leases, skipped, err := dhcpsvc.ParseReservations(strings.NewReader(req.Data), req.Format)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	added, errs := s.ImportStaticLeases(leases)
+	errs = append(skipped, errs...)
+	resp := &staticLeasesImportResp{
+		Errors: make([]string, 0, len(errs)),
+		Added:  added,
+	}
+
+	for _, e := range errs {
+		resp.Errors = append(resp.Errors, e.Error())
+	}
+
+	log.Info("dhcp: imported %d of %d static leases", added, len(leases)+len(skipped))
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleDHCPExportStaticLeases is the handler for the GET
+// /control/dhcp/export_static_leases HTTP API.
+func (s *server) handleDHCPExportStaticLeases(w http.ResponseWriter, r *http.Request) {
+	f := dhcpsvc.ReservationFormat(r.URL.Query().Get("format"))
+	err := f.Validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	leases := append(s.srv4.GetLeases(LeasesStatic), s.srv6.GetLeases(LeasesStatic)...)
+
+	buf := &bytes.Buffer{}
+	err = dhcpsvc.WriteReservations(buf, f, leases)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	contentType := aghhttp.HdrValTextPlain
+	if f == dhcpsvc.ReservationFormatKea {
+		contentType = aghhttp.HdrValApplicationJSON
+	}
+
+	w.Header().Set(httphdr.ContentType, contentType)
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		log.Debug("dhcp: writing static leases: %s", err)
+	}
+}
+
 func (s *server) handleReset(w http.ResponseWriter, r *http.Request) {
 	err := s.Stop()
 	if err != nil {
@@ -727,6 +819,8 @@ func (s *server) registerHandlers() {
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/add_static_lease", s.handleDHCPAddStaticLease)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/remove_static_lease", s.handleDHCPRemoveStaticLease)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/update_static_lease", s.handleDHCPUpdateStaticLease)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/import_static_leases", s.handleDHCPImportStaticLeases)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/export_static_leases", s.handleDHCPExportStaticLeases)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset", s.handleReset)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset_leases", s.handleResetLeases)
 }
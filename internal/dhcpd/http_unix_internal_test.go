@@ -5,11 +5,13 @@ package dhcpd
 import (
 	"bytes"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
 	"testing"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -317,3 +319,59 @@ func TestServer_HandleUpdateStaticLease_validation(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_handleDHCPImportStaticLeases(t *testing.T) {
+	s, err := Create(&ServerConfig{
+		Enabled: true,
+		Conf4:   *defaultV4ServerConf(),
+		Conf6: V6ServerConf{
+			RangeStart: net.ParseIP("2001:db8::100"),
+		},
+		DataDir:        t.TempDir(),
+		ConfigModified: func() {},
+	})
+	require.NoError(t, err)
+
+	b := &bytes.Buffer{}
+	err = json.NewEncoder(b).Encode(&staticLeasesImportReq{
+		Format: dhcpsvc.ReservationFormatDnsmasq,
+		Data: "dhcp-host=aa:aa:aa:aa:aa:aa,192.168.10.10,host1\n" +
+			"dhcp-host=bb:bb:bb:bb:bb:bb,192.168.10.10,host2\n" +
+			"dhcp-host=cc:cc:cc:cc:cc:cc,10.0.0.10,host3\n" +
+			"dhcp-host=dd:dd:dd:dd:dd:dd,[2001:db8::10],host4\n" +
+			"dhcp-host=ee:ee:ee:ee:ee:ee,[2001:db8:1::10],host5\n",
+	})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/control/dhcp/import_static_leases", b)
+	w := httptest.NewRecorder()
+	s.handleDHCPImportStaticLeases(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	resp := &staticLeasesImportResp{}
+	err = json.NewDecoder(w.Body).Decode(resp)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, resp.Added)
+	assert.Equal(t, []string{
+		"lease 192.168.10.10 (bb:bb:bb:bb:bb:bb): ip is already leased to aa:aa:aa:aa:aa:aa",
+		"lease 10.0.0.10 (cc:cc:cc:cc:cc:cc): dhcpv4: adding static lease: " +
+			"adding static lease for 10.0.0.10 (cc:cc:cc:cc:cc:cc): " +
+			`subnet 192.168.10.1/24 does not contain the ip "10.0.0.10"`,
+		"lease 2001:db8:1::10 (ee:ee:ee:ee:ee:ee): " +
+			"ip is outside of dhcpv6 network 2001:db8::/64",
+	}, resp.Errors)
+
+	r = httptest.NewRequest(http.MethodGet, "/control/dhcp/export_static_leases?format=dnsmasq", nil)
+	w = httptest.NewRecorder()
+	s.handleDHCPExportStaticLeases(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, "dhcp-host=aa:aa:aa:aa:aa:aa,192.168.10.10,host1\n"+
+		"dhcp-host=dd:dd:dd:dd:dd:dd,[2001:db8::10],host4\n", w.Body.String())
+
+	r = httptest.NewRequest(http.MethodGet, "/control/dhcp/export_static_leases?format=bind", nil)
+	w = httptest.NewRecorder()
+	s.handleDHCPExportStaticLeases(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -44,6 +44,8 @@ func (s *server) registerHandlers() {
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/add_static_lease", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/remove_static_lease", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/update_static_lease", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/import_static_leases", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/export_static_leases", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset_leases", s.notImplemented)
 }
@@ -14,6 +14,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
@@ -1216,6 +1217,7 @@ func (s *v4Server) handle(req, resp *dhcpv4.DHCPv4) (rCode int) {
 
 	if l != nil {
 		resp.YourIPAddr = l.IP.AsSlice()
+		s.setFingerprint(l, req)
 	}
 
 	s.updateOptions(req, resp)
@@ -1223,6 +1225,19 @@ func (s *v4Server) handle(req, resp *dhcpv4.DHCPv4) (rCode int) {
 	return 1
 }
 
+// setFingerprint stores the device-specific values of req into l.
+func (s *v4Server) setFingerprint(l *dhcpsvc.Lease, req *dhcpv4.DHCPv4) {
+	s.leasesLock.Lock()
+	defer s.leasesLock.Unlock()
+
+	l.Fingerprint = &fingerprint.Params{
+		MAC:              slices.Clone(req.ClientHWAddr),
+		ParamRequestList: slices.Clone(req.Options.Get(dhcpv4.OptionParameterRequestList)),
+		VendorClass:      req.ClassIdentifier(),
+		Hostname:         req.HostName(),
+	}
+}
+
 // updateOptions updates the options of the response in accordance with the
 // request and RFC 2131.
 //
@@ -401,6 +401,39 @@ func TestV4Server_handle_optionsPriority(t *testing.T) {
 	})
 }
 
+func TestV4Server_handle_fingerprint(t *testing.T) {
+	s, err := v4Create(defaultV4ServerConf())
+	require.NoError(t, err)
+
+	s.conf.dnsIPAddrs = []netip.Addr{netip.MustParseAddr("192.168.10.1")}
+
+	mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	req, err := dhcpv4.NewDiscovery(
+		mac,
+		dhcpv4.WithRequestedOptions(dhcpv4.OptionSubnetMask, dhcpv4.OptionRouter),
+		dhcpv4.WithOption(dhcpv4.OptClassIdentifier("android-dhcp-14")),
+		dhcpv4.WithOption(dhcpv4.OptHostName("android-phone")),
+	)
+	require.NoError(t, err)
+
+	resp, err := dhcpv4.NewReplyFromRequest(req)
+	require.NoError(t, err)
+
+	res := s.handle(req, resp)
+	require.Equal(t, 1, res)
+
+	l := s.findLease(mac)
+	require.NotNil(t, l)
+
+	fp := l.Fingerprint
+	require.NotNil(t, fp)
+
+	assert.Equal(t, mac, fp.MAC)
+	assert.Equal(t, "android-dhcp-14", fp.VendorClass)
+	assert.Equal(t, "android-phone", fp.Hostname)
+	assert.Equal(t, req.Options.Get(dhcpv4.OptionParameterRequestList), fp.ParamRequestList)
+}
+
 func TestV4Server_updateOptions(t *testing.T) {
 	testIP := net.IP{1, 2, 3, 4}
 
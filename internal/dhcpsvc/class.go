@@ -0,0 +1,252 @@
+package dhcpsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/validate"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// dhcpOptUserClass is the User Class option.
+	//
+	// See https://datatracker.ietf.org/doc/html/rfc3004.
+	dhcpOptUserClass layers.DHCPOpt = 77
+
+	// dhcpOptClientArch is the Client System Architecture Type option.
+	//
+	// See https://datatracker.ietf.org/doc/html/rfc4578#section-2.1.
+	dhcpOptClientArch layers.DHCPOpt = 93
+)
+
+// maxBootFileNameLen is the maximum length of the boot file name, which is the
+// size of the file field of the DHCPv4 message.
+//
+// See https://datatracker.ietf.org/doc/html/rfc2131#section-2.
+const maxBootFileNameLen = 128
+
+// ClientArch is the client system architecture type sent by the network boot
+// clients within the option 93.
+//
+// See https://www.iana.org/assignments/dhcpv6-parameters/dhcpv6-parameters.xhtml#processor-architecture.
+type ClientArch uint16
+
+// Common client system architecture types.
+const (
+	ClientArchBIOS         ClientArch = 0
+	ClientArchEFIIA32      ClientArch = 6
+	ClientArchEFIBC        ClientArch = 7
+	ClientArchEFIX64       ClientArch = 9
+	ClientArchEFIARM32     ClientArch = 10
+	ClientArchEFIARM64     ClientArch = 11
+	ClientArchEFIX64HTTP   ClientArch = 16
+	ClientArchEFIARM64HTTP ClientArch = 19
+)
+
+// OptionClassConfig is the configuration of DHCPv4 options for the clients
+// matching all the non-empty conditions.
+type OptionClassConfig struct {
+	// Name is the name of the class used for logging.  It must not be empty.
+	Name string
+
+	// VendorClass is the case-insensitive prefix of the Vendor Class
+	// Identifier option, for example "PXEClient".
+	VendorClass string
+
+	// UserClass is the value of the User Class option, for example "iPXE".
+	UserClass string
+
+	// MACPrefix is the prefix of the client's hardware address.
+	MACPrefix net.HardwareAddr
+
+	// Architectures are the client system architecture types, any of which
+	// the client should send within the Client System Architecture Type
+	// option.
+	Architectures []ClientArch
+
+	// Options is the list of DHCP options to send to the matching clients.  It
+	// overrides the options of the interface the same way as
+	// [IPv4Config.Options] overrides the implicit ones.
+	Options layers.DHCPOptions
+
+	// NextServer is the address of the network boot server, if any.  It must
+	// be a valid IPv4 address, if set.
+	NextServer netip.Addr
+
+	// BootFileName is the name of the network boot file, if any.  It must not
+	// be longer than 128 bytes.
+	BootFileName string
+}
+
+// type check
+var _ validate.Interface = (*OptionClassConfig)(nil)
+
+// Validate implements the [validate.Interface] interface for
+// *OptionClassConfig.
+func (c *OptionClassConfig) Validate() (err error) {
+	if c == nil {
+		return errors.ErrNoValue
+	}
+
+	errs := []error{
+		validate.NotEmpty("Name", c.Name),
+		validate.NoGreaterThan("BootFileName length", len(c.BootFileName), maxBootFileNameLen),
+	}
+
+	if c.VendorClass == "" &&
+		c.UserClass == "" &&
+		len(c.MACPrefix) == 0 &&
+		len(c.Architectures) == 0 {
+		errs = append(errs, errors.Error("no conditions"))
+	}
+
+	if c.NextServer.IsValid() && !c.NextServer.Is4() {
+		errs = append(errs, newMustErr("next server", "be a valid ipv4", c.NextServer))
+	}
+
+	return errors.Join(errs...)
+}
+
+// match returns true if all the non-empty conditions of c match msg.
+func (c *OptionClassConfig) match(msg *layers.DHCPv4) (ok bool) {
+	if len(c.MACPrefix) > 0 && !bytes.HasPrefix(msg.ClientHWAddr, c.MACPrefix) {
+		return false
+	}
+
+	if c.VendorClass != "" {
+		vc := string(option4(msg, layers.DHCPOptClassID))
+		if !strings.HasPrefix(strings.ToLower(vc), strings.ToLower(c.VendorClass)) {
+			return false
+		}
+	}
+
+	if c.UserClass != "" && !hasUserClass(option4(msg, dhcpOptUserClass), c.UserClass) {
+		return false
+	}
+
+	if len(c.Architectures) > 0 && !hasClientArch(option4(msg, dhcpOptClientArch), c.Architectures) {
+		return false
+	}
+
+	return true
+}
+
+// hasUserClass returns true if the User Class option data contains the class.
+// Some clients, notably iPXE, send the class as is, while RFC 3004 requires
+// each class to be prefixed with its length, so both forms are accepted.
+func hasUserClass(data []byte, class string) (ok bool) {
+	if string(data) == class {
+		return true
+	}
+
+	for len(data) > 0 {
+		l := int(data[0])
+		if l == 0 || l >= len(data) {
+			return false
+		}
+
+		if string(data[1:l+1]) == class {
+			return true
+		}
+
+		data = data[l+1:]
+	}
+
+	return false
+}
+
+// hasClientArch returns true if the Client System Architecture Type option
+// data contains any of archs.
+func hasClientArch(data []byte, archs []ClientArch) (ok bool) {
+	for ; len(data) >= 2; data = data[2:] {
+		if slices.Contains(archs, ClientArch(binary.BigEndian.Uint16(data))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// overrideOptions applies overrides to opts, which must be sorted by code.
+// The overrides having a zero value within the Length field are treated as
+// deletions of the corresponding options.  res is also sorted by code.
+func overrideOptions(opts, overrides layers.DHCPOptions) (res layers.DHCPOptions) {
+	res = opts
+	for _, o := range overrides {
+		i, found := slices.BinarySearchFunc(res, o, compareV4OptionCodes)
+		switch {
+		case o.Length == 0:
+			if found {
+				res = slices.Delete(res, i, i+1)
+			}
+		case found:
+			res[i] = o
+		default:
+			res = slices.Insert(res, i, o)
+		}
+	}
+
+	return res
+}
+
+// setResponseOptions appends the options for the client's lease l to resp and
+// sets its boot parameters.  The options of the interface are overridden by
+// the ones of the classes matching req, in the configured order, and then by
+// the ones of l.  l may be nil.
+func (iface *dhcpInterfaceV4) setResponseOptions(
+	ctx context.Context,
+	resp *layers.DHCPv4,
+	req *layers.DHCPv4,
+	l *Lease,
+) {
+	opts := slices.Concat(iface.implicitOpts, iface.explicitOpts)
+	slices.SortFunc(opts, compareV4OptionCodes)
+
+	for _, c := range iface.classes {
+		if !c.match(req) {
+			continue
+		}
+
+		iface.common.logger.DebugContext(ctx, "matched option class", "class", c.Name)
+
+		opts = overrideOptions(opts, c.Options)
+		if c.NextServer.IsValid() {
+			resp.NextServerIP = c.NextServer.AsSlice()
+		}
+
+		if c.BootFileName != "" {
+			resp.File = []byte(c.BootFileName)
+		}
+	}
+
+	if l != nil {
+		opts = overrideOptions(opts, l.Options)
+	}
+
+	resp.Options = append(resp.Options, opts...)
+}
+
+// validateLeaseOptions returns an error if opts contain options which can't
+// be overridden per lease.
+func validateLeaseOptions(opts layers.DHCPOptions) (err error) {
+	for _, o := range opts {
+		switch o.Type {
+		case layers.DHCPOptPad, layers.DHCPOptEnd, layers.DHCPOptMessageType, layers.DHCPOptServerID:
+			return fmt.Errorf("option %d: %w", o.Type, errors.ErrBadEnumValue)
+		default:
+			if int(o.Length) != len(o.Data) {
+				return fmt.Errorf("option %d: length %d doesn't match data", o.Type, o.Length)
+			}
+		}
+	}
+
+	return nil
+}
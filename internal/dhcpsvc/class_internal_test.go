@@ -0,0 +1,265 @@
+package dhcpsvc
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBootRequest returns a DHCPv4 request of a network boot client.
+func newTestBootRequest(mac net.HardwareAddr, arch ClientArch, userClass []byte) (req *layers.DHCPv4) {
+	opts := layers.DHCPOptions{
+		layers.NewDHCPOption(layers.DHCPOptClassID, []byte("PXEClient:Arch:00000:UNDI:002001")),
+		layers.NewDHCPOption(dhcpOptClientArch, []byte{byte(arch >> 8), byte(arch)}),
+	}
+
+	if userClass != nil {
+		opts = append(opts, layers.NewDHCPOption(dhcpOptUserClass, userClass))
+	}
+
+	return &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		ClientHWAddr: mac,
+		Options:      opts,
+	}
+}
+
+func TestOptionClassConfig_match(t *testing.T) {
+	mac := net.HardwareAddr{0xb8, 0x27, 0xeb, 0x1, 0x2, 0x3}
+	otherMAC := net.HardwareAddr{0x0, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	testCases := []struct {
+		class *OptionClassConfig
+		req   *layers.DHCPv4
+		name  string
+		want  bool
+	}{{
+		class: &OptionClassConfig{VendorClass: "pxeclient"},
+		req:   newTestBootRequest(mac, ClientArchBIOS, nil),
+		name:  "vendor_class",
+		want:  true,
+	}, {
+		class: &OptionClassConfig{VendorClass: "MSFT"},
+		req:   newTestBootRequest(mac, ClientArchBIOS, nil),
+		name:  "other_vendor_class",
+		want:  false,
+	}, {
+		class: &OptionClassConfig{MACPrefix: mac[:3]},
+		req:   newTestBootRequest(mac, ClientArchBIOS, nil),
+		name:  "mac_prefix",
+		want:  true,
+	}, {
+		class: &OptionClassConfig{MACPrefix: mac[:3]},
+		req:   newTestBootRequest(otherMAC, ClientArchBIOS, nil),
+		name:  "other_mac_prefix",
+		want:  false,
+	}, {
+		class: &OptionClassConfig{Architectures: []ClientArch{ClientArchEFIBC, ClientArchEFIX64}},
+		req:   newTestBootRequest(mac, ClientArchEFIX64, nil),
+		name:  "uefi",
+		want:  true,
+	}, {
+		class: &OptionClassConfig{Architectures: []ClientArch{ClientArchEFIBC, ClientArchEFIX64}},
+		req:   newTestBootRequest(mac, ClientArchBIOS, nil),
+		name:  "bios_not_uefi",
+		want:  false,
+	}, {
+		class: &OptionClassConfig{UserClass: "iPXE"},
+		req:   newTestBootRequest(mac, ClientArchBIOS, []byte("iPXE")),
+		name:  "ipxe_raw",
+		want:  true,
+	}, {
+		class: &OptionClassConfig{UserClass: "iPXE"},
+		req:   newTestBootRequest(mac, ClientArchBIOS, []byte("\x03abc\x04iPXE")),
+		name:  "ipxe_rfc3004",
+		want:  true,
+	}, {
+		class: &OptionClassConfig{UserClass: "iPXE"},
+		req:   newTestBootRequest(mac, ClientArchBIOS, nil),
+		name:  "not_ipxe",
+		want:  false,
+	}, {
+		class: &OptionClassConfig{
+			VendorClass:   "PXEClient",
+			Architectures: []ClientArch{ClientArchBIOS},
+			MACPrefix:     mac[:3],
+		},
+		req:  newTestBootRequest(otherMAC, ClientArchBIOS, nil),
+		name: "partial",
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.class.match(tc.req))
+		})
+	}
+}
+
+func TestDHCPInterfaceV4_setResponseOptions(t *testing.T) {
+	iotMAC := net.HardwareAddr{0xb8, 0x27, 0xeb, 0x1, 0x2, 0x3}
+	pcMAC := net.HardwareAddr{0x0, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	gwIP := netip.MustParseAddr("192.168.0.1")
+	iotGW := netip.MustParseAddr("192.168.0.254")
+	dnsIP := netip.MustParseAddr("192.168.0.53")
+	bootIP := netip.MustParseAddr("192.168.0.10")
+
+	optDNS := layers.NewDHCPOption(layers.DHCPOptDNS, dnsIP.AsSlice())
+
+	conf := &IPv4Config{
+		Enabled:       true,
+		GatewayIP:     gwIP,
+		SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+		RangeStart:    netip.MustParseAddr("192.168.0.100"),
+		RangeEnd:      netip.MustParseAddr("192.168.0.200"),
+		LeaseDuration: time.Hour,
+		Options:       layers.DHCPOptions{optDNS},
+		Classes: []*OptionClassConfig{{
+			Name:      "iot",
+			MACPrefix: iotMAC[:3],
+			Options: layers.DHCPOptions{
+				layers.NewDHCPOption(layers.DHCPOptRouter, iotGW.AsSlice()),
+				layers.NewDHCPOption(layers.DHCPOptDNS, nil),
+			},
+		}, {
+			Name:          "bios",
+			VendorClass:   "PXEClient",
+			Architectures: []ClientArch{ClientArchBIOS},
+			NextServer:    bootIP,
+			BootFileName:  "undionly.kpxe",
+		}, {
+			Name:          "uefi",
+			VendorClass:   "PXEClient",
+			Architectures: []ClientArch{ClientArchEFIBC, ClientArchEFIX64},
+			NextServer:    bootIP,
+			BootFileName:  "ipxe.efi",
+		}, {
+			Name:         "ipxe",
+			UserClass:    "iPXE",
+			BootFileName: "http://192.168.0.10/boot.ipxe",
+		}},
+	}
+	require.NoError(t, conf.Validate())
+
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+	iface := newDHCPInterfaceV4(ctx, slogutil.NewDiscardLogger(), "eth0", conf)
+
+	leaseGW := netip.MustParseAddr("192.168.0.2")
+	lease := &Lease{
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptRouter, leaseGW.AsSlice()),
+		},
+	}
+
+	testCases := []struct {
+		req        *layers.DHCPv4
+		lease      *Lease
+		wantGW     netip.Addr
+		wantNext   netip.Addr
+		name       string
+		wantFile   string
+		wantHasDNS bool
+	}{{
+		req:        &layers.DHCPv4{ClientHWAddr: pcMAC},
+		lease:      nil,
+		wantGW:     gwIP,
+		wantNext:   netip.Addr{},
+		name:       "default",
+		wantFile:   "",
+		wantHasDNS: true,
+	}, {
+		req:        &layers.DHCPv4{ClientHWAddr: iotMAC},
+		lease:      nil,
+		wantGW:     iotGW,
+		wantNext:   netip.Addr{},
+		name:       "iot",
+		wantFile:   "",
+		wantHasDNS: false,
+	}, {
+		req:        &layers.DHCPv4{ClientHWAddr: iotMAC},
+		lease:      lease,
+		wantGW:     leaseGW,
+		wantNext:   netip.Addr{},
+		name:       "iot_lease",
+		wantFile:   "",
+		wantHasDNS: false,
+	}, {
+		req:        newTestBootRequest(pcMAC, ClientArchBIOS, nil),
+		lease:      nil,
+		wantGW:     gwIP,
+		wantNext:   bootIP,
+		name:       "pxe_bios",
+		wantFile:   "undionly.kpxe",
+		wantHasDNS: true,
+	}, {
+		req:        newTestBootRequest(pcMAC, ClientArchEFIX64, nil),
+		lease:      nil,
+		wantGW:     gwIP,
+		wantNext:   bootIP,
+		name:       "pxe_uefi",
+		wantFile:   "ipxe.efi",
+		wantHasDNS: true,
+	}, {
+		req:        newTestBootRequest(pcMAC, ClientArchEFIX64, []byte("iPXE")),
+		lease:      nil,
+		wantGW:     gwIP,
+		wantNext:   bootIP,
+		name:       "ipxe",
+		wantFile:   "http://192.168.0.10/boot.ipxe",
+		wantHasDNS: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &layers.DHCPv4{}
+			iface.setResponseOptions(ctx, resp, tc.req, tc.lease)
+
+			assert.Equal(t, tc.wantGW.AsSlice(), []byte(option4(resp, layers.DHCPOptRouter)))
+			assert.Equal(t, tc.wantHasDNS, option4(resp, layers.DHCPOptDNS) != nil)
+			assert.Equal(t, tc.wantFile, string(resp.File))
+
+			next, _ := netip.AddrFromSlice(resp.NextServerIP)
+			assert.Equal(t, tc.wantNext, next)
+
+			assert.IsIncreasing(t, optionCodes(resp.Options))
+		})
+	}
+}
+
+// optionCodes returns the codes of opts.
+func optionCodes(opts layers.DHCPOptions) (codes []layers.DHCPOpt) {
+	for _, o := range opts {
+		codes = append(codes, o.Type)
+	}
+
+	return codes
+}
+
+func TestDBLease_options(t *testing.T) {
+	l := &Lease{
+		IP:       netip.MustParseAddr("192.168.0.2"),
+		Hostname: "pxe",
+		HWAddr:   net.HardwareAddr{0x1, 0x2, 0x3, 0x4, 0x5, 0x6},
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptRouter, []byte{192, 168, 0, 254}),
+		},
+		IsStatic: true,
+	}
+
+	got, err := toDBLease(l).toInternal()
+	require.NoError(t, err)
+
+	assert.Equal(t, l, got)
+	assert.True(t, sameLease(l, got))
+
+	l.Options = layers.DHCPOptions{layers.NewDHCPOption(layers.DHCPOptServerID, nil)}
+	testutil.AssertErrorMsg(t, "option 54: bad enum value", validateLeaseOptions(l.Options))
+}
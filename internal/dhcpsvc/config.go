@@ -20,6 +20,15 @@ type Config struct {
 	// contain valid interface names and configurations.
 	Interfaces map[string]*InterfaceConfig
 
+	// RelayPools stores configurations of address pools for the clients behind
+	// DHCP relay agents identified by the pool name.  It may be empty and must
+	// only contain valid configurations.
+	RelayPools map[string]*RelayPoolConfig
+
+	// HA is the configuration of the lease-state synchronization with another
+	// DHCP server.  If nil, the synchronization is disabled.
+	HA *HAConfig
+
 	// Logger will be used to log the DHCP events.  It must not be nil.
 	Logger *slog.Logger
 
@@ -78,6 +87,14 @@ func (conf *Config) Validate() (err error) {
 		errs = validate.Append(errs, iface, ifaceConf)
 	}
 
+	if conf.HA != nil {
+		errs = validate.Append(errs, "HA", conf.HA)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(conf.RelayPools)) {
+		errs = validate.Append(errs, "relay pool "+name, conf.RelayPools[name])
+	}
+
 	return errors.Join(errs...)
 }
 
@@ -36,6 +36,22 @@ func TestConfig_Validate(t *testing.T) {
 		LeaseDuration: 1 * time.Hour,
 	}
 
+	badClassConf := &dhcpsvc.IPv4Config{
+		Enabled:       true,
+		GatewayIP:     netip.MustParseAddr("192.168.0.1"),
+		SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+		RangeStart:    netip.MustParseAddr("192.168.0.2"),
+		RangeEnd:      netip.MustParseAddr("192.168.0.254"),
+		LeaseDuration: 1 * time.Hour,
+		Classes: []*dhcpsvc.OptionClassConfig{{
+			Name:        "pxe",
+			VendorClass: "PXEClient",
+			NextServer:  netip.MustParseAddr("2001:db8::1"),
+		}, {
+			Name: "",
+		}, nil},
+	}
+
 	validIPv6Conf := &dhcpsvc.IPv6Config{
 		Enabled:       true,
 		RangeStart:    netip.MustParseAddr("2001:db8::1"),
@@ -44,6 +60,25 @@ func TestConfig_Validate(t *testing.T) {
 		RASLAACOnly:   true,
 	}
 
+	badIPv6Conf := &dhcpsvc.IPv6Config{
+		Enabled:       true,
+		RangeStart:    netip.MustParseAddr("2001:db8::1"),
+		LeaseDuration: 1 * time.Hour,
+		Reservations: []*dhcpsvc.DUIDReservation{{
+			DUID: []byte{0x00, 0x01},
+			IP:   netip.MustParseAddr("2001:db8::10"),
+		}, {
+			DUID: []byte{0x00, 0x01},
+			IP:   netip.MustParseAddr("2001:db8::1:10"),
+		}, {
+			IP: netip.MustParseAddr("2001:db8::10"),
+		}, nil},
+		PrefixDelegation: &dhcpsvc.PrefixDelegationConfig{
+			Prefix:          netip.MustParsePrefix("2001:db8:1::/48"),
+			DelegatedLength: 72,
+		},
+	}
+
 	leasesPath := filepath.Join(t.TempDir(), "leases.json")
 
 	testCases := []struct {
@@ -176,6 +211,97 @@ func TestConfig_Validate(t *testing.T) {
 		name: "bad_start",
 		wantErrMsg: "eth0: ipv4: range start 127.0.0.1 is not within 192.168.0.1/24" + "\n" +
 			"gateway ip 192.168.0.1 in the ip range 127.0.0.1-192.168.0.254",
+	}, {
+		conf: &dhcpsvc.Config{
+			Enabled:         true,
+			Logger:          discardLog,
+			LocalDomainName: testLocalTLD,
+			Interfaces:      testInterfaceConf,
+			RelayPools: map[string]*dhcpsvc.RelayPoolConfig{
+				"vlan10": {
+					IPv4:      validIPv4Conf,
+					CircuitID: "port1",
+				},
+			},
+			DBFilePath: leasesPath,
+		},
+		name:       "valid_relay_pool",
+		wantErrMsg: "",
+	}, {
+		conf: &dhcpsvc.Config{
+			Enabled:         true,
+			Logger:          discardLog,
+			LocalDomainName: testLocalTLD,
+			Interfaces:      testInterfaceConf,
+			RelayPools: map[string]*dhcpsvc.RelayPoolConfig{
+				"vlan10": nil,
+				"vlan20": {
+					IPv4: nil,
+				},
+			},
+			DBFilePath: leasesPath,
+		},
+		name:       "bad_relay_pools",
+		wantErrMsg: "relay pool vlan10: no value\nrelay pool vlan20: ipv4: no value",
+	}, {
+		conf: &dhcpsvc.Config{
+			Enabled:         true,
+			Logger:          discardLog,
+			LocalDomainName: testLocalTLD,
+			Interfaces:      testInterfaceConf,
+			RelayPools: map[string]*dhcpsvc.RelayPoolConfig{
+				"vlan10": {
+					IPv4: validIPv4Conf,
+					AllowedRelays: []netip.Addr{
+						netip.MustParseAddr("192.168.1.1"),
+						netip.MustParseAddr("2001:db8::1"),
+					},
+				},
+			},
+			DBFilePath: leasesPath,
+		},
+		name: "bad_allowed_relays",
+		wantErrMsg: "relay pool vlan10: allowed relay at index 1 2001:db8::1 " +
+			"must be a valid ipv4",
+	}, {
+		conf: &dhcpsvc.Config{
+			Enabled:         true,
+			Logger:          discardLog,
+			LocalDomainName: testLocalTLD,
+			Interfaces: map[string]*dhcpsvc.InterfaceConfig{
+				"eth0": {
+					IPv4: badClassConf,
+					IPv6: validIPv6Conf,
+				},
+			},
+			DBFilePath: leasesPath,
+		},
+		name: "bad_classes",
+		wantErrMsg: "eth0: ipv4: classes: at index 0: next server 2001:db8::1 " +
+			"must be a valid ipv4\n" +
+			"classes: at index 1: Name: empty value\n" +
+			"no conditions\n" +
+			"classes: at index 2: no value",
+	}, {
+		conf: &dhcpsvc.Config{
+			Enabled:         true,
+			Logger:          discardLog,
+			LocalDomainName: testLocalTLD,
+			Interfaces: map[string]*dhcpsvc.InterfaceConfig{
+				"eth0": {
+					IPv4: validIPv4Conf,
+					IPv6: badIPv6Conf,
+				},
+			},
+			DBFilePath: leasesPath,
+		},
+		name: "bad_reservations",
+		wantErrMsg: "eth0: ipv6: reservations: at index 1: ip 2001:db8::1:10 is not " +
+			"within the range starting at 2001:db8::1\n" +
+			"reservations: at index 1: duid 0001: duplicated value\n" +
+			"reservations: at index 2: DUID: no value\n" +
+			"reservations: at index 3: no value\n" +
+			"prefix delegation: DelegatedLength: out of range: must be no greater than 64, got 72",
 	}}
 
 	for _, tc := range testCases {
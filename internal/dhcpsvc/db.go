@@ -2,6 +2,7 @@ package dhcpsvc
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/fs"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/google/gopacket/layers"
 	"github.com/google/renameio/v2/maybe"
 )
 
@@ -28,17 +30,45 @@ type dataLeases struct {
 	// Leases is the list containing stored DHCP leases.
 	Leases []*dbLease `json:"leases"`
 
+	// Delegations is the list containing stored DHCPv6 prefix delegations.
+	Delegations []*dbDelegation `json:"delegations,omitempty"`
+
 	// Version is the current version of the structure.
 	Version int `json:"version"`
 }
 
 // dbLease is the structure of stored lease.
 type dbLease struct {
-	Expiry   string     `json:"expires"`
-	IP       netip.Addr `json:"ip"`
-	Hostname string     `json:"hostname"`
-	HWAddr   string     `json:"mac"`
-	IsStatic bool       `json:"static"`
+	Expiry   string      `json:"expires"`
+	IP       netip.Addr  `json:"ip"`
+	Hostname string      `json:"hostname"`
+	HWAddr   string      `json:"mac"`
+	Options  []*dbOption `json:"options,omitempty"`
+	IsStatic bool        `json:"static"`
+}
+
+// dbOption is the structure of stored DHCP option of a lease.
+type dbOption struct {
+	// Data is the hex-encoded value of the option.
+	Data string `json:"data"`
+
+	// Code is the code of the option.
+	Code layers.DHCPOpt `json:"code"`
+}
+
+// dbDelegation is the structure of stored DHCPv6 prefix delegation.
+type dbDelegation struct {
+	// Expiry is the expiration time of the delegation in RFC 3339 format.
+	Expiry string `json:"expires"`
+
+	// Prefix is the delegated prefix.
+	Prefix netip.Prefix `json:"prefix"`
+
+	// DUID is the hex-encoded DUID of the requesting router.
+	DUID string `json:"duid"`
+
+	// IAID is the identity association identifier of the IA_PD.
+	IAID uint32 `json:"iaid"`
 }
 
 // compareNames returns the result of comparing the hostnames of dl and other
@@ -63,10 +93,23 @@ func toDBLease(l *Lease) (dl *dbLease) {
 		Hostname: l.Hostname,
 		HWAddr:   l.HWAddr.String(),
 		IP:       l.IP,
+		Options:  toDBOptions(l.Options),
 		IsStatic: l.IsStatic,
 	}
 }
 
+// toDBOptions converts opts to the stored options.
+func toDBOptions(opts layers.DHCPOptions) (dbOpts []*dbOption) {
+	for _, o := range opts {
+		dbOpts = append(dbOpts, &dbOption{
+			Data: hex.EncodeToString(o.Data),
+			Code: o.Type,
+		})
+	}
+
+	return dbOpts
+}
+
 // toInternal converts dl to *Lease.
 func (dl *dbLease) toInternal() (l *Lease, err error) {
 	mac, err := net.ParseMAC(dl.HWAddr)
@@ -82,11 +125,23 @@ func (dl *dbLease) toInternal() (l *Lease, err error) {
 		}
 	}
 
+	var opts layers.DHCPOptions
+	for i, o := range dl.Options {
+		var data []byte
+		data, err = hex.DecodeString(o.Data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing option at index %d: %w", i, err)
+		}
+
+		opts = append(opts, layers.NewDHCPOption(o.Code, data))
+	}
+
 	return &Lease{
 		Expiry:   expiry,
 		IP:       dl.IP,
 		Hostname: dl.Hostname,
 		HWAddr:   mac,
+		Options:  opts,
 		IsStatic: dl.IsStatic,
 	}, nil
 }
@@ -118,6 +173,7 @@ func (srv *DHCPServer) dbLoad(ctx context.Context) (err error) {
 
 	srv.resetLeases()
 	srv.addDBLeases(ctx, dl.Leases)
+	srv.addDBDelegations(ctx, dl.Delegations)
 
 	return nil
 }
@@ -158,6 +214,77 @@ func (srv *DHCPServer) addDBLeases(ctx context.Context, leases []*dbLease) {
 	srv.logger.InfoContext(ctx, "loaded leases", "v4", v4, "v6", v6, "total", len(leases))
 }
 
+// addDBDelegations adds the unexpired delegations to the interfaces
+// delegating their prefixes.
+func (srv *DHCPServer) addDBDelegations(ctx context.Context, delegations []*dbDelegation) {
+	now := time.Now()
+
+	var n uint
+	for i, dd := range delegations {
+		key, d, err := dd.toInternal()
+		if err != nil {
+			srv.logger.WarnContext(ctx, "converting delegation", "idx", i, slogutil.KeyError, err)
+
+			continue
+		} else if now.After(d.expiry) {
+			continue
+		}
+
+		iface, ok := srv.interfaces6.findDelegating(d.prefix)
+		if !ok {
+			srv.logger.WarnContext(ctx, "no interface for delegation", "idx", i, "prefix", d.prefix)
+
+			continue
+		}
+
+		iface.delegations[key] = d
+		n++
+	}
+
+	srv.logger.InfoContext(ctx, "loaded delegations", "num", n, "total", len(delegations))
+}
+
+// toInternal converts dd to the delegation and its key.
+func (dd *dbDelegation) toInternal() (key delegationKey, d *delegation, err error) {
+	duid, err := hex.DecodeString(dd.DUID)
+	if err != nil {
+		return delegationKey{}, nil, fmt.Errorf("parsing duid: %w", err)
+	}
+
+	expiry, err := time.Parse(time.RFC3339, dd.Expiry)
+	if err != nil {
+		return delegationKey{}, nil, fmt.Errorf("parsing expiry time: %w", err)
+	}
+
+	key = delegationKey{
+		duid: string(duid),
+		iaid: dd.IAID,
+	}
+
+	return key, &delegation{expiry: expiry, prefix: dd.Prefix}, nil
+}
+
+// dbDelegations returns the delegations of all the interfaces sorted by
+// prefix.  It expects the [DHCPServer.leasesMu] to be locked.
+func (srv *DHCPServer) dbDelegations() (dds []*dbDelegation) {
+	for _, iface := range srv.interfaces6 {
+		for key, d := range iface.delegations {
+			dds = append(dds, &dbDelegation{
+				Expiry: d.expiry.Format(time.RFC3339),
+				Prefix: d.prefix,
+				DUID:   hex.EncodeToString([]byte(key.duid)),
+				IAID:   key.iaid,
+			})
+		}
+	}
+
+	slices.SortFunc(dds, func(a, b *dbDelegation) (res int) {
+		return a.Prefix.Addr().Compare(b.Prefix.Addr())
+	})
+
+	return dds
+}
+
 // writeDB writes leases to the database file.  It expects the
 // [DHCPServer.leasesMu] to be locked.
 func (srv *DHCPServer) dbStore(ctx context.Context) (err error) {
@@ -165,8 +292,9 @@ func (srv *DHCPServer) dbStore(ctx context.Context) (err error) {
 
 	dl := &dataLeases{
 		// Avoid writing null into the database file if there are no leases.
-		Leases:  make([]*dbLease, 0, srv.leases.len()),
-		Version: dataVersion,
+		Leases:      make([]*dbLease, 0, srv.leases.len()),
+		Delegations: srv.dbDelegations(),
+		Version:     dataVersion,
 	}
 
 	srv.leases.rangeLeases(func(l *Lease) (cont bool) {
@@ -0,0 +1,799 @@
+package dhcpsvc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/validate"
+	"github.com/google/gopacket/layers"
+)
+
+// HAMode is the failover mode of a pair of DHCP servers.
+type HAMode string
+
+const (
+	// HAModeActiveStandby means that the primary server serves all the clients
+	// while the secondary one only takes over when the primary is down.
+	HAModeActiveStandby HAMode = "active_standby"
+
+	// HAModeSplitScope means that each server allocates the addresses from its
+	// own half of each range, the primary from the lower one and the secondary
+	// from the upper one, and takes over the whole range when the peer is down.
+	HAModeSplitScope HAMode = "split_scope"
+)
+
+// HARole is the role of the DHCP server within a pair.
+type HARole string
+
+const (
+	// HARolePrimary is the role of the server that is active by default.
+	HARolePrimary HARole = "primary"
+
+	// HARoleSecondary is the role of the server that is standby by default.
+	HARoleSecondary HARole = "secondary"
+)
+
+// haMinSecretLen is the minimum length of the shared secret in bytes.
+const haMinSecretLen = 16
+
+// HAConfig is the configuration of the lease-state synchronization between two
+// DHCP servers.
+type HAConfig struct {
+	// PeerURL is the base URL of the peer's synchronization endpoint, for
+	// example "http://192.168.0.2:6767".  It must be an HTTP or HTTPS URL.
+	PeerURL *url.URL
+
+	// ListenAddr is the address to listen for the peer's messages on.  It must
+	// be valid.
+	ListenAddr netip.AddrPort
+
+	// Secret is the key shared with the peer, which is used to authenticate
+	// the messages.  It must be at least 16 bytes long.
+	Secret string
+
+	// Mode is the failover mode.  It must be the same on both peers.
+	Mode HAMode
+
+	// Role is the role of this server.  It must differ from the peer's one.
+	Role HARole
+
+	// HeartbeatInterval is the interval between the heartbeats sent to the
+	// peer.  It must be positive.
+	HeartbeatInterval time.Duration
+
+	// FailoverTimeout is the time after the last heartbeat from the peer after
+	// which the peer is considered down.  It must be greater than
+	// HeartbeatInterval.
+	FailoverTimeout time.Duration
+}
+
+// type check
+var _ validate.Interface = (*HAConfig)(nil)
+
+// Validate implements the [validate.Interface] interface for *HAConfig.
+func (c *HAConfig) Validate() (err error) {
+	if c == nil {
+		return errors.ErrNoValue
+	}
+
+	errs := []error{
+		validate.Positive("HeartbeatInterval", c.HeartbeatInterval),
+		validate.Positive("FailoverTimeout", c.FailoverTimeout),
+	}
+
+	switch {
+	case c.PeerURL == nil:
+		errs = append(errs, fmt.Errorf("PeerURL: %w", errors.ErrNoValue))
+	case c.PeerURL.Scheme != "http" && c.PeerURL.Scheme != "https":
+		errs = append(errs, fmt.Errorf("PeerURL: scheme: %w: %q", errors.ErrBadEnumValue, c.PeerURL.Scheme))
+	}
+
+	if !c.ListenAddr.IsValid() {
+		errs = append(errs, fmt.Errorf("ListenAddr: %w", errors.ErrNoValue))
+	}
+
+	if len(c.Secret) < haMinSecretLen {
+		errs = append(errs, fmt.Errorf("Secret: must be at least %d bytes long", haMinSecretLen))
+	}
+
+	switch c.Mode {
+	case HAModeActiveStandby, HAModeSplitScope:
+		// Go on.
+	default:
+		errs = append(errs, fmt.Errorf("Mode: %w: %q", errors.ErrBadEnumValue, c.Mode))
+	}
+
+	switch c.Role {
+	case HARolePrimary, HARoleSecondary:
+		// Go on.
+	default:
+		errs = append(errs, fmt.Errorf("Role: %w: %q", errors.ErrBadEnumValue, c.Role))
+	}
+
+	if c.FailoverTimeout <= c.HeartbeatInterval {
+		errs = append(errs, fmt.Errorf(
+			"FailoverTimeout %s must be greater than HeartbeatInterval %s",
+			c.FailoverTimeout,
+			c.HeartbeatInterval,
+		))
+	}
+
+	return errors.Join(errs...)
+}
+
+// haKind is the kind of the message sent between the peers.
+type haKind string
+
+const (
+	haKindHeartbeat haKind = "heartbeat"
+	haKindAdd       haKind = "add"
+	haKindUpdate    haKind = "update"
+	haKindRemove    haKind = "remove"
+	haKindFull      haKind = "full"
+)
+
+// haMessage is a message sent between the peers.
+type haMessage struct {
+	// Kind is the kind of the message.
+	Kind haKind `json:"kind"`
+
+	// Leases are the leases the message is about.  For [haKindFull] these are
+	// all the leases of the sender.
+	Leases []*dbLease `json:"leases"`
+}
+
+const (
+	// haPath is the path of the synchronization endpoint.
+	haPath = "/dhcp/ha"
+
+	// haHdrTimestamp is the HTTP header containing the Unix time of the
+	// message in seconds.
+	haHdrTimestamp = "X-Dhcp-Ha-Timestamp"
+
+	// haHdrSequence is the HTTP header containing the sequence number of the
+	// message.  The sequence numbers of the messages from a peer must strictly
+	// increase, so that the captured messages can't be replayed.  They are
+	// based on the Unix time in nanoseconds, so that they keep increasing
+	// across restarts of both peers.
+	haHdrSequence = "X-Dhcp-Ha-Sequence"
+
+	// haHdrSignature is the HTTP header containing the hex-encoded HMAC-SHA256
+	// signature of the timestamp, the sequence number, and the body of the
+	// message.
+	haHdrSignature = "X-Dhcp-Ha-Signature"
+
+	// haMaxClockSkew is the maximum difference between the timestamp of a
+	// message and the current time.
+	haMaxClockSkew = 30 * time.Second
+
+	// haMaxBodySize is the maximum size of a message body.
+	haMaxBodySize = 16 << 20
+
+	// haQueueSize is the maximum number of lease events waiting to be sent.
+	haQueueSize = 256
+)
+
+// haPeer replicates the lease events to the peer, receives the peer's ones,
+// and tracks the peer's availability.
+type haPeer struct {
+	// logger logs the synchronization events.
+	logger *slog.Logger
+
+	// client sends the messages to the peer.
+	client *http.Client
+
+	// handler handles the messages from the peer.
+	handler http.Handler
+
+	// sessionMu protects session.
+	sessionMu *sync.Mutex
+
+	// session is the state of the current run of the peer.  It's nil if the
+	// peer isn't started.
+	session *haSession
+
+	// peerURL is the URL of the peer's synchronization endpoint.
+	peerURL *url.URL
+
+	// listenAddr is the address to receive the peer's messages on.
+	listenAddr netip.AddrPort
+
+	// events is the queue of the lease events to send.
+	events chan *haMessage
+
+	// onMessage applies a message received from the peer.
+	onMessage func(ctx context.Context, msg *haMessage) (err error)
+
+	// snapshot returns all the local leases for the full synchronization.
+	snapshot func() (leases []*dbLease)
+
+	// lastSeen is the Unix time in nanoseconds of the last message received
+	// from the peer or the last successful request to it.
+	lastSeen *atomic.Int64
+
+	// needFull is true if the next message to the peer should be a full
+	// synchronization.
+	needFull *atomic.Bool
+
+	// seq is the sequence number of the last message sent to the peer.  See
+	// [haPeer.nextSeq].
+	seq *atomic.Uint64
+
+	// peerSeq is the sequence number of the last authentic message received
+	// from the peer.  It starts from the Unix time in nanoseconds of the
+	// server's creation, so that the messages captured before a restart can't
+	// be replayed after it.
+	peerSeq *atomic.Uint64
+
+	// secret is the shared key authenticating the messages.
+	secret []byte
+
+	// mode is the failover mode.
+	mode HAMode
+
+	// role is the role of this server.
+	role HARole
+
+	// heartbeatIvl is the interval between the heartbeats.
+	heartbeatIvl time.Duration
+
+	// failoverTimeout is the time without heartbeats after which the peer is
+	// considered down.
+	failoverTimeout time.Duration
+}
+
+// newHAPeer returns a new properly initialized *haPeer.  conf must be valid.
+func newHAPeer(
+	l *slog.Logger,
+	conf *HAConfig,
+	onMessage func(ctx context.Context, msg *haMessage) (err error),
+	snapshot func() (leases []*dbLease),
+) (p *haPeer) {
+	needFull := &atomic.Bool{}
+	needFull.Store(true)
+
+	peerSeq := &atomic.Uint64{}
+	peerSeq.Store(uint64(time.Now().UnixNano()))
+
+	p = &haPeer{
+		logger:          l,
+		client:          &http.Client{Timeout: conf.HeartbeatInterval},
+		sessionMu:       &sync.Mutex{},
+		peerURL:         conf.PeerURL.JoinPath(haPath),
+		listenAddr:      conf.ListenAddr,
+		events:          make(chan *haMessage, haQueueSize),
+		onMessage:       onMessage,
+		snapshot:        snapshot,
+		lastSeen:        &atomic.Int64{},
+		needFull:        needFull,
+		seq:             &atomic.Uint64{},
+		peerSeq:         peerSeq,
+		secret:          []byte(conf.Secret),
+		mode:            conf.Mode,
+		role:            conf.Role,
+		heartbeatIvl:    conf.HeartbeatInterval,
+		failoverTimeout: conf.FailoverTimeout,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodPost+" "+haPath, p.handleMessage)
+	p.handler = mux
+
+	return p
+}
+
+// haSession is the state of a single run of [haPeer] between its start and
+// shutdown.
+type haSession struct {
+	// server receives the messages from the peer.
+	server *http.Server
+
+	// done is closed when the session is stopped.
+	done chan struct{}
+
+	// stopOnce makes sure done is only closed once.
+	stopOnce *sync.Once
+}
+
+// stop stops the session.  It's safe for concurrent use and may be called
+// several times.
+func (s *haSession) stop(ctx context.Context) (err error) {
+	s.stopOnce.Do(func() { close(s.done) })
+
+	return s.server.Shutdown(ctx)
+}
+
+// start starts listening for the peer's messages and sending the local ones.
+// The peer may be started again after [haPeer.shutdown].
+func (p *haPeer) start(ctx context.Context) (err error) {
+	p.sessionMu.Lock()
+	defer p.sessionMu.Unlock()
+
+	if p.session != nil {
+		return errors.Error("ha peer is already started")
+	}
+
+	l, err := net.Listen("tcp", p.listenAddr.String())
+	if err != nil {
+		return fmt.Errorf("listening for peer: %w", err)
+	}
+
+	p.session = &haSession{
+		server: &http.Server{
+			Handler:           p.handler,
+			ReadHeaderTimeout: p.heartbeatIvl,
+		},
+		done:     make(chan struct{}),
+		stopOnce: &sync.Once{},
+	}
+
+	go p.serve(ctx, p.session.server, l)
+	go p.run(ctx, p.session.done)
+
+	return nil
+}
+
+// serve serves the peer's messages on l using srv.  It's used to run in a
+// separate goroutine.
+func (p *haPeer) serve(ctx context.Context, srv *http.Server, l net.Listener) {
+	defer slogutil.RecoverAndLog(ctx, p.logger)
+
+	err := srv.Serve(l)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		p.logger.ErrorContext(ctx, "serving peer", slogutil.KeyError, err)
+	}
+}
+
+// shutdown stops the peer.  It does nothing if the peer isn't started.
+func (p *haPeer) shutdown(ctx context.Context) (err error) {
+	p.sessionMu.Lock()
+	s := p.session
+	p.session = nil
+	p.sessionMu.Unlock()
+
+	if s == nil {
+		return nil
+	}
+
+	return s.stop(ctx)
+}
+
+// run sends the queued lease events and the heartbeats to the peer until done
+// is closed.  It's used to run in a separate goroutine.
+func (p *haPeer) run(ctx context.Context, done <-chan struct{}) {
+	defer slogutil.RecoverAndLog(ctx, p.logger)
+
+	t := time.NewTicker(p.heartbeatIvl)
+	defer t.Stop()
+
+	for {
+		var msg *haMessage
+		select {
+		case <-done:
+			return
+		case msg = <-p.events:
+			// Go on.
+		case <-t.C:
+			msg = &haMessage{Kind: haKindHeartbeat}
+		}
+
+		if p.needFull.Swap(false) {
+			msg = &haMessage{Kind: haKindFull, Leases: p.snapshot()}
+		}
+
+		err := p.send(ctx, msg)
+		if err != nil {
+			// Resynchronize everything once the peer is reachable again.
+			p.needFull.Store(true)
+			p.logger.DebugContext(ctx, "sending to peer", "kind", msg.Kind, slogutil.KeyError, err)
+		}
+	}
+}
+
+// replicate queues the lease event of the given kind to be sent to the peer.
+// p may be nil.
+func (p *haPeer) replicate(ctx context.Context, kind haKind, l *Lease) {
+	if p == nil {
+		return
+	}
+
+	msg := &haMessage{
+		Kind:   kind,
+		Leases: []*dbLease{toDBLease(l)},
+	}
+
+	select {
+	case p.events <- msg:
+		// Go on.
+	default:
+		p.needFull.Store(true)
+		p.logger.WarnContext(ctx, "peer queue is full, scheduling full sync")
+	}
+}
+
+// send signs and sends msg to the peer.
+func (p *haPeer) send(ctx context.Context, msg *haMessage) (err error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encoding: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.peerURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	seq := strconv.FormatUint(p.nextSeq(now), 10)
+	req.Header.Set(haHdrTimestamp, ts)
+	req.Header.Set(haHdrSequence, seq)
+	req.Header.Set(haHdrSignature, p.sign(ts, seq, body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	p.seen(ctx)
+
+	return nil
+}
+
+// nextSeq returns the sequence number of the next message sent at now.  It's
+// the Unix time of now in nanoseconds, unless it doesn't exceed the previous
+// one, so that the peer accepts the messages sent after its restart and rejects
+// the ones captured before it.
+func (p *haPeer) nextSeq(now time.Time) (n uint64) {
+	for {
+		last := p.seq.Load()
+		n = max(last+1, uint64(now.UnixNano()))
+		if p.seq.CompareAndSwap(last, n) {
+			return n
+		}
+	}
+}
+
+// sign returns the hex-encoded signature of the message with the given
+// timestamp, sequence number, and body.
+func (p *haPeer) sign(ts, seq string, body []byte) (sig string) {
+	mac := hmac.New(sha256.New, p.secret)
+	_, _ = mac.Write([]byte(ts))
+	_, _ = mac.Write([]byte{'\n'})
+	_, _ = mac.Write([]byte(seq))
+	_, _ = mac.Write([]byte{'\n'})
+	_, _ = mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns an error if the message with the given timestamp, sequence
+// number, signature, and body isn't authentic or has already been received.
+func (p *haPeer) verify(ts, seq, sig string, body []byte, now time.Time) (err error) {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad timestamp: %w", err)
+	}
+
+	if d := now.Sub(time.Unix(sec, 0)).Abs(); d > haMaxClockSkew {
+		return fmt.Errorf("timestamp is off by %s", d)
+	}
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad sequence number: %w", err)
+	}
+
+	want, err := hex.DecodeString(p.sign(ts, seq, body))
+	if err != nil {
+		// Should never happen.
+		panic(err)
+	}
+
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(want, got) {
+		return errors.Error("bad signature")
+	}
+
+	for {
+		last := p.peerSeq.Load()
+		if n <= last {
+			return fmt.Errorf("sequence number %d is not greater than %d", n, last)
+		} else if p.peerSeq.CompareAndSwap(last, n) {
+			return nil
+		}
+	}
+}
+
+// handleMessage handles the message from the peer.
+func (p *haPeer) handleMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, haMaxBodySize))
+	if err != nil {
+		http.Error(w, "reading body", http.StatusBadRequest)
+
+		return
+	}
+
+	err = p.verify(
+		r.Header.Get(haHdrTimestamp),
+		r.Header.Get(haHdrSequence),
+		r.Header.Get(haHdrSignature),
+		body,
+		time.Now(),
+	)
+	if err != nil {
+		p.logger.WarnContext(ctx, "rejecting peer message", "remote", r.RemoteAddr, slogutil.KeyError, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	msg := &haMessage{}
+	err = json.Unmarshal(body, msg)
+	if err != nil {
+		http.Error(w, "decoding body", http.StatusBadRequest)
+
+		return
+	}
+
+	p.seen(ctx)
+
+	err = p.onMessage(ctx, msg)
+	if err != nil {
+		p.logger.ErrorContext(ctx, "applying peer message", "kind", msg.Kind, slogutil.KeyError, err)
+		http.Error(w, "applying message", http.StatusInternalServerError)
+
+		return
+	}
+}
+
+// seen marks the peer as alive.  If the peer was considered down, the full
+// synchronization is scheduled.
+func (p *haPeer) seen(ctx context.Context) {
+	now := time.Now()
+	if !p.peerAlive(now) {
+		p.logger.InfoContext(ctx, "peer is up")
+		p.needFull.Store(true)
+	}
+
+	p.lastSeen.Store(now.UnixNano())
+}
+
+// peerAlive returns true if the peer has been seen within the failover timeout
+// before now.
+func (p *haPeer) peerAlive(now time.Time) (ok bool) {
+	last := p.lastSeen.Load()
+
+	return last != 0 && now.Sub(time.Unix(0, last)) < p.failoverTimeout
+}
+
+// serving returns true if the server should respond to the clients at now.  p
+// may be nil.
+func (p *haPeer) serving(now time.Time) (ok bool) {
+	if p == nil || p.mode == HAModeSplitScope {
+		return true
+	}
+
+	return p.role == HARolePrimary || !p.peerAlive(now)
+}
+
+// scope returns the part of the IPv4 range r the server may allocate addresses
+// from at now.  p may be nil.
+func (p *haPeer) scope(r ipRange, now time.Time) (res ipRange) {
+	if p == nil || p.mode != HAModeSplitScope || !p.peerAlive(now) {
+		return r
+	}
+
+	lower, upper := r.split4()
+	if p.role == HARolePrimary {
+		return lower
+	}
+
+	return upper
+}
+
+// addrSpace4 returns the part of the address space of iface the server may
+// allocate addresses from at now.  In the split-scope mode, it's the own half
+// of the address space while the peer is alive.
+func (srv *DHCPServer) addrSpace4(iface *dhcpInterfaceV4, now time.Time) (r ipRange) {
+	return srv.ha.scope(iface.addrSpace, now)
+}
+
+// split4 splits the IPv4 range r into two halves.  The lower one is larger if
+// the length of r is odd.
+func (r ipRange) split4() (lower, upper ipRange) {
+	start, end := r.start.As4(), r.end.As4()
+	s, e := ipv4ToUint32(start), ipv4ToUint32(end)
+	mid := s + (e-s)/2
+
+	lower = ipRange{start: r.start, end: uint32ToIPv4(mid)}
+	upper = ipRange{start: uint32ToIPv4(mid + 1), end: r.end}
+
+	return lower, upper
+}
+
+// ipv4ToUint32 converts the IPv4 address to a number.
+func ipv4ToUint32(ip [4]byte) (n uint32) {
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+// uint32ToIPv4 converts the number to an IPv4 address.
+func uint32ToIPv4(n uint32) (ip netip.Addr) {
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+}
+
+// applyHAMessage applies the message received from the peer.
+func (srv *DHCPServer) applyHAMessage(ctx context.Context, msg *haMessage) (err error) {
+	var apply func(ctx context.Context, l *Lease) (changed bool)
+	switch msg.Kind {
+	case haKindHeartbeat:
+		return nil
+	case haKindAdd, haKindUpdate, haKindFull:
+		apply = srv.mergeLease
+	case haKindRemove:
+		apply = srv.removeReplicated
+	default:
+		return fmt.Errorf("kind: %w: %q", errors.ErrBadEnumValue, msg.Kind)
+	}
+
+	srv.leasesMu.Lock()
+	defer srv.leasesMu.Unlock()
+
+	changed := 0
+	for i, dl := range msg.Leases {
+		l, convErr := dl.toInternal()
+		if convErr != nil {
+			srv.logger.WarnContext(ctx, "converting peer lease", "idx", i, slogutil.KeyError, convErr)
+
+			continue
+		}
+
+		if apply(ctx, l) {
+			changed++
+		}
+	}
+
+	srv.logger.DebugContext(ctx, "applied peer message", "kind", msg.Kind, "changed", changed)
+
+	if changed == 0 {
+		return nil
+	}
+
+	return srv.dbStore(ctx)
+}
+
+// supersedes returns true if the replicated lease l should replace the local
+// lease local.  Static leases win over the dynamic ones, the ones expiring
+// later win otherwise.
+func supersedes(l, local *Lease) (ok bool) {
+	if l.IsStatic != local.IsStatic {
+		return l.IsStatic
+	}
+
+	return !l.Expiry.Before(local.Expiry)
+}
+
+// sameLease returns true if a and b describe the same lease.
+func sameLease(a, b *Lease) (ok bool) {
+	return a.IP == b.IP &&
+		a.Hostname == b.Hostname &&
+		a.IsStatic == b.IsStatic &&
+		a.Expiry.Equal(b.Expiry) &&
+		slices.Equal(a.HWAddr, b.HWAddr) &&
+		slices.EqualFunc(a.Options, b.Options, func(x, y layers.DHCPOption) (ok bool) {
+			return x.Type == y.Type && bytes.Equal(x.Data, y.Data)
+		})
+}
+
+// mergeLease adds the replicated lease l, replacing the conflicting local
+// leases, unless any of them supersedes l.  It expects the
+// [DHCPServer.leasesMu] to be locked.
+func (srv *DHCPServer) mergeLease(ctx context.Context, l *Lease) (changed bool) {
+	iface, err := srv.ifaceForAddr(l.IP)
+	if err != nil {
+		srv.logger.DebugContext(ctx, "skipping peer lease", slogutil.KeyError, err)
+
+		return false
+	}
+
+	var conflicts []*Lease
+	if local, ok := srv.leases.leaseByAddr(l.IP); ok {
+		conflicts = append(conflicts, local)
+	}
+
+	if local, ok := srv.leases.leaseByName(l.Hostname); ok && !slices.Contains(conflicts, local) {
+		conflicts = append(conflicts, local)
+	}
+
+	if local, ok := iface.leases[macToKey(l.HWAddr)]; ok && !slices.Contains(conflicts, local) {
+		conflicts = append(conflicts, local)
+	}
+
+	for _, local := range conflicts {
+		if !supersedes(l, local) || sameLease(l, local) {
+			return false
+		}
+	}
+
+	for _, local := range conflicts {
+		srv.removeLocal(ctx, local)
+	}
+
+	err = srv.leases.add(l, iface)
+	if err != nil {
+		srv.logger.WarnContext(ctx, "adding peer lease", "ip", l.IP, slogutil.KeyError, err)
+
+		return len(conflicts) > 0
+	}
+
+	return true
+}
+
+// removeReplicated removes the local lease with the same IP and hardware
+// addresses as the replicated lease l, unless the local one supersedes l.  It
+// expects the [DHCPServer.leasesMu] to be locked.
+func (srv *DHCPServer) removeReplicated(ctx context.Context, l *Lease) (changed bool) {
+	local, ok := srv.leases.leaseByAddr(l.IP)
+	if !ok || !slices.Equal(local.HWAddr, l.HWAddr) || !supersedes(l, local) {
+		return false
+	}
+
+	srv.removeLocal(ctx, local)
+
+	return true
+}
+
+// removeLocal removes the local lease l.  It expects the
+// [DHCPServer.leasesMu] to be locked.
+func (srv *DHCPServer) removeLocal(ctx context.Context, l *Lease) {
+	iface, err := srv.ifaceForAddr(l.IP)
+	if err == nil {
+		err = srv.leases.remove(l, iface)
+	}
+
+	if err != nil {
+		srv.logger.WarnContext(ctx, "removing conflicting lease", "ip", l.IP, slogutil.KeyError, err)
+	}
+}
+
+// haSnapshot returns all the leases of the server for the full
+// synchronization.
+func (srv *DHCPServer) haSnapshot() (leases []*dbLease) {
+	srv.leasesMu.RLock()
+	defer srv.leasesMu.RUnlock()
+
+	leases = make([]*dbLease, 0, srv.leases.len())
+	srv.leases.rangeLeases(func(l *Lease) (cont bool) {
+		leases = append(leases, toDBLease(l))
+
+		return true
+	})
+
+	return leases
+}
@@ -0,0 +1,458 @@
+package dhcpsvc
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHASecret is the shared secret for tests.
+const testHASecret = "0123456789abcdef"
+
+// newTestHAConf returns a valid HA configuration with the given role.
+func newTestHAConf(role HARole, mode HAMode) (conf *HAConfig) {
+	return &HAConfig{
+		PeerURL:           &url.URL{Scheme: "http", Host: "127.0.0.1:1"},
+		ListenAddr:        netip.MustParseAddrPort("127.0.0.1:0"),
+		Secret:            testHASecret,
+		Mode:              mode,
+		Role:              role,
+		HeartbeatInterval: 100 * time.Millisecond,
+		FailoverTimeout:   time.Second,
+	}
+}
+
+// newTestHAServer returns a new DHCP server with the HA configuration.
+func newTestHAServer(tb testing.TB, haConf *HAConfig) (srv *DHCPServer) {
+	tb.Helper()
+
+	ctx := testutil.ContextWithTimeout(tb, time.Second)
+	srv, err := New(ctx, &Config{
+		Enabled:         true,
+		Logger:          slogutil.NewDiscardLogger(),
+		LocalDomainName: "local",
+		DBFilePath:      filepath.Join(tb.TempDir(), "leases.json"),
+		HA:              haConf,
+		Interfaces: map[string]*InterfaceConfig{
+			"eth0": {
+				IPv4: &IPv4Config{
+					Enabled:       true,
+					GatewayIP:     netip.MustParseAddr("192.168.0.1"),
+					SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+					RangeStart:    netip.MustParseAddr("192.168.0.100"),
+					RangeEnd:      netip.MustParseAddr("192.168.0.200"),
+					LeaseDuration: time.Hour,
+				},
+				IPv6: &IPv6Config{Enabled: false},
+			},
+		},
+	})
+	require.NoError(tb, err)
+
+	return srv
+}
+
+func TestHAConfig_Validate(t *testing.T) {
+	valid := newTestHAConf(HARolePrimary, HAModeActiveStandby)
+
+	badURL := newTestHAConf(HARolePrimary, HAModeActiveStandby)
+	badURL.PeerURL = &url.URL{Scheme: "ftp", Host: "127.0.0.1"}
+
+	badTimeouts := newTestHAConf(HARolePrimary, HAModeActiveStandby)
+	badTimeouts.FailoverTimeout = badTimeouts.HeartbeatInterval
+
+	badEnums := newTestHAConf("tertiary", "mirror")
+	badEnums.Secret = "short"
+
+	testCases := []struct {
+		conf       *HAConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       valid,
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "no value",
+	}, {
+		conf:       badURL,
+		name:       "bad_url",
+		wantErrMsg: `PeerURL: scheme: bad enum value: "ftp"`,
+	}, {
+		conf:       badTimeouts,
+		name:       "bad_timeouts",
+		wantErrMsg: "FailoverTimeout 100ms must be greater than HeartbeatInterval 100ms",
+	}, {
+		conf: badEnums,
+		name: "bad_enums",
+		wantErrMsg: "Secret: must be at least 16 bytes long\n" +
+			`Mode: bad enum value: "mirror"` + "\n" +
+			`Role: bad enum value: "tertiary"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.Validate())
+		})
+	}
+}
+
+func TestHAPeer_verify(t *testing.T) {
+	srv := newTestHAServer(t, newTestHAConf(HARolePrimary, HAModeActiveStandby))
+	p := srv.ha
+
+	now := time.Unix(time.Now().Unix(), 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"kind":"heartbeat"}`)
+
+	// The sequence numbers of the messages sent before the creation of the
+	// server are rejected.
+	seed := p.peerSeq.Load()
+	seq1, seq2, seq3 := seed+1, seed+2, seed+3
+	s1 := strconv.FormatUint(seq1, 10)
+	s2 := strconv.FormatUint(seq2, 10)
+	s3 := strconv.FormatUint(seq3, 10)
+	sig := p.sign(ts, s1, body)
+
+	testutil.AssertErrorMsg(t, "bad signature", p.verify(ts, s1, sig, []byte(`{}`), now))
+	testutil.AssertErrorMsg(t, "bad signature", p.verify(ts, s1, "zz", body, now))
+	testutil.AssertErrorMsg(t, "bad signature", p.verify(ts, s2, sig, body, now))
+	testutil.AssertErrorMsg(
+		t,
+		"timestamp is off by 1m0s",
+		p.verify(ts, s1, sig, body, now.Add(time.Minute)),
+	)
+	testutil.AssertErrorMsg(
+		t,
+		fmt.Sprintf("sequence number 1 is not greater than %d", seed),
+		p.verify(ts, "1", p.sign(ts, "1", body), body, now),
+	)
+
+	other := newTestHAConf(HARoleSecondary, HAModeActiveStandby)
+	other.Secret = "fedcba9876543210"
+	otherSrv := newTestHAServer(t, other)
+
+	testutil.AssertErrorMsg(t, "bad signature", otherSrv.ha.verify(ts, s1, sig, body, now))
+
+	require.NoError(t, p.verify(ts, s1, sig, body, now))
+
+	// The same message can't be replayed.
+	testutil.AssertErrorMsg(
+		t,
+		fmt.Sprintf("sequence number %d is not greater than %d", seq1, seq1),
+		p.verify(ts, s1, sig, body, now),
+	)
+
+	require.NoError(t, p.verify(ts, s3, p.sign(ts, s3, body), body, now))
+
+	testutil.AssertErrorMsg(
+		t,
+		fmt.Sprintf("sequence number %d is not greater than %d", seq2, seq3),
+		p.verify(ts, s2, p.sign(ts, s2, body), body, now),
+	)
+
+	// The message sent by a restarted peer is accepted.
+	restarted := newTestHAServer(t, newTestHAConf(HARoleSecondary, HAModeActiveStandby))
+	seq := strconv.FormatUint(restarted.ha.nextSeq(time.Now()), 10)
+	require.NoError(t, p.verify(ts, seq, p.sign(ts, seq, body), body, now))
+}
+
+func TestHAPeer_nextSeq(t *testing.T) {
+	srv := newTestHAServer(t, newTestHAConf(HARolePrimary, HAModeActiveStandby))
+	p := srv.ha
+
+	now := time.Now()
+	first := p.nextSeq(now)
+	assert.Equal(t, uint64(now.UnixNano()), first)
+
+	// The sequence numbers increase even if the clock doesn't.
+	assert.Equal(t, first+1, p.nextSeq(now))
+	assert.Equal(t, first+2, p.nextSeq(now.Add(-time.Second)))
+
+	later := now.Add(time.Second)
+	assert.Equal(t, uint64(later.UnixNano()), p.nextSeq(later))
+}
+
+func TestHAPeer_startShutdown(t *testing.T) {
+	srv := newTestHAServer(t, newTestHAConf(HARolePrimary, HAModeActiveStandby))
+	p := srv.ha
+
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+
+	// Shutting down the peer that isn't started does nothing.
+	require.NoError(t, p.shutdown(ctx))
+
+	require.NoError(t, p.start(ctx))
+	require.Error(t, p.start(ctx))
+
+	require.NoError(t, p.shutdown(ctx))
+	require.NoError(t, p.shutdown(ctx))
+
+	// The peer can be started again after the shutdown.
+	require.NoError(t, p.start(ctx))
+	require.NoError(t, p.shutdown(ctx))
+}
+
+func TestDHCPServer_allocate4_splitScope(t *testing.T) {
+	now := time.Now()
+	lowerIP := netip.MustParseAddr("192.168.0.100")
+	upperIP := netip.MustParseAddr("192.168.0.151")
+	mac := net.HardwareAddr{0x1, 0x2, 0x3, 0x4, 0x5, 0x6}
+
+	testCases := []struct {
+		lastSeen time.Time
+		reqIP    netip.Addr
+		wantIP   netip.Addr
+		role     HARole
+		name     string
+	}{{
+		lastSeen: now,
+		reqIP:    netip.Addr{},
+		wantIP:   lowerIP,
+		role:     HARolePrimary,
+		name:     "primary",
+	}, {
+		lastSeen: now,
+		reqIP:    netip.Addr{},
+		wantIP:   upperIP,
+		role:     HARoleSecondary,
+		name:     "secondary",
+	}, {
+		lastSeen: now,
+		reqIP:    lowerIP,
+		wantIP:   upperIP,
+		role:     HARoleSecondary,
+		name:     "secondary_peer_half",
+	}, {
+		lastSeen: now.Add(-time.Minute),
+		reqIP:    netip.Addr{},
+		wantIP:   lowerIP,
+		role:     HARoleSecondary,
+		name:     "secondary_takeover",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTestHAServer(t, newTestHAConf(tc.role, HAModeSplitScope))
+			srv.ha.lastSeen.Store(tc.lastSeen.UnixNano())
+
+			var opts layers.DHCPOptions
+			if tc.reqIP.IsValid() {
+				opts = append(opts, layers.NewDHCPOption(layers.DHCPOptRequestIP, tc.reqIP.AsSlice()))
+			}
+
+			req := newTestRequest4(mac, layers.DHCPMsgTypeDiscover, opts...)
+			l, ok := srv.allocate4(srv.interfaces4[0], req, tc.reqIP, now)
+			require.True(t, ok)
+
+			assert.Equal(t, tc.wantIP, l.IP)
+		})
+	}
+}
+
+func TestDHCPServer_applyHAMessage(t *testing.T) {
+	srv := newTestHAServer(t, newTestHAConf(HARolePrimary, HAModeActiveStandby))
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+
+	now := time.Now().Truncate(time.Second)
+	mac := net.HardwareAddr{0x1, 0x2, 0x3, 0x4, 0x5, 0x6}
+	ip := netip.MustParseAddr("192.168.0.100")
+
+	require.NoError(t, srv.AddLease(ctx, &Lease{
+		IP:       ip,
+		Hostname: "local",
+		HWAddr:   mac,
+		Expiry:   now.Add(time.Hour),
+	}))
+
+	newMsg := func(kind haKind, l *Lease) (msg *haMessage) {
+		return &haMessage{Kind: kind, Leases: []*dbLease{toDBLease(l)}}
+	}
+
+	// An older lease from the peer doesn't replace the local one.
+	require.NoError(t, srv.applyHAMessage(ctx, newMsg(haKindUpdate, &Lease{
+		IP:       ip,
+		Hostname: "older",
+		HWAddr:   mac,
+		Expiry:   now.Add(time.Minute),
+	})))
+	assert.Equal(t, "local", srv.HostByIP(ip))
+
+	// A lease expiring later does.
+	require.NoError(t, srv.applyHAMessage(ctx, newMsg(haKindUpdate, &Lease{
+		IP:       ip,
+		Hostname: "newer",
+		HWAddr:   mac,
+		Expiry:   now.Add(2 * time.Hour),
+	})))
+	assert.Equal(t, "newer", srv.HostByIP(ip))
+
+	// The removal of an older lease is ignored.
+	require.NoError(t, srv.applyHAMessage(ctx, newMsg(haKindRemove, &Lease{
+		IP:       ip,
+		Hostname: "newer",
+		HWAddr:   mac,
+		Expiry:   now.Add(time.Hour),
+	})))
+	assert.Equal(t, "newer", srv.HostByIP(ip))
+
+	// A static lease wins over the dynamic one with the same hardware address.
+	staticIP := netip.MustParseAddr("192.168.0.50")
+	require.NoError(t, srv.applyHAMessage(ctx, newMsg(haKindAdd, &Lease{
+		IP:       staticIP,
+		Hostname: "static",
+		HWAddr:   mac,
+		IsStatic: true,
+	})))
+	assert.Empty(t, srv.HostByIP(ip))
+	assert.Equal(t, "static", srv.HostByIP(staticIP))
+
+	// The removal of the same lease is applied.
+	require.NoError(t, srv.applyHAMessage(ctx, newMsg(haKindRemove, &Lease{
+		IP:       staticIP,
+		Hostname: "static",
+		HWAddr:   mac,
+		IsStatic: true,
+	})))
+	assert.Empty(t, srv.Leases())
+
+	testutil.AssertErrorMsg(
+		t,
+		`kind: bad enum value: "unknown"`,
+		srv.applyHAMessage(ctx, &haMessage{Kind: "unknown"}),
+	)
+}
+
+func TestHAPeer_serving(t *testing.T) {
+	r := ipRange{
+		start: netip.MustParseAddr("192.168.0.100"),
+		end:   netip.MustParseAddr("192.168.0.200"),
+	}
+
+	lower := ipRange{start: r.start, end: netip.MustParseAddr("192.168.0.150")}
+	upper := ipRange{start: netip.MustParseAddr("192.168.0.151"), end: r.end}
+
+	now := time.Now()
+	alive, dead := now.Add(-time.Millisecond), now.Add(-time.Minute)
+
+	testCases := []struct {
+		lastSeen    time.Time
+		wantScope   ipRange
+		role        HARole
+		mode        HAMode
+		name        string
+		wantServing bool
+	}{{
+		lastSeen:    alive,
+		wantScope:   r,
+		role:        HARolePrimary,
+		mode:        HAModeActiveStandby,
+		name:        "active_primary",
+		wantServing: true,
+	}, {
+		lastSeen:    alive,
+		wantScope:   r,
+		role:        HARoleSecondary,
+		mode:        HAModeActiveStandby,
+		name:        "active_secondary_standby",
+		wantServing: false,
+	}, {
+		lastSeen:    dead,
+		wantScope:   r,
+		role:        HARoleSecondary,
+		mode:        HAModeActiveStandby,
+		name:        "active_secondary_takeover",
+		wantServing: true,
+	}, {
+		lastSeen:    alive,
+		wantScope:   lower,
+		role:        HARolePrimary,
+		mode:        HAModeSplitScope,
+		name:        "split_primary",
+		wantServing: true,
+	}, {
+		lastSeen:    alive,
+		wantScope:   upper,
+		role:        HARoleSecondary,
+		mode:        HAModeSplitScope,
+		name:        "split_secondary",
+		wantServing: true,
+	}, {
+		lastSeen:    dead,
+		wantScope:   r,
+		role:        HARoleSecondary,
+		mode:        HAModeSplitScope,
+		name:        "split_secondary_takeover",
+		wantServing: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTestHAServer(t, newTestHAConf(tc.role, tc.mode))
+			srv.ha.lastSeen.Store(tc.lastSeen.UnixNano())
+
+			assert.Equal(t, tc.wantServing, srv.ha.serving(now))
+			assert.Equal(t, tc.wantScope, srv.ha.scope(r, now))
+		})
+	}
+
+	var p *haPeer
+	assert.True(t, p.serving(now))
+	assert.Equal(t, r, p.scope(r, now))
+}
+
+func TestHAPeer_replication(t *testing.T) {
+	primary := newTestHAServer(t, newTestHAConf(HARolePrimary, HAModeActiveStandby))
+	secondary := newTestHAServer(t, newTestHAConf(HARoleSecondary, HAModeActiveStandby))
+
+	peerSrv := httptest.NewServer(secondary.ha.handler)
+	t.Cleanup(peerSrv.Close)
+
+	peerURL, err := url.Parse(peerSrv.URL)
+	require.NoError(t, err)
+
+	primary.ha.peerURL = peerURL.JoinPath(haPath)
+
+	ctx := testutil.ContextWithTimeout(t, 5*time.Second)
+	done := make(chan struct{})
+	go primary.ha.run(ctx, done)
+	t.Cleanup(func() { close(done) })
+
+	ip := netip.MustParseAddr("192.168.0.100")
+	require.NoError(t, primary.AddLease(ctx, &Lease{
+		IP:       ip,
+		Hostname: "host",
+		HWAddr:   net.HardwareAddr{0x1, 0x2, 0x3, 0x4, 0x5, 0x6},
+		Expiry:   time.Now().Add(time.Hour),
+	}))
+
+	assert.Eventually(t, func() (ok bool) {
+		return secondary.HostByIP(ip) == "host"
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.True(t, primary.ha.peerAlive(time.Now()))
+	assert.True(t, secondary.ha.peerAlive(time.Now()))
+	assert.False(t, secondary.ha.serving(time.Now()))
+
+	// Unauthenticated requests are rejected.
+	resp, err := http.Post(peerURL.JoinPath(haPath).String(), "application/json", nil)
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, resp.Body.Close)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -42,9 +42,11 @@ func (srv *DHCPServer) serve(ctx context.Context) {
 			var rw responseWriter4
 			err = srv.serveV4(ctx, rw, pkt)
 		case layers.EthernetTypeIPv6:
-			// TODO(e.burkov):  Set the response writer.
-			var rw responseWriter6
-			err = srv.serveV6(ctx, rw, pkt)
+			// DHCPv6 messages are received through the UDP connection, see
+			// [DHCPServer.serveUDP6].
+			srv.logger.DebugContext(ctx, "skipping ipv6 packet")
+
+			continue
 		default:
 			// TODO(e.burkov):  It seems, there is another standard for Ethernet
 			// header, which uses the Length field instead of the EthernetType,
@@ -1,11 +1,16 @@
 package dhcpsvc
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 )
@@ -36,6 +41,14 @@ func (srv *DHCPServer) serveV4(
 		return nil
 	}
 
+	if giaddr, relayed := relayAddr4(req); relayed {
+		// The relayed messages are unicast to the server and are handled by
+		// [DHCPServer.serveRelayed].
+		srv.logger.DebugContext(ctx, "skipping relayed dhcpv4 packet", "giaddr", giaddr)
+
+		return nil
+	}
+
 	typ, ok := msg4Type(req)
 	if !ok {
 		// The "DHCP message type" option - must be included in every DHCP
@@ -55,38 +68,48 @@ func (srv *DHCPServer) handleDHCPv4(
 	typ layers.DHCPMsgType,
 	req *layers.DHCPv4,
 ) (err error) {
+	if !srv.ha.serving(time.Now()) {
+		srv.logger.DebugContext(ctx, "standby, skipping dhcpv4 message", "type", typ)
+
+		return nil
+	}
+
 	// Each interface should handle the DISCOVER and REQUEST messages offer and
 	// allocate the available leases.  The RELEASE and DECLINE messages should
 	// be handled by the server itself as it should remove the lease.
 	switch typ {
 	case layers.DHCPMsgTypeDiscover:
-		srv.handleDiscover(ctx, rw, req)
+		return srv.handleDiscover(ctx, rw, req)
 	case layers.DHCPMsgTypeRequest:
-		srv.handleRequest(ctx, rw, req)
-	case layers.DHCPMsgTypeRelease:
-		// TODO(e.burkov):  Remove the lease, either allocated or offered.
-	case layers.DHCPMsgTypeDecline:
-		// TODO(e.burkov):  Remove the allocated lease.  RFC tells it only
-		// possible if the client found the address already in use.
+		return srv.handleRequest(ctx, rw, req)
+	case layers.DHCPMsgTypeRelease, layers.DHCPMsgTypeDecline:
+		return srv.handleRelease(ctx, typ, req)
 	default:
 		// TODO(e.burkov):  Handle DHCPINFORM.
 		return fmt.Errorf("dhcpv4: request type: %w: %v", errors.ErrBadEnumValue, typ)
 	}
-
-	return nil
 }
 
 // handleDiscover handles the DHCPv4 message of discover type.
-func (srv *DHCPServer) handleDiscover(ctx context.Context, rw responseWriter4, req *layers.DHCPv4) {
-	// TODO(e.burkov):  Check existing leases, either allocated or offered.
-
+func (srv *DHCPServer) handleDiscover(
+	ctx context.Context,
+	rw responseWriter4,
+	req *layers.DHCPv4,
+) (err error) {
+	var errs []error
 	for _, iface := range srv.interfaces4 {
-		go iface.handleDiscover(ctx, rw, req)
+		errs = append(errs, srv.offer4(ctx, rw, iface, req))
 	}
+
+	return errors.Join(errs...)
 }
 
 // handleRequest handles the DHCPv4 message of request type.
-func (srv *DHCPServer) handleRequest(ctx context.Context, rw responseWriter4, req *layers.DHCPv4) {
+func (srv *DHCPServer) handleRequest(
+	ctx context.Context,
+	rw responseWriter4,
+	req *layers.DHCPv4,
+) (err error) {
 	srvID, hasSrvID := serverID4(req)
 	reqIP, hasReqIP := requestedIPv4(req)
 
@@ -99,10 +122,10 @@ func (srv *DHCPServer) handleRequest(ctx context.Context, rw responseWriter4, re
 		if !hasIface {
 			srv.logger.DebugContext(ctx, "skipping selecting request", "serverid", srvID)
 
-			return
+			return nil
 		}
 
-		iface.handleSelecting(ctx, rw, req, reqIP)
+		return srv.handleSelecting(ctx, rw, iface, req, srvID, reqIP)
 	case hasReqIP && !reqIP.IsUnspecified():
 		// Requested IP address option MUST be filled in with client's notion of
 		// its previously assigned address.
@@ -110,10 +133,10 @@ func (srv *DHCPServer) handleRequest(ctx context.Context, rw responseWriter4, re
 		if !hasIface {
 			srv.logger.DebugContext(ctx, "skipping init-reboot request", "requestedip", reqIP)
 
-			return
+			return nil
 		}
 
-		iface.handleInitReboot(ctx, rw, req, reqIP)
+		return srv.handleInitReboot(ctx, rw, iface, req, reqIP)
 	default:
 		// Server identifier MUST NOT be filled in, requested IP address option
 		// MUST NOT be filled in.
@@ -122,9 +145,226 @@ func (srv *DHCPServer) handleRequest(ctx context.Context, rw responseWriter4, re
 		if !hasIface {
 			srv.logger.DebugContext(ctx, "skipping init-reboot request", "clientip", ip)
 
-			return
+			return nil
 		}
 
-		iface.handleRenew(ctx, rw, req)
+		return srv.handleRenew(ctx, rw, iface, req)
+	}
+}
+
+// offer4 offers an address within iface to the client of the DHCPDISCOVER
+// message req.  The offered address isn't stored until the client requests
+// it.
+func (srv *DHCPServer) offer4(
+	ctx context.Context,
+	rw responseWriter4,
+	iface *dhcpInterfaceV4,
+	req *layers.DHCPv4,
+) (err error) {
+	if netutil.ValidateMAC(req.ClientHWAddr) != nil {
+		return fmt.Errorf("dhcpv4: discover: bad hardware address %s", req.ClientHWAddr)
+	}
+
+	reqIP, _ := requestedIPv4(req)
+
+	srv.leasesMu.RLock()
+	l, ok := srv.allocate4(iface, req, reqIP, time.Now())
+	srv.leasesMu.RUnlock()
+
+	if !ok {
+		iface.common.logger.WarnContext(ctx, "no addresses to offer", "mac", req.ClientHWAddr)
+
+		return nil
+	}
+
+	return rw.write(ctx, iface.newLeaseResponse(ctx, req, layers.DHCPMsgTypeOffer, l))
+}
+
+// handleSelecting handles the DHCPREQUEST message req in the SELECTING state,
+// which is sent in response to the offer of the server with srvID.  The
+// requested address is leased to the client if it's still available.
+func (srv *DHCPServer) handleSelecting(
+	ctx context.Context,
+	rw responseWriter4,
+	iface *dhcpInterfaceV4,
+	req *layers.DHCPv4,
+	srvID netip.Addr,
+	reqIP netip.Addr,
+) (err error) {
+	if srvID != iface.serverID() {
+		// The client has chosen another server.
+		iface.common.logger.DebugContext(ctx, "offer declined", "serverid", srvID)
+
+		return nil
 	}
+
+	return srv.ack4(ctx, rw, iface, req, reqIP, true)
+}
+
+// handleInitReboot handles the DHCPREQUEST message req in the INIT-REBOOT
+// state, which verifies the previously leased address reqIP.
+func (srv *DHCPServer) handleInitReboot(
+	ctx context.Context,
+	rw responseWriter4,
+	iface *dhcpInterfaceV4,
+	req *layers.DHCPv4,
+	reqIP netip.Addr,
+) (err error) {
+	return srv.ack4(ctx, rw, iface, req, reqIP, false)
+}
+
+// handleRenew handles the DHCPREQUEST message req in the RENEWING or REBINDING
+// state, which extends the lease of the address from the ciaddr field.
+func (srv *DHCPServer) handleRenew(
+	ctx context.Context,
+	rw responseWriter4,
+	iface *dhcpInterfaceV4,
+	req *layers.DHCPv4,
+) (err error) {
+	ip, _ := netip.AddrFromSlice(req.ClientIP.To4())
+
+	return srv.ack4(ctx, rw, iface, req, ip, false)
+}
+
+// ack4 leases the address ip within iface to the client of the DHCPREQUEST
+// message req and acknowledges it.  If the address can't be leased, the
+// request is declined.  If selecting is false, the client is expected to
+// already have a lease, and the requests of unknown clients are ignored.
+//
+// See https://datatracker.ietf.org/doc/html/rfc2131#section-4.3.2.
+func (srv *DHCPServer) ack4(
+	ctx context.Context,
+	rw responseWriter4,
+	iface *dhcpInterfaceV4,
+	req *layers.DHCPv4,
+	ip netip.Addr,
+	selecting bool,
+) (err error) {
+	if netutil.ValidateMAC(req.ClientHWAddr) != nil {
+		return fmt.Errorf("dhcpv4: request: bad hardware address %s", req.ClientHWAddr)
+	}
+
+	srv.leasesMu.Lock()
+	defer srv.leasesMu.Unlock()
+
+	existing := iface.common.leases[macToKey(req.ClientHWAddr)]
+	if existing == nil && !selecting {
+		// The server has no record of the client, so it must remain silent.
+		iface.common.logger.DebugContext(ctx, "no lease for request", "mac", req.ClientHWAddr)
+
+		return nil
+	}
+
+	l, ok := srv.allocate4(iface, req, ip, time.Now())
+	if !ok || l.IP != ip {
+		iface.common.logger.DebugContext(ctx, "declining request", "ip", ip, "mac", req.ClientHWAddr)
+
+		nak := iface.newResponse(req, layers.DHCPMsgTypeNak)
+		if _, relayed := relayAddr4(req); relayed {
+			// The relay agent must broadcast the DHCPNAK to the client, since
+			// the client may not have a valid address.
+			//
+			// See https://datatracker.ietf.org/doc/html/rfc2131#section-4.3.2.
+			nak.Flags |= flagBroadcast4
+		}
+
+		return rw.write(ctx, nak)
+	}
+
+	err = srv.commitLease(ctx, iface.common, l, existing)
+	if err != nil {
+		return fmt.Errorf("dhcpv4: committing lease: %w", err)
+	}
+
+	return rw.write(ctx, iface.newLeaseResponse(ctx, req, layers.DHCPMsgTypeAck, l))
+}
+
+// handleRelease handles the DHCPv4 messages of release and decline types by
+// removing the client's dynamic lease.  The released address is taken from the
+// ciaddr field and the declined one from the requested IP address option.
+func (srv *DHCPServer) handleRelease(
+	ctx context.Context,
+	typ layers.DHCPMsgType,
+	req *layers.DHCPv4,
+) (err error) {
+	ip, _ := netip.AddrFromSlice(req.ClientIP.To4())
+	if typ == layers.DHCPMsgTypeDecline {
+		// The client has found the address already in use.
+		ip, _ = requestedIPv4(req)
+	}
+
+	if !ip.IsValid() || netutil.ValidateMAC(req.ClientHWAddr) != nil {
+		return fmt.Errorf("dhcpv4: %s: no address or hardware address", typ)
+	}
+
+	return srv.removeLeaseByAddr(ctx, ip, req.ClientHWAddr)
+}
+
+// allocate4 returns the lease for the client of req within iface.  The address
+// is chosen from, in order of preference, the static or the existing lease of
+// the client, reqIP, and the first free address within the part of the range
+// the server may allocate from.  reqIP may be invalid.  It expects the
+// [DHCPServer.leasesMu] to be locked.
+func (srv *DHCPServer) allocate4(
+	iface *dhcpInterfaceV4,
+	req *layers.DHCPv4,
+	reqIP netip.Addr,
+	now time.Time,
+) (l *Lease, ok bool) {
+	mac := req.ClientHWAddr
+	existing := iface.common.leases[macToKey(mac)]
+	if existing != nil && existing.IsStatic {
+		return existing, true
+	}
+
+	l = &Lease{
+		HWAddr:   slices.Clone(mac),
+		Hostname: hostname4(req),
+		Expiry:   now.Add(iface.common.leaseTTL),
+	}
+
+	space := srv.addrSpace4(iface, now)
+	isFree := func(ip netip.Addr) (free bool) {
+		return ip != iface.gateway && srv.leases.isFree(ip, mac, now)
+	}
+
+	switch {
+	case existing != nil:
+		l.IP = existing.IP
+	case space.contains(reqIP) && isFree(reqIP):
+		l.IP = reqIP
+	default:
+		l.IP = space.find(isFree)
+		if !l.IP.IsValid() {
+			return nil, false
+		}
+	}
+
+	if l.Hostname == "" && existing != nil {
+		l.Hostname = existing.Hostname
+	}
+
+	if other, has := srv.leases.leaseByName(l.Hostname); l.Hostname == "" ||
+		(has && !bytes.Equal(other.HWAddr, l.HWAddr)) {
+		l.Hostname = generateHostname4(l.IP)
+	}
+
+	return l, true
+}
+
+// hostname4 returns the valid hostname from the Host Name option of req, if
+// any.
+func hostname4(req *layers.DHCPv4) (host string) {
+	host = strings.ToLower(string(option4(req, layers.DHCPOptHostname)))
+	if netutil.ValidateHostname(host) != nil {
+		return ""
+	}
+
+	return host
+}
+
+// generateHostname4 returns the hostname for the client having no hostname of
+// its own.
+func generateHostname4(ip netip.Addr) (host string) {
+	return strings.ReplaceAll(ip.String(), ".", "-")
 }
@@ -1,10 +1,17 @@
 package dhcpsvc
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 )
@@ -27,17 +34,155 @@ func (srv *DHCPServer) serveV6(
 		return nil
 	}
 
+	var srcMAC net.HardwareAddr
+	if eth, isEth := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); isEth {
+		srcMAC = eth.SrcMAC
+	}
+
 	// TODO(e.burkov):  Handle duplicate TransactionID.
 
-	return srv.handleDHCPv6(ctx, rw, msg.MsgType, msg)
+	return srv.handleDHCPv6(ctx, rw, msg.MsgType, msg, srcMAC)
+}
+
+// request6 is the parsed DHCPv6 message from the client.
+type request6 struct {
+	// msg is the original message.
+	msg *layers.DHCPv6
+
+	// mac is the hardware address of the client.  It's taken from the DUID,
+	// if possible, and from the Ethernet header otherwise.
+	mac net.HardwareAddr
+
+	// clientID is the DUID of the client.
+	clientID []byte
+
+	// serverID is the DUID of the server the message is addressed to, if any.
+	serverID []byte
+
+	// hostname is the hostname of the client from the Client FQDN option, if
+	// any.
+	hostname string
+
+	// iaNA are the IA_NA options of the message.
+	iaNA []*ia6
+
+	// iaPD are the IA_PD options of the message.
+	iaPD []*ia6
+
+	// rapidCommit is true if the client asks for the two-message exchange.
+	rapidCommit bool
 }
 
-// handleDHCPv6 handles the DHCPv6 message of the given type.
+// parseRequest6 parses msg.  srcMAC is the source address of the Ethernet
+// frame, if any.
+func parseRequest6(msg *layers.DHCPv6, srcMAC net.HardwareAddr) (req *request6, err error) {
+	req = &request6{
+		msg: msg,
+	}
+
+	var errs []error
+	for _, o := range msg.Options {
+		switch o.Code {
+		case layers.DHCPv6OptClientID:
+			req.clientID = o.Data
+		case layers.DHCPv6OptServerID:
+			req.serverID = o.Data
+		case layers.DHCPv6OptRapidCommit:
+			req.rapidCommit = true
+		case layers.DHCPv6OptClientFQDN:
+			req.hostname = hostnameFromFQDN(o.Data)
+		case layers.DHCPv6OptIANA, layers.DHCPv6OptIAPD:
+			ia, iaErr := parseIA6(o.Code, o.Data)
+			if iaErr != nil {
+				errs = append(errs, iaErr)
+			} else if o.Code == layers.DHCPv6OptIANA {
+				req.iaNA = append(req.iaNA, ia)
+			} else {
+				req.iaPD = append(req.iaPD, ia)
+			}
+		default:
+			// Ignore other options.
+		}
+	}
+
+	if len(req.clientID) > maxDUIDLen {
+		errs = append(errs, fmt.Errorf("client id: length %d is too long", len(req.clientID)))
+	}
+
+	var ok bool
+	if req.mac, ok = macFromDUID(req.clientID); !ok {
+		req.mac = srcMAC
+	}
+
+	return req, errors.Join(errs...)
+}
+
+// hostnameFromFQDN returns the first label of the domain name from the Client
+// FQDN option data, if it's a valid hostname.
+//
+// See https://datatracker.ietf.org/doc/html/rfc4704#section-4.
+func hostnameFromFQDN(data []byte) (host string) {
+	// Skip the flags field.
+	if len(data) < 2 {
+		return ""
+	}
+
+	l := int(data[1])
+	if l == 0 || len(data) < 2+l {
+		return ""
+	}
+
+	host = strings.ToLower(string(data[2 : 2+l]))
+	if netutil.ValidateHostname(host) != nil {
+		return ""
+	}
+
+	return host
+}
+
+// validateServerID returns an error if the Server Identifier option of req
+// doesn't conform to the message type typ.  ours is the DUID of the server.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8415#section-16.
+func validateServerID(typ layers.DHCPv6MsgType, req *request6, ours []byte) (err error) {
+	switch typ {
+	case
+		layers.DHCPv6MsgTypeSolicit,
+		layers.DHCPv6MsgTypeConfirm,
+		layers.DHCPv6MsgTypeRebind:
+		if req.serverID != nil {
+			return errors.Error("unexpected server id")
+		}
+	case
+		layers.DHCPv6MsgTypeRequest,
+		layers.DHCPv6MsgTypeRenew,
+		layers.DHCPv6MsgTypeRelease,
+		layers.DHCPv6MsgTypeDecline:
+		if !bytes.Equal(req.serverID, ours) {
+			return fmt.Errorf("server id %x doesn't match", req.serverID)
+		}
+	default:
+		// Information-request may omit the server identifier.
+		if req.serverID != nil && !bytes.Equal(req.serverID, ours) {
+			return fmt.Errorf("server id %x doesn't match", req.serverID)
+		}
+	}
+
+	if typ != layers.DHCPv6MsgTypeInformationRequest && len(req.clientID) == 0 {
+		return fmt.Errorf("client id: %w", errors.ErrNoValue)
+	}
+
+	return nil
+}
+
+// handleDHCPv6 handles the DHCPv6 message of the given type.  srcMAC is the
+// source address of the Ethernet frame, if any.
 func (srv *DHCPServer) handleDHCPv6(
-	_ context.Context,
-	_ responseWriter6,
+	ctx context.Context,
+	rw responseWriter6,
 	typ layers.DHCPv6MsgType,
-	_ *layers.DHCPv6,
+	msg *layers.DHCPv6,
+	srcMAC net.HardwareAddr,
 ) (err error) {
 	switch typ {
 	case
@@ -49,10 +194,406 @@ func (srv *DHCPServer) handleDHCPv6(
 		layers.DHCPv6MsgTypeInformationRequest,
 		layers.DHCPv6MsgTypeRelease,
 		layers.DHCPv6MsgTypeDecline:
-		// TODO(e.burkov):  Handle messages.
+		// Go on.
 	default:
 		return fmt.Errorf("dhcpv6: request type: %w: %v", errors.ErrBadEnumValue, typ)
 	}
 
-	return nil
+	if !srv.ha.serving(time.Now()) {
+		srv.logger.DebugContext(ctx, "standby, skipping dhcpv6 message", "type", typ)
+
+		return nil
+	}
+
+	req, err := parseRequest6(msg, srcMAC)
+	if err != nil {
+		return fmt.Errorf("dhcpv6: parsing %s: %w", typ, err)
+	}
+
+	iface, ok := srv.interfaces6.forRequest(req)
+	if !ok {
+		srv.logger.DebugContext(ctx, "no interface for dhcpv6 message", "type", typ)
+
+		return nil
+	}
+
+	err = validateServerID(typ, req, iface.serverID)
+	if err != nil {
+		// Such messages must be discarded silently.
+		iface.common.logger.DebugContext(ctx, "discarding dhcpv6 message", "type", typ, "reason", err)
+
+		return nil
+	} else if typ != layers.DHCPv6MsgTypeInformationRequest && netutil.ValidateMAC(req.mac) != nil {
+		return fmt.Errorf("dhcpv6: %s: no valid hardware address for client %x", typ, req.clientID)
+	}
+
+	resp := iface.newResponse(req, layers.DHCPv6MsgTypeReply)
+
+	switch typ {
+	case layers.DHCPv6MsgTypeSolicit:
+		commit := req.rapidCommit
+		if commit {
+			resp.Options = append(resp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptRapidCommit, nil))
+		} else {
+			resp.MsgType = layers.DHCPv6MsgTypeAdverstise
+		}
+
+		err = srv.assignIAs(ctx, iface, req, resp, commit, false)
+	case layers.DHCPv6MsgTypeRequest:
+		err = srv.assignIAs(ctx, iface, req, resp, true, false)
+	case layers.DHCPv6MsgTypeRenew, layers.DHCPv6MsgTypeRebind:
+		err = srv.assignIAs(ctx, iface, req, resp, true, true)
+	case layers.DHCPv6MsgTypeRelease, layers.DHCPv6MsgTypeDecline:
+		err = srv.releaseIAs(ctx, iface, req, resp)
+	case layers.DHCPv6MsgTypeConfirm:
+		iface.confirm(req, resp)
+	default:
+		// Information-request only needs the configuration options.
+	}
+	if err != nil {
+		return fmt.Errorf("dhcpv6: handling %s: %w", typ, err)
+	}
+
+	iface.appendOptions(resp)
+
+	return rw.write(ctx, resp)
+}
+
+// forRequest returns the interface responsible for req.  It chooses the one
+// containing the address hints, if any.
+//
+// TODO:  Use the network interface the message was received from.
+func (ifaces dhcpInterfacesV6) forRequest(req *request6) (iface *dhcpInterfaceV6, ok bool) {
+	for _, ia := range req.iaNA {
+		for _, h := range ia.hints {
+			iface, ok = ifaces.findInterface(h.Addr())
+			if ok {
+				return iface, true
+			}
+		}
+	}
+
+	if len(ifaces) == 0 {
+		return nil, false
+	}
+
+	return ifaces[0], true
+}
+
+// newResponse returns a new response of the given type to req.
+func (iface *dhcpInterfaceV6) newResponse(
+	req *request6,
+	typ layers.DHCPv6MsgType,
+) (resp *layers.DHCPv6) {
+	resp = &layers.DHCPv6{
+		MsgType:       typ,
+		TransactionID: slices.Clone(req.msg.TransactionID),
+	}
+
+	if req.clientID != nil {
+		resp.Options = append(resp.Options, layers.NewDHCPv6Option(
+			layers.DHCPv6OptClientID,
+			slices.Clone(req.clientID),
+		))
+	}
+
+	resp.Options = append(resp.Options, layers.NewDHCPv6Option(
+		layers.DHCPv6OptServerID,
+		slices.Clone(iface.serverID),
+	))
+
+	return resp
+}
+
+// appendOptions appends the configuration options of iface to resp.
+func (iface *dhcpInterfaceV6) appendOptions(resp *layers.DHCPv6) {
+	opts := slices.Concat(iface.implicitOpts, iface.explicitOpts)
+	slices.SortFunc(opts, compareV6OptionCodes)
+
+	for _, o := range opts {
+		if len(o.Data) > 0 {
+			resp.Options = append(resp.Options, o)
+		}
+	}
+}
+
+// assignIAs appends the IA options with the leased addresses and delegated
+// prefixes to resp.  If commit is true, the leases are stored.  If renew is
+// true, only the existing bindings are extended.
+func (srv *DHCPServer) assignIAs(
+	ctx context.Context,
+	iface *dhcpInterfaceV6,
+	req *request6,
+	resp *layers.DHCPv6,
+	commit bool,
+	renew bool,
+) (err error) {
+	srv.leasesMu.Lock()
+	defer srv.leasesMu.Unlock()
+
+	now := time.Now()
+	lt := newIALifetimes(iface.common.leaseTTL)
+	expiry := now.Add(iface.common.leaseTTL)
+
+	for _, ia := range req.iaNA {
+		var opt layers.DHCPv6Option
+		opt, err = srv.assignAddr(ctx, iface, req, ia, now, commit, renew)
+		if err != nil {
+			return err
+		}
+
+		resp.Options = append(resp.Options, opt)
+	}
+
+	delegated := false
+	for _, ia := range req.iaPD {
+		key := delegationKey{duid: string(req.clientID), iaid: ia.id}
+
+		_, bound := iface.delegations[key]
+		if renew && !bound {
+			resp.Options = append(resp.Options, newIAOption6(
+				layers.DHCPv6OptIAPD, ia.id, lt, nil, statusNoBinding6, "no binding",
+			))
+
+			continue
+		}
+
+		p, ok := iface.delegate(key, ia.hints, now, expiry, commit)
+		if !ok {
+			resp.Options = append(resp.Options, newIAOption6(
+				layers.DHCPv6OptIAPD, ia.id, lt, nil, statusNoPrefixAvail6, "no prefixes available",
+			))
+
+			continue
+		}
+
+		if commit {
+			delegated = true
+			iface.common.logger.DebugContext(ctx, "delegated prefix", "prefix", p, "iaid", ia.id)
+		}
+
+		resp.Options = append(resp.Options, newIAOption6(
+			layers.DHCPv6OptIAPD, ia.id, lt, []netip.Prefix{p}, statusSuccess6, "",
+		))
+	}
+
+	if !delegated {
+		return nil
+	}
+
+	return srv.dbStore(ctx)
+}
+
+// assignAddr returns the IA_NA option with the address leased to the client
+// for ia.  It expects the [DHCPServer.leasesMu] to be locked.
+func (srv *DHCPServer) assignAddr(
+	ctx context.Context,
+	iface *dhcpInterfaceV6,
+	req *request6,
+	ia *ia6,
+	now time.Time,
+	commit bool,
+	renew bool,
+) (opt layers.DHCPv6Option, err error) {
+	lt := newIALifetimes(iface.common.leaseTTL)
+
+	existing := iface.common.leases[macToKey(req.mac)]
+	if renew && existing == nil {
+		return newIAOption6(layers.DHCPv6OptIANA, ia.id, lt, nil, statusNoBinding6, "no binding"), nil
+	}
+
+	l, ok := iface.allocate(srv.leases, req, ia, existing, now)
+	if !ok {
+		return newIAOption6(
+			layers.DHCPv6OptIANA, ia.id, lt, nil, statusNoAddrsAvail6, "no addresses available",
+		), nil
+	}
+
+	if commit {
+		err = srv.commitLease(ctx, iface.common, l, existing)
+		if err != nil {
+			return layers.DHCPv6Option{}, err
+		}
+	}
+
+	return newIAOption6(layers.DHCPv6OptIANA, ia.id, lt, []netip.Prefix{
+		netip.PrefixFrom(l.IP, netutil.IPv6BitLen),
+	}, statusSuccess6, ""), nil
+}
+
+// allocate returns the lease for the client of req.  The address is chosen
+// from, in order of preference, the DUID reservation, the existing lease, the
+// hints of ia, and the first free address within the range.  It expects the
+// [DHCPServer.leasesMu] to be locked.
+func (iface *dhcpInterfaceV6) allocate(
+	idx *leaseIndex,
+	req *request6,
+	ia *ia6,
+	existing *Lease,
+	now time.Time,
+) (l *Lease, ok bool) {
+	if existing != nil && existing.IsStatic {
+		return existing, true
+	}
+
+	l = &Lease{
+		HWAddr:   slices.Clone(req.mac),
+		Hostname: req.hostname,
+		Expiry:   now.Add(iface.common.leaseTTL),
+	}
+
+	if r, has := iface.reservations[string(req.clientID)]; has && idx.isFree(r.IP, req.mac, now) {
+		l.IP = r.IP
+		if r.Hostname != "" {
+			l.Hostname = r.Hostname
+		}
+	} else if existing != nil {
+		l.IP = existing.IP
+	} else if l.IP, ok = iface.hintedAddr(idx, req, ia, now); !ok {
+		l.IP, ok = iface.freeAddr(idx, req.mac, now)
+		if !ok {
+			return nil, false
+		}
+	}
+
+	if l.Hostname == "" && existing != nil {
+		l.Hostname = existing.Hostname
+	}
+
+	if other, has := idx.leaseByName(l.Hostname); l.Hostname == "" ||
+		(has && !bytes.Equal(other.HWAddr, l.HWAddr)) {
+		l.Hostname = generateHostname6(l.IP)
+	}
+
+	return l, true
+}
+
+// generateHostname6 returns the hostname for the client having no hostname of
+// its own.
+func generateHostname6(ip netip.Addr) (host string) {
+	return strings.ReplaceAll(ip.StringExpanded(), ":", "-")
+}
+
+// isReserved returns true if ip is reserved for a client with DUID other than
+// duid.
+func (iface *dhcpInterfaceV6) isReserved(ip netip.Addr, duid []byte) (ok bool) {
+	for id, r := range iface.reservations {
+		if r.IP == ip && id != string(duid) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hintedAddr returns the first address from the hints of ia, which can be
+// leased to the client of req.  It expects the [DHCPServer.leasesMu] to be
+// locked.
+func (iface *dhcpInterfaceV6) hintedAddr(
+	idx *leaseIndex,
+	req *request6,
+	ia *ia6,
+	now time.Time,
+) (ip netip.Addr, ok bool) {
+	for _, h := range ia.hints {
+		ip = h.Addr()
+		if inRange6(iface.rangeStart, ip) &&
+			!iface.isReserved(ip, req.clientID) &&
+			idx.isFree(ip, req.mac, now) {
+			return ip, true
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+// freeAddr returns the first address within the range of iface, which can be
+// leased to the client with the given hardware address.  It expects the
+// [DHCPServer.leasesMu] to be locked.
+func (iface *dhcpInterfaceV6) freeAddr(
+	idx *leaseIndex,
+	mac net.HardwareAddr,
+	now time.Time,
+) (ip netip.Addr, ok bool) {
+	for ip = iface.rangeStart; inRange6(iface.rangeStart, ip); ip = ip.Next() {
+		if !iface.isReserved(ip, nil) && idx.isFree(ip, mac, now) {
+			return ip, true
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+// releaseIAs removes the dynamic leases and delegations of the client for the
+// IA options of req and sets the status of resp.
+func (srv *DHCPServer) releaseIAs(
+	ctx context.Context,
+	iface *dhcpInterfaceV6,
+	req *request6,
+	resp *layers.DHCPv6,
+) (err error) {
+	srv.leasesMu.Lock()
+	defer srv.leasesMu.Unlock()
+
+	lt := iaLifetimes{}
+	for _, ia := range req.iaNA {
+		l := iface.common.leases[macToKey(req.mac)]
+		if l == nil || !slices.ContainsFunc(ia.hints, func(p netip.Prefix) (ok bool) {
+			return p.Addr() == l.IP
+		}) {
+			resp.Options = append(resp.Options, newIAOption6(
+				layers.DHCPv6OptIANA, ia.id, lt, nil, statusNoBinding6, "no binding",
+			))
+
+			continue
+		}
+
+		if l.IsStatic {
+			continue
+		}
+
+		err = srv.leases.remove(l, iface.common)
+		if err != nil {
+			return fmt.Errorf("removing lease: %w", err)
+		}
+
+		srv.ha.replicate(ctx, haKindRemove, l)
+
+		iface.common.logger.DebugContext(ctx, "released address", "ip", l.IP, "mac", l.HWAddr)
+	}
+
+	for _, ia := range req.iaPD {
+		key := delegationKey{duid: string(req.clientID), iaid: ia.id}
+		if _, ok := iface.delegations[key]; !ok {
+			resp.Options = append(resp.Options, newIAOption6(
+				layers.DHCPv6OptIAPD, ia.id, lt, nil, statusNoBinding6, "no binding",
+			))
+
+			continue
+		}
+
+		delete(iface.delegations, key)
+	}
+
+	resp.Options = append(resp.Options, newStatusOption6(statusSuccess6, ""))
+
+	return srv.dbStore(ctx)
+}
+
+// confirm sets the status of resp depending on whether all the addresses
+// within the IA_NA options of req are appropriate for the link.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8415#section-18.3.3.
+func (iface *dhcpInterfaceV6) confirm(req *request6, resp *layers.DHCPv6) {
+	for _, ia := range req.iaNA {
+		for _, h := range ia.hints {
+			if !inRange6(iface.rangeStart, h.Addr()) {
+				resp.Options = append(resp.Options, newStatusOption6(statusNotOnLink6, "not on link"))
+
+				return
+			}
+		}
+	}
+
+	resp.Options = append(resp.Options, newStatusOption6(statusSuccess6, ""))
 }
@@ -0,0 +1,336 @@
+package dhcpsvc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// maxDUIDLen is the maximum length of a DUID including the 2-byte type
+	// code.
+	//
+	// See https://datatracker.ietf.org/doc/html/rfc8415#section-11.1.
+	maxDUIDLen = 130
+
+	// maxDelegatedLen is the maximum length of a delegated prefix, so that
+	// the requesting router is still able to use SLAAC within it.
+	maxDelegatedLen = 64
+)
+
+// duidTypeUUID is the type of DUID based on Universally Unique Identifier.
+//
+// See https://datatracker.ietf.org/doc/html/rfc6355.
+const duidTypeUUID layers.DHCPv6DUIDType = 4
+
+// statusCode6 is the status code of the DHCPv6 Status Code option.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8415#section-21.13.
+type statusCode6 uint16
+
+// Status codes used by the server.
+const (
+	statusSuccess6       statusCode6 = 0
+	statusNoAddrsAvail6  statusCode6 = 2
+	statusNoBinding6     statusCode6 = 3
+	statusNotOnLink6     statusCode6 = 4
+	statusNoPrefixAvail6 statusCode6 = 6
+)
+
+// newServerDUID returns a DUID-UUID for the server on the network interface
+// with the given name and range start.  It remains the same across restarts
+// while the configuration stays the same.
+func newServerDUID(ifaceName string, rangeStart netip.Addr) (duid []byte) {
+	sum := sha256.Sum256(append([]byte(ifaceName), rangeStart.AsSlice()...))
+
+	duid = binary.BigEndian.AppendUint16(nil, uint16(duidTypeUUID))
+
+	return append(duid, sum[:16]...)
+}
+
+// macFromDUID returns the Ethernet hardware address contained in the DUID of
+// type LLT or LL, if any.
+func macFromDUID(duid []byte) (mac net.HardwareAddr, ok bool) {
+	d := &layers.DHCPv6DUID{}
+	err := d.DecodeFromBytes(duid)
+	if err != nil {
+		return nil, false
+	}
+
+	switch d.Type {
+	case layers.DHCPv6DUIDTypeLLT, layers.DHCPv6DUIDTypeLL:
+		if d.HardwareType[1] == 1 && len(d.LinkLayerAddress) == 6 {
+			return d.LinkLayerAddress, true
+		}
+	default:
+		// Go on.
+	}
+
+	return nil, false
+}
+
+// ia6 is the Identity Association option for either non-temporary addresses or
+// prefix delegation.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8415#section-21.4 and
+// https://datatracker.ietf.org/doc/html/rfc8415#section-21.21.
+type ia6 struct {
+	// hints are the addresses or prefixes within the IA the client asks for.
+	// For IA_NA those are single-address prefixes.
+	hints []netip.Prefix
+
+	// id is the identity association identifier.
+	id uint32
+}
+
+// parseIA6 parses the data of the IA_NA or the IA_PD option, depending on
+// code.
+func parseIA6(code layers.DHCPv6Opt, data []byte) (ia *ia6, err error) {
+	// The IAID, T1, and T2 fields.
+	const hdrLen = 12
+
+	if len(data) < hdrLen {
+		return nil, fmt.Errorf("option %s: %d bytes is too short", code, len(data))
+	}
+
+	ia = &ia6{
+		id: binary.BigEndian.Uint32(data),
+	}
+
+	opts, err := parseOptions6(data[hdrLen:])
+	if err != nil {
+		return nil, fmt.Errorf("option %s: %w", code, err)
+	}
+
+	for _, o := range opts {
+		switch {
+		case code == layers.DHCPv6OptIANA && o.Code == layers.DHCPv6OptIAAddr && len(o.Data) >= 24:
+			addr := netip.AddrFrom16([16]byte(o.Data[:16]))
+			ia.hints = append(ia.hints, netip.PrefixFrom(addr, net.IPv6len*8))
+		case code == layers.DHCPv6OptIAPD && o.Code == layers.DHCPv6OptIAPrefix && len(o.Data) >= 25:
+			addr := netip.AddrFrom16([16]byte(o.Data[9:25]))
+			pref, pErr := addr.Prefix(int(o.Data[8]))
+			if pErr == nil && !addr.IsUnspecified() {
+				ia.hints = append(ia.hints, pref)
+			}
+		default:
+			// Ignore other options.
+		}
+	}
+
+	return ia, nil
+}
+
+// parseOptions6 parses the encapsulated DHCPv6 options from data.
+func parseOptions6(data []byte) (opts layers.DHCPv6Options, err error) {
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("option header: %d bytes is too short", len(data))
+		}
+
+		code := layers.DHCPv6Opt(binary.BigEndian.Uint16(data))
+		l := int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+l {
+			return nil, fmt.Errorf("option %s: length %d is out of bounds", code, l)
+		}
+
+		opts = append(opts, layers.NewDHCPv6Option(code, data[4:4+l]))
+		data = data[4+l:]
+	}
+
+	return opts, nil
+}
+
+// appendOption6 appends the encoded option to b.
+func appendOption6(b []byte, o layers.DHCPv6Option) (res []byte) {
+	res = binary.BigEndian.AppendUint16(b, uint16(o.Code))
+	res = binary.BigEndian.AppendUint16(res, uint16(len(o.Data)))
+
+	return append(res, o.Data...)
+}
+
+// newStatusOption6 returns the Status Code option with the given code and
+// message.
+func newStatusOption6(code statusCode6, msg string) (opt layers.DHCPv6Option) {
+	data := binary.BigEndian.AppendUint16(nil, uint16(code))
+
+	return layers.NewDHCPv6Option(layers.DHCPv6OptStatusCode, append(data, msg...))
+}
+
+// iaLifetimes are the timers of the identity association and its leases.
+type iaLifetimes struct {
+	// t1 is the time the client should contact the server to renew.
+	t1 time.Duration
+
+	// t2 is the time the client should contact any server to rebind.
+	t2 time.Duration
+
+	// lifetime is both the preferred and the valid lifetime of the leased
+	// addresses and prefixes.
+	lifetime time.Duration
+}
+
+// newIALifetimes returns the lifetimes for the lease of the given duration
+// using the recommended ratios for T1 and T2.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8415#section-21.4.
+func newIALifetimes(ttl time.Duration) (lt iaLifetimes) {
+	return iaLifetimes{
+		t1:       ttl / 2,
+		t2:       ttl * 4 / 5,
+		lifetime: ttl,
+	}
+}
+
+// seconds returns d as the number of seconds suitable for DHCPv6 time fields.
+func seconds(d time.Duration) (s uint32) {
+	return uint32(d / time.Second)
+}
+
+// newIAOption6 returns the IA_NA or the IA_PD option, depending on code, with
+// the given leased addresses or prefixes.  If status is not
+// [statusSuccess6], the option only contains the status.
+func newIAOption6(
+	code layers.DHCPv6Opt,
+	id uint32,
+	lt iaLifetimes,
+	leased []netip.Prefix,
+	status statusCode6,
+	msg string,
+) (opt layers.DHCPv6Option) {
+	data := binary.BigEndian.AppendUint32(nil, id)
+	if status != statusSuccess6 {
+		data = binary.BigEndian.AppendUint64(data, 0)
+		data = appendOption6(data, newStatusOption6(status, msg))
+
+		return layers.NewDHCPv6Option(code, data)
+	}
+
+	data = binary.BigEndian.AppendUint32(data, seconds(lt.t1))
+	data = binary.BigEndian.AppendUint32(data, seconds(lt.t2))
+
+	for _, p := range leased {
+		var sub []byte
+		sub = binary.BigEndian.AppendUint32(sub, seconds(lt.lifetime))
+		sub = binary.BigEndian.AppendUint32(sub, seconds(lt.lifetime))
+
+		if code == layers.DHCPv6OptIANA {
+			sub = append(p.Addr().AsSlice(), sub...)
+			data = appendOption6(data, layers.NewDHCPv6Option(layers.DHCPv6OptIAAddr, sub))
+		} else {
+			sub = append(sub, byte(p.Bits()))
+			sub = append(sub, p.Addr().AsSlice()...)
+			data = appendOption6(data, layers.NewDHCPv6Option(layers.DHCPv6OptIAPrefix, sub))
+		}
+	}
+
+	return layers.NewDHCPv6Option(code, data)
+}
+
+// delegationKey is the key of a delegated prefix.
+type delegationKey struct {
+	// duid is the DUID of the requesting router.
+	duid string
+
+	// iaid is the identity association identifier of the IA_PD.
+	iaid uint32
+}
+
+// delegation is a prefix delegated to the requesting router.
+type delegation struct {
+	// expiry is the time the delegation expires.
+	expiry time.Time
+
+	// prefix is the delegated prefix.
+	prefix netip.Prefix
+}
+
+// subprefix returns the n-th prefix of the delegated length within the pool of
+// c.  ok is false if there is no such prefix.
+func (c *PrefixDelegationConfig) subprefix(n uint64) (p netip.Prefix, ok bool) {
+	shift := c.DelegatedLength - c.Prefix.Bits()
+	if shift < 64 && n >= 1<<shift {
+		return netip.Prefix{}, false
+	}
+
+	b := c.Prefix.Addr().As16()
+	hi := binary.BigEndian.Uint64(b[:8])
+	binary.BigEndian.PutUint64(b[:8], hi+n<<(maxDelegatedLen-c.DelegatedLength))
+
+	return netip.PrefixFrom(netip.AddrFrom16(b), c.DelegatedLength), true
+}
+
+// delegate returns the prefix delegated to the IA_PD with the given key,
+// either existing or newly allocated, preferring the hinted one.  If commit is
+// true, the delegation is stored with the given expiry.  ok is false if there
+// are no available prefixes.  It expects the [DHCPServer.leasesMu] to be
+// locked.
+func (iface *dhcpInterfaceV6) delegate(
+	key delegationKey,
+	hints []netip.Prefix,
+	now time.Time,
+	expiry time.Time,
+	commit bool,
+) (p netip.Prefix, ok bool) {
+	if iface.pd == nil {
+		return netip.Prefix{}, false
+	}
+
+	if d, has := iface.delegations[key]; has {
+		p, ok = d.prefix, true
+	} else {
+		p, ok = iface.freePrefix(hints, now)
+	}
+
+	if ok && commit {
+		iface.delegations[key] = &delegation{
+			prefix: p,
+			expiry: expiry,
+		}
+	}
+
+	return p, ok
+}
+
+// freePrefix returns a prefix not delegated to any other router, preferring
+// the first acceptable one from hints.  It expects the [DHCPServer.leasesMu]
+// to be locked.
+func (iface *dhcpInterfaceV6) freePrefix(hints []netip.Prefix, now time.Time) (p netip.Prefix, ok bool) {
+	used := make(map[netip.Prefix]struct{}, len(iface.delegations))
+	for k, d := range iface.delegations {
+		if now.After(d.expiry) {
+			delete(iface.delegations, k)
+
+			continue
+		}
+
+		used[d.prefix] = struct{}{}
+	}
+
+	for _, h := range hints {
+		h = h.Masked()
+		_, isUsed := used[h]
+		if !isUsed && h.Bits() == iface.pd.DelegatedLength && iface.pd.Prefix.Contains(h.Addr()) {
+			return h, true
+		}
+	}
+
+	// There is at least one free prefix among the first len(used)+1 ones.
+	for n := range uint64(len(used) + 1) {
+		p, ok = iface.pd.subprefix(n)
+		if !ok {
+			return netip.Prefix{}, false
+		}
+
+		if _, isUsed := used[p]; !isUsed {
+			return p, true
+		}
+	}
+
+	return netip.Prefix{}, false
+}
@@ -5,6 +5,9 @@ import (
 	"net/netip"
 	"slices"
 	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
+	"github.com/google/gopacket/layers"
 )
 
 // Lease is a DHCP lease.
@@ -26,6 +29,14 @@ type Lease struct {
 	// HWAddr is the physical hardware address (MAC address).
 	HWAddr net.HardwareAddr
 
+	// Fingerprint are the device-specific values of the latest DHCP message
+	// received from the client, if any.  It isn't stored in the database.
+	Fingerprint *fingerprint.Params
+
+	// Options are the DHCP options overriding the ones of the interface and
+	// option classes for the client.  It's only used for IPv4 leases.
+	Options layers.DHCPOptions
+
 	// IsStatic defines if the lease is static.
 	IsStatic bool
 }
@@ -37,10 +48,26 @@ func (l *Lease) Clone() (clone *Lease) {
 	}
 
 	return &Lease{
-		Expiry:   l.Expiry,
-		Hostname: l.Hostname,
-		HWAddr:   slices.Clone(l.HWAddr),
-		IP:       l.IP,
-		IsStatic: l.IsStatic,
+		Expiry:      l.Expiry,
+		Hostname:    l.Hostname,
+		HWAddr:      slices.Clone(l.HWAddr),
+		Fingerprint: l.Fingerprint.Clone(),
+		Options:     cloneOptions(l.Options),
+		IP:          l.IP,
+		IsStatic:    l.IsStatic,
+	}
+}
+
+// cloneOptions returns a deep copy of opts.
+func cloneOptions(opts layers.DHCPOptions) (clone layers.DHCPOptions) {
+	if opts == nil {
+		return nil
 	}
+
+	clone = make(layers.DHCPOptions, 0, len(opts))
+	for _, o := range opts {
+		clone = append(clone, layers.NewDHCPOption(o.Type, slices.Clone(o.Data)))
+	}
+
+	return clone
 }
@@ -1,10 +1,13 @@
 package dhcpsvc
 
 import (
+	"bytes"
 	"fmt"
+	"net"
 	"net/netip"
 	"slices"
 	"strings"
+	"time"
 )
 
 // leaseIndex is the set of leases indexed by their identifiers for quick
@@ -139,3 +142,11 @@ func (idx *leaseIndex) rangeLeases(f func(l *Lease) (cont bool)) {
 func (idx *leaseIndex) len() (l uint) {
 	return uint(len(idx.byAddr))
 }
+
+// isFree returns true if ip can be leased to the client with the given
+// hardware address at now.
+func (idx *leaseIndex) isFree(ip netip.Addr, mac net.HardwareAddr, now time.Time) (ok bool) {
+	l, has := idx.byAddr[ip]
+
+	return !has || bytes.Equal(l.HWAddr, mac) || (!l.IsStatic && now.After(l.Expiry))
+}
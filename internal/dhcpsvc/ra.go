@@ -0,0 +1,268 @@
+package dhcpsvc
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// raInterval is the interval between the router advertisements.
+	raInterval = 1 * time.Second
+
+	// raRouterLifetime is the lifetime of the default router advertised.
+	raRouterLifetime = 1800
+
+	// raPrefixLifetime is both the valid and preferred lifetime of the
+	// advertised prefix and the lifetime of the advertised DNS server, in
+	// seconds.
+	raPrefixLifetime = 3600
+
+	// raHopLimit is the hop limit for the router advertisements, which must be
+	// 255 to be accepted by hosts.
+	//
+	// See https://datatracker.ietf.org/doc/html/rfc4861#section-6.1.2.
+	raHopLimit = 255
+
+	// raPrefixLen is the length of the advertised prefix suitable for SLAAC.
+	raPrefixLen = 64
+)
+
+// Router advertisement flags.
+//
+// See https://datatracker.ietf.org/doc/html/rfc4861#section-4.2.
+const (
+	raFlagManaged uint8 = 0x80
+	raFlagOther   uint8 = 0x40
+)
+
+// Prefix information option flags.
+//
+// See https://datatracker.ietf.org/doc/html/rfc4861#section-4.6.2.
+const (
+	raPrefixFlagOnLink     uint8 = 0x80
+	raPrefixFlagAutonomous uint8 = 0x40
+)
+
+// icmpv6OptRDNSS is the Recursive DNS Server option of the router
+// advertisement.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8106#section-5.1.
+const icmpv6OptRDNSS layers.ICMPv6Opt = 25
+
+// advertises returns true if iface should send router advertisements.
+func (iface *dhcpInterfaceV6) advertises() (ok bool) {
+	return iface.raSLAACOnly || iface.raAllowSLAAC
+}
+
+// routerAdvertisement returns the ICMPv6 Router Advertisement message for
+// iface.  hwAddr is the hardware address of the network interface, mtu is its
+// MTU, and dns is the address of the DNS server to advertise, if valid.  The
+// checksum is left for the kernel to calculate.
+func (iface *dhcpInterfaceV6) routerAdvertisement(
+	hwAddr net.HardwareAddr,
+	mtu uint32,
+	dns netip.Addr,
+) (data []byte, err error) {
+	err = netutil.ValidateMAC(hwAddr)
+	if err != nil {
+		return nil, fmt.Errorf("source link-layer address: %w", err)
+	}
+
+	var flags uint8
+	if !iface.raSLAACOnly {
+		flags = raFlagManaged | raFlagOther
+	}
+
+	prefix := netip.PrefixFrom(iface.rangeStart, raPrefixLen).Masked()
+
+	prefixInfo := []byte{byte(raPrefixLen), raPrefixFlagOnLink | raPrefixFlagAutonomous}
+	prefixInfo = binary.BigEndian.AppendUint32(prefixInfo, raPrefixLifetime)
+	prefixInfo = binary.BigEndian.AppendUint32(prefixInfo, raPrefixLifetime)
+	prefixInfo = binary.BigEndian.AppendUint32(prefixInfo, 0)
+	prefixInfo = append(prefixInfo, prefix.Addr().AsSlice()...)
+
+	mtuData := binary.BigEndian.AppendUint16(nil, 0)
+	mtuData = binary.BigEndian.AppendUint32(mtuData, mtu)
+
+	opts := layers.ICMPv6Options{{
+		Type: layers.ICMPv6OptPrefixInfo,
+		Data: prefixInfo,
+	}, {
+		Type: layers.ICMPv6OptMTU,
+		Data: mtuData,
+	}, {
+		Type: layers.ICMPv6OptSourceAddress,
+		Data: padOption(hwAddr),
+	}}
+
+	if dns.Is6() {
+		rdnss := binary.BigEndian.AppendUint16(nil, 0)
+		rdnss = binary.BigEndian.AppendUint32(rdnss, raPrefixLifetime)
+		rdnss = append(rdnss, dns.AsSlice()...)
+
+		opts = append(opts, layers.ICMPv6Option{Type: icmpv6OptRDNSS, Data: rdnss})
+	}
+
+	// The options are prepended on serialization, so reverse them to keep the
+	// order.
+	for i, j := 0, len(opts)-1; i < j; i, j = i+1, j-1 {
+		opts[i], opts[j] = opts[j], opts[i]
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(
+		buf,
+		gopacket.SerializeOptions{},
+		&layers.ICMPv6{
+			TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeRouterAdvertisement, 0),
+		},
+		&layers.ICMPv6RouterAdvertisement{
+			HopLimit:       64,
+			Flags:          flags,
+			RouterLifetime: raRouterLifetime,
+			Options:        opts,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("serializing: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// padOption returns data padded with zeroes so that the option containing it
+// with the 2-byte header is aligned to 8 bytes.
+func padOption(data []byte) (padded []byte) {
+	l := (len(data) + 2 + 7) / 8 * 8
+
+	padded = make([]byte, l-2)
+	copy(padded, data)
+
+	return padded
+}
+
+// startRA starts sending the router advertisements on the network interface
+// of iface.  The returned connection should be closed to stop sending.
+func (iface *dhcpInterfaceV6) startRA(ctx context.Context) (conn *icmp.PacketConn, err error) {
+	defer func() { err = errors.Annotate(err, "starting router advertisements: %w") }()
+
+	netIface, err := net.InterfaceByName(iface.common.name)
+	if err != nil {
+		// Don't wrap the error since there is already an annotation deferred.
+		return nil, err
+	}
+
+	src, dns, err := raAddrs(netIface)
+	if err != nil {
+		// Don't wrap the error since there is already an annotation deferred.
+		return nil, err
+	}
+
+	data, err := iface.routerAdvertisement(netIface.HardwareAddr, uint32(netIface.MTU), dns)
+	if err != nil {
+		// Don't wrap the error since there is already an annotation deferred.
+		return nil, err
+	}
+
+	conn, err = icmp.ListenPacket("ip6:ipv6-icmp", src.WithZone(iface.common.name).String())
+	if err != nil {
+		return nil, fmt.Errorf("listening: %w", err)
+	}
+
+	conn6 := conn.IPv6PacketConn()
+	err = errors.Join(conn6.SetHopLimit(raHopLimit), conn6.SetMulticastHopLimit(raHopLimit))
+	if err != nil {
+		return nil, errors.WithDeferred(fmt.Errorf("setting hop limit: %w", err), conn.Close())
+	}
+
+	cm := &ipv6.ControlMessage{
+		HopLimit: raHopLimit,
+		Src:      src.AsSlice(),
+		IfIndex:  netIface.Index,
+	}
+
+	go iface.sendRA(ctx, conn6, data, cm)
+
+	return conn, nil
+}
+
+// raAddrs returns the link-local address of netIface to send the router
+// advertisements from and the address of DNS server to advertise.
+func raAddrs(netIface *net.Interface) (src, dns netip.Addr, err error) {
+	addrs, err := netIface.Addrs()
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("getting addresses: %w", err)
+	}
+
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok || !ip.Is6() || ip.Is4In6() {
+			continue
+		}
+
+		if ip.IsLinkLocalUnicast() {
+			if !src.IsValid() {
+				src = ip
+			}
+		} else if !dns.IsValid() {
+			dns = ip
+		}
+	}
+
+	if !src.IsValid() {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("link-local address: %w", errors.ErrNoValue)
+	} else if !dns.IsValid() {
+		dns = src
+	}
+
+	return src, dns, nil
+}
+
+// sendRA periodically sends data to all nodes until conn is closed.  It's
+// intended to be used as a goroutine.
+func (iface *dhcpInterfaceV6) sendRA(
+	ctx context.Context,
+	conn *ipv6.PacketConn,
+	data []byte,
+	cm *ipv6.ControlMessage,
+) {
+	defer slogutil.RecoverAndLog(ctx, iface.common.logger)
+
+	l := iface.common.logger
+	dst := &net.IPAddr{IP: net.IPv6linklocalallnodes}
+
+	l.DebugContext(ctx, "sending router advertisements")
+
+	ticker := time.NewTicker(raInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := conn.WriteTo(data, cm, dst)
+		if errors.Is(err, net.ErrClosed) {
+			l.DebugContext(ctx, "stopped sending router advertisements")
+
+			return
+		} else if err != nil {
+			l.ErrorContext(ctx, "sending router advertisement", slogutil.KeyError, err)
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,451 @@
+package dhcpsvc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/validate"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// dhcpOptRelayAgentInfo is the code of the Relay Agent Information option.
+	//
+	// See https://datatracker.ietf.org/doc/html/rfc3046#section-2.0.
+	dhcpOptRelayAgentInfo layers.DHCPOpt = 82
+
+	// relaySubOptCircuitID is the code of the Agent Circuit ID sub-option of
+	// the Relay Agent Information option.
+	relaySubOptCircuitID byte = 1
+
+	// relaySubOptRemoteID is the code of the Agent Remote ID sub-option of the
+	// Relay Agent Information option.
+	relaySubOptRemoteID byte = 2
+)
+
+// flagBroadcast4 is the BROADCAST bit of the flags field of the DHCPv4
+// message.
+//
+// See https://datatracker.ietf.org/doc/html/rfc2131#section-2.
+const flagBroadcast4 uint16 = 1 << 15
+
+// ServerPortV4 is the UDP port DHCPv4 servers and relay agents listen on.
+const ServerPortV4 uint16 = 67
+
+// keyRelayPool is the key for logging the name of the relay pool.
+const keyRelayPool = "relay_pool"
+
+// RelayPoolConfig is the configuration of an address pool for the clients
+// behind a DHCP relay agent.  The relayed request is matched to the pool if the
+// gateway address set by the relay agent is within the subnet of the pool and
+// the Relay Agent Information option of the request matches the configured
+// identifiers, if any.
+type RelayPoolConfig struct {
+	// IPv4 is the configuration of the pool.  The relay agent is expected to
+	// set the gateway address of the relayed requests to an address within
+	// the configured subnet, usually to GatewayIP.  It must not be nil.
+	IPv4 *IPv4Config
+
+	// AllowedRelays are the source addresses of the relay agents allowed to
+	// relay requests to the pool.  If empty, the relayed requests are only
+	// accepted when sent from the gateway address set in them.
+	AllowedRelays []netip.Addr
+
+	// CircuitID is the expected Agent Circuit ID sub-option of the Relay Agent
+	// Information option.  If empty, the circuit ID isn't checked.
+	CircuitID string
+
+	// RemoteID is the expected Agent Remote ID sub-option of the Relay Agent
+	// Information option.  If empty, the remote ID isn't checked.
+	RemoteID string
+}
+
+// type check
+var _ validate.Interface = (*RelayPoolConfig)(nil)
+
+// Validate implements the [validate.Interface] interface for *RelayPoolConfig.
+func (c *RelayPoolConfig) Validate() (err error) {
+	if c == nil {
+		return errors.ErrNoValue
+	}
+
+	errs := []error{errors.Annotate(c.IPv4.Validate(), "ipv4: %w")}
+	for i, addr := range c.AllowedRelays {
+		if !addr.Is4() {
+			err = newMustErr(fmt.Sprintf("allowed relay at index %d", i), "be a valid ipv4", addr)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// relayPoolV4 is an address pool for the DHCPv4 clients behind a relay agent.
+type relayPoolV4 struct {
+	// iface handles the requests relayed to the pool.
+	iface *dhcpInterfaceV4
+
+	// circuitID is the expected Agent Circuit ID, if any.
+	circuitID []byte
+
+	// remoteID is the expected Agent Remote ID, if any.
+	remoteID []byte
+
+	// allowedRelays are the source addresses of the relay agents allowed to
+	// relay requests to the pool, if any.
+	allowedRelays []netip.Addr
+}
+
+// relayPoolsV4 is a slice of relay pools sorted by name.
+type relayPoolsV4 []*relayPoolV4
+
+// newRelayPools creates the relay pools for the given map of pool names to
+// their configurations.  pools must be valid, baseLogger must not be nil.
+func newRelayPools(
+	ctx context.Context,
+	baseLogger *slog.Logger,
+	pools map[string]*RelayPoolConfig,
+) (v4 relayPoolsV4) {
+	v4 = make(relayPoolsV4, 0, len(pools))
+
+	for _, name := range slices.Sorted(maps.Keys(pools)) {
+		conf := pools[name]
+		l := baseLogger.With(keyRelayPool, name, keyFamily, netutil.AddrFamilyIPv4)
+
+		iface := newDHCPInterfaceV4(ctx, l, name, conf.IPv4)
+		if iface == nil {
+			continue
+		}
+
+		v4 = append(v4, &relayPoolV4{
+			iface:     iface,
+			circuitID: []byte(conf.CircuitID),
+			remoteID:  []byte(conf.RemoteID),
+
+			allowedRelays: slices.Clone(conf.AllowedRelays),
+		})
+	}
+
+	return v4
+}
+
+// match returns the number of matched relay agent identifiers and true if the
+// request relayed through giaddr with the agent information info and received
+// from src belongs to p.
+func (p *relayPoolV4) match(
+	src netip.Addr,
+	giaddr netip.Addr,
+	info *relayAgentInfo,
+) (score int, ok bool) {
+	if !p.iface.subnet.Contains(giaddr) || !p.allows(src, giaddr) {
+		return 0, false
+	}
+
+	for _, id := range []struct {
+		want []byte
+		got  []byte
+	}{{
+		want: p.circuitID,
+		got:  info.circuitID,
+	}, {
+		want: p.remoteID,
+		got:  info.remoteID,
+	}} {
+		if len(id.want) == 0 {
+			continue
+		} else if !bytes.Equal(id.want, id.got) {
+			return 0, false
+		}
+
+		score++
+	}
+
+	return score, true
+}
+
+// allows returns true if the request relayed through giaddr may be received
+// from src.  src must be one of the allowed relays, if configured, or giaddr
+// itself otherwise.
+func (p *relayPoolV4) allows(src, giaddr netip.Addr) (ok bool) {
+	if len(p.allowedRelays) == 0 {
+		return src == giaddr
+	}
+
+	return slices.Contains(p.allowedRelays, src)
+}
+
+// find returns the pool for the request relayed through giaddr with the agent
+// information info and received from src.  The pools matching more relay agent identifiers are
+// preferred, the first pool wins between the equally matching ones.  It
+// returns false if there is no such pool.
+func (pools relayPoolsV4) find(
+	src netip.Addr,
+	giaddr netip.Addr,
+	info *relayAgentInfo,
+) (iface *dhcpInterfaceV4, ok bool) {
+	best := -1
+	for _, p := range pools {
+		score, matched := p.match(src, giaddr, info)
+		if matched && score > best {
+			iface, best = p.iface, score
+		}
+	}
+
+	return iface, iface != nil
+}
+
+// findByAddr returns the common part of the first pool containing ip.  It
+// returns false if there is no such pool.
+func (pools relayPoolsV4) findByAddr(ip netip.Addr) (iface *netInterface, ok bool) {
+	i := slices.IndexFunc(pools, func(p *relayPoolV4) (contains bool) {
+		return p.iface.subnet.Contains(ip)
+	})
+	if i < 0 {
+		return nil, false
+	}
+
+	return pools[i].iface.common, true
+}
+
+// relayAgentInfo is the parsed Relay Agent Information option.
+type relayAgentInfo struct {
+	// opt is the original option to echo back to the relay agent.  It has a
+	// zero type if the request has no such option.
+	opt layers.DHCPOption
+
+	// circuitID is the Agent Circuit ID sub-option, if any.
+	circuitID []byte
+
+	// remoteID is the Agent Remote ID sub-option, if any.
+	remoteID []byte
+}
+
+// relayAgentInfo4 returns the parsed Relay Agent Information option of msg.
+// info is never nil, the malformed sub-options are ignored.
+func relayAgentInfo4(msg *layers.DHCPv4) (info *relayAgentInfo) {
+	info = &relayAgentInfo{}
+
+	i := slices.IndexFunc(msg.Options, func(o layers.DHCPOption) (ok bool) {
+		return o.Type == dhcpOptRelayAgentInfo
+	})
+	if i < 0 {
+		return info
+	}
+
+	info.opt = msg.Options[i]
+	for data := info.opt.Data; len(data) >= 2; {
+		code, l := data[0], int(data[1])
+		if len(data) < 2+l {
+			break
+		}
+
+		switch code {
+		case relaySubOptCircuitID:
+			info.circuitID = data[2 : 2+l]
+		case relaySubOptRemoteID:
+			info.remoteID = data[2 : 2+l]
+		default:
+			// Go on.
+		}
+
+		data = data[2+l:]
+	}
+
+	return info
+}
+
+// relayAddr4 returns the gateway address set by the relay agent into msg.  It
+// returns false if the message hasn't been relayed.
+func relayAddr4(msg *layers.DHCPv4) (giaddr netip.Addr, ok bool) {
+	giaddr, ok = netip.AddrFromSlice(msg.RelayAgentIP.To4())
+
+	return giaddr, ok && !giaddr.IsUnspecified()
+}
+
+// relayWriter4 is a [responseWriter4] that unicasts the responses back to the
+// relay agent.
+type relayWriter4 struct {
+	// conn is the connection to send the responses through.
+	conn net.PacketConn
+
+	// info is the Relay Agent Information of the request.
+	info *relayAgentInfo
+
+	// giaddr is the address of the relay agent.
+	giaddr netip.Addr
+
+	// port is the UDP port of the relay agent, usually [ServerPortV4].
+	port uint16
+}
+
+// type check
+var _ responseWriter4 = (*relayWriter4)(nil)
+
+// write implements the [responseWriter4] interface for *relayWriter4.  It sets
+// the gateway address and echoes the Relay Agent Information option as
+// required by RFC 3046.
+func (w *relayWriter4) write(ctx context.Context, pkt *layers.DHCPv4) (err error) {
+	pkt.RelayAgentIP = w.giaddr.AsSlice()
+	if w.info.opt.Type == dhcpOptRelayAgentInfo {
+		pkt.Options = slices.DeleteFunc(pkt.Options, func(o layers.DHCPOption) (ok bool) {
+			return o.Type == dhcpOptRelayAgentInfo || o.Type == layers.DHCPOptEnd
+		})
+
+		// The Relay Agent Information option should be the last one in the
+		// message.
+		//
+		// See https://datatracker.ietf.org/doc/html/rfc3046#section-2.1.
+		pkt.Options = append(pkt.Options, w.info.opt)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, pkt)
+	if err != nil {
+		return fmt.Errorf("serializing: %w", err)
+	}
+
+	addr := net.UDPAddrFromAddrPort(netip.AddrPortFrom(w.giaddr, w.port))
+	_, err = w.conn.WriteTo(buf.Bytes(), addr)
+	if err != nil {
+		return fmt.Errorf("writing to relay %s: %w", w.giaddr, err)
+	}
+
+	return nil
+}
+
+// handleRelayed handles the DHCPv4 message of the given type relayed through
+// giaddr and received from src.  The message is handled by the matching relay
+// pool only and the responses are unicast back to the relay agent through
+// conn.
+func (srv *DHCPServer) handleRelayed(
+	ctx context.Context,
+	conn net.PacketConn,
+	typ layers.DHCPMsgType,
+	req *layers.DHCPv4,
+	src netip.Addr,
+	giaddr netip.Addr,
+) (err error) {
+	if !srv.ha.serving(time.Now()) {
+		srv.logger.DebugContext(ctx, "standby, skipping relayed message", "type", typ)
+
+		return nil
+	}
+
+	info := relayAgentInfo4(req)
+	iface, ok := srv.relays4.find(src, giaddr, info)
+	if !ok {
+		srv.logger.DebugContext(
+			ctx,
+			"skipping relayed request",
+			"src", src,
+			"giaddr", giaddr,
+			"circuit_id", info.circuitID,
+			"remote_id", info.remoteID,
+		)
+
+		return nil
+	}
+
+	rw := &relayWriter4{
+		conn:   conn,
+		info:   info,
+		giaddr: giaddr,
+		port:   ServerPortV4,
+	}
+
+	switch typ {
+	case layers.DHCPMsgTypeDiscover:
+		return srv.offer4(ctx, rw, iface, req)
+	case layers.DHCPMsgTypeRequest:
+		srvID, hasSrvID := serverID4(req)
+		reqIP, hasReqIP := requestedIPv4(req)
+
+		switch {
+		case hasSrvID && !srvID.IsUnspecified():
+			return srv.handleSelecting(ctx, rw, iface, req, srvID, reqIP)
+		case hasReqIP && !reqIP.IsUnspecified():
+			return srv.handleInitReboot(ctx, rw, iface, req, reqIP)
+		default:
+			return srv.handleRenew(ctx, rw, iface, req)
+		}
+	case layers.DHCPMsgTypeRelease, layers.DHCPMsgTypeDecline:
+		return srv.handleRelease(ctx, typ, req)
+	default:
+		return fmt.Errorf("dhcpv4: relayed request type: %w: %v", errors.ErrBadEnumValue, typ)
+	}
+}
+
+// serveRelayed reads the relayed DHCPv4 messages from conn and handles them
+// until conn is closed.  It's used to run in a separate goroutine.
+func (srv *DHCPServer) serveRelayed(ctx context.Context, conn net.PacketConn) {
+	defer slogutil.RecoverAndLog(ctx, srv.logger)
+
+	// The maximum size of a DHCPv4 message fits a single non-fragmented UDP
+	// datagram over Ethernet.
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				srv.logger.ErrorContext(ctx, "reading relayed", slogutil.KeyError, err)
+			}
+
+			return
+		}
+
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			srv.logger.DebugContext(ctx, "skipping relayed packet", "addr", addr)
+
+			continue
+		}
+
+		src := udpAddr.AddrPort().Addr().Unmap()
+		pkt := gopacket.NewPacket(buf[:n], layers.LayerTypeDHCPv4, gopacket.Default)
+		err = srv.serveRelayedPacket(ctx, conn, pkt, src)
+		if err != nil {
+			srv.logger.ErrorContext(ctx, "serving relayed", slogutil.KeyError, err)
+		}
+	}
+}
+
+// serveRelayedPacket handles a single packet received from a relay agent with
+// the address src.
+func (srv *DHCPServer) serveRelayedPacket(
+	ctx context.Context,
+	conn net.PacketConn,
+	pkt gopacket.Packet,
+	src netip.Addr,
+) (err error) {
+	req, ok := pkt.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+	if !ok || req.Operation != layers.DHCPOpRequest {
+		srv.logger.DebugContext(ctx, "skipping non-request relayed packet")
+
+		return nil
+	}
+
+	giaddr, ok := relayAddr4(req)
+	if !ok {
+		srv.logger.DebugContext(ctx, "skipping unicast packet without giaddr")
+
+		return nil
+	}
+
+	typ, ok := msg4Type(req)
+	if !ok {
+		return fmt.Errorf("dhcpv4: message type: %w", errors.ErrNoValue)
+	}
+
+	return srv.handleRelayed(ctx, conn, typ, req, src, giaddr)
+}
@@ -0,0 +1,348 @@
+package dhcpsvc
+
+import (
+	"net"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRelayTimeout is a common timeout for relay tests.
+const testRelayTimeout = 1 * time.Second
+
+// newTestRelayConf returns a valid relay pool configuration for the subnet of
+// gateway with the given identifiers.
+func newTestRelayConf(gateway, circuitID, remoteID string) (conf *RelayPoolConfig) {
+	gw := netip.MustParseAddr(gateway)
+	start, end := gw.Next(), gw.Next().Next()
+
+	return &RelayPoolConfig{
+		IPv4: &IPv4Config{
+			Enabled:       true,
+			GatewayIP:     gw,
+			SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+			RangeStart:    start,
+			RangeEnd:      end,
+			LeaseDuration: time.Hour,
+		},
+		CircuitID: circuitID,
+		RemoteID:  remoteID,
+	}
+}
+
+// newRelayAgentInfoOpt returns a Relay Agent Information option with the given
+// identifiers.
+func newRelayAgentInfoOpt(circuitID, remoteID string) (opt layers.DHCPOption) {
+	var data []byte
+	if circuitID != "" {
+		data = append(data, relaySubOptCircuitID, byte(len(circuitID)))
+		data = append(data, circuitID...)
+	}
+
+	if remoteID != "" {
+		data = append(data, relaySubOptRemoteID, byte(len(remoteID)))
+		data = append(data, remoteID...)
+	}
+
+	return layers.NewDHCPOption(dhcpOptRelayAgentInfo, data)
+}
+
+func TestRelayPoolsV4_Find(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testRelayTimeout)
+
+	allowedConf := newTestRelayConf("10.0.30.1", "", "")
+	allowedConf.AllowedRelays = []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+
+	pools := newRelayPools(ctx, slogutil.NewDiscardLogger(), map[string]*RelayPoolConfig{
+		"a_any":     newTestRelayConf("10.0.10.1", "", ""),
+		"b_circuit": newTestRelayConf("10.0.10.1", "port1", ""),
+		"c_both":    newTestRelayConf("10.0.10.1", "port2", "switch1"),
+		"d_other":   newTestRelayConf("10.0.20.1", "", ""),
+		"e_allowed": allowedConf,
+	})
+	require.Len(t, pools, 5)
+
+	testCases := []struct {
+		src       netip.Addr
+		giaddr    netip.Addr
+		name      string
+		opt       layers.DHCPOption
+		wantIface string
+		wantOK    bool
+	}{{
+		name:      "no_info",
+		giaddr:    netip.MustParseAddr("10.0.10.1"),
+		opt:       layers.DHCPOption{},
+		wantIface: "a_any",
+		wantOK:    true,
+	}, {
+		name:      "circuit",
+		giaddr:    netip.MustParseAddr("10.0.10.1"),
+		opt:       newRelayAgentInfoOpt("port1", "switch1"),
+		wantIface: "b_circuit",
+		wantOK:    true,
+	}, {
+		name:      "both",
+		giaddr:    netip.MustParseAddr("10.0.10.1"),
+		opt:       newRelayAgentInfoOpt("port2", "switch1"),
+		wantIface: "c_both",
+		wantOK:    true,
+	}, {
+		name:      "remote_mismatch",
+		giaddr:    netip.MustParseAddr("10.0.10.1"),
+		opt:       newRelayAgentInfoOpt("port2", "switch2"),
+		wantIface: "a_any",
+		wantOK:    true,
+	}, {
+		name:      "other_subnet",
+		giaddr:    netip.MustParseAddr("10.0.20.254"),
+		opt:       newRelayAgentInfoOpt("port1", ""),
+		wantIface: "d_other",
+		wantOK:    true,
+	}, {
+		name:      "unknown_subnet",
+		giaddr:    netip.MustParseAddr("10.0.40.1"),
+		opt:       layers.DHCPOption{},
+		wantIface: "",
+		wantOK:    false,
+	}, {
+		src:       netip.MustParseAddr("10.0.10.2"),
+		name:      "src_not_giaddr",
+		giaddr:    netip.MustParseAddr("10.0.10.1"),
+		opt:       layers.DHCPOption{},
+		wantIface: "",
+		wantOK:    false,
+	}, {
+		src:       netip.MustParseAddr("192.168.1.1"),
+		name:      "src_allowed",
+		giaddr:    netip.MustParseAddr("10.0.30.1"),
+		opt:       layers.DHCPOption{},
+		wantIface: "e_allowed",
+		wantOK:    true,
+	}, {
+		name:      "src_not_allowed",
+		giaddr:    netip.MustParseAddr("10.0.30.1"),
+		opt:       layers.DHCPOption{},
+		wantIface: "",
+		wantOK:    false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &layers.DHCPv4{}
+			if tc.opt.Type != 0 {
+				msg.Options = layers.DHCPOptions{tc.opt}
+			}
+
+			src := tc.src
+			if !src.IsValid() {
+				src = tc.giaddr
+			}
+
+			iface, ok := pools.find(src, tc.giaddr, relayAgentInfo4(msg))
+			require.Equal(t, tc.wantOK, ok)
+
+			if tc.wantOK {
+				assert.Equal(t, tc.wantIface, iface.common.name)
+			}
+		})
+	}
+}
+
+func TestRelayWriter4_Write(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t, testRelayTimeout)
+
+	relay, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, relay.Close)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+	relayAddr := relay.LocalAddr().(*net.UDPAddr).AddrPort()
+	infoOpt := newRelayAgentInfoOpt("port1", "switch1")
+
+	w := &relayWriter4{
+		conn: conn,
+		info: relayAgentInfo4(&layers.DHCPv4{
+			Options: layers.DHCPOptions{infoOpt},
+		}),
+		giaddr: relayAddr.Addr(),
+		port:   relayAddr.Port(),
+	}
+
+	err = w.write(ctx, &layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: layers.LinkTypeEthernet,
+		Xid:          1,
+		ClientHWAddr: net.HardwareAddr{0x1, 0x2, 0x3, 0x4, 0x5, 0x6},
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeOffer)}),
+			layers.NewDHCPOption(layers.DHCPOptEnd, nil),
+		},
+	})
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	require.NoError(t, relay.SetReadDeadline(time.Now().Add(testRelayTimeout)))
+
+	n, _, err := relay.ReadFrom(buf)
+	require.NoError(t, err)
+
+	pkt := gopacket.NewPacket(buf[:n], layers.LayerTypeDHCPv4, gopacket.Default)
+	resp, ok := pkt.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+	require.True(t, ok)
+
+	assert.Equal(t, relayAddr.Addr().AsSlice(), []byte(resp.RelayAgentIP.To4()))
+
+	got := relayAgentInfo4(resp)
+	assert.Equal(t, []byte("port1"), got.circuitID)
+	assert.Equal(t, []byte("switch1"), got.remoteID)
+}
+
+// testPacketConn is a [net.PacketConn] collecting the written packets.
+type testPacketConn struct {
+	// PacketConn is embedded to implement the rest of the interface.  It's
+	// nil, so calling its methods panics.
+	net.PacketConn
+
+	// addrs are the destinations of the written packets.
+	addrs []net.Addr
+
+	// pkts are the written packets.
+	pkts [][]byte
+}
+
+// WriteTo implements the [net.PacketConn] interface for *testPacketConn.
+func (c *testPacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	c.addrs = append(c.addrs, addr)
+	c.pkts = append(c.pkts, append([]byte(nil), b...))
+
+	return len(b), nil
+}
+
+func TestDHCPServer_handleRelayed(t *testing.T) {
+	const (
+		circuitID = "port1"
+		remoteID  = "switch1"
+	)
+
+	ctx := testutil.ContextWithTimeout(t, testRelayTimeout)
+	srv, err := New(ctx, &Config{
+		Enabled:         true,
+		Logger:          slogutil.NewDiscardLogger(),
+		LocalDomainName: "local",
+		DBFilePath:      filepath.Join(t.TempDir(), "leases.json"),
+		Interfaces:      map[string]*InterfaceConfig{},
+		RelayPools: map[string]*RelayPoolConfig{
+			"office": newTestRelayConf("10.0.10.1", circuitID, ""),
+		},
+	})
+	require.NoError(t, err)
+
+	giaddr := netip.MustParseAddr("10.0.10.1")
+	wantIP := giaddr.Next()
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	infoOpt := newRelayAgentInfoOpt(circuitID, remoteID)
+
+	// relay sends a message of the given type through the relay agent and
+	// returns the decoded response, if any.
+	relay := func(
+		t *testing.T,
+		typ layers.DHCPMsgType,
+		opts ...layers.DHCPOption,
+	) (resp *layers.DHCPv4) {
+		t.Helper()
+
+		req := newTestRequest4(mac, typ, append(opts, infoOpt)...)
+		req.RelayAgentIP = giaddr.AsSlice()
+
+		conn := &testPacketConn{}
+		require.NoError(t, srv.handleRelayed(ctx, conn, typ, req, giaddr, giaddr))
+
+		if len(conn.pkts) == 0 {
+			return nil
+		}
+
+		require.Len(t, conn.pkts, 1)
+		assert.Equal(t, &net.UDPAddr{IP: giaddr.AsSlice(), Port: int(ServerPortV4)}, conn.addrs[0])
+
+		pkt := gopacket.NewPacket(conn.pkts[0], layers.LayerTypeDHCPv4, gopacket.Default)
+		resp, ok := pkt.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+		require.True(t, ok)
+
+		return resp
+	}
+
+	t.Run("discover", func(t *testing.T) {
+		resp := relay(t, layers.DHCPMsgTypeDiscover)
+		require.NotNil(t, resp)
+
+		typ, ok := msg4Type(resp)
+		require.True(t, ok)
+
+		assert.Equal(t, layers.DHCPMsgTypeOffer, typ)
+		assert.Equal(t, wantIP.AsSlice(), []byte(resp.YourClientIP.To4()))
+		assert.Equal(t, giaddr.AsSlice(), []byte(resp.RelayAgentIP.To4()))
+
+		// The Relay Agent Information option is echoed as the last one.
+		require.NotEmpty(t, resp.Options)
+
+		last := resp.Options[len(resp.Options)-1]
+		assert.Equal(t, infoOpt.Type, last.Type)
+		assert.Equal(t, infoOpt.Data, last.Data)
+	})
+
+	srvID := layers.NewDHCPOption(layers.DHCPOptServerID, giaddr.AsSlice())
+
+	t.Run("request", func(t *testing.T) {
+		reqIP := layers.NewDHCPOption(layers.DHCPOptRequestIP, wantIP.AsSlice())
+		resp := relay(t, layers.DHCPMsgTypeRequest, srvID, reqIP)
+		require.NotNil(t, resp)
+
+		typ, ok := msg4Type(resp)
+		require.True(t, ok)
+
+		assert.Equal(t, layers.DHCPMsgTypeAck, typ)
+		assert.Equal(t, mac, srv.MACByIP(wantIP))
+	})
+
+	t.Run("decline", func(t *testing.T) {
+		reqIP := layers.NewDHCPOption(layers.DHCPOptRequestIP, wantIP.AsSlice())
+		assert.Nil(t, relay(t, layers.DHCPMsgTypeDecline, srvID, reqIP))
+
+		assert.Empty(t, srv.Leases())
+	})
+
+	t.Run("foreign_source", func(t *testing.T) {
+		req := newTestRequest4(mac, layers.DHCPMsgTypeDiscover, infoOpt)
+		req.RelayAgentIP = giaddr.AsSlice()
+
+		conn := &testPacketConn{}
+		src := netip.MustParseAddr("192.168.1.1")
+		require.NoError(t, srv.handleRelayed(ctx, conn, layers.DHCPMsgTypeDiscover, req, src, giaddr))
+
+		assert.Empty(t, conn.pkts)
+	})
+
+	t.Run("request_nak", func(t *testing.T) {
+		foreignIP := layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte{10, 0, 10, 200})
+		resp := relay(t, layers.DHCPMsgTypeRequest, srvID, foreignIP)
+		require.NotNil(t, resp)
+
+		typ, ok := msg4Type(resp)
+		require.True(t, ok)
+
+		assert.Equal(t, layers.DHCPMsgTypeNak, typ)
+		assert.Equal(t, flagBroadcast4, resp.Flags&flagBroadcast4)
+	})
+}
@@ -0,0 +1,630 @@
+package dhcpsvc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// ReservationFormat is the format of the static leases configuration of other
+// DHCP servers.
+type ReservationFormat string
+
+// Valid reservation formats.
+const (
+	// ReservationFormatDnsmasq is the format of the dhcp-host options of
+	// dnsmasq, either in the configuration file or in the dhcp-hostsfile.
+	ReservationFormatDnsmasq ReservationFormat = "dnsmasq"
+
+	// ReservationFormatISC is the format of the host declarations of ISC DHCP
+	// server.
+	ReservationFormatISC ReservationFormat = "isc"
+
+	// ReservationFormatKea is the JSON format of the reservations of Kea DHCP
+	// server.
+	ReservationFormatKea ReservationFormat = "kea"
+)
+
+// Validate returns an error if f isn't a valid reservation format.
+func (f ReservationFormat) Validate() (err error) {
+	switch f {
+	case ReservationFormatDnsmasq, ReservationFormatISC, ReservationFormatKea:
+		return nil
+	default:
+		return fmt.Errorf("format: %w: %q", errors.ErrBadEnumValue, f)
+	}
+}
+
+// ParseReservations parses the static leases from r in the format f.  The
+// leases aren't validated against any interface configuration.  skipped
+// describes the well-formed reservations which can't be converted into static
+// leases, for example the Kea ones identified by DUID.
+func ParseReservations(
+	r io.Reader,
+	f ReservationFormat,
+) (leases []*Lease, skipped []error, err error) {
+	defer func() { err = errors.Annotate(err, "parsing %s reservations: %w", f) }()
+
+	switch f {
+	case ReservationFormatDnsmasq:
+		leases, err = parseDnsmasq(r)
+	case ReservationFormatISC:
+		leases, err = parseISC(r)
+	case ReservationFormatKea:
+		leases, skipped, err = parseKea(r)
+	default:
+		err = f.Validate()
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return leases, skipped, nil
+}
+
+// WriteReservations writes the static leases to w in the format f.
+func WriteReservations(w io.Writer, f ReservationFormat, leases []*Lease) (err error) {
+	defer func() { err = errors.Annotate(err, "writing %s reservations: %w", f) }()
+
+	switch f {
+	case ReservationFormatDnsmasq:
+		return writeDnsmasq(w, leases)
+	case ReservationFormatISC:
+		return writeISC(w, leases)
+	case ReservationFormatKea:
+		return writeKea(w, leases)
+	default:
+		return f.Validate()
+	}
+}
+
+// newReservation returns a new static lease with the given properties.  Both
+// mac and ip must not be empty.
+func newReservation(mac, ip, hostname string) (l *Lease, err error) {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, fmt.Errorf("hardware address: %w", err)
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	if err != nil {
+		return nil, fmt.Errorf("ip address: %w", err)
+	}
+
+	return &Lease{
+		IP:       addr.Unmap(),
+		Hostname: hostname,
+		HWAddr:   hwAddr,
+		IsStatic: true,
+	}, nil
+}
+
+// dnsmasqHostPrefix is the prefix of the dhcp-host option of dnsmasq.
+const dnsmasqHostPrefix = "dhcp-host="
+
+// dnsmasqLeaseTimeRe matches the lease time field of the dhcp-host option.
+var dnsmasqLeaseTimeRe = regexp.MustCompile(`^(\d+[smhdw]?|infinite)$`)
+
+// parseDnsmasq parses the dhcp-host options from r.  The lines without the
+// option name are considered to be the lines of dhcp-hostsfile, the other
+// options are skipped.
+func parseDnsmasq(r io.Reader) (leases []*Lease, err error) {
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if val, ok := strings.CutPrefix(line, dnsmasqHostPrefix); ok {
+			line = val
+		} else if strings.Contains(line, "=") {
+			continue
+		}
+
+		var l *Lease
+		l, err = parseDnsmasqHost(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		} else if l != nil {
+			leases = append(leases, l)
+		}
+	}
+
+	return leases, s.Err()
+}
+
+// parseDnsmasqHost parses the value of a single dhcp-host option.  l is nil if
+// the option doesn't describe a lease.
+func parseDnsmasqHost(val string) (l *Lease, err error) {
+	var mac, ip, hostname string
+	for _, f := range strings.Split(val, ",") {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "ignore":
+			return nil, nil
+		case
+			f == "",
+			strings.HasPrefix(f, "set:"),
+			strings.HasPrefix(f, "tag:"),
+			strings.HasPrefix(f, "id:"),
+			dnsmasqLeaseTimeRe.MatchString(f):
+			// Skip the fields not related to leases.
+		case isMAC(f):
+			if mac == "" {
+				mac = f
+			}
+		case isAddr(f):
+			if ip == "" {
+				ip = f
+			}
+		default:
+			hostname = f
+		}
+	}
+
+	switch {
+	case mac == "":
+		return nil, fmt.Errorf("hardware address: %w", errors.ErrNoValue)
+	case ip == "":
+		return nil, fmt.Errorf("ip address: %w", errors.ErrNoValue)
+	default:
+		return newReservation(mac, ip, hostname)
+	}
+}
+
+// isMAC returns true if s is a hardware address.
+func isMAC(s string) (ok bool) {
+	_, err := net.ParseMAC(s)
+
+	return err == nil
+}
+
+// isAddr returns true if s is an IP address, possibly enclosed in square
+// brackets.
+func isAddr(s string) (ok bool) {
+	_, err := netip.ParseAddr(strings.Trim(s, "[]"))
+
+	return err == nil
+}
+
+// writeDnsmasq writes leases as dhcp-host options.
+func writeDnsmasq(w io.Writer, leases []*Lease) (err error) {
+	b := &bytes.Buffer{}
+	for _, l := range leases {
+		ip := l.IP.String()
+		if l.IP.Is6() {
+			ip = "[" + ip + "]"
+		}
+
+		_, _ = fmt.Fprintf(b, "%s%s,%s", dnsmasqHostPrefix, l.HWAddr, ip)
+		if l.Hostname != "" {
+			_, _ = fmt.Fprintf(b, ",%s", l.Hostname)
+		}
+
+		_ = b.WriteByte('\n')
+	}
+
+	_, err = w.Write(b.Bytes())
+
+	return err
+}
+
+// iscToken is a single token of the ISC DHCP server configuration.
+type iscToken struct {
+	// val is the value of the token without quotes.
+	val string
+
+	// quoted is true if the token is a quoted string.
+	quoted bool
+}
+
+// isPunct returns true if t is the given unquoted punctuation character.
+func (t iscToken) isPunct(c string) (ok bool) {
+	return !t.quoted && t.val == c
+}
+
+// tokenizeISC splits the ISC DHCP server configuration into tokens.  Commas
+// and comments are skipped.
+func tokenizeISC(data []byte) (tokens []iscToken, err error) {
+	s := string(data)
+	for len(s) > 0 {
+		c := s[0]
+		switch {
+		case unicode.IsSpace(rune(c)), c == ',':
+			s = s[1:]
+		case c == '#':
+			_, s, _ = strings.Cut(s, "\n")
+		case c == '{', c == '}', c == ';':
+			tokens = append(tokens, iscToken{val: s[:1]})
+			s = s[1:]
+		case c == '"':
+			val, rest, ok := strings.Cut(s[1:], `"`)
+			if !ok {
+				return nil, errors.Error("unterminated quoted string")
+			}
+
+			tokens = append(tokens, iscToken{val: val, quoted: true})
+			s = rest
+		default:
+			end := strings.IndexFunc(s, func(r rune) (ok bool) {
+				return unicode.IsSpace(r) || strings.ContainsRune("{};,#\"", r)
+			})
+			if end < 0 {
+				end = len(s)
+			}
+
+			tokens = append(tokens, iscToken{val: s[:end]})
+			s = s[end:]
+		}
+	}
+
+	return tokens, nil
+}
+
+// parseISC parses the host declarations from r.  The hostname is taken from
+// the host-name option, since the declaration names are only used as
+// hostnames with the use-host-decl-names statement.
+func parseISC(r io.Reader) (leases []*Lease, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+
+	tokens, err := tokenizeISC(data)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	stmtStart := true
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if !stmtStart || t.quoted || t.val != "host" || i+2 >= len(tokens) || !tokens[i+2].isPunct("{") {
+			stmtStart = t.isPunct(";") || t.isPunct("{") || t.isPunct("}")
+
+			continue
+		}
+
+		name := tokens[i+1].val
+
+		var l *Lease
+		l, i, err = parseISCHost(tokens, i+3)
+		if err != nil {
+			return nil, fmt.Errorf("host %q: %w", name, err)
+		}
+
+		leases = append(leases, l)
+		stmtStart = true
+	}
+
+	return leases, nil
+}
+
+// parseISCHost parses the body of the host declaration starting at tokens[i].
+// next is the index of the closing brace of the declaration.
+func parseISCHost(tokens []iscToken, i int) (l *Lease, next int, err error) {
+	var mac, ip, hostname string
+	var stmt []string
+	for depth := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.isPunct("{"):
+			depth++
+		case t.isPunct("}") && depth > 0:
+			depth--
+		case t.isPunct("}"):
+			if mac == "" {
+				return nil, i, fmt.Errorf("hardware address: %w", errors.ErrNoValue)
+			} else if ip == "" {
+				return nil, i, fmt.Errorf("ip address: %w", errors.ErrNoValue)
+			}
+
+			l, err = newReservation(mac, ip, hostname)
+
+			return l, i, err
+		case t.isPunct(";"):
+			if depth == 0 {
+				mac, ip, hostname = applyISCStatement(stmt, mac, ip, hostname)
+			}
+
+			stmt = stmt[:0]
+		default:
+			stmt = append(stmt, t.val)
+		}
+	}
+
+	return nil, i, errors.Error("unterminated host declaration")
+}
+
+// applyISCStatement returns the lease properties updated with the statement
+// within the host declaration.
+func applyISCStatement(stmt []string, mac, ip, hostname string) (newMAC, newIP, newHost string) {
+	switch {
+	case len(stmt) == 3 && stmt[0] == "hardware" && stmt[1] == "ethernet":
+		mac = stmt[2]
+	case len(stmt) >= 2 && (stmt[0] == "fixed-address" || stmt[0] == "fixed-address6"):
+		if ip == "" {
+			ip = stmt[1]
+		}
+	case len(stmt) == 3 && stmt[0] == "option" && stmt[1] == "host-name":
+		hostname = stmt[2]
+	}
+
+	return mac, ip, hostname
+}
+
+// writeISC writes leases as host declarations.
+func writeISC(w io.Writer, leases []*Lease) (err error) {
+	b := &bytes.Buffer{}
+	for _, l := range leases {
+		addrStmt := "fixed-address"
+		if l.IP.Is6() {
+			addrStmt = "fixed-address6"
+		}
+
+		name := "lease-" + strings.ReplaceAll(l.HWAddr.String(), ":", "")
+		_, _ = fmt.Fprintf(b, "host %s {\n", name)
+		_, _ = fmt.Fprintf(b, "\thardware ethernet %s;\n", l.HWAddr)
+		_, _ = fmt.Fprintf(b, "\t%s %s;\n", addrStmt, l.IP)
+		if l.Hostname != "" {
+			_, _ = fmt.Fprintf(b, "\toption host-name %q;\n", l.Hostname)
+		}
+
+		_, _ = b.WriteString("}\n")
+	}
+
+	_, err = w.Write(b.Bytes())
+
+	return err
+}
+
+// keaSection is a named section of the Kea DHCP servers configuration.
+type keaSection struct {
+	// conf is the configuration of the section.
+	conf *keaDHCPConfig
+
+	// name is the name of the section used in the error messages.
+	name string
+}
+
+// keaConfig is the configuration of Kea DHCP servers containing the
+// reservations.
+type keaConfig struct {
+	Dhcp4 *keaDHCPConfig `json:"Dhcp4,omitempty"`
+	Dhcp6 *keaDHCPConfig `json:"Dhcp6,omitempty"`
+}
+
+// keaDHCPConfig is the configuration of a single Kea DHCP server.  It's also
+// used for the shared networks, since those contain the subnets in the same
+// way.
+type keaDHCPConfig struct {
+	Reservations   []*keaReservation `json:"reservations,omitempty"`
+	Subnet4        []*keaSubnet      `json:"subnet4,omitempty"`
+	Subnet6        []*keaSubnet      `json:"subnet6,omitempty"`
+	SharedNetworks []*keaDHCPConfig  `json:"shared-networks,omitempty"`
+}
+
+// keaEntry is a reservation within the Kea DHCP servers configuration.
+type keaEntry struct {
+	// res is the reservation itself.
+	res *keaReservation
+
+	// path describes the location of the reservation within the configuration.
+	path string
+}
+
+// appendReservations appends all reservations within c to entries and returns
+// the result.  prefix is the location of c within the configuration.
+func (c *keaDHCPConfig) appendReservations(entries []keaEntry, prefix string) (res []keaEntry) {
+	if c == nil {
+		return entries
+	}
+
+	res = appendKeaEntries(entries, prefix, c.Reservations)
+	for _, sub := range []struct {
+		name    string
+		subnets []*keaSubnet
+	}{{
+		name:    "subnet4",
+		subnets: c.Subnet4,
+	}, {
+		name:    "subnet6",
+		subnets: c.Subnet6,
+	}} {
+		for i, s := range sub.subnets {
+			p := fmt.Sprintf("%s: %s: at index %d", prefix, sub.name, i)
+			res = appendKeaEntries(res, p, s.Reservations)
+		}
+	}
+
+	for i, n := range c.SharedNetworks {
+		p := fmt.Sprintf("%s: shared-networks: at index %d", prefix, i)
+		res = n.appendReservations(res, p)
+	}
+
+	return res
+}
+
+// appendKeaEntries appends the reservations list located at prefix to entries
+// and returns the result.
+func appendKeaEntries(entries []keaEntry, prefix string, list []*keaReservation) (res []keaEntry) {
+	res = entries
+	for i, r := range list {
+		res = append(res, keaEntry{
+			res:  r,
+			path: fmt.Sprintf("%s: reservations: at index %d", prefix, i),
+		})
+	}
+
+	return res
+}
+
+// keaSubnet is a subnet of Kea DHCP server.
+type keaSubnet struct {
+	Reservations []*keaReservation `json:"reservations"`
+}
+
+// keaReservation is a single host reservation of Kea DHCP server.
+type keaReservation struct {
+	HWAddr      string   `json:"hw-address"`
+	IPAddress   string   `json:"ip-address,omitempty"`
+	IPAddresses []string `json:"ip-addresses,omitempty"`
+	Hostname    string   `json:"hostname,omitempty"`
+}
+
+// parseKea parses the reservations from the Kea DHCP servers configuration.
+// The comments are skipped.  The reservations without a hardware address, for
+// example the ones identified by DUID or client-id, and without an IP address
+// are skipped and described in skipped.
+func parseKea(r io.Reader) (leases []*Lease, skipped []error, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading: %w", err)
+	}
+
+	data, err = stripKeaComments(data)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	conf := &keaConfig{}
+	err = json.Unmarshal(data, conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding: %w", err)
+	}
+
+	var entries []keaEntry
+	for _, sect := range []keaSection{{
+		conf: conf.Dhcp4,
+		name: "Dhcp4",
+	}, {
+		conf: conf.Dhcp6,
+		name: "Dhcp6",
+	}} {
+		entries = sect.conf.appendReservations(entries, sect.name)
+	}
+
+	for _, e := range entries {
+		res := e.res
+		ip := res.IPAddress
+		if ip == "" && len(res.IPAddresses) > 0 {
+			ip = res.IPAddresses[0]
+		}
+
+		switch {
+		case res.HWAddr == "":
+			skipped = append(skipped, fmt.Errorf("%s: hardware address: %w", e.path, errors.ErrNoValue))
+		case ip == "":
+			skipped = append(skipped, fmt.Errorf("%s: ip address: %w", e.path, errors.ErrNoValue))
+		default:
+			var l *Lease
+			l, err = newReservation(res.HWAddr, ip, res.Hostname)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", e.path, err)
+			}
+
+			leases = append(leases, l)
+		}
+	}
+
+	return leases, skipped, nil
+}
+
+// stripKeaComments returns data with the comments allowed in the Kea DHCP
+// servers configuration removed: the ones starting with "#" or "//" and lasting
+// until the end of the line, and the ones enclosed in "/*" and "*/".  The
+// comment characters within the JSON strings are kept.
+func stripKeaComments(data []byte) (res []byte, err error) {
+	res = make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '"':
+			end := keaStringEnd(data, i)
+			res = append(res, data[i:end]...)
+			i = end - 1
+		case c == '#', c == '/' && i+1 < len(data) && data[i+1] == '/':
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				return res, nil
+			}
+
+			i += end - 1
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, errors.Error("unterminated comment")
+			}
+
+			// Replace the comment with a space so that it still separates the
+			// tokens around it.
+			res = append(res, ' ')
+			i += 2 + end + 1
+		default:
+			res = append(res, c)
+		}
+	}
+
+	return res, nil
+}
+
+// keaStringEnd returns the index right after the end of the JSON string
+// starting at data[start], or len(data) if the string is unterminated.
+func keaStringEnd(data []byte, start int) (end int) {
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		default:
+			// Go on.
+		}
+	}
+
+	return len(data)
+}
+
+// writeKea writes leases as the global reservations of Kea DHCP servers.
+func writeKea(w io.Writer, leases []*Lease) (err error) {
+	conf := &keaConfig{}
+	for _, l := range leases {
+		res := &keaReservation{
+			HWAddr:   l.HWAddr.String(),
+			Hostname: l.Hostname,
+		}
+
+		if l.IP.Is4() {
+			if conf.Dhcp4 == nil {
+				conf.Dhcp4 = &keaDHCPConfig{}
+			}
+
+			res.IPAddress = l.IP.String()
+			conf.Dhcp4.Reservations = append(conf.Dhcp4.Reservations, res)
+		} else {
+			if conf.Dhcp6 == nil {
+				conf.Dhcp6 = &keaDHCPConfig{}
+			}
+
+			res.IPAddresses = []string{l.IP.String()}
+			conf.Dhcp6.Reservations = append(conf.Dhcp6.Reservations, res)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(conf)
+}
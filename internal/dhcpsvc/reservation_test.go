@@ -0,0 +1,222 @@
+package dhcpsvc_test
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReservations are the leases described by the test configurations of
+// every supported format.
+var testReservations = []*dhcpsvc.Lease{{
+	IP:       netip.MustParseAddr("192.168.0.10"),
+	Hostname: "nas",
+	HWAddr:   net.HardwareAddr{0x0, 0x11, 0x32, 0xaa, 0xbb, 0xcc},
+	IsStatic: true,
+}, {
+	IP:       netip.MustParseAddr("192.168.0.11"),
+	Hostname: "",
+	HWAddr:   net.HardwareAddr{0xb8, 0x27, 0xeb, 0x1, 0x2, 0x3},
+	IsStatic: true,
+}, {
+	IP:       netip.MustParseAddr("2001:db8::10"),
+	Hostname: "printer",
+	HWAddr:   net.HardwareAddr{0x0, 0x11, 0x22, 0x33, 0x44, 0x55},
+	IsStatic: true,
+}}
+
+func TestParseReservations(t *testing.T) {
+	testCases := []struct {
+		format dhcpsvc.ReservationFormat
+		name   string
+		in     string
+	}{{
+		format: dhcpsvc.ReservationFormatDnsmasq,
+		name:   "dnsmasq",
+		in: `# Static leases.
+domain=lan
+dhcp-host=00:11:32:aa:bb:cc,set:nas,192.168.0.10,nas,infinite
+dhcp-host=b8:27:eb:01:02:03,192.168.0.11,12h
+dhcp-host=11:22:33:44:55:66,ignore
+00:11:22:33:44:55,[2001:db8::10],printer
+`,
+	}, {
+		format: dhcpsvc.ReservationFormatISC,
+		name:   "isc",
+		in: `# Static leases.
+subnet 192.168.0.0 netmask 255.255.255.0 {
+  range 192.168.0.100 192.168.0.200;
+
+  host nas {
+    hardware ethernet 00:11:32:aa:bb:cc;
+    fixed-address 192.168.0.10, 192.168.0.12;
+    option host-name "nas";
+  }
+}
+
+group {
+  host pi { hardware ethernet b8:27:eb:01:02:03; fixed-address 192.168.0.11; }
+}
+
+host printer {
+  hardware ethernet 00:11:22:33:44:55;
+  fixed-address6 2001:db8::10;
+  option host-name "printer";
+}
+`,
+	}, {
+		format: dhcpsvc.ReservationFormatKea,
+		name:   "kea",
+		in: `{
+  // Static leases.
+  "Dhcp4": { # The DHCPv4 server.
+    "subnet4": [{
+      "subnet": "192.168.0.0/24", // The "#" and "//" within strings are kept.
+      /* The reservations
+         of the subnet. */
+      "reservations": [
+        {"hw-address": "00:11:32:aa:bb:cc", /* Inline. */ "ip-address": "192.168.0.10", "hostname": "nas"}
+      ]
+    }],
+    "shared-networks": [{
+      "subnet4": [{
+        "reservations": [
+          {"hw-address": "b8:27:eb:01:02:03", "ip-address": "192.168.0.11"}
+        ]
+      }]
+    }]
+  },
+  "Dhcp6": {
+    "reservations": [
+      {"hw-address": "00:11:22:33:44:55", "ip-addresses": ["2001:db8::10"], "hostname": "printer"}
+    ]
+  }
+}
+`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			leases, skipped, err := dhcpsvc.ParseReservations(strings.NewReader(tc.in), tc.format)
+			require.NoError(t, err)
+
+			assert.Empty(t, skipped)
+			assert.Equal(t, testReservations, leases)
+
+			buf := &bytes.Buffer{}
+			err = dhcpsvc.WriteReservations(buf, tc.format, leases)
+			require.NoError(t, err)
+
+			leases, skipped, err = dhcpsvc.ParseReservations(buf, tc.format)
+			require.NoError(t, err)
+
+			assert.Empty(t, skipped)
+			assert.Equal(t, testReservations, leases)
+		})
+	}
+}
+
+func TestParseReservations_errors(t *testing.T) {
+	testCases := []struct {
+		format     dhcpsvc.ReservationFormat
+		name       string
+		in         string
+		wantErrMsg string
+	}{{
+		format:     "bind",
+		name:       "bad_format",
+		in:         "",
+		wantErrMsg: `parsing bind reservations: format: bad enum value: "bind"`,
+	}, {
+		format:     dhcpsvc.ReservationFormatDnsmasq,
+		name:       "dnsmasq_no_ip",
+		in:         "dhcp-host=00:11:22:33:44:55,printer\n",
+		wantErrMsg: "parsing dnsmasq reservations: line 1: ip address: no value",
+	}, {
+		format:     dhcpsvc.ReservationFormatISC,
+		name:       "isc_no_mac",
+		in:         "host printer { fixed-address 192.168.0.10; }",
+		wantErrMsg: `parsing isc reservations: host "printer": hardware address: no value`,
+	}, {
+		format:     dhcpsvc.ReservationFormatISC,
+		name:       "isc_unterminated",
+		in:         "host printer { fixed-address 192.168.0.10;",
+		wantErrMsg: `parsing isc reservations: host "printer": unterminated host declaration`,
+	}, {
+		format: dhcpsvc.ReservationFormatKea,
+		name:   "kea_bad_mac",
+		in: `{
+  "Dhcp4": {"reservations": [{"hw-address": "00:11:22:33:44:55", "ip-address": "192.168.0.10"}]},
+  "Dhcp6": {"subnet6": [{}, {"reservations": [{"hw-address": "bad", "ip-addresses": ["2001:db8::1"]}]}]}
+}`,
+		wantErrMsg: "parsing kea reservations: Dhcp6: subnet6: at index 1: " +
+			"reservations: at index 0: hardware address: address bad: invalid MAC address",
+	}, {
+		format:     dhcpsvc.ReservationFormatKea,
+		name:       "kea_unterminated_comment",
+		in:         `{"Dhcp4": {} /* The DHCPv4 server.`,
+		wantErrMsg: "parsing kea reservations: unterminated comment",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := dhcpsvc.ParseReservations(strings.NewReader(tc.in), tc.format)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestParseReservations_keaSkipped(t *testing.T) {
+	const in = `{
+  "Dhcp4": {
+    "shared-networks": [{
+      "subnet4": [{
+        "reservations": [
+          {"client-id": "01:02:03", "ip-address": "192.168.0.20"},
+          {"hw-address": "00:11:32:aa:bb:cc", "ip-address": "192.168.0.10", "hostname": "nas"}
+        ]
+      }]
+    }]
+  },
+  "Dhcp6": {
+    "reservations": [
+      {"duid": "01:02:03:04", "ip-addresses": ["2001:db8::1"]},
+      {"hw-address": "00:11:22:33:44:55", "hostname": "printer"}
+    ]
+  }
+}`
+
+	leases, skipped, err := dhcpsvc.ParseReservations(
+		strings.NewReader(in),
+		dhcpsvc.ReservationFormatKea,
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, testReservations[:1], leases)
+
+	require.Len(t, skipped, 3)
+
+	testutil.AssertErrorMsg(
+		t,
+		"Dhcp4: shared-networks: at index 0: subnet4: at index 0: "+
+			"reservations: at index 0: hardware address: no value",
+		skipped[0],
+	)
+	testutil.AssertErrorMsg(
+		t,
+		"Dhcp6: reservations: at index 0: hardware address: no value",
+		skipped[1],
+	)
+	testutil.AssertErrorMsg(
+		t,
+		"Dhcp6: reservations: at index 1: ip address: no value",
+		skipped[2],
+	)
+}
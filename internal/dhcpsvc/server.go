@@ -1,6 +1,7 @@
 package dhcpsvc
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
@@ -15,6 +16,7 @@ import (
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/google/gopacket"
+	"golang.org/x/net/icmp"
 )
 
 // DHCPServer is a DHCP server for both IPv4 and IPv6 address families.
@@ -56,6 +58,26 @@ type DHCPServer struct {
 	// interfaces6 is the set of IPv6 interfaces sorted by interface name.
 	interfaces6 dhcpInterfacesV6
 
+	// relays4 is the set of IPv4 address pools for the clients behind DHCP
+	// relay agents sorted by pool name.
+	relays4 relayPoolsV4
+
+	// relayConn is the connection receiving the relayed DHCPv4 messages.  It's
+	// nil if there are no relay pools or the server isn't started.
+	relayConn net.PacketConn
+
+	// conn6 is the connection receiving the DHCPv6 messages.  It's nil if
+	// there are no IPv6 interfaces or the server isn't started.
+	conn6 net.PacketConn
+
+	// raConns are the connections sending the router advertisements on the
+	// IPv6 interfaces.  It's empty if the server isn't started.
+	raConns []*icmp.PacketConn
+
+	// ha synchronizes the leases with the peer server.  It's nil if the
+	// synchronization is disabled.
+	ha *haPeer
+
 	// icmpTimeout is the timeout for checking another DHCP server's presence.
 	icmpTimeout time.Duration
 }
@@ -86,10 +108,20 @@ func New(ctx context.Context, conf *Config) (srv *DHCPServer, err error) {
 		leases:      newLeaseIndex(),
 		interfaces4: ifaces4,
 		interfaces6: ifaces6,
+		relays4:     newRelayPools(ctx, l, conf.RelayPools),
 		icmpTimeout: conf.ICMPTimeout,
 		dbFilePath:  conf.DBFilePath,
 	}
 
+	if conf.HA != nil {
+		srv.ha = newHAPeer(
+			l.With("ha_role", conf.HA.Role),
+			conf.HA,
+			srv.applyHAMessage,
+			srv.haSnapshot,
+		)
+	}
+
 	err = srv.dbLoad(ctx)
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
@@ -149,6 +181,47 @@ func (srv *DHCPServer) Start(ctx context.Context) (err error) {
 
 	// TODO(e.burkov):  Listen to configured interfaces.
 
+	if len(srv.relays4) > 0 {
+		addr := &net.UDPAddr{IP: net.IPv4zero, Port: int(ServerPortV4)}
+		srv.relayConn, err = net.ListenUDP("udp4", addr)
+		if err != nil {
+			return fmt.Errorf("listening for relayed messages: %w", err)
+		}
+
+		go srv.serveRelayed(context.WithoutCancel(ctx), srv.relayConn)
+	}
+
+	if len(srv.interfaces6) > 0 {
+		srv.conn6, err = srv.listen6()
+		if err != nil {
+			return fmt.Errorf("dhcpv6: %w", err)
+		}
+
+		go srv.serveUDP6(context.WithoutCancel(ctx), srv.conn6)
+	}
+
+	for _, iface := range srv.interfaces6 {
+		if !iface.advertises() {
+			continue
+		}
+
+		var conn *icmp.PacketConn
+		conn, err = iface.startRA(context.WithoutCancel(ctx))
+		if err != nil {
+			return fmt.Errorf("interface %s: %w", iface.common.name, err)
+		}
+
+		srv.raConns = append(srv.raConns, conn)
+	}
+
+	if srv.ha != nil {
+		err = srv.ha.start(context.WithoutCancel(ctx))
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+	}
+
 	go srv.serve(context.WithoutCancel(ctx))
 
 	return nil
@@ -159,6 +232,40 @@ func (srv *DHCPServer) Shutdown(ctx context.Context) (err error) {
 
 	// TODO(e.burkov):  Close the packet source.
 
+	if srv.relayConn != nil {
+		err = srv.relayConn.Close()
+		if err != nil {
+			return fmt.Errorf("closing relay connection: %w", err)
+		}
+	}
+
+	if srv.conn6 != nil {
+		err = srv.conn6.Close()
+		if err != nil {
+			return fmt.Errorf("closing dhcpv6 connection: %w", err)
+		}
+
+		srv.conn6 = nil
+	}
+
+	var errs []error
+	for _, conn := range srv.raConns {
+		errs = append(errs, conn.Close())
+	}
+	srv.raConns = nil
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return fmt.Errorf("closing router advertisement connections: %w", err)
+	}
+
+	if srv.ha != nil {
+		err = srv.ha.shutdown(ctx)
+		if err != nil {
+			return fmt.Errorf("shutting down ha peer: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -242,6 +349,10 @@ func (srv *DHCPServer) resetLeases() {
 	}
 	for _, iface := range srv.interfaces6 {
 		iface.common.reset()
+		clear(iface.delegations)
+	}
+	for _, p := range srv.relays4 {
+		p.iface.common.reset()
 	}
 	srv.leases.clear()
 }
@@ -250,6 +361,12 @@ func (srv *DHCPServer) resetLeases() {
 func (srv *DHCPServer) AddLease(ctx context.Context, l *Lease) (err error) {
 	defer func() { err = errors.Annotate(err, "adding lease: %w") }()
 
+	err = validateLeaseOptions(l.Options)
+	if err != nil {
+		// Don't wrap the error since there is already an annotation deferred.
+		return err
+	}
+
 	addr := l.IP
 	iface, err := srv.ifaceForAddr(addr)
 	if err != nil {
@@ -272,6 +389,8 @@ func (srv *DHCPServer) AddLease(ctx context.Context, l *Lease) (err error) {
 		return err
 	}
 
+	srv.ha.replicate(ctx, haKindAdd, l)
+
 	iface.logger.DebugContext(
 		ctx, "added lease",
 		"hostname", l.Hostname,
@@ -283,12 +402,70 @@ func (srv *DHCPServer) AddLease(ctx context.Context, l *Lease) (err error) {
 	return nil
 }
 
+// commitLease stores l, replacing the client's existing lease, if any, as
+// well as the expired lease for the same address.  It expects the
+// [DHCPServer.leasesMu] to be locked.
+func (srv *DHCPServer) commitLease(
+	ctx context.Context,
+	iface *netInterface,
+	l *Lease,
+	existing *Lease,
+) (err error) {
+	if l == existing {
+		// The static lease needs no changes.
+		return nil
+	}
+
+	if expired, has := srv.leases.leaseByAddr(l.IP); has && !bytes.Equal(expired.HWAddr, l.HWAddr) {
+		err = srv.leases.remove(expired, iface)
+		if err != nil {
+			return fmt.Errorf("removing expired lease: %w", err)
+		}
+
+		srv.ha.replicate(ctx, haKindRemove, expired)
+	}
+
+	kind := haKindAdd
+	if existing != nil {
+		kind = haKindUpdate
+		err = srv.leases.update(l, iface)
+	} else {
+		err = srv.leases.add(l, iface)
+	}
+	if err != nil {
+		return fmt.Errorf("storing lease: %w", err)
+	}
+
+	err = srv.dbStore(ctx)
+	if err != nil {
+		// Don't wrap the error since it's already informative enough as is.
+		return err
+	}
+
+	srv.ha.replicate(ctx, kind, l)
+
+	iface.logger.DebugContext(
+		ctx, "leased address",
+		"hostname", l.Hostname,
+		"ip", l.IP,
+		"mac", l.HWAddr,
+	)
+
+	return nil
+}
+
 // UpdateStaticLease implements the [Interface] interface for *DHCPServer.
 //
 // TODO(e.burkov):  Support moving leases between interfaces.
 func (srv *DHCPServer) UpdateStaticLease(ctx context.Context, l *Lease) (err error) {
 	defer func() { err = errors.Annotate(err, "updating static lease: %w") }()
 
+	err = validateLeaseOptions(l.Options)
+	if err != nil {
+		// Don't wrap the error since there is already an annotation deferred.
+		return err
+	}
+
 	addr := l.IP
 	iface, err := srv.ifaceForAddr(addr)
 	if err != nil {
@@ -311,6 +488,8 @@ func (srv *DHCPServer) UpdateStaticLease(ctx context.Context, l *Lease) (err err
 		return err
 	}
 
+	srv.ha.replicate(ctx, haKindUpdate, l)
+
 	iface.logger.DebugContext(
 		ctx, "updated lease",
 		"hostname", l.Hostname,
@@ -348,6 +527,8 @@ func (srv *DHCPServer) RemoveLease(ctx context.Context, l *Lease) (err error) {
 		return err
 	}
 
+	srv.ha.replicate(ctx, haKindRemove, l)
+
 	iface.logger.DebugContext(
 		ctx, "removed lease",
 		"hostname", l.Hostname,
@@ -359,11 +540,14 @@ func (srv *DHCPServer) RemoveLease(ctx context.Context, l *Lease) (err error) {
 	return nil
 }
 
-// removeLeaseByAddr removes the lease with the given IP address from the
-// server.  It returns an error if the lease can't be removed.
-//
-//lint:ignore U1000 TODO(e.burkov):  Use
-func (srv *DHCPServer) removeLeaseByAddr(ctx context.Context, addr netip.Addr) (err error) {
+// removeLeaseByAddr removes the dynamic lease with the given IP address held
+// by the client with the given hardware address.  It does nothing if there is
+// no such lease.
+func (srv *DHCPServer) removeLeaseByAddr(
+	ctx context.Context,
+	addr netip.Addr,
+	mac net.HardwareAddr,
+) (err error) {
 	defer func() { err = errors.Annotate(err, "removing lease by address: %w") }()
 
 	iface, err := srv.ifaceForAddr(addr)
@@ -376,8 +560,10 @@ func (srv *DHCPServer) removeLeaseByAddr(ctx context.Context, addr netip.Addr) (
 	defer srv.leasesMu.Unlock()
 
 	l, ok := srv.leases.leaseByAddr(addr)
-	if !ok {
-		return fmt.Errorf("no lease for ip %s", addr)
+	if !ok || l.IsStatic || !bytes.Equal(l.HWAddr, mac) {
+		iface.logger.DebugContext(ctx, "no lease to remove", "ip", addr, "mac", mac)
+
+		return nil
 	}
 
 	err = srv.leases.remove(l, iface)
@@ -392,6 +578,8 @@ func (srv *DHCPServer) removeLeaseByAddr(ctx context.Context, addr netip.Addr) (
 		return err
 	}
 
+	srv.ha.replicate(ctx, haKindRemove, l)
+
 	iface.logger.DebugContext(
 		ctx, "removed lease",
 		"hostname", l.Hostname,
@@ -409,6 +597,9 @@ func (srv *DHCPServer) ifaceForAddr(addr netip.Addr) (iface *netInterface, err e
 	var ok bool
 	if addr.Is4() {
 		iface, ok = srv.interfaces4.find(addr)
+		if !ok {
+			iface, ok = srv.relays4.findByAddr(addr)
+		}
 	} else {
 		iface, ok = srv.interfaces6.find(addr)
 	}
@@ -0,0 +1,108 @@
+package dhcpsvc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/ipv6"
+)
+
+// ServerPortV6 is the UDP port DHCPv6 servers and relay agents listen on.
+const ServerPortV6 uint16 = 547
+
+// allDHCPAgentsV6 is the All_DHCP_Relay_Agents_and_Servers multicast address
+// the DHCPv6 clients send their messages to.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8415#section-7.1.
+var allDHCPAgentsV6 = netip.MustParseAddr("ff02::1:2")
+
+// udpWriter6 is a [responseWriter6] that unicasts the responses back to the
+// client through the UDP connection.
+type udpWriter6 struct {
+	// conn is the connection to send the responses through.
+	conn net.PacketConn
+
+	// addr is the address of the client, including the zone of its link-local
+	// address.
+	addr net.Addr
+}
+
+// type check
+var _ responseWriter6 = (*udpWriter6)(nil)
+
+// write implements the [responseWriter6] interface for *udpWriter6.
+func (w *udpWriter6) write(_ context.Context, pkt *layers.DHCPv6) (err error) {
+	buf := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, pkt)
+	if err != nil {
+		return fmt.Errorf("serializing: %w", err)
+	}
+
+	_, err = w.conn.WriteTo(buf.Bytes(), w.addr)
+	if err != nil {
+		return fmt.Errorf("writing to %s: %w", w.addr, err)
+	}
+
+	return nil
+}
+
+// listen6 returns the connection receiving the DHCPv6 messages sent to the
+// All_DHCP_Relay_Agents_and_Servers address on the network interfaces of
+// srv.interfaces6.
+func (srv *DHCPServer) listen6() (conn net.PacketConn, err error) {
+	addr := &net.UDPAddr{IP: net.IPv6unspecified, Port: int(ServerPortV6)}
+	conn, err = net.ListenUDP("udp6", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening: %w", err)
+	}
+
+	conn6 := ipv6.NewPacketConn(conn)
+	group := &net.UDPAddr{IP: allDHCPAgentsV6.AsSlice()}
+	for _, iface := range srv.interfaces6 {
+		var netIface *net.Interface
+		netIface, err = net.InterfaceByName(iface.common.name)
+		if err == nil {
+			err = conn6.JoinGroup(netIface, group)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("interface %s: joining %s: %w", iface.common.name, allDHCPAgentsV6, err)
+
+			return nil, errors.WithDeferred(err, conn.Close())
+		}
+	}
+
+	return conn, nil
+}
+
+// serveUDP6 reads the DHCPv6 messages from conn and handles them until conn is
+// closed.  It's used to run in a separate goroutine.
+func (srv *DHCPServer) serveUDP6(ctx context.Context, conn net.PacketConn) {
+	defer slogutil.RecoverAndLog(ctx, srv.logger)
+
+	// The maximum size of a DHCPv6 message fits a single non-fragmented UDP
+	// datagram over Ethernet.
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				srv.logger.ErrorContext(ctx, "reading dhcpv6", slogutil.KeyError, err)
+			}
+
+			return
+		}
+
+		pkt := gopacket.NewPacket(buf[:n], layers.LayerTypeDHCPv6, gopacket.Default)
+		err = srv.serveV6(ctx, &udpWriter6{conn: conn, addr: addr}, pkt)
+		if err != nil {
+			srv.logger.ErrorContext(ctx, "serving", slogutil.KeyError, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package dhcpsvc
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"log/slog"
 	"net"
@@ -43,6 +44,11 @@ type IPv4Config struct {
 	// explicit.
 	Options layers.DHCPOptions
 
+	// Classes are the option classes overriding Options for the matching
+	// clients.  The classes are applied in order, so that the latter ones take
+	// precedence.  It must only contain valid configurations.
+	Classes []*OptionClassConfig
+
 	// LeaseDuration is the TTL of a DHCP lease.  It should be positive.
 	LeaseDuration time.Duration
 
@@ -74,6 +80,10 @@ func (c *IPv4Config) Validate() (err error) {
 		errs = append(errs, err)
 	}
 
+	for i, c := range c.Classes {
+		errs = validate.Append(errs, fmt.Sprintf("classes: at index %d", i), c)
+	}
+
 	return errors.Join(errs...)
 }
 
@@ -144,6 +154,10 @@ type dhcpInterfaceV4 struct {
 	// explicitOpts are the user-configured options.  It must not have
 	// intersections with implicitOpts.
 	explicitOpts layers.DHCPOptions
+
+	// classes are the option classes overriding the options for the matching
+	// clients.
+	classes []*OptionClassConfig
 }
 
 // newDHCPInterfaceV4 creates a new DHCP interface for IPv4 address family with
@@ -170,6 +184,7 @@ func newDHCPInterfaceV4(
 		gateway:   conf.GatewayIP,
 		subnet:    netip.PrefixFrom(conf.GatewayIP, maskLen),
 		addrSpace: addrSpace,
+		classes:   conf.Classes,
 		common: &netInterface{
 			logger:   l,
 			leases:   map[macKey]*Lease{},
@@ -409,42 +424,69 @@ func serverID4(msg *layers.DHCPv4) (ip netip.Addr, ok bool) {
 	return netip.Addr{}, false
 }
 
-// handleDiscover handles messages of type discover.
-func (iface *dhcpInterfaceV4) handleDiscover(
-	ctx context.Context,
-	rw responseWriter4,
-	msg *layers.DHCPv4,
-) {
-	// TODO(e.burkov):  Implement.
+// option4 returns the data of the first option of type typ within msg, if
+// any.
+func option4(msg *layers.DHCPv4, typ layers.DHCPOpt) (data []byte) {
+	for _, opt := range msg.Options {
+		if opt.Type == typ {
+			return opt.Data
+		}
+	}
+
+	return nil
 }
 
-// handleSelecting handles messages of type request in SELECTING state.
-func (iface *dhcpInterfaceV4) handleSelecting(
-	ctx context.Context,
-	rw responseWriter4,
-	msg *layers.DHCPv4,
-	reqIP netip.Addr,
-) {
-	// TODO(e.burkov):  Implement.
+// serverID returns the Server Identifier of iface.  The server is expected to
+// be reachable by the clients at the gateway address, either directly or
+// through the relay agent.
+func (iface *dhcpInterfaceV4) serverID() (ip netip.Addr) {
+	return iface.gateway
 }
 
-// handleSelecting handles messages of type request in INIT-REBOOT state.
-func (iface *dhcpInterfaceV4) handleInitReboot(
-	ctx context.Context,
-	rw responseWriter4,
-	msg *layers.DHCPv4,
-	reqIP netip.Addr,
-) {
-	// TODO(e.burkov):  Implement.
+// newResponse returns a new response of the given type to req.  The options of
+// the response are sorted by code.
+func (iface *dhcpInterfaceV4) newResponse(
+	req *layers.DHCPv4,
+	typ layers.DHCPMsgType,
+) (resp *layers.DHCPv4) {
+	return &layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: req.HardwareType,
+		HardwareLen:  req.HardwareLen,
+		Xid:          req.Xid,
+		Flags:        req.Flags,
+		RelayAgentIP: req.RelayAgentIP,
+		ClientHWAddr: req.ClientHWAddr,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(typ)}),
+			layers.NewDHCPOption(layers.DHCPOptServerID, iface.serverID().AsSlice()),
+		},
+	}
 }
 
-// handleRenew handles messages of type request in RENEWING or REBINDING state.
-func (iface *dhcpInterfaceV4) handleRenew(
+// newLeaseResponse returns a new response of the given type to req, which
+// offers or acknowledges l.
+func (iface *dhcpInterfaceV4) newLeaseResponse(
 	ctx context.Context,
-	rw responseWriter4,
 	req *layers.DHCPv4,
-) {
-	// TODO(e.burkov):  Implement.
+	typ layers.DHCPMsgType,
+	l *Lease,
+) (resp *layers.DHCPv4) {
+	resp = iface.newResponse(req, typ)
+	resp.YourClientIP = l.IP.AsSlice()
+
+	required := resp.Options
+	resp.Options = nil
+	iface.setResponseOptions(ctx, resp, req, l)
+
+	leaseTime := binary.BigEndian.AppendUint32(nil, uint32(iface.common.leaseTTL.Seconds()))
+	required = append(required, layers.NewDHCPOption(layers.DHCPOptLeaseTime, leaseTime))
+	slices.SortFunc(required, compareV4OptionCodes)
+
+	// The required options take precedence over the configured ones.
+	resp.Options = overrideOptions(resp.Options, required)
+
+	return resp
 }
 
 // dhcpInterfacesV4 is a slice of network interfaces of IPv4 address family.
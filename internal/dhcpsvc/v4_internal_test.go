@@ -1,7 +1,10 @@
 package dhcpsvc
 
 import (
+	"context"
+	"net"
 	"net/netip"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -9,6 +12,7 @@ import (
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/google/gopacket/layers"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIPv4Config_Options(t *testing.T) {
@@ -92,3 +96,211 @@ func TestIPv4Config_Options(t *testing.T) {
 		})
 	}
 }
+
+// testResponseWriter4 is a [responseWriter4] collecting the responses.
+type testResponseWriter4 struct {
+	resps []*layers.DHCPv4
+}
+
+// type check
+var _ responseWriter4 = (*testResponseWriter4)(nil)
+
+// write implements the [responseWriter4] interface for *testResponseWriter4.
+func (w *testResponseWriter4) write(_ context.Context, pkt *layers.DHCPv4) (err error) {
+	w.resps = append(w.resps, pkt)
+
+	return nil
+}
+
+// last returns the last response written and resets w.
+func (w *testResponseWriter4) last(tb testing.TB) (resp *layers.DHCPv4) {
+	tb.Helper()
+
+	require.NotEmpty(tb, w.resps)
+
+	resp = w.resps[len(w.resps)-1]
+	w.resps = nil
+
+	return resp
+}
+
+var (
+	// testGatewayIP4 is the gateway address of the DHCPv4 interface in tests.
+	testGatewayIP4 = netip.MustParseAddr("192.168.0.1")
+
+	// testRangeStart4 is the first address of the DHCPv4 range in tests.
+	testRangeStart4 = netip.MustParseAddr("192.168.0.100")
+
+	// testBootIP4 is the address of the network boot server in tests.
+	testBootIP4 = netip.MustParseAddr("192.168.0.10")
+
+	// testMAC4 is the hardware address of the client in tests.
+	testMAC4 = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+)
+
+// newTestV4Conf returns a valid configuration of the DHCPv4 interface with a
+// network boot option class.
+func newTestV4Conf() (conf *IPv4Config) {
+	return &IPv4Config{
+		Enabled:       true,
+		GatewayIP:     testGatewayIP4,
+		SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+		RangeStart:    testRangeStart4,
+		RangeEnd:      netip.MustParseAddr("192.168.0.200"),
+		LeaseDuration: time.Hour,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptDNS, testGatewayIP4.AsSlice()),
+		},
+		Classes: []*OptionClassConfig{{
+			Name:          "bios",
+			VendorClass:   "PXEClient",
+			Architectures: []ClientArch{ClientArchBIOS},
+			Options: layers.DHCPOptions{
+				layers.NewDHCPOption(layers.DHCPOptDNS, testBootIP4.AsSlice()),
+			},
+			NextServer:   testBootIP4,
+			BootFileName: "undionly.kpxe",
+		}},
+	}
+}
+
+// newTestV4Server returns a new DHCP server with the single IPv4 interface.
+func newTestV4Server(tb testing.TB) (srv *DHCPServer) {
+	tb.Helper()
+
+	ctx := testutil.ContextWithTimeout(tb, time.Second)
+	srv, err := New(ctx, &Config{
+		Enabled:         true,
+		Logger:          slogutil.NewDiscardLogger(),
+		LocalDomainName: "local",
+		DBFilePath:      filepath.Join(tb.TempDir(), "leases.json"),
+		Interfaces: map[string]*InterfaceConfig{
+			"eth0": {
+				IPv4: newTestV4Conf(),
+				IPv6: &IPv6Config{Enabled: false},
+			},
+		},
+	})
+	require.NoError(tb, err)
+
+	return srv
+}
+
+// newTestRequest4 returns a new DHCPv4 message of the given type from mac with
+// the given options.
+func newTestRequest4(
+	mac net.HardwareAddr,
+	typ layers.DHCPMsgType,
+	opts ...layers.DHCPOption,
+) (req *layers.DHCPv4) {
+	return &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  uint8(len(mac)),
+		Xid:          1,
+		ClientHWAddr: mac,
+		Options: append(layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(typ)}),
+		}, opts...),
+	}
+}
+
+func TestDHCPServer_handleDHCPv4(t *testing.T) {
+	srv := newTestV4Server(t)
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+	rw := &testResponseWriter4{}
+
+	bootOpts := newTestBootRequest(testMAC4, ClientArchBIOS, nil).Options
+	serverID := layers.NewDHCPOption(layers.DHCPOptServerID, testGatewayIP4.AsSlice())
+	reqIP := layers.NewDHCPOption(layers.DHCPOptRequestIP, testRangeStart4.AsSlice())
+
+	t.Run("discover", func(t *testing.T) {
+		req := newTestRequest4(testMAC4, layers.DHCPMsgTypeDiscover, bootOpts...)
+		require.NoError(t, srv.handleDHCPv4(ctx, rw, layers.DHCPMsgTypeDiscover, req))
+
+		resp := rw.last(t)
+		typ, ok := msg4Type(resp)
+		require.True(t, ok)
+
+		assert.Equal(t, layers.DHCPMsgTypeOffer, typ)
+		assert.Equal(t, layers.DHCPOpReply, resp.Operation)
+		assert.Equal(t, req.Xid, resp.Xid)
+		assert.Equal(t, testRangeStart4.AsSlice(), []byte(resp.YourClientIP.To4()))
+		assert.Equal(t, testGatewayIP4.AsSlice(), option4(resp, layers.DHCPOptServerID))
+		assert.Equal(t, testGatewayIP4.AsSlice(), option4(resp, layers.DHCPOptRouter))
+		assert.Equal(t, []byte{0x0, 0x0, 0xe, 0x10}, option4(resp, layers.DHCPOptLeaseTime))
+
+		// The class options override the interface ones.
+		assert.Equal(t, testBootIP4.AsSlice(), option4(resp, layers.DHCPOptDNS))
+		assert.Equal(t, testBootIP4.AsSlice(), []byte(resp.NextServerIP.To4()))
+		assert.Equal(t, "undionly.kpxe", string(resp.File))
+
+		assert.IsIncreasing(t, optionCodes(resp.Options))
+		assert.Empty(t, srv.Leases())
+	})
+
+	t.Run("request_selecting", func(t *testing.T) {
+		req := newTestRequest4(testMAC4, layers.DHCPMsgTypeRequest, serverID, reqIP)
+		require.NoError(t, srv.handleDHCPv4(ctx, rw, layers.DHCPMsgTypeRequest, req))
+
+		resp := rw.last(t)
+		typ, ok := msg4Type(resp)
+		require.True(t, ok)
+
+		assert.Equal(t, layers.DHCPMsgTypeAck, typ)
+		assert.Equal(t, testRangeStart4.AsSlice(), []byte(resp.YourClientIP.To4()))
+
+		leases := srv.Leases()
+		require.Len(t, leases, 1)
+
+		assert.Equal(t, testRangeStart4, leases[0].IP)
+		assert.Equal(t, testMAC4, leases[0].HWAddr)
+		assert.Equal(t, "192-168-0-100", leases[0].Hostname)
+	})
+
+	t.Run("request_taken", func(t *testing.T) {
+		mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+		req := newTestRequest4(mac, layers.DHCPMsgTypeRequest, serverID, reqIP)
+		require.NoError(t, srv.handleDHCPv4(ctx, rw, layers.DHCPMsgTypeRequest, req))
+
+		typ, ok := msg4Type(rw.last(t))
+		require.True(t, ok)
+
+		assert.Equal(t, layers.DHCPMsgTypeNak, typ)
+	})
+
+	t.Run("request_other_server", func(t *testing.T) {
+		otherID := layers.NewDHCPOption(layers.DHCPOptServerID, []byte{192, 168, 0, 2})
+		req := newTestRequest4(testMAC4, layers.DHCPMsgTypeRequest, otherID, reqIP)
+		require.NoError(t, srv.handleDHCPv4(ctx, rw, layers.DHCPMsgTypeRequest, req))
+
+		assert.Empty(t, rw.resps)
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		req := newTestRequest4(testMAC4, layers.DHCPMsgTypeRequest)
+		req.ClientIP = testRangeStart4.AsSlice()
+		require.NoError(t, srv.handleDHCPv4(ctx, rw, layers.DHCPMsgTypeRequest, req))
+
+		typ, ok := msg4Type(rw.last(t))
+		require.True(t, ok)
+
+		assert.Equal(t, layers.DHCPMsgTypeAck, typ)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		req := newTestRequest4(testMAC4, layers.DHCPMsgTypeRelease, serverID)
+		req.ClientIP = testRangeStart4.AsSlice()
+		require.NoError(t, srv.handleDHCPv4(ctx, rw, layers.DHCPMsgTypeRelease, req))
+
+		assert.Empty(t, rw.resps)
+		assert.Empty(t, srv.Leases())
+	})
+
+	t.Run("init_reboot_unknown", func(t *testing.T) {
+		req := newTestRequest4(testMAC4, layers.DHCPMsgTypeRequest, reqIP)
+		require.NoError(t, srv.handleDHCPv4(ctx, rw, layers.DHCPMsgTypeRequest, req))
+
+		assert.Empty(t, rw.resps)
+	})
+}
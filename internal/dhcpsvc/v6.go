@@ -8,6 +8,7 @@ import (
 	"slices"
 	"time"
 
+	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/validate"
@@ -25,6 +26,15 @@ type IPv6Config struct {
 	// options, either implicit or explicit.
 	Options layers.DHCPv6Options
 
+	// Reservations are the static addresses reserved for the clients with the
+	// given DUIDs.  It must only contain valid reservations with unique DUIDs
+	// and addresses.
+	Reservations []*DUIDReservation
+
+	// PrefixDelegation is the configuration of the prefix delegation.  If nil,
+	// the IA_PD options are answered with the NoPrefixAvail status.
+	PrefixDelegation *PrefixDelegationConfig
+
 	// LeaseDuration is the TTL of a DHCP lease.  It should be positive.
 	LeaseDuration time.Duration
 
@@ -64,9 +74,124 @@ func (c *IPv6Config) Validate() (err error) {
 		errs = append(errs, err)
 	}
 
+	errs = c.validateReservations(errs)
+
+	if c.PrefixDelegation != nil {
+		errs = validate.Append(errs, "prefix delegation", c.PrefixDelegation)
+	}
+
 	return errors.Join(errs...)
 }
 
+// validateReservations validates the static DUID reservations.
+func (c *IPv6Config) validateReservations(errs []error) (res []error) {
+	res = errs
+
+	duids := container.NewMapSet[string]()
+	addrs := container.NewMapSet[netip.Addr]()
+	for i, r := range c.Reservations {
+		prefix := fmt.Sprintf("reservations: at index %d", i)
+
+		err := r.Validate()
+		if err != nil {
+			res = append(res, fmt.Errorf("%s: %w", prefix, err))
+
+			continue
+		}
+
+		if !inRange6(c.RangeStart, r.IP) {
+			err = fmt.Errorf("ip %s is not within the range starting at %s", r.IP, c.RangeStart)
+			res = append(res, fmt.Errorf("%s: %w", prefix, err))
+		}
+
+		if duids.Has(string(r.DUID)) {
+			err = fmt.Errorf("duid %x: %w", r.DUID, errors.ErrDuplicated)
+			res = append(res, fmt.Errorf("%s: %w", prefix, err))
+		}
+
+		if addrs.Has(r.IP) {
+			err = fmt.Errorf("ip %s: %w", r.IP, errors.ErrDuplicated)
+			res = append(res, fmt.Errorf("%s: %w", prefix, err))
+		}
+
+		duids.Add(string(r.DUID))
+		addrs.Add(r.IP)
+	}
+
+	return res
+}
+
+// DUIDReservation is a static address reserved for the DHCPv6 client.
+type DUIDReservation struct {
+	// IP is the reserved address.  It must be a valid IPv6 address within the
+	// range of the interface.
+	IP netip.Addr
+
+	// Hostname is the hostname of the client, if any.  It must be a valid
+	// hostname, if set.
+	Hostname string
+
+	// DUID is the DHCP Unique Identifier of the client.  It must not be empty.
+	DUID []byte
+}
+
+// type check
+var _ validate.Interface = (*DUIDReservation)(nil)
+
+// Validate implements the [validate.Interface] interface for *DUIDReservation.
+func (r *DUIDReservation) Validate() (err error) {
+	if r == nil {
+		return errors.ErrNoValue
+	}
+
+	errs := []error{
+		validate.NotEmptySlice("DUID", r.DUID),
+		validate.NoGreaterThan("DUID length", len(r.DUID), maxDUIDLen),
+	}
+
+	if !r.IP.Is6() {
+		errs = append(errs, newMustErr("ip", "be a valid ipv6", r.IP))
+	}
+
+	if r.Hostname != "" {
+		errs = append(errs, netutil.ValidateHostname(r.Hostname))
+	}
+
+	return errors.Join(errs...)
+}
+
+// PrefixDelegationConfig is the configuration of the DHCPv6 prefix delegation.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8415#section-6.3.
+type PrefixDelegationConfig struct {
+	// Prefix is the pool of prefixes to delegate.  It must be a valid masked
+	// IPv6 prefix.
+	Prefix netip.Prefix
+
+	// DelegatedLength is the length of each delegated prefix.  It must not be
+	// less than the length of Prefix and must not be greater than 64.
+	DelegatedLength int
+}
+
+// type check
+var _ validate.Interface = (*PrefixDelegationConfig)(nil)
+
+// Validate implements the [validate.Interface] interface for
+// *PrefixDelegationConfig.
+func (c *PrefixDelegationConfig) Validate() (err error) {
+	if c == nil {
+		return errors.ErrNoValue
+	}
+
+	if !c.Prefix.IsValid() || !c.Prefix.Addr().Is6() || c.Prefix.Addr().Is4In6() {
+		return newMustErr("prefix", "be a valid ipv6 prefix", c.Prefix)
+	} else if c.Prefix.Masked() != c.Prefix {
+		return newMustErr("prefix", "be masked", c.Prefix)
+	}
+
+	return validate.InRange("DelegatedLength", c.DelegatedLength, c.Prefix.Bits(), maxDelegatedLen)
+}
+
 // dhcpInterfaceV6 is a DHCP interface for IPv6 address family.
 type dhcpInterfaceV6 struct {
 	// common is the common part of any network interface within the DHCP
@@ -91,6 +216,21 @@ type dhcpInterfaceV6 struct {
 
 	// raAllowSLAAC defines if DHCP should send ICMPv6.RA packets with MO flags.
 	raAllowSLAAC bool
+
+	// serverID is the DUID of the server on this interface.
+	serverID []byte
+
+	// reservations are the static addresses reserved for the clients, keyed
+	// by the DUIDs of the clients.
+	reservations map[string]*DUIDReservation
+
+	// pd is the prefix delegation configuration, if any.
+	pd *PrefixDelegationConfig
+
+	// delegations are the prefixes delegated to the clients.  It's protected
+	// by [DHCPServer.leasesMu] and stored in the database along with the
+	// leases.
+	delegations map[delegationKey]*delegation
 }
 
 // newDHCPInterfaceV6 creates a new DHCP interface for IPv6 address family with
@@ -118,7 +258,15 @@ func newDHCPInterfaceV6(
 		},
 		raSLAACOnly:  conf.RASLAACOnly,
 		raAllowSLAAC: conf.RAAllowSLAAC,
+		serverID:     newServerDUID(name, conf.RangeStart),
+		reservations: make(map[string]*DUIDReservation, len(conf.Reservations)),
+		pd:           conf.PrefixDelegation,
+		delegations:  map[delegationKey]*delegation{},
+	}
+	for _, r := range conf.Reservations {
+		iface.reservations[string(r.DUID)] = r
 	}
+
 	iface.implicitOpts, iface.explicitOpts = conf.options(ctx, l)
 
 	return iface
@@ -130,17 +278,8 @@ type dhcpInterfacesV6 []*dhcpInterfaceV6
 // find returns the first network interface within ifaces containing ip.  It
 // returns false if there is no such interface.
 func (ifaces dhcpInterfacesV6) find(ip netip.Addr) (iface6 *netInterface, ok bool) {
-	// prefLen is the length of prefix to match ip against.
-	//
-	// TODO(e.burkov):  DHCPv6 inherits the weird behavior of legacy
-	// implementation where the allocated range constrained by the first address
-	// and the first address with last byte set to 0xff.  Proper prefixes should
-	// be used instead.
-	const prefLen = netutil.IPv6BitLen - 8
-
 	i := slices.IndexFunc(ifaces, func(iface *dhcpInterfaceV6) (contains bool) {
-		return !ip.Less(iface.rangeStart) &&
-			netip.PrefixFrom(iface.rangeStart, prefLen).Contains(ip)
+		return inRange6(iface.rangeStart, ip)
 	})
 	if i < 0 {
 		return nil, false
@@ -149,6 +288,49 @@ func (ifaces dhcpInterfacesV6) find(ip netip.Addr) (iface6 *netInterface, ok boo
 	return ifaces[i].common, true
 }
 
+// findInterface returns the first DHCPv6 interface within ifaces containing
+// ip.  It returns false if there is no such interface.
+func (ifaces dhcpInterfacesV6) findInterface(ip netip.Addr) (iface *dhcpInterfaceV6, ok bool) {
+	i := slices.IndexFunc(ifaces, func(iface *dhcpInterfaceV6) (contains bool) {
+		return inRange6(iface.rangeStart, ip)
+	})
+	if i < 0 {
+		return nil, false
+	}
+
+	return ifaces[i], true
+}
+
+// findDelegating returns the first DHCPv6 interface within ifaces delegating
+// the prefixes of the same length as p from the pool containing p.  It returns
+// false if there is no such interface.
+func (ifaces dhcpInterfacesV6) findDelegating(p netip.Prefix) (iface *dhcpInterfaceV6, ok bool) {
+	i := slices.IndexFunc(ifaces, func(iface *dhcpInterfaceV6) (delegates bool) {
+		pd := iface.pd
+
+		return pd != nil && pd.DelegatedLength == p.Bits() && pd.Prefix.Contains(p.Addr())
+	})
+	if i < 0 {
+		return nil, false
+	}
+
+	return ifaces[i], true
+}
+
+// rangePrefixLen is the length of prefix to match the leased addresses
+// against.
+//
+// TODO(e.burkov):  DHCPv6 inherits the weird behavior of legacy implementation
+// where the allocated range constrained by the first address and the first
+// address with last byte set to 0xff.  Proper prefixes should be used instead.
+const rangePrefixLen = netutil.IPv6BitLen - 8
+
+// inRange6 returns true if ip is within the DHCPv6 address range starting at
+// start.
+func inRange6(start, ip netip.Addr) (ok bool) {
+	return !ip.Less(start) && netip.PrefixFrom(start, rangePrefixLen).Contains(ip)
+}
+
 // options returns the implicit and explicit options for the interface.  The two
 // lists are disjoint and the implicit options are initialized with default
 // values.
@@ -0,0 +1,470 @@
+package dhcpsvc
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testResponseWriter6 is a [responseWriter6] collecting the responses.
+type testResponseWriter6 struct {
+	resps []*layers.DHCPv6
+}
+
+// type check
+var _ responseWriter6 = (*testResponseWriter6)(nil)
+
+// write implements the [responseWriter6] interface for *testResponseWriter6.
+func (w *testResponseWriter6) write(_ context.Context, pkt *layers.DHCPv6) (err error) {
+	w.resps = append(w.resps, pkt)
+
+	return nil
+}
+
+// last returns the last response written and resets w.
+func (w *testResponseWriter6) last(tb testing.TB) (resp *layers.DHCPv6) {
+	tb.Helper()
+
+	require.NotEmpty(tb, w.resps)
+
+	resp = w.resps[len(w.resps)-1]
+	w.resps = nil
+
+	return resp
+}
+
+var (
+	// testRangeStart6 is the first address of the DHCPv6 range in tests.
+	testRangeStart6 = netip.MustParseAddr("2001:db8::100")
+
+	// testReservedIP6 is the address reserved for [testReservedDUID].
+	testReservedIP6 = netip.MustParseAddr("2001:db8::1ff")
+
+	// testMAC6 is the hardware address of the client in tests.
+	testMAC6 = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+)
+
+// testReservedDUID is the DUID-EN of the client with the reserved address.
+var testReservedDUID = []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x09, 0x01, 0x02, 0x03}
+
+// newDUIDLL returns a DUID-LL containing mac.
+func newDUIDLL(mac net.HardwareAddr) (duid []byte) {
+	return append([]byte{0x00, 0x03, 0x00, 0x01}, mac...)
+}
+
+// newTestV6Server returns a new DHCP server with the single IPv6 interface.
+func newTestV6Server(tb testing.TB) (srv *DHCPServer) {
+	tb.Helper()
+
+	return newTestV6ServerWithDB(tb, filepath.Join(tb.TempDir(), "leases.json"))
+}
+
+// newTestV6ServerWithDB returns a new DHCP server with the single IPv6
+// interface, which stores the leases in the given file.
+func newTestV6ServerWithDB(tb testing.TB, dbFilePath string) (srv *DHCPServer) {
+	tb.Helper()
+
+	ctx := testutil.ContextWithTimeout(tb, time.Second)
+	srv, err := New(ctx, &Config{
+		Enabled:         true,
+		Logger:          slogutil.NewDiscardLogger(),
+		LocalDomainName: "local",
+		DBFilePath:      dbFilePath,
+		Interfaces: map[string]*InterfaceConfig{
+			"eth0": {
+				IPv4: &IPv4Config{Enabled: false},
+				IPv6: &IPv6Config{
+					Enabled:       true,
+					RangeStart:    testRangeStart6,
+					LeaseDuration: time.Hour,
+					Reservations: []*DUIDReservation{{
+						DUID:     testReservedDUID,
+						IP:       testReservedIP6,
+						Hostname: "printer",
+					}},
+					PrefixDelegation: &PrefixDelegationConfig{
+						Prefix:          netip.MustParsePrefix("2001:db8:1::/48"),
+						DelegatedLength: 56,
+					},
+				},
+			},
+		},
+	})
+	require.NoError(tb, err)
+
+	return srv
+}
+
+// newTestIAOption6 returns the IA_NA or IA_PD option with the given hint.
+func newTestIAOption6(code layers.DHCPv6Opt, id uint32, hint netip.Prefix) (opt layers.DHCPv6Option) {
+	data := binary.BigEndian.AppendUint32(nil, id)
+	data = binary.BigEndian.AppendUint64(data, 0)
+
+	switch {
+	case !hint.IsValid():
+		// Don't add any hints.
+	case code == layers.DHCPv6OptIANA:
+		sub := append(hint.Addr().AsSlice(), make([]byte, 8)...)
+		data = appendOption6(data, layers.NewDHCPv6Option(layers.DHCPv6OptIAAddr, sub))
+	default:
+		sub := append(make([]byte, 8), byte(hint.Bits()))
+		sub = append(sub, hint.Addr().AsSlice()...)
+		data = appendOption6(data, layers.NewDHCPv6Option(layers.DHCPv6OptIAPrefix, sub))
+	}
+
+	return layers.NewDHCPv6Option(code, data)
+}
+
+// newTestPacket6 returns the decoded Ethernet frame from mac containing the
+// DHCPv6 message of the given type with the given options.
+func newTestPacket6(
+	tb testing.TB,
+	mac net.HardwareAddr,
+	typ layers.DHCPv6MsgType,
+	opts ...layers.DHCPv6Option,
+) (pkt gopacket.Packet) {
+	tb.Helper()
+
+	eth := &layers.Ethernet{
+		SrcMAC:       mac,
+		DstMAC:       net.HardwareAddr{0x33, 0x33, 0x00, 0x01, 0x00, 0x02},
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip := &layers.IPv6{
+		Version:    6,
+		HopLimit:   1,
+		NextHeader: layers.IPProtocolUDP,
+		SrcIP:      net.ParseIP("fe80::1"),
+		DstIP:      net.ParseIP("ff02::1:2"),
+	}
+	udp := &layers.UDP{
+		SrcPort: 546,
+		DstPort: 547,
+	}
+	require.NoError(tb, udp.SetNetworkLayerForChecksum(ip))
+
+	msg := &layers.DHCPv6{
+		MsgType:       typ,
+		TransactionID: []byte{0x01, 0x02, 0x03},
+		Options:       opts,
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}, eth, ip, udp, msg)
+	require.NoError(tb, err)
+
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+// findOption6 returns the data of the first option with the given code within
+// msg.
+func findOption6(tb testing.TB, msg *layers.DHCPv6, code layers.DHCPv6Opt) (data []byte) {
+	tb.Helper()
+
+	for _, o := range msg.Options {
+		if o.Code == code {
+			return o.Data
+		}
+	}
+
+	require.Failf(tb, "option not found", "code %s", code)
+
+	return nil
+}
+
+// iaStatus returns the status code within the IA option data, if any.
+func iaStatus(tb testing.TB, data []byte) (code statusCode6) {
+	tb.Helper()
+
+	opts, err := parseOptions6(data[12:])
+	require.NoError(tb, err)
+
+	for _, o := range opts {
+		if o.Code == layers.DHCPv6OptStatusCode {
+			return statusCode6(binary.BigEndian.Uint16(o.Data))
+		}
+	}
+
+	return statusSuccess6
+}
+
+// leasedPrefix returns the single address or prefix leased within the IA
+// option of the given code.
+func leasedPrefix(tb testing.TB, msg *layers.DHCPv6, code layers.DHCPv6Opt) (p netip.Prefix) {
+	tb.Helper()
+
+	data := findOption6(tb, msg, code)
+	require.Equal(tb, statusSuccess6, iaStatus(tb, data))
+
+	ia, err := parseIA6(code, data)
+	require.NoError(tb, err)
+	require.Len(tb, ia.hints, 1)
+
+	return ia.hints[0]
+}
+
+func TestDHCPServer_serveV6(t *testing.T) {
+	srv := newTestV6Server(t)
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+	rw := &testResponseWriter6{}
+
+	clientID := layers.NewDHCPv6Option(layers.DHCPv6OptClientID, newDUIDLL(testMAC6))
+	serverID := layers.NewDHCPv6Option(layers.DHCPv6OptServerID, srv.interfaces6[0].serverID)
+	iana := newTestIAOption6(layers.DHCPv6OptIANA, 1, netip.Prefix{})
+	iapd := newTestIAOption6(layers.DHCPv6OptIAPD, 2, netip.Prefix{})
+
+	wantAddr := netip.PrefixFrom(testRangeStart6, 128)
+	wantPrefix := netip.MustParsePrefix("2001:db8:1::/56")
+
+	t.Run("solicit", func(t *testing.T) {
+		pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeSolicit, clientID, iana, iapd)
+		require.NoError(t, srv.serveV6(ctx, rw, pkt))
+
+		resp := rw.last(t)
+		assert.Equal(t, layers.DHCPv6MsgTypeAdverstise, resp.MsgType)
+		assert.Equal(t, []byte{0x01, 0x02, 0x03}, resp.TransactionID)
+		assert.Equal(t, srv.interfaces6[0].serverID, findOption6(t, resp, layers.DHCPv6OptServerID))
+		assert.Equal(t, wantAddr, leasedPrefix(t, resp, layers.DHCPv6OptIANA))
+		assert.Equal(t, wantPrefix, leasedPrefix(t, resp, layers.DHCPv6OptIAPD))
+
+		assert.Empty(t, srv.Leases())
+	})
+
+	t.Run("solicit_with_server_id", func(t *testing.T) {
+		pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeSolicit, clientID, serverID, iana)
+		require.NoError(t, srv.serveV6(ctx, rw, pkt))
+
+		assert.Empty(t, rw.resps)
+	})
+
+	t.Run("request", func(t *testing.T) {
+		pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeRequest, clientID, serverID, iana, iapd)
+		require.NoError(t, srv.serveV6(ctx, rw, pkt))
+
+		resp := rw.last(t)
+		assert.Equal(t, layers.DHCPv6MsgTypeReply, resp.MsgType)
+		assert.Equal(t, wantAddr, leasedPrefix(t, resp, layers.DHCPv6OptIANA))
+		assert.Equal(t, wantPrefix, leasedPrefix(t, resp, layers.DHCPv6OptIAPD))
+
+		leases := srv.Leases()
+		require.Len(t, leases, 1)
+
+		assert.Equal(t, testRangeStart6, leases[0].IP)
+		assert.Equal(t, testMAC6, leases[0].HWAddr)
+		assert.False(t, leases[0].IsStatic)
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeRenew, clientID, serverID, iana, iapd)
+		require.NoError(t, srv.serveV6(ctx, rw, pkt))
+
+		resp := rw.last(t)
+		assert.Equal(t, layers.DHCPv6MsgTypeReply, resp.MsgType)
+		assert.Equal(t, wantAddr, leasedPrefix(t, resp, layers.DHCPv6OptIANA))
+		assert.Equal(t, wantPrefix, leasedPrefix(t, resp, layers.DHCPv6OptIAPD))
+	})
+
+	t.Run("confirm_not_on_link", func(t *testing.T) {
+		foreign := newTestIAOption6(
+			layers.DHCPv6OptIANA,
+			1,
+			netip.MustParsePrefix("2001:db8:ffff::1/128"),
+		)
+		pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeConfirm, clientID, foreign)
+		require.NoError(t, srv.serveV6(ctx, rw, pkt))
+
+		resp := rw.last(t)
+		status := findOption6(t, resp, layers.DHCPv6OptStatusCode)
+		assert.Equal(t, statusNotOnLink6, statusCode6(binary.BigEndian.Uint16(status)))
+	})
+
+	t.Run("release", func(t *testing.T) {
+		leased := newTestIAOption6(layers.DHCPv6OptIANA, 1, wantAddr)
+		pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeRelease, clientID, serverID, leased, iapd)
+		require.NoError(t, srv.serveV6(ctx, rw, pkt))
+
+		resp := rw.last(t)
+		status := findOption6(t, resp, layers.DHCPv6OptStatusCode)
+		assert.Equal(t, statusSuccess6, statusCode6(binary.BigEndian.Uint16(status)))
+
+		assert.Empty(t, srv.Leases())
+		assert.Empty(t, srv.interfaces6[0].delegations)
+	})
+
+	t.Run("renew_no_binding", func(t *testing.T) {
+		pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeRenew, clientID, serverID, iana, iapd)
+		require.NoError(t, srv.serveV6(ctx, rw, pkt))
+
+		resp := rw.last(t)
+		assert.Equal(t, statusNoBinding6, iaStatus(t, findOption6(t, resp, layers.DHCPv6OptIANA)))
+		assert.Equal(t, statusNoBinding6, iaStatus(t, findOption6(t, resp, layers.DHCPv6OptIAPD)))
+	})
+
+	t.Run("rapid_commit_reservation", func(t *testing.T) {
+		mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+		pkt := newTestPacket6(
+			t,
+			mac,
+			layers.DHCPv6MsgTypeSolicit,
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientID, testReservedDUID),
+			layers.NewDHCPv6Option(layers.DHCPv6OptRapidCommit, nil),
+			iana,
+		)
+		require.NoError(t, srv.serveV6(ctx, rw, pkt))
+
+		resp := rw.last(t)
+		assert.Equal(t, layers.DHCPv6MsgTypeReply, resp.MsgType)
+		assert.Empty(t, findOption6(t, resp, layers.DHCPv6OptRapidCommit))
+		assert.Equal(t, netip.PrefixFrom(testReservedIP6, 128), leasedPrefix(t, resp, layers.DHCPv6OptIANA))
+
+		assert.Equal(t, "printer", srv.HostByIP(testReservedIP6))
+		assert.Equal(t, mac, srv.MACByIP(testReservedIP6))
+	})
+
+	t.Run("bad_type", func(t *testing.T) {
+		pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeReply, clientID)
+		err := srv.serveV6(ctx, rw, pkt)
+		testutil.AssertErrorMsg(t, "serving dhcpv6: dhcpv6: request type: bad enum value: Reply", err)
+	})
+}
+
+func TestDHCPServer_serveV6_restart(t *testing.T) {
+	dbFilePath := filepath.Join(t.TempDir(), "leases.json")
+	srv := newTestV6ServerWithDB(t, dbFilePath)
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+	rw := &testResponseWriter6{}
+
+	clientID := layers.NewDHCPv6Option(layers.DHCPv6OptClientID, newDUIDLL(testMAC6))
+	serverID := layers.NewDHCPv6Option(layers.DHCPv6OptServerID, srv.interfaces6[0].serverID)
+	iapd := newTestIAOption6(layers.DHCPv6OptIAPD, 2, netip.Prefix{})
+
+	wantPrefix := netip.MustParsePrefix("2001:db8:1::/56")
+
+	pkt := newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeRequest, clientID, serverID, iapd)
+	require.NoError(t, srv.serveV6(ctx, rw, pkt))
+	require.Equal(t, wantPrefix, leasedPrefix(t, rw.last(t), layers.DHCPv6OptIAPD))
+
+	restarted := newTestV6ServerWithDB(t, dbFilePath)
+	require.Len(t, restarted.interfaces6[0].delegations, 1)
+
+	t.Run("renew", func(t *testing.T) {
+		pkt = newTestPacket6(t, testMAC6, layers.DHCPv6MsgTypeRenew, clientID, serverID, iapd)
+		require.NoError(t, restarted.serveV6(ctx, rw, pkt))
+
+		assert.Equal(t, wantPrefix, leasedPrefix(t, rw.last(t), layers.DHCPv6OptIAPD))
+	})
+
+	t.Run("other_router", func(t *testing.T) {
+		otherMAC := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+		otherID := layers.NewDHCPv6Option(layers.DHCPv6OptClientID, newDUIDLL(otherMAC))
+		pkt = newTestPacket6(t, otherMAC, layers.DHCPv6MsgTypeSolicit, otherID, iapd)
+		require.NoError(t, restarted.serveV6(ctx, rw, pkt))
+
+		// The restored delegation isn't given away.
+		got := leasedPrefix(t, rw.last(t), layers.DHCPv6OptIAPD)
+		assert.Equal(t, netip.MustParsePrefix("2001:db8:1:100::/56"), got)
+	})
+}
+
+func TestDHCPInterfaceV6_routerAdvertisement(t *testing.T) {
+	srv := newTestV6Server(t)
+	iface := srv.interfaces6[0]
+
+	dns := netip.MustParseAddr("2001:db8::1")
+	data, err := iface.routerAdvertisement(testMAC6, 1500, dns)
+	require.NoError(t, err)
+
+	pkt := gopacket.NewPacket(data, layers.LayerTypeICMPv6, gopacket.Default)
+	ra, ok := pkt.Layer(layers.LayerTypeICMPv6RouterAdvertisement).(*layers.ICMPv6RouterAdvertisement)
+	require.True(t, ok)
+
+	assert.True(t, ra.ManagedAddressConfig())
+	assert.True(t, ra.OtherConfig())
+	require.Len(t, ra.Options, 4)
+
+	prefixInfo := ra.Options[0]
+	assert.Equal(t, layers.ICMPv6OptPrefixInfo, prefixInfo.Type)
+	assert.Equal(t, byte(64), prefixInfo.Data[0])
+	assert.Equal(t, netip.MustParseAddr("2001:db8::").AsSlice(), prefixInfo.Data[14:30])
+
+	assert.Equal(t, layers.ICMPv6OptMTU, ra.Options[1].Type)
+	assert.Equal(t, uint32(1500), binary.BigEndian.Uint32(ra.Options[1].Data[2:]))
+
+	assert.Equal(t, layers.ICMPv6OptSourceAddress, ra.Options[2].Type)
+	assert.Equal(t, []byte(testMAC6), ra.Options[2].Data[:6])
+
+	assert.Equal(t, icmpv6OptRDNSS, ra.Options[3].Type)
+	assert.Equal(t, dns.AsSlice(), ra.Options[3].Data[6:22])
+
+	iface.raSLAACOnly = true
+	data, err = iface.routerAdvertisement(testMAC6, 1500, netip.Addr{})
+	require.NoError(t, err)
+
+	pkt = gopacket.NewPacket(data, layers.LayerTypeICMPv6, gopacket.Default)
+	ra, ok = pkt.Layer(layers.LayerTypeICMPv6RouterAdvertisement).(*layers.ICMPv6RouterAdvertisement)
+	require.True(t, ok)
+
+	assert.False(t, ra.ManagedAddressConfig())
+	assert.Len(t, ra.Options, 3)
+}
+
+func TestDHCPServer_serveUDP6(t *testing.T) {
+	srv := newTestV6Server(t)
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("ipv6 loopback is unavailable: %s", err)
+	}
+	testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+	go srv.serveUDP6(ctx, conn)
+
+	client, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, client.Close)
+
+	buf := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, &layers.DHCPv6{
+		MsgType:       layers.DHCPv6MsgTypeSolicit,
+		TransactionID: []byte{0x01, 0x02, 0x03},
+		Options: layers.DHCPv6Options{
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientID, newDUIDLL(testMAC6)),
+			newTestIAOption6(layers.DHCPv6OptIANA, 1, netip.Prefix{}),
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = client.WriteTo(buf.Bytes(), conn.LocalAddr())
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+
+	respBuf := make([]byte, 1500)
+	n, from, err := client.ReadFrom(respBuf)
+	require.NoError(t, err)
+
+	assert.Equal(t, conn.LocalAddr().String(), from.String())
+
+	pkt := gopacket.NewPacket(respBuf[:n], layers.LayerTypeDHCPv6, gopacket.Default)
+	resp, ok := pkt.Layer(layers.LayerTypeDHCPv6).(*layers.DHCPv6)
+	require.True(t, ok)
+
+	assert.Equal(t, layers.DHCPv6MsgTypeAdverstise, resp.MsgType)
+	assert.Equal(t, []byte{0x01, 0x02, 0x03}, resp.TransactionID)
+	assert.Equal(t, netip.PrefixFrom(testRangeStart6, 128), leasedPrefix(t, resp, layers.DHCPv6OptIANA))
+}
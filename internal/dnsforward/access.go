@@ -7,6 +7,7 @@ import (
 	"net/netip"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
@@ -112,6 +113,11 @@ func (a *accessManager) allowlistMode() (ok bool) {
 	return a.allowedIPs.Len() != 0 || a.allowedClientIDs.Len() != 0 || len(a.allowedNets) != 0
 }
 
+// hasClientID returns true if the ClientID is in the allowlist or the blocklist.
+func (a *accessManager) hasClientID(id string) (ok bool) {
+	return a.allowedClientIDs.Has(id) || a.blockedClientIDs.Has(id)
+}
+
 // isBlockedClientID returns true if the ClientID should be blocked.
 func (a *accessManager) isBlockedClientID(id string) (ok bool) {
 	allowlistMode := a.allowlistMode()
@@ -172,16 +178,33 @@ type accessListJSON struct {
 	AllowedClients    []string `json:"allowed_clients"`
 	DisallowedClients []string `json:"disallowed_clients"`
 	BlockedHosts      []string `json:"blocked_hosts"`
+
+	// Bans are the active temporary bans.  They are ignored when the access
+	// list is set.
+	Bans []*Ban `json:"bans"`
 }
 
 func (s *Server) accessListJSON() (j accessListJSON) {
 	s.serverLock.RLock()
 	defer s.serverLock.RUnlock()
 
+	now := time.Now()
+	bans := s.clientIDGuard.Bans(now)
+	if s.conf.AuthBans != nil {
+		bans = append(bans, s.conf.AuthBans.Bans(now)...)
+	}
+
+	if bans == nil {
+		bans = []*Ban{}
+	}
+
+	sortBans(bans)
+
 	return accessListJSON{
 		AllowedClients:    slices.Clone(s.conf.AllowedClients),
 		DisallowedClients: slices.Clone(s.conf.DisallowedClients),
 		BlockedHosts:      slices.Clone(s.conf.BlockedHosts),
+		Bans:              bans,
 	}
 }
 
@@ -3,6 +3,7 @@ package dnsforward
 import (
 	"encoding/binary"
 	"fmt"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -31,11 +32,41 @@ func (s *Server) HandleBefore(
 		}
 	}
 
-	blocked, _ := s.IsBlockedClient(pctx.Addr.Addr(), clientID)
+	cliIP := pctx.Addr.Addr()
+	now := time.Now()
+	if s.clientIDGuard.banned(cliIP, now) {
+		log.Debug("access: client %s is banned for guessing clientids", cliIP)
+
+		return s.preBlockedResponse(pctx)
+	}
+
+	blocked, _ := s.IsBlockedClient(cliIP, clientID)
 	if blocked {
 		return s.preBlockedResponse(pctx)
 	}
 
+	persistent := clientID != "" && s.conf.ClientsContainer.HasClientID(clientID)
+	if clientID != "" &&
+		!persistent &&
+		!s.access.hasClientID(clientID) &&
+		s.clientIDGuard.fail(cliIP, clientID, now) {
+		log.Info("access: banning client %s for using too many unknown clientids", cliIP)
+
+		return s.preBlockedResponse(pctx)
+	}
+
+	if s.refusedByHardening(pctx, persistent) {
+		log.Debug("access: %s request from %s refused by public hardening", pctx.Proto, cliIP)
+
+		return s.preBlockedResponse(pctx)
+	}
+
+	if persistent && !s.quotas.consume(clientID, now) {
+		log.Debug("access: clientid %q has exceeded its quota", clientID)
+
+		return s.preBlockedResponse(pctx)
+	}
+
 	if len(pctx.Req.Question) == 1 {
 		q := pctx.Req.Question[0]
 		qt := q.Qtype
@@ -3,10 +3,12 @@ package dnsforward
 import (
 	"crypto/tls"
 	"net"
+	"net/netip"
 	"testing"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/miekg/dns"
@@ -164,6 +166,81 @@ func TestServer_HandleBefore_tls(t *testing.T) {
 	}
 }
 
+func TestServer_HandleBefore_clientIDGuessing(t *testing.T) {
+	t.Parallel()
+
+	const knownClientID = "known"
+
+	s, _ := createTestTLS(t, &TLSConfig{
+		TLSListenAddrs: []*net.TCPAddr{{}},
+		ServerName:     tlsServerName,
+	})
+
+	s.conf.UpstreamDNS = []string{aghtest.StartLocalhostUpstream(t, dns.HandlerFunc(
+		func(w dns.ResponseWriter, req *dns.Msg) {
+			require.NoError(t, w.WriteMsg((&dns.Msg{}).SetReply(req)))
+		},
+	)).String()}
+
+	s.conf.UnknownClientIDLimit = 2
+	s.conf.ClientsContainer = &clientsContainer{
+		OnCustomUpstreamConfig: func(
+			_ string,
+			_ netip.Addr,
+		) (conf *proxy.CustomUpstreamConfig) {
+			return nil
+		},
+		OnUpdateCommonUpstreamConfig: func(_ *client.CommonUpstreamConfig) {},
+		OnClearUpstreamCache:         func() {},
+		OnMarkActive:                 func(_ netip.Addr) {},
+		OnHasClientID: func(clientID string) (ok bool) {
+			return clientID == knownClientID
+		},
+	}
+
+	err := s.Prepare(&s.conf)
+	require.NoError(t, err)
+
+	startDeferStop(t, s)
+
+	addr := s.dnsProxy.Addr(proxy.ProtoTLS).String()
+	exchange := func(t *testing.T, clientID string) (rcode int) {
+		t.Helper()
+
+		c := &dns.Client{
+			Net: "tcp-tls",
+			TLSConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				ServerName:         clientID + "." + tlsServerName,
+			},
+			Timeout: dnsClientTimeout,
+		}
+
+		reply, _, exErr := c.Exchange(createTestMessage(testFQDN), addr)
+		require.NoError(t, exErr)
+
+		return reply.Rcode
+	}
+
+	assert.Equal(t, dns.RcodeSuccess, exchange(t, "unknown-1"))
+	assert.Equal(t, dns.RcodeSuccess, exchange(t, "unknown-1"))
+	assert.Equal(t, dns.RcodeSuccess, exchange(t, knownClientID))
+	assert.Equal(t, dns.RcodeRefused, exchange(t, "unknown-2"))
+	assert.Equal(t, dns.RcodeRefused, exchange(t, knownClientID))
+
+	bans := s.accessListJSON().Bans
+	require.Len(t, bans, 1)
+
+	assert.Equal(t, BanReasonClientID, bans[0].Reason)
+
+	// The IPv6 addresses are banned by networks.
+	if subnet := bans[0].Subnet; subnet != nil {
+		assert.True(t, subnet.Contains(netip.IPv6Loopback()))
+	} else {
+		assert.True(t, bans[0].IP.IsLoopback())
+	}
+}
+
 func TestServer_HandleBefore_udp(t *testing.T) {
 	t.Parallel()
 
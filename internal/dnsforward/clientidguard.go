@@ -0,0 +1,291 @@
+package dnsforward
+
+import (
+	"container/list"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/container"
+)
+
+// BanReason is the reason why an IP address has been temporarily banned.
+type BanReason string
+
+// Valid ban reasons.
+const (
+	// BanReasonClientID means that the address has used too many unknown
+	// ClientIDs.
+	BanReasonClientID BanReason = "clientid_guessing"
+
+	// BanReasonWebAuth means that the address has failed the web
+	// authentication too many times.
+	BanReasonWebAuth BanReason = "web_auth"
+)
+
+// Ban is a temporary ban of an IP address.
+type Ban struct {
+	// Until is the moment when the ban expires.
+	Until time.Time `json:"until"`
+
+	// Subnet is the banned network, if the ban covers a network rather than a
+	// single address.  IP is the first address of the network then.
+	Subnet *netip.Prefix `json:"subnet,omitempty"`
+
+	// IP is the banned address.
+	IP netip.Addr `json:"ip"`
+
+	// Reason is the reason of the ban.
+	Reason BanReason `json:"reason"`
+}
+
+// BanSource is a source of temporary bans that are shown in the access list
+// HTTP API.
+type BanSource interface {
+	// Bans returns the bans active at now.  It must be safe for concurrent use.
+	Bans(now time.Time) (bans []*Ban)
+}
+
+const (
+	// defaultUnknownClientIDBanDur is the duration of the ban for the unknown
+	// ClientIDs used when the configured one is zero.
+	defaultUnknownClientIDBanDur = 1 * time.Hour
+
+	// defaultUnknownClientIDIPv6PrefixLen is the length of the IPv6 networks
+	// tracked by clientIDGuard used when the configured one is zero.
+	defaultUnknownClientIDIPv6PrefixLen = 64
+
+	// unknownClientIDWindow is the period of time within which the unknown
+	// ClientIDs used by an address are counted.
+	unknownClientIDWindow = 10 * time.Minute
+
+	// maxClientIDGuardIPs is the maximum number of addresses tracked by
+	// clientIDGuard.  When it's reached, the oldest entry is evicted to track
+	// a new address.
+	maxClientIDGuardIPs = 10_000
+)
+
+// clientIDAttempts is the information about the unknown ClientIDs used by an
+// address.
+type clientIDAttempts struct {
+	// ids are the distinct unknown ClientIDs used within the window.
+	ids *container.MapSet[string]
+
+	// elem is the element of [clientIDGuard.order] holding the key of the
+	// entry.
+	elem *list.Element
+
+	// start is the start of the current window.
+	start time.Time
+
+	// until is the moment when the ban expires.  It's zero if the address
+	// isn't banned.
+	until time.Time
+}
+
+// expired returns true if both the window and the ban of a are over at now.
+func (a *clientIDAttempts) expired(now time.Time) (ok bool) {
+	return now.Sub(a.start) >= unknownClientIDWindow && !now.Before(a.until)
+}
+
+// clientIDGuard tracks the unknown ClientIDs used by each client's address and
+// temporarily bans the addresses that use too many of them, since such
+// addresses are likely to guess the ClientIDs of private profiles.  The IPv6
+// addresses are tracked by their networks, since a single client usually owns
+// a whole one.  A clientIDGuard is safe for concurrent use.
+type clientIDGuard struct {
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// attempts are the tracked networks, see [clientIDGuard.key].
+	attempts map[netip.Prefix]*clientIDAttempts
+
+	// order contains the keys of attempts ordered by the start of their
+	// windows, the oldest first.
+	order *list.List
+
+	// lastSweep is the moment of the last removal of the expired entries.
+	lastSweep time.Time
+
+	// banDur is the duration of a ban.
+	banDur time.Duration
+
+	// limit is the number of distinct unknown ClientIDs after which an
+	// address is banned.  Zero disables the guard.
+	limit uint
+
+	// ipv6PrefixLen is the length of the tracked IPv6 networks.
+	ipv6PrefixLen int
+}
+
+// newClientIDGuard returns a new properly initialized *clientIDGuard, which is
+// disabled until [clientIDGuard.setLimits] is called.
+func newClientIDGuard() (g *clientIDGuard) {
+	return &clientIDGuard{
+		mu:            &sync.Mutex{},
+		attempts:      map[netip.Prefix]*clientIDAttempts{},
+		order:         list.New(),
+		ipv6PrefixLen: defaultUnknownClientIDIPv6PrefixLen,
+	}
+}
+
+// setLimits sets the number of distinct unknown ClientIDs that an address may
+// use, the duration of a ban, and the length of the tracked IPv6 networks,
+// which must not be greater than 128.  limit of zero disables the guard and
+// removes all bans, as does changing the length.
+func (g *clientIDGuard) setLimits(limit uint, banDur time.Duration, ipv6PrefixLen uint) {
+	if banDur <= 0 {
+		banDur = defaultUnknownClientIDBanDur
+	}
+
+	if ipv6PrefixLen == 0 {
+		ipv6PrefixLen = defaultUnknownClientIDIPv6PrefixLen
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if limit == 0 || int(ipv6PrefixLen) != g.ipv6PrefixLen {
+		clear(g.attempts)
+		g.order.Init()
+	}
+
+	g.limit, g.banDur, g.ipv6PrefixLen = limit, banDur, int(ipv6PrefixLen)
+}
+
+// key returns the key of the network ip belongs to.  g.mu must be locked.
+func (g *clientIDGuard) key(ip netip.Addr) (k netip.Prefix) {
+	ip = ip.Unmap().WithZone("")
+	if ip.Is4() {
+		return netip.PrefixFrom(ip, ip.BitLen())
+	}
+
+	return netip.PrefixFrom(ip, g.ipv6PrefixLen).Masked()
+}
+
+// banned returns true if ip is banned at now.
+func (g *clientIDGuard) banned(ip netip.Addr, now time.Time) (ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a := g.attempts[g.key(ip)]
+
+	return a != nil && now.Before(a.until)
+}
+
+// fail records that ip has used the unknown id at now.  banned is true if ip is
+// banned as a result.
+func (g *clientIDGuard) fail(ip netip.Addr, id string, now time.Time) (banned bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.limit == 0 {
+		return false
+	}
+
+	g.sweepLocked(now)
+
+	k := g.key(ip)
+	a := g.attempts[k]
+	switch {
+	case a == nil:
+		if len(g.attempts) >= maxClientIDGuardIPs {
+			g.evictOldestLocked()
+		}
+
+		a = &clientIDAttempts{
+			ids:   container.NewMapSet[string](),
+			elem:  g.order.PushBack(k),
+			start: now,
+		}
+		g.attempts[k] = a
+	case a.expired(now):
+		a.ids.Clear()
+		a.start, a.until = now, time.Time{}
+		g.order.MoveToBack(a.elem)
+	case now.Before(a.until):
+		return true
+	default:
+		// Go on.
+	}
+
+	a.ids.Add(id)
+	if uint(a.ids.Len()) < g.limit {
+		return false
+	}
+
+	a.until = now.Add(g.banDur)
+	a.ids.Clear()
+
+	return true
+}
+
+// evictOldestLocked removes the entry with the oldest window.  g.mu must be
+// locked.
+func (g *clientIDGuard) evictOldestLocked() {
+	e := g.order.Front()
+	if e == nil {
+		return
+	}
+
+	delete(g.attempts, g.order.Remove(e).(netip.Prefix))
+}
+
+// sweepLocked removes the expired entries if the last sweep was at least a
+// window ago, so that the entries are swept once per window at most.  g.mu must
+// be locked.
+func (g *clientIDGuard) sweepLocked(now time.Time) {
+	if now.Sub(g.lastSweep) < unknownClientIDWindow {
+		return
+	}
+
+	g.lastSweep = now
+	for k, a := range g.attempts {
+		if a.expired(now) {
+			g.order.Remove(a.elem)
+			delete(g.attempts, k)
+		}
+	}
+}
+
+// type check
+var _ BanSource = (*clientIDGuard)(nil)
+
+// Bans implements the [BanSource] interface for *clientIDGuard.
+func (g *clientIDGuard) Bans(now time.Time) (bans []*Ban) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for k, a := range g.attempts {
+		if !now.Before(a.until) {
+			continue
+		}
+
+		b := &Ban{
+			Until:  a.until,
+			IP:     k.Addr(),
+			Reason: BanReasonClientID,
+		}
+
+		if !k.IsSingleIP() {
+			b.Subnet = &k
+		}
+
+		bans = append(bans, b)
+	}
+
+	return bans
+}
+
+// sortBans sorts bans by the address and then by the reason.
+func sortBans(bans []*Ban) {
+	slices.SortFunc(bans, func(a, b *Ban) (res int) {
+		if res = a.IP.Compare(b.IP); res != 0 {
+			return res
+		}
+
+		return strings.Compare(string(a.Reason), string(b.Reason))
+	})
+}
@@ -0,0 +1,156 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIDGuard(t *testing.T) {
+	t.Parallel()
+
+	const banDur = time.Hour
+
+	ip := netip.MustParseAddr("192.0.2.1")
+	otherIP := netip.MustParseAddr("192.0.2.2")
+	now := time.Now()
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		g := newClientIDGuard()
+		for _, id := range []string{"a", "b", "c"} {
+			assert.False(t, g.fail(ip, id, now))
+		}
+
+		assert.False(t, g.banned(ip, now))
+		assert.Empty(t, g.Bans(now))
+	})
+
+	t.Run("ban", func(t *testing.T) {
+		t.Parallel()
+
+		g := newClientIDGuard()
+		g.setLimits(2, banDur, 0)
+
+		assert.False(t, g.fail(ip, "a", now))
+		assert.False(t, g.fail(ip, "a", now))
+		assert.False(t, g.fail(otherIP, "b", now))
+		assert.True(t, g.fail(ip, "b", now))
+
+		assert.True(t, g.banned(ip, now))
+		assert.False(t, g.banned(otherIP, now))
+
+		bans := g.Bans(now)
+		require.Len(t, bans, 1)
+
+		assert.Equal(t, &Ban{
+			Until:  now.Add(banDur),
+			IP:     ip,
+			Reason: BanReasonClientID,
+		}, bans[0])
+
+		later := now.Add(banDur)
+		assert.False(t, g.banned(ip, later))
+		assert.Empty(t, g.Bans(later))
+	})
+
+	t.Run("window", func(t *testing.T) {
+		t.Parallel()
+
+		g := newClientIDGuard()
+		g.setLimits(2, banDur, 0)
+
+		assert.False(t, g.fail(ip, "a", now))
+		assert.False(t, g.fail(ip, "b", now.Add(unknownClientIDWindow)))
+		assert.False(t, g.banned(ip, now.Add(unknownClientIDWindow)))
+	})
+	t.Run("ipv6_network", func(t *testing.T) {
+		t.Parallel()
+
+		g := newClientIDGuard()
+		g.setLimits(2, banDur, 0)
+
+		ip6 := netip.MustParseAddr("2001:db8::1")
+		sameNet := netip.MustParseAddr("2001:db8::ffff")
+		otherNet := netip.MustParseAddr("2001:db8:0:1::1")
+
+		assert.False(t, g.fail(ip6, "a", now))
+		assert.True(t, g.fail(sameNet, "b", now))
+
+		assert.True(t, g.banned(ip6, now))
+		assert.False(t, g.banned(otherNet, now))
+
+		bans := g.Bans(now)
+		require.Len(t, bans, 1)
+
+		subnet := netip.MustParsePrefix("2001:db8::/64")
+		assert.Equal(t, &Ban{
+			Until:  now.Add(banDur),
+			Subnet: &subnet,
+			IP:     subnet.Addr(),
+			Reason: BanReasonClientID,
+		}, bans[0])
+
+		// Changing the length of the networks removes the bans.
+		g.setLimits(2, banDur, 128)
+		assert.False(t, g.banned(ip6, now))
+
+		assert.False(t, g.fail(ip6, "a", now))
+		assert.False(t, g.fail(sameNet, "b", now))
+		assert.Empty(t, g.Bans(now))
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		t.Parallel()
+
+		g := newClientIDGuard()
+		g.setLimits(2, banDur, 0)
+
+		first := netip.MustParseAddr("198.51.100.1")
+		assert.False(t, g.fail(first, "a", now))
+
+		addr := netip.MustParseAddr("10.0.0.0")
+		for range maxClientIDGuardIPs - 1 {
+			addr = addr.Next()
+			assert.False(t, g.fail(addr, "a", now))
+		}
+
+		require.Len(t, g.attempts, maxClientIDGuardIPs)
+
+		// The new address is tracked and the oldest one is evicted.
+		last := netip.MustParseAddr("198.51.100.2")
+		assert.False(t, g.fail(last, "a", now))
+		assert.True(t, g.fail(last, "b", now))
+
+		assert.Len(t, g.attempts, maxClientIDGuardIPs)
+		assert.NotContains(t, g.attempts, netip.PrefixFrom(first, 32))
+		assert.Equal(t, g.order.Len(), len(g.attempts))
+	})
+
+	t.Run("sweep", func(t *testing.T) {
+		t.Parallel()
+
+		g := newClientIDGuard()
+		g.setLimits(2, banDur, 0)
+
+		const w = unknownClientIDWindow
+
+		assert.False(t, g.fail(ip, "a", now))
+		assert.False(t, g.fail(otherIP, "a", now.Add(w/2)))
+
+		assert.False(t, g.fail(netip.MustParseAddr("192.0.2.3"), "a", now.Add(w)))
+		assert.Len(t, g.attempts, 2)
+
+		// The expired entries are only swept once per window.
+		assert.False(t, g.fail(netip.MustParseAddr("192.0.2.4"), "a", now.Add(w+w/2)))
+		assert.Len(t, g.attempts, 3)
+
+		assert.False(t, g.fail(netip.MustParseAddr("192.0.2.5"), "a", now.Add(2*w)))
+		assert.Len(t, g.attempts, 2)
+		assert.Equal(t, 2, g.order.Len())
+	})
+}
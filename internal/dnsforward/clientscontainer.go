@@ -20,6 +20,14 @@ type ClientsContainer interface {
 	// ClearUpstreamCache clears the upstream cache for each stored custom
 	// client upstream configuration.
 	ClearUpstreamCache()
+
+	// MarkActive records the DNS activity of the client with cliAddr.  It must
+	// be safe for concurrent use and must not block for long.
+	MarkActive(cliAddr netip.Addr)
+
+	// HasClientID returns true if a persistent client has the ClientID.  It
+	// must be safe for concurrent use.
+	HasClientID(clientID string) (ok bool)
 }
 
 // EmptyClientsContainer is an [ClientsContainer] implementation that does nothing.
@@ -44,3 +52,11 @@ func (EmptyClientsContainer) UpdateCommonUpstreamConfig(conf *client.CommonUpstr
 // ClearUpstreamCache implements the [ClientsContainer] interface for
 // EmptyClientsContainer.
 func (EmptyClientsContainer) ClearUpstreamCache() {}
+
+// MarkActive implements the [ClientsContainer] interface for
+// EmptyClientsContainer.
+func (EmptyClientsContainer) MarkActive(_ netip.Addr) {}
+
+// HasClientID implements the [ClientsContainer] interface for
+// EmptyClientsContainer.  It always returns false.
+func (EmptyClientsContainer) HasClientID(_ string) (ok bool) { return false }
@@ -107,6 +107,24 @@ type Config struct {
 	// empty slice for this field makes Proxy not trust any address.
 	TrustedProxies []netutil.Prefix `yaml:"trusted_proxies"`
 
+	// UnknownClientIDLimit is the number of distinct unknown ClientIDs that a
+	// single IP address may use within ten minutes before it's temporarily
+	// banned.  Zero disables the check.
+	UnknownClientIDLimit uint `yaml:"unknown_clientid_limit"`
+
+	// UnknownClientIDBanDuration is the duration of the ban for using too many
+	// unknown ClientIDs.  Zero means one hour.
+	UnknownClientIDBanDuration timeutil.Duration `yaml:"unknown_clientid_ban_duration"`
+
+	// UnknownClientIDIPv6PrefixLen is the length of the IPv6 networks, which
+	// are counted and banned as a single address for using too many unknown
+	// ClientIDs.  It must not be greater than 128, zero means 64.
+	UnknownClientIDIPv6PrefixLen uint `yaml:"unknown_clientid_ipv6_prefix_len"`
+
+	// PublicHardening is the configuration of the mode for the servers exposed
+	// to the Internet.  If nil, the mode is disabled.
+	PublicHardening *PublicHardeningConfig `yaml:"public_hardening"`
+
 	// DNS cache settings
 
 	// CacheSize is the DNS cache size (in bytes).
@@ -256,6 +274,10 @@ type ServerConfig struct {
 	// Called when the configuration is changed by HTTP request
 	ConfigModified func()
 
+	// AuthBans, if not nil, are the additional bans shown in the access list
+	// HTTP API, for example the ones of the web authentication.
+	AuthBans BanSource
+
 	// Register an HTTP handler
 	HTTPRegister aghhttp.RegisterFunc
 
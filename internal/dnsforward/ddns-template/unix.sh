@@ -13,6 +13,7 @@ NC='\033[0m' # No Color
 
 # Configuration - modify before running
 base_url="{{server_name}}" # Example: http://localhost:34020 or https://dns.example.com
+token="{{token}}"          # API token with the rewrite:read and rewrite:write scopes, e.g.: "agh_0123abcd"
 username="{{username}}"    # Null Private username
 password="{{password}}"    # Null Private password
 domain="{{domain}}"        # Domain to update, e.g.: nas.example.com
@@ -22,9 +23,11 @@ cookies="{{cookies}}"      # Cookie string for authentication, e.g.: "agh_sessio
 enable_ipv4="true" # Enable IPv4 DDNS updates
 enable_ipv6="true" # Enable IPv6 DDNS updates
 
+# It is recommended to use an API token created in the settings with the
+# rewrite:read and rewrite:write scopes.
+#
 # WARNING: Cookies may expire over time, which could cause authentication failures.
-# It is recommended to use username/password authentication whenever possible.
-# Only use cookies if username/password authentication is not available.
+# Cookies are deprecated and are only supported for compatibility.
 
 # Display usage information
 show_usage() {
@@ -34,18 +37,24 @@ show_usage() {
     echo -e "  ${YELLOW}domain${NC}    - Domain to update (e.g., nas.example.com)"
     echo -e ""
     echo -e "  For authentication, use one of the following methods:"
-    echo -e "  1. Username/Password (recommended):"
+    echo -e "  1. API token (recommended):"
+    echo -e "     ${YELLOW}token${NC}    - API token with the rewrite:read and rewrite:write scopes"
+    echo -e ""
+    echo -e "  2. Username/Password:"
     echo -e "     ${YELLOW}username${NC} - Null Private username"
     echo -e "     ${YELLOW}password${NC} - Null Private password"
     echo -e ""
-    echo -e "  2. Cookies (alternative, may expire):"
+    echo -e "  3. Cookies (deprecated, may expire):"
     echo -e "     ${YELLOW}cookies${NC}  - Cookie string (e.g., \"agh_session=abc123\")"
     echo -e ""
     echo -e "  Example configuration:"
     echo -e "    base_url=\"https://{xxxxxxxxxxxxxxxx}.nullprivate.com\""
+    echo -e "    token=\"agh_0123abcd\""
+    echo -e "    domain=\"nas.example.com\""
+    echo -e ""
+    echo -e "    # OR using username/password instead of the token:"
     echo -e "    username=\"admin\""
     echo -e "    password=\"password123\""
-    echo -e "    domain=\"nas.example.com\""
     echo -e ""
     echo -e "    # OR using cookies instead of username/password:"
     echo -e "    cookies=\"agh_session=abc123\""
@@ -123,7 +132,9 @@ get_current_ip() {
 
 # Generate auth header
 get_auth_header() {
-    if [ -n "$username" ] && [ -n "$password" ]; then
+    if [ -n "$token" ]; then
+        echo "Authorization: Bearer $token"
+    elif [ -n "$username" ] && [ -n "$password" ]; then
         auth_base64=$(echo -n "$username:$password" | base64)
         echo "Authorization: Basic $auth_base64"
     elif [ -n "$cookies" ]; then
@@ -495,9 +506,9 @@ check_params() {
     fi
 
     # Check authentication
-    if [ -z "$username" ] || [ -z "$password" ]; then
+    if [ -z "$token" ] && { [ -z "$username" ] || [ -z "$password" ]; }; then
         if [ -z "$cookies" ]; then
-            echo -e "${RED}Error: Authentication is required (either username/password or cookies)${NC}"
+            echo -e "${RED}Error: Authentication is required (either token, username/password, or cookies)${NC}"
             missing=1
         fi
     fi
@@ -511,13 +522,13 @@ check_params() {
 
 # Check authentication method
 check_auth() {
-    if [ -z "$username" ] || [ -z "$password" ]; then
+    if [ -z "$token" ] && { [ -z "$username" ] || [ -z "$password" ]; }; then
         if [ -z "$cookies" ]; then
             echo -e "${RED}Error: No authentication method available.${NC}"
-            echo -e "${RED}Please provide either username/password or cookies.${NC}"
+            echo -e "${RED}Please provide either token, username/password, or cookies.${NC}"
             show_usage
         else
-            echo -e "${YELLOW}Warning: Using cookies for authentication. Username/password is recommended as cookies may expire.${NC}"
+            echo -e "${YELLOW}Warning: Using deprecated cookies for authentication. An API token is recommended as cookies may expire.${NC}"
         fi
     fi
 }
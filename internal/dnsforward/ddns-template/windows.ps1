@@ -4,6 +4,7 @@
 
 # Configuration - modify before running
 $base_url = "{{server_name}}"  # Example: http://localhost:34020 or https://dns.example.com
+$token = "{{token}}"            # API token with the rewrite:read and rewrite:write scopes, e.g.: "agh_0123abcd"
 $username = "{{username}}"      # Null Private username
 $password = "{{password}}"      # Null Private password
 $domain = "{{domain}}"          # Domain to update, e.g.: nas.example.com
@@ -28,18 +29,24 @@ function Show-Usage {
     Write-Host "  domain    - Domain to update (e.g., nas.example.com)" -ForegroundColor Yellow
     Write-Host ""
     Write-Host "  For authentication, use one of the following methods:"
-    Write-Host "  1. Username/Password (recommended):"
+    Write-Host "  1. API token (recommended):"
+    Write-Host "     token    - API token with the rewrite:read and rewrite:write scopes" -ForegroundColor Yellow
+    Write-Host ""
+    Write-Host "  2. Username/Password:"
     Write-Host "     username - Null Private username" -ForegroundColor Yellow
     Write-Host "     password - Null Private password" -ForegroundColor Yellow
     Write-Host ""
-    Write-Host "  2. Cookies (alternative, may expire):"
+    Write-Host "  3. Cookies (deprecated, may expire):"
     Write-Host "     cookies  - Cookie string (e.g., 'agh_session=abc123')" -ForegroundColor Yellow
     Write-Host ""
     Write-Host "  Example configuration:"
     Write-Host "    `$base_url = 'https://{xxxxxxxxxxxxxxxx}.nullprivate.com'"
+    Write-Host "    `$token = 'agh_0123abcd'"
+    Write-Host "    `$domain = 'nas.example.com'"
+    Write-Host ""
+    Write-Host "    # OR using username/password instead of the token:"
     Write-Host "    `$username = 'admin'"
     Write-Host "    `$password = 'password123'"
-    Write-Host "    `$domain = 'nas.example.com'"
     Write-Host ""
     Write-Host "    # OR using cookies instead of username/password:"
     Write-Host "    `$cookies = 'agh_session=abc123'"
@@ -65,10 +72,11 @@ function Check-Params {
     }
 
     # Check authentication
-    if ([string]::IsNullOrEmpty($username) -and 
+    if ([string]::IsNullOrEmpty($token) -and
+        [string]::IsNullOrEmpty($username) -and 
         [string]::IsNullOrEmpty($password) -and 
         [string]::IsNullOrEmpty($cookies)) {
-        Write-Host "Error: Authentication is required (either username/password or cookies)" -ForegroundColor Red
+        Write-Host "Error: Authentication is required (either token, username/password, or cookies)" -ForegroundColor Red
         $missing = $true
     }
 
@@ -133,7 +141,12 @@ function Get-CurrentIP {
 
 # Generate authorization header
 function Get-AuthorizationHeader {
-    if ($username -and $password) {
+    if ($token) {
+        $headers = @{
+            "Authorization" = "Bearer $token"
+        }
+    }
+    elseif ($username -and $password) {
         $pair = "$($username):$($password)"
         $bytes = [System.Text.Encoding]::ASCII.GetBytes($pair)
         $base64 = [System.Convert]::ToBase64String($bytes)
@@ -147,7 +160,7 @@ function Get-AuthorizationHeader {
         }
     }
     else {
-        Write-ColorOutput "Error: Please provide username/password or cookies for authentication." "Red"
+        Write-ColorOutput "Error: Please provide token, username/password, or cookies for authentication." "Red"
         exit 1
     }
     
@@ -43,6 +43,7 @@ type ddnsTemplateData struct {
 	Password   string
 	Domain     string
 	Cookies    string
+	Token      string
 }
 
 // Register DDNS script download handlers
@@ -90,6 +91,7 @@ func (s *Server) handleDDNSScript(
 		Password:   "", // User will fill in themselves
 		Domain:     domain,
 		Cookies:    cookies, // Add obtained cookie
+		Token:      "",      // User will fill in themselves
 	}
 
 	err := executeDDNSTemplate(w, r, templateFileName, downloadFileName, contentType, data)
@@ -168,6 +170,7 @@ func executeDDNSTemplate(
 		"password":    func() string { return data.Password },
 		"domain":      func() string { return data.Domain },
 		"cookies":     func() string { return data.Cookies },
+		"token":       func() string { return data.Token },
 	}
 
 	// Parse template using function map
@@ -20,6 +20,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/localzone"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/rdns"
 	"github.com/AdguardTeam/AdGuardHome/internal/ruleset"
@@ -27,6 +28,7 @@ import (
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/cache"
+	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
@@ -118,6 +120,10 @@ type Server struct {
 	// dhcpServer is the DHCP server for accessing lease data.
 	dhcpServer DHCP
 
+	// localZone is the authoritative zone of the local network.  It's nil if
+	// the zone is disabled.
+	localZone *localzone.Zone
+
 	// etcHosts contains the current data from the system's hosts files.
 	etcHosts upstream.Resolver
 
@@ -138,6 +144,14 @@ type Server struct {
 	// access drops disallowed clients.
 	access *accessManager
 
+	// clientIDGuard bans the clients that use too many unknown ClientIDs.  It
+	// must not be nil after initialization.
+	clientIDGuard *clientIDGuard
+
+	// quotas enforces the query quotas of the ClientIDs in the public
+	// hardening mode.  It must not be nil after initialization.
+	quotas *clientIDQuotas
+
 	// anonymizer masks the client's IP addresses if needed.
 	anonymizer *aghnet.IPMut
 
@@ -199,6 +213,10 @@ type Server struct {
 
 	// ruleset
 	ruleset *ruleset.Ruleset
+
+	// rulesetDomains are the FQDNs of the domain-specific upstreams added from
+	// the alternate upstream rulesets.  It is used to trace requests.
+	rulesetDomains *container.MapSet[string]
 }
 
 // defaultLocalDomainSuffix is the default suffix used to detect internal hosts
@@ -217,6 +235,9 @@ type DNSCreateParams struct {
 	Anonymizer  *aghnet.IPMut
 	EtcHosts    *aghnet.HostsContainer
 
+	// LocalZone is the authoritative zone of the local network, if any.
+	LocalZone *localzone.Zone
+
 	// Logger is used as a base logger.  It must not be nil.
 	Logger *slog.Logger
 
@@ -224,6 +245,10 @@ type DNSCreateParams struct {
 
 	// ruleset configuration.
 	Ruleset *ruleset.Ruleset
+
+	// QuotasFilePath is the path to the file the counters of the ClientID
+	// quotas are saved to.  If empty, the counters are only kept in memory.
+	QuotasFilePath string
 }
 
 // NewServer creates a new instance of the dnsforward.Server
@@ -256,6 +281,7 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 	s = &Server{
 		dnsFilter:   p.DNSFilter,
 		dhcpServer:  p.DHCPServer,
+		localZone:   p.LocalZone,
 		stats:       p.Stats,
 		queryLog:    p.QueryLog,
 		privateNets: p.PrivateNets,
@@ -267,13 +293,23 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 			EnableLRU: true,
 			MaxCount:  defaultClientIDCacheCount,
 		}),
-		anonymizer: p.Anonymizer,
+		anonymizer:    p.Anonymizer,
+		clientIDGuard: newClientIDGuard(),
+		quotas:        newClientIDQuotas(p.QuotasFilePath),
 		conf: ServerConfig{
 			ServePlainDNS: true,
 		},
 		ruleset: p.Ruleset,
 	}
 
+	err = s.quotas.load()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	s.quotas.start()
+
 	s.sysResolvers, err = sysresolv.NewSystemResolvers(nil, defaultPlainDNSPort)
 	if err != nil {
 		return nil, fmt.Errorf("initializing system resolvers: %w", err)
@@ -305,6 +341,10 @@ func (s *Server) Close() {
 	if err := s.ipset.close(); err != nil {
 		log.Error("dnsforward: closing ipset: %s", err)
 	}
+
+	if err := s.quotas.close(); err != nil {
+		log.Error("dnsforward: saving quotas: %s", err)
+	}
 }
 
 // WriteDiskConfig - write configuration
@@ -528,6 +568,22 @@ func (s *Server) Prepare(conf *ServerConfig) (err error) {
 		return fmt.Errorf("preparing access: %w", err)
 	}
 
+	if l := s.conf.UnknownClientIDIPv6PrefixLen; l > netutil.IPv6BitLen {
+		return fmt.Errorf("unknown_clientid_ipv6_prefix_len: %d is greater than %d", l, netutil.IPv6BitLen)
+	}
+
+	s.clientIDGuard.setLimits(
+		s.conf.UnknownClientIDLimit,
+		time.Duration(s.conf.UnknownClientIDBanDuration),
+		s.conf.UnknownClientIDIPv6PrefixLen,
+	)
+
+	if h := s.conf.PublicHardening; h != nil && h.Enabled {
+		s.quotas.setLimits(h.DailyQuota, h.MonthlyQuota)
+	} else {
+		s.quotas.setLimits(0, 0)
+	}
+
 	proxyConfig.Fallbacks, err = s.setupFallbackDNS()
 	if err != nil {
 		return fmt.Errorf("setting up fallback dns servers: %w", err)
@@ -697,6 +753,7 @@ func (s *Server) prepareUpstreamSettings(boot upstream.Resolver) (err error) {
 	})
 
 	// Process alternate DNS settings if configured
+	s.rulesetDomains = container.NewMapSet[string]()
 	err = s.configureAlternateUpstreams(boot)
 	if err != nil {
 		return err
@@ -754,7 +811,9 @@ func (s *Server) mergeAlternateUpstreams(altUC *proxy.UpstreamConfig) {
 	// Merge the alternate upstreams into the main config
 	for domain, upstreams := range altUC.DomainReservedUpstreams {
 		// append "." to domain to make it a FQDN
-		s.conf.UpstreamConfig.DomainReservedUpstreams[dns.Fqdn(domain)] = upstreams
+		fqdn := dns.Fqdn(domain)
+		s.conf.UpstreamConfig.DomainReservedUpstreams[fqdn] = upstreams
+		s.rulesetDomains.Add(fqdn)
 	}
 }
 
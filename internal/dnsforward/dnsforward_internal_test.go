@@ -76,6 +76,10 @@ type clientsContainer struct {
 	OnUpdateCommonUpstreamConfig func(conf *client.CommonUpstreamConfig)
 
 	OnClearUpstreamCache func()
+
+	OnMarkActive func(cliAddr netip.Addr)
+
+	OnHasClientID func(clientID string) (ok bool)
 }
 
 // CustomUpstreamConfig implements the [ClientsContainer] interface for
@@ -99,6 +103,18 @@ func (c *clientsContainer) ClearUpstreamCache() {
 	c.OnClearUpstreamCache()
 }
 
+// MarkActive implements the [ClientsContainer] interface for
+// *clientsContainer.
+func (c *clientsContainer) MarkActive(cliAddr netip.Addr) {
+	c.OnMarkActive(cliAddr)
+}
+
+// HasClientID implements the [ClientsContainer] interface for
+// *clientsContainer.
+func (c *clientsContainer) HasClientID(clientID string) (ok bool) {
+	return c.OnHasClientID(clientID)
+}
+
 func startDeferStop(t *testing.T, s *Server) {
 	t.Helper()
 
@@ -809,6 +825,7 @@ func TestServerCustomClientUpstream(t *testing.T) {
 		) (conf *proxy.CustomUpstreamConfig) {
 			return customUpsConf
 		},
+		OnMarkActive: func(_ netip.Addr) {},
 	}
 
 	startDeferStop(t, s)
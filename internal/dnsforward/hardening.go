@@ -0,0 +1,435 @@
+package dnsforward
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/v2/maybe"
+)
+
+// PublicHardeningConfig is the configuration of the mode for the servers
+// exposed to the Internet, for example as public DoH and DoT endpoints.
+type PublicHardeningConfig struct {
+	// DailyQuota is the maximum number of queries that a single ClientID may
+	// make within a calendar day.  Zero means no limit.
+	DailyQuota uint64 `yaml:"daily_quota"`
+
+	// MonthlyQuota is the maximum number of queries that a single ClientID may
+	// make within a calendar month.  Zero means no limit.
+	MonthlyQuota uint64 `yaml:"monthly_quota"`
+
+	// Enabled, if true, makes the server refuse the encrypted queries without
+	// a ClientID of a persistent client and the plain DNS queries from outside
+	// the private networks, as well as enforce the quotas.
+	Enabled bool `yaml:"enabled"`
+}
+
+// refusedByHardening returns true if the request in pctx must be refused in
+// the public hardening mode.  persistent is true if the request has a ClientID
+// of a persistent client.
+func (s *Server) refusedByHardening(pctx *proxy.DNSContext, persistent bool) (ok bool) {
+	h := s.conf.PublicHardening
+	if h == nil || !h.Enabled {
+		return false
+	}
+
+	switch pctx.Proto {
+	case proxy.ProtoUDP, proxy.ProtoTCP:
+		return !s.privateNets.Contains(pctx.Addr.Addr())
+	default:
+		// DNSCrypt can't carry a ClientID, so it's refused as well.
+		return !persistent
+	}
+}
+
+// quotaUsage is the number of queries made with a ClientID in the current day
+// and month.
+type quotaUsage struct {
+	// day is the start of the day of the daily counter.
+	day time.Time
+
+	// month is the start of the month of the monthly counter.
+	month time.Time
+
+	// daily is the number of queries made within day.
+	daily uint64
+
+	// monthly is the number of queries made within month.
+	monthly uint64
+
+	// refused is the number of queries refused within month because of the
+	// exceeded quota.
+	refused uint64
+}
+
+// reset resets the counters of u that belong to a period other than the one of
+// now.
+func (u *quotaUsage) reset(now time.Time) {
+	y, m, d := now.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	month := time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+
+	if !u.day.Equal(day) {
+		u.day, u.daily = day, 0
+	}
+
+	if !u.month.Equal(month) {
+		u.month, u.monthly, u.refused = month, 0, 0
+	}
+}
+
+// quotasStoreIvl is the interval between saving the counters of the quotas to
+// the file.
+const quotasStoreIvl = 1 * time.Minute
+
+// clientIDQuotas counts the queries made with each ClientID and enforces the
+// daily and monthly quotas.  The counters are saved to the file, if any, so
+// that restarting the server doesn't reset them.  A clientIDQuotas is safe for
+// concurrent use.
+type clientIDQuotas struct {
+	// mu protects all fields below.
+	mu *sync.Mutex
+
+	// usage are the counters for each ClientID.
+	usage map[string]*quotaUsage
+
+	// done is closed to stop saving the counters in the background.  It's nil
+	// if the counters aren't saved in the background.
+	done chan struct{}
+
+	// filePath is the path to the file with the counters.  If empty, the
+	// counters are only kept in memory.
+	filePath string
+
+	// daily is the daily quota.  Zero means no limit.
+	daily uint64
+
+	// monthly is the monthly quota.  Zero means no limit.
+	monthly uint64
+
+	// changed is true if the counters have changed since they've been saved.
+	changed bool
+}
+
+// newClientIDQuotas returns a new properly initialized *clientIDQuotas, which
+// doesn't limit anything until [clientIDQuotas.setLimits] is called.  filePath
+// is the path to the file with the counters, it may be empty.
+func newClientIDQuotas(filePath string) (q *clientIDQuotas) {
+	return &clientIDQuotas{
+		mu:       &sync.Mutex{},
+		usage:    map[string]*quotaUsage{},
+		filePath: filePath,
+	}
+}
+
+// quotasDataVersion is the current version of the quotas file format.
+const quotasDataVersion = 1
+
+// quotasData is the structure of the file with the counters of the quotas.
+type quotasData struct {
+	Clients []*quotaUsageData `json:"clients"`
+	Version int               `json:"version"`
+}
+
+// quotaUsageData is the stored counters of a ClientID along with the starts of
+// their periods.
+type quotaUsageData struct {
+	Day      time.Time `json:"day"`
+	Month    time.Time `json:"month"`
+	ClientID string    `json:"client_id"`
+	Daily    uint64    `json:"daily"`
+	Monthly  uint64    `json:"monthly"`
+	Refused  uint64    `json:"refused"`
+}
+
+// load reads the counters from the file, if there is one.
+func (q *clientIDQuotas) load() (err error) {
+	if q.filePath == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(q.filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("reading quotas: %w", err)
+	}
+
+	d := &quotasData{}
+	err = json.Unmarshal(b, d)
+	if err != nil {
+		return fmt.Errorf("decoding quotas: %w", err)
+	} else if d.Version != quotasDataVersion {
+		return fmt.Errorf("quotas: version: %w: %d", errors.ErrBadEnumValue, d.Version)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, c := range d.Clients {
+		q.usage[c.ClientID] = &quotaUsage{
+			day:     c.Day,
+			month:   c.Month,
+			daily:   c.Daily,
+			monthly: c.Monthly,
+			refused: c.Refused,
+		}
+	}
+
+	log.Debug("dnsforward: loaded quotas of %d clientids", len(d.Clients))
+
+	return nil
+}
+
+// start starts saving the counters to the file every [quotasStoreIvl] in a
+// separate goroutine.  It does nothing if there is no file.
+func (q *clientIDQuotas) start() {
+	if q.filePath == "" {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.done != nil {
+		return
+	}
+
+	q.done = make(chan struct{})
+
+	go q.storeLoop(q.done)
+}
+
+// storeLoop saves the counters to the file every [quotasStoreIvl] until done is
+// closed.  It's used to run in a separate goroutine.
+func (q *clientIDQuotas) storeLoop(done <-chan struct{}) {
+	defer log.OnPanic("dnsforward: saving quotas")
+
+	t := time.NewTicker(quotasStoreIvl)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			err := q.store()
+			if err != nil {
+				log.Error("dnsforward: saving quotas: %s", err)
+			}
+		}
+	}
+}
+
+// close stops saving the counters in the background, if started, and saves
+// them to the file for the last time.
+func (q *clientIDQuotas) close() (err error) {
+	q.mu.Lock()
+	if q.done != nil {
+		close(q.done)
+		q.done = nil
+	}
+	q.mu.Unlock()
+
+	return q.store()
+}
+
+// store saves the counters to the file, if they've changed.  The file is
+// written without holding q.mu, so that the queries aren't delayed.
+func (q *clientIDQuotas) store() (err error) {
+	b, err := q.marshal()
+	if err != nil || b == nil {
+		return err
+	}
+
+	err = maybe.WriteFile(q.filePath, b, aghos.DefaultPermFile)
+	if err != nil {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		// Try again next time.
+		q.changed = true
+
+		return fmt.Errorf("writing quotas: %w", err)
+	}
+
+	return nil
+}
+
+// marshal returns the encoded counters and marks them as saved.  b is nil if
+// there is no file or the counters haven't changed.
+func (q *clientIDQuotas) marshal() (b []byte, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.filePath == "" || !q.changed {
+		return nil, nil
+	}
+
+	d := &quotasData{
+		Clients: make([]*quotaUsageData, 0, len(q.usage)),
+		Version: quotasDataVersion,
+	}
+
+	for id, u := range q.usage {
+		d.Clients = append(d.Clients, &quotaUsageData{
+			Day:      u.day,
+			Month:    u.month,
+			ClientID: id,
+			Daily:    u.daily,
+			Monthly:  u.monthly,
+			Refused:  u.refused,
+		})
+	}
+
+	slices.SortFunc(d.Clients, func(a, b *quotaUsageData) (res int) {
+		return strings.Compare(a.ClientID, b.ClientID)
+	})
+
+	b, err = json.Marshal(d)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	q.changed = false
+
+	return b, nil
+}
+
+// setLimits sets the daily and the monthly quotas.  Zero means no limit.
+func (q *clientIDQuotas) setLimits(daily, monthly uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.daily, q.monthly = daily, monthly
+}
+
+// consume counts a query made with clientID at now.  ok is false if the query
+// must be refused, since one of the quotas is exceeded.
+func (q *clientIDQuotas) consume(clientID string, now time.Time) (ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.daily == 0 && q.monthly == 0 {
+		return true
+	}
+
+	u := q.usage[clientID]
+	if u == nil {
+		u = &quotaUsage{}
+		q.usage[clientID] = u
+	}
+
+	u.reset(now)
+	q.changed = true
+
+	if q.exceededLocked(u) {
+		if u.refused == 0 {
+			log.Info("dnsforward: clientid %q has exceeded its quota", clientID)
+		}
+
+		u.refused++
+
+		return false
+	}
+
+	u.daily++
+	u.monthly++
+
+	return true
+}
+
+// exceeded returns true if clientID has exceeded one of the quotas at now.  It
+// doesn't count a query.
+func (q *clientIDQuotas) exceeded(clientID string, now time.Time) (ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.usage[clientID]
+	if u == nil {
+		return false
+	}
+
+	u.reset(now)
+
+	return q.exceededLocked(u)
+}
+
+// exceededLocked returns true if u exceeds one of the quotas.  q.mu must be
+// locked.
+func (q *clientIDQuotas) exceededLocked(u *quotaUsage) (ok bool) {
+	return (q.daily > 0 && u.daily >= q.daily) || (q.monthly > 0 && u.monthly >= q.monthly)
+}
+
+// quotaUsageJSON is the usage of the quotas by a ClientID for the HTTP API.
+type quotaUsageJSON struct {
+	ClientID string `json:"client_id"`
+	Daily    uint64 `json:"daily"`
+	Monthly  uint64 `json:"monthly"`
+	Refused  uint64 `json:"refused"`
+	Exceeded bool   `json:"exceeded"`
+}
+
+// quotasJSON is the response to the GET /control/access/quotas HTTP API.
+type quotasJSON struct {
+	Clients      []*quotaUsageJSON `json:"clients"`
+	DailyQuota   uint64            `json:"daily_quota"`
+	MonthlyQuota uint64            `json:"monthly_quota"`
+}
+
+// report returns the usage of the quotas in the current periods at now.
+func (q *clientIDQuotas) report(now time.Time) (resp *quotasJSON) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	resp = &quotasJSON{
+		Clients:      []*quotaUsageJSON{},
+		DailyQuota:   q.daily,
+		MonthlyQuota: q.monthly,
+	}
+
+	for id, u := range q.usage {
+		u.reset(now)
+		if u.monthly == 0 && u.refused == 0 {
+			// The ClientID hasn't been used this month, so forget it.
+			delete(q.usage, id)
+			q.changed = true
+
+			continue
+		}
+
+		resp.Clients = append(resp.Clients, &quotaUsageJSON{
+			ClientID: id,
+			Daily:    u.daily,
+			Monthly:  u.monthly,
+			Refused:  u.refused,
+			Exceeded: q.exceededLocked(u),
+		})
+	}
+
+	slices.SortFunc(resp.Clients, func(a, b *quotaUsageJSON) (res int) {
+		return strings.Compare(a.ClientID, b.ClientID)
+	})
+
+	return resp
+}
+
+// handleAccessQuotas handles requests to the GET /control/access/quotas
+// endpoint.
+func (s *Server) handleAccessQuotas(w http.ResponseWriter, r *http.Request) {
+	aghhttp.WriteJSONResponseOK(w, r, s.quotas.report(time.Now()))
+}
@@ -0,0 +1,241 @@
+package dnsforward
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIDQuotas(t *testing.T) {
+	t.Parallel()
+
+	const clientID = "client-1"
+
+	now := time.Date(2026, time.January, 31, 12, 0, 0, 0, time.UTC)
+	nextDay := now.Add(24 * time.Hour)
+
+	q := newClientIDQuotas("")
+	assert.True(t, q.consume(clientID, now))
+
+	q.setLimits(2, 3)
+
+	assert.True(t, q.consume(clientID, now))
+	assert.True(t, q.consume(clientID, now))
+	assert.False(t, q.consume(clientID, now))
+
+	assert.Equal(t, &quotasJSON{
+		Clients: []*quotaUsageJSON{{
+			ClientID: clientID,
+			Daily:    2,
+			Monthly:  2,
+			Refused:  1,
+			Exceeded: true,
+		}},
+		DailyQuota:   2,
+		MonthlyQuota: 3,
+	}, q.report(now))
+
+	// The next day is also the next month.
+	assert.True(t, q.consume(clientID, nextDay))
+	assert.True(t, q.consume(clientID, nextDay))
+	assert.False(t, q.consume(clientID, nextDay))
+
+	q.setLimits(0, 3)
+
+	assert.True(t, q.consume(clientID, nextDay.Add(24*time.Hour)))
+	assert.False(t, q.consume(clientID, nextDay.Add(24*time.Hour)))
+}
+
+func TestClientIDQuotas_restart(t *testing.T) {
+	t.Parallel()
+
+	const clientID = "client-1"
+
+	filePath := filepath.Join(t.TempDir(), "quotas.json")
+	now := time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC)
+
+	q := newClientIDQuotas(filePath)
+	require.NoError(t, q.load())
+
+	q.setLimits(3, 5)
+
+	assert.True(t, q.consume(clientID, now))
+	assert.True(t, q.consume(clientID, now))
+	require.NoError(t, q.store())
+
+	q = newClientIDQuotas(filePath)
+	require.NoError(t, q.load())
+
+	q.setLimits(3, 5)
+
+	assert.True(t, q.consume(clientID, now))
+	assert.False(t, q.consume(clientID, now))
+
+	// The daily counter is reset on the next day, but the monthly one isn't.
+	nextDay := now.Add(24 * time.Hour)
+	require.NoError(t, q.store())
+
+	q = newClientIDQuotas(filePath)
+	require.NoError(t, q.load())
+
+	q.setLimits(3, 5)
+
+	assert.True(t, q.consume(clientID, nextDay))
+	assert.True(t, q.consume(clientID, nextDay))
+	assert.False(t, q.consume(clientID, nextDay))
+
+	assert.Equal(t, &quotasJSON{
+		Clients: []*quotaUsageJSON{{
+			ClientID: clientID,
+			Daily:    2,
+			Monthly:  5,
+			Refused:  2,
+			Exceeded: true,
+		}},
+		DailyQuota:   3,
+		MonthlyQuota: 5,
+	}, q.report(nextDay))
+}
+
+func TestClientIDQuotas_close(t *testing.T) {
+	t.Parallel()
+
+	const clientID = "client-1"
+
+	filePath := filepath.Join(t.TempDir(), "quotas.json")
+	now := time.Now()
+
+	q := newClientIDQuotas(filePath)
+	require.NoError(t, q.load())
+
+	q.start()
+	q.setLimits(1, 0)
+
+	assert.True(t, q.consume(clientID, now))
+	require.NoError(t, q.close())
+
+	// Closing twice is safe.
+	require.NoError(t, q.close())
+
+	q = newClientIDQuotas(filePath)
+	require.NoError(t, q.load())
+
+	q.setLimits(1, 0)
+
+	assert.False(t, q.consume(clientID, now))
+}
+
+func TestServer_HandleBefore_publicHardening(t *testing.T) {
+	t.Parallel()
+
+	const knownClientID = "known"
+
+	localUpsAddr := aghtest.StartLocalhostUpstream(t, dns.HandlerFunc(
+		func(w dns.ResponseWriter, req *dns.Msg) {
+			require.NoError(t, w.WriteMsg((&dns.Msg{}).SetReply(req)))
+		},
+	)).String()
+
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamDNS:      []string{localUpsAddr},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			PublicHardening: &PublicHardeningConfig{
+				DailyQuota: 1,
+				Enabled:    true,
+			},
+			ClientsContainer: &clientsContainer{
+				OnCustomUpstreamConfig: func(
+					_ string,
+					_ netip.Addr,
+				) (conf *proxy.CustomUpstreamConfig) {
+					return nil
+				},
+				OnUpdateCommonUpstreamConfig: func(_ *client.CommonUpstreamConfig) {},
+				OnClearUpstreamCache:         func() {},
+				OnMarkActive:                 func(_ netip.Addr) {},
+				OnHasClientID: func(clientID string) (ok bool) {
+					return clientID == knownClientID
+				},
+			},
+		},
+		ServePlainDNS: true,
+	})
+
+	publicAddr := netip.MustParseAddrPort("1.2.3.4:12345")
+	privateAddr := netip.MustParseAddrPort("192.168.1.1:12345")
+
+	newDoHCtx := func(path string) (pctx *proxy.DNSContext) {
+		return &proxy.DNSContext{
+			Proto:       proxy.ProtoHTTPS,
+			Req:         createTestMessage(testFQDN),
+			Addr:        publicAddr,
+			HTTPRequest: httptest.NewRequest(http.MethodGet, "https://dns.example"+path, nil),
+		}
+	}
+
+	assertRefused := func(t *testing.T, err error) {
+		t.Helper()
+
+		beforeErr := &proxy.BeforeRequestError{}
+		require.ErrorAs(t, err, &beforeErr)
+
+		assert.Equal(t, dns.RcodeRefused, beforeErr.Response.Rcode)
+	}
+
+	t.Run("plain_public", func(t *testing.T) {
+		err := s.HandleBefore(nil, &proxy.DNSContext{
+			Proto: proxy.ProtoUDP,
+			Req:   createTestMessage(testFQDN),
+			Addr:  publicAddr,
+		})
+		assert.ErrorIs(t, err, errAccessBlocked)
+	})
+
+	t.Run("plain_private", func(t *testing.T) {
+		err := s.HandleBefore(nil, &proxy.DNSContext{
+			Proto: proxy.ProtoUDP,
+			Req:   createTestMessage(testFQDN),
+			Addr:  privateAddr,
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("encrypted_no_clientid", func(t *testing.T) {
+		assertRefused(t, s.HandleBefore(nil, newDoHCtx("/dns-query")))
+	})
+
+	t.Run("encrypted_unknown_clientid", func(t *testing.T) {
+		assertRefused(t, s.HandleBefore(nil, newDoHCtx("/dns-query/unknown")))
+	})
+
+	t.Run("encrypted_known_clientid", func(t *testing.T) {
+		require.NoError(t, s.HandleBefore(nil, newDoHCtx("/dns-query/"+knownClientID)))
+
+		// The daily quota is exceeded.
+		assertRefused(t, s.HandleBefore(nil, newDoHCtx("/dns-query/"+knownClientID)))
+
+		resp := s.quotas.report(time.Now())
+		require.Len(t, resp.Clients, 1)
+
+		assert.True(t, resp.Clients[0].Exceeded)
+	})
+}
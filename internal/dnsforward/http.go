@@ -800,9 +800,12 @@ func (s *Server) registerHandlers() {
 
 	s.conf.HTTPRegister(http.MethodGet, "/control/access/list", s.handleAccessList)
 	s.conf.HTTPRegister(http.MethodPost, "/control/access/set", s.handleAccessSet)
+	s.conf.HTTPRegister(http.MethodGet, "/control/access/quotas", s.handleAccessQuotas)
 
 	s.conf.HTTPRegister(http.MethodPost, "/control/cache_clear", s.handleCacheClear)
 
+	s.conf.HTTPRegister(http.MethodGet, "/control/dns_trace", s.handleTrace)
+
 	// Register both versions, with and without the trailing slash, to
 	// prevent a 301 Moved Permanently redirect when clients request the
 	// path without the trailing slash.  Those redirects break some clients.
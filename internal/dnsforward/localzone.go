@@ -0,0 +1,111 @@
+package dnsforward
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// processLocalZone responds to the requests for the names and addresses
+// within the authoritative local zone, including the zone transfers.
+func (s *Server) processLocalZone(dctx *dnsContext) (rc resultCode) {
+	log.Debug("dnsforward: started processing local zone")
+	defer log.Debug("dnsforward: finished processing local zone")
+
+	z := s.localZone
+	if z == nil {
+		return resultCodeSuccess
+	}
+
+	pctx := dctx.proxyCtx
+	req := pctx.Req
+
+	// TODO:  Use passed context.
+	ctx := context.TODO()
+
+	if z.IsTransfer(req) {
+		if pctx.Proto == proxy.ProtoUDP {
+			dctx.trace.add(traceStageLocalZone, traceDecisionBlock, "zone transfer over udp")
+			pctx.Res = s.makeResponseREFUSED(req)
+
+			return resultCodeSuccess
+		}
+
+		s.transferLocalZone(ctx, dctx)
+
+		return resultCodeSuccess
+	}
+
+	if !pctx.IsPrivateClient {
+		// Let the DHCP hosts processing respond to the public clients.
+		return resultCodeSuccess
+	}
+
+	resp, ok := z.Answer(ctx, req)
+	if !ok {
+		dctx.trace.add(traceStageLocalZone, traceDecisionPass, "not in the local zone")
+
+		return resultCodeSuccess
+	}
+
+	dctx.trace.add(traceStageLocalZone, traceDecisionAnswer, "answered from the local zone")
+	pctx.Res = resp
+
+	return resultCodeSuccess
+}
+
+// transferLocalZone responds to the zone transfer request of dctx, which must
+// not be received over UDP.  All the messages of the transfer except the last
+// one are written to the client's connection directly, while the last one is
+// left for the proxy to write.
+func (s *Server) transferLocalZone(ctx context.Context, dctx *dnsContext) {
+	z := s.localZone
+	pctx := dctx.proxyCtx
+	req := pctx.Req
+
+	resps := z.Transfer(ctx, req, pctx.Addr.Addr())
+	last := len(resps) - 1
+	if last > 0 && pctx.Conn == nil {
+		// Only the connections of DNS over TCP and DNS over TLS are able to
+		// carry several messages in response to a single request.
+		dctx.trace.add(traceStageLocalZone, traceDecisionBlock, "zone transfer over %s", pctx.Proto)
+		pctx.Res = s.makeResponseREFUSED(req)
+
+		return
+	}
+
+	dctx.trace.add(traceStageLocalZone, traceDecisionAnswer, "zone transfer of %q", z.Origin())
+
+	for i, resp := range resps[:last] {
+		err := writePrefixed(pctx.Conn, resp)
+		if err != nil {
+			log.Error("dnsforward: writing zone transfer message at index %d: %s", i, err)
+
+			// Make the proxy close the connection, since the transfer is
+			// incomplete.
+			pctx.Res = nil
+
+			return
+		}
+	}
+
+	pctx.Res = resps[last]
+}
+
+// writePrefixed writes msg to the connection of DNS over TCP prefixed with its
+// two-byte length.
+func writePrefixed(conn net.Conn, msg *dns.Msg) (err error) {
+	b, err := msg.Pack()
+	if err != nil {
+		return fmt.Errorf("packing: %w", err)
+	}
+
+	_, err = (&net.Buffers{binary.BigEndian.AppendUint16(nil, uint16(len(b))), b}).WriteTo(conn)
+
+	return err
+}
@@ -0,0 +1,249 @@
+package dnsforward
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/localzone"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ProcessLocalZone(t *testing.T) {
+	const (
+		localTLD = "lan"
+		host     = "nas." + localTLD
+	)
+
+	hostAddr := netip.MustParseAddr("192.168.1.2")
+	secondary := netip.MustParseAddrPort("192.168.1.53:53")
+
+	conf := &localzone.Config{
+		Logger: slogutil.NewDiscardLogger(),
+		Origin: localTLD,
+		Sources: []localzone.RecordSource{localzone.RecordSourceFunc(
+			func(_ context.Context) (recs []*localzone.Record) {
+				return []*localzone.Record{{
+					Addr:   hostAddr,
+					Host:   "nas",
+					Source: localzone.SourceHosts,
+				}}
+			},
+		)},
+		TransferAllowed: []netip.Prefix{netip.PrefixFrom(secondary.Addr(), 32)},
+		MaxTTL:          time.Hour,
+		RefreshInterval: time.Hour,
+	}
+	require.NoError(t, conf.Validate())
+
+	s := &Server{
+		localZone:  localzone.New(conf),
+		baseLogger: slogutil.NewDiscardLogger(),
+	}
+
+	testCases := []struct {
+		name      string
+		host      string
+		proto     proxy.Proto
+		wantRcode int
+		wantAns   int
+		qtyp      uint16
+		private   bool
+		wantRes   bool
+	}{{
+		name:      "a",
+		host:      host,
+		proto:     proxy.ProtoUDP,
+		wantRcode: dns.RcodeSuccess,
+		wantAns:   1,
+		qtyp:      dns.TypeA,
+		private:   true,
+		wantRes:   true,
+	}, {
+		name:      "public_client",
+		host:      host,
+		proto:     proxy.ProtoUDP,
+		wantRcode: dns.RcodeSuccess,
+		wantAns:   0,
+		qtyp:      dns.TypeA,
+		private:   false,
+		wantRes:   false,
+	}, {
+		name:      "unknown",
+		host:      "printer." + localTLD,
+		proto:     proxy.ProtoUDP,
+		wantRcode: dns.RcodeSuccess,
+		wantAns:   0,
+		qtyp:      dns.TypeA,
+		private:   true,
+		wantRes:   false,
+	}, {
+		name:      "axfr_udp",
+		host:      localTLD,
+		proto:     proxy.ProtoUDP,
+		wantRcode: dns.RcodeRefused,
+		wantAns:   0,
+		qtyp:      dns.TypeAXFR,
+		private:   true,
+		wantRes:   true,
+	}, {
+		name:      "axfr_tcp",
+		host:      localTLD,
+		proto:     proxy.ProtoTCP,
+		wantRcode: dns.RcodeSuccess,
+		wantAns:   3,
+		qtyp:      dns.TypeAXFR,
+		private:   true,
+		wantRes:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:             (&dns.Msg{}).SetQuestion(dns.Fqdn(tc.host), tc.qtyp),
+					Addr:            secondary,
+					Proto:           tc.proto,
+					IsPrivateClient: tc.private,
+				},
+			}
+
+			rc := s.processLocalZone(dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			res := dctx.proxyCtx.Res
+			if !tc.wantRes {
+				assert.Nil(t, res)
+
+				return
+			}
+
+			require.NotNil(t, res)
+
+			assert.Equal(t, tc.wantRcode, res.Rcode)
+			require.Len(t, res.Answer, tc.wantAns)
+
+			if tc.qtyp == dns.TypeA {
+				a := testutil.RequireTypeAssert[*dns.A](t, res.Answer[0])
+				assert.Equal(t, hostAddr.AsSlice(), []byte(a.A.To4()))
+			}
+		})
+	}
+}
+
+func TestServer_ProcessLocalZone_largeTransfer(t *testing.T) {
+	const numRecs = 2_000
+
+	secondary := netip.MustParseAddrPort("192.168.1.53:53")
+
+	recs := make([]*localzone.Record, 0, numRecs)
+	for i := range numRecs {
+		recs = append(recs, &localzone.Record{
+			Addr:   netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)}),
+			Host:   fmt.Sprintf("host-with-a-rather-long-name-%04d", i),
+			Source: localzone.SourceHosts,
+		})
+	}
+
+	conf := &localzone.Config{
+		Logger: slogutil.NewDiscardLogger(),
+		Origin: "lan",
+		Sources: []localzone.RecordSource{localzone.RecordSourceFunc(
+			func(_ context.Context) (res []*localzone.Record) { return recs },
+		)},
+		TransferAllowed: []netip.Prefix{netip.PrefixFrom(secondary.Addr(), 32)},
+		MaxTTL:          time.Hour,
+		RefreshInterval: time.Hour,
+	}
+	require.NoError(t, conf.Validate())
+
+	s := &Server{
+		localZone:  localzone.New(conf),
+		baseLogger: slogutil.NewDiscardLogger(),
+	}
+
+	req := (&dns.Msg{}).SetQuestion("lan.", dns.TypeAXFR)
+
+	t.Run("https", func(t *testing.T) {
+		dctx := &dnsContext{
+			proxyCtx: &proxy.DNSContext{
+				Req:   req,
+				Addr:  secondary,
+				Proto: proxy.ProtoHTTPS,
+			},
+		}
+
+		require.Equal(t, resultCodeSuccess, s.processLocalZone(dctx))
+		require.NotNil(t, dctx.proxyCtx.Res)
+
+		assert.Equal(t, dns.RcodeRefused, dctx.proxyCtx.Res.Rcode)
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		srvConn, cliConn := net.Pipe()
+		t.Cleanup(func() {
+			_ = srvConn.Close()
+			_ = cliConn.Close()
+		})
+
+		dctx := &dnsContext{
+			proxyCtx: &proxy.DNSContext{
+				Req:   req,
+				Addr:  secondary,
+				Proto: proxy.ProtoTCP,
+				Conn:  srvConn,
+			},
+		}
+
+		written := make(chan []*dns.Msg, 1)
+		go func() {
+			var msgs []*dns.Msg
+			defer func() { written <- msgs }()
+
+			for {
+				l := make([]byte, 2)
+				if _, err := io.ReadFull(cliConn, l); err != nil {
+					return
+				}
+
+				b := make([]byte, binary.BigEndian.Uint16(l))
+				if _, err := io.ReadFull(cliConn, b); err != nil {
+					return
+				}
+
+				msg := &dns.Msg{}
+				if msg.Unpack(b) != nil {
+					return
+				}
+
+				msgs = append(msgs, msg)
+			}
+		}()
+
+		require.Equal(t, resultCodeSuccess, s.processLocalZone(dctx))
+		require.NotNil(t, dctx.proxyCtx.Res)
+		require.NoError(t, srvConn.Close())
+
+		msgs := append(<-written, dctx.proxyCtx.Res)
+		require.Greater(t, len(msgs), 1)
+
+		n := 0
+		for _, msg := range msgs {
+			n += len(msg.Answer)
+		}
+
+		assert.Equal(t, numRecs+2, n)
+		assert.IsType(t, &dns.SOA{}, msgs[0].Answer[0])
+		assert.IsType(t, &dns.SOA{}, dctx.proxyCtx.Res.Answer[len(dctx.proxyCtx.Res.Answer)-1])
+	})
+}
@@ -58,6 +58,10 @@ type dnsContext struct {
 	// isDHCPHost is true if the request for a local domain name and the DHCP is
 	// available for this request.
 	isDHCPHost bool
+
+	// trace, if not nil, collects the decisions made while processing the
+	// request in the dry-run mode.  See [Server.handleTrace].
+	trace *requestTrace
 }
 
 // resultCode is the result of a request processing function.
@@ -99,6 +103,7 @@ func (s *Server) handleDNSRequest(_ *proxy.Proxy, pctx *proxy.DNSContext) error
 	mods := []modProcessFunc{
 		s.processInitial,
 		s.processDDRQuery,
+		s.processLocalZone,
 		s.processDHCPHosts,
 		s.processDHCPAddrs,
 		s.processFilteringBeforeRequest,
@@ -154,23 +159,30 @@ func (s *Server) processInitial(dctx *dnsContext) (rc resultCode) {
 	defer log.Debug("dnsforward: finished processing initial")
 
 	pctx := dctx.proxyCtx
-	s.processClientIP(pctx.Addr.Addr())
+	t := dctx.trace
+	if t == nil {
+		s.processClientIP(pctx.Addr.Addr())
+	}
 
 	q := pctx.Req.Question[0]
 	qt := q.Qtype
 	if s.conf.AAAADisabled && qt == dns.TypeAAAA {
+		t.add(traceStageInitial, traceDecisionAnswer, "aaaa requests are disabled")
 		pctx.Res = s.NewMsgNODATA(pctx.Req)
 
 		return resultCodeFinish
 	}
 
 	if (qt == dns.TypeA || qt == dns.TypeAAAA) && q.Name == mozillaFQDN {
+		t.add(traceStageInitial, traceDecisionAnswer, "mozilla canary domain")
 		pctx.Res = s.NewMsgNXDOMAIN(pctx.Req)
 
 		return resultCodeFinish
 	}
 
 	if q.Name == healthcheckFQDN {
+		t.add(traceStageInitial, traceDecisionAnswer, "healthcheck domain")
+
 		// Generate a NODATA negative response to make nslookup exit with 0.
 		pctx.Res = s.replyCompressed(pctx.Req)
 
@@ -178,19 +190,25 @@ func (s *Server) processInitial(dctx *dnsContext) (rc resultCode) {
 	}
 
 	// Get the ClientID, if any, before getting client-specific filtering
-	// settings.
-	var key [8]byte
-	binary.BigEndian.PutUint64(key[:], pctx.RequestID)
-	dctx.clientID = string(s.clientIDCache.Get(key[:]))
+	// settings.  The traced requests have it set already.
+	if t == nil {
+		var key [8]byte
+		binary.BigEndian.PutUint64(key[:], pctx.RequestID)
+		dctx.clientID = string(s.clientIDCache.Get(key[:]))
+	}
 
 	// Get the client-specific filtering settings.
 	dctx.protectionEnabled, _ = s.UpdatedProtectionStatus()
 	dctx.setts = s.clientRequestFilteringSettings(dctx)
 
+	t.add(traceStageInitial, traceDecisionPass, "protection enabled: %t", dctx.protectionEnabled)
+	traceSettings(t, dctx.setts)
+
 	return resultCodeSuccess
 }
 
-// processClientIP sends the client IP address to s.addrProc, if needed.
+// processClientIP sends the client IP address to s.addrProc, if needed, and
+// records the activity of the client.
 func (s *Server) processClientIP(addr netip.Addr) {
 	if !addr.IsValid() {
 		log.Info("dnsforward: warning: bad client addr %q", addr)
@@ -198,6 +216,10 @@ func (s *Server) processClientIP(addr netip.Addr) {
 		return
 	}
 
+	if s.conf.ClientsContainer != nil {
+		s.conf.ClientsContainer.MarkActive(addr)
+	}
+
 	// Do not assign s.addrProc to a local variable to then use, since this lock
 	// also serializes the closure of s.addrProc.
 	s.serverLock.RLock()
@@ -223,6 +245,7 @@ func (s *Server) processDDRQuery(dctx *dnsContext) (rc resultCode) {
 	pctx := dctx.proxyCtx
 	q := pctx.Req.Question[0]
 	if q.Name == ddrHostFQDN {
+		dctx.trace.add(traceStageDDR, traceDecisionAnswer, "discovery of designated resolvers")
 		pctx.Res = s.makeDDRResponse(pctx.Req)
 
 		return resultCodeFinish
@@ -316,6 +339,11 @@ func (s *Server) processDHCPHosts(dctx *dnsContext) (rc resultCode) {
 	defer log.Debug("dnsforward: finished processing dhcp hosts")
 
 	pctx := dctx.proxyCtx
+	if pctx.Res != nil {
+		// The request is already answered from the local zone.
+		return resultCodeSuccess
+	}
+
 	req := pctx.Req
 
 	q := &req.Question[0]
@@ -326,6 +354,7 @@ func (s *Server) processDHCPHosts(dctx *dnsContext) (rc resultCode) {
 
 	if !pctx.IsPrivateClient {
 		log.Debug("dnsforward: %q requests for dhcp host %q", pctx.Addr, dhcpHost)
+		dctx.trace.add(traceStageDHCPHosts, traceDecisionBlock, "public client requests dhcp host")
 		pctx.Res = s.NewMsgNXDOMAIN(req)
 
 		// Do not even put into query log.
@@ -337,11 +366,13 @@ func (s *Server) processDHCPHosts(dctx *dnsContext) (rc resultCode) {
 		// Go on and process them with filters, including dnsrewrite ones, and
 		// possibly route them to a domain-specific upstream.
 		log.Debug("dnsforward: no dhcp record for %q", dhcpHost)
+		dctx.trace.add(traceStageDHCPHosts, traceDecisionPass, "no dhcp lease for %q", dhcpHost)
 
 		return resultCodeSuccess
 	}
 
 	log.Debug("dnsforward: dhcp record for %q is %s", dhcpHost, ip)
+	dctx.trace.add(traceStageDHCPHosts, traceDecisionAnswer, "dhcp lease for %q is %s", dhcpHost, ip)
 
 	resp := s.replyCompressed(req)
 	switch q.Qtype {
@@ -397,6 +428,7 @@ func (s *Server) processDHCPAddrs(dctx *dnsContext) (rc resultCode) {
 	}
 
 	log.Debug("dnsforward: dhcp client %s is %q", addr, host)
+	dctx.trace.add(traceStageDHCPAddrs, traceDecisionAnswer, "dhcp client %s is %q", addr, host)
 
 	resp := s.replyCompressed(req)
 	ptr := &dns.PTR{
@@ -431,6 +463,8 @@ func (s *Server) processFilteringBeforeRequest(dctx *dnsContext) (rc resultCode)
 	}
 
 	if dctx.proxyCtx.Res != nil {
+		dctx.trace.add(traceStageFilteringReq, traceDecisionSkip, "response is already set")
+
 		// Go on since the response is already set.
 		return resultCodeSuccess
 	}
@@ -445,6 +479,8 @@ func (s *Server) processFilteringBeforeRequest(dctx *dnsContext) (rc resultCode)
 		return resultCodeError
 	}
 
+	dctx.trace.addResult(traceStageFilteringReq, dctx.result)
+
 	return resultCodeSuccess
 }
 
@@ -465,7 +501,10 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 	pctx := dctx.proxyCtx
 	req := pctx.Req
 
+	t := dctx.trace
 	if pctx.Res != nil {
+		t.add(traceStageUpstream, traceDecisionSkip, "response is already set")
+
 		// The response has already been set.
 		return resultCodeSuccess
 	} else if dctx.isDHCPHost {
@@ -476,6 +515,7 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 		// local domain name if there is one.
 		name := req.Question[0].Name
 		log.Debug("dnsforward: dhcp client hostname %q was not filtered", name[:len(name)-1])
+		t.add(traceStageUpstream, traceDecisionAnswer, "unknown dhcp client hostname")
 		pctx.Res = s.NewMsgNXDOMAIN(req)
 
 		return resultCodeFinish
@@ -483,6 +523,15 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 
 	s.setCustomUpstream(pctx, dctx.clientID)
 
+	if t != nil {
+		s.traceUpstream(dctx)
+		if !t.resolve {
+			t.add(traceStageResolve, traceDecisionSkip, "dry run, request is not sent")
+
+			return resultCodeFinish
+		}
+	}
+
 	reqWantsDNSSEC := s.setReqAD(req)
 
 	// Process the request further since it wasn't filtered.
@@ -499,6 +548,12 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 
 	dctx.responseFromUpstream = true
 	dctx.responseAD = pctx.Res.AuthenticatedData
+	t.add(
+		traceStageResolve,
+		traceDecisionPass,
+		"upstream responded with %s",
+		dns.RcodeToString[pctx.Res.Rcode],
+	)
 
 	s.setRespAD(pctx, reqWantsDNSSEC)
 
@@ -596,6 +651,8 @@ func (s *Server) processFilteringAfterResponse(dctx *dnsContext) (rc resultCode)
 
 	switch res := dctx.result; res.Reason {
 	case filtering.NotFilteredAllowList:
+		dctx.trace.add(traceStageFilteringResp, traceDecisionSkip, "request is explicitly allowed")
+
 		return resultCodeSuccess
 	case
 		filtering.Rewritten,
@@ -628,6 +685,12 @@ func (s *Server) filterAfterResponse(dctx *dnsContext) (res resultCode) {
 	// response if the protection is disabled since dnsrewrite rules aren't
 	// applied to it anyway.
 	if !dctx.protectionEnabled || !dctx.responseFromUpstream {
+		dctx.trace.add(
+			traceStageFilteringResp,
+			traceDecisionSkip,
+			"response is not from upstream or protection is disabled",
+		)
+
 		return resultCodeSuccess
 	}
 
@@ -638,5 +701,11 @@ func (s *Server) filterAfterResponse(dctx *dnsContext) (res resultCode) {
 		return resultCodeError
 	}
 
+	if dctx.origResp != nil {
+		dctx.trace.addResult(traceStageFilteringResp, dctx.result)
+	} else {
+		dctx.trace.add(traceStageFilteringResp, traceDecisionPass, "no answer records matched")
+	}
+
 	return resultCodeSuccess
 }
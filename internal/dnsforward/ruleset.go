@@ -4,15 +4,12 @@ package dnsforward
 import (
 	"bufio"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/ruleset"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/log"
@@ -21,8 +18,6 @@ import (
 
 const defaultRulesetsDir = "data/rulesets"
 
-const ruleCacheExpire = 7 * 24 * time.Hour
-
 // rulesetManager manages the download and parsing of rulesets.
 type rulesetManager struct {
 	rulesetsDir string
@@ -37,153 +32,11 @@ func newRulesetManager(dir string) *rulesetManager {
 	return &rulesetManager{rulesetsDir: dir}
 }
 
-// ensureRulesetsDir ensures that the rulesets directory exists.
-func (m *rulesetManager) ensureRulesetsDir() error {
-	return os.MkdirAll(m.rulesetsDir, 0o750)
-}
-
-// isURLAllowed checks if the URL is safe to download from.
-// It implements basic validation to prevent potential security issues.
-func isURLAllowed(rawURL string) error {
-	parsedURL, err := url.Parse(rawURL)
-	if err != nil {
-		return fmt.Errorf("parsing URL: %w", err)
-	}
-
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return fmt.Errorf("unsupported URL scheme %q", parsedURL.Scheme)
-	}
-
-	return nil
-}
-
 // downloadRuleset downloads a ruleset from the URL and saves it to a file.
-// If the file already exists and is not older than ruleCacheExpire, it is not downloaded again.
+// If the file already exists and is not older than [ruleset.CacheExpire], it
+// is not downloaded again.
 func (m *rulesetManager) downloadRuleset(rawURL string) (string, error) {
-	if err := m.ensureRulesetsDir(); err != nil {
-		return "", fmt.Errorf("creating rulesets directory: %w", err)
-	}
-
-	// Security check for URL
-	if err := isURLAllowed(rawURL); err != nil {
-		return "", fmt.Errorf("invalid URL: %w", err)
-	}
-
-	// Generate a filename based on the URL
-	safeFilename := filenameFromURL(rawURL)
-	filename := filepath.Join(m.rulesetsDir, safeFilename)
-
-	// Check if the file already exists and is fresh
-	if m.isFileExistAndFresh(filename) {
-		log.Debug("dnsforward: ruleset %s is fresh, not downloading", rawURL)
-		return filename, nil
-	}
-
-	log.Debug("dnsforward: downloading ruleset from %s", rawURL)
-	return m.fetchAndSaveRuleset(rawURL, filename)
-}
-
-// isFileExistAndFresh checks if the file exists and is not older than ruleCacheExpire.
-func (m *rulesetManager) isFileExistAndFresh(filename string) bool {
-	info, err := os.Stat(filename)
-	if err != nil {
-		return false
-	}
-	return time.Since(info.ModTime()) < ruleCacheExpire
-}
-
-// fetchAndSaveRuleset downloads a ruleset from URL and saves it to filename.
-func (m *rulesetManager) fetchAndSaveRuleset(rawURL, filename string) (string, error) {
-	// Create a proper HTTP client for this request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
-	resp, err := m.makeRequest(client, rawURL)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			log.Error("dnsforward: failed to close response body: %s", closeErr)
-		}
-	}()
-
-	return m.saveRulesetToFile(resp.Body, filename)
-}
-
-// makeRequest creates and executes an HTTP request.
-func (m *rulesetManager) makeRequest(client *http.Client, rawURL string) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
-	}
-
-	resp, doErr := client.Do(req)
-	if doErr != nil {
-		return nil, fmt.Errorf("downloading ruleset: %w", doErr)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		closeErr := resp.Body.Close()
-		if closeErr != nil {
-			log.Error("dnsforward: failed to close response body: %s", closeErr)
-		}
-		return nil, fmt.Errorf("downloading ruleset: HTTP status %d", resp.StatusCode)
-	}
-
-	return resp, nil
-}
-
-// saveRulesetToFile saves the ruleset content to a file.
-func (m *rulesetManager) saveRulesetToFile(content io.Reader, filename string) (res string, err error) {
-	f, err := os.OpenFile(filepath.Clean(filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
-	if err != nil {
-		return "", fmt.Errorf("creating ruleset file: %w", err)
-	}
-	defer m.cleanupIncompleteFile(f, filename, &err)
-
-	if _, err = io.Copy(f, content); err != nil {
-		return "", fmt.Errorf("writing ruleset file: %w", err)
-	}
-
-	return filename, nil
-}
-
-// cleanupIncompleteFile closes the file and removes it if there was an error.
-func (m *rulesetManager) cleanupIncompleteFile(f *os.File, filename string, opErr *error) {
-	closeErr := f.Close()
-	if *opErr == nil && closeErr != nil {
-		*opErr = fmt.Errorf("closing ruleset file: %w", closeErr)
-	}
-
-	if *opErr != nil {
-		if removeErr := os.Remove(filepath.Clean(filename)); removeErr != nil {
-			log.Error("dnsforward: failed to remove incomplete ruleset file %s: %s", filename, removeErr)
-		} else {
-			log.Debug("dnsforward: removed incomplete ruleset file %s, error: %s", filename, *opErr)
-		}
-	}
-}
-
-// filenameFromURL generates a safe filename from a URL.
-func filenameFromURL(url string) string {
-	// Remove common prefixes
-	url = strings.TrimPrefix(url, "http://")
-	url = strings.TrimPrefix(url, "https://")
-
-	// Replace special characters with underscore
-	replacer := strings.NewReplacer(
-		"/", "_",
-		":", "_",
-		"?", "_",
-		"&", "_",
-		"=", "_",
-		" ", "_",
-		"..", "_", // Prevent path traversal
-		"\\", "_", // Prevent path traversal
-	)
-	return replacer.Replace(url)
+	return ruleset.Download(m.rulesetsDir, rawURL)
 }
 
 // verifyFilePath checks if the given path is within the rulesetsDir directory.
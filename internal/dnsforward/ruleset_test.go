@@ -13,47 +13,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestFilenameFromURL(t *testing.T) {
-	testCases := []struct {
-		name     string
-		url      string
-		expected string
-	}{
-		{
-			name:     "Simple URL",
-			url:      "example.com",
-			expected: "example.com",
-		},
-		{
-			name:     "With HTTP prefix",
-			url:      "http://example.com",
-			expected: "example.com",
-		},
-		{
-			name:     "With HTTPS prefix",
-			url:      "https://example.com",
-			expected: "example.com",
-		},
-		{
-			name:     "With path and parameters",
-			url:      "https://example.com/path/to/resource?param=value",
-			expected: "example.com_path_to_resource_param_value",
-		},
-		{
-			name:     "With special characters",
-			url:      "https://example.com/some:path?param=value&other=123",
-			expected: "example.com_some_path_param_value_other_123",
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			result := filenameFromURL(tc.url)
-			assert.Equal(t, tc.expected, result)
-		})
-	}
-}
-
 func TestParseRuleset(t *testing.T) {
 	// Create temporary directory
 	tempDir := t.TempDir()
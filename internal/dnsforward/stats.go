@@ -171,6 +171,9 @@ func (s *Server) updateStats(dctx *dnsContext, clientIP string, processingTime t
 		filtering.FilteredInvalid,
 		filtering.FilteredBlockedService:
 		e.Result = stats.RFiltered
+	case filtering.FilteredCategory:
+		e.Result = stats.RFiltered
+		e.Category = dctx.result.Category
 	}
 
 	s.stats.Update(e)
@@ -0,0 +1,582 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// traceDecision is the decision made by a single stage of the request
+// processing pipeline.
+type traceDecision string
+
+// Valid trace decisions.
+const (
+	// traceDecisionPass means that the stage didn't change the processing of
+	// the request.
+	traceDecisionPass traceDecision = "pass"
+
+	// traceDecisionBlock means that the stage blocked the request.
+	traceDecisionBlock traceDecision = "block"
+
+	// traceDecisionAllow means that the stage explicitly allowed the request.
+	traceDecisionAllow traceDecision = "allow"
+
+	// traceDecisionRewrite means that the stage rewrote the request or the
+	// response.
+	traceDecisionRewrite traceDecision = "rewrite"
+
+	// traceDecisionAnswer means that the stage answered the request by itself.
+	traceDecisionAnswer traceDecision = "answer"
+
+	// traceDecisionSkip means that the stage wasn't performed.
+	traceDecisionSkip traceDecision = "skip"
+)
+
+// Names of the traced processing stages.
+const (
+	traceStageAccess        = "access"
+	traceStageInitial       = "initial"
+	traceStageClient        = "client_settings"
+	traceStageDDR           = "ddr"
+	traceStageLocalZone     = "local_zone"
+	traceStageDHCPHosts     = "dhcp_hosts"
+	traceStageDHCPAddrs     = "dhcp_addrs"
+	traceStageFilteringReq  = "filtering_request"
+	traceStageUpstream      = "upstream"
+	traceStageFilteringResp = "filtering_response"
+	traceStageResolve       = "resolve"
+)
+
+// traceRule is a filtering rule matched during a traced stage.
+type traceRule struct {
+	// Text is the text of the rule.
+	Text string `json:"text"`
+
+	// FilterListID is the ID of the rule's filter list.
+	FilterListID int `json:"filter_list_id"`
+}
+
+// traceStep is a single decision made while processing a traced request.
+type traceStep struct {
+	// Stage is the name of the processing stage.
+	Stage string `json:"stage"`
+
+	// Decision is the decision made by the stage.
+	Decision traceDecision `json:"decision"`
+
+	// Details is the human-readable description of the decision.
+	Details string `json:"details"`
+
+	// Reason is the filtering reason, if the stage involved filtering.
+	Reason string `json:"reason,omitempty"`
+
+	// Rules are the filtering rules matched by the stage, if any.
+	Rules []*traceRule `json:"rules,omitempty"`
+}
+
+// requestTrace collects the decisions made while processing a request in the
+// dry-run mode.  A nil *requestTrace is valid and records nothing, so that the
+// processing functions could use it unconditionally.
+type requestTrace struct {
+	// steps are the recorded decisions in the order they were made.
+	steps []*traceStep
+
+	// resolve is true if the traced request should actually be sent to the
+	// upstream servers, so that the response filtering is traced as well.
+	resolve bool
+}
+
+// add records a decision of the stage.  It does nothing if t is nil.
+func (t *requestTrace) add(stage string, d traceDecision, format string, args ...any) {
+	if t == nil {
+		return
+	}
+
+	t.steps = append(t.steps, &traceStep{
+		Stage:    stage,
+		Decision: d,
+		Details:  fmt.Sprintf(format, args...),
+	})
+}
+
+// addResult records a decision of the filtering stage based on res.  It does
+// nothing if t is nil.
+func (t *requestTrace) addResult(stage string, res *filtering.Result) {
+	if t == nil {
+		return
+	}
+
+	step := &traceStep{
+		Stage:    stage,
+		Decision: traceDecisionPass,
+		Details:  "no rules matched",
+	}
+
+	if res != nil {
+		step.Decision, step.Details = describeResult(res)
+		step.Reason = res.Reason.String()
+		for _, r := range res.Rules {
+			step.Rules = append(step.Rules, &traceRule{
+				Text:         r.Text,
+				FilterListID: int(r.FilterListID),
+			})
+		}
+	}
+
+	t.steps = append(t.steps, step)
+}
+
+// describeResult returns the trace decision and its description for the
+// filtering result.  res must not be nil.
+func describeResult(res *filtering.Result) (d traceDecision, details string) {
+	switch res.Reason {
+	case filtering.NotFilteredNotFound:
+		return traceDecisionPass, "no rules matched"
+	case filtering.NotFilteredAllowList:
+		return traceDecisionAllow, "explicitly allowed by an allowlist rule"
+	case filtering.FilteredBlockedService:
+		return traceDecisionBlock, fmt.Sprintf("blocked service %q", res.ServiceName)
+	case filtering.FilteredCategory:
+		return traceDecisionBlock, fmt.Sprintf("blocked category %q", res.Category)
+	case filtering.FilteredSafeSearch:
+		return traceDecisionRewrite, fmt.Sprintf("safe search rewrite to %q", res.CanonName)
+	case
+		filtering.Rewritten,
+		filtering.RewrittenRule,
+		filtering.RewrittenAutoHosts:
+		return traceDecisionRewrite, describeRewrite(res)
+	default:
+		if res.IsFiltered {
+			return traceDecisionBlock, fmt.Sprintf("blocked by %s", res.Reason)
+		}
+
+		return traceDecisionPass, fmt.Sprintf("matched with reason %s", res.Reason)
+	}
+}
+
+// describeRewrite returns a human-readable description of the rewrite result.
+func describeRewrite(res *filtering.Result) (details string) {
+	parts := []string{fmt.Sprintf("rewritten by %s", res.Reason)}
+	if res.CanonName != "" {
+		parts = append(parts, fmt.Sprintf("cname %q", res.CanonName))
+	}
+
+	if len(res.IPList) > 0 {
+		parts = append(parts, fmt.Sprintf("ips %v", res.IPList))
+	}
+
+	if dr := res.DNSRewriteResult; dr != nil {
+		parts = append(parts, fmt.Sprintf("rcode %s", dns.RcodeToString[dr.RCode]))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// traceResp is the response to the GET /control/dns_trace HTTP API.
+type traceResp struct {
+	// Steps are the decisions made while processing the request, in order.
+	Steps []*traceStep `json:"steps"`
+
+	// Reason is the final filtering reason of the request.
+	Reason string `json:"reason"`
+
+	// Rcode is the response code of the resulting response, if there is one.
+	Rcode string `json:"rcode,omitempty"`
+
+	// Answer is the answer section of the resulting response, if there is
+	// one.
+	Answer []string `json:"answer,omitempty"`
+}
+
+// handleTrace is the handler for the GET /control/dns_trace HTTP API.  It
+// processes a request for the domain in the dry-run mode and returns every
+// decision made along the way.
+func (s *Server) handleTrace(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	host := query.Get("name")
+	if host == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, `query parameter "name" is required`)
+
+		return
+	}
+
+	qTypeStr := query.Get("qtype")
+	qType, err := traceQType(qTypeStr)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "bad qtype query parameter: %q", qTypeStr)
+
+		return
+	}
+
+	cliAddr, clientID, err := traceClient(query.Get("client"))
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "bad client query parameter: %s", err)
+
+		return
+	}
+
+	resolve, _ := strconv.ParseBool(query.Get("resolve"))
+
+	resp, err := s.trace(host, qType, cliAddr, clientID, resolve)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "tracing %q: %s", host, err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// traceQType converts the string to a DNS type.  If the string is empty, it
+// returns [dns.TypeA].
+func traceQType(str string) (qtype uint16, err error) {
+	if str == "" {
+		return dns.TypeA, nil
+	}
+
+	qtype, ok := dns.StringToType[strings.ToUpper(str)]
+	if !ok {
+		return 0, errors.ErrBadEnumValue
+	}
+
+	return qtype, nil
+}
+
+// traceClient parses the client identifier, which is either an IP address or
+// a ClientID.  If cli is empty, the loopback address is used.
+func traceClient(cli string) (addr netip.Addr, clientID string, err error) {
+	if cli == "" {
+		return netutil.IPv4Localhost(), "", nil
+	}
+
+	addr, err = netip.ParseAddr(cli)
+	if err == nil {
+		return addr, "", nil
+	}
+
+	err = client.ValidateClientID(cli)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return netip.Addr{}, "", err
+	}
+
+	return netip.IPv4Unspecified(), cli, nil
+}
+
+// trace processes a request for host in the dry-run mode.  The request isn't
+// logged, doesn't affect the statistics, and isn't sent to the upstream servers
+// unless resolve is true.
+func (s *Server) trace(
+	host string,
+	qtype uint16,
+	cliAddr netip.Addr,
+	clientID string,
+	resolve bool,
+) (resp *traceResp, err error) {
+	if !s.IsRunning() {
+		return nil, srvClosedErr
+	}
+
+	req := &dns.Msg{
+		MsgHdr: dns.MsgHdr{
+			Id:               dns.Id(),
+			RecursionDesired: true,
+		},
+		Question: []dns.Question{{
+			Name:   dns.Fqdn(host),
+			Qtype:  qtype,
+			Qclass: dns.ClassINET,
+		}},
+	}
+
+	pctx := &proxy.DNSContext{
+		Proto:           proxy.ProtoUDP,
+		Req:             req,
+		Addr:            netip.AddrPortFrom(cliAddr, 0),
+		IsPrivateClient: s.privateNets.Contains(cliAddr),
+	}
+	if clientID != "" {
+		pctx.Proto = proxy.ProtoHTTPS
+		pctx.IsPrivateClient = false
+	}
+
+	if qtype == dns.TypePTR && pctx.IsPrivateClient {
+		pctx.RequestedPrivateRDNS = s.privateRDNSPrefix(req.Question[0].Name)
+	}
+
+	dctx := &dnsContext{
+		proxyCtx: pctx,
+		result:   &filtering.Result{},
+		clientID: clientID,
+		trace:    &requestTrace{resolve: resolve},
+	}
+
+	err = s.traceRequest(dctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTraceResp(dctx), nil
+}
+
+// privateRDNSPrefix returns the prefix for the PTR request name if it's within
+// the locally-served networks.
+func (s *Server) privateRDNSPrefix(name string) (pref netip.Prefix) {
+	pref, err := netutil.ExtractReversedAddr(name)
+	if err != nil || !s.privateNets.Contains(pref.Addr()) {
+		return netip.Prefix{}
+	}
+
+	return pref
+}
+
+// traceRequest runs the processing pipeline for the traced request.  It skips
+// the stages with side effects, like the query log, statistics, and ipset.
+func (s *Server) traceRequest(dctx *dnsContext) (err error) {
+	if s.traceAccess(dctx) {
+		return nil
+	}
+
+	mods := []func(dctx *dnsContext) (rc resultCode){
+		s.processInitial,
+		s.processDDRQuery,
+		s.processLocalZone,
+		s.processDHCPHosts,
+		s.processDHCPAddrs,
+		s.processFilteringBeforeRequest,
+		s.processUpstream,
+		s.processFilteringAfterResponse,
+	}
+	for _, process := range mods {
+		switch process(dctx) {
+		case resultCodeSuccess:
+			// Go on.
+		case resultCodeFinish:
+			return nil
+		case resultCodeError:
+			return dctx.err
+		}
+	}
+
+	return nil
+}
+
+// traceAccess records the access settings decision for the traced request,
+// including the bans of the ClientID guessers, the public hardening, and the
+// quotas.  It returns true if the request is blocked.  Unlike
+// [Server.HandleBefore], it neither counts the request against the quota nor
+// records the unknown ClientIDs.
+func (s *Server) traceAccess(dctx *dnsContext) (blocked bool) {
+	pctx := dctx.proxyCtx
+	t := dctx.trace
+	cliIP := pctx.Addr.Addr()
+	clientID := dctx.clientID
+	now := time.Now()
+
+	if s.clientIDGuard.banned(cliIP, now) {
+		t.add(traceStageAccess, traceDecisionBlock, "client is banned for guessing clientids")
+
+		return true
+	}
+
+	blocked, rule := s.IsBlockedClient(cliIP, clientID)
+	if blocked {
+		t.add(traceStageAccess, traceDecisionBlock, "client is blocked by access settings: %q", rule)
+
+		return true
+	}
+
+	persistent := clientID != "" && s.conf.ClientsContainer.HasClientID(clientID)
+	if s.refusedByHardening(pctx, persistent) {
+		t.add(traceStageAccess, traceDecisionBlock, "request is refused by public hardening")
+
+		return true
+	}
+
+	if persistent && s.quotas.exceeded(clientID, now) {
+		t.add(traceStageAccess, traceDecisionBlock, "clientid %q has exceeded its quota", clientID)
+
+		return true
+	}
+
+	q := pctx.Req.Question[0]
+	host := aghnet.NormalizeDomain(q.Name)
+
+	s.serverLock.RLock()
+	blocked = s.access.isBlockedHost(host, q.Qtype)
+	s.serverLock.RUnlock()
+
+	if blocked {
+		t.add(traceStageAccess, traceDecisionBlock, "host is in the blocked hosts list")
+
+		return true
+	}
+
+	t.add(traceStageAccess, traceDecisionPass, "client and host are allowed")
+
+	return false
+}
+
+// traceSettings records the client-specific filtering settings.  It does
+// nothing if t is nil.
+func traceSettings(t *requestTrace, setts *filtering.Settings) {
+	if t == nil {
+		return
+	}
+
+	name := setts.ClientName
+	if name == "" {
+		name = "global settings"
+	}
+
+	t.add(
+		traceStageClient,
+		traceDecisionPass,
+		"%s, tags %v: filtering %t, safe search %t, safe browsing %t, parental %t",
+		name,
+		setts.ClientTags,
+		setts.FilteringEnabled,
+		setts.SafeSearchEnabled,
+		setts.SafeBrowsingEnabled,
+		setts.ParentalEnabled,
+	)
+
+	bs := setts.BlockedServices
+	if bs == nil || len(bs.IDs) == 0 {
+		return
+	}
+
+	if len(setts.ServicesRules) == 0 {
+		t.add(traceStageClient, traceDecisionSkip, "blocked services %v are paused by schedule", bs.IDs)
+	} else {
+		t.add(traceStageClient, traceDecisionPass, "blocked services %v are active", bs.IDs)
+	}
+}
+
+// traceUpstream records the upstream servers that would be used for the
+// traced request.
+func (s *Server) traceUpstream(dctx *dnsContext) {
+	pctx := dctx.proxyCtx
+	t := dctx.trace
+	if pctx.CustomUpstreamConfig != nil {
+		t.add(traceStageUpstream, traceDecisionPass, "using custom upstreams of the client")
+
+		return
+	}
+
+	if pctx.RequestedPrivateRDNS != (netip.Prefix{}) {
+		t.add(traceStageUpstream, traceDecisionPass, "using private reverse dns upstreams")
+
+		return
+	}
+
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	name := pctx.Req.Question[0].Name
+	domain, ups := upstreamsForDomain(s.conf.UpstreamConfig, name)
+	if domain == "" {
+		t.add(traceStageUpstream, traceDecisionPass, "using default upstreams %s", upstreamAddrs(ups))
+
+		return
+	}
+
+	source := "upstream configuration"
+	if s.rulesetDomains.Has(domain) {
+		source = "alternate upstream rulesets"
+	}
+
+	t.add(
+		traceStageUpstream,
+		traceDecisionPass,
+		"using upstreams %s for domain %q from %s",
+		upstreamAddrs(ups),
+		domain,
+		source,
+	)
+}
+
+// upstreamsForDomain returns the upstreams used for fqdn along with the domain
+// that matched the domain-specific upstreams.  domain is empty if the default
+// upstreams are used.  It mirrors the upstream selection of [proxy.Proxy].
+func upstreamsForDomain(
+	uc *proxy.UpstreamConfig,
+	fqdn string,
+) (domain string, ups []upstream.Upstream) {
+	if uc == nil {
+		return "", nil
+	}
+
+	fqdn = strings.ToLower(fqdn)
+	if uc.SubdomainExclusions.Has(fqdn) {
+		if ups = uc.SpecifiedDomainUpstreams[fqdn]; len(ups) > 0 {
+			return fqdn, ups
+		}
+
+		_, parent, _ := strings.Cut(fqdn, ".")
+		if ups = uc.DomainReservedUpstreams[parent]; len(ups) > 0 {
+			return parent, ups
+		}
+
+		return "", uc.Upstreams
+	}
+
+	for name := fqdn; name != ""; _, name, _ = strings.Cut(name, ".") {
+		var ok bool
+		ups, ok = uc.DomainReservedUpstreams[name]
+		if !ok {
+			continue
+		} else if len(ups) == 0 {
+			// The domain has been excluded from reserved upstreams.
+			return "", uc.Upstreams
+		}
+
+		return name, ups
+	}
+
+	return "", uc.Upstreams
+}
+
+// upstreamAddrs returns the addresses of the upstreams as a string.
+func upstreamAddrs(ups []upstream.Upstream) (addrs string) {
+	strs := make([]string, 0, len(ups))
+	for _, u := range ups {
+		strs = append(strs, u.Address())
+	}
+
+	return "[" + strings.Join(strs, ", ") + "]"
+}
+
+// newTraceResp returns the trace response for the processed dctx.
+func newTraceResp(dctx *dnsContext) (resp *traceResp) {
+	resp = &traceResp{
+		Steps:  dctx.trace.steps,
+		Reason: dctx.result.Reason.String(),
+	}
+
+	res := dctx.proxyCtx.Res
+	if res == nil {
+		return resp
+	}
+
+	resp.Rcode = dns.RcodeToString[res.Rcode]
+	for _, rr := range res.Answer {
+		resp.Answer = append(resp.Answer, rr.String())
+	}
+
+	return resp
+}
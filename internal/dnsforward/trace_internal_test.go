@@ -0,0 +1,292 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTraceTestServer is a helper that returns a started server for tracing
+// tests.
+func newTraceTestServer(t *testing.T, blockedHosts []string) (s *Server) {
+	t.Helper()
+
+	forwardConf := ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamDNS:  []string{"127.0.0.1:53"},
+			UpstreamMode: UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{
+				Enabled: false,
+			},
+			ClientsContainer: EmptyClientsContainer{},
+			BlockedHosts:     blockedHosts,
+		},
+		ServePlainDNS: true,
+	}
+
+	s = createTestServer(t, &filtering.Config{
+		ProtectionEnabled: true,
+		BlockingMode:      filtering.BlockingModeDefault,
+	}, forwardConf)
+	startDeferStop(t, s)
+
+	return s
+}
+
+// lastStep returns the last trace step of the given stage.
+func lastStep(tb testing.TB, resp *traceResp, stage string) (step *traceStep) {
+	tb.Helper()
+
+	for _, st := range resp.Steps {
+		if st.Stage == stage {
+			step = st
+		}
+	}
+
+	require.NotNilf(tb, step, "no step %q", stage)
+
+	return step
+}
+
+func TestServer_trace(t *testing.T) {
+	s := newTraceTestServer(t, []string{"blocked-host.example"})
+
+	cliAddr := netip.MustParseAddr("192.0.2.1")
+
+	testCases := []struct {
+		name         string
+		host         string
+		wantStage    string
+		wantDecision traceDecision
+		wantReason   string
+	}{{
+		name:         "blocked_host",
+		host:         "blocked-host.example",
+		wantStage:    traceStageAccess,
+		wantDecision: traceDecisionBlock,
+		wantReason:   "NotFilteredNotFound",
+	}, {
+		name:         "filtered",
+		host:         "nxdomain.example.org",
+		wantStage:    traceStageFilteringReq,
+		wantDecision: traceDecisionBlock,
+		wantReason:   "FilteredBlackList",
+	}, {
+		name:         "allowed",
+		host:         "whitelist.example.org",
+		wantStage:    traceStageFilteringReq,
+		wantDecision: traceDecisionAllow,
+		wantReason:   "NotFilteredWhiteList",
+	}, {
+		name:         "dry_run",
+		host:         "example.com",
+		wantStage:    traceStageResolve,
+		wantDecision: traceDecisionSkip,
+		wantReason:   "NotFilteredNotFound",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := s.trace(tc.host, dns.TypeA, cliAddr, "", false)
+			require.NoError(t, err)
+
+			step := lastStep(t, resp, tc.wantStage)
+			assert.Equal(t, tc.wantDecision, step.Decision)
+			assert.Equal(t, tc.wantReason, resp.Reason)
+		})
+	}
+
+	t.Run("filtered_response", func(t *testing.T) {
+		resp, err := s.trace("nxdomain.example.org", dns.TypeA, cliAddr, "", false)
+		require.NoError(t, err)
+
+		assert.Equal(t, "NOERROR", resp.Rcode)
+		require.Len(t, resp.Answer, 1)
+
+		step := lastStep(t, resp, traceStageFilteringReq)
+		require.Len(t, step.Rules, 1)
+
+		assert.Equal(t, "||nxdomain.example.org", step.Rules[0].Text)
+	})
+}
+
+func TestServer_trace_access(t *testing.T) {
+	const knownClientID = "known"
+
+	s := createTestServer(t, &filtering.Config{
+		BlockingMode: filtering.BlockingModeDefault,
+	}, ServerConfig{
+		UDPListenAddrs: []*net.UDPAddr{{}},
+		TCPListenAddrs: []*net.TCPAddr{{}},
+		TLSConf:        &TLSConfig{},
+		Config: Config{
+			UpstreamDNS:      []string{"127.0.0.1:53"},
+			UpstreamMode:     UpstreamModeLoadBalance,
+			EDNSClientSubnet: &EDNSClientSubnet{Enabled: false},
+			PublicHardening: &PublicHardeningConfig{
+				DailyQuota: 1,
+				Enabled:    true,
+			},
+			ClientsContainer: &clientsContainer{
+				OnCustomUpstreamConfig: func(
+					_ string,
+					_ netip.Addr,
+				) (conf *proxy.CustomUpstreamConfig) {
+					return nil
+				},
+				OnUpdateCommonUpstreamConfig: func(_ *client.CommonUpstreamConfig) {},
+				OnClearUpstreamCache:         func() {},
+				OnMarkActive:                 func(_ netip.Addr) {},
+				OnHasClientID: func(clientID string) (ok bool) {
+					return clientID == knownClientID
+				},
+			},
+		},
+		ServePlainDNS: true,
+	})
+	startDeferStop(t, s)
+
+	bannedAddr := netip.MustParseAddr("192.168.1.2")
+	privateAddr := netip.MustParseAddr("192.168.1.1")
+
+	s.clientIDGuard.setLimits(1, time.Hour, 64)
+	for range 2 {
+		s.clientIDGuard.fail(bannedAddr, "unknown", time.Now())
+	}
+
+	assertAccess := func(
+		t *testing.T,
+		cliAddr netip.Addr,
+		clientID string,
+		wantDecision traceDecision,
+		wantMsg string,
+	) {
+		t.Helper()
+
+		resp, err := s.trace(testFQDN, dns.TypeA, cliAddr, clientID, false)
+		require.NoError(t, err)
+
+		step := lastStep(t, resp, traceStageAccess)
+		assert.Equal(t, wantDecision, step.Decision)
+		assert.Equal(t, wantMsg, step.Details)
+	}
+
+	t.Run("banned", func(t *testing.T) {
+		assertAccess(
+			t,
+			bannedAddr,
+			"",
+			traceDecisionBlock,
+			"client is banned for guessing clientids",
+		)
+	})
+
+	t.Run("plain_public", func(t *testing.T) {
+		assertAccess(
+			t,
+			netip.MustParseAddr("1.2.3.4"),
+			"",
+			traceDecisionBlock,
+			"request is refused by public hardening",
+		)
+	})
+
+	t.Run("plain_private", func(t *testing.T) {
+		assertAccess(t, privateAddr, "", traceDecisionPass, "client and host are allowed")
+	})
+
+	t.Run("unknown_clientid", func(t *testing.T) {
+		assertAccess(
+			t,
+			netip.IPv4Unspecified(),
+			"unknown",
+			traceDecisionBlock,
+			"request is refused by public hardening",
+		)
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		// Tracing doesn't count the request against the quota.
+		assertAccess(t, netip.IPv4Unspecified(), knownClientID, traceDecisionPass, "client and host are allowed")
+		assertAccess(t, netip.IPv4Unspecified(), knownClientID, traceDecisionPass, "client and host are allowed")
+
+		require.True(t, s.quotas.consume(knownClientID, time.Now()))
+
+		assertAccess(
+			t,
+			netip.IPv4Unspecified(),
+			knownClientID,
+			traceDecisionBlock,
+			`clientid "known" has exceeded its quota`,
+		)
+	})
+}
+
+func TestUpstreamsForDomain(t *testing.T) {
+	uc, err := proxy.ParseUpstreamsConfig([]string{
+		"1.1.1.1",
+		"[/example.org/]2.2.2.2",
+		"[/*.sub.example.org/]3.3.3.3",
+		"[/excluded.example.org/]#",
+	}, &upstream.Options{})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		fqdn       string
+		wantDomain string
+		wantAddr   string
+	}{{
+		name:       "default",
+		fqdn:       "example.com.",
+		wantDomain: "",
+		wantAddr:   "1.1.1.1:53",
+	}, {
+		name:       "exact",
+		fqdn:       "example.org.",
+		wantDomain: "example.org.",
+		wantAddr:   "2.2.2.2:53",
+	}, {
+		name:       "subdomain",
+		fqdn:       "www.example.org.",
+		wantDomain: "example.org.",
+		wantAddr:   "2.2.2.2:53",
+	}, {
+		name:       "excluded",
+		fqdn:       "excluded.example.org.",
+		wantDomain: "",
+		wantAddr:   "1.1.1.1:53",
+	}, {
+		name:       "wildcard",
+		fqdn:       "a.sub.example.org.",
+		wantDomain: "sub.example.org.",
+		wantAddr:   "3.3.3.3:53",
+	}, {
+		name:       "wildcard_parent",
+		fqdn:       "sub.example.org.",
+		wantDomain: "example.org.",
+		wantAddr:   "2.2.2.2:53",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			domain, ups := upstreamsForDomain(uc, tc.fqdn)
+			assert.Equal(t, tc.wantDomain, domain)
+
+			require.Len(t, ups, 1)
+			assert.Equal(t, tc.wantAddr, ups[0].Address())
+		})
+	}
+}
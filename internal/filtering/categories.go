@@ -0,0 +1,194 @@
+package filtering
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/category"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/ruleset"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// categoriesDir is the name of the directory within the data directory where
+// the downloaded category lists are stored.
+const categoriesDir = "categories"
+
+// CategorySource is a source of the list of domains of a category.  Several
+// sources may have the same name, in which case their lists are merged.
+type CategorySource struct {
+	// Name is the name of the category, for example "gambling".
+	Name string `yaml:"name"`
+
+	// Path is the path to a local file with the list of domains.  Either Path
+	// or URL must be set.
+	Path string `yaml:"path,omitempty"`
+
+	// URL is the URL the list of domains is downloaded from.  The downloaded
+	// lists are cached the same way the rulesets are.
+	URL string `yaml:"url,omitempty"`
+}
+
+// validate returns an error if s isn't valid.
+func (s *CategorySource) validate() (err error) {
+	switch {
+	case s == nil:
+		return errors.ErrNoValue
+	case s.Name == "":
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case (s.Path == "") == (s.URL == ""):
+		return errors.Error("exactly one of path and url must be set")
+	default:
+		return nil
+	}
+}
+
+// BlockedCategories is the configuration of blocked domain categories.
+type BlockedCategories struct {
+	// Schedule is blocked categories schedule for every day of the week.
+	Schedule *schedule.Weekly `json:"schedule" yaml:"schedule"`
+
+	// IDs are the names of blocked categories.
+	IDs []string `json:"ids" yaml:"ids"`
+}
+
+// Clone returns a deep copy of blocked categories.
+func (c *BlockedCategories) Clone() (clone *BlockedCategories) {
+	if c == nil {
+		return nil
+	}
+
+	return &BlockedCategories{
+		Schedule: c.Schedule.Clone(),
+		IDs:      slices.Clone(c.IDs),
+	}
+}
+
+// blocked returns the names of the categories blocked at now.  c may be nil.
+func (c *BlockedCategories) blocked(now time.Time) (ids []string) {
+	if c == nil || (c.Schedule != nil && c.Schedule.Contains(now)) {
+		return nil
+	}
+
+	return slices.Clone(c.IDs)
+}
+
+// validateCategories returns an error if c contains a category not provided by
+// any of the sources.  c must not be nil.
+func validateCategories(c *BlockedCategories, sources []*CategorySource) (err error) {
+	for _, id := range c.IDs {
+		known := slices.ContainsFunc(sources, func(s *CategorySource) (ok bool) {
+			return s.Name == id
+		})
+		if !known {
+			return fmt.Errorf("unknown category %q", id)
+		}
+	}
+
+	return nil
+}
+
+// ValidateBlockedCategories returns an error if c contains a category unknown
+// to d.  c must not be nil.
+func (d *DNSFilter) ValidateBlockedCategories(c *BlockedCategories) (err error) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	return validateCategories(c, d.conf.CategorySources)
+}
+
+// loadCategories reads the category lists from the configured sources,
+// downloading the remote ones if necessary, and replaces the current category
+// matcher.  The sources that fail to load are skipped.
+func (d *DNSFilter) loadCategories() {
+	var sources []*CategorySource
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		sources = slices.Clone(d.conf.CategorySources)
+	}()
+
+	dir := filepath.Join(d.conf.DataDir, categoriesDir)
+	m := category.NewMatcher()
+	for _, s := range sources {
+		n, err := addCategorySource(m, s, dir)
+		if err != nil {
+			log.Error("filtering: loading category %q: %s", s.Name, err)
+
+			continue
+		}
+
+		log.Debug("filtering: loaded %d domains into category %q", n, s.Name)
+	}
+
+	d.categories.Store(m)
+}
+
+// addCategorySource adds the domains from the list of s to m.  dir is the
+// directory to download the remote lists into.
+func addCategorySource(m *category.Matcher, s *CategorySource, dir string) (n int, err error) {
+	path := s.Path
+	if s.URL != "" {
+		path, err = ruleset.Download(dir, s.URL)
+		if err != nil {
+			return 0, fmt.Errorf("downloading: %w", err)
+		}
+	}
+
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return 0, fmt.Errorf("opening: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	return m.Add(s.Name, f)
+}
+
+// applyBlockedCategories sets the globally blocked categories in setts.
+func (d *DNSFilter) applyBlockedCategories(setts *Settings) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	setts.Categories = d.conf.BlockedCategories.blocked(time.Now())
+}
+
+// matchCategories checks the host against the blocked categories in settings,
+// if any.  The err is always nil, it is only there to make this a valid
+// hostChecker function.
+func (d *DNSFilter) matchCategories(
+	host string,
+	_ uint16,
+	setts *Settings,
+) (res Result, err error) {
+	if !setts.ProtectionEnabled || len(setts.Categories) == 0 {
+		return Result{}, nil
+	}
+
+	m := d.categories.Load()
+	if m == nil {
+		return Result{}, nil
+	}
+
+	name, domain, ok := m.Match(host, setts.Categories)
+	if !ok {
+		return Result{}, nil
+	}
+
+	log.Debug("categories: matched domain %q for host %q, category %q", domain, host, name)
+
+	return Result{
+		Rules: []*ResultRule{{
+			Text:         "||" + domain + "^",
+			FilterListID: rulelist.URLFilterIDCategory,
+		}},
+		Category:   name,
+		Reason:     FilteredCategory,
+		IsFiltered: true,
+	}, nil
+}
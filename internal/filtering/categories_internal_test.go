@@ -0,0 +1,118 @@
+package filtering
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_matchCategories(t *testing.T) {
+	const (
+		gambling = "gambling"
+		adult    = "adult"
+	)
+
+	dir := t.TempDir()
+	gamblingPath := filepath.Join(dir, "gambling.txt")
+	err := os.WriteFile(gamblingPath, []byte("casino.example\n"), 0o600)
+	require.NoError(t, err)
+
+	adultPath := filepath.Join(dir, "adult.txt")
+	err = os.WriteFile(adultPath, []byte("0.0.0.0 adult.example\n"), 0o600)
+	require.NoError(t, err)
+
+	ownCliAddr := netip.MustParseAddr("192.0.2.1")
+	otherCliAddr := netip.MustParseAddr("192.0.2.2")
+
+	d, _ := newForTest(t, &Config{
+		DataDir: dir,
+		CategorySources: []*CategorySource{{
+			Name: gambling,
+			Path: gamblingPath,
+		}, {
+			Name: adult,
+			Path: adultPath,
+		}},
+		BlockedCategories: &BlockedCategories{
+			Schedule: schedule.EmptyWeekly(),
+			IDs:      []string{gambling},
+		},
+		ApplyClientFiltering: func(_ string, addr netip.Addr, setts *Settings) {
+			if addr == ownCliAddr {
+				setts.BlockedCategories = &BlockedCategories{
+					IDs: []string{adult},
+				}
+			}
+		},
+		BlockedServices: &BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+		},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	d.loadCategories()
+
+	testCases := []struct {
+		cliAddr    netip.Addr
+		name       string
+		host       string
+		wantCat    string
+		wantReason Reason
+	}{{
+		cliAddr:    otherCliAddr,
+		name:       "global_blocked",
+		host:       "www.casino.example",
+		wantCat:    gambling,
+		wantReason: FilteredCategory,
+	}, {
+		cliAddr:    otherCliAddr,
+		name:       "global_not_blocked",
+		host:       "adult.example",
+		wantCat:    "",
+		wantReason: NotFilteredNotFound,
+	}, {
+		cliAddr:    ownCliAddr,
+		name:       "client_blocked",
+		host:       "adult.example",
+		wantCat:    adult,
+		wantReason: FilteredCategory,
+	}, {
+		cliAddr:    ownCliAddr,
+		name:       "client_not_blocked",
+		host:       "casino.example",
+		wantCat:    "",
+		wantReason: NotFilteredNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setts := &Settings{
+				ProtectionEnabled: true,
+				FilteringEnabled:  true,
+			}
+			d.ApplyAdditionalFiltering(tc.cliAddr, "", setts)
+
+			res, checkErr := d.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, checkErr)
+
+			assert.Equal(t, tc.wantReason, res.Reason)
+			assert.Equal(t, tc.wantCat, res.Category)
+
+			if tc.wantReason == FilteredCategory {
+				require.Len(t, res.Rules, 1)
+
+				assert.Equal(t, rulelist.URLFilterIDCategory, res.Rules[0].FilterListID)
+			}
+		})
+	}
+
+	err = d.ValidateBlockedCategories(&BlockedCategories{IDs: []string{"unknown"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package filtering
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/category"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// categoriesAllJSON is the response to the GET /control/categories/all HTTP
+// API.
+type categoriesAllJSON struct {
+	Categories []*category.Info `json:"categories"`
+}
+
+// handleCategoriesAll is the handler for the GET /control/categories/all HTTP
+// API.
+func (d *DNSFilter) handleCategoriesAll(w http.ResponseWriter, r *http.Request) {
+	resp := &categoriesAllJSON{
+		Categories: []*category.Info{},
+	}
+
+	if m := d.categories.Load(); m != nil {
+		resp.Categories = m.Infos()
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleCategoriesGet is the handler for the GET /control/categories/get HTTP
+// API.
+func (d *DNSFilter) handleCategoriesGet(w http.ResponseWriter, r *http.Request) {
+	var bc *BlockedCategories
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		bc = d.conf.BlockedCategories.Clone()
+	}()
+
+	if bc == nil {
+		bc = &BlockedCategories{
+			Schedule: schedule.EmptyWeekly(),
+			IDs:      []string{},
+		}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, bc)
+}
+
+// handleCategoriesUpdate is the handler for the PUT /control/categories/update
+// HTTP API.
+func (d *DNSFilter) handleCategoriesUpdate(w http.ResponseWriter, r *http.Request) {
+	bc := &BlockedCategories{}
+	err := json.NewDecoder(r.Body).Decode(bc)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	if bc.Schedule == nil {
+		bc.Schedule = schedule.EmptyWeekly()
+	}
+
+	err = func() (err error) {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		err = validateCategories(bc, d.conf.CategorySources)
+		if err != nil {
+			return err
+		}
+
+		d.conf.BlockedCategories = bc
+
+		return nil
+	}()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "validating: %s", err)
+
+		return
+	}
+
+	log.Debug("filtering: updated blocked categories: %d", len(bc.IDs))
+
+	d.conf.ConfigModified()
+}
+
+// handleCategoriesReload is the handler for the POST
+// /control/categories/reload HTTP API.
+func (d *DNSFilter) handleCategoriesReload(w http.ResponseWriter, r *http.Request) {
+	d.loadCategories()
+
+	d.handleCategoriesAll(w, r)
+}
@@ -0,0 +1,186 @@
+// Package category contains the matcher of domain names against the lists of
+// domains grouped by categories, such as "gambling" or "adult".
+package category
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// MaxCount is the maximum number of categories a single [Matcher] may
+// contain.
+const MaxCount = 64
+
+// ErrTooMany is returned by [Matcher.Add] when the matcher already contains
+// [MaxCount] categories.
+const ErrTooMany errors.Error = "too many categories"
+
+// Matcher matches domain names against the category lists.  A domain name
+// belongs to a category if either the name itself or any of its parent domains
+// is in the list of the category.  A Matcher must not be modified after it's
+// been shared, matching is safe for concurrent use.
+type Matcher struct {
+	// domains maps the domain names to the bit sets of their categories.
+	domains map[string]uint64
+
+	// names are the names of the categories in the order of their bits.
+	names []string
+
+	// counts are the numbers of domains in each category in the order of
+	// their bits.
+	counts []int
+}
+
+// NewMatcher returns a new empty *Matcher.
+func NewMatcher() (m *Matcher) {
+	return &Matcher{
+		domains: map[string]uint64{},
+	}
+}
+
+// Add reads the list of domains from r and adds them to the category with the
+// given name, creating it if necessary.  Each line of the list is either a
+// domain name, a hosts-file entry, or an "||domain^" blocking rule; the empty
+// lines and the ones starting with "#" or "!" are ignored, as well as the lines
+// that don't contain a valid domain name.  n is the number of domains added.
+func (m *Matcher) Add(name string, r io.Reader) (n int, err error) {
+	if name == "" {
+		return 0, fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	}
+
+	bit, err := m.bit(name)
+	if err != nil {
+		return 0, fmt.Errorf("category %q: %w", name, err)
+	}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		host := parseLine(s.Text())
+		if host == "" || m.domains[host]&bit != 0 {
+			continue
+		}
+
+		m.domains[host] |= bit
+		n++
+	}
+
+	err = s.Err()
+	if err != nil {
+		return n, fmt.Errorf("category %q: reading: %w", name, err)
+	}
+
+	m.counts[bits.TrailingZeros64(bit)] += n
+
+	return n, nil
+}
+
+// bit returns the bit of the category with the given name, adding it if
+// necessary.
+func (m *Matcher) bit(name string) (bit uint64, err error) {
+	if i := slices.Index(m.names, name); i >= 0 {
+		return 1 << i, nil
+	}
+
+	if len(m.names) >= MaxCount {
+		return 0, ErrTooMany
+	}
+
+	m.names = append(m.names, name)
+	m.counts = append(m.counts, 0)
+
+	return 1 << (len(m.names) - 1), nil
+}
+
+// parseLine returns the normalized domain name from the line of a category
+// list or an empty string if there is none.
+func parseLine(line string) (host string) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == '!' {
+		return ""
+	}
+
+	fields := strings.Fields(line)
+	host = fields[0]
+	if len(fields) > 1 {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return ""
+		}
+
+		// A hosts-file entry.
+		host = fields[1]
+	}
+
+	host = strings.TrimPrefix(host, "||")
+	host = strings.TrimSuffix(host, "^")
+	host = strings.TrimPrefix(host, "*.")
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if netutil.ValidateDomainName(host) != nil {
+		return ""
+	}
+
+	return host
+}
+
+// Info is the information about a single category.
+type Info struct {
+	// Name is the name of the category.
+	Name string `json:"name"`
+
+	// Domains is the number of domains in the category.
+	Domains int `json:"domains"`
+}
+
+// Infos returns the information about all categories in the order they have
+// been added.
+func (m *Matcher) Infos() (infos []*Info) {
+	infos = make([]*Info, 0, len(m.names))
+	for i, name := range m.names {
+		infos = append(infos, &Info{
+			Name:    name,
+			Domains: m.counts[i],
+		})
+	}
+
+	return infos
+}
+
+// Match returns the name of the category from names that host belongs to and
+// the matched domain, which is either host or one of its parent domains.  If
+// host belongs to several of them, the first added category wins.  ok is false
+// if host doesn't belong to any of names.  host must be lowercased.
+func (m *Matcher) Match(host string, names []string) (name, domain string, ok bool) {
+	var mask uint64
+	for i, n := range m.names {
+		if slices.Contains(names, n) {
+			mask |= 1 << i
+		}
+	}
+
+	if mask == 0 {
+		return "", "", false
+	}
+
+	for domain = host; domain != ""; {
+		if set := m.domains[domain] & mask; set != 0 {
+			return m.names[bits.TrailingZeros64(set)], domain, true
+		}
+
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			break
+		}
+
+		domain = domain[i+1:]
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,119 @@
+package category_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/category"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatcher(t *testing.T) {
+	const (
+		gambling = "gambling"
+		adult    = "adult"
+	)
+
+	m := category.NewMatcher()
+
+	n, err := m.Add(gambling, strings.NewReader(`# Comment.
+! Another comment.
+
+casino.example
+0.0.0.0 Poker.Example.
+||bets.example^
+*.lottery.example
+not a domain
+casino.example
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, n)
+
+	n, err = m.Add(adult, strings.NewReader("casino.example\nadult.example\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, []*category.Info{{
+		Name:    gambling,
+		Domains: 4,
+	}, {
+		Name:    adult,
+		Domains: 2,
+	}}, m.Infos())
+
+	testCases := []struct {
+		name       string
+		host       string
+		wantName   string
+		wantDomain string
+		names      []string
+		wantOK     bool
+	}{{
+		name:       "exact",
+		host:       "poker.example",
+		names:      []string{gambling},
+		wantName:   gambling,
+		wantDomain: "poker.example",
+		wantOK:     true,
+	}, {
+		name:       "subdomain",
+		host:       "www.bets.example",
+		names:      []string{gambling, adult},
+		wantName:   gambling,
+		wantDomain: "bets.example",
+		wantOK:     true,
+	}, {
+		name:       "first_added",
+		host:       "casino.example",
+		names:      []string{adult, gambling},
+		wantName:   gambling,
+		wantDomain: "casino.example",
+		wantOK:     true,
+	}, {
+		name:       "other_category",
+		host:       "casino.example",
+		names:      []string{adult},
+		wantName:   adult,
+		wantDomain: "casino.example",
+		wantOK:     true,
+	}, {
+		name:   "not_selected",
+		host:   "adult.example",
+		names:  []string{gambling},
+		wantOK: false,
+	}, {
+		name:   "unknown_category",
+		host:   "adult.example",
+		names:  []string{"unknown"},
+		wantOK: false,
+	}, {
+		name:   "parent_not_listed",
+		host:   "example",
+		names:  []string{gambling, adult},
+		wantOK: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, domain, ok := m.Match(tc.host, tc.names)
+			require.Equal(t, tc.wantOK, ok)
+
+			assert.Equal(t, tc.wantName, name)
+			assert.Equal(t, tc.wantDomain, domain)
+		})
+	}
+}
+
+func TestMatcher_Add_tooMany(t *testing.T) {
+	m := category.NewMatcher()
+	for i := range category.MaxCount {
+		_, err := m.Add(string(rune('a'+i%26))+strings.Repeat("x", i), strings.NewReader(""))
+		require.NoError(t, err)
+	}
+
+	_, err := m.Add("extra", strings.NewReader(""))
+	assert.ErrorIs(t, err, category.ErrTooMany)
+}
@@ -188,6 +188,28 @@ func (d *DNSFilter) filterExistsLocked(url string) (ok bool) {
 	return false
 }
 
+// FilterListName returns the name of the enabled or disabled filter list with
+// the given ID or an empty string if there is no such list.  It's safe for
+// concurrent use.
+func (d *DNSFilter) FilterListName(id rulelist.URLFilterID) (name string) {
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	for _, f := range d.conf.Filters {
+		if f.ID == id {
+			return f.Name
+		}
+	}
+
+	for _, f := range d.conf.WhitelistFilters {
+		if f.ID == id {
+			return f.Name
+		}
+	}
+
+	return ""
+}
+
 // Add a filter
 // Return FALSE if a filter with this URL exists
 func (d *DNSFilter) filterAdd(flt FilterYAML) (err error) {
@@ -643,8 +665,10 @@ func (d *DNSFilter) enableFiltersLocked(async bool) {
 // blocked services and client-specific configurations.
 func (d *DNSFilter) ApplyAdditionalFiltering(cliAddr netip.Addr, clientID string, setts *Settings) {
 	setts.ClientIP = cliAddr
+	setts.ClientID = clientID
 
 	d.ApplyBlockedServices(setts)
+	d.applyBlockedCategories(setts)
 	d.applyClientFiltering(clientID, cliAddr, setts)
 	if setts.BlockedServices != nil {
 		// TODO(e.burkov):  Get rid of this crutch.
@@ -654,4 +678,8 @@ func (d *DNSFilter) ApplyAdditionalFiltering(cliAddr netip.Addr, clientID string
 			d.ApplyBlockedServicesList(setts, svcs)
 		}
 	}
+
+	if setts.BlockedCategories != nil {
+		setts.Categories = setts.BlockedCategories.blocked(time.Now())
+	}
 }
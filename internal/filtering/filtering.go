@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"net/netip"
@@ -21,6 +22,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/category"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
@@ -45,6 +47,7 @@ type ServiceEntry struct {
 // TODO(s.chzhen):  Move to the client package.
 type Settings struct {
 	ClientName string
+	ClientID   string
 	ClientIP   netip.Addr
 	ClientTags []string
 
@@ -54,6 +57,14 @@ type Settings struct {
 	// is nil if the client does not have any blocked services.
 	BlockedServices *BlockedServices
 
+	// BlockedCategories is the configuration of blocked categories of a
+	// client.  It is nil if the client uses the global blocked categories.
+	BlockedCategories *BlockedCategories
+
+	// Categories are the names of the domain categories blocked for the
+	// request.
+	Categories []string
+
 	ProtectionEnabled   bool
 	FilteringEnabled    bool
 	SafeSearchEnabled   bool
@@ -94,12 +105,25 @@ type Config struct {
 	// Per-client settings can override this configuration.
 	BlockedServices *BlockedServices `yaml:"blocked_services"`
 
+	// BlockedCategories is the configuration of blocked domain categories.
+	// Per-client settings can override this configuration.
+	BlockedCategories *BlockedCategories `yaml:"blocked_categories"`
+
+	// CategorySources are the sources of the lists of domains of the
+	// categories.
+	CategorySources []*CategorySource `yaml:"category_sources"`
+
 	// EtcHosts is a container of IP-hostname pairs taken from the operating
 	// system configuration files (e.g. /etc/hosts).
 	//
 	// TODO(e.burkov):  Move it to dnsforward entirely.
 	EtcHosts hostsfile.Storage `yaml:"-"`
 
+	// ExpireClientOverrides is called periodically to make the persistent
+	// clients stop using their expired settings overrides.  It returns the
+	// number of changed clients.  It may be nil.
+	ExpireClientOverrides func(now time.Time) (n int) `yaml:"-"`
+
 	// Called when the configuration is changed by HTTP request
 	ConfigModified func() `yaml:"-"`
 
@@ -140,6 +164,14 @@ type Config struct {
 
 	Rewrites []*LegacyRewrite `yaml:"rewrites"`
 
+	// UserRulesExpiry maps the texts of the temporary user rules to the times
+	// they expire at.  The rules that aren't present here never expire.
+	UserRulesExpiry map[string]time.Time `yaml:"user_rules_expiry"`
+
+	// UnblockRules are the approved unblock requests.  The expired ones are
+	// removed periodically.
+	UnblockRules []*UnblockRule `yaml:"unblock_rules"`
+
 	// Filters are the blocking filter lists.
 	Filters []FilterYAML `yaml:"-"`
 
@@ -291,6 +323,13 @@ type DNSFilter struct {
 
 	hostCheckers []hostChecker
 
+	// unblockReqs are the pending unblock requests.
+	unblockReqs *unblockRequests
+
+	// categories is the matcher of the domain categories.  It's nil until the
+	// categories are loaded.
+	categories atomic.Pointer[category.Matcher]
+
 	safeFSPatterns []string
 
 	// logger 用于记录日志
@@ -353,6 +392,10 @@ const (
 	//
 	// See https://github.com/AdguardTeam/AdGuardHome/issues/2499.
 	RewrittenRule
+
+	// FilteredCategory is returned when the host belongs to a blocked domain
+	// category.
+	FilteredCategory
 )
 
 // TODO(a.garipov): Resync with actual code names or replace completely
@@ -372,6 +415,8 @@ var reasonNames = []string{
 	Rewritten:          "Rewrite",
 	RewrittenAutoHosts: "RewriteEtcHosts",
 	RewrittenRule:      "RewriteRule",
+
+	FilteredCategory: "FilteredCategory",
 }
 
 func (r Reason) String() string {
@@ -411,6 +456,8 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 
 		*c = *d.conf
 		c.Rewrites = cloneRewrites(c.Rewrites)
+		c.UnblockRules = cloneUnblockRules(c.UnblockRules)
+		c.BlockedCategories = c.BlockedCategories.Clone()
 	}()
 
 	d.conf.filtersMu.RLock()
@@ -419,6 +466,7 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 	c.Filters = slices.Clone(d.conf.Filters)
 	c.WhitelistFilters = slices.Clone(d.conf.WhitelistFilters)
 	c.UserRules = slices.Clone(d.conf.UserRules)
+	c.UserRulesExpiry = maps.Clone(d.conf.UserRulesExpiry)
 }
 
 // setFilters sets new filters, synchronously or asynchronously.  When filters
@@ -586,6 +634,10 @@ type Result struct {
 	// Reason is set to FilteredBlockedService.
 	ServiceName string `json:",omitempty"`
 
+	// Category is the name of the blocked domain category.  It is empty unless
+	// Reason is set to FilteredCategory.
+	Category string `json:",omitempty"`
+
 	// IPList is the lookup rewrite result.  It is empty unless Reason is set to
 	// Rewritten.
 	IPList []netip.Addr `json:",omitempty"`
@@ -710,6 +762,23 @@ func (d *DNSFilter) processRewrites(host string, qtype uint16) (res Result) {
 	return res
 }
 
+// AddressRewrites returns the clones of the legacy rewrites for exact domain
+// names resolving to IP addresses, which haven't expired yet.
+func (d *DNSFilter) AddressRewrites() (rws []*LegacyRewrite) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	now := time.Now()
+	for _, rw := range d.conf.Rewrites {
+		if rw.IP.IsValid() && !isWildcard(rw.Domain) && !rw.isExpired(now) {
+			clone := *rw
+			rws = append(rws, &clone)
+		}
+	}
+
+	return rws
+}
+
 // matchBlockedServicesRules checks the host against the blocked services rules
 // in settings, if any.  The err is always nil, it is only there to make this
 // a valid hostChecker function.
@@ -1030,6 +1099,7 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		parentalControlChecker: c.ParentalControlChecker,
 		applyClientFiltering:   c.ApplyClientFiltering,
 		confMu:                 &sync.RWMutex{},
+		unblockReqs:            newUnblockRequests(),
 	}
 
 	for i, p := range c.SafeFSPatterns {
@@ -1045,12 +1115,18 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 	d.hostCheckers = []hostChecker{{
 		check: d.matchSysHosts,
 		name:  "hosts container",
+	}, {
+		check: d.matchUnblockRules,
+		name:  "unblock rules",
 	}, {
 		check: d.matchHost,
 		name:  "filtering",
 	}, {
 		check: matchBlockedServicesRules,
 		name:  "blocked services",
+	}, {
+		check: d.matchCategories,
+		name:  "categories",
 	}, {
 		check: d.checkSafeBrowsing,
 		name:  "safe browsing",
@@ -1072,6 +1148,13 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		return nil, fmt.Errorf("rewrites: preparing: %w", err)
 	}
 
+	for i, r := range d.conf.UnblockRules {
+		err = r.validate()
+		if err != nil {
+			return nil, fmt.Errorf("unblock_rules: at index %d: %w", i, err)
+		}
+	}
+
 	if d.conf.BlockedServices != nil {
 		err = d.conf.BlockedServices.Validate()
 		if err != nil {
@@ -1079,6 +1162,20 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		}
 	}
 
+	for i, src := range d.conf.CategorySources {
+		err = src.validate()
+		if err != nil {
+			return nil, fmt.Errorf("category_sources: at index %d: %w", i, err)
+		}
+	}
+
+	if d.conf.BlockedCategories != nil {
+		err = validateCategories(d.conf.BlockedCategories, d.conf.CategorySources)
+		if err != nil {
+			return nil, fmt.Errorf("blocked_categories: %w", err)
+		}
+	}
+
 	if blockFilters != nil {
 		err = d.initFiltering(nil, blockFilters)
 		if err != nil {
@@ -1117,6 +1214,14 @@ func (d *DNSFilter) Start() {
 	// Initialize the service loader during startup
 	d.initServiceLoader(context.Background())
 
+	// Load the categories in the background, since the lists may need to be
+	// downloaded.
+	go func() {
+		defer log.OnPanic("filtering: loading categories")
+
+		d.loadCategories()
+	}()
+
 	go d.updatesLoop()
 }
 
@@ -1127,6 +1232,9 @@ func (d *DNSFilter) updatesLoop() {
 	ivl := time.Second * 5
 	t := time.NewTimer(ivl)
 
+	janitor := time.NewTicker(janitorIvl)
+	defer janitor.Stop()
+
 	for {
 		select {
 		case params := <-d.filtersInitializerChan:
@@ -1139,6 +1247,8 @@ func (d *DNSFilter) updatesLoop() {
 		case <-t.C:
 			ivl = d.periodicallyRefreshFilters(ivl)
 			t.Reset(ivl)
+		case now := <-janitor.C:
+			d.removeExpired(now)
 		case <-d.done:
 			t.Stop()
 
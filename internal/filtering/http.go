@@ -3,6 +3,7 @@ package filtering
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/netip"
 	"net/url"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil/urlutil"
@@ -260,6 +262,55 @@ func (d *DNSFilter) handleFilteringSetURL(w http.ResponseWriter, r *http.Request
 // filteringRulesReq is the JSON structure for settings custom filtering rules.
 type filteringRulesReq struct {
 	Rules []string `json:"rules"`
+
+	// RulesExpiry are the expiration times of the temporary rules from Rules.
+	// If it's nil, the expiration times of the rules that are kept are
+	// preserved.
+	RulesExpiry []*userRuleExpiryJSON `json:"rules_expiry"`
+}
+
+// userRuleExpiryJSON is the JSON structure for the expiration time of a
+// temporary user rule.
+type userRuleExpiryJSON struct {
+	Expires time.Time `json:"expires"`
+	Rule    string    `json:"rule"`
+
+	// Remaining is the time remaining until the rule expires, in
+	// milliseconds.  It's only used in responses.
+	Remaining int64 `json:"remaining,omitempty"`
+}
+
+// userRulesExpiry returns the expiration times of the rules from req.  prev
+// are the current expiration times used when req.RulesExpiry is nil.
+func (req *filteringRulesReq) userRulesExpiry(
+	prev map[string]time.Time,
+	now time.Time,
+) (expiry map[string]time.Time, err error) {
+	rules := container.NewMapSet(req.Rules...)
+	if req.RulesExpiry == nil {
+		expiry = maps.Clone(prev)
+		maps.DeleteFunc(expiry, func(rule string, _ time.Time) (ok bool) {
+			return !rules.Has(rule)
+		})
+
+		return expiry, nil
+	}
+
+	expiry = make(map[string]time.Time, len(req.RulesExpiry))
+	for i, e := range req.RulesExpiry {
+		switch {
+		case e == nil:
+			return nil, fmt.Errorf("rules_expiry: at index %d: %w", i, errors.ErrNoValue)
+		case !rules.Has(e.Rule):
+			return nil, fmt.Errorf("rules_expiry: at index %d: no rule %q", i, e.Rule)
+		case !e.Expires.After(now):
+			return nil, fmt.Errorf("rules_expiry: at index %d: expires in the past", i)
+		default:
+			expiry[e.Rule] = e.Expires
+		}
+	}
+
+	return expiry, nil
 }
 
 func (d *DNSFilter) handleFilteringSetRules(w http.ResponseWriter, r *http.Request) {
@@ -275,7 +326,26 @@ func (d *DNSFilter) handleFilteringSetRules(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	d.conf.UserRules = req.Rules
+	err = func() (err error) {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		expiry, err := req.userRulesExpiry(d.conf.UserRulesExpiry, time.Now())
+		if err != nil {
+			return err
+		}
+
+		d.conf.UserRules = req.Rules
+		d.conf.UserRulesExpiry = expiry
+
+		return nil
+	}()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
 	d.conf.ConfigModified()
 	d.EnableFilters(true)
 }
@@ -328,6 +398,9 @@ type filteringConfig struct {
 	UserRules        []string     `json:"user_rules"`
 	Interval         uint32       `json:"interval"` // in hours
 	Enabled          bool         `json:"enabled"`
+
+	// UserRulesExpiry are the expiration times of the temporary user rules.
+	UserRulesExpiry []*userRuleExpiryJSON `json:"user_rules_expiry"`
 }
 
 func filterToJSON(f FilterYAML) filterJSON {
@@ -361,11 +434,36 @@ func (d *DNSFilter) handleFilteringStatus(w http.ResponseWriter, r *http.Request
 		resp.WhitelistFilters = append(resp.WhitelistFilters, fj)
 	}
 	resp.UserRules = d.conf.UserRules
+	resp.UserRulesExpiry = userRulesExpiryToJSON(d.conf.UserRules, d.conf.UserRulesExpiry, time.Now())
 	d.conf.filtersMu.RUnlock()
 
 	aghhttp.WriteJSONResponseOK(w, r, resp)
 }
 
+// userRulesExpiryToJSON returns the JSON representation of the expiration times
+// of rules in the order of rules.
+func userRulesExpiryToJSON(
+	rules []string,
+	expiry map[string]time.Time,
+	now time.Time,
+) (res []*userRuleExpiryJSON) {
+	res = []*userRuleExpiryJSON{}
+	for _, rule := range rules {
+		exp, ok := expiry[rule]
+		if !ok {
+			continue
+		}
+
+		res = append(res, &userRuleExpiryJSON{
+			Expires:   exp,
+			Rule:      rule,
+			Remaining: remainingMs(exp, now),
+		})
+	}
+
+	return res
+}
+
 // Set filtering configuration
 func (d *DNSFilter) handleFilteringConfig(w http.ResponseWriter, r *http.Request) {
 	req := filteringConfig{}
@@ -412,6 +510,9 @@ type checkHostResp struct {
 	// for FilteredBlockedService:
 	SvcName string `json:"service_name"`
 
+	// for FilteredCategory:
+	Category string `json:"category,omitempty"`
+
 	// for Rewrite:
 	CanonName string       `json:"cname"`    // CNAME value
 	IPList    []netip.Addr `json:"ip_addrs"` // list of IP addresses
@@ -485,6 +586,7 @@ func (d *DNSFilter) handleCheckHost(w http.ResponseWriter, r *http.Request) {
 	resp := checkHostResp{
 		Reason:    result.Reason.String(),
 		SvcName:   result.ServiceName,
+		Category:  result.Category,
 		CanonName: result.CanonName,
 		IPList:    result.IPList,
 		Rules:     make([]*checkHostRespRule, len(result.Rules)),
@@ -631,6 +733,11 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodPut, "/control/rewrite/update", d.handleRewriteUpdate)
 	registerHTTP(http.MethodPost, "/control/rewrite/delete", d.handleRewriteDelete)
 
+	registerHTTP(http.MethodGet, "/control/unblock_requests", d.handleUnblockRequests)
+	registerHTTP(http.MethodPost, "/control/unblock_requests/approve", d.handleUnblockApprove)
+	registerHTTP(http.MethodPost, "/control/unblock_requests/reject", d.handleUnblockReject)
+	registerHTTP(http.MethodPost, "/control/unblock_requests/revoke", d.handleUnblockRevoke)
+
 	registerHTTP(http.MethodGet, "/control/blocked_services/services", d.handleBlockedServicesIDs)
 	registerHTTP(http.MethodGet, "/control/blocked_services/all", d.handleBlockedServicesAll)
 	// 添加新的API端点用于重新加载服务
@@ -645,6 +752,11 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodGet, "/control/blocked_services/get", d.handleBlockedServicesGet)
 	registerHTTP(http.MethodPut, "/control/blocked_services/update", d.handleBlockedServicesUpdate)
 
+	registerHTTP(http.MethodGet, "/control/categories/all", d.handleCategoriesAll)
+	registerHTTP(http.MethodGet, "/control/categories/get", d.handleCategoriesGet)
+	registerHTTP(http.MethodPut, "/control/categories/update", d.handleCategoriesUpdate)
+	registerHTTP(http.MethodPost, "/control/categories/reload", d.handleCategoriesReload)
+
 	registerHTTP(http.MethodGet, "/control/filtering/status", d.handleFilteringStatus)
 	registerHTTP(http.MethodPost, "/control/filtering/config", d.handleFilteringConfig)
 	registerHTTP(http.MethodPost, "/control/filtering/add_url", d.handleFilteringAddURL)
@@ -0,0 +1,104 @@
+package filtering
+
+import (
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// janitorIvl is the interval between the removals of the expired rules,
+// rewrites, and client settings.
+const janitorIvl = 1 * time.Minute
+
+// isExpired returns true if the entry expiring at expires has expired by now.
+// The zero expires means that the entry never expires.
+func isExpired(expires, now time.Time) (ok bool) {
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+// remainingMs returns the time remaining until expires in milliseconds.  It
+// returns zero if expires is zero or has already passed.
+func remainingMs(expires, now time.Time) (ms int64) {
+	if expires.IsZero() {
+		return 0
+	}
+
+	return max(0, expires.Sub(now).Milliseconds())
+}
+
+// removeExpired removes the unblock rules, user rules, rewrites, and client
+// blocked services overrides that have expired by now.  It calls
+// [Config.ConfigModified] if anything has been removed and reloads the filters
+// if any of the user rules has been removed.
+func (d *DNSFilter) removeExpired(now time.Time) {
+	unblockRules := d.removeExpiredUnblockRules(now)
+	rewrites := d.removeExpiredRewrites(now)
+	userRules := d.removeExpiredUserRules(now)
+
+	clients := 0
+	if d.conf.ExpireClientOverrides != nil {
+		clients = d.conf.ExpireClientOverrides(now)
+	}
+
+	if unblockRules+rewrites+userRules+clients == 0 {
+		return
+	}
+
+	log.Info(
+		"filtering: removed expired: %d unblock rules, %d rewrites, %d user rules, %d client overrides",
+		unblockRules,
+		rewrites,
+		userRules,
+		clients,
+	)
+
+	d.conf.ConfigModified()
+
+	if userRules > 0 {
+		// Reload the filters synchronously, since it's called from the
+		// goroutine initializing the filters.
+		d.EnableFilters(false)
+	}
+}
+
+// removeExpiredRewrites removes the rewrites that have expired by now and
+// returns the number of removed rewrites.
+func (d *DNSFilter) removeExpiredRewrites(now time.Time) (n int) {
+	d.confMu.Lock()
+	defer d.confMu.Unlock()
+
+	prev := len(d.conf.Rewrites)
+	d.conf.Rewrites = slices.DeleteFunc(d.conf.Rewrites, func(rw *LegacyRewrite) (ok bool) {
+		return rw.isExpired(now)
+	})
+
+	return prev - len(d.conf.Rewrites)
+}
+
+// removeExpiredUserRules removes the user rules that have expired by now and
+// returns the number of expired rules.  The filters must be reloaded if n is
+// not zero.
+func (d *DNSFilter) removeExpiredUserRules(now time.Time) (n int) {
+	d.conf.filtersMu.Lock()
+	defer d.conf.filtersMu.Unlock()
+
+	expired := container.NewMapSet[string]()
+	for rule, exp := range d.conf.UserRulesExpiry {
+		if isExpired(exp, now) {
+			delete(d.conf.UserRulesExpiry, rule)
+			expired.Add(rule)
+		}
+	}
+
+	if expired.Len() == 0 {
+		return 0
+	}
+
+	// Clone the rules, since the slice may be shared with the configuration
+	// being written.
+	d.conf.UserRules = slices.DeleteFunc(slices.Clone(d.conf.UserRules), expired.Has)
+
+	return expired.Len()
+}
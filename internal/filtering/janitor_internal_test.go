@@ -0,0 +1,75 @@
+package filtering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_removeExpired(t *testing.T) {
+	const (
+		tempRule = "||temp.example^"
+		permRule = "||perm.example^"
+	)
+
+	now := time.Now()
+	expires := now.Add(time.Hour)
+
+	modified, clientsExpired := 0, 0
+	d, setts := newForTest(t, &Config{
+		ConfigModified: func() { modified++ },
+		ExpireClientOverrides: func(_ time.Time) (n int) {
+			return clientsExpired
+		},
+		Rewrites: []*LegacyRewrite{{
+			Domain:  "temp.example",
+			Answer:  "192.0.2.1",
+			Expires: expires,
+		}, {
+			Domain: "perm.example",
+			Answer: "192.0.2.2",
+		}},
+		UserRules:       []string{tempRule, permRule},
+		UserRulesExpiry: map[string]time.Time{tempRule: expires},
+	}, []Filter{{
+		ID:   rulelist.URLFilterIDCustom,
+		Data: []byte(tempRule + "\n" + permRule + "\n"),
+	}})
+	t.Cleanup(d.Close)
+
+	res, err := d.CheckHost("temp.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.Equal(t, Rewritten, res.Reason)
+
+	d.removeExpired(now)
+	assert.Zero(t, modified)
+
+	clientsExpired = 1
+	d.removeExpired(now)
+	assert.Equal(t, 1, modified)
+
+	clientsExpired = 0
+	later := expires.Add(time.Second)
+
+	d.removeExpired(later)
+	assert.Equal(t, 2, modified)
+
+	require.Len(t, d.conf.Rewrites, 1)
+
+	assert.Equal(t, "perm.example", d.conf.Rewrites[0].Domain)
+	assert.Equal(t, []string{permRule}, d.conf.UserRules)
+	assert.Empty(t, d.conf.UserRulesExpiry)
+}
+
+func TestLegacyRewrite_isExpired(t *testing.T) {
+	now := time.Now()
+
+	assert.False(t, (&LegacyRewrite{}).isExpired(now))
+	assert.False(t, (&LegacyRewrite{Expires: now.Add(time.Second)}).isExpired(now))
+	assert.True(t, (&LegacyRewrite{Expires: now}).isExpired(now))
+}
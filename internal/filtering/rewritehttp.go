@@ -2,17 +2,53 @@ package filtering
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"slices"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 )
 
 // TODO(d.kolyshev): Use [rewrite.Item] instead.
 type rewriteEntryJSON struct {
+	// Expires is the optional time the rewrite expires at.
+	Expires *time.Time `json:"expires,omitempty"`
+
 	Domain string `json:"domain"`
 	Answer string `json:"answer"`
+
+	// Remaining is the time remaining until the rewrite expires, in
+	// milliseconds.  It's only used in responses.
+	Remaining int64 `json:"remaining,omitempty"`
+}
+
+// toRewrite returns a new rewrite from j.  now is used to validate the
+// expiration time.
+func (j *rewriteEntryJSON) toRewrite(now time.Time) (rw *LegacyRewrite, err error) {
+	rw = &LegacyRewrite{
+		Domain: j.Domain,
+		Answer: j.Answer,
+	}
+
+	if j.Expires != nil {
+		if !j.Expires.After(now) {
+			return nil, errors.Error("expires in the past")
+		}
+
+		rw.Expires = *j.Expires
+	}
+
+	err = rw.normalize()
+	if err != nil {
+		// Shouldn't happen currently, since normalize only returns a non-nil
+		// error when a rewrite is nil, but be change-proof.
+		return nil, fmt.Errorf("normalizing: %w", err)
+	}
+
+	return rw, nil
 }
 
 // handleRewriteList is the handler for the GET /control/rewrite/list HTTP API.
@@ -23,11 +59,19 @@ func (d *DNSFilter) handleRewriteList(w http.ResponseWriter, r *http.Request) {
 		d.confMu.RLock()
 		defer d.confMu.RUnlock()
 
+		now := time.Now()
 		for _, ent := range d.conf.Rewrites {
 			jsonEnt := rewriteEntryJSON{
-				Domain: ent.Domain,
-				Answer: ent.Answer,
+				Domain:    ent.Domain,
+				Answer:    ent.Answer,
+				Remaining: remainingMs(ent.Expires, now),
+			}
+
+			if !ent.Expires.IsZero() {
+				exp := ent.Expires
+				jsonEnt.Expires = &exp
 			}
+
 			arr = append(arr, &jsonEnt)
 		}
 	}()
@@ -45,16 +89,9 @@ func (d *DNSFilter) handleRewriteAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rw := &LegacyRewrite{
-		Domain: rwJSON.Domain,
-		Answer: rwJSON.Answer,
-	}
-
-	err = rw.normalize()
+	rw, err := rwJSON.toRewrite(time.Now())
 	if err != nil {
-		// Shouldn't happen currently, since normalize only returns a non-nil
-		// error when a rewrite is nil, but be change-proof.
-		aghhttp.Error(r, w, http.StatusBadRequest, "normalizing: %s", err)
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
@@ -133,16 +170,9 @@ func (d *DNSFilter) handleRewriteUpdate(w http.ResponseWriter, r *http.Request)
 		Answer: updateJSON.Target.Answer,
 	}
 
-	rwAdd := &LegacyRewrite{
-		Domain: updateJSON.Update.Domain,
-		Answer: updateJSON.Update.Answer,
-	}
-
-	err = rwAdd.normalize()
+	rwAdd, err := updateJSON.Update.toRewrite(time.Now())
 	if err != nil {
-		// Shouldn't happen currently, since normalize only returns a non-nil
-		// error when a rewrite is nil, but be change-proof.
-		aghhttp.Error(r, w, http.StatusBadRequest, "normalizing: %s", err)
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
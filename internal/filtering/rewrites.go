@@ -5,6 +5,7 @@ import (
 	"net/netip"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
@@ -28,15 +29,25 @@ type LegacyRewrite struct {
 	// dns.TypeA or dns.TypeAAAA.
 	IP netip.Addr `yaml:"-"`
 
+	// Expires is the optional time after which the rewrite is no longer
+	// applied and is removed.  The zero value means that it never expires.
+	Expires time.Time `yaml:"expires,omitempty"`
+
 	// Type is the DNS record type: A, AAAA, or CNAME.
 	Type uint16 `yaml:"-"`
 }
 
-// equal returns true if the rw is equal to the other.
+// equal returns true if the rw is equal to the other.  The expiration time
+// isn't taken into account.
 func (rw *LegacyRewrite) equal(other *LegacyRewrite) (ok bool) {
 	return rw.Domain == other.Domain && rw.Answer == other.Answer
 }
 
+// isExpired returns true if rw has expired by now.
+func (rw *LegacyRewrite) isExpired(now time.Time) (ok bool) {
+	return isExpired(rw.Expires, now)
+}
+
 // matchesQType returns true if the entry matches the question type qt.
 func (rw *LegacyRewrite) matchesQType(qt uint16) (ok bool) {
 	// Add CNAMEs, since they match for all types requests.
@@ -159,8 +170,9 @@ func findRewrites(
 	host string,
 	qtype uint16,
 ) (rewrites []*LegacyRewrite, matched bool) {
+	now := time.Now()
 	for _, e := range entries {
-		if e.Domain != host && !matchDomainWildcard(host, e.Domain) {
+		if e.Domain != host && !matchDomainWildcard(host, e.Domain) || e.isExpired(now) {
 			continue
 		}
 
@@ -213,10 +225,11 @@ func cloneRewrites(entries []*LegacyRewrite) (clone []*LegacyRewrite) {
 	clone = make([]*LegacyRewrite, len(entries))
 	for i, rw := range entries {
 		clone[i] = &LegacyRewrite{
-			Domain: rw.Domain,
-			Answer: rw.Answer,
-			IP:     rw.IP,
-			Type:   rw.Type,
+			Domain:  rw.Domain,
+			Answer:  rw.Answer,
+			IP:      rw.IP,
+			Expires: rw.Expires,
+			Type:    rw.Type,
 		}
 	}
 
@@ -0,0 +1,453 @@
+package filtering
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// UnblockScope is the scope of an approved unblock request.
+type UnblockScope string
+
+// Valid unblock scopes.
+const (
+	// UnblockScopeClient means that the domain is only unblocked for the
+	// client that has requested it.
+	UnblockScopeClient UnblockScope = "client"
+
+	// UnblockScopeTag means that the domain is unblocked for all clients with
+	// the tag.
+	UnblockScopeTag UnblockScope = "tag"
+
+	// UnblockScopeAll means that the domain is unblocked for everyone.
+	UnblockScopeAll UnblockScope = "all"
+)
+
+// Limits of the unblock requests.
+const (
+	// maxUnblockRequests is the maximum number of pending unblock requests.
+	maxUnblockRequests = 1000
+
+	// maxUnblockRequestsPerClient is the maximum number of pending unblock
+	// requests from a single IP address.
+	maxUnblockRequestsPerClient = 10
+
+	// maxUnblockCommentLen is the maximum length of the comment of an unblock
+	// request, in bytes.
+	maxUnblockCommentLen = 512
+
+	// maxUnblockDuration is the maximum duration an unblock request may be
+	// approved for.
+	maxUnblockDuration = 30 * timeutil.Day
+)
+
+// ErrTooManyUnblockRequests is returned by [DNSFilter.RequestUnblock] when
+// there are too many pending requests.
+const ErrTooManyUnblockRequests errors.Error = "too many pending unblock requests"
+
+// UnblockRequest is a pending request from a client to unblock a domain.
+type UnblockRequest struct {
+	// Time is the time the request has been filed.
+	Time time.Time
+
+	// Host is the domain name to unblock.
+	Host string
+
+	// Comment is the optional comment from the requester.
+	Comment string
+
+	// ClientID is the optional ClientID of the requester.  Unless
+	// ClientIDVerified is true, it may be forged by the requester.
+	ClientID string
+
+	// Reason is the description of the reason the domain has been blocked
+	// with.
+	Reason string
+
+	// ClientIP is the address of the requester.
+	ClientIP netip.Addr
+
+	// ID is the unique identifier of the request.
+	ID uint64
+
+	// ClientIDVerified is true if ClientIP belongs to the persistent client
+	// with ClientID.
+	ClientIDVerified bool
+}
+
+// client returns the identifier of the requesting client used in the approved
+// rules.  An unverified ClientID is never used, since otherwise anyone could
+// request unblocking for another client.
+func (req *UnblockRequest) client() (c string) {
+	if req.ClientID != "" && req.ClientIDVerified {
+		return req.ClientID
+	}
+
+	return req.ClientIP.String()
+}
+
+// UnblockRule is an approved unblock request that allows a domain and its
+// subdomains until it expires.
+type UnblockRule struct {
+	// Expires is the time the rule stops being applied at.
+	Expires time.Time `yaml:"expires"`
+
+	// Host is the allowed domain name.
+	Host string `yaml:"host"`
+
+	// Client is the ClientID or the IP address of the client the domain is
+	// allowed for.  It's only used with [UnblockScopeClient].
+	Client string `yaml:"client,omitempty"`
+
+	// Tag is the tag of the clients the domain is allowed for.  It's only used
+	// with [UnblockScopeTag].
+	Tag string `yaml:"tag,omitempty"`
+
+	// Comment is the optional comment of the original request.
+	Comment string `yaml:"comment,omitempty"`
+
+	// Scope defines the clients the domain is allowed for.
+	Scope UnblockScope `yaml:"scope"`
+}
+
+// validate returns an error if r isn't valid.
+func (r *UnblockRule) validate() (err error) {
+	if r == nil {
+		return errors.ErrNoValue
+	}
+
+	err = netutil.ValidateHostname(r.Host)
+	if err != nil {
+		return fmt.Errorf("host: %w", err)
+	}
+
+	switch r.Scope {
+	case UnblockScopeClient:
+		if r.Client == "" {
+			return fmt.Errorf("client: %w", errors.ErrEmptyValue)
+		}
+	case UnblockScopeTag:
+		if r.Tag == "" {
+			return fmt.Errorf("tag: %w", errors.ErrEmptyValue)
+		}
+	case UnblockScopeAll:
+		// Go on.
+	default:
+		return fmt.Errorf("scope: %w: %q", errors.ErrBadEnumValue, r.Scope)
+	}
+
+	return nil
+}
+
+// text returns the text of the allowlist rule equivalent to r.
+func (r *UnblockRule) text() (text string) {
+	switch r.Scope {
+	case UnblockScopeClient:
+		return fmt.Sprintf("@@||%s^$client='%s'", r.Host, r.Client)
+	case UnblockScopeTag:
+		return fmt.Sprintf("@@||%s^$ctag=%s", r.Host, r.Tag)
+	default:
+		return fmt.Sprintf("@@||%s^", r.Host)
+	}
+}
+
+// matches returns true if r allows host for the client described by setts at
+// now.
+func (r *UnblockRule) matches(host string, setts *Settings, now time.Time) (ok bool) {
+	if !now.Before(r.Expires) {
+		return false
+	}
+
+	if host != r.Host && !strings.HasSuffix(host, "."+r.Host) {
+		return false
+	}
+
+	switch r.Scope {
+	case UnblockScopeClient:
+		return (setts.ClientID != "" && r.Client == setts.ClientID) ||
+			(setts.ClientIP.IsValid() && r.Client == setts.ClientIP.String())
+	case UnblockScopeTag:
+		return slices.Contains(setts.ClientTags, r.Tag)
+	default:
+		return true
+	}
+}
+
+// equal returns true if r and other allow the same host for the same clients
+// regardless of their expiration time and comments.
+func (r *UnblockRule) equal(other *UnblockRule) (ok bool) {
+	return r.Host == other.Host &&
+		r.Scope == other.Scope &&
+		r.Client == other.Client &&
+		r.Tag == other.Tag
+}
+
+// unblockRequests is the storage of the pending unblock requests.  The pending
+// requests are only kept in memory and are lost on restart, unlike the approved
+// [UnblockRule]s, which are stored in the configuration file.
+type unblockRequests struct {
+	// mu protects reqs and lastID.
+	mu *sync.Mutex
+
+	// reqs are the pending requests in the order of filing.
+	reqs []*UnblockRequest
+
+	// lastID is the ID of the last filed request.
+	lastID uint64
+}
+
+// newUnblockRequests returns a new properly initialized *unblockRequests.
+func newUnblockRequests() (s *unblockRequests) {
+	return &unblockRequests{
+		mu: &sync.Mutex{},
+	}
+}
+
+// add files req, assigning it an ID.  If the same client has already
+// requested the same host, the request is updated instead.  The number of the
+// requests is limited by the IP address of the requester, since the ClientID
+// may be forged.
+func (s *unblockRequests) add(req *UnblockRequest) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fromClient := 0
+	for _, r := range s.reqs {
+		if r.ClientIP != req.ClientIP {
+			continue
+		}
+
+		if r.Host == req.Host && r.ClientID == req.ClientID {
+			r.Time, r.Comment, r.Reason = req.Time, req.Comment, req.Reason
+			r.ClientIDVerified = req.ClientIDVerified
+
+			return nil
+		}
+
+		fromClient++
+	}
+
+	if fromClient >= maxUnblockRequestsPerClient || len(s.reqs) >= maxUnblockRequests {
+		return ErrTooManyUnblockRequests
+	}
+
+	s.lastID++
+	req.ID = s.lastID
+	s.reqs = append(s.reqs, req)
+
+	return nil
+}
+
+// list returns the copies of the pending requests.
+func (s *unblockRequests) list() (reqs []UnblockRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reqs = make([]UnblockRequest, 0, len(s.reqs))
+	for _, r := range s.reqs {
+		reqs = append(reqs, *r)
+	}
+
+	return reqs
+}
+
+// remove removes the request with the given ID and returns it.  req is nil if
+// there is no such request.
+func (s *unblockRequests) remove(id uint64) (req *UnblockRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.reqs, func(r *UnblockRequest) (ok bool) { return r.ID == id })
+	if i < 0 {
+		return nil
+	}
+
+	req = s.reqs[i]
+	s.reqs = slices.Delete(s.reqs, i, i+1)
+
+	return req
+}
+
+// RequestUnblock files the request to unblock a domain for the administrators.
+// req must not be nil.  It's safe for concurrent use.
+func (d *DNSFilter) RequestUnblock(req *UnblockRequest) (err error) {
+	defer func() { err = errors.Annotate(err, "requesting unblock: %w") }()
+
+	req.Host = strings.ToLower(strings.TrimSuffix(req.Host, "."))
+	err = netutil.ValidateHostname(req.Host)
+	if err != nil {
+		return fmt.Errorf("host: %w", err)
+	}
+
+	if !req.ClientIP.IsValid() {
+		return fmt.Errorf("client ip: %w", errors.ErrNoValue)
+	}
+
+	if len(req.Comment) > maxUnblockCommentLen {
+		req.Comment = req.Comment[:maxUnblockCommentLen]
+	}
+
+	if req.Time.IsZero() {
+		req.Time = time.Now()
+	}
+
+	err = d.unblockReqs.add(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	log.Info("filtering: unblock of %q requested by %s", req.Host, req.client())
+
+	return nil
+}
+
+// approveUnblock turns the pending request with the given ID into an unblock
+// rule with the given scope and lifetime.  tag is only used with
+// [UnblockScopeTag].  If an equal rule already exists, it's extended instead.
+// It calls [Config.ConfigModified].
+func (d *DNSFilter) approveUnblock(
+	id uint64,
+	scope UnblockScope,
+	tag string,
+	dur time.Duration,
+) (rule *UnblockRule, err error) {
+	if dur <= 0 || dur > maxUnblockDuration {
+		return nil, fmt.Errorf("duration: out of range: %s", dur)
+	}
+
+	if scope == UnblockScopeTag && tag == "" {
+		return nil, fmt.Errorf("tag: %w", errors.ErrEmptyValue)
+	}
+
+	req := d.unblockReqs.remove(id)
+	if req == nil {
+		return nil, fmt.Errorf("request %d: %w", id, errors.ErrNoValue)
+	}
+
+	rule = &UnblockRule{
+		Expires: time.Now().Add(dur),
+		Host:    req.Host,
+		Comment: req.Comment,
+		Scope:   scope,
+	}
+
+	switch scope {
+	case UnblockScopeClient:
+		rule.Client = req.client()
+	case UnblockScopeTag:
+		rule.Tag = tag
+	}
+
+	err = rule.validate()
+	if err != nil {
+		// Shouldn't happen, since the host is validated when the request is
+		// filed, but be change-proof.
+		return nil, err
+	}
+
+	rule = d.addUnblockRule(rule)
+
+	log.Info("filtering: unblock of %q approved for %s until %s", rule.Host, scope, rule.Expires)
+
+	d.conf.ConfigModified()
+
+	return rule, nil
+}
+
+// addUnblockRule adds rule to the approved ones unless there is an equal rule
+// already, which is updated with the expiration time and the comment of rule
+// then.  added is a copy of the added or updated rule.
+func (d *DNSFilter) addUnblockRule(rule *UnblockRule) (added *UnblockRule) {
+	d.confMu.Lock()
+	defer d.confMu.Unlock()
+
+	i := slices.IndexFunc(d.conf.UnblockRules, rule.equal)
+	if i < 0 {
+		d.conf.UnblockRules = append(d.conf.UnblockRules, rule)
+
+		c := *rule
+
+		return &c
+	}
+
+	existing := d.conf.UnblockRules[i]
+	if rule.Expires.After(existing.Expires) {
+		existing.Expires = rule.Expires
+	}
+
+	if rule.Comment != "" {
+		existing.Comment = rule.Comment
+	}
+
+	c := *existing
+
+	return &c
+}
+
+// matchUnblockRules checks the host against the approved unblock rules.
+func (d *DNSFilter) matchUnblockRules(
+	host string,
+	_ uint16,
+	setts *Settings,
+) (res Result, err error) {
+	if !setts.ProtectionEnabled {
+		return Result{}, nil
+	}
+
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	now := time.Now()
+	for _, r := range d.conf.UnblockRules {
+		if r.matches(host, setts, now) {
+			return Result{
+				Rules: []*ResultRule{{
+					Text:         r.text(),
+					FilterListID: rulelist.URLFilterIDCustom,
+				}},
+				Reason: NotFilteredAllowList,
+			}, nil
+		}
+	}
+
+	return Result{}, nil
+}
+
+// removeExpiredUnblockRules removes the unblock rules that have expired by now
+// and returns the number of removed rules.
+func (d *DNSFilter) removeExpiredUnblockRules(now time.Time) (n int) {
+	d.confMu.Lock()
+	defer d.confMu.Unlock()
+
+	prev := len(d.conf.UnblockRules)
+	d.conf.UnblockRules = slices.DeleteFunc(d.conf.UnblockRules, func(r *UnblockRule) (ok bool) {
+		return !now.Before(r.Expires)
+	})
+
+	return prev - len(d.conf.UnblockRules)
+}
+
+// cloneUnblockRules returns a deep copy of rules.
+func cloneUnblockRules(rules []*UnblockRule) (clone []*UnblockRule) {
+	if rules == nil {
+		return nil
+	}
+
+	clone = make([]*UnblockRule, 0, len(rules))
+	for _, r := range rules {
+		c := *r
+		clone = append(clone, &c)
+	}
+
+	return clone
+}
@@ -0,0 +1,194 @@
+package filtering
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_approveUnblock(t *testing.T) {
+	const (
+		blockedHost = "blocked.example"
+		subHost     = "sub." + blockedHost
+	)
+
+	filters := []Filter{{
+		ID:   rulelist.URLFilterIDCustom,
+		Data: []byte("||" + blockedHost + "^\n"),
+	}}
+
+	modified := 0
+	d, setts := newForTest(t, &Config{
+		ConfigModified: func() { modified++ },
+	}, filters)
+	t.Cleanup(d.Close)
+
+	cliIP := netip.MustParseAddr("192.0.2.1")
+	otherIP := netip.MustParseAddr("192.0.2.2")
+
+	err := d.RequestUnblock(&UnblockRequest{
+		Host:     "Blocked.Example.",
+		Comment:  "homework",
+		ClientIP: cliIP,
+	})
+	require.NoError(t, err)
+
+	reqs := d.unblockReqs.list()
+	require.Len(t, reqs, 1)
+
+	req := reqs[0]
+	assert.Equal(t, blockedHost, req.Host)
+
+	_, err = d.approveUnblock(req.ID, UnblockScopeClient, "", 0)
+	assert.Error(t, err)
+
+	_, err = d.approveUnblock(req.ID, UnblockScopeClient, "", time.Hour)
+	require.NoError(t, err)
+
+	assert.Empty(t, d.unblockReqs.list())
+	assert.Equal(t, 1, modified)
+
+	setts.ClientIP = cliIP
+	res, err := d.CheckHost(subHost, dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.Equal(t, NotFilteredAllowList, res.Reason)
+	require.Len(t, res.Rules, 1)
+
+	assert.Equal(t, "@@||blocked.example^$client='192.0.2.1'", res.Rules[0].Text)
+
+	setts.ClientIP = otherIP
+	res, err = d.CheckHost(blockedHost, dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.Equal(t, FilteredBlockList, res.Reason)
+
+	d.removeExpired(time.Now())
+	assert.Len(t, d.conf.UnblockRules, 1)
+	assert.Equal(t, 1, modified)
+
+	d.removeExpired(time.Now().Add(2 * time.Hour))
+	assert.Empty(t, d.conf.UnblockRules)
+	assert.Equal(t, 2, modified)
+}
+
+func TestUnblockRequests_add(t *testing.T) {
+	s := newUnblockRequests()
+	cliIP := netip.MustParseAddr("192.0.2.1")
+
+	for i := range maxUnblockRequestsPerClient {
+		err := s.add(&UnblockRequest{
+			Host:     string(rune('a'+i)) + ".example",
+			ClientIP: cliIP,
+		})
+		require.NoError(t, err)
+	}
+
+	err := s.add(&UnblockRequest{
+		Host:     "a.example",
+		Comment:  "again",
+		ClientIP: cliIP,
+	})
+	require.NoError(t, err)
+
+	reqs := s.list()
+	require.Len(t, reqs, maxUnblockRequestsPerClient)
+
+	assert.Equal(t, "again", reqs[0].Comment)
+
+	err = s.add(&UnblockRequest{
+		Host:     "new.example",
+		ClientIP: cliIP,
+	})
+	assert.ErrorIs(t, err, ErrTooManyUnblockRequests)
+
+	// The limit is per IP address, since the ClientID may be forged.
+	err = s.add(&UnblockRequest{
+		Host:     "new.example",
+		ClientID: "laptop",
+		ClientIP: cliIP,
+	})
+	assert.ErrorIs(t, err, ErrTooManyUnblockRequests)
+
+	err = s.add(&UnblockRequest{
+		Host:     "new.example",
+		ClientIP: netip.MustParseAddr("192.0.2.2"),
+	})
+	assert.NoError(t, err)
+}
+
+func TestUnblockRequest_client(t *testing.T) {
+	cliIP := netip.MustParseAddr("192.0.2.1")
+
+	testCases := []struct {
+		req  *UnblockRequest
+		want string
+		name string
+	}{{
+		req:  &UnblockRequest{ClientIP: cliIP},
+		want: "192.0.2.1",
+		name: "ip",
+	}, {
+		req:  &UnblockRequest{ClientID: "laptop", ClientIP: cliIP},
+		want: "192.0.2.1",
+		name: "unverified",
+	}, {
+		req:  &UnblockRequest{ClientID: "laptop", ClientIP: cliIP, ClientIDVerified: true},
+		want: "laptop",
+		name: "verified",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.req.client())
+		})
+	}
+}
+
+func TestDNSFilter_approveUnblock_duplicate(t *testing.T) {
+	d, _ := newForTest(t, &Config{
+		ConfigModified: func() {},
+	}, nil)
+	t.Cleanup(d.Close)
+
+	cliIP := netip.MustParseAddr("192.0.2.1")
+
+	approve := func(t *testing.T, comment string, dur time.Duration) {
+		t.Helper()
+
+		err := d.RequestUnblock(&UnblockRequest{
+			Host:     "blocked.example",
+			Comment:  comment,
+			ClientIP: cliIP,
+		})
+		require.NoError(t, err)
+
+		reqs := d.unblockReqs.list()
+		require.Len(t, reqs, 1)
+
+		_, err = d.approveUnblock(reqs[0].ID, UnblockScopeClient, "", dur)
+		require.NoError(t, err)
+	}
+
+	approve(t, "first", 2*time.Hour)
+	require.Len(t, d.conf.UnblockRules, 1)
+
+	expires := d.conf.UnblockRules[0].Expires
+
+	approve(t, "second", time.Hour)
+	require.Len(t, d.conf.UnblockRules, 1)
+
+	assert.Equal(t, expires, d.conf.UnblockRules[0].Expires)
+	assert.Equal(t, "second", d.conf.UnblockRules[0].Comment)
+
+	approve(t, "", 3*time.Hour)
+	require.Len(t, d.conf.UnblockRules, 1)
+
+	assert.True(t, d.conf.UnblockRules[0].Expires.After(expires))
+	assert.Equal(t, "second", d.conf.UnblockRules[0].Comment)
+}
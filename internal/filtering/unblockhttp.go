@@ -0,0 +1,189 @@
+package filtering
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// unblockRequestJSON is the JSON representation of a pending unblock request.
+type unblockRequestJSON struct {
+	Time             time.Time `json:"time"`
+	Domain           string    `json:"domain"`
+	Comment          string    `json:"comment,omitempty"`
+	ClientID         string    `json:"client_id,omitempty"`
+	ClientIP         string    `json:"client_ip,omitempty"`
+	Reason           string    `json:"reason,omitempty"`
+	ID               uint64    `json:"id"`
+	ClientIDVerified bool      `json:"client_id_verified"`
+}
+
+// unblockRuleJSON is the JSON representation of an approved unblock request.
+type unblockRuleJSON struct {
+	Expires time.Time    `json:"expires"`
+	Domain  string       `json:"domain"`
+	Client  string       `json:"client,omitempty"`
+	Tag     string       `json:"tag,omitempty"`
+	Comment string       `json:"comment,omitempty"`
+	Scope   UnblockScope `json:"scope"`
+
+	// Remaining is the time remaining until the rule expires, in
+	// milliseconds.  It's only used in responses.
+	Remaining int64 `json:"remaining,omitempty"`
+}
+
+// unblockRequestsJSON is the response to the GET /control/unblock_requests
+// HTTP API.
+type unblockRequestsJSON struct {
+	Requests []*unblockRequestJSON `json:"requests"`
+	Rules    []*unblockRuleJSON    `json:"rules"`
+}
+
+// handleUnblockRequests is the handler for the GET /control/unblock_requests
+// HTTP API.
+func (d *DNSFilter) handleUnblockRequests(w http.ResponseWriter, r *http.Request) {
+	resp := &unblockRequestsJSON{
+		Requests: []*unblockRequestJSON{},
+		Rules:    []*unblockRuleJSON{},
+	}
+
+	for _, req := range d.unblockReqs.list() {
+		reqJSON := &unblockRequestJSON{
+			Time:             req.Time,
+			Domain:           req.Host,
+			Comment:          req.Comment,
+			ClientID:         req.ClientID,
+			Reason:           req.Reason,
+			ID:               req.ID,
+			ClientIDVerified: req.ClientIDVerified,
+		}
+
+		if req.ClientIP.IsValid() {
+			reqJSON.ClientIP = req.ClientIP.String()
+		}
+
+		resp.Requests = append(resp.Requests, reqJSON)
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		now := time.Now()
+		for _, rule := range d.conf.UnblockRules {
+			resp.Rules = append(resp.Rules, &unblockRuleJSON{
+				Expires:   rule.Expires,
+				Domain:    rule.Host,
+				Client:    rule.Client,
+				Tag:       rule.Tag,
+				Comment:   rule.Comment,
+				Scope:     rule.Scope,
+				Remaining: remainingMs(rule.Expires, now),
+			})
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// unblockApproveJSON is the request to the POST
+// /control/unblock_requests/approve HTTP API.
+type unblockApproveJSON struct {
+	Scope UnblockScope `json:"scope"`
+	Tag   string       `json:"tag"`
+
+	// Duration is the lifetime of the rule, in milliseconds.
+	Duration uint64 `json:"duration"`
+
+	ID uint64 `json:"id"`
+}
+
+// handleUnblockApprove is the handler for the POST
+// /control/unblock_requests/approve HTTP API.
+func (d *DNSFilter) handleUnblockApprove(w http.ResponseWriter, r *http.Request) {
+	req := &unblockApproveJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	dur := time.Duration(req.Duration) * time.Millisecond
+	_, err = d.approveUnblock(req.ID, req.Scope, req.Tag, dur)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "approving: %s", err)
+
+		return
+	}
+}
+
+// unblockIDJSON is the request with the ID of a pending unblock request.
+type unblockIDJSON struct {
+	ID uint64 `json:"id"`
+}
+
+// handleUnblockReject is the handler for the POST
+// /control/unblock_requests/reject HTTP API.
+func (d *DNSFilter) handleUnblockReject(w http.ResponseWriter, r *http.Request) {
+	req := &unblockIDJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	removed := d.unblockReqs.remove(req.ID)
+	if removed == nil {
+		aghhttp.Error(r, w, http.StatusNotFound, "no request with id %d", req.ID)
+
+		return
+	}
+
+	log.Info("filtering: unblock of %q rejected", removed.Host)
+}
+
+// handleUnblockRevoke is the handler for the POST
+// /control/unblock_requests/revoke HTTP API.  It removes the approved rule
+// before it expires.
+func (d *DNSFilter) handleUnblockRevoke(w http.ResponseWriter, r *http.Request) {
+	ruleJSON := &unblockRuleJSON{}
+	err := json.NewDecoder(r.Body).Decode(ruleJSON)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json.Decode: %s", err)
+
+		return
+	}
+
+	target := &UnblockRule{
+		Host:   ruleJSON.Domain,
+		Client: ruleJSON.Client,
+		Tag:    ruleJSON.Tag,
+		Scope:  ruleJSON.Scope,
+	}
+
+	removed := func() (ok bool) {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		prev := len(d.conf.UnblockRules)
+		d.conf.UnblockRules = slices.DeleteFunc(d.conf.UnblockRules, target.equal)
+
+		return len(d.conf.UnblockRules) != prev
+	}()
+
+	if !removed {
+		aghhttp.Error(r, w, http.StatusNotFound, "no such rule")
+
+		return
+	}
+
+	log.Info("filtering: unblock of %q revoked", target.Host)
+
+	d.conf.ConfigModified()
+}
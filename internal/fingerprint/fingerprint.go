@@ -0,0 +1,240 @@
+// Package fingerprint contains the identification of devices by the values
+// they send within the DHCP messages.
+package fingerprint
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// defaultSignatures is the default signature database in JSON format.
+//
+//go:embed signatures.json
+var defaultSignatures []byte
+
+// Params are the device-specific values of a DHCP message.
+type Params struct {
+	// MAC is the hardware address of the device.
+	MAC net.HardwareAddr
+
+	// ParamRequestList is the Parameter Request List option, the option codes
+	// in the order requested by the device.
+	ParamRequestList []byte
+
+	// VendorClass is the Vendor Class Identifier option.
+	VendorClass string
+
+	// Hostname is the Host Name option.
+	Hostname string
+}
+
+// Clone returns a deep copy of p.
+func (p *Params) Clone() (clone *Params) {
+	if p == nil {
+		return nil
+	}
+
+	return &Params{
+		MAC:              slices.Clone(p.MAC),
+		ParamRequestList: slices.Clone(p.ParamRequestList),
+		VendorClass:      p.VendorClass,
+		Hostname:         p.Hostname,
+	}
+}
+
+// Device is the identified device.
+type Device struct {
+	// Name is the human-readable name of the device, for example "iPhone".
+	Name string `json:"name"`
+
+	// Type is the type of the device, for example "phone".  It's the suffix of
+	// the corresponding client tag, see [Device.Tags].
+	Type string `json:"type"`
+
+	// OS is the operating system of the device, for example "ios".  It's the
+	// suffix of the corresponding client tag, see [Device.Tags].
+	OS string `json:"os"`
+}
+
+// Tags returns the client tags describing d, for example "device_phone" and
+// "os_ios".
+func (d *Device) Tags() (tags []string) {
+	if d.Type != "" {
+		tags = append(tags, "device_"+d.Type)
+	}
+
+	if d.OS != "" {
+		tags = append(tags, "os_"+d.OS)
+	}
+
+	return tags
+}
+
+// signature is a single entry of the signature database.  All non-empty
+// conditions of a signature must match the parameters.
+type signature struct {
+	// Device is the device identified by the signature.
+	Device
+
+	// OUI is the list of the organizationally unique identifiers, the first
+	// three octets of a hardware address, in the "aa:bb:cc" form.
+	OUI []string `json:"oui"`
+
+	// VendorClass is the case-insensitive prefix of the Vendor Class
+	// Identifier option.
+	VendorClass string `json:"vendor_class"`
+
+	// Hostname is the case-insensitive prefix of the Host Name option.
+	Hostname string `json:"hostname"`
+
+	// ParamRequestList is the comma-separated list of the option codes of the
+	// Parameter Request List option.  The order is significant.
+	ParamRequestList string `json:"param_request_list"`
+}
+
+// validate returns an error if s isn't a valid signature.
+func (s *signature) validate() (err error) {
+	switch {
+	case s.Name == "":
+		return fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	case len(s.OUI) == 0 && s.VendorClass == "" && s.Hostname == "" && s.ParamRequestList == "":
+		return errors.Error("no conditions")
+	default:
+		return nil
+	}
+}
+
+// match returns the number of matched conditions and true if all the
+// conditions of s match p.  prl and oui are the normalized Parameter Request
+// List and OUI of p.
+func (s *signature) match(p *Params, prl, oui string) (score int, ok bool) {
+	if len(s.OUI) > 0 {
+		if !slices.Contains(s.OUI, oui) {
+			return 0, false
+		}
+
+		score++
+	}
+
+	for _, c := range []struct {
+		want string
+		got  string
+	}{{
+		want: s.VendorClass,
+		got:  strings.ToLower(p.VendorClass),
+	}, {
+		want: s.Hostname,
+		got:  strings.ToLower(p.Hostname),
+	}} {
+		if c.want == "" {
+			continue
+		} else if !strings.HasPrefix(c.got, c.want) {
+			return 0, false
+		}
+
+		score++
+	}
+
+	if s.ParamRequestList != "" {
+		if s.ParamRequestList != prl {
+			return 0, false
+		}
+
+		score++
+	}
+
+	return score, true
+}
+
+// DB is the database of device signatures.  It must not be modified after
+// creation and is safe for concurrent use.
+type DB struct {
+	// signatures are the signatures in the order they're stored in the
+	// database.
+	signatures []*signature
+}
+
+// NewDB reads the signature database in JSON format from r.
+func NewDB(r io.Reader) (db *DB, err error) {
+	var sigs []*signature
+	err = json.NewDecoder(r).Decode(&sigs)
+	if err != nil {
+		return nil, fmt.Errorf("decoding signatures: %w", err)
+	}
+
+	for i, s := range sigs {
+		if s == nil {
+			return nil, fmt.Errorf("signature at index %d: %w", i, errors.ErrNoValue)
+		}
+
+		err = s.validate()
+		if err != nil {
+			return nil, fmt.Errorf("signature at index %d: %w", i, err)
+		}
+
+		s.VendorClass = strings.ToLower(s.VendorClass)
+		s.Hostname = strings.ToLower(s.Hostname)
+		for j, oui := range s.OUI {
+			s.OUI[j] = strings.ToLower(oui)
+		}
+	}
+
+	return &DB{
+		signatures: sigs,
+	}, nil
+}
+
+// NewDefaultDB returns the built-in signature database.
+func NewDefaultDB() (db *DB) {
+	return errors.Must(NewDB(bytes.NewReader(defaultSignatures)))
+}
+
+// Match returns the device identified by p.  If several signatures match, the
+// one with the most matched conditions wins, the first one in the database is
+// chosen between the equal ones.  ok is false if no signature matches.
+func (db *DB) Match(p *Params) (d *Device, ok bool) {
+	prl := formatPRL(p.ParamRequestList)
+	oui := ""
+	if len(p.MAC) >= 3 {
+		oui = p.MAC[:3].String()
+	}
+
+	best := 0
+	for _, s := range db.signatures {
+		score, matched := s.match(p, prl, oui)
+		if matched && score > best {
+			d, best = &s.Device, score
+		}
+	}
+
+	if d == nil {
+		return nil, false
+	}
+
+	clone := *d
+
+	return &clone, true
+}
+
+// formatPRL returns the Parameter Request List in the comma-separated form.
+func formatPRL(prl []byte) (s string) {
+	b := &strings.Builder{}
+	for i, code := range prl {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(strconv.Itoa(int(code)))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package fingerprint_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_Match(t *testing.T) {
+	db := fingerprint.NewDefaultDB()
+
+	testCases := []struct {
+		want   *fingerprint.Device
+		params *fingerprint.Params
+		name   string
+	}{{
+		want: nil,
+		params: &fingerprint.Params{
+			Hostname: "Johns-iPhone",
+		},
+		name: "hostname_not_prefix",
+	}, {
+		want: &fingerprint.Device{Name: "iPhone", Type: "phone", OS: "ios"},
+		params: &fingerprint.Params{
+			Hostname: "iPhone-John",
+		},
+		name: "hostname",
+	}, {
+		want: &fingerprint.Device{Name: "Android", Type: "phone", OS: "android"},
+		params: &fingerprint.Params{
+			VendorClass: "android-dhcp-14",
+		},
+		name: "vendor_class",
+	}, {
+		want: &fingerprint.Device{Name: "Windows 10/11", Type: "pc", OS: "windows"},
+		params: &fingerprint.Params{
+			VendorClass:      "MSFT 5.0",
+			ParamRequestList: []byte{1, 3, 6, 15, 31, 33, 43, 44, 46, 47, 119, 121, 249, 252},
+		},
+		name: "more_conditions",
+	}, {
+		want: &fingerprint.Device{Name: "Windows", Type: "pc", OS: "windows"},
+		params: &fingerprint.Params{
+			VendorClass:      "MSFT 5.0",
+			ParamRequestList: []byte{1, 3, 6},
+		},
+		name: "less_conditions",
+	}, {
+		want: &fingerprint.Device{Name: "Apple iOS", Type: "phone", OS: "ios"},
+		params: &fingerprint.Params{
+			ParamRequestList: []byte{1, 121, 3, 6, 15, 119, 252},
+		},
+		name: "prl",
+	}, {
+		want: nil,
+		params: &fingerprint.Params{
+			MAC:      net.HardwareAddr{0x1, 0x2, 0x3, 0x4, 0x5, 0x6},
+			Hostname: "desktop-1",
+		},
+		name: "none",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, ok := db.Match(tc.params)
+			require.Equal(t, tc.want != nil, ok)
+
+			assert.Equal(t, tc.want, d)
+		})
+	}
+}
+
+func TestDB_Match_oui(t *testing.T) {
+	const data = `[{
+		"name": "Camera",
+		"type": "camera",
+		"os": "other",
+		"oui": ["AA:BB:CC"]
+	}]`
+
+	db, err := fingerprint.NewDB(strings.NewReader(data))
+	require.NoError(t, err)
+
+	d, ok := db.Match(&fingerprint.Params{
+		MAC: errors.Must(net.ParseMAC("aa:bb:cc:01:02:03")),
+	})
+	require.True(t, ok)
+
+	assert.Equal(t, []string{"device_camera", "os_other"}, d.Tags())
+
+	_, ok = db.Match(&fingerprint.Params{
+		MAC: errors.Must(net.ParseMAC("aa:bb:cd:01:02:03")),
+	})
+	assert.False(t, ok)
+}
+
+func TestNewDB(t *testing.T) {
+	testCases := []struct {
+		name       string
+		data       string
+		wantErrMsg string
+	}{{
+		name:       "valid",
+		data:       `[{"name":"A","hostname":"a"}]`,
+		wantErrMsg: "",
+	}, {
+		name:       "no_name",
+		data:       `[{"hostname":"a"}]`,
+		wantErrMsg: "signature at index 0: name: empty value",
+	}, {
+		name:       "no_conditions",
+		data:       `[{"name":"A"}]`,
+		wantErrMsg: "signature at index 0: no conditions",
+	}, {
+		name:       "nil",
+		data:       `[null]`,
+		wantErrMsg: "signature at index 0: no value",
+	}, {
+		name:       "bad_json",
+		data:       `{`,
+		wantErrMsg: "decoding signatures: unexpected EOF",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := fingerprint.NewDB(strings.NewReader(tc.data))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package home
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// apiTokenPrefix is the prefix of the API tokens making them easier to
+	// recognize, for example by secret scanners.
+	apiTokenPrefix = "agh_"
+
+	// apiTokenSize is the length of the random part of API tokens in bytes.
+	apiTokenSize = 32
+
+	// apiTokenIDLen is the length of the API token identifiers in bytes.  The
+	// identifier is the beginning of the token hash.
+	apiTokenIDLen = 8
+
+	// apiTokenUsePersistIvl is the minimum interval between saving the last
+	// usage time of an API token to the database file.
+	apiTokenUsePersistIvl = 1 * time.Minute
+)
+
+// apiTokensBucketName returns the name of the database bucket with the API
+// tokens.
+func apiTokensBucketName() (name []byte) {
+	return []byte("api-tokens")
+}
+
+// apiToken is a long-lived token for accessing the HTTP API without the web
+// user credentials.  Only the hash of the token is stored.
+type apiToken struct {
+	// Created is the time when the token has been created.
+	Created time.Time `json:"created"`
+
+	// Expires is the time after which the token is no longer valid.  Zero
+	// means that the token never expires.
+	Expires time.Time `json:"expires"`
+
+	// LastUsed is the time when the token has been used for the last time.
+	LastUsed time.Time `json:"last_used"`
+
+	// LastUsedIP is the IP address the token has been used from for the last
+	// time.
+	LastUsedIP netip.Addr `json:"last_used_ip"`
+
+	// Name is the human-readable name of the token.
+	Name string `json:"name"`
+
+	// UserName is the name of the web user who has created the token.  The
+	// token doesn't grant more permissions than the user has.
+	UserName string `json:"user_name"`
+
+	// Scopes are the permissions granted by the token.
+	Scopes []aghuser.Permission `json:"scopes"`
+
+	// AllowedSubnets are the subnets the token may be used from.  Empty means
+	// any address.
+	AllowedSubnets []netip.Prefix `json:"allowed_subnets"`
+
+	// persisted is the last usage time saved to the database file.
+	persisted time.Time
+}
+
+// clone returns a deep copy of t.
+func (t *apiToken) clone() (c *apiToken) {
+	c = &apiToken{}
+	*c = *t
+	c.Scopes = slices.Clone(t.Scopes)
+	c.AllowedSubnets = slices.Clone(t.AllowedSubnets)
+
+	return c
+}
+
+// validateAPITokenScopes returns an error if scopes are empty or contain
+// a permission that u doesn't have.  Scopes for managing the tokens themselves
+// and the web users are not allowed.
+func validateAPITokenScopes(scopes []aghuser.Permission, u *webUser) (err error) {
+	if len(scopes) == 0 {
+		return fmt.Errorf("scopes: %w", errors.ErrEmptyValue)
+	}
+
+	for i, s := range scopes {
+		_, err = aghuser.ParsePermission(string(s))
+		if err != nil {
+			return fmt.Errorf("scopes: at index %d: %w", i, err)
+		}
+
+		if isCredentialsScope(s) {
+			return fmt.Errorf("scopes: at index %d: %q is not allowed for tokens", i, s)
+		} else if !u.Role.Allows(s) {
+			return fmt.Errorf("scopes: at index %d: %q is not granted to user", i, s)
+		}
+	}
+
+	return nil
+}
+
+// isCredentialsScope returns true if s allows managing the credentials, which
+// the API tokens must not be able to do.
+func isCredentialsScope(s aghuser.Permission) (ok bool) {
+	area, _, _ := strings.Cut(string(s), ":")
+
+	return area == string(aghuser.AreaTokens) || area == string(aghuser.AreaUsers)
+}
+
+// apiTokenID returns the identifier of the token with the hash key.
+func apiTokenID(key []byte) (id string) {
+	return hex.EncodeToString(key[:apiTokenIDLen])
+}
+
+// hashAPIToken returns the hash of the token used as the database key.
+func hashAPIToken(token string) (key []byte) {
+	sum := sha256.Sum256([]byte(token))
+
+	return sum[:]
+}
+
+// loadAPITokens loads the API tokens from the database file.
+func (a *Auth) loadAPITokens() {
+	err := a.db.View(func(tx *bbolt.Tx) (err error) {
+		bkt := tx.Bucket(apiTokensBucketName())
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(k, v []byte) (err error) {
+			t := &apiToken{}
+			err = json.Unmarshal(v, t)
+			if err != nil {
+				log.Error("auth: decoding api token %s: %s", apiTokenID(k), err)
+
+				return nil
+			}
+
+			t.persisted = t.LastUsed
+			a.apiTokens[hex.EncodeToString(k)] = t
+
+			return nil
+		})
+	})
+	if err != nil {
+		log.Error("auth: loading api tokens: %s", err)
+	}
+
+	log.Debug("auth: loaded %d api tokens from DB", len(a.apiTokens))
+}
+
+// storeAPIToken saves t with the hash key to the database file.
+func (a *Auth) storeAPIToken(key []byte, t *apiToken) (err error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encoding api token: %w", err)
+	}
+
+	return a.db.Update(func(tx *bbolt.Tx) (err error) {
+		bkt, err := tx.CreateBucketIfNotExists(apiTokensBucketName())
+		if err != nil {
+			return fmt.Errorf("creating bucket: %w", err)
+		}
+
+		return bkt.Put(key, data)
+	})
+}
+
+// addAPIToken generates a new API token, saves t as its information, and
+// returns the token.  The token itself isn't stored anywhere.
+func (a *Auth) addAPIToken(t *apiToken) (id, token string, err error) {
+	randData := make([]byte, apiTokenSize)
+
+	// Since Go 1.24, crypto/rand.Read doesn't return an error and crashes
+	// unrecoverably instead.
+	_, _ = rand.Read(randData)
+
+	token = apiTokenPrefix + hex.EncodeToString(randData)
+	key := hashAPIToken(token)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	err = a.storeAPIToken(key, t)
+	if err != nil {
+		return "", "", fmt.Errorf("storing api token: %w", err)
+	}
+
+	a.apiTokens[hex.EncodeToString(key)] = t
+
+	id = apiTokenID(key)
+	log.Info("auth: user %q created api token %s %q", t.UserName, id, t.Name)
+
+	return id, token, nil
+}
+
+// removeAPIToken revokes the API token with id.  ok is false if there is no
+// such token.
+func (a *Auth) removeAPIToken(id string) (ok bool, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for k := range a.apiTokens {
+		key, _ := hex.DecodeString(k)
+		if apiTokenID(key) != id {
+			continue
+		}
+
+		err = a.db.Update(func(tx *bbolt.Tx) (err error) {
+			bkt := tx.Bucket(apiTokensBucketName())
+			if bkt == nil {
+				return nil
+			}
+
+			return bkt.Delete(key)
+		})
+		if err != nil {
+			return false, fmt.Errorf("removing api token: %w", err)
+		}
+
+		delete(a.apiTokens, k)
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// apiTokensList returns copies of the API tokens mapped by their identifiers.
+func (a *Auth) apiTokensList() (tokens map[string]*apiToken) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	tokens = make(map[string]*apiToken, len(a.apiTokens))
+	for k, t := range a.apiTokens {
+		key, _ := hex.DecodeString(k)
+		tokens[apiTokenID(key)] = t.clone()
+	}
+
+	return tokens
+}
+
+// checkAPIToken returns the information about token and its owner if the token
+// is valid and may be used from ip at now.  It also records the usage.
+func (a *Auth) checkAPIToken(
+	ctx context.Context,
+	token string,
+	ip netip.Addr,
+	now time.Time,
+) (t *apiToken, u *webUser, err error) {
+	key := hashAPIToken(token)
+	k := hex.EncodeToString(key)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	stored, ok := a.apiTokens[k]
+	if !ok {
+		return nil, nil, errors.Error("unknown token")
+	} else if !stored.Expires.IsZero() && !now.Before(stored.Expires) {
+		return nil, nil, errors.Error("token expired")
+	} else if len(stored.AllowedSubnets) > 0 && !slices.ContainsFunc(
+		stored.AllowedSubnets,
+		func(p netip.Prefix) (ok bool) { return p.Contains(ip) },
+	) {
+		return nil, nil, fmt.Errorf("token not allowed from %s", ip)
+	}
+
+	owner := a.userByName(ctx, stored.UserName)
+	if owner == nil {
+		return nil, nil, fmt.Errorf("token owner %q not found", stored.UserName)
+	} else if owner.External && externalExpired(stored.Created, now) {
+		return nil, nil, errors.Error("token of external user expired")
+	}
+
+	stored.LastUsed, stored.LastUsedIP = now, ip
+	if now.Sub(stored.persisted) >= apiTokenUsePersistIvl {
+		err = a.storeAPIToken(key, stored)
+		if err != nil {
+			log.Error("auth: saving api token %s usage: %s", apiTokenID(key), err)
+		} else {
+			stored.persisted = now
+		}
+	}
+
+	return stored.clone(), newWebUser(owner), nil
+}
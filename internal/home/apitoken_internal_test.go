@@ -0,0 +1,238 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth_APIToken(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "sessions.db")
+	users := []webUser{{
+		Name: "ddns",
+		Role: aghuser.RoleDDNS,
+	}}
+
+	a := InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		fn,
+		users,
+		60,
+		nil,
+		nil,
+	)
+	require.NotNil(t, a)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	now := time.Now()
+	subnet := netip.MustParsePrefix("192.0.2.0/24")
+	allowedIP := netip.MustParseAddr("192.0.2.1")
+	otherIP := netip.MustParseAddr("198.51.100.1")
+
+	tok, err := newAPIToken(&apiTokenAddReq{
+		Name:           "script",
+		Scopes:         []aghuser.Permission{"rewrite:write", "rewrite:read"},
+		AllowedSubnets: []netip.Prefix{subnet},
+	}, &users[0], now)
+	require.NoError(t, err)
+
+	id, token, err := a.addAPIToken(tok)
+	require.NoError(t, err)
+
+	assert.Len(t, id, 2*apiTokenIDLen)
+	assert.Contains(t, a.apiTokensList(), id)
+
+	got, u, err := a.checkAPIToken(ctx, token, allowedIP, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, "ddns", u.Name)
+	assert.Equal(t, []aghuser.Permission{"rewrite:read", "rewrite:write"}, got.Scopes)
+	assert.Equal(t, allowedIP, got.LastUsedIP)
+
+	_, _, err = a.checkAPIToken(ctx, token, otherIP, now)
+	assert.Error(t, err)
+
+	_, _, err = a.checkAPIToken(ctx, token+"0", allowedIP, now)
+	assert.Error(t, err)
+
+	a.Close()
+
+	a = InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		fn,
+		users,
+		60,
+		nil,
+		nil,
+	)
+	require.NotNil(t, a)
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		a.Close()
+
+		return nil
+	})
+
+	list := a.apiTokensList()
+	require.Contains(t, list, id)
+
+	assert.Equal(t, "script", list[id].Name)
+	assert.Equal(t, allowedIP, list[id].LastUsedIP)
+
+	ok, err := a.removeAPIToken(id)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, _, err = a.checkAPIToken(ctx, token, allowedIP, now)
+	assert.Error(t, err)
+}
+
+func TestNewAPIToken(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	u := &webUser{Name: "ddns", Role: aghuser.RoleDDNS}
+
+	testCases := []struct {
+		req        *apiTokenAddReq
+		name       string
+		wantErrMsg string
+	}{{
+		req: &apiTokenAddReq{
+			Name:   "script",
+			Scopes: []aghuser.Permission{"rewrite:read"},
+		},
+		name:       "success",
+		wantErrMsg: "",
+	}, {
+		req: &apiTokenAddReq{
+			Scopes: []aghuser.Permission{"rewrite:read"},
+		},
+		name:       "no_name",
+		wantErrMsg: "name: empty value",
+	}, {
+		req: &apiTokenAddReq{
+			Name: "script",
+		},
+		name:       "no_scopes",
+		wantErrMsg: "scopes: empty value",
+	}, {
+		req: &apiTokenAddReq{
+			Name:   "script",
+			Scopes: []aghuser.Permission{"dns:write"},
+		},
+		name:       "not_granted",
+		wantErrMsg: `scopes: at index 0: "dns:write" is not granted to user`,
+	}, {
+		req: &apiTokenAddReq{
+			Name:   "script",
+			Scopes: []aghuser.Permission{"tokens:read"},
+		},
+		name:       "tokens",
+		wantErrMsg: `scopes: at index 0: "tokens:read" is not allowed for tokens`,
+	}, {
+		req: &apiTokenAddReq{
+			Name:   "script",
+			Scopes: []aghuser.Permission{"rewrite"},
+		},
+		name: "bad_scope",
+		wantErrMsg: `scopes: at index 0: permission "rewrite": ` +
+			`bad enum value`,
+	}, {
+		req: &apiTokenAddReq{
+			Expires: &past,
+			Name:    "script",
+			Scopes:  []aghuser.Permission{"rewrite:read"},
+		},
+		name:       "expired",
+		wantErrMsg: "expires: " + past.String() + " is in the past",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newAPIToken(tc.req, u, now)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestNewAPIToken_external(t *testing.T) {
+	now := time.Now()
+	u := &webUser{Name: "directory_user", Role: aghuser.RoleDDNS, external: true}
+	later := now.Add(time.Hour)
+
+	testCases := []struct {
+		expires *time.Time
+		want    time.Time
+		name    string
+	}{{
+		expires: nil,
+		want:    now.UTC().Add(maxExternalAge),
+		name:    "never",
+	}, {
+		expires: &later,
+		want:    later.UTC(),
+		name:    "earlier",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tok, err := newAPIToken(&apiTokenAddReq{
+				Expires: tc.expires,
+				Name:    "script",
+				Scopes:  []aghuser.Permission{"rewrite:read"},
+			}, u, now)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, tok.Expires)
+		})
+	}
+}
+
+func TestPermissionHandler_apiToken(t *testing.T) {
+	const path = "/control/rewrite/add"
+
+	h := permissionHandler(
+		http.MethodPost,
+		path,
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	testCases := []struct {
+		name   string
+		scopes []aghuser.Permission
+		want   int
+	}{{
+		name:   "allowed",
+		scopes: []aghuser.Permission{"rewrite:write"},
+		want:   http.StatusOK,
+	}, {
+		name:   "read_only",
+		scopes: []aghuser.Permission{"rewrite:read"},
+		want:   http.StatusForbidden,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, path, nil)
+			ctx := withAuthUser(r.Context(), &webUser{Name: "admin"})
+			ctx = withAPIToken(ctx, &apiToken{Name: "script", Scopes: tc.scopes})
+			r = r.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+}
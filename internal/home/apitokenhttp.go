@@ -0,0 +1,255 @@
+package home
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// apiTokenJSON is the information about an API token for the HTTP API.  It
+// never contains the token itself.
+type apiTokenJSON struct {
+	// Expires is nil if the token never expires.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// LastUsed is nil if the token has never been used.
+	LastUsed *time.Time `json:"last_used,omitempty"`
+
+	// LastUsedIP is nil if the token has never been used.
+	LastUsedIP *netip.Addr `json:"last_used_ip,omitempty"`
+
+	Created        time.Time            `json:"created"`
+	ID             string               `json:"id"`
+	Name           string               `json:"name"`
+	User           string               `json:"user"`
+	Scopes         []aghuser.Permission `json:"scopes"`
+	AllowedSubnets []netip.Prefix       `json:"allowed_subnets"`
+}
+
+// newAPITokenJSON converts t with id into its HTTP API representation.
+func newAPITokenJSON(id string, t *apiToken) (j *apiTokenJSON) {
+	j = &apiTokenJSON{
+		Created:        t.Created,
+		ID:             id,
+		Name:           t.Name,
+		User:           t.UserName,
+		Scopes:         t.Scopes,
+		AllowedSubnets: t.AllowedSubnets,
+	}
+
+	if j.AllowedSubnets == nil {
+		j.AllowedSubnets = []netip.Prefix{}
+	}
+
+	if !t.Expires.IsZero() {
+		j.Expires = &t.Expires
+	}
+
+	if !t.LastUsed.IsZero() {
+		j.LastUsed = &t.LastUsed
+		j.LastUsedIP = &t.LastUsedIP
+	}
+
+	return j
+}
+
+// apiTokensJSON is the response to the GET /control/tokens HTTP API.
+type apiTokensJSON struct {
+	Tokens []*apiTokenJSON `json:"tokens"`
+}
+
+// apiTokenAddReq is the request to the POST /control/tokens/add HTTP API.
+type apiTokenAddReq struct {
+	// Expires is the time after which the token is no longer valid.  Nil
+	// means that the token never expires.
+	Expires *time.Time `json:"expires"`
+
+	Name           string               `json:"name"`
+	Scopes         []aghuser.Permission `json:"scopes"`
+	AllowedSubnets []netip.Prefix       `json:"allowed_subnets"`
+}
+
+// apiTokenAddResp is the response to the POST /control/tokens/add HTTP API.
+// It's the only place where the token itself is shown.
+type apiTokenAddResp struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+}
+
+// apiTokenDeleteReq is the request to the POST /control/tokens/delete HTTP
+// API.
+type apiTokenDeleteReq struct {
+	ID string `json:"id"`
+}
+
+// registerAPITokenHandlers registers the HTTP API handlers for managing the API
+// tokens.
+func registerAPITokenHandlers() {
+	httpRegister(http.MethodGet, "/control/tokens", handleAPITokensList)
+	httpRegister(http.MethodPost, "/control/tokens/add", handleAPITokenAdd)
+	httpRegister(http.MethodPost, "/control/tokens/delete", handleAPITokenDelete)
+}
+
+// rejectAPITokenAuth writes an error and returns true if r is authenticated
+// with an API token, since the tokens must not be able to manage themselves.
+func rejectAPITokenAuth(w http.ResponseWriter, r *http.Request) (rejected bool) {
+	if _, ok := apiTokenFromContext(r.Context()); !ok {
+		return false
+	}
+
+	aghhttp.Error(r, w, http.StatusForbidden, "api tokens cannot be managed with api tokens")
+
+	return true
+}
+
+// handleAPITokensList is the handler for the GET /control/tokens HTTP API.
+func handleAPITokensList(w http.ResponseWriter, r *http.Request) {
+	if rejectAPITokenAuth(w, r) {
+		return
+	}
+
+	resp := &apiTokensJSON{
+		Tokens: []*apiTokenJSON{},
+	}
+
+	if globalContext.auth != nil {
+		for id, t := range globalContext.auth.apiTokensList() {
+			resp.Tokens = append(resp.Tokens, newAPITokenJSON(id, t))
+		}
+	}
+
+	slices.SortFunc(resp.Tokens, func(a, b *apiTokenJSON) (res int) {
+		return cmp.Or(a.Created.Compare(b.Created), strings.Compare(a.ID, b.ID))
+	})
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleAPITokenAdd is the handler for the POST /control/tokens/add HTTP API.
+func handleAPITokenAdd(w http.ResponseWriter, r *http.Request) {
+	if rejectAPITokenAuth(w, r) {
+		return
+	}
+
+	req := &apiTokenAddReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	u, ok := authUserFromContext(r.Context())
+	if !ok || globalContext.auth == nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "api tokens require authentication")
+
+		return
+	}
+
+	now := time.Now()
+	t, err := newAPIToken(req, u, now)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	id, token, err := globalContext.auth.addAPIToken(t)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "adding token: %s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, &apiTokenAddResp{
+		ID:    id,
+		Token: token,
+	})
+}
+
+// newAPIToken validates req and returns the information about the new API
+// token created by u at now.
+func newAPIToken(req *apiTokenAddReq, u *webUser, now time.Time) (t *apiToken, err error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("name: %w", errors.ErrEmptyValue)
+	}
+
+	err = validateAPITokenScopes(req.Scopes, u)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
+	t = &apiToken{
+		Created:        now.UTC(),
+		Name:           req.Name,
+		UserName:       u.Name,
+		Scopes:         slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		AllowedSubnets: make([]netip.Prefix, 0, len(req.AllowedSubnets)),
+	}
+
+	for _, p := range req.AllowedSubnets {
+		t.AllowedSubnets = append(t.AllowedSubnets, p.Masked())
+	}
+
+	if req.Expires != nil {
+		if !req.Expires.After(now) {
+			return nil, fmt.Errorf("expires: %s is in the past", req.Expires)
+		}
+
+		t.Expires = req.Expires.UTC()
+	}
+
+	if u.external {
+		maxExpires := t.Created.Add(maxExternalAge)
+		if t.Expires.IsZero() || t.Expires.After(maxExpires) {
+			t.Expires = maxExpires
+		}
+	}
+
+	return t, nil
+}
+
+// handleAPITokenDelete is the handler for the POST /control/tokens/delete HTTP
+// API.
+func handleAPITokenDelete(w http.ResponseWriter, r *http.Request) {
+	if rejectAPITokenAuth(w, r) {
+		return
+	}
+
+	req := &apiTokenDeleteReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	if globalContext.auth == nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "api token %q not found", req.ID)
+
+		return
+	}
+
+	ok, err := globalContext.auth.removeAPIToken(req.ID)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "removing token: %s", err)
+
+		return
+	} else if !ok {
+		aghhttp.Error(r, w, http.StatusBadRequest, "api token %q not found", req.ID)
+
+		return
+	}
+
+	aghhttp.OK(w)
+}
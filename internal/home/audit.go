@@ -0,0 +1,209 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/audit"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Audit log query limits.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditFileName is the name of the audit log file in the data directory.
+const auditFileName = "audit.log"
+
+// auditConfig is the configuration of the audit log of the configuration
+// changes.
+type auditConfig struct {
+	// Enabled defines if the configuration changes made through the HTTP API
+	// are recorded.
+	Enabled bool `yaml:"enabled"`
+
+	// Syslog defines if the entries are also sent to syslog or, on Windows,
+	// to the event log.
+	Syslog bool `yaml:"syslog"`
+}
+
+// initAudit initializes the audit log if it's enabled.
+func initAudit(ctx context.Context, baseLogger *slog.Logger) (err error) {
+	c := config.Audit
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	l := baseLogger.With(slogutil.KeyPrefix, "audit")
+
+	auditConf := &audit.Config{
+		Logger: l,
+		Path:   filepath.Join(globalContext.getDataDir(), auditFileName),
+	}
+
+	if c.Syslog {
+		auditConf.Syslog, err = aghos.NewSyslogWriter(serviceName)
+		if err != nil {
+			// Don't fail the start because of the syslog.
+			l.ErrorContext(ctx, "initializing syslog", slogutil.KeyError, err)
+		}
+	}
+
+	globalContext.audit, err = audit.New(auditConf)
+	if err != nil {
+		return fmt.Errorf("initializing audit log: %w", err)
+	}
+
+	return nil
+}
+
+// configDocument returns the current configuration as a generic document for
+// computing the differences.
+func configDocument() (doc map[string]any, err error) {
+	data, err := config.marshal(globalContext.tls)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+
+	return doc, nil
+}
+
+// auditRecorder records the configuration changes made while handling a
+// request.
+type auditRecorder struct {
+	before map[string]any
+}
+
+// newAuditRecorder returns a new *auditRecorder with the current state of the
+// configuration or nil if the audit log is disabled.  globalContext.controlLock
+// is expected to be locked, so that the changes of the concurrent requests
+// don't mix.
+func newAuditRecorder() (rec *auditRecorder) {
+	if globalContext.audit == nil {
+		return nil
+	}
+
+	before, err := configDocument()
+	if err != nil {
+		log.Error("audit: getting config: %s", err)
+
+		return nil
+	}
+
+	return &auditRecorder{before: before}
+}
+
+// finish records the changes of the configuration made by r, if any.
+func (rec *auditRecorder) finish(r *http.Request) {
+	after, err := configDocument()
+	if err != nil {
+		log.Error("audit: getting config: %s", err)
+
+		return
+	}
+
+	changes := audit.Diff(rec.before, after)
+	if len(changes) == 0 {
+		return
+	}
+
+	ctx := r.Context()
+	e := &audit.Entry{
+		Time:     time.Now(),
+		Method:   r.Method,
+		Endpoint: r.URL.Path,
+		Changes:  changes,
+	}
+
+	if u, ok := authUserFromContext(ctx); ok && u != nil {
+		e.User = u.Name
+	}
+
+	if t, ok := apiTokenFromContext(ctx); ok {
+		e.APIToken = t.Name
+	}
+
+	if globalContext.auth != nil {
+		e.IP, err = requestIP(r)
+		if err != nil {
+			log.Debug("audit: getting ip: %s", err)
+		}
+	}
+
+	err = globalContext.audit.Record(ctx, e)
+	if err != nil {
+		log.Error("audit: %s", err)
+	}
+}
+
+// auditResp is the response to the GET /control/audit HTTP API.
+type auditResp struct {
+	Entries []*audit.Entry `json:"entries"`
+}
+
+// handleAudit is the handler for the GET /control/audit HTTP API.
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if globalContext.audit == nil {
+		aghhttp.Error(r, w, http.StatusNotFound, "audit log is disabled")
+
+		return
+	}
+
+	q := r.URL.Query()
+	query := &audit.Query{
+		User:  q.Get("user"),
+		Limit: defaultAuditLimit,
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			aghhttp.Error(r, w, http.StatusBadRequest, "limit: must be from 1 to %d", maxAuditLimit)
+
+			return
+		}
+
+		query.Limit = limit
+	}
+
+	if v := q.Get("before"); v != "" {
+		before, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "before: %s", err)
+
+			return
+		}
+
+		query.Before = before
+	}
+
+	entries, err := globalContext.audit.Query(r.Context(), query)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "querying audit log: %s", err)
+
+		return
+	}
+
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, &auditResp{Entries: entries})
+}
@@ -0,0 +1,95 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/audit"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleAudit(t *testing.T) {
+	storeGlobals(t)
+
+	l, err := audit.New(&audit.Config{
+		Logger: slogutil.NewDiscardLogger(),
+		Path:   filepath.Join(t.TempDir(), auditFileName),
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	globalContext.audit = l
+
+	ctx := testutil.ContextWithTimeout(t, time.Second)
+	now := time.Now().UTC()
+	for _, u := range []string{"admin", "kid"} {
+		err = l.Record(ctx, &audit.Entry{
+			Time:     now,
+			User:     u,
+			Method:   http.MethodPost,
+			Endpoint: "/control/protection",
+			Changes: []*audit.Change{{
+				Old:  true,
+				New:  false,
+				Path: "dns.protection_enabled",
+			}},
+		})
+		require.NoError(t, err)
+	}
+
+	testCases := []struct {
+		name      string
+		query     string
+		wantUsers []string
+		wantCode  int
+	}{{
+		name:      "all",
+		query:     "",
+		wantUsers: []string{"kid", "admin"},
+		wantCode:  http.StatusOK,
+	}, {
+		name:      "user",
+		query:     "?user=kid",
+		wantUsers: []string{"kid"},
+		wantCode:  http.StatusOK,
+	}, {
+		name:      "before",
+		query:     "?before=" + now.Format(time.RFC3339Nano),
+		wantUsers: []string{},
+		wantCode:  http.StatusOK,
+	}, {
+		name:      "bad_limit",
+		query:     "?limit=0",
+		wantUsers: nil,
+		wantCode:  http.StatusBadRequest,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleAudit(w, httptest.NewRequest(http.MethodGet, "/control/audit"+tc.query, nil))
+			require.Equal(t, tc.wantCode, w.Code)
+
+			if tc.wantUsers == nil {
+				return
+			}
+
+			resp := &auditResp{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+
+			users := []string{}
+			for _, e := range resp.Entries {
+				users = append(users, e.User)
+			}
+
+			assert.Equal(t, tc.wantUsers, users)
+		})
+	}
+}
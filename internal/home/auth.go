@@ -1,67 +1,64 @@
 package home
 
 import (
+	"context"
 	"crypto/rand"
-	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
 	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/AdguardTeam/golibs/validate"
 	"go.etcd.io/bbolt"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // sessionTokenSize is the length of session token in bytes.
-const sessionTokenSize = 16
-
-type session struct {
-	userName string
-	// expire is the expiration time, in seconds.
-	expire uint32
-}
-
-func (s *session) serialize() []byte {
-	const (
-		expireLen = 4
-		nameLen   = 2
-	)
-	data := make([]byte, expireLen+nameLen+len(s.userName))
-	binary.BigEndian.PutUint32(data[0:4], s.expire)
-	binary.BigEndian.PutUint16(data[4:6], uint16(len(s.userName)))
-	copy(data[6:], []byte(s.userName))
-	return data
-}
-
-func (s *session) deserialize(data []byte) bool {
-	if len(data) < 4+2 {
-		return false
-	}
-	s.expire = binary.BigEndian.Uint32(data[0:4])
-	nameLen := binary.BigEndian.Uint16(data[4:6])
-	data = data[6:]
-
-	if len(data) < int(nameLen) {
-		return false
-	}
-	s.userName = string(data)
-	return true
-}
+const sessionTokenSize = aghuser.SessionTokenLength
 
 // Auth is the global authentication object.
 type Auth struct {
 	trustedProxies netutil.SubnetSet
 	db             *bbolt.DB
 	rateLimiter    *authRateLimiter
-	sessions       map[string]*session
-	users          []webUser
-	lock           sync.Mutex
-	sessionTTL     uint32
+
+	// sessions stores the web sessions in db.
+	sessions aghuser.SessionStorage
+
+	// users contains the local users from the configuration file and the
+	// users provisioned by the single sign-on.
+	users aghuser.DB
+
+	// directory is the external database of the users, such as an LDAP
+	// directory.  The users from users take precedence over its users.  It's
+	// nil if there is none.  It's only set during the initialization, so it
+	// isn't protected by lock.
+	directory aghuser.DB
+
+	apiTokens  map[string]*apiToken
+	mfa        *mfaState
+	oidc       *oidcAuth
+	proxyAuth  *proxyAuthConfig
+	lock       sync.Mutex
+	sessionTTL uint32
+
+	// sessionIdleTimeout is the time after the last request within a session
+	// after which the session expires.  Zero means no idle timeout.
+	sessionIdleTimeout time.Duration
+
+	// maxSessions is the maximum number of sessions of a single user.  Zero
+	// means no limit.
+	maxSessions uint
 }
 
 // webUser represents a user of the Web UI.
@@ -70,187 +67,254 @@ type Auth struct {
 type webUser struct {
 	Name         string `yaml:"name"`
 	PasswordHash string `yaml:"password"`
+
+	// Role defines the permissions of the user.  Empty role means
+	// [aghuser.RoleAdmin].
+	Role aghuser.Role `yaml:"role,omitempty"`
+
+	// Clients are the names of the persistent clients the user may manage.
+	// It's only used with [aghuser.RoleParent].
+	Clients []string `yaml:"clients,omitempty"`
+
+	// external is true if the user is provisioned by the identity provider of
+	// the single sign-on.  Such users have no password and aren't written to
+	// the configuration file.
+	external bool
 }
 
-// InitAuth initializes the global authentication object.
-func InitAuth(
-	dbFilename string,
-	users []webUser,
-	sessionTTL uint32,
-	rateLimiter *authRateLimiter,
-	trustedProxies netutil.SubnetSet,
-) (a *Auth) {
-	log.Info("Initializing auth module: %s", dbFilename)
+// type check
+var _ validate.Interface = (*webUser)(nil)
 
-	a = &Auth{
-		sessionTTL:     sessionTTL,
-		rateLimiter:    rateLimiter,
-		sessions:       make(map[string]*session),
-		users:          users,
-		trustedProxies: trustedProxies,
+// Validate implements the [validate.Interface] interface for *webUser.
+func (u *webUser) Validate() (err error) {
+	if u == nil {
+		return errors.ErrNoValue
 	}
-	var err error
 
-	a.db, err = bbolt.Open(dbFilename, aghos.DefaultPermFile, nil)
-	if err != nil {
-		log.Error("auth: open DB: %s: %s", dbFilename, err)
-		if err.Error() == "invalid argument" {
-			log.Error("AdGuard Home cannot be initialized due to an incompatible file system.\nPlease read the explanation here: https://github.com/AdguardTeam/AdGuardHome/wiki/Getting-Started#limitations")
-		}
+	errs := []error{
+		validate.NotEmpty("name", u.Name),
+		u.Role.Validate(),
+	}
 
-		return nil
+	if u.Role != aghuser.RoleParent && len(u.Clients) > 0 {
+		errs = append(errs, fmt.Errorf("clients: only allowed for role %q", aghuser.RoleParent))
 	}
-	a.loadSessions()
-	log.Info("auth: initialized.  users:%d  sessions:%d", len(a.users), len(a.sessions))
 
-	return a
+	return errors.Join(errs...)
 }
 
-// Close closes the authentication database.
-func (a *Auth) Close() {
-	_ = a.db.Close()
-}
+// roleMapping maps a group of an external identity provider to a role.
+type roleMapping struct {
+	// Group is the name of the group.
+	Group string `yaml:"group"`
 
-func bucketName() []byte {
-	return []byte("sessions-2")
+	// Role is the role of the members of Group.
+	Role aghuser.Role `yaml:"role"`
 }
 
-// loadSessions loads sessions from the database file and removes expired
-// sessions.
-func (a *Auth) loadSessions() {
-	tx, err := a.db.Begin(true)
-	if err != nil {
-		log.Error("auth: bbolt.Begin: %s", err)
-
-		return
-	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
-
-	bkt := tx.Bucket(bucketName())
-	if bkt == nil {
-		return
+// validateMappedRole returns an error if r can't be assigned to the users of
+// an external identity provider.  Unlike the local users, an empty role isn't
+// allowed, so that a typo doesn't grant the administrator access.
+func validateMappedRole(r aghuser.Role) (err error) {
+	if r == "" {
+		return errors.ErrEmptyValue
+	} else if r == aghuser.RoleParent {
+		return fmt.Errorf("role %q requires clients and can't be mapped", r)
 	}
 
-	removed := 0
+	return r.Validate()
+}
 
-	if tx.Bucket([]byte("sessions")) != nil {
-		_ = tx.DeleteBucket([]byte("sessions"))
-		removed = 1
+// validateRoleMappings returns the errors of validating the default role and
+// the group mappings of an external identity provider.  An empty defaultRole
+// is valid.
+func validateRoleMappings(defaultRole aghuser.Role, mappings []*roleMapping) (errs []error) {
+	if defaultRole != "" {
+		errs = append(errs, errors.Annotate(validateMappedRole(defaultRole), "default_role: %w"))
 	}
 
-	now := uint32(time.Now().UTC().Unix())
-	forEach := func(k, v []byte) error {
-		s := session{}
-		if !s.deserialize(v) || s.expire <= now {
-			err = bkt.Delete(k)
-			if err != nil {
-				log.Error("auth: bbolt.Delete: %s", err)
-			} else {
-				removed++
-			}
+	for i, m := range mappings {
+		if m == nil {
+			errs = append(errs, fmt.Errorf("role_mappings: at index %d: %w", i, errors.ErrNoValue))
 
-			return nil
+			continue
 		}
 
-		a.sessions[hex.EncodeToString(k)] = &s
-		return nil
-	}
-	_ = bkt.ForEach(forEach)
-	if removed != 0 {
-		err = tx.Commit()
-		if err != nil {
-			log.Error("bolt.Commit(): %s", err)
-		}
+		errs = append(
+			errs,
+			errors.Annotate(validate.NotEmpty("group", m.Group), "role_mappings: at index %d: %w", i),
+			errors.Annotate(validateMappedRole(m.Role), "role_mappings: at index %d: role: %w", i),
+		)
 	}
 
-	log.Debug("auth: loaded %d sessions from DB (removed %d expired)", len(a.sessions), removed)
+	return errs
 }
 
-// addSession adds a new session to the list of sessions and saves it in the
-// database file.
-func (a *Auth) addSession(data []byte, s *session) {
-	name := hex.EncodeToString(data)
-	a.lock.Lock()
-	a.sessions[name] = s
-	a.lock.Unlock()
-	if a.storeSession(data, s) {
-		log.Debug("auth: created session %s: expire=%d", name, s.expire)
+// mappedRole returns the role of the first mapping matching one of groups or
+// defaultRole.  ok is false if there is no matching mapping and defaultRole is
+// empty, so the user isn't allowed to log in.
+func mappedRole(
+	groups []string,
+	defaultRole aghuser.Role,
+	mappings []*roleMapping,
+) (r aghuser.Role, ok bool) {
+	for _, m := range mappings {
+		if slices.Contains(groups, m.Group) {
+			return m.Role, true
+		}
 	}
+
+	return defaultRole, defaultRole != ""
 }
 
-// storeSession saves a session in the database file.
-func (a *Auth) storeSession(data []byte, s *session) bool {
-	tx, err := a.db.Begin(true)
+// toAGHUser returns a new web user with the properties of u and a new ID.
+func (u *webUser) toAGHUser() (au *aghuser.User, err error) {
+	login, err := aghuser.NewLogin(u.Name)
 	if err != nil {
-		log.Error("auth: bbolt.Begin: %s", err)
-
-		return false
+		return nil, fmt.Errorf("name: %w", err)
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
 
-	bkt, err := tx.CreateBucketIfNotExists(bucketName())
+	id, err := aghuser.NewUserID()
 	if err != nil {
-		log.Error("auth: bbolt.CreateBucketIfNotExists: %s", err)
+		return nil, fmt.Errorf("generating id: %w", err)
+	}
 
-		return false
+	var passwd aghuser.Password = aghuser.NewDefaultPassword(u.PasswordHash)
+	if u.external {
+		passwd = noPassword{}
 	}
 
-	err = bkt.Put(data, s.serialize())
-	if err != nil {
-		log.Error("auth: bbolt.Put: %s", err)
+	return &aghuser.User{
+		Password: passwd,
+		Login:    login,
+		Role:     u.Role,
+		Clients:  slices.Clone(u.Clients),
+		ID:       id,
+		External: u.external,
+	}, nil
+}
 
-		return false
+// newWebUser returns the web user with the properties of u.
+func newWebUser(u *aghuser.User) (wu *webUser) {
+	return &webUser{
+		Name:         string(u.Login),
+		PasswordHash: string(u.Password.Hash()),
+		Role:         u.Role,
+		Clients:      slices.Clone(u.Clients),
+		external:     u.External,
 	}
+}
 
-	err = tx.Commit()
-	if err != nil {
-		log.Error("auth: bbolt.Commit: %s", err)
+// noPassword is the [aghuser.Password] of the users provisioned by the single
+// sign-on, who can't log in with a password.
+type noPassword struct{}
 
-		return false
-	}
+// type check
+var _ aghuser.Password = noPassword{}
 
-	return true
+// Authenticate implements the [aghuser.Password] interface for noPassword.  It
+// always returns false.
+func (noPassword) Authenticate(_ context.Context, _ string) (ok bool) {
+	return false
 }
 
-// removeSessionFromFile removes a stored session from the DB file on disk.
-func (a *Auth) removeSessionFromFile(sess []byte) {
-	tx, err := a.db.Begin(true)
-	if err != nil {
-		log.Error("auth: bbolt.Begin: %s", err)
+// Hash implements the [aghuser.Password] interface for noPassword.  It always
+// returns nil.
+func (noPassword) Hash() (b []byte) {
+	return nil
+}
 
-		return
+// InitAuth initializes the global authentication object.
+func InitAuth(
+	ctx context.Context,
+	baseLogger *slog.Logger,
+	dbFilename string,
+	users []webUser,
+	sessionTTL uint32,
+	rateLimiter *authRateLimiter,
+	trustedProxies netutil.SubnetSet,
+) (a *Auth) {
+	log.Info("Initializing auth module: %s", dbFilename)
+
+	a = &Auth{
+		sessionTTL:     sessionTTL,
+		rateLimiter:    rateLimiter,
+		users:          aghuser.NewDefaultDB(),
+		apiTokens:      make(map[string]*apiToken),
+		mfa:            newMFAState(),
+		trustedProxies: trustedProxies,
 	}
 
-	defer func() {
-		_ = tx.Rollback()
-	}()
+	for i := range users {
+		err := a.createUser(ctx, &users[i])
+		if err != nil {
+			log.Error("auth: adding user %q: %s", users[i].Name, err)
+		}
+	}
 
-	bkt := tx.Bucket(bucketName())
-	if bkt == nil {
-		log.Error("auth: bbolt.Bucket")
+	var err error
+	a.db, err = bbolt.Open(dbFilename, aghos.DefaultPermFile, nil)
+	if err != nil {
+		log.Error("auth: open DB: %s: %s", dbFilename, err)
+		if err.Error() == "invalid argument" {
+			log.Error("AdGuard Home cannot be initialized due to an incompatible file system.\nPlease read the explanation here: https://github.com/AdguardTeam/AdGuardHome/wiki/Getting-Started#limitations")
+		}
 
-		return
+		return nil
 	}
 
-	err = bkt.Delete(sess)
+	removeLegacySessions(a.db)
+
+	a.sessions, err = aghuser.NewDefaultSessionStorage(ctx, &aghuser.DefaultSessionStorageConfig{
+		Logger:     baseLogger.With(slogutil.KeyPrefix, "sessions"),
+		Clock:      timeutil.SystemClock{},
+		DB:         a.db,
+		SessionTTL: time.Duration(sessionTTL) * time.Second,
+	})
 	if err != nil {
-		log.Error("auth: bbolt.Put: %s", err)
+		log.Error("auth: loading sessions: %s", err)
+		_ = a.db.Close()
 
-		return
+		return nil
 	}
 
-	err = tx.Commit()
+	a.loadAPITokens()
+	a.loadMFA()
+	log.Info("auth: initialized.  users:%d  api tokens:%d", len(users), len(a.apiTokens))
+
+	return a
+}
+
+// Close closes the authentication database.
+func (a *Auth) Close() {
+	err := a.sessions.Close()
 	if err != nil {
-		log.Error("auth: bbolt.Commit: %s", err)
+		log.Error("auth: closing sessions: %s", err)
+	}
 
-		return
+	_ = a.db.Close()
+}
+
+// removeLegacySessions removes the bucket of the sessions stored by the very
+// old versions.
+func removeLegacySessions(db *bbolt.DB) {
+	err := db.Update(func(tx *bbolt.Tx) (err error) {
+		const name = "sessions"
+		if tx.Bucket([]byte(name)) == nil {
+			return nil
+		}
+
+		return tx.DeleteBucket([]byte(name))
+	})
+	if err != nil {
+		log.Error("auth: removing legacy sessions: %s", err)
 	}
+}
 
-	log.Debug("auth: removed session from DB")
+// setDirectory sets the external database of the users.  db may be nil.  It
+// must only be called during the initialization.
+func (a *Auth) setDirectory(db aghuser.DB) {
+	a.directory = db
 }
 
 // checkSessionResult is the result of checking a session.
@@ -263,100 +327,194 @@ const (
 	checkSessionExpired  checkSessionResult = 1
 )
 
-// checkSession checks if the session is valid.
-func (a *Auth) checkSession(sess string) (res checkSessionResult) {
-	now := uint32(time.Now().UTC().Unix())
-	update := false
+// parseSessionToken returns the session token from its hexadecimal
+// representation.
+func parseSessionToken(sess string) (t aghuser.SessionToken, ok bool) {
+	data, err := hex.DecodeString(sess)
+	if err != nil || len(data) != aghuser.SessionTokenLength {
+		return t, false
+	}
 
-	a.lock.Lock()
-	defer a.lock.Unlock()
+	return aghuser.SessionToken(data), true
+}
 
-	s, ok := a.sessions[sess]
+// findSession returns the session with the hexadecimal token sess or nil if
+// there is none.
+func (a *Auth) findSession(ctx context.Context, sess string) (s *aghuser.Session) {
+	t, ok := parseSessionToken(sess)
 	if !ok {
+		return nil
+	}
+
+	s, err := a.sessions.FindByToken(ctx, t)
+	if err != nil {
+		log.Error("auth: searching session: %s", err)
+	}
+
+	return s
+}
+
+// checkSession checks if the session is valid.
+func (a *Auth) checkSession(ctx context.Context, sess string) (res checkSessionResult) {
+	s := a.findSession(ctx, sess)
+	if s == nil {
 		return checkSessionNotFound
 	}
 
-	if s.expire <= now {
-		delete(a.sessions, sess)
-		key, _ := hex.DecodeString(sess)
-		a.removeSessionFromFile(key)
+	now := time.Now()
+	if a.idleExpired(s, now) {
+		a.removeSession(ctx, sess)
 
 		return checkSessionExpired
 	}
 
-	newExpire := now + a.sessionTTL
-	if s.expire/(24*60*60) != newExpire/(24*60*60) {
-		// update expiration time once a day
-		update = true
-		s.expire = newExpire
+	if u := a.userByName(ctx, string(s.UserLogin)); u == nil || u.External {
+		// The external identity provider isn't asked whether the user still
+		// exists, so the session isn't renewed.
+		if externalExpired(s.Created, now) {
+			a.removeSession(ctx, sess)
+
+			return checkSessionExpired
+		}
+
+		return checkSessionOK
 	}
 
-	if update {
-		key, _ := hex.DecodeString(sess)
-		if a.storeSession(key, s) {
-			log.Debug("auth: updated session %s: expire=%d", sess, s.expire)
+	const day = 24 * 60 * 60
+	newExpire := now.Add(time.Duration(a.sessionTTL) * time.Second)
+	if s.Expire.Unix()/day != newExpire.Unix()/day {
+		// update expiration time once a day
+		upd := s.Clone()
+		upd.Expire = newExpire
+
+		err := a.sessions.Update(ctx, upd)
+		if err != nil {
+			log.Error("auth: updating session %s: %s", sessionID(sess), err)
+		} else {
+			log.Debug("auth: updated session %s: expire=%s", sessionID(sess), newExpire)
 		}
 	}
 
 	return checkSessionOK
 }
 
+// maxExternalAge is the maximum lifetime of the sessions and the API tokens of
+// the users provisioned by an external identity provider.  The provider is only
+// asked about the user on login, so a user removed from it stays logged in
+// until then.
+const maxExternalAge = 24 * time.Hour
+
+// externalExpired returns true if a session or an API token of an external
+// user created at created is no longer valid at now.
+func externalExpired(created, now time.Time) (ok bool) {
+	return created.IsZero() || now.Sub(created) >= maxExternalAge
+}
+
 // removeSession removes the session from the active sessions and the disk.
-func (a *Auth) removeSession(sess string) {
-	key, _ := hex.DecodeString(sess)
-	a.lock.Lock()
-	delete(a.sessions, sess)
-	a.lock.Unlock()
-	a.removeSessionFromFile(key)
+func (a *Auth) removeSession(ctx context.Context, sess string) {
+	t, ok := parseSessionToken(sess)
+	if !ok {
+		return
+	}
+
+	err := a.sessions.DeleteByToken(ctx, t)
+	if err != nil {
+		log.Error("auth: removing session %s: %s", sessionID(sess), err)
+	}
 }
 
-// addUser adds a new user with the given password.
-func (a *Auth) addUser(u *webUser, password string) (err error) {
+// createUser adds u to the local users.
+func (a *Auth) createUser(ctx context.Context, u *webUser) (err error) {
+	au, err := u.toAGHUser()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	return a.users.Create(ctx, au)
+}
+
+// hashPassword returns the hash of the password for storing in the
+// configuration file.
+func hashPassword(password string) (hash string, err error) {
 	if len(password) == 0 {
-		return errors.Error("empty password")
+		return "", errors.Error("empty password")
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	data, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return fmt.Errorf("generating hash: %w", err)
+		return "", fmt.Errorf("generating hash: %w", err)
 	}
 
-	u.PasswordHash = string(hash)
+	return string(data), nil
+}
 
-	a.lock.Lock()
-	defer a.lock.Unlock()
+// addUser adds a new user with the given password.
+func (a *Auth) addUser(ctx context.Context, u *webUser, password string) (err error) {
+	u.PasswordHash, err = hashPassword(password)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
 
-	a.users = append(a.users, *u)
+	err = a.createUser(ctx, u)
+	if err != nil {
+		return fmt.Errorf("adding user: %w", err)
+	}
 
 	log.Debug("auth: added user with login %q", u.Name)
 
 	return nil
 }
 
-// findUser returns a user if there is one.
-func (a *Auth) findUser(login, password string) (u webUser, ok bool) {
-	a.lock.Lock()
-	defer a.lock.Unlock()
+// localUser returns the local user or the user provisioned by the single
+// sign-on with name or nil if there is none.
+func (a *Auth) localUser(ctx context.Context, name string) (u *aghuser.User) {
+	u, err := a.users.ByLogin(ctx, aghuser.Login(name))
+	if err != nil {
+		// Should not happen, since the local users are kept in memory.
+		log.Error("auth: searching user %q: %s", name, err)
+	}
 
-	for _, u = range a.users {
-		if u.Name == login &&
-			bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil {
-			return u, true
-		}
+	return u
+}
+
+// userByName returns the local user or the user of the external directory
+// with name or nil if there is none.
+func (a *Auth) userByName(ctx context.Context, name string) (u *aghuser.User) {
+	u = a.localUser(ctx, name)
+	if u != nil || a.directory == nil {
+		return u
 	}
 
-	return webUser{}, false
+	u, err := a.directory.ByLogin(ctx, aghuser.Login(name))
+	if err != nil {
+		log.Error("auth: searching directory user %q: %s", name, err)
+	}
+
+	return u
+}
+
+// findUser returns a user if there is one.
+func (a *Auth) findUser(ctx context.Context, login, password string) (u webUser, ok bool) {
+	au := a.userByName(ctx, login)
+	if au == nil || !au.Password.Authenticate(ctx, password) {
+		return webUser{}, false
+	}
+
+	return *newWebUser(au), true
 }
 
 // getCurrentUser returns the current user.  It returns an empty User if the
 // user is not found.
 func (a *Auth) getCurrentUser(r *http.Request) (u webUser) {
+	ctx := r.Context()
 	cookie, err := r.Cookie(sessionCookieName)
 	if err != nil {
 		// There's no Cookie, check Basic authentication.
 		user, pass, ok := r.BasicAuth()
 		if ok {
-			u, _ = globalContext.auth.findUser(user, pass)
+			u, _ = a.findUser(ctx, user, pass)
 
 			return u
 		}
@@ -364,30 +522,39 @@ func (a *Auth) getCurrentUser(r *http.Request) (u webUser) {
 		return webUser{}
 	}
 
-	a.lock.Lock()
-	defer a.lock.Unlock()
+	s := a.findSession(ctx, cookie.Value)
+	if s == nil {
+		return webUser{}
+	}
 
-	s, ok := a.sessions[cookie.Value]
-	if !ok {
+	au := a.userByName(ctx, string(s.UserLogin))
+	if au == nil {
 		return webUser{}
 	}
 
-	for _, u = range a.users {
-		if u.Name == s.userName {
-			return u
-		}
+	return *newWebUser(au)
+}
+
+// localUsers returns the local users, excluding the users provisioned by the
+// single sign-on, sorted by name.
+func (a *Auth) localUsers(ctx context.Context) (users []*aghuser.User) {
+	all, err := a.users.All(ctx)
+	if err != nil {
+		// Should not happen, since the local users are kept in memory.
+		log.Error("auth: getting users: %s", err)
 	}
 
-	return webUser{}
+	return slices.DeleteFunc(all, func(u *aghuser.User) (ok bool) { return u.External })
 }
 
-// usersList returns a copy of a users list.
+// usersList returns a copy of a users list without the users provisioned by
+// the identity provider.
 func (a *Auth) usersList() (users []webUser) {
-	a.lock.Lock()
-	defer a.lock.Unlock()
-
-	users = make([]webUser, len(a.users))
-	copy(users, a.users)
+	local := a.localUsers(context.TODO())
+	users = make([]webUser, 0, len(local))
+	for _, u := range local {
+		users = append(users, *newWebUser(u))
+	}
 
 	return users
 }
@@ -398,10 +565,16 @@ func (a *Auth) authRequired() bool {
 		return true
 	}
 
+	users, err := a.users.All(context.TODO())
+	if err != nil {
+		// Should not happen, since the local users are kept in memory.
+		log.Error("auth: getting users: %s", err)
+	}
+
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
-	return len(a.users) != 0
+	return len(users) != 0 || a.directory != nil || a.oidc != nil || a.proxyAuth != nil
 }
 
 // newSessionToken returns cryptographically secure randomly generated slice of
@@ -1,11 +1,13 @@
 package home
 
 import (
-	"encoding/hex"
+	"context"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,52 +20,125 @@ func TestAuth(t *testing.T) {
 		Name:         "name",
 		PasswordHash: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2",
 	}}
-	a := InitAuth(fn, nil, 60, nil, nil)
-	s := session{}
+
+	// Use the TTL of 2 seconds to check the expiration.
+	const ttl = 2
+
+	a := InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		fn,
+		nil,
+		ttl,
+		nil,
+		nil,
+	)
+	require.NotNil(t, a)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
 
 	user := webUser{Name: "name"}
-	err := a.addUser(&user, "password")
+	err := a.addUser(ctx, &user, "password")
 	require.NoError(t, err)
 
-	assert.Equal(t, checkSessionNotFound, a.checkSession("notfound"))
-	a.removeSession("notfound")
+	assert.Equal(t, checkSessionNotFound, a.checkSession(ctx, "notfound"))
+	a.removeSession(ctx, "notfound")
 
-	sess := newSessionToken()
-	sessStr := hex.EncodeToString(sess)
-
-	now := time.Now().UTC().Unix()
-	// check expiration
-	s.expire = uint32(now)
-	a.addSession(sess, &s)
-	assert.Equal(t, checkSessionExpired, a.checkSession(sessStr))
+	c, err := a.newSessionCookie(ctx, user.Name, newSessionClient(nil))
+	require.NoError(t, err)
 
-	// add session with TTL = 2 sec
-	s = session{}
-	s.expire = uint32(time.Now().UTC().Unix() + 2)
-	a.addSession(sess, &s)
-	assert.Equal(t, checkSessionOK, a.checkSession(sessStr))
+	assert.Equal(t, checkSessionOK, a.checkSession(ctx, c.Value))
 
 	a.Close()
 
 	// load saved session
-	a = InitAuth(fn, users, 60, nil, nil)
+	a = InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		fn,
+		users,
+		ttl,
+		nil,
+		nil,
+	)
+	require.NotNil(t, a)
 
 	// the session is still alive
-	assert.Equal(t, checkSessionOK, a.checkSession(sessStr))
-	// reset our expiration time because checkSession() has just updated it
-	s.expire = uint32(time.Now().UTC().Unix() + 2)
-	a.storeSession(sess, &s)
-	a.Close()
+	assert.Equal(t, checkSessionOK, a.checkSession(ctx, c.Value))
 
-	u, ok := a.findUser("name", "password")
+	u, ok := a.findUser(ctx, "name", "password")
 	assert.True(t, ok)
 	assert.NotEmpty(t, u.Name)
 
-	time.Sleep(3 * time.Second)
+	_, ok = a.findUser(ctx, "name", "wrong")
+	assert.False(t, ok)
+
+	a.Close()
+
+	time.Sleep(ttl * time.Second)
+	ctx = testutil.ContextWithTimeout(t, testTimeout)
 
 	// load and remove expired sessions
-	a = InitAuth(fn, users, 60, nil, nil)
-	assert.Equal(t, checkSessionNotFound, a.checkSession(sessStr))
+	a = InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		fn,
+		users,
+		ttl,
+		nil,
+		nil,
+	)
+	require.NotNil(t, a)
+
+	assert.Equal(t, checkSessionNotFound, a.checkSession(ctx, c.Value))
 
 	a.Close()
 }
+
+func TestAuth_checkSession_external(t *testing.T) {
+	const login aghuser.Login = "directory_user"
+
+	a := InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		filepath.Join(t.TempDir(), "sessions.db"),
+		nil,
+		3600,
+		nil,
+		nil,
+	)
+	require.NotNil(t, a)
+	t.Cleanup(a.Close)
+
+	db := newTestUsersDB()
+	db.onByLogin = func(_ context.Context, l aghuser.Login) (u *aghuser.User, err error) {
+		return &aghuser.User{
+			Login:    l,
+			Role:     aghuser.RoleAdmin,
+			External: true,
+		}, nil
+	}
+	a.setDirectory(db)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	c, err := a.newSessionCookie(ctx, string(login), newSessionClient(nil))
+	require.NoError(t, err)
+
+	s := a.findSession(ctx, c.Value)
+	require.NotNil(t, s)
+
+	assert.Equal(t, checkSessionOK, a.checkSession(ctx, c.Value))
+
+	// The session of an external user isn't renewed.
+	renewed := a.findSession(ctx, c.Value)
+	require.NotNil(t, renewed)
+
+	assert.Equal(t, s.Expire, renewed.Expire)
+
+	upd := s.Clone()
+	upd.Created = time.Now().Add(-maxExternalAge)
+	require.NoError(t, a.sessions.Update(ctx, upd))
+
+	assert.Equal(t, checkSessionExpired, a.checkSession(ctx, c.Value))
+	assert.Equal(t, checkSessionNotFound, a.checkSession(ctx, c.Value))
+}
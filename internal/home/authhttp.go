@@ -37,10 +37,20 @@ type loginJSON struct {
 	Password string `json:"password"`
 }
 
-// newCookie creates a new authentication cookie.
-func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error) {
+// errMFARequired is returned by [Auth.newCookie] when the password is correct
+// but the user has to pass the second factor.
+const errMFARequired errors.Error = "second factor is required"
+
+// newCookie creates a new authentication cookie for the client c.  It returns
+// [errMFARequired] if the user has a second factor.
+func (a *Auth) newCookie(
+	ctx context.Context,
+	req loginJSON,
+	addr string,
+	client *sessionClient,
+) (c *http.Cookie, err error) {
 	rateLimiter := a.rateLimiter
-	u, ok := a.findUser(req.Name, req.Password)
+	u, ok := a.findUser(ctx, req.Name, req.Password)
 	if !ok {
 		if rateLimiter != nil {
 			rateLimiter.inc(addr)
@@ -49,26 +59,16 @@ func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error)
 		return nil, errors.Error("invalid username or password")
 	}
 
+	if a.userHasMFA(u.Name) {
+		// Don't reset the rate limiter until the second factor is passed.
+		return nil, errMFARequired
+	}
+
 	if rateLimiter != nil {
 		rateLimiter.remove(addr)
 	}
 
-	sess := newSessionToken()
-	now := time.Now().UTC()
-
-	a.addSession(sess, &session{
-		userName: u.Name,
-		expire:   uint32(now.Unix()) + a.sessionTTL,
-	})
-
-	return &http.Cookie{
-		Name:     sessionCookieName,
-		Value:    hex.EncodeToString(sess),
-		Path:     "/",
-		Expires:  now.Add(cookieTTL),
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	}, nil
+	return a.newSessionCookie(ctx, u.Name, client)
 }
 
 // realIP extracts the real IP address of the client from an HTTP request using
@@ -178,8 +178,13 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		log.Error("auth: getting real ip from request with remote ip %s: %s", remoteIP, err)
 	}
 
-	cookie, err := globalContext.auth.newCookie(req, remoteIP)
-	if err != nil {
+	cookie, err := globalContext.auth.newCookie(r.Context(), req, remoteIP, newSessionClient(r))
+	if errors.Is(err, errMFARequired) {
+		log.Info("auth: user %q from ip %s needs to pass second factor", req.Name, ip)
+		writeMFALoginResp(w, r, req.Name)
+
+		return
+	} else if err != nil {
 		logIP := remoteIP
 		if globalContext.auth.trustedProxies.Contains(ip.Unmap()) {
 			logIP = ip.String()
@@ -193,13 +198,18 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 	log.Info("auth: user %q successfully logged in from ip %s", req.Name, ip)
 
 	http.SetCookie(w, cookie)
+	setNoCacheHeaders(w)
+
+	aghhttp.OK(w)
+}
 
+// setNoCacheHeaders sets the headers that prevent caching of the responses
+// with credentials.
+func setNoCacheHeaders(w http.ResponseWriter) {
 	h := w.Header()
 	h.Set(httphdr.CacheControl, "no-store, no-cache, must-revalidate, proxy-revalidate")
 	h.Set(httphdr.Pragma, "no-cache")
 	h.Set(httphdr.Expires, "0")
-
-	aghhttp.OK(w)
 }
 
 // handleLogout is the handler for the GET /control/logout HTTP API.
@@ -215,7 +225,7 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	globalContext.auth.removeSession(c.Value)
+	globalContext.auth.removeSession(r.Context(), c.Value)
 
 	c = &http.Cookie{
 		Name:    sessionCookieName,
@@ -236,41 +246,96 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 func RegisterAuthHandlers() {
 	globalContext.mux.Handle("/control/login", postInstallHandler(ensureHandler(http.MethodPost, handleLogin)))
 	httpRegister(http.MethodGet, "/control/logout", handleLogout)
+	registerAPITokenHandlers()
+	registerMFAHandlers()
+	registerOIDCHandlers()
+	registerSessionHandlers()
+	registerUsersHandlers()
 }
 
-// optionalAuthThird returns true if a user should authenticate first.
-func optionalAuthThird(w http.ResponseWriter, r *http.Request) (mustAuth bool) {
+// optionalAuthThird returns true if a user should authenticate first.  If the
+// user is authenticated by [Auth], authed is r with the user and the API token,
+// if any, added to its context.
+func optionalAuthThird(
+	w http.ResponseWriter,
+	r *http.Request,
+) (authed *http.Request, mustAuth bool) {
 	pref := fmt.Sprintf("auth: raddr %s", r.RemoteAddr)
 
 	if glProcessCookie(r) {
 		log.Debug("%s: authentication is handled by gl-inet submodule", pref)
 
-		return false
+		return r, false
 	}
 
 	// redirect to login page if not authenticated
 	isAuthenticated := false
-	cookie, err := r.Cookie(sessionCookieName)
-	if err != nil {
+	var u *webUser
+	if token, ok := bearerToken(r); ok {
+		if rejectRateLimited(w, r) {
+			return nil, true
+		}
+
+		var t *apiToken
+		t, u, isAuthenticated = checkRequestAPIToken(r, token)
+		recordAuthAttempt(r, isAuthenticated)
+		if isAuthenticated {
+			r = r.WithContext(withAPIToken(r.Context(), t))
+		}
+	} else if pu, found, perr := globalContext.auth.userFromProxyHeaders(r); found {
+		if perr != nil {
+			log.Info("%s: refusing proxy authentication: %s", pref, perr)
+		} else {
+			isAuthenticated, u = true, pu
+		}
+	} else if cookie, err := r.Cookie(sessionCookieName); err != nil {
 		// The only error that is returned from r.Cookie is [http.ErrNoCookie].
 		// Check Basic authentication.
 		user, pass, hasBasic := r.BasicAuth()
 		if hasBasic {
-			_, isAuthenticated = globalContext.auth.findUser(user, pass)
+			if rejectRateLimited(w, r) {
+				return nil, true
+			}
+
+			var found webUser
+			found, isAuthenticated = globalContext.auth.findUser(r.Context(), user, pass)
 			if !isAuthenticated {
+				recordAuthAttempt(r, false)
 				log.Info("%s: invalid basic authorization value", pref)
+			} else if globalContext.auth.userHasMFA(found.Name) {
+				// Basic authentication can't carry the second factor, so the
+				// users with one must use API tokens instead.  Don't reset the
+				// rate limiter, since the second factor isn't passed.
+				isAuthenticated = false
+				log.Info("%s: basic authorization for user %q with second factor", pref, user)
+			} else {
+				recordAuthAttempt(r, true)
+				u = &found
 			}
 		}
 	} else {
-		res := globalContext.auth.checkSession(cookie.Value)
+		res := globalContext.auth.checkSession(r.Context(), cookie.Value)
 		isAuthenticated = res == checkSessionOK
 		if !isAuthenticated {
 			log.Debug("%s: invalid cookie value: %q", pref, cookie)
+		} else if found := globalContext.auth.getCurrentUser(r); found.Name != "" {
+			u = &found
+			globalContext.auth.touchSession(
+				r.Context(),
+				cookie.Value,
+				newSessionClient(r),
+				time.Now().UTC(),
+			)
+		} else {
+			// Don't let the sessions of the removed users inherit the
+			// permissions of the administrator.
+			isAuthenticated = false
+			log.Debug("%s: no user for session", pref)
 		}
 	}
 
 	if isAuthenticated {
-		return false
+		return r.WithContext(withAuthUser(r.Context(), u)), false
 	}
 
 	if p := r.URL.Path; p == "/" || p == "/index.html" {
@@ -286,9 +351,114 @@ func optionalAuthThird(w http.ResponseWriter, r *http.Request) (mustAuth bool) {
 		_, _ = w.Write([]byte("Forbidden"))
 	}
 
+	return nil, true
+}
+
+// rejectRateLimited writes the error and returns true if the client sending
+// the credentials in r is blocked by the rate limiter of [Auth].
+func rejectRateLimited(w http.ResponseWriter, r *http.Request) (rejected bool) {
+	rateLimiter := globalContext.auth.rateLimiter
+	if rateLimiter == nil {
+		return false
+	}
+
+	// realIP cannot be used here without taking TrustedProxies into account
+	// due to security issues, so use the same key as the login handler.
+	remoteIP, err := netutil.SplitHost(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	left := rateLimiter.check(remoteIP)
+	if left <= 0 {
+		return false
+	}
+
+	w.Header().Set(httphdr.RetryAfter, strconv.Itoa(int(left.Seconds())))
+	writeErrorWithIP(r, w, http.StatusTooManyRequests, remoteIP, "auth: blocked for %s", left)
+
 	return true
 }
 
+// recordAuthAttempt updates the rate limiter of [Auth] with the result of the
+// authentication of the client sending r.
+func recordAuthAttempt(r *http.Request, ok bool) {
+	rateLimiter := globalContext.auth.rateLimiter
+	if rateLimiter == nil {
+		return
+	}
+
+	remoteIP, err := netutil.SplitHost(r.RemoteAddr)
+	if err != nil {
+		return
+	}
+
+	if ok {
+		rateLimiter.remove(remoteIP)
+	} else {
+		rateLimiter.inc(remoteIP)
+	}
+}
+
+// bearerToken returns the API token from the Authorization header of r, if
+// any.
+func bearerToken(r *http.Request) (token string, ok bool) {
+	const scheme = "Bearer "
+
+	v := r.Header.Get(httphdr.Authorization)
+	if len(v) <= len(scheme) || !strings.EqualFold(v[:len(scheme)], scheme) {
+		return "", false
+	}
+
+	return strings.TrimSpace(v[len(scheme):]), true
+}
+
+// checkRequestAPIToken checks the API token from r and returns its information
+// and owner if it's valid.
+func checkRequestAPIToken(r *http.Request, token string) (t *apiToken, u *webUser, ok bool) {
+	ip, err := requestIP(r)
+	if err != nil {
+		log.Info("auth: raddr %s: api token: %s", r.RemoteAddr, err)
+
+		return nil, nil, false
+	}
+
+	t, u, err = globalContext.auth.checkAPIToken(r.Context(), token, ip, time.Now())
+	if err != nil {
+		log.Info("auth: raddr %s: api token: %s", r.RemoteAddr, err)
+
+		return nil, nil, false
+	}
+
+	return t, u, true
+}
+
+// requestIP returns the IP address of the client sending r.  The address from
+// the proxy headers is only used if the request comes from a trusted proxy.
+func requestIP(r *http.Request) (ip netip.Addr, err error) {
+	remoteIP, err := netutil.SplitHost(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("getting remote address: %w", err)
+	}
+
+	ip, err = netip.ParseAddr(remoteIP)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("parsing remote address: %w", err)
+	}
+
+	ip = ip.Unmap()
+	if !globalContext.auth.trustedProxies.Contains(ip) {
+		return ip, nil
+	}
+
+	ip, err = realIP(r)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("getting real ip: %w", err)
+	}
+
+	return ip.Unmap(), nil
+}
+
 // TODO(a.garipov): Use [http.Handler] consistently everywhere throughout the
 // project.
 func optionalAuth(
@@ -301,7 +471,7 @@ func optionalAuth(
 			cookie, err := r.Cookie(sessionCookieName)
 			if authRequired && err == nil {
 				// Redirect to the dashboard if already authenticated.
-				res := globalContext.auth.checkSession(cookie.Value)
+				res := globalContext.auth.checkSession(r.Context(), cookie.Value)
 				if res == checkSessionOK {
 					http.Redirect(w, r, "", http.StatusFound)
 
@@ -313,7 +483,9 @@ func optionalAuth(
 		} else if isPublicResource(p) {
 			// Process as usual, no additional auth requirements.
 		} else if authRequired {
-			if optionalAuthThird(w, r) {
+			var mustAuth bool
+			r, mustAuth = optionalAuthThird(w, r)
+			if mustAuth {
 				return
 			}
 		}
@@ -23,6 +23,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
 	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -37,6 +38,11 @@ type testSessionStorage struct {
 		ctx context.Context,
 		t aghuser.SessionToken,
 	) (s *aghuser.Session, err error)
+	onFindByUser func(
+		ctx context.Context,
+		login aghuser.Login,
+	) (sessions []*aghuser.Session, err error)
+	onUpdate        func(ctx context.Context, s *aghuser.Session) (err error)
 	onDeleteByToken func(ctx context.Context, t aghuser.SessionToken) (err error)
 	onClose         func() (err error)
 }
@@ -57,6 +63,15 @@ func newTestSessionStorage() (ts *testSessionStorage) {
 		) (_ *aghuser.Session, err error) {
 			panic(fmt.Errorf("unexpected call to testSessionStorage.FindByToken(%v)", t))
 		},
+		onFindByUser: func(
+			_ context.Context,
+			l aghuser.Login,
+		) (_ []*aghuser.Session, _ error) {
+			panic(fmt.Errorf("unexpected call to testSessionStorage.FindByUser(%v)", l))
+		},
+		onUpdate: func(_ context.Context, s *aghuser.Session) (_ error) {
+			panic(fmt.Errorf("unexpected call to testSessionStorage.Update(%v)", s))
+		},
 		onDeleteByToken: func(_ context.Context, t aghuser.SessionToken) (_ error) {
 			panic(fmt.Errorf("unexpected call to testSessionStorage.DeleteByToken(%v)", t))
 		},
@@ -84,6 +99,21 @@ func (ts *testSessionStorage) FindByToken(
 	return ts.onFindByToken(ctx, t)
 }
 
+// FindByUser implements the [aghuser.SessionStorage] interface for
+// *testSessionStorage.
+func (ts *testSessionStorage) FindByUser(
+	ctx context.Context,
+	login aghuser.Login,
+) (sessions []*aghuser.Session, err error) {
+	return ts.onFindByUser(ctx, login)
+}
+
+// Update implements the [aghuser.SessionStorage] interface for
+// *testSessionStorage.
+func (ts *testSessionStorage) Update(ctx context.Context, s *aghuser.Session) (err error) {
+	return ts.onUpdate(ctx, s)
+}
+
 // DeleteByToken implements the [aghuser.SessionStorage] interface for
 // *testSessionStorage.
 func (ts *testSessionStorage) DeleteByToken(
@@ -105,6 +135,8 @@ type testUsersDB struct {
 	onByLogin func(ctx context.Context, login aghuser.Login) (u *aghuser.User, err error)
 	onByUUID  func(ctx context.Context, id aghuser.UserID) (u *aghuser.User, err error)
 	onCreate  func(ctx context.Context, u *aghuser.User) (err error)
+	onUpdate  func(ctx context.Context, u *aghuser.User) (err error)
+	onDelete  func(ctx context.Context, id aghuser.UserID) (err error)
 }
 
 // newTestUsersDB returns a new *testUsersDB all methods of which panic.
@@ -122,6 +154,12 @@ func newTestUsersDB() (ts *testUsersDB) {
 		onCreate: func(_ context.Context, u *aghuser.User) (_ error) {
 			panic(fmt.Errorf("unexpected call to testUsersDB.Create(%v)", u))
 		},
+		onUpdate: func(_ context.Context, u *aghuser.User) (_ error) {
+			panic(fmt.Errorf("unexpected call to testUsersDB.Update(%v)", u))
+		},
+		onDelete: func(_ context.Context, id aghuser.UserID) (_ error) {
+			panic(fmt.Errorf("unexpected call to testUsersDB.Delete(%v)", id))
+		},
 	}
 }
 
@@ -151,6 +189,16 @@ func (db *testUsersDB) Create(ctx context.Context, u *aghuser.User) (err error)
 	return db.onCreate(ctx, u)
 }
 
+// Update implements the [aghuser.DB] interface for *testUsersDB.
+func (db *testUsersDB) Update(ctx context.Context, u *aghuser.User) (err error) {
+	return db.onUpdate(ctx, u)
+}
+
+// Delete implements the [aghuser.DB] interface for *testUsersDB.
+func (db *testUsersDB) Delete(ctx context.Context, id aghuser.UserID) (err error) {
+	return db.onDelete(ctx, id)
+}
+
 // testAuthHandler is a helper handler used for testing HTTP middleware.
 type testAuthHandler struct {
 	user   *aghuser.User
@@ -445,7 +493,15 @@ func TestAuth_ServeHTTP_auth(t *testing.T) {
 		Name:         userName,
 		PasswordHash: string(passwordHash),
 	}}
-	auth := InitAuth(sessionsDB, users, testTTL, nil, nil)
+	auth := InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		sessionsDB,
+		users,
+		testTTL,
+		nil,
+		netutil.SliceSubnetSet(nil),
+	)
 	t.Cleanup(auth.Close)
 	globalContext.auth = auth
 
@@ -578,7 +634,15 @@ func TestAuth_ServeHTTP_logout(t *testing.T) {
 		Name:         userName,
 		PasswordHash: string(passwordHash),
 	}}
-	auth := InitAuth(sessionsDB, users, testTTL, nil, nil)
+	auth := InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		sessionsDB,
+		users,
+		testTTL,
+		nil,
+		netutil.SliceSubnetSet(nil),
+	)
 	t.Cleanup(auth.Close)
 	globalContext.auth = auth
 
@@ -632,7 +696,15 @@ func TestAuthHTTP(t *testing.T) {
 	users := []webUser{
 		{Name: "name", PasswordHash: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2"},
 	}
-	globalContext.auth = InitAuth(fn, users, 60, nil, nil)
+	globalContext.auth = InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		fn,
+		users,
+		60,
+		nil,
+		netutil.SliceSubnetSet(nil),
+	)
 
 	handlerCalled := false
 	handler := func(_ http.ResponseWriter, _ *http.Request) {
@@ -661,7 +733,12 @@ func TestAuthHTTP(t *testing.T) {
 	assert.True(t, handlerCalled)
 
 	// perform login
-	cookie, err := globalContext.auth.newCookie(loginJSON{Name: "name", Password: "password"}, "")
+	cookie, err := globalContext.auth.newCookie(
+		testutil.ContextWithTimeout(t, testTimeout),
+		loginJSON{Name: "name", Password: "password"},
+		"",
+		newSessionClient(nil),
+	)
 	require.NoError(t, err)
 	require.NotNil(t, cookie)
 
@@ -710,6 +787,70 @@ func TestAuthHTTP(t *testing.T) {
 	globalContext.auth.Close()
 }
 
+func TestOptionalAuth_rateLimit(t *testing.T) {
+	storeGlobals(t)
+
+	users := []webUser{{
+		Name:         "name",
+		PasswordHash: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2",
+	}}
+
+	rateLimiter := newAuthRateLimiter(time.Hour, 2)
+	globalContext.auth = InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		filepath.Join(t.TempDir(), "sessions.db"),
+		users,
+		60,
+		rateLimiter,
+		netutil.SliceSubnetSet(nil),
+	)
+	require.NotNil(t, globalContext.auth)
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		globalContext.auth.Close()
+
+		return nil
+	})
+
+	h := optionalAuth(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	do := func(t *testing.T, setAuth func(r *http.Request)) (w *httptest.ResponseRecorder) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/control/status", nil)
+		setAuth(r)
+
+		w = httptest.NewRecorder()
+		h(w, r)
+
+		return w
+	}
+
+	basic := func(pass string) (f func(r *http.Request)) {
+		return func(r *http.Request) { r.SetBasicAuth("name", pass) }
+	}
+
+	w := do(t, basic("password"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do(t, basic("wrong"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do(t, func(r *http.Request) { r.Header.Set(httphdr.Authorization, "Bearer bad") })
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do(t, basic("password"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get(httphdr.RetryAfter))
+
+	bans := rateLimiter.Bans(time.Now())
+	require.Len(t, bans, 1)
+
+	assert.Equal(t, netip.MustParseAddr("192.0.2.1"), bans[0].IP)
+}
+
 func TestRealIP(t *testing.T) {
 	const remoteAddr = "1.2.3.4:5678"
 
@@ -0,0 +1,115 @@
+package home
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/ldap"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/AdguardTeam/golibs/validate"
+)
+
+// defaultLDAPTimeout is the default timeout for a bind to the LDAP directory.
+const defaultLDAPTimeout = 10 * time.Second
+
+// ldapConfig is the configuration of the authentication of the web users by
+// a bind to an LDAP directory.  The local users take precedence over the users
+// of the directory with the same names.
+type ldapConfig struct {
+	// URL is the URL of the directory, for example
+	// "ldaps://ldap.example.org".  The unencrypted ldap scheme is only allowed
+	// for the loopback addresses.
+	URL string `yaml:"url"`
+
+	// BindDN is the template of the distinguished names of the users, for
+	// example "uid={login},ou=people,dc=example,dc=org".
+	BindDN string `yaml:"bind_dn"`
+
+	// Role is the role of the users of the directory.
+	Role aghuser.Role `yaml:"role"`
+
+	// Timeout is the timeout for a bind.  Zero means [defaultLDAPTimeout].
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// Enabled defines if the authentication by the directory is enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// type check
+var _ validate.Interface = (*ldapConfig)(nil)
+
+// Validate implements the [validate.Interface] interface for *ldapConfig.
+func (c *ldapConfig) Validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	_, err = c.toInternal(slogutil.NewDiscardLogger(), nil)
+
+	return errors.Annotate(err, "ldap: %w")
+}
+
+// toInternal returns the configuration of the directory client.  tlsConf may
+// be nil.
+func (c *ldapConfig) toInternal(
+	logger *slog.Logger,
+	tlsConf *tls.Config,
+) (conf *ldap.Config, err error) {
+	err = errors.Annotate(validateMappedRole(c.Role), "role: %w")
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	timeout := time.Duration(c.Timeout)
+	if timeout == 0 {
+		timeout = defaultLDAPTimeout
+	}
+
+	conf = &ldap.Config{
+		Logger:    logger,
+		TLSConfig: tlsConf,
+		URL:       u,
+		BindDN:    c.BindDN,
+		Role:      c.Role,
+		Timeout:   timeout,
+	}
+
+	return conf, conf.Validate()
+}
+
+// newLDAPDB returns the user database of the LDAP directory or nil if c is
+// nil or disabled.  c must be valid.  tlsMgr must not be nil.
+func newLDAPDB(baseLogger *slog.Logger, c *ldapConfig, tlsMgr *tlsManager) (db aghuser.DB) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	conf, err := c.toInternal(baseLogger.With(slogutil.KeyPrefix, "ldap"), &tls.Config{
+		RootCAs:      tlsMgr.rootCerts,
+		CipherSuites: tlsMgr.customCipherIDs,
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		// Should not happen, since the configuration has been validated.
+		panic(fmt.Errorf("ldap: %w", err))
+	}
+
+	ldb, err := ldap.New(conf)
+	if err != nil {
+		// Should not happen, since the configuration has been validated.
+		panic(err)
+	}
+
+	return ldb
+}
@@ -0,0 +1,166 @@
+package home
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/validate"
+	"golang.org/x/net/http/httpguts"
+)
+
+// proxyAuthMaxUsernameLen is the maximum length of the user name taken from
+// the header of the authentication proxy.
+const proxyAuthMaxUsernameLen = 128
+
+// proxyAuthConfig is the configuration of the authentication by the headers
+// set by a forward authentication proxy, such as Authelia, Authentik, or
+// oauth2-proxy.  The headers are only accepted from the trusted proxies, see
+// [dnsConfig.TrustedProxies].
+type proxyAuthConfig struct {
+	// UserHeader is the header containing the name of the authenticated user,
+	// for example "Remote-User".
+	UserHeader string `yaml:"user_header"`
+
+	// GroupsHeader is the optional header containing the comma-separated
+	// groups of the user, for example "Remote-Groups".
+	GroupsHeader string `yaml:"groups_header"`
+
+	// DefaultRole is the role of the users that are neither local users nor
+	// matched by RoleMappings.  If it's empty, such users are rejected.
+	DefaultRole aghuser.Role `yaml:"default_role"`
+
+	// RoleMappings map the groups of the users that aren't local users to the
+	// roles.  The first matching mapping is used.
+	RoleMappings []*roleMapping `yaml:"role_mappings"`
+
+	// Enabled defines if the authentication by the headers is enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// type check
+var _ validate.Interface = (*proxyAuthConfig)(nil)
+
+// Validate implements the [validate.Interface] interface for *proxyAuthConfig.
+func (c *proxyAuthConfig) Validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	errs := []error{
+		validateHeaderName("user_header", c.UserHeader, false),
+		validateHeaderName("groups_header", c.GroupsHeader, true),
+	}
+
+	errs = append(errs, validateRoleMappings(c.DefaultRole, c.RoleMappings)...)
+
+	return errors.Annotate(errors.Join(errs...), "proxy_auth: %w")
+}
+
+// validateHeaderName returns an error if the header name h isn't valid.
+func validateHeaderName(name, h string, optional bool) (err error) {
+	if h == "" {
+		if optional {
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", name, errors.ErrEmptyValue)
+	}
+
+	if !httpguts.ValidHeaderFieldName(h) {
+		return fmt.Errorf("%s: %q is not a valid header name", name, h)
+	}
+
+	return nil
+}
+
+// setProxyAuth enables the authentication by the headers of the trusted
+// proxies.  c may be nil.  c must be valid.
+func (a *Auth) setProxyAuth(c *proxyAuthConfig) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if c == nil || !c.Enabled {
+		a.proxyAuth = nil
+
+		return
+	}
+
+	a.proxyAuth = c
+}
+
+// userFromProxyHeaders returns the user from the headers of the authentication
+// proxy.  found is false if the authentication by the headers is disabled or
+// r has no user header.  err is not nil if the header must not be trusted, for
+// example because r doesn't come from a trusted proxy; r must not be
+// authenticated then.
+func (a *Auth) userFromProxyHeaders(r *http.Request) (u *webUser, found bool, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	c := a.proxyAuth
+	if c == nil {
+		return nil, false, nil
+	}
+
+	name := strings.TrimSpace(r.Header.Get(c.UserHeader))
+	if name == "" {
+		return nil, false, nil
+	}
+
+	// Use the address of the immediate peer, since the proxy headers can't be
+	// trusted before the peer is.
+	ipStr, err := netutil.SplitHost(r.RemoteAddr)
+	if err != nil {
+		return nil, true, fmt.Errorf("getting remote address: %w", err)
+	}
+
+	ip, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return nil, true, fmt.Errorf("parsing remote address: %w", err)
+	}
+
+	if !a.trustedProxies.Contains(ip.Unmap()) {
+		return nil, true, fmt.Errorf("header %s from untrusted address %s", c.UserHeader, ip)
+	} else if len(name) > proxyAuthMaxUsernameLen {
+		return nil, true, fmt.Errorf("header %s is too long", c.UserHeader)
+	}
+
+	if local := a.localUser(r.Context(), name); local != nil {
+		return newWebUser(local), true, nil
+	}
+
+	role, ok := mappedRole(proxyAuthGroups(r, c.GroupsHeader), c.DefaultRole, c.RoleMappings)
+	if !ok {
+		return nil, true, fmt.Errorf("user %q has no role", name)
+	}
+
+	return &webUser{
+		Name:     name,
+		Role:     role,
+		external: true,
+	}, true, nil
+}
+
+// proxyAuthGroups returns the groups from the comma-separated values of the
+// header h of r.  h may be empty.
+func proxyAuthGroups(r *http.Request, h string) (groups []string) {
+	if h == "" {
+		return nil
+	}
+
+	for _, v := range r.Header.Values(h) {
+		for g := range strings.SplitSeq(v, ",") {
+			g = strings.TrimSpace(g)
+			if g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,177 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth_userFromProxyHeaders(t *testing.T) {
+	users := []webUser{{
+		Name: "local",
+		Role: aghuser.RoleReadOnly,
+	}}
+
+	trusted := netutil.SliceSubnetSet{netip.MustParsePrefix("192.0.2.0/24")}
+	a := InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		filepath.Join(t.TempDir(), "sessions.db"),
+		users,
+		60,
+		nil,
+		trusted,
+	)
+	require.NotNil(t, a)
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		a.Close()
+
+		return nil
+	})
+
+	a.setProxyAuth(&proxyAuthConfig{
+		UserHeader:   "Remote-User",
+		GroupsHeader: "Remote-Groups",
+		RoleMappings: []*roleMapping{{
+			Group: "dns-admins",
+			Role:  aghuser.RoleOperator,
+		}},
+		Enabled: true,
+	})
+
+	const (
+		trustedAddr   = "192.0.2.1:12345"
+		untrustedAddr = "198.51.100.1:12345"
+	)
+
+	testCases := []struct {
+		want       *webUser
+		name       string
+		remoteAddr string
+		user       string
+		groups     string
+		wantErrMsg string
+		wantFound  bool
+	}{{
+		want:       nil,
+		name:       "no_header",
+		remoteAddr: trustedAddr,
+		user:       "",
+		groups:     "",
+		wantErrMsg: "",
+		wantFound:  false,
+	}, {
+		want:       &webUser{Name: "local", Role: aghuser.RoleReadOnly},
+		name:       "local",
+		remoteAddr: trustedAddr,
+		user:       "local",
+		groups:     "dns-admins",
+		wantErrMsg: "",
+		wantFound:  true,
+	}, {
+		want:       &webUser{Name: "alice", Role: aghuser.RoleOperator, external: true},
+		name:       "mapped",
+		remoteAddr: trustedAddr,
+		user:       "alice",
+		groups:     "users, dns-admins",
+		wantErrMsg: "",
+		wantFound:  true,
+	}, {
+		want:       nil,
+		name:       "no_role",
+		remoteAddr: trustedAddr,
+		user:       "alice",
+		groups:     "users",
+		wantErrMsg: `user "alice" has no role`,
+		wantFound:  true,
+	}, {
+		want:       nil,
+		name:       "untrusted",
+		remoteAddr: untrustedAddr,
+		user:       "local",
+		groups:     "",
+		wantErrMsg: "header Remote-User from untrusted address 198.51.100.1",
+		wantFound:  true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/control/status", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.user != "" {
+				r.Header.Set("Remote-User", tc.user)
+			}
+
+			if tc.groups != "" {
+				r.Header.Set("Remote-Groups", tc.groups)
+			}
+
+			u, found, err := a.userFromProxyHeaders(r)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.wantFound, found)
+			assert.Equal(t, tc.want, u)
+		})
+	}
+}
+
+func TestOptionalAuthThird_proxyAuth(t *testing.T) {
+	storeGlobals(t)
+
+	trusted := netutil.SliceSubnetSet{netip.MustParsePrefix("192.0.2.0/24")}
+	a := InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		filepath.Join(t.TempDir(), "sessions.db"),
+		nil,
+		60,
+		nil,
+		trusted,
+	)
+	require.NotNil(t, a)
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		a.Close()
+
+		return nil
+	})
+
+	globalContext.auth = a
+
+	r := httptest.NewRequest(http.MethodGet, "/control/status", nil)
+	r.Header.Set("Remote-User", "alice")
+	r.RemoteAddr = "192.0.2.1:12345"
+
+	// Disabled by default.
+	assert.False(t, a.authRequired())
+
+	a.setProxyAuth(&proxyAuthConfig{
+		UserHeader:  "Remote-User",
+		DefaultRole: aghuser.RoleReadOnly,
+		Enabled:     true,
+	})
+
+	require.True(t, a.authRequired())
+
+	authed, mustAuth := optionalAuthThird(httptest.NewRecorder(), r)
+	require.False(t, mustAuth)
+
+	u, ok := authUserFromContext(authed.Context())
+	require.True(t, ok)
+
+	assert.Equal(t, "alice", u.Name)
+	assert.Equal(t, aghuser.RoleReadOnly, u.Role)
+
+	r.RemoteAddr = "198.51.100.1:12345"
+	w := httptest.NewRecorder()
+	_, mustAuth = optionalAuthThird(w, r)
+	assert.True(t, mustAuth)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
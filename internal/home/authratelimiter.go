@@ -1,8 +1,11 @@
 package home
 
 import (
+	"net/netip"
 	"sync"
 	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 )
 
 // failedAuthTTL is the period of time for which the failed attempt will stay in
@@ -108,3 +111,32 @@ func (ab *authRateLimiter) remove(usrID string) {
 
 	delete(ab.failedAuths, usrID)
 }
+
+// type check
+var _ dnsforward.BanSource = (*authRateLimiter)(nil)
+
+// Bans implements the [dnsforward.BanSource] interface for *authRateLimiter.
+// The attempters that aren't IP addresses are skipped.
+func (ab *authRateLimiter) Bans(now time.Time) (bans []*dnsforward.Ban) {
+	ab.failedAuthsLock.Lock()
+	defer ab.failedAuthsLock.Unlock()
+
+	for usrID, a := range ab.failedAuths {
+		if a.num < ab.maxAttempts || !now.Before(a.until) {
+			continue
+		}
+
+		ip, err := netip.ParseAddr(usrID)
+		if err != nil {
+			continue
+		}
+
+		bans = append(bans, &dnsforward.Ban{
+			Until:  a.until,
+			IP:     ip,
+			Reason: dnsforward.BanReasonWebAuth,
+		})
+	}
+
+	return bans
+}
@@ -2,9 +2,12 @@ package home
 
 import (
 	"net"
+	"net/netip"
 	"testing"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -205,3 +208,24 @@ func TestAuthRateLimiter_Remove(t *testing.T) {
 
 	assert.Empty(t, ab.failedAuths)
 }
+
+func TestAuthRateLimiter_Bans(t *testing.T) {
+	now := time.Now()
+	until := now.Add(time.Hour)
+
+	ab := &authRateLimiter{
+		failedAuths: map[string]failedAuth{
+			"192.0.2.1": {until: until, num: 2},
+			"192.0.2.2": {until: until, num: 1},
+			"192.0.2.3": {until: now.Add(-time.Hour), num: 2},
+			"not-an-ip": {until: until, num: 2},
+		},
+		maxAttempts: 2,
+	}
+
+	assert.Equal(t, []*dnsforward.Ban{{
+		Until:  until,
+		IP:     netip.MustParseAddr("192.0.2.1"),
+		Reason: dnsforward.BanReasonWebAuth,
+	}}, ab.Bans(now))
+}
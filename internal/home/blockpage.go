@@ -0,0 +1,218 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/blockpage"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/miekg/dns"
+)
+
+// blockPageConfig is the configuration of the block page server.
+type blockPageConfig struct {
+	// Messages are the custom messages shown on the block page for each
+	// blocking reason.
+	Messages map[blockpage.Reason]string `yaml:"messages"`
+
+	// CACertPath is the path to the certificate of the local certificate
+	// authority used to serve the block page over HTTPS.
+	CACertPath string `yaml:"ca_certificate_path"`
+
+	// CAKeyPath is the path to the private key of the local certificate
+	// authority.
+	CAKeyPath string `yaml:"ca_private_key_path"`
+
+	// TemplatesDir is the directory with the custom block page templates.
+	TemplatesDir string `yaml:"templates_dir"`
+
+	// HTTPAddress is the address to serve the plain HTTP block page on.
+	HTTPAddress netip.AddrPort `yaml:"http_address"`
+
+	// HTTPSAddress is the address to serve the HTTPS block page on.
+	HTTPSAddress netip.AddrPort `yaml:"https_address"`
+
+	// Enabled defines if the block page server is running.
+	Enabled bool `yaml:"enabled"`
+
+	// AllowUnblockRequests defines if the users are offered to request
+	// unblocking of the domains from the administrators.
+	AllowUnblockRequests bool `yaml:"allow_unblock_requests"`
+}
+
+// validate returns an error if the block page configuration isn't valid.
+func (c *blockPageConfig) validate() (err error) {
+	switch {
+	case c == nil, !c.Enabled:
+		return nil
+	case !c.HTTPAddress.IsValid() && !c.HTTPSAddress.IsValid():
+		return fmt.Errorf("block_page: no addresses to serve on")
+	case c.HTTPSAddress.IsValid() && (c.CACertPath == "" || c.CAKeyPath == ""):
+		return fmt.Errorf("block_page: https_address requires a ca certificate and key")
+	default:
+		return nil
+	}
+}
+
+// filteringBlockPageChecker is the [blockpage.Checker] that uses the filtering
+// module to find out why a domain is blocked.
+type filteringBlockPageChecker struct {
+	filters *filtering.DNSFilter
+}
+
+// type check
+var _ blockpage.Checker = (*filteringBlockPageChecker)(nil)
+
+// Check implements the [blockpage.Checker] interface for
+// *filteringBlockPageChecker.
+func (c *filteringBlockPageChecker) Check(
+	_ context.Context,
+	host string,
+	cliAddr netip.Addr,
+) (info *blockpage.Info, err error) {
+	setts := c.filters.Settings()
+	setts.ProtectionEnabled, _ = c.filters.ProtectionStatus()
+	c.filters.ApplyAdditionalFiltering(cliAddr, "", setts)
+
+	res, err := c.filters.CheckHost(host, dns.TypeA, setts)
+	if err != nil {
+		return nil, fmt.Errorf("checking host: %w", err)
+	}
+
+	info = &blockpage.Info{
+		Host:        host,
+		ServiceName: res.ServiceName,
+		Category:    res.Category,
+		Reason:      blockPageReason(res.Reason),
+	}
+
+	if len(res.Rules) > 0 {
+		r := res.Rules[0]
+		info.Rule = r.Text
+		info.FilterName = c.filters.FilterListName(r.FilterListID)
+	}
+
+	return info, nil
+}
+
+// filteringUnblockRequester is the [blockpage.UnblockRequester] that files the
+// requests into the filtering module.
+type filteringUnblockRequester struct {
+	filters *filtering.DNSFilter
+	clients *client.Storage
+}
+
+// type check
+var _ blockpage.UnblockRequester = (*filteringUnblockRequester)(nil)
+
+// RequestUnblock implements the [blockpage.UnblockRequester] interface for
+// *filteringUnblockRequester.
+func (r *filteringUnblockRequester) RequestUnblock(
+	_ context.Context,
+	req *blockpage.UnblockRequest,
+) (err error) {
+	err = r.filters.RequestUnblock(&filtering.UnblockRequest{
+		Host:             req.Host,
+		Comment:          req.Comment,
+		ClientID:         req.ClientID,
+		Reason:           string(req.Reason),
+		ClientIP:         req.ClientAddr,
+		ClientIDVerified: r.verifyClientID(req.ClientID, req.ClientAddr),
+	})
+	if errors.Is(err, filtering.ErrTooManyUnblockRequests) {
+		return fmt.Errorf("%w: %w", blockpage.ErrTooManyUnblockRequests, err)
+	}
+
+	return err
+}
+
+// verifyClientID returns true if addr belongs to the persistent client with
+// the ClientID id.  The block page can't see the ClientID used in DNS queries,
+// so the one sent with the form is only trusted in that case.
+func (r *filteringUnblockRequester) verifyClientID(id string, addr netip.Addr) (ok bool) {
+	if id == "" || r.clients == nil || !addr.IsValid() {
+		return false
+	}
+
+	byID, ok := r.clients.Find(&client.FindParams{ClientID: client.ClientID(id)})
+	if !ok {
+		return false
+	}
+
+	byAddr, ok := r.clients.Find(&client.FindParams{RemoteIP: addr})
+
+	return ok && byAddr.UID == byID.UID
+}
+
+// blockPageReason converts the filtering reason into the block page one.
+func blockPageReason(r filtering.Reason) (br blockpage.Reason) {
+	switch r {
+	case filtering.FilteredBlockList:
+		return blockpage.ReasonFilterList
+	case filtering.FilteredBlockedService:
+		return blockpage.ReasonBlockedService
+	case filtering.FilteredCategory:
+		return blockpage.ReasonCategory
+	case filtering.FilteredParental:
+		return blockpage.ReasonParental
+	case filtering.FilteredSafeBrowsing:
+		return blockpage.ReasonSafeBrowsing
+	default:
+		return blockpage.ReasonUnknown
+	}
+}
+
+// initBlockPage initializes and starts the block page server if it's enabled.
+// globalContext.filters must be initialized.
+func initBlockPage(ctx context.Context, baseLogger *slog.Logger) (err error) {
+	c := config.BlockPage
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	l := baseLogger.With(slogutil.KeyPrefix, "blockpage")
+	if mode, _, _ := globalContext.filters.BlockingMode(); mode != filtering.BlockingModeCustomIP {
+		l.WarnContext(
+			ctx,
+			"blocking mode should be custom_ip with the address of the block page server",
+			"mode", mode,
+		)
+	}
+
+	var requester blockpage.UnblockRequester
+	if c.AllowUnblockRequests {
+		requester = &filteringUnblockRequester{
+			filters: globalContext.filters,
+			clients: globalContext.clients.storage,
+		}
+	}
+
+	srv, err := blockpage.New(&blockpage.Config{
+		Logger:           l,
+		Checker:          &filteringBlockPageChecker{filters: globalContext.filters},
+		UnblockRequester: requester,
+		Messages:         c.Messages,
+		CACertPath:       c.CACertPath,
+		CAKeyPath:        c.CAKeyPath,
+		TemplatesDir:     c.TemplatesDir,
+		HTTPAddr:         c.HTTPAddress,
+		HTTPSAddr:        c.HTTPSAddress,
+	})
+	if err != nil {
+		return fmt.Errorf("creating block page server: %w", err)
+	}
+
+	err = srv.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("starting block page server: %w", err)
+	}
+
+	globalContext.blockPage = srv
+
+	return nil
+}
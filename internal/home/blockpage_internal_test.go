@@ -0,0 +1,58 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+)
+
+func TestBlockPageConfig_validate(t *testing.T) {
+	t.Parallel()
+
+	addr := netip.MustParseAddrPort("127.0.0.1:8080")
+
+	testCases := []struct {
+		conf       *blockPageConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf:       &blockPageConfig{},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf:       &blockPageConfig{Enabled: true},
+		name:       "no_addrs",
+		wantErrMsg: "block_page: no addresses to serve on",
+	}, {
+		conf:       &blockPageConfig{Enabled: true, HTTPAddress: addr},
+		name:       "http",
+		wantErrMsg: "",
+	}, {
+		conf: &blockPageConfig{Enabled: true, HTTPSAddress: addr},
+		name: "https_no_ca",
+		wantErrMsg: "block_page: https_address requires a ca certificate " +
+			"and key",
+	}, {
+		conf: &blockPageConfig{
+			CACertPath:   "ca.pem",
+			CAKeyPath:    "ca.key",
+			HTTPSAddress: addr,
+			Enabled:      true,
+		},
+		name:       "https",
+		wantErrMsg: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
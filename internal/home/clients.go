@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/netip"
+	"os"
 	"slices"
 	"sync"
 	"time"
@@ -14,6 +15,8 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
+	"github.com/AdguardTeam/AdGuardHome/internal/lanname"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
@@ -66,6 +69,31 @@ type BlockedClientChecker interface {
 	IsBlockedClient(ip netip.Addr, clientID string) (blocked bool, rule string)
 }
 
+// newFingerprintDB returns the device signature database configured by conf.
+// db is nil if the identification of devices is disabled.
+func newFingerprintDB(conf *clientFingerprintConfig) (db *fingerprint.DB, autoTags bool, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, false, nil
+	}
+
+	if conf.SignaturesFile == "" {
+		return fingerprint.NewDefaultDB(), conf.AutoTags, nil
+	}
+
+	f, err := os.Open(conf.SignaturesFile)
+	if err != nil {
+		return nil, false, fmt.Errorf("opening signatures: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	db, err = fingerprint.NewDB(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("signatures %q: %w", conf.SignaturesFile, err)
+	}
+
+	return db, conf.AutoTags, nil
+}
+
 // Init initializes clients container
 // dhcpServer: optional
 // Note: this function must be called only once
@@ -111,6 +139,18 @@ func (clients *clientsContainer) Init(
 		hosts = etcHosts
 	}
 
+	fingerprints, autoTags, err := newFingerprintDB(config.Clients.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("init fingerprints: %w", err)
+	}
+
+	var mdns client.MDNS
+	if config.Clients.Sources.MDNS {
+		mdns = lanname.NewMDNS(&lanname.MDNSConfig{
+			Logger: baseLogger.With(slogutil.KeyPrefix, "mdns"),
+		})
+	}
+
 	clients.storage, err = client.NewStorage(ctx, &client.StorageConfig{
 		Logger:                 baseLogger.With(slogutil.KeyPrefix, "client_storage"),
 		Clock:                  timeutil.SystemClock{},
@@ -118,8 +158,11 @@ func (clients *clientsContainer) Init(
 		DHCP:                   dhcpServer,
 		EtcHosts:               hosts,
 		ARPDB:                  arpDB,
+		MDNS:                   mdns,
+		Fingerprints:           fingerprints,
 		ARPClientsUpdatePeriod: arpClientsUpdatePeriod,
 		RuntimeSourceDHCP:      config.Clients.Sources.DHCP,
+		AutoTags:               autoTags,
 	})
 	if err != nil {
 		return fmt.Errorf("init client storage: %w", err)
@@ -128,6 +171,9 @@ func (clients *clientsContainer) Init(
 	sigHdlr.addClientStorage(clients.storage)
 
 	filteringConf.ApplyClientFiltering = clients.storage.ApplyClientFiltering
+	filteringConf.ExpireClientOverrides = func(now time.Time) (n int) {
+		return clients.storage.ExpireBlockedServices(ctx, now)
+	}
 
 	return nil
 }
@@ -159,6 +205,14 @@ type clientObject struct {
 	// BlockedServices is the configuration of blocked services of a client.
 	BlockedServices *filtering.BlockedServices `yaml:"blocked_services"`
 
+	// BlockedServicesExpires is the time after which the client uses the
+	// global blocked services again.
+	BlockedServicesExpires time.Time `yaml:"blocked_services_expires,omitempty"`
+
+	// BlockedCategories is the configuration of blocked domain categories of a
+	// client.
+	BlockedCategories *filtering.BlockedCategories `yaml:"blocked_categories,omitempty"`
+
 	Name string `yaml:"name"`
 
 	IDs       []string `yaml:"ids"`
@@ -182,6 +236,10 @@ type clientObject struct {
 	SafeBrowsingEnabled      bool `yaml:"safebrowsing_enabled"`
 	UseGlobalBlockedServices bool `yaml:"use_global_blocked_services"`
 
+	// UseOwnBlockedCategories defines if the client uses BlockedCategories
+	// instead of the global ones.
+	UseOwnBlockedCategories bool `yaml:"use_own_blocked_categories"`
+
 	IgnoreQueryLog   bool `yaml:"ignore_querylog"`
 	IgnoreStatistics bool `yaml:"ignore_statistics"`
 }
@@ -200,16 +258,20 @@ func (o *clientObject) toPersistent(
 
 		UID: o.UID,
 
-		UseOwnSettings:        !o.UseGlobalSettings,
-		FilteringEnabled:      o.FilteringEnabled,
-		ParentalEnabled:       o.ParentalEnabled,
-		SafeSearchConf:        o.SafeSearchConf,
-		SafeBrowsingEnabled:   o.SafeBrowsingEnabled,
-		UseOwnBlockedServices: !o.UseGlobalBlockedServices,
-		IgnoreQueryLog:        o.IgnoreQueryLog,
-		IgnoreStatistics:      o.IgnoreStatistics,
-		UpstreamsCacheEnabled: o.UpstreamsCacheEnabled,
-		UpstreamsCacheSize:    o.UpstreamsCacheSize,
+		UseOwnSettings:         !o.UseGlobalSettings,
+		FilteringEnabled:       o.FilteringEnabled,
+		ParentalEnabled:        o.ParentalEnabled,
+		SafeSearchConf:         o.SafeSearchConf,
+		SafeBrowsingEnabled:    o.SafeBrowsingEnabled,
+		UseOwnBlockedServices:  !o.UseGlobalBlockedServices,
+		BlockedServicesExpires: o.BlockedServicesExpires,
+		BlockedCategories:      o.BlockedCategories.Clone(),
+		IgnoreQueryLog:         o.IgnoreQueryLog,
+		IgnoreStatistics:       o.IgnoreStatistics,
+		UpstreamsCacheEnabled:  o.UpstreamsCacheEnabled,
+		UpstreamsCacheSize:     o.UpstreamsCacheSize,
+
+		UseOwnBlockedCategories: o.UseOwnBlockedCategories,
 	}
 
 	err = cli.SetIDs(o.IDs)
@@ -273,7 +335,11 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 		objs = append(objs, &clientObject{
 			Name: cli.Name,
 
-			BlockedServices: cli.BlockedServices.Clone(),
+			BlockedServices:        cli.BlockedServices.Clone(),
+			BlockedServicesExpires: cli.BlockedServicesExpires,
+
+			BlockedCategories:       cli.BlockedCategories.Clone(),
+			UseOwnBlockedCategories: cli.UseOwnBlockedCategories,
 
 			IDs:       cli.Identifiers(),
 			Tags:      slices.Clone(cli.Tags),
@@ -405,6 +471,20 @@ func (clients *clientsContainer) UpdateAddress(
 	clients.storage.UpdateAddress(ctx, ip, host, info)
 }
 
+// type check
+var _ client.LANNameUpdater = (*clientsContainer)(nil)
+
+// UpdateAddressSource implements the [client.LANNameUpdater] interface for
+// *clientsContainer
+func (clients *clientsContainer) UpdateAddressSource(
+	ctx context.Context,
+	ip netip.Addr,
+	src client.Source,
+	host string,
+) {
+	clients.storage.UpdateAddressSource(ctx, ip, src, host)
+}
+
 // close gracefully closes all the client-specific upstream configurations of
 // the persistent clients.
 func (clients *clientsContainer) close(ctx context.Context) (err error) {
@@ -6,14 +6,18 @@ import (
 	"fmt"
 	"net/http"
 	"net/netip"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+	"github.com/AdguardTeam/AdGuardHome/internal/fingerprint"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/logutil/slogutil"
 )
 
@@ -41,6 +45,15 @@ type clientJSON struct {
 	// Schedule is blocked services schedule for every day of the week.
 	Schedule *schedule.Weekly `json:"blocked_services_schedule"`
 
+	// BlockedServicesExpires is the optional time after which the client uses
+	// the global blocked services again.
+	BlockedServicesExpires *time.Time `json:"blocked_services_expires,omitempty"`
+
+	// BlockedCategories is the configuration of blocked domain categories of
+	// the client.  If it's nil in a request, the previous configuration is
+	// kept.
+	BlockedCategories *filtering.BlockedCategories `json:"blocked_categories,omitempty"`
+
 	Name string `json:"name"`
 
 	// BlockedServices is the names of blocked services.
@@ -57,16 +70,75 @@ type clientJSON struct {
 	UseGlobalBlockedServices bool `json:"use_global_blocked_services"`
 	UseGlobalSettings        bool `json:"use_global_settings"`
 
+	// UseOwnBlockedCategories defines if the client uses BlockedCategories
+	// instead of the global blocked categories.
+	UseOwnBlockedCategories bool `json:"use_own_blocked_categories"`
+
 	IgnoreQueryLog   aghalg.NullBool `json:"ignore_querylog"`
 	IgnoreStatistics aghalg.NullBool `json:"ignore_statistics"`
 
 	UpstreamsCacheSize    uint32          `json:"upstreams_cache_size"`
 	UpstreamsCacheEnabled aghalg.NullBool `json:"upstreams_cache_enabled"`
+
+	// BlockedServicesRemaining is the time remaining until the blocked
+	// services override expires, in milliseconds.  It's only used in
+	// responses.
+	BlockedServicesRemaining int64 `json:"blocked_services_remaining,omitempty"`
+
+	// Presence is the presence information of the client without the history.
+	// It's only used in responses and is nil if the client hasn't been seen.
+	Presence *presenceJSON `json:"presence,omitempty"`
+}
+
+// presenceJSON is a JSON representation of the [client.Presence].
+type presenceJSON struct {
+	FirstSeen *time.Time                `json:"first_seen,omitempty"`
+	LastSeen  *time.Time                `json:"last_seen,omitempty"`
+	History   []*presenceTransitionJSON `json:"history,omitempty"`
+	Online    bool                      `json:"online"`
+}
+
+// presenceTransitionJSON is a JSON representation of the
+// [client.PresenceTransition].
+type presenceTransitionJSON struct {
+	Time   time.Time             `json:"time"`
+	Source client.PresenceSource `json:"source,omitempty"`
+	Online bool                  `json:"online"`
+}
+
+// presenceToJSON converts p to JSON, including the history if withHistory is
+// true.  p may be nil.
+func presenceToJSON(p *client.Presence, withHistory bool) (pj *presenceJSON) {
+	if p == nil {
+		return &presenceJSON{}
+	}
+
+	pj = &presenceJSON{
+		FirstSeen: &p.FirstSeen,
+		LastSeen:  &p.LastSeen,
+		Online:    p.Online,
+	}
+
+	if !withHistory {
+		return pj
+	}
+
+	pj.History = make([]*presenceTransitionJSON, 0, len(p.History))
+	for _, t := range p.History {
+		pj.History = append(pj.History, &presenceTransitionJSON{
+			Time:   t.Time,
+			Source: t.Source,
+			Online: t.Online,
+		})
+	}
+
+	return pj
 }
 
 // runtimeClientJSON is a JSON representation of the [client.Runtime].
 type runtimeClientJSON struct {
-	WHOIS *whois.Info `json:"whois_info"`
+	WHOIS  *whois.Info         `json:"whois_info"`
+	Device *fingerprint.Device `json:"device,omitempty"`
 
 	IP     netip.Addr    `json:"ip"`
 	Name   string        `json:"name"`
@@ -100,18 +172,26 @@ func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, r *http
 	defer clients.lock.Unlock()
 
 	clients.storage.RangeByName(func(c *client.Persistent) (cont bool) {
-		cj := clientToJSON(c)
-		data.Clients = append(data.Clients, cj)
+		if userCanManageClient(r, c.Name) {
+			data.Clients = append(data.Clients, clientToJSON(c))
+		}
 
 		return true
 	})
 
+	for _, cj := range data.Clients {
+		if p, _ := clients.storage.Presence(cj.Name); p != nil {
+			cj.Presence = presenceToJSON(p, false)
+		}
+	}
+
 	clients.storage.UpdateDHCP(r.Context())
 
 	clients.storage.RangeRuntime(func(rc *client.Runtime) (cont bool) {
 		src, host := rc.Info()
 		cj := runtimeClientJSON{
 			WHOIS:  whoisOrEmpty(rc),
+			Device: rc.Device(),
 			Name:   host,
 			Source: src,
 			IP:     rc.Addr(),
@@ -210,6 +290,24 @@ func (clients *clientsContainer) jsonToClient(
 	c.SafeBrowsingEnabled = cj.SafeBrowsingEnabled
 	c.UseOwnBlockedServices = !cj.UseGlobalBlockedServices
 
+	c.BlockedServicesExpires = time.Time{}
+	if cj.BlockedServicesExpires != nil {
+		if !c.UseOwnBlockedServices {
+			return nil, errors.Error("blocked_services_expires requires own blocked services")
+		} else if !cj.BlockedServicesExpires.After(time.Now()) {
+			return nil, errors.Error("blocked_services_expires is in the past")
+		}
+
+		c.BlockedServicesExpires = *cj.BlockedServicesExpires
+	}
+
+	c.UseOwnBlockedCategories = cj.UseOwnBlockedCategories
+	c.BlockedCategories, err = copyBlockedCategories(cj.BlockedCategories, prev)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
 	if c.SafeSearchConf.Enabled {
 		logger := clients.baseLogger.With(
 			slogutil.KeyPrefix, safesearch.LogPrefix,
@@ -291,6 +389,35 @@ func copyBlockedServices(
 	return svcs, nil
 }
 
+// copyBlockedCategories returns the validated copy of the blocked categories
+// from the request or the previous ones of the client, if bc is nil.
+func copyBlockedCategories(
+	bc *filtering.BlockedCategories,
+	prev *client.Persistent,
+) (res *filtering.BlockedCategories, err error) {
+	if bc == nil {
+		if prev == nil {
+			return nil, nil
+		}
+
+		return prev.BlockedCategories.Clone(), nil
+	}
+
+	res = bc.Clone()
+	if res.Schedule == nil {
+		res.Schedule = schedule.EmptyWeekly()
+	}
+
+	if globalContext.filters != nil {
+		err = globalContext.filters.ValidateBlockedCategories(res)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked categories: %w", err)
+		}
+	}
+
+	return res, nil
+}
+
 // clientToJSON converts persistent client object to JSON object.
 func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 	// TODO(d.kolyshev): Remove after cleaning the deprecated
@@ -298,6 +425,14 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 	cloneVal := c.SafeSearchConf
 	safeSearchConf := &cloneVal
 
+	var expires *time.Time
+	var remaining int64
+	if !c.BlockedServicesExpires.IsZero() {
+		exp := c.BlockedServicesExpires
+		expires = &exp
+		remaining = max(0, time.Until(exp).Milliseconds())
+	}
+
 	return &clientJSON{
 		Name:                c.Name,
 		IDs:                 c.Identifiers(),
@@ -311,8 +446,13 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 
 		UseGlobalBlockedServices: !c.UseOwnBlockedServices,
 
-		Schedule:        c.BlockedServices.Schedule,
-		BlockedServices: c.BlockedServices.IDs,
+		Schedule:                 c.BlockedServices.Schedule,
+		BlockedServices:          c.BlockedServices.IDs,
+		BlockedServicesExpires:   expires,
+		BlockedServicesRemaining: remaining,
+
+		BlockedCategories:       c.BlockedCategories.Clone(),
+		UseOwnBlockedCategories: c.UseOwnBlockedCategories,
 
 		Upstreams: c.Upstreams,
 
@@ -326,6 +466,12 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 
 // handleAddClient is the handler for POST /control/clients/add HTTP API.
 func (clients *clientsContainer) handleAddClient(w http.ResponseWriter, r *http.Request) {
+	if !userManagesAllClients(r) {
+		aghhttp.Error(r, w, http.StatusForbidden, "not allowed to add clients")
+
+		return
+	}
+
 	cj := clientJSON{}
 	err := json.NewDecoder(r.Body).Decode(&cj)
 	if err != nil {
@@ -369,6 +515,12 @@ func (clients *clientsContainer) handleDelClient(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if !userManagesAllClients(r) {
+		aghhttp.Error(r, w, http.StatusForbidden, "not allowed to delete clients")
+
+		return
+	}
+
 	if !clients.storage.RemoveByName(r.Context(), cj.Name) {
 		aghhttp.Error(r, w, http.StatusBadRequest, "Client not found")
 
@@ -404,6 +556,12 @@ func (clients *clientsContainer) handleUpdateClient(w http.ResponseWriter, r *ht
 		return
 	}
 
+	if !userCanManageClient(r, dj.Name) || dj.Data.Name != dj.Name && !userManagesAllClients(r) {
+		aghhttp.Error(r, w, http.StatusForbidden, "not allowed to change client %q", dj.Name)
+
+		return
+	}
+
 	c, err := clients.jsonToClient(r.Context(), dj.Data, nil)
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
@@ -411,6 +569,21 @@ func (clients *clientsContainer) handleUpdateClient(w http.ResponseWriter, r *ht
 		return
 	}
 
+	if !userManagesAllClients(r) {
+		stored, ok := clients.storage.FindByName(dj.Name)
+		if ok && protectionChanged(stored, c) {
+			aghhttp.Error(
+				r,
+				w,
+				http.StatusForbidden,
+				"not allowed to change the identifiers and protection of client %q",
+				dj.Name,
+			)
+
+			return
+		}
+	}
+
 	err = clients.storage.Update(r.Context(), dj.Name, c)
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
@@ -423,6 +596,17 @@ func (clients *clientsContainer) handleUpdateClient(w http.ResponseWriter, r *ht
 	}
 }
 
+// protectionChanged returns true if c changes the identifiers or turns off the
+// protection of the stored client, which users with [aghuser.RoleParent] aren't
+// allowed to do.
+func protectionChanged(stored, c *client.Persistent) (changed bool) {
+	return !stored.EqualIDs(c) ||
+		stored.UseOwnSettings != c.UseOwnSettings ||
+		stored.FilteringEnabled != c.FilteringEnabled ||
+		stored.ParentalEnabled != c.ParentalEnabled ||
+		stored.SafeBrowsingEnabled != c.SafeBrowsingEnabled
+}
+
 // handleFindClient is the handler for GET /control/clients/find HTTP API.
 //
 // Deprecated:  Remove it when migration to the new API is over.
@@ -570,7 +754,76 @@ func (clients *clientsContainer) registerWebHandlers() {
 	httpRegister(http.MethodPost, "/control/clients/delete", clients.handleDelClient)
 	httpRegister(http.MethodPost, "/control/clients/update", clients.handleUpdateClient)
 	httpRegister(http.MethodPost, "/control/clients/search", clients.handleSearchClient)
+	httpRegister(http.MethodGet, "/control/clients/presence", clients.handleGetPresence)
+	httpRegister(http.MethodPost, "/control/clients/wake", clients.handleWakeClient)
 
 	// Deprecated handler.
 	httpRegister(http.MethodGet, "/control/clients/find", clients.handleFindClient)
 }
+
+// handleGetPresence is the handler for GET /control/clients/presence HTTP API.
+func (clients *clientsContainer) handleGetPresence(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "client's name must be non-empty")
+
+		return
+	}
+
+	p, ok := clients.storage.Presence(name)
+	if !ok {
+		aghhttp.Error(r, w, http.StatusBadRequest, "Client not found")
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, presenceToJSON(p, true))
+}
+
+// wakeJSON is the request body of the POST /control/clients/wake HTTP API.
+type wakeJSON struct {
+	Name string `json:"name"`
+}
+
+// handleWakeClient is the handler for POST /control/clients/wake HTTP API.  It
+// sends the Wake-on-LAN magic packets for each MAC address of the client.
+func (clients *clientsContainer) handleWakeClient(w http.ResponseWriter, r *http.Request) {
+	wj := wakeJSON{}
+	err := json.NewDecoder(r.Body).Decode(&wj)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	if !userCanManageClient(r, wj.Name) {
+		aghhttp.Error(r, w, http.StatusForbidden, "not allowed to wake client %q", wj.Name)
+
+		return
+	}
+
+	macs, ips, ok := clients.storage.KnownAddrs(wj.Name)
+	if !ok {
+		aghhttp.Error(r, w, http.StatusBadRequest, "Client not found")
+
+		return
+	} else if len(macs) == 0 {
+		aghhttp.Error(r, w, http.StatusBadRequest, "client %q has no mac addresses", wj.Name)
+
+		return
+	}
+
+	var errs []error
+	for _, mac := range macs {
+		errs = append(errs, aghnet.WakeOnLAN(mac, ips))
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "sending magic packet: %s", err)
+
+		return
+	}
+
+	clients.logger.InfoContext(r.Context(), "sent wake-on-lan packet", "name", wj.Name)
+}
@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
@@ -85,7 +86,7 @@ func assertClients(tb testing.TB, want, got []*client.Persistent) {
 	slices.SortFunc(want, sortFunc)
 	slices.SortFunc(got, sortFunc)
 
-	slices.CompareFunc(want, got, func(a, b *client.Persistent) (n int) {
+	_ = slices.CompareFunc(want, got, func(a, b *client.Persistent) (n int) {
 		assert.True(tb, a.EqualIDs(b), "%q doesn't have the same ids as %q", a.Name, b.Name)
 
 		return 0
@@ -551,3 +552,84 @@ func TestClientsContainer_HandleSearchClient(t *testing.T) {
 		})
 	}
 }
+
+func TestClientsContainer_HandleUpdateClient_parent(t *testing.T) {
+	clients := newClientsContainer(t)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	stored := newPersistentClientWithIDs(t, "kid", []string{testClientIP1})
+	stored.UseOwnSettings = true
+	stored.FilteringEnabled = true
+	stored.ParentalEnabled = true
+	stored.SafeBrowsingEnabled = true
+
+	err := clients.storage.Add(ctx, stored)
+	require.NoError(t, err)
+
+	parent := &webUser{
+		Name:    "parent",
+		Role:    aghuser.RoleParent,
+		Clients: []string{stored.Name},
+	}
+
+	testCases := []struct {
+		modify   func(c *client.Persistent)
+		name     string
+		wantCode int
+	}{{
+		modify: func(c *client.Persistent) {
+			require.NoError(t, c.SetIDs([]string{testClientIP2}))
+		},
+		name:     "ids",
+		wantCode: http.StatusForbidden,
+	}, {
+		modify:   func(c *client.Persistent) { c.UseOwnSettings = false },
+		name:     "use_global_settings",
+		wantCode: http.StatusForbidden,
+	}, {
+		modify:   func(c *client.Persistent) { c.FilteringEnabled = false },
+		name:     "filtering",
+		wantCode: http.StatusForbidden,
+	}, {
+		modify:   func(c *client.Persistent) { c.ParentalEnabled = false },
+		name:     "parental",
+		wantCode: http.StatusForbidden,
+	}, {
+		modify:   func(c *client.Persistent) { c.SafeBrowsingEnabled = false },
+		name:     "safebrowsing",
+		wantCode: http.StatusForbidden,
+	}, {
+		modify:   func(c *client.Persistent) { c.Tags = []string{"user_child"} },
+		name:     "tags",
+		wantCode: http.StatusOK,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			modified := stored.ShallowClone()
+			tc.modify(modified)
+
+			body, jsonErr := json.Marshal(updateJSON{
+				Name: stored.Name,
+				Data: *clientToJSON(modified),
+			})
+			require.NoError(t, jsonErr)
+
+			r := httptest.NewRequest(http.MethodPost, "/control/clients/update", bytes.NewReader(body))
+			r = r.WithContext(withAuthUser(r.Context(), parent))
+
+			rw := httptest.NewRecorder()
+			clients.handleUpdateClient(rw, r)
+			assert.Equal(t, tc.wantCode, rw.Code)
+
+			got, ok := clients.storage.FindByName(stored.Name)
+			require.True(t, ok)
+
+			assert.True(t, got.EqualIDs(stored))
+			assert.True(t, got.FilteringEnabled)
+			assert.True(t, got.ParentalEnabled)
+			assert.True(t, got.SafeBrowsingEnabled)
+			assert.True(t, got.UseOwnSettings)
+		})
+	}
+}
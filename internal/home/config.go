@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
@@ -94,10 +95,27 @@ type osConfig struct {
 type clientsConfig struct {
 	// Sources defines the set of sources to fetch the runtime clients from.
 	Sources *clientSourcesConfig `yaml:"runtime_sources"`
+	// Fingerprint configures the identification of DHCP clients' devices.
+	Fingerprint *clientFingerprintConfig `yaml:"fingerprint"`
 	// Persistent are the configured clients.
 	Persistent []*clientObject `yaml:"persistent"`
 }
 
+// clientFingerprintConfig is used to configure the identification of devices
+// by the values of their DHCP messages.
+type clientFingerprintConfig struct {
+	// SignaturesFile is the path to the JSON file with the device signatures.
+	// If empty, the built-in signatures are used.
+	SignaturesFile string `yaml:"signatures_file"`
+
+	// Enabled defines if the devices of DHCP clients should be identified.
+	Enabled bool `yaml:"enabled"`
+
+	// AutoTags defines if the tags of the identified devices should be
+	// assigned to the new clients.
+	AutoTags bool `yaml:"auto_tags"`
+}
+
 // clientSourceConfig is used to configure where the runtime clients will be
 // obtained from.
 type clientSourcesConfig struct {
@@ -106,6 +124,9 @@ type clientSourcesConfig struct {
 	RDNS      bool `yaml:"rdns"`
 	DHCP      bool `yaml:"dhcp"`
 	HostsFile bool `yaml:"hosts"`
+	MDNS      bool `yaml:"mdns"`
+	LLMNR     bool `yaml:"llmnr"`
+	NetBIOS   bool `yaml:"netbios"`
 }
 
 // configuration is loaded from YAML.
@@ -160,6 +181,25 @@ type configuration struct {
 	// DNS shunt
 	Ruleset *ruleset.Ruleset `yaml:"ruleset"`
 
+	// BlockPage is the configuration of the block page server.
+	BlockPage *blockPageConfig `yaml:"block_page"`
+
+	// OIDC is the configuration of the OpenID Connect single sign-on into the
+	// web UI.
+	OIDC *oidcConfig `yaml:"oidc"`
+
+	// ProxyAuth is the configuration of the authentication by the headers of
+	// a forward authentication proxy.
+	ProxyAuth *proxyAuthConfig `yaml:"proxy_auth"`
+
+	// LDAP is the configuration of the authentication of the web users by an
+	// LDAP directory.
+	LDAP *ldapConfig `yaml:"ldap"`
+
+	// Audit is the configuration of the audit log of the configuration
+	// changes.
+	Audit *auditConfig `yaml:"audit"`
+
 	// Clients contains the YAML representations of the persistent clients.
 	// This field is only used for reading and writing persistent client data.
 	// Keep this field sorted to ensure consistent ordering.
@@ -197,6 +237,15 @@ type httpConfig struct {
 	// SessionTTL for a web session.
 	// An active session is automatically refreshed once a day.
 	SessionTTL timeutil.Duration `yaml:"session_ttl"`
+
+	// SessionIdleTimeout is the time after which a web session expires if it
+	// isn't used.  Zero means no idle timeout.
+	SessionIdleTimeout timeutil.Duration `yaml:"session_idle_timeout"`
+
+	// MaxSessionsPerUser is the maximum number of the concurrent web sessions
+	// of a single user.  The least recently used sessions are removed when
+	// it's exceeded.  Zero means no limit.
+	MaxSessionsPerUser uint `yaml:"max_sessions_per_user"`
 }
 
 // httpPprofConfig is the block with pprof HTTP configuration.
@@ -277,6 +326,9 @@ type dnsConfig struct {
 
 	// PendingRequests configures duplicate requests policy.
 	PendingRequests *pendingRequests `yaml:"pending_requests"`
+
+	// LocalZone configures the authoritative zone of the local network.
+	LocalZone *localZoneConfig `yaml:"local_zone"`
 }
 
 // pendingRequests is a block with pending requests configuration.
@@ -475,7 +527,16 @@ var config = &configuration{
 			}, {
 				Prefix: netip.MustParsePrefix("::1/128"),
 			}},
-			CacheSize: 4 * 1024 * 1024,
+			UnknownClientIDLimit:         10,
+			UnknownClientIDBanDuration:   timeutil.Duration(1 * time.Hour),
+			UnknownClientIDIPv6PrefixLen: 64,
+			CacheSize:                    4 * 1024 * 1024,
+
+			PublicHardening: &dnsforward.PublicHardeningConfig{
+				DailyQuota:   0,
+				MonthlyQuota: 0,
+				Enabled:      false,
+			},
 
 			EDNSClientSubnet: &dnsforward.EDNSClientSubnet{
 				CustomIP:  netip.Addr{},
@@ -496,6 +557,10 @@ var config = &configuration{
 		PendingRequests: &pendingRequests{
 			Enabled: true,
 		},
+		LocalZone: &localZoneConfig{
+			Enabled: false,
+			MaxTTL:  timeutil.Duration(1 * time.Hour),
+		},
 	},
 	TLS: tlsConfigSettings{
 		PortHTTPS:       defaultPortHTTPS,
@@ -584,6 +649,13 @@ var config = &configuration{
 			RDNS:      true,
 			DHCP:      true,
 			HostsFile: true,
+			MDNS:      false,
+			LLMNR:     false,
+			NetBIOS:   false,
+		},
+		Fingerprint: &clientFingerprintConfig{
+			Enabled:  true,
+			AutoTags: false,
 		},
 	},
 	Log: logSettings{
@@ -601,6 +673,13 @@ var config = &configuration{
 	Theme:         ThemeAuto,
 	ServiceType:   defaultServiceType,
 	Ruleset:       &ruleset.Ruleset{},
+	BlockPage:     &blockPageConfig{},
+	OIDC:          &oidcConfig{},
+	ProxyAuth:     &proxyAuthConfig{},
+	LDAP:          &ldapConfig{},
+	Audit: &auditConfig{
+		Enabled: true,
+	},
 }
 
 // configFilePath returns the absolute path to the symlink-evaluated path to the
@@ -709,6 +788,37 @@ func validateConfig() (err error) {
 		return fmt.Errorf("invalid service_type: %s", config.ServiceType)
 	}
 
+	err = config.BlockPage.validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	err = config.OIDC.Validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	err = config.ProxyAuth.Validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	err = config.LDAP.Validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	for i := range config.Users {
+		err = config.Users[i].Validate()
+		if err != nil {
+			return fmt.Errorf("users: at index %d: %w", i, err)
+		}
+	}
+
 	tcpPorts := aghalg.UniqChecker[tcpPort]{}
 	addPorts(tcpPorts, tcpPort(config.HTTPConfig.Address.Port()))
 
@@ -728,6 +838,10 @@ func validateConfig() (err error) {
 		addPorts(udpPorts, udpPort(config.TLS.PortDNSOverQUIC))
 	}
 
+	if bp := config.BlockPage; bp != nil && bp.Enabled {
+		addPorts(tcpPorts, tcpPort(bp.HTTPAddress.Port()), tcpPort(bp.HTTPSAddress.Port()))
+	}
+
 	if err = tcpPorts.Validate(); err != nil {
 		return fmt.Errorf("validating tcp ports: %w", err)
 	} else if err = udpPorts.Validate(); err != nil {
@@ -771,6 +885,26 @@ func readConfigFile() (fileData []byte, err error) {
 
 // Saves configuration to the YAML file and also saves the user filter contents to a file
 func (c *configuration) write(tlsMgr *tlsManager) (err error) {
+	data, err := c.marshal(tlsMgr)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	confPath := configFilePath()
+	log.Debug("writing config file %q", confPath)
+
+	err = maybe.WriteFile(confPath, data, aghos.DefaultPermFile)
+	if err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+
+	return nil
+}
+
+// marshal updates the configuration from the current state of the modules and
+// returns its YAML representation.
+func (c *configuration) marshal(tlsMgr *tlsManager) (data []byte, err error) {
 	c.Lock()
 	defer c.Unlock()
 
@@ -830,24 +964,16 @@ func (c *configuration) write(tlsMgr *tlsManager) (err error) {
 
 	config.Clients.Persistent = globalContext.clients.forConfig()
 
-	confPath := configFilePath()
-	log.Debug("writing config file %q", confPath)
-
 	buf := &bytes.Buffer{}
 	enc := yaml.NewEncoder(buf)
 	enc.SetIndent(2)
 
 	err = enc.Encode(config)
 	if err != nil {
-		return fmt.Errorf("generating config file: %w", err)
-	}
-
-	err = maybe.WriteFile(confPath, buf.Bytes(), aghos.DefaultPermFile)
-	if err != nil {
-		return fmt.Errorf("writing config file: %w", err)
+		return nil, fmt.Errorf("generating config file: %w", err)
 	}
 
-	return nil
+	return buf.Bytes(), nil
 }
 
 // validateTLSCipherIDs validates the custom TLS cipher suite IDs.
@@ -13,6 +13,8 @@ type ctxKey uint8
 
 const (
 	ctxKeyWebUser ctxKey = iota
+	ctxKeyAuthUser
+	ctxKeyAPIToken
 )
 
 // type check
@@ -23,6 +25,10 @@ func (k ctxKey) String() (s string) {
 	switch k {
 	case ctxKeyWebUser:
 		return "ctxKeyWebUser"
+	case ctxKeyAuthUser:
+		return "ctxKeyAuthUser"
+	case ctxKeyAPIToken:
+		return "ctxKeyAPIToken"
 	default:
 		panic(fmt.Errorf("ctx key: %w: %d", errors.ErrBadEnumValue, k))
 	}
@@ -54,3 +60,51 @@ func webUserFromContext(ctx context.Context) (u *aghuser.User, ok bool) {
 
 	return u, true
 }
+
+// withAuthUser returns a copy of the parent context with the user
+// authenticated by [Auth] added.
+//
+// TODO:  Remove when [Auth] is replaced with [aghuser.DB].
+func withAuthUser(ctx context.Context, u *webUser) (withUser context.Context) {
+	return context.WithValue(ctx, ctxKeyAuthUser, u)
+}
+
+// authUserFromContext returns the user authenticated by [Auth] from the
+// context, if any.
+func authUserFromContext(ctx context.Context) (u *webUser, ok bool) {
+	const key = ctxKeyAuthUser
+	v := ctx.Value(key)
+	if v == nil {
+		return nil, false
+	}
+
+	u, ok = v.(*webUser)
+	if !ok {
+		panicBadType(key, v)
+	}
+
+	return u, true
+}
+
+// withAPIToken returns a copy of the parent context with the API token used
+// for authentication added.
+func withAPIToken(ctx context.Context, t *apiToken) (withToken context.Context) {
+	return context.WithValue(ctx, ctxKeyAPIToken, t)
+}
+
+// apiTokenFromContext returns the API token used for authentication from the
+// context, if any.
+func apiTokenFromContext(ctx context.Context) (t *apiToken, ok bool) {
+	const key = ctxKeyAPIToken
+	v := ctx.Value(key)
+	if v == nil {
+		return nil, false
+	}
+
+	t, ok = v.(*apiToken)
+	if !ok {
+		panicBadType(key, v)
+	}
+
+	return t, true
+}
@@ -171,10 +171,13 @@ func (web *webAPI) handleStatus(w http.ResponseWriter, r *http.Request) {
 // registerControlHandlers sets up HTTP handlers for various control endpoints.
 // web must not be nil.
 func registerControlHandlers(web *webAPI) {
-	globalContext.mux.HandleFunc(
-		"/control/version.json",
-		postInstall(optionalAuth(web.handleVersionJSON)),
+	const versionPath = "/control/version.json"
+	versionHdlr := permissionHandler(
+		http.MethodPost,
+		versionPath,
+		http.HandlerFunc(web.handleVersionJSON),
 	)
+	globalContext.mux.HandleFunc(versionPath, postInstall(optionalAuth(versionHdlr.ServeHTTP)))
 	httpRegister(http.MethodPost, "/control/update", web.handleUpdate)
 
 	httpRegister(http.MethodGet, "/control/status", web.handleStatus)
@@ -186,6 +189,8 @@ func registerControlHandlers(web *webAPI) {
 	// Service type API endpoints
 	httpRegister(http.MethodGet, "/control/service-type", web.handleServiceTypeGet)
 
+	httpRegister(http.MethodGet, "/control/audit", handleAudit)
+
 	// No auth is necessary for DoH/DoT configurations
 	globalContext.mux.HandleFunc("/apple/doh.mobileconfig", postInstall(handleMobileConfigDoH))
 	globalContext.mux.HandleFunc("/apple/dot.mobileconfig", postInstall(handleMobileConfigDoT))
@@ -200,7 +205,8 @@ func httpRegister(method, url string, handler http.HandlerFunc) {
 		return
 	}
 
-	globalContext.mux.Handle(url, postInstallHandler(optionalAuthHandler(gziphandler.GzipHandler(ensureHandler(method, handler)))))
+	h := gziphandler.GzipHandler(ensureHandler(method, handler))
+	globalContext.mux.Handle(url, postInstallHandler(optionalAuthHandler(permissionHandler(method, url, h))))
 }
 
 // ensure returns a wrapped handler that makes sure that the request has the
@@ -224,6 +230,10 @@ func ensure(
 
 			globalContext.controlLock.Lock()
 			defer globalContext.controlLock.Unlock()
+
+			if rec := newAuditRecorder(); rec != nil {
+				defer rec.finish(r)
+			}
 		}
 
 		handler(w, r)
@@ -0,0 +1,146 @@
+package home
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// stdioPath is the path meaning the standard input or output for the DHCP
+// leases commands.
+const stdioPath = "-"
+
+// parseDHCPLeasesArg parses the value of the --import-dhcp-leases and
+// --export-dhcp-leases command-line options in the "format:path" form.
+func parseDHCPLeasesArg(v string) (f dhcpsvc.ReservationFormat, path string, err error) {
+	fmtStr, path, ok := strings.Cut(v, ":")
+	if !ok || path == "" {
+		return "", "", fmt.Errorf("bad value %q: want format:path", v)
+	}
+
+	f = dhcpsvc.ReservationFormat(fmtStr)
+
+	return f, path, f.Validate()
+}
+
+// handleDHCPLeasesCommands imports and exports the DHCP static leases as
+// requested by the command-line options.  config must be parsed.
+func handleDHCPLeasesCommands(opts options) (err error) {
+	//lint:ignore SA1019 Migration is not over.
+	config.DHCP.WorkDir = globalContext.workDir
+	config.DHCP.DataDir = globalContext.getDataDir()
+	config.DHCP.HTTPRegister = func(_, _ string, _ http.HandlerFunc) {}
+	config.DHCP.ConfigModified = func() {}
+
+	srv, err := dhcpd.Create(config.DHCP)
+	if err != nil {
+		return fmt.Errorf("initing dhcp: %w", err)
+	}
+
+	if opts.importDHCPLeases != "" {
+		err = importDHCPLeases(srv, opts.importDHCPLeases)
+		if err != nil {
+			return fmt.Errorf("importing: %w", err)
+		}
+	}
+
+	if opts.exportDHCPLeases != "" {
+		err = exportDHCPLeases(srv, opts.exportDHCPLeases)
+		if err != nil {
+			return fmt.Errorf("exporting: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// importDHCPLeases adds the static leases from the file described by arg to
+// srv.  It returns an error if any of the leases hasn't been added.
+func importDHCPLeases(srv dhcpd.Interface, arg string) (err error) {
+	f, path, err := parseDHCPLeasesArg(arg)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if path != stdioPath {
+		var file *os.File
+		file, err = os.Open(path)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+		defer func() { err = errors.WithDeferred(err, file.Close()) }()
+
+		r = file
+	}
+
+	leases, skipped, err := dhcpsvc.ParseReservations(r, f)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	added, errs := srv.ImportStaticLeases(leases)
+	errs = append(skipped, errs...)
+	for _, e := range errs {
+		log.Error("dhcp: skipped: %s", e)
+	}
+
+	total := len(leases) + len(skipped)
+	log.Info("dhcp: imported %d of %d static leases from %s", added, total, path)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d leases skipped", len(errs))
+	}
+
+	return nil
+}
+
+// exportDHCPLeases writes the static leases of srv to the file described by
+// arg.
+func exportDHCPLeases(srv dhcpd.Interface, arg string) (err error) {
+	f, path, err := parseDHCPLeasesArg(arg)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	var leases []*dhcpsvc.Lease
+	for _, l := range srv.Leases() {
+		if l.IsStatic {
+			leases = append(leases, l)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if path != stdioPath {
+		var file *os.File
+		file, err = os.Create(path)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+		defer func() { err = errors.WithDeferred(err, file.Close()) }()
+
+		w = file
+	}
+
+	err = dhcpsvc.WriteReservations(w, f, leases)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	log.Info("dhcp: exported %d static leases to %s", len(leases), path)
+
+	return nil
+}
@@ -132,6 +132,10 @@ func initDNS(
 	)
 }
 
+// quotasFileName is the name of the file in the data directory with the
+// counters of the ClientID quotas.
+const quotasFileName = "quotas.json"
+
 // initDNSServer initializes the [context.dnsServer].  To only use the internal
 // proxy, none of the arguments are required, but tlsMgr and l still must not be
 // nil, in other cases all the arguments also must not be nil.  It also must not
@@ -149,17 +153,34 @@ func initDNSServer(
 	l *slog.Logger,
 	ruleset *ruleset.Ruleset,
 ) (err error) {
+	// dhcpSrv is nil when only the internal proxy is used.
+	leases, _ := dhcpSrv.(leaseLister)
+	localZone, err := newLocalZone(
+		l,
+		config.DNS.LocalZone,
+		config.DHCP.LocalDomainName,
+		filters,
+		globalContext.etcHosts,
+		leases,
+	)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return err
+	}
+
 	globalContext.dnsServer, err = dnsforward.NewServer(dnsforward.DNSCreateParams{
-		Logger:      l,
-		DNSFilter:   filters,
-		Stats:       sts,
-		QueryLog:    qlog,
-		PrivateNets: parseSubnetSet(config.DNS.PrivateNets),
-		Anonymizer:  anonymizer,
-		DHCPServer:  dhcpSrv,
-		EtcHosts:    globalContext.etcHosts,
-		LocalDomain: config.DHCP.LocalDomainName,
-		Ruleset:     ruleset,
+		Logger:         l,
+		DNSFilter:      filters,
+		Stats:          sts,
+		QueryLog:       qlog,
+		PrivateNets:    parseSubnetSet(config.DNS.PrivateNets),
+		Anonymizer:     anonymizer,
+		DHCPServer:     dhcpSrv,
+		EtcHosts:       globalContext.etcHosts,
+		LocalDomain:    config.DHCP.LocalDomainName,
+		LocalZone:      localZone,
+		Ruleset:        ruleset,
+		QuotasFilePath: filepath.Join(globalContext.getDataDir(), quotasFileName),
 	})
 	defer func() {
 		if err != nil {
@@ -246,6 +267,16 @@ func ipsToUDPAddrs(ips []netip.Addr, port uint16) (udpAddrs []*net.UDPAddr) {
 	return udpAddrs
 }
 
+// authBanSource returns the source of the bans for failing the web
+// authentication or nil if there is no rate limiter.
+func authBanSource() (src dnsforward.BanSource) {
+	if globalContext.auth == nil || globalContext.auth.rateLimiter == nil {
+		return nil
+	}
+
+	return globalContext.auth.rateLimiter
+}
+
 // newServerConfig converts values from the configuration file into the internal
 // DNS server configuration.  All arguments must not be nil, except for httpReg.
 func newServerConfig(
@@ -275,6 +306,7 @@ func newServerConfig(
 		UpstreamTimeout:        time.Duration(dnsConf.UpstreamTimeout),
 		TLSv12Roots:            tlsMgr.rootCerts,
 		ConfigModified:         onConfigModified,
+		AuthBans:               authBanSource(),
 		HTTPRegister:           httpReg,
 		LocalPTRResolvers:      dnsConf.PrivateRDNSResolvers,
 		UseDNS64:               dnsConf.UseDNS64,
@@ -300,10 +332,13 @@ func newServerConfig(
 	newConf.AddrProcConf = &client.DefaultAddrProcConfig{
 		Exchanger:        globalContext.dnsServer,
 		AddressUpdater:   &globalContext.clients,
+		LANNameUpdater:   &globalContext.clients,
 		InitialAddresses: initialAddresses,
 		CatchPanics:      true,
 		UseRDNS:          clientSrcConf.RDNS,
 		UseWHOIS:         clientSrcConf.WHOIS,
+		UseLLMNR:         clientSrcConf.LLMNR,
+		UseNetBIOS:       clientSrcConf.NetBIOS,
 	}
 
 	newConf.DNSCryptConfig, err = newDNSCryptConfig(tlsConf, hosts)
@@ -22,6 +22,8 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
+	"github.com/AdguardTeam/AdGuardHome/internal/audit"
+	"github.com/AdguardTeam/AdGuardHome/internal/blockpage"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
@@ -57,6 +59,8 @@ type homeContext struct {
 	filters    *filtering.DNSFilter // DNS filtering module
 	web        *webAPI              // Web (HTTP, HTTPS) module
 	ruleset    *ruleset.Ruleset     // Ruleset module
+	blockPage  *blockpage.Server    // Block page module
+	audit      *audit.Log           // Configuration changes audit log
 
 	// tls contains the current configuration and state of TLS encryption.
 	//
@@ -149,6 +153,12 @@ func setupContext(opts options) (err error) {
 	}
 
 	if globalContext.firstRun {
+		if opts.importDHCPLeases != "" || opts.exportDHCPLeases != "" {
+			log.Error("dhcp leases: no configuration file")
+
+			os.Exit(osutil.ExitCodeFailure)
+		}
+
 		log.Info("This is the first time AdGuard Home is launched")
 		checkNetworkPermissions()
 
@@ -168,6 +178,17 @@ func setupContext(opts options) (err error) {
 		os.Exit(osutil.ExitCodeSuccess)
 	}
 
+	if opts.importDHCPLeases != "" || opts.exportDHCPLeases != "" {
+		err = handleDHCPLeasesCommands(opts)
+		if err != nil {
+			log.Error("dhcp leases: %s", err)
+
+			os.Exit(osutil.ExitCodeFailure)
+		}
+
+		os.Exit(osutil.ExitCodeSuccess)
+	}
+
 	return nil
 }
 
@@ -687,9 +708,13 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}, sigHdlr *signalH
 	GLMode = opts.glinetMode
 
 	// Init auth module.
-	globalContext.auth, err = initUsers()
+	globalContext.auth, err = initUsers(ctx, slogLogger)
 	fatalOnError(err)
 
+	globalContext.auth.setOIDC(ctx, newOIDCAuth(slogLogger, config.OIDC, httpClient(tlsMgr)))
+	globalContext.auth.setProxyAuth(config.ProxyAuth)
+	globalContext.auth.setDirectory(newLDAPDB(slogLogger, config.LDAP, tlsMgr))
+
 	web, err := initWeb(ctx, opts, clientBuildFS, upd, slogLogger, tlsMgr, isCustomURL)
 	fatalOnError(err)
 
@@ -707,6 +732,12 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}, sigHdlr *signalH
 
 		tlsMgr.start(ctx)
 
+		err = initBlockPage(ctx, slogLogger)
+		fatalOnError(err)
+
+		err = initAudit(ctx, slogLogger)
+		fatalOnError(err)
+
 		go func() {
 			startErr := startDNSServer()
 			if startErr != nil {
@@ -807,7 +838,7 @@ func checkPermissions(
 }
 
 // initUsers initializes context auth module.  Clears config users field.
-func initUsers() (auth *Auth, err error) {
+func initUsers(ctx context.Context, baseLogger *slog.Logger) (auth *Auth, err error) {
 	sessFilename := filepath.Join(globalContext.getDataDir(), "sessions.db")
 
 	var rateLimiter *authRateLimiter
@@ -821,11 +852,24 @@ func initUsers() (auth *Auth, err error) {
 	trustedProxies := netutil.SliceSubnetSet(netutil.UnembedPrefixes(config.DNS.TrustedProxies))
 
 	sessionTTL := time.Duration(config.HTTPConfig.SessionTTL).Seconds()
-	auth = InitAuth(sessFilename, config.Users, uint32(sessionTTL), rateLimiter, trustedProxies)
+	auth = InitAuth(
+		ctx,
+		baseLogger,
+		sessFilename,
+		config.Users,
+		uint32(sessionTTL),
+		rateLimiter,
+		trustedProxies,
+	)
 	if auth == nil {
 		return nil, errors.Error("initializing auth module failed")
 	}
 
+	auth.setSessionLimits(
+		time.Duration(config.HTTPConfig.SessionIdleTimeout),
+		config.HTTPConfig.MaxSessionsPerUser,
+	)
+
 	config.Users = nil
 
 	return auth, nil
@@ -941,6 +985,24 @@ func cleanup(ctx context.Context) {
 		globalContext.auth = nil
 	}
 
+	if globalContext.audit != nil {
+		err := globalContext.audit.Close()
+		if err != nil {
+			log.Error("closing audit log: %s", err)
+		}
+
+		globalContext.audit = nil
+	}
+
+	if globalContext.blockPage != nil {
+		err := globalContext.blockPage.Shutdown(ctx)
+		if err != nil {
+			log.Error("stopping block page server: %s", err)
+		}
+
+		globalContext.blockPage = nil
+	}
+
 	err := stopDNSServer()
 	if err != nil {
 		log.Error("stopping dns server: %s", err)
@@ -0,0 +1,167 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/localzone"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// Default parameters of the local zone, which aren't configurable.
+const (
+	// localZoneRefreshIvl is the minimum interval between rebuilding the zone.
+	localZoneRefreshIvl = 5 * time.Second
+
+	// localZoneJournalSize is the number of the latest zone changes kept for
+	// incremental zone transfers.
+	localZoneJournalSize = 16
+)
+
+// leaseLister is the source of the DHCP leases for the local zone.
+//
+// TODO:  Add to [dnsforward.DHCP].
+type leaseLister interface {
+	// Leases returns all the current DHCP leases.
+	Leases() (leases []*dhcpsvc.Lease)
+}
+
+// localZoneConfig is a block with the local zone configuration.
+type localZoneConfig struct {
+	// TransferAllowed are the networks of secondary servers allowed to
+	// transfer the zone using AXFR and IXFR over TCP.
+	TransferAllowed []netutil.Prefix `yaml:"transfer_allowed"`
+
+	// MaxTTL is the TTL of static records and the upper bound for the TTL of
+	// the records built from DHCP leases.
+	MaxTTL timeutil.Duration `yaml:"max_ttl"`
+
+	// Enabled defines if the DNS server answers authoritatively for the local
+	// domain name.
+	Enabled bool `yaml:"enabled"`
+}
+
+// newLocalZone returns the local zone built from the rewrites of filters, the
+// system hosts files of hosts, and the leases of dhcpSrv.  It returns nil if the
+// zone is disabled.  l and conf must not be nil, filters, hosts, and dhcpSrv
+// may be nil.
+func newLocalZone(
+	l *slog.Logger,
+	conf *localZoneConfig,
+	origin string,
+	filters *filtering.DNSFilter,
+	hosts *aghnet.HostsContainer,
+	dhcpSrv leaseLister,
+) (z *localzone.Zone, err error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+
+	var srcs []localzone.RecordSource
+	if filters != nil {
+		srcs = append(srcs, localzone.RecordSourceFunc(
+			func(_ context.Context) (recs []*localzone.Record) {
+				return rewriteRecords(filters.AddressRewrites())
+			},
+		))
+	}
+
+	if hosts != nil {
+		srcs = append(srcs, localzone.RecordSourceFunc(
+			func(_ context.Context) (recs []*localzone.Record) {
+				return hostsRecords(hosts)
+			},
+		))
+	}
+
+	if dhcpSrv != nil {
+		srcs = append(srcs, localzone.RecordSourceFunc(
+			func(_ context.Context) (recs []*localzone.Record) {
+				return leaseRecords(dhcpSrv)
+			},
+		))
+	}
+
+	allowed := make([]netip.Prefix, 0, len(conf.TransferAllowed))
+	for _, p := range conf.TransferAllowed {
+		allowed = append(allowed, p.Prefix)
+	}
+
+	c := &localzone.Config{
+		Logger:          l.With(slogutil.KeyPrefix, "localzone"),
+		Origin:          origin,
+		Sources:         srcs,
+		TransferAllowed: allowed,
+		MaxTTL:          time.Duration(conf.MaxTTL),
+		RefreshInterval: localZoneRefreshIvl,
+		JournalSize:     localZoneJournalSize,
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("local zone: %w", err)
+	}
+
+	return localzone.New(c), nil
+}
+
+// rewriteRecords converts the address rewrites into local zone records.
+func rewriteRecords(rws []*filtering.LegacyRewrite) (recs []*localzone.Record) {
+	recs = make([]*localzone.Record, 0, len(rws))
+	for _, rw := range rws {
+		recs = append(recs, &localzone.Record{
+			Expiry: rw.Expires,
+			Addr:   rw.IP,
+			Host:   rw.Domain,
+			Source: localzone.SourceRewrite,
+		})
+	}
+
+	return recs
+}
+
+// hostsRecords converts the current system hosts into local zone records.
+func hostsRecords(hosts *aghnet.HostsContainer) (recs []*localzone.Record) {
+	hosts.RangeAddrs(func(host string, addrs []netip.Addr) (cont bool) {
+		for _, addr := range addrs {
+			recs = append(recs, &localzone.Record{
+				Addr:   addr,
+				Host:   host,
+				Source: localzone.SourceHosts,
+			})
+		}
+
+		return true
+	})
+
+	return recs
+}
+
+// leaseRecords converts the current DHCP leases into local zone records.
+func leaseRecords(dhcpSrv leaseLister) (recs []*localzone.Record) {
+	leases := dhcpSrv.Leases()
+	recs = make([]*localzone.Record, 0, len(leases))
+	for _, l := range leases {
+		r := &localzone.Record{
+			Addr:   l.IP,
+			Host:   l.Hostname,
+			Owner:  l.HWAddr.String(),
+			Source: localzone.SourceDHCP,
+		}
+		if !l.IsStatic {
+			r.Expiry = l.Expiry
+		}
+
+		recs = append(recs, r)
+	}
+
+	return recs
+}
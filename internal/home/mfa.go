@@ -0,0 +1,705 @@
+package home
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/webauthn"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// mfaCeremonyTTL is the time during which a user has to finish a
+	// second-factor login or an enrollment.
+	mfaCeremonyTTL = 5 * time.Minute
+
+	// mfaMaxAttempts is the maximum number of failed second-factor attempts
+	// for a single login.  The user has to enter the password again after
+	// that.
+	mfaMaxAttempts = 5
+
+	// mfaRecoveryCodesNum is the number of recovery codes generated at once.
+	mfaRecoveryCodesNum = 10
+
+	// mfaRecoveryCodeSize is the size of the random part of recovery codes in
+	// bytes.
+	mfaRecoveryCodeSize = 8
+
+	// mfaTOTPIssuer is the issuer shown by the authenticator apps.
+	mfaTOTPIssuer = "Null Private"
+)
+
+// Second-factor authentication methods.
+const (
+	mfaMethodRecoveryCode = "recovery_code"
+	mfaMethodTOTP         = "totp"
+	mfaMethodWebAuthn     = "webauthn"
+)
+
+// mfaBucketName returns the name of the database bucket with the second-factor
+// authentication data of the users.
+func mfaBucketName() (name []byte) {
+	return []byte("mfa")
+}
+
+// userMFA is the second-factor authentication data of a web user.
+type userMFA struct {
+	// TOTPSecret is the secret of the enabled TOTP authenticator, if any.
+	TOTPSecret []byte `json:"totp_secret,omitempty"`
+
+	// RecoveryCodes are the SHA-256 hashes of the unused recovery codes.
+	RecoveryCodes [][]byte `json:"recovery_codes,omitempty"`
+
+	// WebAuthn are the registered WebAuthn credentials.
+	WebAuthn []*webAuthnCredential `json:"webauthn,omitempty"`
+
+	// TOTPLastStep is the time step of the last accepted TOTP code.  It
+	// prevents the reuse of codes.
+	TOTPLastStep int64 `json:"totp_last_step,omitempty"`
+}
+
+// enabled returns true if m has at least one second factor.
+func (m *userMFA) enabled() (ok bool) {
+	return m != nil && (len(m.TOTPSecret) > 0 || len(m.WebAuthn) > 0)
+}
+
+// webAuthnCredential is a WebAuthn credential registered by a web user.
+type webAuthnCredential struct {
+	// Created is the time when the credential has been registered.
+	Created time.Time `json:"created"`
+
+	// LastUsed is the time when the credential has been used for the last
+	// time.
+	LastUsed time.Time `json:"last_used"`
+
+	// Name is the human-readable name of the credential.
+	Name string `json:"name"`
+
+	// RPID is the domain name the credential has been registered for.
+	// Browsers only use the credentials on the same domain.
+	RPID string `json:"rp_id"`
+
+	webauthn.Credential
+}
+
+// mfaCeremony is an unfinished second-factor login or enrollment.
+type mfaCeremony struct {
+	expires  time.Time
+	userName string
+
+	// rpID and challenge are only set for WebAuthn ceremonies.
+	rpID      string
+	challenge []byte
+
+	// totpSecret is only set for TOTP enrollments.
+	totpSecret []byte
+
+	attempts int
+}
+
+// mfaState is the second-factor authentication state of [Auth].  It's
+// protected by the lock of [Auth].
+type mfaState struct {
+	// users maps the names of the users to their data.
+	users map[string]*userMFA
+
+	// logins maps the hex-encoded login tokens to the logins waiting for the
+	// second factor.
+	logins map[string]*mfaCeremony
+
+	// totpSetups maps the user names to the unconfirmed TOTP enrollments.
+	totpSetups map[string]*mfaCeremony
+
+	// registrations maps the user names to the unfinished WebAuthn
+	// registrations.
+	registrations map[string]*mfaCeremony
+}
+
+// newMFAState returns a new properly initialized *mfaState.
+func newMFAState() (s *mfaState) {
+	return &mfaState{
+		users:         map[string]*userMFA{},
+		logins:        map[string]*mfaCeremony{},
+		totpSetups:    map[string]*mfaCeremony{},
+		registrations: map[string]*mfaCeremony{},
+	}
+}
+
+// removeExpired removes the ceremonies that have expired by now.
+func (s *mfaState) removeExpired(now time.Time) {
+	isExpired := func(_ string, c *mfaCeremony) (ok bool) { return !now.Before(c.expires) }
+
+	maps.DeleteFunc(s.logins, isExpired)
+	maps.DeleteFunc(s.totpSetups, isExpired)
+	maps.DeleteFunc(s.registrations, isExpired)
+}
+
+// hashRecoveryCode returns the hash of the normalized recovery code.
+func hashRecoveryCode(code string) (h []byte) {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+
+	return sum[:]
+}
+
+// newRecoveryCodes returns new recovery codes and their hashes.
+func newRecoveryCodes() (codes []string, hashes [][]byte) {
+	for range mfaRecoveryCodesNum {
+		b := make([]byte, mfaRecoveryCodeSize)
+
+		// Since Go 1.24, crypto/rand.Read doesn't return an error and crashes
+		// unrecoverably instead.
+		_, _ = rand.Read(b)
+
+		h := hex.EncodeToString(b)
+		code := h[:4] + "-" + h[4:8] + "-" + h[8:12] + "-" + h[12:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes
+}
+
+// loadMFA loads the second-factor authentication data from the database file.
+func (a *Auth) loadMFA() {
+	err := a.db.View(func(tx *bbolt.Tx) (err error) {
+		bkt := tx.Bucket(mfaBucketName())
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(k, v []byte) (err error) {
+			m := &userMFA{}
+			err = json.Unmarshal(v, m)
+			if err != nil {
+				log.Error("auth: decoding mfa data of user %q: %s", k, err)
+
+				return nil
+			}
+
+			a.mfa.users[string(k)] = m
+
+			return nil
+		})
+	})
+	if err != nil {
+		log.Error("auth: loading mfa data: %s", err)
+	}
+
+	log.Debug("auth: loaded mfa data of %d users from DB", len(a.mfa.users))
+}
+
+// storeMFA saves the second-factor data of the user with name to the database
+// file.  a.lock is expected to be locked.
+func (a *Auth) storeMFA(name string, m *userMFA) (err error) {
+	var data []byte
+	if m.enabled() {
+		data, err = json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("encoding mfa data: %w", err)
+		}
+	}
+
+	err = a.db.Update(func(tx *bbolt.Tx) (err error) {
+		bkt, err := tx.CreateBucketIfNotExists(mfaBucketName())
+		if err != nil {
+			return fmt.Errorf("creating bucket: %w", err)
+		}
+
+		if data == nil {
+			return bkt.Delete([]byte(name))
+		}
+
+		return bkt.Put([]byte(name), data)
+	})
+	if err != nil {
+		return fmt.Errorf("storing mfa data: %w", err)
+	}
+
+	if m.enabled() {
+		a.mfa.users[name] = m
+	} else {
+		delete(a.mfa.users, name)
+	}
+
+	return nil
+}
+
+// userHasMFA returns true if the user with name has a second factor.
+func (a *Auth) userHasMFA(name string) (ok bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.mfa.users[name].enabled()
+}
+
+// mfaLogin is a started second-factor login.
+type mfaLogin struct {
+	// token identifies the login.
+	token string
+
+	// methods are the methods the user may use.
+	methods []string
+
+	// challenge is the WebAuthn challenge.  It's nil if the user has no
+	// WebAuthn credentials for rpID.
+	challenge []byte
+
+	// credIDs are the identifiers of the WebAuthn credentials of the user for
+	// rpID.
+	credIDs [][]byte
+}
+
+// startMFALogin starts the second-factor login of the user with name, who has
+// entered the correct password.  rpID is the domain used by the browser.
+func (a *Auth) startMFALogin(name, rpID string, now time.Time) (l *mfaLogin) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.mfa.removeExpired(now)
+
+	m := a.userMFAOrEmpty(name)
+	l = &mfaLogin{
+		token: hex.EncodeToString(newSessionToken()),
+	}
+
+	if len(m.TOTPSecret) > 0 {
+		l.methods = append(l.methods, mfaMethodTOTP)
+	}
+
+	for _, c := range m.WebAuthn {
+		if rpID != "" && c.RPID == rpID {
+			l.credIDs = append(l.credIDs, c.ID)
+		}
+	}
+
+	if len(l.credIDs) > 0 {
+		l.methods = append(l.methods, mfaMethodWebAuthn)
+		l.challenge = webauthn.NewChallenge()
+	}
+
+	if len(m.RecoveryCodes) > 0 {
+		l.methods = append(l.methods, mfaMethodRecoveryCode)
+	}
+
+	a.mfa.logins[l.token] = &mfaCeremony{
+		expires:   now.Add(mfaCeremonyTTL),
+		userName:  name,
+		rpID:      rpID,
+		challenge: l.challenge,
+	}
+
+	return l
+}
+
+// mfaLoginReq is the request to the POST /control/login/mfa HTTP API.
+type mfaLoginReq struct {
+	// WebAuthn is the result of navigator.credentials.get.
+	WebAuthn *webAuthnAssertionJSON `json:"webauthn"`
+
+	// MFAToken is the token returned by POST /control/login.
+	MFAToken string `json:"mfa_token"`
+
+	// TOTP is the code from the authenticator app.
+	TOTP string `json:"totp"`
+
+	// RecoveryCode is one of the recovery codes.
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// finishMFALogin checks the second factor from req and returns the name of the
+// user if it's valid.
+func (a *Auth) finishMFALogin(req *mfaLoginReq, now time.Time) (name string, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.mfa.removeExpired(now)
+
+	c, ok := a.mfa.logins[req.MFAToken]
+	if !ok {
+		return "", errors.Error("login expired, enter the password again")
+	}
+
+	c.attempts++
+	if c.attempts >= mfaMaxAttempts {
+		delete(a.mfa.logins, req.MFAToken)
+	}
+
+	m, ok := a.mfa.users[c.userName]
+	if !ok {
+		return "", errors.Error("second factor is not configured")
+	}
+
+	// Update a copy, so that the failed attempts don't change anything.
+	upd := m.clone()
+	switch {
+	case req.TOTP != "":
+		err = upd.checkTOTP(req.TOTP, now)
+	case req.RecoveryCode != "":
+		err = upd.useRecoveryCode(req.RecoveryCode)
+	case req.WebAuthn != nil:
+		err = upd.checkWebAuthn(req.WebAuthn, c, now)
+	default:
+		err = errors.Error("no second factor provided")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = a.storeMFA(c.userName, upd)
+	if err != nil {
+		// Don't allow to reuse the code or the signature counter if the data
+		// can't be saved.
+		return "", err
+	}
+
+	delete(a.mfa.logins, req.MFAToken)
+
+	return c.userName, nil
+}
+
+// clone returns a deep copy of m.
+func (m *userMFA) clone() (c *userMFA) {
+	c = &userMFA{
+		TOTPSecret:    m.TOTPSecret,
+		RecoveryCodes: slices.Clone(m.RecoveryCodes),
+		TOTPLastStep:  m.TOTPLastStep,
+		WebAuthn:      make([]*webAuthnCredential, 0, len(m.WebAuthn)),
+	}
+
+	for _, cred := range m.WebAuthn {
+		cc := *cred
+		c.WebAuthn = append(c.WebAuthn, &cc)
+	}
+
+	return c
+}
+
+// checkTOTP returns an error if code isn't a valid TOTP code at now.
+func (m *userMFA) checkTOTP(code string, now time.Time) (err error) {
+	if len(m.TOTPSecret) == 0 {
+		return errors.Error("totp is not enabled")
+	}
+
+	step, ok := aghuser.ValidateTOTP(m.TOTPSecret, strings.TrimSpace(code), now, m.TOTPLastStep)
+	if !ok {
+		return errors.Error("invalid totp code")
+	}
+
+	m.TOTPLastStep = step
+
+	return nil
+}
+
+// useRecoveryCode returns an error if code isn't one of the unused recovery
+// codes.  Otherwise, it removes the code.
+func (m *userMFA) useRecoveryCode(code string) (err error) {
+	h := hashRecoveryCode(code)
+	idx := slices.IndexFunc(m.RecoveryCodes, func(stored []byte) (ok bool) {
+		return subtle.ConstantTimeCompare(stored, h) == 1
+	})
+	if idx < 0 {
+		return errors.Error("invalid recovery code")
+	}
+
+	m.RecoveryCodes = slices.Delete(m.RecoveryCodes, idx, idx+1)
+
+	return nil
+}
+
+// checkWebAuthn returns an error if the assertion isn't valid for the
+// challenge of c.
+func (m *userMFA) checkWebAuthn(
+	aj *webAuthnAssertionJSON,
+	c *mfaCeremony,
+	now time.Time,
+) (err error) {
+	if c.challenge == nil {
+		return errors.Error("webauthn is not available for this login")
+	}
+
+	p, id, err := aj.toParams()
+	if err != nil {
+		return err
+	}
+
+	idx := slices.IndexFunc(m.WebAuthn, func(cred *webAuthnCredential) (ok bool) {
+		return cred.RPID == c.rpID && bytes.Equal(cred.ID, id)
+	})
+	if idx < 0 {
+		return errors.Error("unknown webauthn credential")
+	}
+
+	cred := m.WebAuthn[idx]
+	p.Challenge, p.RPID = c.challenge, c.rpID
+	signCount, err := webauthn.VerifyAssertion(&cred.Credential, p)
+	if err != nil {
+		return fmt.Errorf("webauthn credential %q: %w", cred.Name, err)
+	}
+
+	cred.SignCount, cred.LastUsed = signCount, now.UTC()
+
+	return nil
+}
+
+// addRecoveryCodesIfNone generates the recovery codes if m has none and returns
+// them.
+func (m *userMFA) addRecoveryCodesIfNone() (codes []string) {
+	if len(m.RecoveryCodes) > 0 {
+		return nil
+	}
+
+	codes, m.RecoveryCodes = newRecoveryCodes()
+
+	return codes
+}
+
+// userMFAOrEmpty returns a copy of the second-factor data of the user with name
+// or an empty one.  a.lock is expected to be locked.
+func (a *Auth) userMFAOrEmpty(name string) (m *userMFA) {
+	m, ok := a.mfa.users[name]
+	if !ok {
+		return &userMFA{}
+	}
+
+	return m.clone()
+}
+
+// beginTOTPSetup generates a new TOTP secret for the user with name, which
+// is only enabled after the user confirms it with a code.
+func (a *Auth) beginTOTPSetup(name string, now time.Time) (secret []byte) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.mfa.removeExpired(now)
+
+	secret = aghuser.NewTOTPSecret()
+	a.mfa.totpSetups[name] = &mfaCeremony{
+		expires:    now.Add(mfaCeremonyTTL),
+		userName:   name,
+		totpSecret: secret,
+	}
+
+	return secret
+}
+
+// enableTOTP enables the TOTP secret set up for the user with name if code is
+// valid.  codes are the new recovery codes, if the user has had none.
+func (a *Auth) enableTOTP(name, code string, now time.Time) (codes []string, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.mfa.removeExpired(now)
+
+	c, ok := a.mfa.totpSetups[name]
+	if !ok {
+		return nil, errors.Error("totp setup expired, start again")
+	}
+
+	upd := a.userMFAOrEmpty(name)
+	upd.TOTPSecret, upd.TOTPLastStep = c.totpSecret, 0
+	err = upd.checkTOTP(code, now)
+	if err != nil {
+		return nil, err
+	}
+
+	codes = upd.addRecoveryCodesIfNone()
+	err = a.storeMFA(name, upd)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(a.mfa.totpSetups, name)
+	log.Info("auth: user %q enabled totp", name)
+
+	return codes, nil
+}
+
+// disableTOTP disables TOTP for the user with name.
+func (a *Auth) disableTOTP(name string) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	upd := a.userMFAOrEmpty(name)
+	upd.TOTPSecret, upd.TOTPLastStep = nil, 0
+	if !upd.enabled() {
+		upd.RecoveryCodes = nil
+	}
+
+	err = a.storeMFA(name, upd)
+	if err != nil {
+		return err
+	}
+
+	log.Info("auth: user %q disabled totp", name)
+
+	return nil
+}
+
+// beginWebAuthnRegistration starts the registration of a WebAuthn credential
+// of the user with name for rpID.  excludeIDs are the identifiers of the
+// credentials already registered for rpID.
+func (a *Auth) beginWebAuthnRegistration(
+	name string,
+	rpID string,
+	now time.Time,
+) (challenge []byte, excludeIDs [][]byte) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.mfa.removeExpired(now)
+
+	for _, c := range a.mfa.users[name].webAuthnCredentials() {
+		if c.RPID == rpID {
+			excludeIDs = append(excludeIDs, c.ID)
+		}
+	}
+
+	challenge = webauthn.NewChallenge()
+	a.mfa.registrations[name] = &mfaCeremony{
+		expires:   now.Add(mfaCeremonyTTL),
+		userName:  name,
+		rpID:      rpID,
+		challenge: challenge,
+	}
+
+	return challenge, excludeIDs
+}
+
+// webAuthnCredentials returns the WebAuthn credentials of m, if any.
+func (m *userMFA) webAuthnCredentials() (creds []*webAuthnCredential) {
+	if m == nil {
+		return nil
+	}
+
+	return m.WebAuthn
+}
+
+// finishWebAuthnRegistration verifies the result of the WebAuthn registration
+// and adds the credential with credName to the user with name.  codes are the
+// new recovery codes, if the user has had none.
+func (a *Auth) finishWebAuthnRegistration(
+	name string,
+	credName string,
+	clientDataJSON []byte,
+	attObj []byte,
+	now time.Time,
+) (codes []string, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.mfa.removeExpired(now)
+
+	c, ok := a.mfa.registrations[name]
+	if !ok {
+		return nil, errors.Error("webauthn registration expired, start again")
+	}
+
+	// The challenge must only be used once.
+	delete(a.mfa.registrations, name)
+
+	cred, err := webauthn.VerifyRegistration(&webauthn.RegistrationParams{
+		ClientDataJSON:    clientDataJSON,
+		AttestationObject: attObj,
+		Challenge:         c.challenge,
+		RPID:              c.rpID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	upd := a.userMFAOrEmpty(name)
+	if slices.ContainsFunc(upd.WebAuthn, func(wc *webAuthnCredential) (ok bool) {
+		return bytes.Equal(wc.ID, cred.ID)
+	}) {
+		return nil, errors.Error("credential is already registered")
+	}
+
+	upd.WebAuthn = append(upd.WebAuthn, &webAuthnCredential{
+		Created:    now.UTC(),
+		Name:       credName,
+		RPID:       c.rpID,
+		Credential: *cred,
+	})
+
+	codes = upd.addRecoveryCodesIfNone()
+	err = a.storeMFA(name, upd)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("auth: user %q registered webauthn credential %q for %q", name, credName, c.rpID)
+
+	return codes, nil
+}
+
+// removeWebAuthnCredential removes the WebAuthn credential with id from the
+// user with name.  ok is false if there is no such credential.
+func (a *Auth) removeWebAuthnCredential(name string, id []byte) (ok bool, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	upd := a.userMFAOrEmpty(name)
+	n := len(upd.WebAuthn)
+	upd.WebAuthn = slices.DeleteFunc(upd.WebAuthn, func(c *webAuthnCredential) (del bool) {
+		return bytes.Equal(c.ID, id)
+	})
+	if len(upd.WebAuthn) == n {
+		return false, nil
+	}
+
+	if !upd.enabled() {
+		upd.RecoveryCodes = nil
+	}
+
+	err = a.storeMFA(name, upd)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info("auth: user %q removed webauthn credential", name)
+
+	return true, nil
+}
+
+// regenerateRecoveryCodes replaces the recovery codes of the user with name.
+func (a *Auth) regenerateRecoveryCodes(name string) (codes []string, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	upd := a.userMFAOrEmpty(name)
+	if !upd.enabled() {
+		return nil, errors.Error("second factor is not enabled")
+	}
+
+	codes, upd.RecoveryCodes = newRecoveryCodes()
+	err = a.storeMFA(name, upd)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("auth: user %q regenerated recovery codes", name)
+
+	return codes, nil
+}
+
+// userMFAStatus returns a copy of the second-factor data of the user with name.
+func (a *Auth) userMFAStatus(name string) (m *userMFA) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.userMFAOrEmpty(name)
+}
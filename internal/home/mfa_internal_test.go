@@ -0,0 +1,225 @@
+package home
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMFAUser is the name of the user with the password "password" used in
+// the second-factor tests.
+const testMFAUser = "name"
+
+// newTestMFAAuth returns a new *Auth with a single user for the second-factor
+// tests.
+func newTestMFAAuth(tb testing.TB, fn string) (a *Auth) {
+	tb.Helper()
+
+	users := []webUser{{
+		Name:         testMFAUser,
+		PasswordHash: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2",
+	}}
+
+	a = InitAuth(
+		testutil.ContextWithTimeout(tb, testTimeout),
+		testLogger,
+		fn,
+		users,
+		60,
+		nil,
+		netutil.SliceSubnetSet(nil),
+	)
+	require.NotNil(tb, a)
+
+	return a
+}
+
+func TestAuth_TOTP(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "sessions.db")
+	a := newTestMFAAuth(t, fn)
+
+	now := time.Now()
+	secret := a.beginTOTPSetup(testMFAUser, now)
+
+	_, err := a.enableTOTP(testMFAUser, "000000", now)
+	require.Error(t, err)
+
+	codes, err := a.enableTOTP(testMFAUser, aghuser.TOTPCode(secret, now), now)
+	require.NoError(t, err)
+	require.Len(t, codes, mfaRecoveryCodesNum)
+
+	assert.True(t, a.userHasMFA(testMFAUser))
+
+	_, err = a.newCookie(
+		testutil.ContextWithTimeout(t, testTimeout),
+		loginJSON{Name: testMFAUser, Password: "password"},
+		"",
+		newSessionClient(nil),
+	)
+	require.ErrorIs(t, err, errMFARequired)
+
+	l := a.startMFALogin(testMFAUser, "", now)
+	assert.Equal(t, []string{mfaMethodTOTP, mfaMethodRecoveryCode}, l.methods)
+	assert.Nil(t, l.challenge)
+
+	// The code used for enabling can't be reused.
+	_, err = a.finishMFALogin(&mfaLoginReq{
+		MFAToken: l.token,
+		TOTP:     aghuser.TOTPCode(secret, now),
+	}, now)
+	testutil.AssertErrorMsg(t, "invalid totp code", err)
+
+	later := now.Add(aghuser.TOTPPeriod)
+	name, err := a.finishMFALogin(&mfaLoginReq{
+		MFAToken: l.token,
+		TOTP:     aghuser.TOTPCode(secret, later),
+	}, later)
+	require.NoError(t, err)
+
+	assert.Equal(t, testMFAUser, name)
+
+	_, err = a.finishMFALogin(&mfaLoginReq{
+		MFAToken: l.token,
+		TOTP:     aghuser.TOTPCode(secret, later),
+	}, later)
+	testutil.AssertErrorMsg(t, "login expired, enter the password again", err)
+
+	a.Close()
+
+	a = newTestMFAAuth(t, fn)
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		a.Close()
+
+		return nil
+	})
+
+	require.True(t, a.userHasMFA(testMFAUser))
+
+	l = a.startMFALogin(testMFAUser, "", later)
+	name, err = a.finishMFALogin(&mfaLoginReq{
+		MFAToken:     l.token,
+		RecoveryCode: codes[0],
+	}, later)
+	require.NoError(t, err)
+
+	assert.Equal(t, testMFAUser, name)
+	assert.Len(t, a.userMFAStatus(testMFAUser).RecoveryCodes, mfaRecoveryCodesNum-1)
+
+	l = a.startMFALogin(testMFAUser, "", later)
+	_, err = a.finishMFALogin(&mfaLoginReq{
+		MFAToken:     l.token,
+		RecoveryCode: codes[0],
+	}, later)
+	testutil.AssertErrorMsg(t, "invalid recovery code", err)
+
+	require.NoError(t, a.disableTOTP(testMFAUser))
+
+	assert.False(t, a.userHasMFA(testMFAUser))
+	assert.Empty(t, a.userMFAStatus(testMFAUser).RecoveryCodes)
+}
+
+func TestAuth_finishMFALogin_attempts(t *testing.T) {
+	a := newTestMFAAuth(t, filepath.Join(t.TempDir(), "sessions.db"))
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		a.Close()
+
+		return nil
+	})
+
+	now := time.Now()
+	secret := a.beginTOTPSetup(testMFAUser, now)
+	_, err := a.enableTOTP(testMFAUser, aghuser.TOTPCode(secret, now), now)
+	require.NoError(t, err)
+
+	l := a.startMFALogin(testMFAUser, "", now)
+	for range mfaMaxAttempts {
+		_, err = a.finishMFALogin(&mfaLoginReq{MFAToken: l.token, TOTP: "abcdef"}, now)
+		require.Error(t, err)
+	}
+
+	later := now.Add(aghuser.TOTPPeriod)
+	_, err = a.finishMFALogin(&mfaLoginReq{
+		MFAToken: l.token,
+		TOTP:     aghuser.TOTPCode(secret, later),
+	}, later)
+	testutil.AssertErrorMsg(t, "login expired, enter the password again", err)
+
+	l = a.startMFALogin(testMFAUser, "", now)
+	_, err = a.finishMFALogin(&mfaLoginReq{
+		MFAToken: l.token,
+		TOTP:     aghuser.TOTPCode(secret, later),
+	}, now.Add(mfaCeremonyTTL))
+	testutil.AssertErrorMsg(t, "login expired, enter the password again", err)
+}
+
+func TestHandleLogin_mfa(t *testing.T) {
+	storeGlobals(t)
+
+	globalContext.auth = newTestMFAAuth(t, filepath.Join(t.TempDir(), "sessions.db"))
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		globalContext.auth.Close()
+
+		return nil
+	})
+
+	setupW := httptest.NewRecorder()
+	setupR := httptest.NewRequest(http.MethodPost, "/control/mfa/totp/setup", nil)
+	setupR = setupR.WithContext(withAuthUser(setupR.Context(), &webUser{Name: testMFAUser}))
+	handleMFATOTPSetup(setupW, setupR)
+	require.Equal(t, http.StatusOK, setupW.Code)
+
+	setup := &mfaTOTPSetupJSON{}
+	require.NoError(t, json.NewDecoder(setupW.Body).Decode(setup))
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(setup.Secret)
+	require.NoError(t, err)
+
+	// Enable TOTP with the code of the previous period, so that the current
+	// one isn't considered reused.
+	prev := time.Now().Add(-aghuser.TOTPPeriod)
+	_, err = globalContext.auth.enableTOTP(testMFAUser, aghuser.TOTPCode(secret, prev), prev)
+	require.NoError(t, err)
+
+	body, err := json.Marshal(&loginJSON{Name: testMFAUser, Password: "password"})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handleLogin(w, httptest.NewRequest(http.MethodPost, "/control/login", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Empty(t, w.Result().Cookies())
+
+	resp := &mfaLoginResp{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+	require.True(t, resp.MFARequired)
+
+	body, err = json.Marshal(&mfaLoginReq{
+		MFAToken: resp.MFAToken,
+		TOTP:     aghuser.TOTPCode(secret, time.Now()),
+	})
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	handleLoginMFA(w, httptest.NewRequest(http.MethodPost, "/control/login/mfa", bytes.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, w.Result().Cookies(), 1)
+
+	assert.Equal(t, sessionCookieName, w.Result().Cookies()[0].Name)
+
+	r := httptest.NewRequest(http.MethodGet, "/control/status", nil)
+	r.SetBasicAuth(testMFAUser, "password")
+	_, mustAuth := optionalAuthThird(httptest.NewRecorder(), r)
+	assert.True(t, mustAuth)
+}
@@ -0,0 +1,624 @@
+package home
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/webauthn"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// webAuthnTimeout is the timeout for the WebAuthn ceremonies in the browser.
+const webAuthnTimeout = 2 * time.Minute
+
+// webAuthnRPID returns the WebAuthn relying party identifier for r, which is
+// the domain name used by the browser.  WebAuthn can't be used with IP
+// addresses.
+func webAuthnRPID(r *http.Request) (rpID string, err error) {
+	host, err := netutil.SplitHost(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return "", errors.Error("webauthn: no host in request")
+	} else if _, err = netip.ParseAddr(host); err == nil {
+		return "", fmt.Errorf("webauthn: requires a domain name, not ip address %s", host)
+	}
+
+	return host, nil
+}
+
+// decodeBase64URL decodes the base64url-encoded data with or without padding,
+// as produced by browsers.
+func decodeBase64URL(s string) (b []byte, err error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// encodeBase64URL encodes b in the base64url encoding without padding.
+func encodeBase64URL(b []byte) (s string) {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// webAuthnCredDescriptorJSON is the PublicKeyCredentialDescriptor WebAuthn
+// structure.
+type webAuthnCredDescriptorJSON struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// newWebAuthnCredDescriptors returns the descriptors of the credentials with
+// ids.
+func newWebAuthnCredDescriptors(ids [][]byte) (descs []*webAuthnCredDescriptorJSON) {
+	descs = make([]*webAuthnCredDescriptorJSON, 0, len(ids))
+	for _, id := range ids {
+		descs = append(descs, &webAuthnCredDescriptorJSON{
+			Type: "public-key",
+			ID:   encodeBase64URL(id),
+		})
+	}
+
+	return descs
+}
+
+// webAuthnRequestOptionsJSON is the PublicKeyCredentialRequestOptions WebAuthn
+// structure for navigator.credentials.get.  Binary values are base64url-encoded.
+type webAuthnRequestOptionsJSON struct {
+	Challenge        string                        `json:"challenge"`
+	RPID             string                        `json:"rpId"`
+	UserVerification string                        `json:"userVerification"`
+	AllowCredentials []*webAuthnCredDescriptorJSON `json:"allowCredentials"`
+	Timeout          int64                         `json:"timeout"`
+}
+
+// webAuthnCreationOptionsJSON is the PublicKeyCredentialCreationOptions
+// WebAuthn structure for navigator.credentials.create.  Binary values are
+// base64url-encoded.
+type webAuthnCreationOptionsJSON struct {
+	RP                     *webAuthnRPJSON                 `json:"rp"`
+	User                   *webAuthnUserJSON               `json:"user"`
+	AuthenticatorSelection *webAuthnAuthSelectionJSON      `json:"authenticatorSelection"`
+	Challenge              string                          `json:"challenge"`
+	Attestation            string                          `json:"attestation"`
+	PubKeyCredParams       []*webAuthnPubKeyCredParamsJSON `json:"pubKeyCredParams"`
+	ExcludeCredentials     []*webAuthnCredDescriptorJSON   `json:"excludeCredentials"`
+	Timeout                int64                           `json:"timeout"`
+}
+
+// webAuthnRPJSON is the PublicKeyCredentialRpEntity WebAuthn structure.
+type webAuthnRPJSON struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// webAuthnUserJSON is the PublicKeyCredentialUserEntity WebAuthn structure.
+type webAuthnUserJSON struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// webAuthnAuthSelectionJSON is the AuthenticatorSelectionCriteria WebAuthn
+// structure.
+type webAuthnAuthSelectionJSON struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// webAuthnPubKeyCredParamsJSON is the PublicKeyCredentialParameters WebAuthn
+// structure.
+type webAuthnPubKeyCredParamsJSON struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// webAuthnAssertionJSON is the result of navigator.credentials.get.  Binary
+// values are base64url-encoded.
+type webAuthnAssertionJSON struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	Signature         string `json:"signature"`
+}
+
+// toParams decodes the assertion into the verification parameters and the
+// credential identifier.
+func (aj *webAuthnAssertionJSON) toParams() (p *webauthn.AssertionParams, id []byte, err error) {
+	p = &webauthn.AssertionParams{}
+	var errs []error
+
+	id, err = decodeBase64URL(aj.ID)
+	errs = append(errs, errors.Annotate(err, "id: %w"))
+
+	p.ClientDataJSON, err = decodeBase64URL(aj.ClientDataJSON)
+	errs = append(errs, errors.Annotate(err, "client_data_json: %w"))
+
+	p.AuthenticatorData, err = decodeBase64URL(aj.AuthenticatorData)
+	errs = append(errs, errors.Annotate(err, "authenticator_data: %w"))
+
+	p.Signature, err = decodeBase64URL(aj.Signature)
+	errs = append(errs, errors.Annotate(err, "signature: %w"))
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("webauthn: %w", err)
+	}
+
+	return p, id, nil
+}
+
+// mfaLoginResp is the response to POST /control/login for users with a second
+// factor.
+type mfaLoginResp struct {
+	// WebAuthn is nil if the user has no WebAuthn credentials for the domain.
+	WebAuthn *webAuthnRequestOptionsJSON `json:"webauthn,omitempty"`
+
+	MFAToken    string   `json:"mfa_token"`
+	Methods     []string `json:"methods"`
+	MFARequired bool     `json:"mfa_required"`
+}
+
+// writeMFALoginResp starts the second-factor login of the user with name and
+// writes the response.
+func writeMFALoginResp(w http.ResponseWriter, r *http.Request, name string) {
+	// The error is not important here, since WebAuthn is just not offered
+	// for the addresses.
+	rpID, _ := webAuthnRPID(r)
+
+	l := globalContext.auth.startMFALogin(name, rpID, time.Now())
+	resp := &mfaLoginResp{
+		MFAToken:    l.token,
+		Methods:     l.methods,
+		MFARequired: true,
+	}
+
+	if l.challenge != nil {
+		resp.WebAuthn = &webAuthnRequestOptionsJSON{
+			Challenge:        encodeBase64URL(l.challenge),
+			RPID:             rpID,
+			UserVerification: "preferred",
+			AllowCredentials: newWebAuthnCredDescriptors(l.credIDs),
+			Timeout:          webAuthnTimeout.Milliseconds(),
+		}
+	}
+
+	setNoCacheHeaders(w)
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleLoginMFA is the handler for the POST /control/login/mfa HTTP API.
+func handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	req := &mfaLoginReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	remoteIP, err := netutil.SplitHost(r.RemoteAddr)
+	if err != nil {
+		writeErrorWithIP(
+			r,
+			w,
+			http.StatusBadRequest,
+			r.RemoteAddr,
+			"auth: getting remote address: %s",
+			err,
+		)
+
+		return
+	}
+
+	rateLimiter := globalContext.auth.rateLimiter
+	if rateLimiter != nil {
+		if left := rateLimiter.check(remoteIP); left > 0 {
+			w.Header().Set(httphdr.RetryAfter, strconv.Itoa(int(left.Seconds())))
+			writeErrorWithIP(r, w, http.StatusTooManyRequests, remoteIP, "auth: blocked for %s", left)
+
+			return
+		}
+	}
+
+	name, err := globalContext.auth.finishMFALogin(req, time.Now())
+	if err != nil {
+		if rateLimiter != nil {
+			rateLimiter.inc(remoteIP)
+		}
+
+		writeErrorWithIP(r, w, http.StatusForbidden, remoteIP, "auth: second factor: %s", err)
+
+		return
+	}
+
+	if rateLimiter != nil {
+		rateLimiter.remove(remoteIP)
+	}
+
+	log.Info("auth: user %q passed second factor from ip %s", name, remoteIP)
+
+	cookie, err := globalContext.auth.newSessionCookie(r.Context(), name, newSessionClient(r))
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "auth: %s", err)
+
+		return
+	}
+
+	http.SetCookie(w, cookie)
+	setNoCacheHeaders(w)
+	aghhttp.OK(w)
+}
+
+// registerMFAHandlers registers the HTTP API handlers for managing the second
+// factors of the current user.
+func registerMFAHandlers() {
+	globalContext.mux.Handle(
+		"/control/login/mfa",
+		postInstallHandler(ensureHandler(http.MethodPost, handleLoginMFA)),
+	)
+
+	httpRegister(http.MethodGet, "/control/mfa/status", handleMFAStatus)
+	httpRegister(http.MethodPost, "/control/mfa/totp/setup", handleMFATOTPSetup)
+	httpRegister(http.MethodPost, "/control/mfa/totp/enable", handleMFATOTPEnable)
+	httpRegister(http.MethodPost, "/control/mfa/totp/disable", handleMFATOTPDisable)
+	httpRegister(http.MethodPost, "/control/mfa/webauthn/register/begin", handleMFAWebAuthnBegin)
+	httpRegister(http.MethodPost, "/control/mfa/webauthn/register/finish", handleMFAWebAuthnFinish)
+	httpRegister(http.MethodPost, "/control/mfa/webauthn/delete", handleMFAWebAuthnDelete)
+	httpRegister(http.MethodPost, "/control/mfa/recovery_codes", handleMFARecoveryCodes)
+}
+
+// mfaUser returns the user of r that manages the second factors.  If there is
+// none, or the request is authenticated with an API token, mfaUser writes an
+// error and returns nil.
+func mfaUser(w http.ResponseWriter, r *http.Request) (u *webUser) {
+	if rejectAPITokenAuth(w, r) {
+		return nil
+	}
+
+	u, ok := authUserFromContext(r.Context())
+	if !ok || globalContext.auth == nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "second factors require authentication")
+
+		return nil
+	} else if u.external {
+		aghhttp.Error(
+			r,
+			w,
+			http.StatusBadRequest,
+			"second factors of external users are managed by their identity provider",
+		)
+
+		return nil
+	}
+
+	return u
+}
+
+// mfaStatusJSON is the response to the GET /control/mfa/status HTTP API.
+type mfaStatusJSON struct {
+	WebAuthnCredentials []*webAuthnCredentialJSON `json:"webauthn_credentials"`
+	RecoveryCodesLeft   int                       `json:"recovery_codes_left"`
+	TOTPEnabled         bool                      `json:"totp_enabled"`
+}
+
+// webAuthnCredentialJSON is the information about a WebAuthn credential.
+type webAuthnCredentialJSON struct {
+	// LastUsed is nil if the credential has never been used.
+	LastUsed *time.Time `json:"last_used,omitempty"`
+
+	Created time.Time `json:"created"`
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	RPID    string    `json:"rp_id"`
+}
+
+// handleMFAStatus is the handler for the GET /control/mfa/status HTTP API.
+func handleMFAStatus(w http.ResponseWriter, r *http.Request) {
+	u := mfaUser(w, r)
+	if u == nil {
+		return
+	}
+
+	m := globalContext.auth.userMFAStatus(u.Name)
+	resp := &mfaStatusJSON{
+		WebAuthnCredentials: make([]*webAuthnCredentialJSON, 0, len(m.WebAuthn)),
+		RecoveryCodesLeft:   len(m.RecoveryCodes),
+		TOTPEnabled:         len(m.TOTPSecret) > 0,
+	}
+
+	for _, c := range m.WebAuthn {
+		cj := &webAuthnCredentialJSON{
+			Created: c.Created,
+			ID:      encodeBase64URL(c.ID),
+			Name:    c.Name,
+			RPID:    c.RPID,
+		}
+
+		if !c.LastUsed.IsZero() {
+			cj.LastUsed = &c.LastUsed
+		}
+
+		resp.WebAuthnCredentials = append(resp.WebAuthnCredentials, cj)
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// mfaTOTPSetupJSON is the response to the POST /control/mfa/totp/setup HTTP
+// API.
+type mfaTOTPSetupJSON struct {
+	// Secret is the base32-encoded secret for entering manually.
+	Secret string `json:"secret"`
+
+	// URI is the otpauth URI for the QR code.
+	URI string `json:"uri"`
+}
+
+// handleMFATOTPSetup is the handler for the POST /control/mfa/totp/setup HTTP
+// API.
+func handleMFATOTPSetup(w http.ResponseWriter, r *http.Request) {
+	u := mfaUser(w, r)
+	if u == nil {
+		return
+	}
+
+	secret := globalContext.auth.beginTOTPSetup(u.Name, time.Now())
+
+	setNoCacheHeaders(w)
+	aghhttp.WriteJSONResponseOK(w, r, &mfaTOTPSetupJSON{
+		Secret: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret),
+		URI:    aghuser.TOTPURI(mfaTOTPIssuer, u.Name, secret),
+	})
+}
+
+// mfaCodeReq is the request with a TOTP code.
+type mfaCodeReq struct {
+	Code string `json:"code"`
+}
+
+// recoveryCodesJSON is the response with the new recovery codes.  It's the
+// only place where they are shown.
+type recoveryCodesJSON struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// writeRecoveryCodes writes codes as the response.
+func writeRecoveryCodes(w http.ResponseWriter, r *http.Request, codes []string) {
+	if codes == nil {
+		codes = []string{}
+	}
+
+	setNoCacheHeaders(w)
+	aghhttp.WriteJSONResponseOK(w, r, &recoveryCodesJSON{
+		RecoveryCodes: codes,
+	})
+}
+
+// handleMFATOTPEnable is the handler for the POST /control/mfa/totp/enable HTTP
+// API.
+func handleMFATOTPEnable(w http.ResponseWriter, r *http.Request) {
+	u := mfaUser(w, r)
+	if u == nil {
+		return
+	}
+
+	req := &mfaCodeReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	codes, err := globalContext.auth.enableTOTP(u.Name, req.Code, time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "enabling totp: %s", err)
+
+		return
+	}
+
+	writeRecoveryCodes(w, r, codes)
+}
+
+// handleMFATOTPDisable is the handler for the POST /control/mfa/totp/disable
+// HTTP API.
+func handleMFATOTPDisable(w http.ResponseWriter, r *http.Request) {
+	u := mfaUser(w, r)
+	if u == nil {
+		return
+	}
+
+	err := globalContext.auth.disableTOTP(u.Name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "disabling totp: %s", err)
+
+		return
+	}
+
+	aghhttp.OK(w)
+}
+
+// handleMFAWebAuthnBegin is the handler for the POST
+// /control/mfa/webauthn/register/begin HTTP API.
+func handleMFAWebAuthnBegin(w http.ResponseWriter, r *http.Request) {
+	u := mfaUser(w, r)
+	if u == nil {
+		return
+	}
+
+	rpID, err := webAuthnRPID(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	challenge, excludeIDs := globalContext.auth.beginWebAuthnRegistration(u.Name, rpID, time.Now())
+
+	params := make([]*webAuthnPubKeyCredParamsJSON, 0, len(webauthn.SupportedAlgorithms))
+	for _, alg := range webauthn.SupportedAlgorithms {
+		params = append(params, &webAuthnPubKeyCredParamsJSON{
+			Type: "public-key",
+			Alg:  alg,
+		})
+	}
+
+	// Use a hash of the name as the user handle, since the handle must not
+	// contain personal information.
+	userID := sha256.Sum256([]byte(u.Name))
+
+	setNoCacheHeaders(w)
+	aghhttp.WriteJSONResponseOK(w, r, &webAuthnCreationOptionsJSON{
+		RP: &webAuthnRPJSON{
+			ID:   rpID,
+			Name: mfaTOTPIssuer,
+		},
+		User: &webAuthnUserJSON{
+			ID:          encodeBase64URL(userID[:16]),
+			Name:        u.Name,
+			DisplayName: u.Name,
+		},
+		AuthenticatorSelection: &webAuthnAuthSelectionJSON{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Challenge:          encodeBase64URL(challenge),
+		Attestation:        "none",
+		PubKeyCredParams:   params,
+		ExcludeCredentials: newWebAuthnCredDescriptors(excludeIDs),
+		Timeout:            webAuthnTimeout.Milliseconds(),
+	})
+}
+
+// webAuthnRegistrationReq is the request to the POST
+// /control/mfa/webauthn/register/finish HTTP API.  Binary values are
+// base64url-encoded.
+type webAuthnRegistrationReq struct {
+	Name              string `json:"name"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AttestationObject string `json:"attestation_object"`
+}
+
+// handleMFAWebAuthnFinish is the handler for the POST
+// /control/mfa/webauthn/register/finish HTTP API.
+func handleMFAWebAuthnFinish(w http.ResponseWriter, r *http.Request) {
+	u := mfaUser(w, r)
+	if u == nil {
+		return
+	}
+
+	req := &webAuthnRegistrationReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	clientData, errCD := decodeBase64URL(req.ClientDataJSON)
+	attObj, errAO := decodeBase64URL(req.AttestationObject)
+	err = errors.Join(
+		errors.Annotate(errCD, "client_data_json: %w"),
+		errors.Annotate(errAO, "attestation_object: %w"),
+	)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Security key"
+	}
+
+	codes, err := globalContext.auth.finishWebAuthnRegistration(
+		u.Name,
+		name,
+		clientData,
+		attObj,
+		time.Now(),
+	)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "registering webauthn credential: %s", err)
+
+		return
+	}
+
+	writeRecoveryCodes(w, r, codes)
+}
+
+// webAuthnDeleteReq is the request to the POST /control/mfa/webauthn/delete
+// HTTP API.
+type webAuthnDeleteReq struct {
+	ID string `json:"id"`
+}
+
+// handleMFAWebAuthnDelete is the handler for the POST
+// /control/mfa/webauthn/delete HTTP API.
+func handleMFAWebAuthnDelete(w http.ResponseWriter, r *http.Request) {
+	u := mfaUser(w, r)
+	if u == nil {
+		return
+	}
+
+	req := &webAuthnDeleteReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	id, err := decodeBase64URL(req.ID)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "id: %s", err)
+
+		return
+	}
+
+	ok, err := globalContext.auth.removeWebAuthnCredential(u.Name, id)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "removing credential: %s", err)
+
+		return
+	} else if !ok {
+		aghhttp.Error(r, w, http.StatusBadRequest, "credential %q not found", req.ID)
+
+		return
+	}
+
+	aghhttp.OK(w)
+}
+
+// handleMFARecoveryCodes is the handler for the POST
+// /control/mfa/recovery_codes HTTP API.
+func handleMFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	u := mfaUser(w, r)
+	if u == nil {
+		return
+	}
+
+	codes, err := globalContext.auth.regenerateRecoveryCodes(u.Name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "generating recovery codes: %s", err)
+
+		return
+	}
+
+	writeRecoveryCodes(w, r, codes)
+}
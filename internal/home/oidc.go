@@ -0,0 +1,556 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/oidc"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/validate"
+	"go.etcd.io/bbolt"
+)
+
+// Default claim names used for mapping the users of the identity provider.
+const (
+	defaultOIDCUsernameClaim = "preferred_username"
+	defaultOIDCGroupsClaim   = "groups"
+)
+
+// OpenID Connect login parameters.
+const (
+	// oidcStateCookieName is the name of the cookie binding the login to the
+	// browser that has started it.
+	oidcStateCookieName = "agh_oidc_state"
+
+	// oidcLoginTTL is the time a started login is valid for.
+	oidcLoginTTL = 10 * time.Minute
+
+	// oidcMaxPendingLogins is the maximum number of the started logins, so
+	// that unauthenticated requests can't exhaust the memory.
+	oidcMaxPendingLogins = 1024
+
+	// oidcMaxUsernameLen is the maximum length of the user name taken from the
+	// claims.
+	oidcMaxUsernameLen = 128
+)
+
+// oidcConfig is the configuration of the OpenID Connect single sign-on into
+// the web UI.
+type oidcConfig struct {
+	// Issuer is the URL of the identity provider.  It must use HTTPS.
+	Issuer string `yaml:"issuer"`
+
+	// ClientID is the ID of the client registered at the identity provider.
+	ClientID string `yaml:"client_id"`
+
+	// ClientSecret is the secret of the client.  It may be empty for public
+	// clients.
+	ClientSecret string `yaml:"client_secret"`
+
+	// RedirectURL is the URL of the GET /control/oidc/callback handler as
+	// registered at the identity provider.
+	RedirectURL string `yaml:"redirect_url"`
+
+	// UsernameClaim is the claim containing the name of the user.
+	UsernameClaim string `yaml:"username_claim"`
+
+	// GroupsClaim is the claim containing the groups of the user.
+	GroupsClaim string `yaml:"groups_claim"`
+
+	// DefaultRole is the role of the users not matched by RoleMappings.  If
+	// it's empty, such users aren't allowed to log in.
+	DefaultRole aghuser.Role `yaml:"default_role"`
+
+	// Scopes are the requested scopes.  If empty, [oidc.DefaultScopes] are
+	// used.
+	Scopes []string `yaml:"scopes"`
+
+	// RoleMappings map the groups of the users to the roles.  The first
+	// matching mapping is used.
+	RoleMappings []*roleMapping `yaml:"role_mappings"`
+
+	// Enabled defines if the single sign-on is enabled.
+	Enabled bool `yaml:"enabled"`
+
+	// LinkLocalUsers defines if the users of the identity provider may log in
+	// as the local users with the same names.  Otherwise, such logins are
+	// rejected.
+	LinkLocalUsers bool `yaml:"link_local_users"`
+}
+
+// type check
+var _ validate.Interface = (*oidcConfig)(nil)
+
+// Validate implements the [validate.Interface] interface for *oidcConfig.
+func (c *oidcConfig) Validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	errs := []error{
+		validate.NotEmpty("client_id", c.ClientID),
+	}
+
+	issuer, err := url.Parse(c.Issuer)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("issuer: %w", err))
+	} else if issuer.Scheme != "https" || issuer.Host == "" {
+		errs = append(errs, fmt.Errorf("issuer: %q is not an https url", c.Issuer))
+	}
+
+	redir, err := url.Parse(c.RedirectURL)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("redirect_url: %w", err))
+	} else if !redir.IsAbs() || redir.Host == "" {
+		errs = append(errs, fmt.Errorf("redirect_url: %q is not an absolute url", c.RedirectURL))
+	}
+
+	errs = append(errs, validateRoleMappings(c.DefaultRole, c.RoleMappings)...)
+
+	return errors.Annotate(errors.Join(errs...), "oidc: %w")
+}
+
+// usernameClaim returns the configured username claim or the default one.
+func (c *oidcConfig) usernameClaim() (name string) {
+	if c.UsernameClaim != "" {
+		return c.UsernameClaim
+	}
+
+	return defaultOIDCUsernameClaim
+}
+
+// groupsClaim returns the configured groups claim or the default one.
+func (c *oidcConfig) groupsClaim() (name string) {
+	if c.GroupsClaim != "" {
+		return c.GroupsClaim
+	}
+
+	return defaultOIDCGroupsClaim
+}
+
+// role returns the role for the user with groups.  ok is false if the user is
+// not allowed to log in.
+func (c *oidcConfig) role(groups []string) (r aghuser.Role, ok bool) {
+	return mappedRole(groups, c.DefaultRole, c.RoleMappings)
+}
+
+// oidcProvider is the interface for the OpenID Connect identity provider.  It
+// is implemented by [*oidc.Provider].
+type oidcProvider interface {
+	// AuthURL returns the URL of the authorization endpoint to redirect the
+	// user to.
+	AuthURL(ctx context.Context, redirectURL, state, nonce, verifier string) (u string, err error)
+
+	// Exchange exchanges the authorization code for the raw ID token.
+	Exchange(ctx context.Context, code, redirectURL, verifier string) (rawIDToken string, err error)
+
+	// VerifyIDToken verifies the raw ID token and returns its claims.
+	VerifyIDToken(
+		ctx context.Context,
+		raw string,
+		nonce string,
+		now time.Time,
+	) (c oidc.Claims, err error)
+}
+
+// type check
+var _ oidcProvider = (*oidc.Provider)(nil)
+
+// oidcLogin is a started OpenID Connect login.
+type oidcLogin struct {
+	expires  time.Time
+	nonce    string
+	verifier string
+}
+
+// oidcAuth is the OpenID Connect single sign-on state of [Auth].
+type oidcAuth struct {
+	conf     *oidcConfig
+	provider oidcProvider
+
+	// mu protects logins.
+	mu *sync.Mutex
+
+	// logins are the started logins by their states.
+	logins map[string]*oidcLogin
+}
+
+// newOIDCAuth returns a new *oidcAuth for c or nil if the single sign-on is
+// disabled.  c must be valid.
+func newOIDCAuth(baseLogger *slog.Logger, c *oidcConfig, cli *http.Client) (o *oidcAuth) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	// The URL has been validated.
+	issuer, _ := url.Parse(c.Issuer)
+
+	return &oidcAuth{
+		conf: c,
+		provider: oidc.New(&oidc.Config{
+			Logger:       baseLogger.With(slogutil.KeyPrefix, "oidc"),
+			HTTPClient:   cli,
+			Issuer:       issuer,
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			Scopes:       c.Scopes,
+		}),
+		mu:     &sync.Mutex{},
+		logins: map[string]*oidcLogin{},
+	}
+}
+
+// start starts a new login and returns its state and the URL to redirect the
+// user to.
+func (o *oidcAuth) start(ctx context.Context, now time.Time) (state, u string, err error) {
+	l := &oidcLogin{
+		expires:  now.Add(oidcLoginTTL),
+		nonce:    oidc.RandomString(),
+		verifier: oidc.RandomString(),
+	}
+
+	state = oidc.RandomString()
+	u, err = o.provider.AuthURL(ctx, o.conf.RedirectURL, state, l.nonce, l.verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for s, pending := range o.logins {
+		if !now.Before(pending.expires) {
+			delete(o.logins, s)
+		}
+	}
+
+	if len(o.logins) >= oidcMaxPendingLogins {
+		return "", "", errors.Error("too many pending logins")
+	}
+
+	o.logins[state] = l
+
+	return state, u, nil
+}
+
+// finish finishes the login with state using the authorization code and
+// returns the verified claims of the user.
+func (o *oidcAuth) finish(
+	ctx context.Context,
+	state string,
+	code string,
+	now time.Time,
+) (c oidc.Claims, err error) {
+	o.mu.Lock()
+	l, ok := o.logins[state]
+	delete(o.logins, state)
+	o.mu.Unlock()
+
+	if !ok || !now.Before(l.expires) {
+		return nil, errors.Error("login expired, try again")
+	}
+
+	raw, err := o.provider.Exchange(ctx, code, o.conf.RedirectURL, l.verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.provider.VerifyIDToken(ctx, raw, l.nonce, now)
+}
+
+// oidcUserData is the stored information about a user provisioned by the
+// identity provider.
+type oidcUserData struct {
+	LastLogin time.Time    `json:"last_login"`
+	Subject   string       `json:"sub"`
+	Role      aghuser.Role `json:"role"`
+}
+
+// oidcUsersBucketName returns the name of the bucket with the users
+// provisioned by the identity provider.
+func oidcUsersBucketName() (b []byte) {
+	return []byte("oidc_users")
+}
+
+// setOIDC enables the single sign-on using o and loads the users provisioned
+// by the identity provider.  o may be nil, in which case the single sign-on is
+// disabled.
+func (a *Auth) setOIDC(ctx context.Context, o *oidcAuth) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.oidc = o
+	if o == nil {
+		return
+	}
+
+	n := 0
+	err := a.db.View(func(tx *bbolt.Tx) (err error) {
+		bkt := tx.Bucket(oidcUsersBucketName())
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(k, v []byte) (err error) {
+			d := &oidcUserData{}
+			err = json.Unmarshal(v, d)
+			if err != nil {
+				log.Error("auth: decoding oidc user %q: %s", k, err)
+
+				return nil
+			}
+
+			name := string(k)
+			if a.localUser(ctx, name) != nil {
+				// A local user with the same name has been added since.
+				return nil
+			}
+
+			err = a.createUser(ctx, &webUser{Name: name, Role: d.Role, external: true})
+			if err != nil {
+				log.Error("auth: adding oidc user %q: %s", k, err)
+
+				return nil
+			}
+
+			n++
+
+			return nil
+		})
+	})
+	if err != nil {
+		log.Error("auth: loading oidc users: %s", err)
+	}
+
+	log.Debug("auth: loaded %d oidc users from DB", n)
+}
+
+// oidcEnabled returns true if the single sign-on is enabled.
+func (a *Auth) oidcEnabled() (ok bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.oidc != nil
+}
+
+// loginOIDCUser maps the verified claims of a user of the identity provider
+// to a web user, provisioning it if necessary, and returns its name.
+func (a *Auth) loginOIDCUser(
+	ctx context.Context,
+	c oidc.Claims,
+	now time.Time,
+) (name string, err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	conf := a.oidc.conf
+
+	claim := conf.usernameClaim()
+	name = c.String(claim)
+	if name == "" {
+		return "", fmt.Errorf("no %q claim", claim)
+	} else if len(name) > oidcMaxUsernameLen {
+		return "", fmt.Errorf("%q claim is too long", claim)
+	}
+
+	local := a.localUser(ctx, name)
+	if local != nil && !local.External {
+		if !conf.LinkLocalUsers {
+			return "", fmt.Errorf("user %q is a local user", name)
+		}
+
+		// The role of the linked local user is defined by the configuration
+		// file.
+		return name, nil
+	}
+
+	role, ok := conf.role(c.Strings(conf.groupsClaim()))
+	if !ok {
+		return "", fmt.Errorf("user %q has no role", name)
+	}
+
+	d := &oidcUserData{
+		LastLogin: now,
+		Subject:   c.Subject(),
+		Role:      role,
+	}
+
+	err = a.storeOIDCUser(name, d)
+	if err != nil {
+		return "", err
+	}
+
+	if local == nil {
+		err = a.createUser(ctx, &webUser{Name: name, Role: role, external: true})
+	} else {
+		upd := local.Clone()
+		upd.Role = role
+		err = a.users.Update(ctx, upd)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("provisioning user %q: %w", name, err)
+	}
+
+	return name, nil
+}
+
+// storeOIDCUser saves the data of the user provisioned by the identity
+// provider to the database file.  It returns an error if the user with name
+// belongs to another subject.  a.lock is expected to be locked.
+func (a *Auth) storeOIDCUser(name string, d *oidcUserData) (err error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("encoding oidc user: %w", err)
+	}
+
+	err = a.db.Update(func(tx *bbolt.Tx) (err error) {
+		bkt, err := tx.CreateBucketIfNotExists(oidcUsersBucketName())
+		if err != nil {
+			return fmt.Errorf("creating bucket: %w", err)
+		}
+
+		if prevData := bkt.Get([]byte(name)); prevData != nil {
+			prev := &oidcUserData{}
+			err = json.Unmarshal(prevData, prev)
+			if err == nil && prev.Subject != d.Subject {
+				return fmt.Errorf("user %q belongs to another subject", name)
+			}
+		}
+
+		return bkt.Put([]byte(name), data)
+	})
+	if err != nil {
+		return fmt.Errorf("storing oidc user: %w", err)
+	}
+
+	return nil
+}
+
+// registerOIDCHandlers registers the HTTP handlers of the single sign-on.
+// They are available without authentication.
+func registerOIDCHandlers() {
+	globalContext.mux.Handle(
+		"/control/oidc/login",
+		postInstallHandler(ensureHandler(http.MethodGet, handleOIDCLogin)),
+	)
+	globalContext.mux.Handle(
+		"/control/oidc/callback",
+		postInstallHandler(ensureHandler(http.MethodGet, handleOIDCCallback)),
+	)
+}
+
+// handleOIDCLogin is the handler for the GET /control/oidc/login HTTP API.  It
+// redirects the user to the identity provider.
+func handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	a := globalContext.auth
+	if a == nil || !a.oidcEnabled() {
+		aghhttp.Error(r, w, http.StatusNotFound, "single sign-on is disabled")
+
+		return
+	}
+
+	state, u, err := a.oidc.start(r.Context(), time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusServiceUnavailable, "starting single sign-on: %s", err)
+
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     "/control/oidc/",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Lax is required, since the callback is a cross-site navigation
+		// from the identity provider.
+		SameSite: http.SameSiteLaxMode,
+	})
+	setNoCacheHeaders(w)
+
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// handleOIDCCallback is the handler for the GET /control/oidc/callback HTTP
+// API.  It finishes the login started by [handleOIDCLogin] and creates the
+// session.
+func handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	a := globalContext.auth
+	if a == nil || !a.oidcEnabled() {
+		aghhttp.Error(r, w, http.StatusNotFound, "single sign-on is disabled")
+
+		return
+	}
+
+	// Remove the state cookie in any case.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Path:     "/control/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	setNoCacheHeaders(w)
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		aghhttp.Error(r, w, http.StatusForbidden, "identity provider: %s: %s", e, q.Get("error_description"))
+
+		return
+	}
+
+	state := q.Get("state")
+	c, err := r.Cookie(oidcStateCookieName)
+	if err != nil || state == "" || c.Value != state {
+		aghhttp.Error(r, w, http.StatusBadRequest, "single sign-on state mismatch, try again")
+
+		return
+	}
+
+	now := time.Now()
+	claims, err := a.oidc.finish(r.Context(), state, q.Get("code"), now)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusForbidden, "single sign-on: %s", err)
+
+		return
+	}
+
+	name, err := a.loginOIDCUser(r.Context(), claims, now)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusForbidden, "single sign-on: %s", err)
+
+		return
+	}
+
+	ip, err := requestIP(r)
+	if err != nil {
+		log.Debug("auth: getting ip of oidc login: %s", err)
+	}
+
+	log.Info("auth: user %q successfully logged in with single sign-on from ip %s", name, ip)
+
+	// The identity provider is responsible for the second factors of its
+	// users, so the local ones aren't requested.
+	cookie, err := a.newSessionCookie(r.Context(), name, newSessionClient(r))
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "auth: oidc: %s", err)
+
+		return
+	}
+
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,292 @@
+package home
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/oidc"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOIDCProvider is a fake [oidcProvider] for tests.
+type fakeOIDCProvider struct {
+	// claims are returned from VerifyIDToken.
+	claims oidc.Claims
+}
+
+// type check
+var _ oidcProvider = (*fakeOIDCProvider)(nil)
+
+// AuthURL implements the [oidcProvider] interface for *fakeOIDCProvider.
+func (p *fakeOIDCProvider) AuthURL(
+	_ context.Context,
+	redirectURL string,
+	state string,
+	nonce string,
+	verifier string,
+) (u string, err error) {
+	q := url.Values{
+		"redirect_uri": {redirectURL},
+		"state":        {state},
+		"nonce":        {nonce},
+	}
+
+	return "https://idp.example/authorize?" + q.Encode(), nil
+}
+
+// Exchange implements the [oidcProvider] interface for *fakeOIDCProvider.
+func (p *fakeOIDCProvider) Exchange(
+	_ context.Context,
+	code string,
+	_ string,
+	_ string,
+) (rawIDToken string, err error) {
+	return code, nil
+}
+
+// VerifyIDToken implements the [oidcProvider] interface for
+// *fakeOIDCProvider.
+func (p *fakeOIDCProvider) VerifyIDToken(
+	_ context.Context,
+	_ string,
+	_ string,
+	_ time.Time,
+) (c oidc.Claims, err error) {
+	return p.claims, nil
+}
+
+// newTestOIDCAuth returns a new *oidcAuth with a fake provider returning
+// claims.
+func newTestOIDCAuth(conf *oidcConfig, claims oidc.Claims) (o *oidcAuth) {
+	return &oidcAuth{
+		conf:     conf,
+		provider: &fakeOIDCProvider{claims: claims},
+		mu:       &sync.Mutex{},
+		logins:   map[string]*oidcLogin{},
+	}
+}
+
+func TestOIDCConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *oidcConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf: &oidcConfig{
+			Issuer:      "https://idp.example",
+			ClientID:    "nullprivate",
+			RedirectURL: "https://dns.example/control/oidc/callback",
+			DefaultRole: aghuser.RoleReadOnly,
+			RoleMappings: []*roleMapping{{
+				Group: "admins",
+				Role:  aghuser.RoleAdmin,
+			}},
+			Enabled: true,
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &oidcConfig{
+			Issuer:      "http://idp.example",
+			RedirectURL: "/control/oidc/callback",
+			RoleMappings: []*roleMapping{{
+				Group: "admins",
+			}, {
+				Group: "parents",
+				Role:  aghuser.RoleParent,
+			}},
+			Enabled: true,
+		},
+		name: "invalid",
+		wantErrMsg: "oidc: client_id: empty value\n" +
+			`issuer: "http://idp.example" is not an https url` + "\n" +
+			`redirect_url: "/control/oidc/callback" is not an absolute url` + "\n" +
+			"role_mappings: at index 0: role: empty value\n" +
+			`role_mappings: at index 1: role: role "parent" requires clients and can't be mapped`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.Validate())
+		})
+	}
+}
+
+func TestHandleOIDCCallback(t *testing.T) {
+	storeGlobals(t)
+
+	users := []webUser{{
+		Name:         "local",
+		PasswordHash: "$2y$05$..vyzAECIhJPfaQiOK17IukcQnqEgKJHy0iETyYqxn3YXJl8yZuo2",
+	}}
+
+	fn := filepath.Join(t.TempDir(), "sessions.db")
+	a := InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		fn,
+		users,
+		60,
+		nil,
+		netutil.SliceSubnetSet(nil),
+	)
+	require.NotNil(t, a)
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		a.Close()
+
+		return nil
+	})
+
+	globalContext.auth = a
+
+	conf := &oidcConfig{
+		RedirectURL: "https://dns.example/control/oidc/callback",
+		RoleMappings: []*roleMapping{{
+			Group: "admins",
+			Role:  aghuser.RoleOperator,
+		}},
+		Enabled: true,
+	}
+
+	claims := oidc.Claims{
+		"sub":                "subject-1",
+		"preferred_username": "alice",
+		"groups":             []any{"users", "admins"},
+	}
+
+	a.setOIDC(testutil.ContextWithTimeout(t, testTimeout), newTestOIDCAuth(conf, claims))
+
+	login := func(t *testing.T) (w *httptest.ResponseRecorder) {
+		t.Helper()
+
+		lw := httptest.NewRecorder()
+		handleOIDCLogin(lw, httptest.NewRequest(http.MethodGet, "/control/oidc/login", nil))
+		require.Equal(t, http.StatusFound, lw.Code)
+
+		loc, err := url.Parse(lw.Header().Get("Location"))
+		require.NoError(t, err)
+
+		state := loc.Query().Get("state")
+		require.NotEmpty(t, state)
+
+		r := httptest.NewRequest(
+			http.MethodGet,
+			"/control/oidc/callback?code=code&state="+url.QueryEscape(state),
+			nil,
+		)
+		for _, c := range lw.Result().Cookies() {
+			r.AddCookie(c)
+		}
+
+		w = httptest.NewRecorder()
+		handleOIDCCallback(w, r)
+
+		return w
+	}
+
+	t.Run("provisioned", func(t *testing.T) {
+		w := login(t)
+		require.Equal(t, http.StatusFound, w.Code)
+
+		var sess *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == sessionCookieName {
+				sess = c
+			}
+		}
+
+		require.NotNil(t, sess)
+
+		r := httptest.NewRequest(http.MethodGet, "/control/status", nil)
+		r.AddCookie(sess)
+
+		u := a.getCurrentUser(r)
+		assert.Equal(t, "alice", u.Name)
+		assert.Equal(t, aghuser.RoleOperator, u.Role)
+		assert.True(t, u.external)
+
+		assert.Equal(t, users, a.usersList())
+
+		_, ok := a.findUser(testutil.ContextWithTimeout(t, testTimeout), "alice", "")
+		assert.False(t, ok)
+	})
+
+	t.Run("no_role", func(t *testing.T) {
+		claims["groups"] = []any{"users"}
+		t.Cleanup(func() { claims["groups"] = []any{"users", "admins"} })
+
+		w := login(t)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("other_subject", func(t *testing.T) {
+		claims["sub"] = "subject-2"
+		t.Cleanup(func() { claims["sub"] = "subject-1" })
+
+		w := login(t)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("local_user", func(t *testing.T) {
+		claims["preferred_username"] = "local"
+		t.Cleanup(func() { claims["preferred_username"] = "alice" })
+
+		w := login(t)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		conf.LinkLocalUsers = true
+		t.Cleanup(func() { conf.LinkLocalUsers = false })
+
+		w = login(t)
+		assert.Equal(t, http.StatusFound, w.Code)
+	})
+
+	t.Run("state_mismatch", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/control/oidc/callback?code=code&state=abc", nil)
+		r.AddCookie(&http.Cookie{Name: oidcStateCookieName, Value: "def"})
+
+		w := httptest.NewRecorder()
+		handleOIDCCallback(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		a.Close()
+
+		reloaded := InitAuth(
+			testutil.ContextWithTimeout(t, testTimeout),
+			testLogger,
+			fn,
+			users,
+			60,
+			nil,
+			netutil.SliceSubnetSet(nil),
+		)
+		require.NotNil(t, reloaded)
+
+		a = reloaded
+		globalContext.auth = a
+
+		a.setOIDC(testutil.ContextWithTimeout(t, testTimeout), newTestOIDCAuth(conf, claims))
+
+		all, err := a.users.All(testutil.ContextWithTimeout(t, testTimeout))
+		require.NoError(t, err)
+
+		assert.Len(t, all, 2)
+		assert.Equal(t, users, a.usersList())
+	})
+}
@@ -80,6 +80,14 @@ type options struct {
 	// rather than the ones that have been compiled into the binary.
 	localFrontend bool
 
+	// importDHCPLeases is the format and the path of the file to import the
+	// DHCP static leases from, in the "format:path" form.
+	importDHCPLeases string
+
+	// exportDHCPLeases is the format and the path of the file to export the
+	// DHCP static leases to, in the "format:path" form.
+	exportDHCPLeases string
+
 	// noPermCheck disables checking and migration of permissions for the
 	// security-sensitive files.
 	noPermCheck bool
@@ -319,6 +327,34 @@ var cmdLineOpts = []cmdLineOpt{{
 		"of security-sensitive files.",
 	longName:  "no-permcheck",
 	shortName: "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) {
+		_, _, err := parseDHCPLeasesArg(v)
+		o.importDHCPLeases = v
+
+		return o, err
+	},
+	updateNoValue: nil,
+	effect:        nil,
+	serialize:     func(o options) (val string, ok bool) { return "", false },
+	description: "Import DHCP static leases from the file in the format:path form, " +
+		"where format is one of dnsmasq, isc, or kea, and exit.  Use - as path for stdin.",
+	longName:  "import-dhcp-leases",
+	shortName: "",
+}, {
+	updateWithValue: func(o options, v string) (options, error) {
+		_, _, err := parseDHCPLeasesArg(v)
+		o.exportDHCPLeases = v
+
+		return o, err
+	},
+	updateNoValue: nil,
+	effect:        nil,
+	serialize:     func(o options) (val string, ok bool) { return "", false },
+	description: "Export DHCP static leases to the file in the format:path form, " +
+		"where format is one of dnsmasq, isc, or kea, and exit.  Use - as path for stdout.",
+	longName:  "export-dhcp-leases",
+	shortName: "",
 }, {
 	updateWithValue: nil,
 	updateNoValue:   nil,
@@ -145,6 +145,19 @@ func TestParseGLInet(t *testing.T) {
 	assert.True(t, testParseOK(t, "--glinet").glinetMode, "--glinet is GL-Inet mode")
 }
 
+func TestParseDHCPLeases(t *testing.T) {
+	assert.Equal(
+		t,
+		"kea:/etc/kea/kea-dhcp4.conf",
+		testParseOK(t, "--import-dhcp-leases", "kea:/etc/kea/kea-dhcp4.conf").importDHCPLeases,
+	)
+	assert.Equal(t, "dnsmasq:-", testParseOK(t, "--export-dhcp-leases", "dnsmasq:-").exportDHCPLeases)
+
+	testParseParamMissing(t, "--import-dhcp-leases")
+	testParseErr(t, "no path", "--import-dhcp-leases", "kea")
+	testParseErr(t, "bad format", "--export-dhcp-leases", "bind:/etc/named.conf")
+}
+
 func TestParseUnknown(t *testing.T) {
 	testParseErr(t, "unknown word", "x")
 	testParseErr(t, "unknown short", "-x")
@@ -0,0 +1,124 @@
+package home
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// controlPrefix is the common prefix of the HTTP API paths.
+const controlPrefix = "/control/"
+
+// routeAreas maps the first segments of the HTTP API paths to the areas in
+// cases where they differ.  The segments not listed here are used as the areas
+// as is.
+var routeAreas = map[string]aghuser.Area{
+	"access":            aghuser.AreaDNS,
+	"cache_clear":       aghuser.AreaDNS,
+	"check_host":        aghuser.AreaFiltering,
+	"dns_config":        aghuser.AreaDNS,
+	"dns_info":          aghuser.AreaDNS,
+	"dns_trace":         aghuser.AreaDNS,
+	"i18n":              aghuser.AreaProfile,
+	"mfa":               aghuser.AreaProfile,
+	"parental":          aghuser.AreaFiltering,
+	"querylog_clear":    aghuser.AreaQueryLog,
+	"querylog_config":   aghuser.AreaQueryLog,
+	"querylog_info":     aghuser.AreaQueryLog,
+	"safebrowsing":      aghuser.AreaFiltering,
+	"safesearch":        aghuser.AreaFiltering,
+	"service-type":      aghuser.AreaStatus,
+	"sessions":          aghuser.AreaProfile,
+	"stats_config":      aghuser.AreaStats,
+	"stats_info":        aghuser.AreaStats,
+	"stats_reset":       aghuser.AreaStats,
+	"test_upstream_dns": aghuser.AreaDNS,
+	"version.json":      aghuser.AreaStatus,
+}
+
+// readOnlyPOSTRoutes are the paths of the HTTP API handlers that use the POST
+// method but don't change anything.
+var readOnlyPOSTRoutes = []string{
+	"/control/clients/search",
+	"/control/version.json",
+}
+
+// routePermission returns the permission required to call the HTTP API handler
+// registered for method and path.  ok is false if the handler doesn't require
+// any permission, as is the case for logging out.
+func routePermission(method, path string) (p aghuser.Permission, ok bool) {
+	rest, ok := strings.CutPrefix(path, controlPrefix)
+	if !ok || rest == "logout" {
+		return "", false
+	}
+
+	seg, _, _ := strings.Cut(rest, "/")
+	area, ok := routeAreas[seg]
+	if !ok {
+		area = aghuser.Area(seg)
+	}
+
+	access := aghuser.AccessRead
+	if modifiesData(method) && !slices.Contains(readOnlyPOSTRoutes, path) {
+		access = aghuser.AccessWrite
+	}
+
+	return aghuser.NewPermission(area, access), true
+}
+
+// permissionHandler returns a handler that only calls h if the authenticated
+// user has the permission required for method and path and, if the request is
+// authenticated with an API token, the token has it in its scopes.  It must be
+// wrapped by the authentication handler.
+func permissionHandler(method, path string, h http.Handler) (wrapped http.Handler) {
+	perm, ok := routePermission(method, path)
+	if !ok {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// There is no user if the authentication isn't required or is handled
+		// by the GL.iNet submodule.
+		u, ok := authUserFromContext(r.Context())
+		if ok && !u.Role.Allows(perm) {
+			log.Info("auth: user %q with role %q: %s is not granted", u.Name, u.Role, perm)
+			aghhttp.Error(r, w, http.StatusForbidden, "permission %s is required", perm)
+
+			return
+		}
+
+		t, ok := apiTokenFromContext(r.Context())
+		if ok && !slices.Contains(t.Scopes, perm) {
+			log.Info("auth: api token %q: %s is not in scopes", t.Name, perm)
+			aghhttp.Error(r, w, http.StatusForbidden, "scope %s is required", perm)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// userCanManageClient returns true if the user of r may change the persistent
+// client with name.  Users with [aghuser.RoleParent] may only change the
+// clients listed in their configuration.
+func userCanManageClient(r *http.Request, name string) (ok bool) {
+	u, ok := authUserFromContext(r.Context())
+	if !ok || u.Role != aghuser.RoleParent {
+		return true
+	}
+
+	return slices.Contains(u.Clients, name)
+}
+
+// userManagesAllClients returns true if the user of r isn't limited to
+// particular persistent clients.
+func userManagesAllClients(r *http.Request) (ok bool) {
+	u, ok := authUserFromContext(r.Context())
+
+	return !ok || u.Role != aghuser.RoleParent
+}
@@ -0,0 +1,141 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutePermission(t *testing.T) {
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		want   aghuser.Permission
+		wantOK bool
+	}{{
+		name:   "read",
+		method: http.MethodGet,
+		path:   "/control/querylog",
+		want:   "querylog:read",
+		wantOK: true,
+	}, {
+		name:   "write",
+		method: http.MethodPost,
+		path:   "/control/rewrite/add",
+		want:   "rewrite:write",
+		wantOK: true,
+	}, {
+		name:   "mapped",
+		method: http.MethodPost,
+		path:   "/control/dns_config",
+		want:   "dns:write",
+		wantOK: true,
+	}, {
+		name:   "underscore",
+		method: http.MethodPost,
+		path:   "/control/stats_reset",
+		want:   "stats:write",
+		wantOK: true,
+	}, {
+		name:   "read_only_post",
+		method: http.MethodPost,
+		path:   "/control/clients/search",
+		want:   "clients:read",
+		wantOK: true,
+	}, {
+		name:   "unknown",
+		method: http.MethodPut,
+		path:   "/control/something/new",
+		want:   "something:write",
+		wantOK: true,
+	}, {
+		name:   "logout",
+		method: http.MethodGet,
+		path:   "/control/logout",
+		want:   "",
+		wantOK: false,
+	}, {
+		name:   "not_control",
+		method: "",
+		path:   "/dns-query",
+		want:   "",
+		wantOK: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, ok := routePermission(tc.method, tc.path)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.want, p)
+		})
+	}
+}
+
+func TestPermissionHandler(t *testing.T) {
+	const path = "/control/protection"
+
+	h := permissionHandler(
+		http.MethodPost,
+		path,
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	testCases := []struct {
+		user *webUser
+		name string
+		want int
+	}{{
+		user: nil,
+		name: "no_auth",
+		want: http.StatusOK,
+	}, {
+		user: &webUser{Name: "admin"},
+		name: "admin",
+		want: http.StatusOK,
+	}, {
+		user: &webUser{Name: "operator", Role: aghuser.RoleOperator},
+		name: "operator",
+		want: http.StatusOK,
+	}, {
+		user: &webUser{Name: "child", Role: aghuser.RoleParent},
+		name: "parent",
+		want: http.StatusForbidden,
+	}, {
+		user: &webUser{Name: "viewer", Role: aghuser.RoleReadOnly},
+		name: "read_only",
+		want: http.StatusForbidden,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, path, nil)
+			if tc.user != nil {
+				r = r.WithContext(withAuthUser(r.Context(), tc.user))
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+}
+
+func TestWebUser_Validate(t *testing.T) {
+	assert.NoError(t, (&webUser{Name: "a"}).Validate())
+	assert.NoError(t, (&webUser{
+		Name:    "a",
+		Role:    aghuser.RoleParent,
+		Clients: []string{"kid"},
+	}).Validate())
+
+	assert.Error(t, (&webUser{Name: "a", Role: "superuser"}).Validate())
+	assert.Error(t, (&webUser{Name: "a", Clients: []string{"kid"}}).Validate())
+	assert.Error(t, (&webUser{}).Validate())
+}
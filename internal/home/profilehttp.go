@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
 	"github.com/AdguardTeam/golibs/log"
 )
 
@@ -43,11 +44,21 @@ type profileJSON struct {
 	Name     string `json:"name"`
 	Language string `json:"language"`
 	Theme    Theme  `json:"theme"`
+
+	// Role is the role of the current user.  It's only used in responses.
+	Role aghuser.Role `json:"role,omitempty"`
+
+	// Permissions are the permissions granted by Role.  It's only used in
+	// responses and is empty for [aghuser.RoleAdmin].
+	Permissions []aghuser.Permission `json:"permissions,omitempty"`
 }
 
 // handleGetProfile is the handler for GET /control/profile endpoint.
 func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 	u := globalContext.auth.getCurrentUser(r)
+	if u.Role == "" {
+		u.Role = aghuser.RoleAdmin
+	}
 
 	var resp profileJSON
 	func() {
@@ -55,9 +66,11 @@ func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 		defer config.RUnlock()
 
 		resp = profileJSON{
-			Name:     u.Name,
-			Language: config.Language,
-			Theme:    config.Theme,
+			Name:        u.Name,
+			Language:    config.Language,
+			Theme:       config.Theme,
+			Role:        u.Role,
+			Permissions: u.Role.Permissions(),
 		}
 	}()
 
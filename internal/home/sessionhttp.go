@@ -0,0 +1,417 @@
+package home
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Session tracking parameters.
+const (
+	// sessionSeenUpdateIvl is the minimum interval between updates of the last
+	// seen time of a session, unless the client changes.
+	sessionSeenUpdateIvl = time.Minute
+
+	// maxUserAgentLen is the maximum length of the stored User-Agent.
+	maxUserAgentLen = 256
+
+	// sessionIDLen is the length of the public session ID in bytes.
+	sessionIDLen = 8
+)
+
+// sessionClient is the information about the client using a session.
+type sessionClient struct {
+	ip        netip.Addr
+	userAgent string
+}
+
+// newSessionClient returns the information about the client sending r.  r may
+// be nil.
+func newSessionClient(r *http.Request) (c *sessionClient) {
+	c = &sessionClient{}
+	if r == nil {
+		return c
+	}
+
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLen {
+		ua = ua[:maxUserAgentLen]
+	}
+
+	c.userAgent = ua
+	if globalContext.auth == nil {
+		return c
+	}
+
+	var err error
+	c.ip, err = requestIP(r)
+	if err != nil {
+		log.Debug("auth: getting session client ip: %s", err)
+	}
+
+	return c
+}
+
+// setSessionLimits sets the idle timeout of the sessions and the maximum
+// number of sessions of a single user.  Zero values disable the limits.
+func (a *Auth) setSessionLimits(idleTimeout time.Duration, maxSessions uint) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.sessionIdleTimeout = idleTimeout
+	a.maxSessions = maxSessions
+}
+
+// sessionLimits returns the idle timeout of the sessions and the maximum number
+// of sessions of a single user.
+func (a *Auth) sessionLimits() (idleTimeout time.Duration, maxSessions uint) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.sessionIdleTimeout, a.maxSessions
+}
+
+// idleExpired returns true if s has been idle for longer than the idle
+// timeout.
+func (a *Auth) idleExpired(s *aghuser.Session, now time.Time) (ok bool) {
+	idleTimeout, _ := a.sessionLimits()
+
+	return idleTimeout > 0 && !s.LastSeen.IsZero() && now.Sub(s.LastSeen) >= idleTimeout
+}
+
+// newSessionCookie creates a new session of the client c for the user with
+// name and returns its cookie.
+func (a *Auth) newSessionCookie(
+	ctx context.Context,
+	name string,
+	client *sessionClient,
+) (c *http.Cookie, err error) {
+	u := a.userByName(ctx, name)
+	if u == nil {
+		return nil, fmt.Errorf("creating session: user %q: %w", name, aghuser.ErrNotFound)
+	}
+
+	s, err := a.sessions.New(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("creating session: %w", err)
+	}
+
+	if client.ip.IsValid() || client.userAgent != "" {
+		upd := s.Clone()
+		upd.LastIP = client.ip
+		upd.UserAgent = client.userAgent
+
+		err = a.sessions.Update(ctx, upd)
+		if err != nil {
+			log.Error("auth: updating new session of user %q: %s", name, err)
+		}
+	}
+
+	a.removeExcessSessions(ctx, u.Login)
+
+	return &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    hex.EncodeToString(s.Token[:]),
+		Path:     "/",
+		Expires:  time.Now().Add(cookieTTL),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}, nil
+}
+
+// touchSession updates the last seen information of the session sess.
+func (a *Auth) touchSession(ctx context.Context, sess string, c *sessionClient, now time.Time) {
+	s := a.findSession(ctx, sess)
+	if s == nil {
+		return
+	}
+
+	changed := (c.ip.IsValid() && c.ip != s.LastIP) ||
+		(c.userAgent != "" && c.userAgent != s.UserAgent)
+	if !changed && now.Sub(s.LastSeen) < sessionSeenUpdateIvl {
+		return
+	}
+
+	upd := s.Clone()
+	upd.LastSeen = now
+	if c.ip.IsValid() {
+		upd.LastIP = c.ip
+	}
+
+	if c.userAgent != "" {
+		upd.UserAgent = c.userAgent
+	}
+
+	err := a.sessions.Update(ctx, upd)
+	if err != nil && !errors.Is(err, aghuser.ErrSessionNotFound) {
+		log.Error("auth: updating session %s: %s", sessionID(sess), err)
+	}
+}
+
+// findUserSessions returns the sessions of the user with login.
+func (a *Auth) findUserSessions(ctx context.Context, login aghuser.Login) (sessions []*aghuser.Session) {
+	sessions, err := a.sessions.FindByUser(ctx, login)
+	if err != nil {
+		log.Error("auth: searching sessions of user %q: %s", login, err)
+	}
+
+	return sessions
+}
+
+// removeExcessSessions removes the least recently seen sessions of the user
+// with login, so that there are no more than the maximum number of them.
+func (a *Auth) removeExcessSessions(ctx context.Context, login aghuser.Login) {
+	_, maxSessions := a.sessionLimits()
+	if maxSessions == 0 {
+		return
+	}
+
+	userSess := a.findUserSessions(ctx, login)
+	excess := len(userSess) - int(maxSessions)
+	if excess <= 0 {
+		return
+	}
+
+	slices.SortFunc(userSess, func(x, y *aghuser.Session) (res int) {
+		return cmp.Or(x.LastSeen.Compare(y.LastSeen), x.Created.Compare(y.Created))
+	})
+
+	for _, s := range userSess[:excess] {
+		err := a.sessions.DeleteByToken(ctx, s.Token)
+		if err != nil {
+			log.Error("auth: removing excess session of user %q: %s", login, err)
+		}
+	}
+
+	log.Debug("auth: removed %d excess sessions of user %q", excess, login)
+}
+
+// sessionID returns the public ID of the session sess, which doesn't allow
+// using the session.
+func sessionID(sess string) (id string) {
+	sum := sha256.Sum256([]byte(sess))
+
+	return hex.EncodeToString(sum[:sessionIDLen])
+}
+
+// sessionJSON is the information about a session.
+type sessionJSON struct {
+	// Created is nil if the session has been created by an older version.
+	Created *time.Time `json:"created,omitempty"`
+
+	// LastSeen is nil if the session hasn't been used since it was loaded from
+	// an older version.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+
+	// Expires is the time when the session expires unless it's used.
+	Expires time.Time `json:"expires"`
+
+	ID        string `json:"id"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Current   bool   `json:"current"`
+}
+
+// timeOrNil returns a pointer to t or nil if t is zero.
+func timeOrNil(t time.Time) (p *time.Time) {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// userSessions returns the sessions of the user with name, the most recently
+// seen first.  current is the session of the request, if any.
+func (a *Auth) userSessions(
+	ctx context.Context,
+	name string,
+	current string,
+) (sessions []*sessionJSON) {
+	sessions = []*sessionJSON{}
+	for _, s := range a.findUserSessions(ctx, aghuser.Login(name)) {
+		k := hex.EncodeToString(s.Token[:])
+		sj := &sessionJSON{
+			Created:   timeOrNil(s.Created),
+			LastSeen:  timeOrNil(s.LastSeen),
+			Expires:   s.Expire.UTC(),
+			ID:        sessionID(k),
+			UserAgent: s.UserAgent,
+			Current:   k == current,
+		}
+
+		if s.LastIP.IsValid() {
+			sj.IP = s.LastIP.String()
+		}
+
+		sessions = append(sessions, sj)
+	}
+
+	slices.SortFunc(sessions, func(x, y *sessionJSON) (res int) {
+		return -cmp.Or(
+			timeOrZero(x.LastSeen).Compare(timeOrZero(y.LastSeen)),
+			timeOrZero(x.Created).Compare(timeOrZero(y.Created)),
+			cmp.Compare(x.ID, y.ID),
+		)
+	})
+
+	return sessions
+}
+
+// timeOrZero returns the time at p or zero time if p is nil.
+func timeOrZero(p *time.Time) (t time.Time) {
+	if p == nil {
+		return time.Time{}
+	}
+
+	return *p
+}
+
+// errSessionNotFound is returned when the user has no session with the given
+// ID.
+const errSessionNotFound errors.Error = "session not found"
+
+// removeUserSessions removes the sessions of the user with name for which
+// remove returns true and returns their number.
+func (a *Auth) removeUserSessions(
+	ctx context.Context,
+	name string,
+	remove func(sess string) (ok bool),
+) (n int) {
+	for _, s := range a.findUserSessions(ctx, aghuser.Login(name)) {
+		if !remove(hex.EncodeToString(s.Token[:])) {
+			continue
+		}
+
+		err := a.sessions.DeleteByToken(ctx, s.Token)
+		if err != nil {
+			log.Error("auth: removing session of user %q: %s", name, err)
+
+			continue
+		}
+
+		n++
+	}
+
+	return n
+}
+
+// sessionsUser returns the user of r that manages the sessions and the
+// current session, if any.  If there is no user, or the request is
+// authenticated with an API token, sessionsUser writes an error and returns
+// nil.
+func sessionsUser(w http.ResponseWriter, r *http.Request) (u *webUser, current string) {
+	if rejectAPITokenAuth(w, r) {
+		return nil, ""
+	}
+
+	u, ok := authUserFromContext(r.Context())
+	if !ok || u == nil || globalContext.auth == nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "sessions require authentication")
+
+		return nil, ""
+	}
+
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		current = c.Value
+	}
+
+	return u, current
+}
+
+// sessionsResp is the response to the GET /control/sessions HTTP API.
+type sessionsResp struct {
+	Sessions []*sessionJSON `json:"sessions"`
+}
+
+// handleSessions is the handler for the GET /control/sessions HTTP API.
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	u, current := sessionsUser(w, r)
+	if u == nil {
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, &sessionsResp{
+		Sessions: globalContext.auth.userSessions(r.Context(), u.Name, current),
+	})
+}
+
+// sessionRevokeReq is the request to the POST /control/sessions/revoke HTTP
+// API.
+type sessionRevokeReq struct {
+	ID string `json:"id"`
+}
+
+// handleSessionRevoke is the handler for the POST /control/sessions/revoke
+// HTTP API.
+func handleSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	u, _ := sessionsUser(w, r)
+	if u == nil {
+		return
+	}
+
+	req := &sessionRevokeReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "json decode: %s", err)
+
+		return
+	}
+
+	n := globalContext.auth.removeUserSessions(r.Context(), u.Name, func(sess string) (ok bool) {
+		return sessionID(sess) == req.ID
+	})
+	if n == 0 {
+		aghhttp.Error(r, w, http.StatusNotFound, "%s", errSessionNotFound)
+
+		return
+	}
+
+	log.Info("auth: user %q revoked session %s", u.Name, req.ID)
+
+	aghhttp.OK(w)
+}
+
+// sessionsRevokedResp is the response to the POST
+// /control/sessions/revoke_others HTTP API.
+type sessionsRevokedResp struct {
+	Revoked int `json:"revoked"`
+}
+
+// handleSessionsRevokeOthers is the handler for the POST
+// /control/sessions/revoke_others HTTP API.  It removes all sessions of the
+// user except the current one.
+func handleSessionsRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	u, current := sessionsUser(w, r)
+	if u == nil {
+		return
+	}
+
+	n := globalContext.auth.removeUserSessions(r.Context(), u.Name, func(sess string) (ok bool) {
+		return sess != current
+	})
+
+	log.Info("auth: user %q revoked %d other sessions", u.Name, n)
+
+	aghhttp.WriteJSONResponseOK(w, r, &sessionsRevokedResp{Revoked: n})
+}
+
+// registerSessionHandlers registers the HTTP handlers for managing the
+// sessions of the current user.
+func registerSessionHandlers() {
+	httpRegister(http.MethodGet, "/control/sessions", handleSessions)
+	httpRegister(http.MethodPost, "/control/sessions/revoke", handleSessionRevoke)
+	httpRegister(http.MethodPost, "/control/sessions/revoke_others", handleSessionsRevokeOthers)
+}
@@ -0,0 +1,160 @@
+package home
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSessionsAuth returns a new *Auth for testing sessions.
+func newTestSessionsAuth(t *testing.T) (a *Auth) {
+	t.Helper()
+
+	a = InitAuth(
+		testutil.ContextWithTimeout(t, testTimeout),
+		testLogger,
+		filepath.Join(t.TempDir(), "sessions.db"),
+		[]webUser{{Name: "admin"}, {Name: "kid"}, {Name: "other"}},
+		60,
+		nil,
+		netutil.SliceSubnetSet(nil),
+	)
+	require.NotNil(t, a)
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		a.Close()
+
+		return nil
+	})
+
+	return a
+}
+
+func TestAuth_sessionLimits(t *testing.T) {
+	a := newTestSessionsAuth(t)
+	a.setSessionLimits(time.Minute, 2)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+	now := time.Now()
+
+	var sessions []string
+	for i := range 3 {
+		c, err := a.newSessionCookie(ctx, "admin", newSessionClient(nil))
+		require.NoError(t, err)
+
+		sessions = append(sessions, c.Value)
+
+		s := a.findSession(ctx, c.Value)
+		require.NotNil(t, s)
+
+		upd := s.Clone()
+		upd.LastSeen = now.Add(time.Duration(i-10) * time.Second)
+		require.NoError(t, a.sessions.Update(ctx, upd))
+	}
+
+	// The least recently seen session is removed.
+	assert.Equal(t, checkSessionNotFound, a.checkSession(ctx, sessions[0]))
+	assert.Equal(t, checkSessionOK, a.checkSession(ctx, sessions[1]))
+	assert.Equal(t, checkSessionOK, a.checkSession(ctx, sessions[2]))
+
+	idle, err := a.newSessionCookie(ctx, "other", newSessionClient(nil))
+	require.NoError(t, err)
+
+	s := a.findSession(ctx, idle.Value)
+	require.NotNil(t, s)
+
+	upd := s.Clone()
+	upd.LastSeen = now.Add(-2 * time.Minute)
+	require.NoError(t, a.sessions.Update(ctx, upd))
+
+	assert.Equal(t, checkSessionExpired, a.checkSession(ctx, idle.Value))
+	assert.Nil(t, a.findSession(ctx, idle.Value))
+}
+
+func TestSessionsHandlers(t *testing.T) {
+	storeGlobals(t)
+
+	a := newTestSessionsAuth(t)
+	globalContext.auth = a
+
+	u := &webUser{Name: "admin"}
+	r := httptest.NewRequest(http.MethodGet, "/control/sessions", nil)
+	r.RemoteAddr = "192.0.2.1:12345"
+	r.Header.Set("User-Agent", "Browser/1.0")
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	current, err := a.newSessionCookie(ctx, u.Name, newSessionClient(r))
+	require.NoError(t, err)
+
+	other, err := a.newSessionCookie(ctx, u.Name, newSessionClient(nil))
+	require.NoError(t, err)
+
+	_, err = a.newSessionCookie(ctx, "kid", newSessionClient(nil))
+	require.NoError(t, err)
+
+	// newRequest returns a new request of u with the current session.
+	newRequest := func(method, target string, body []byte) (req *http.Request) {
+		req = httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.AddCookie(current)
+
+		return req.WithContext(withAuthUser(req.Context(), u))
+	}
+
+	w := httptest.NewRecorder()
+	handleSessions(w, newRequest(http.MethodGet, "/control/sessions", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body []byte
+	resp := &sessionsResp{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+	require.Len(t, resp.Sessions, 2)
+
+	var cur *sessionJSON
+	for _, s := range resp.Sessions {
+		if s.Current {
+			cur = s
+		}
+	}
+
+	require.NotNil(t, cur)
+	assert.Equal(t, sessionID(current.Value), cur.ID)
+	assert.Equal(t, "192.0.2.1", cur.IP)
+	assert.Equal(t, "Browser/1.0", cur.UserAgent)
+
+	body, err = json.Marshal(&sessionRevokeReq{ID: sessionID(other.Value)})
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	handleSessionRevoke(w, newRequest(http.MethodPost, "/control/sessions/revoke", body))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, checkSessionNotFound, a.checkSession(ctx, other.Value))
+
+	w = httptest.NewRecorder()
+	handleSessionRevoke(w, newRequest(http.MethodPost, "/control/sessions/revoke", body))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	another, err := a.newSessionCookie(ctx, u.Name, newSessionClient(nil))
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	handleSessionsRevokeOthers(w, newRequest(http.MethodPost, "/control/sessions/revoke_others", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	revoked := &sessionsRevokedResp{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(revoked))
+
+	assert.Equal(t, 1, revoked.Revoked)
+	assert.Equal(t, checkSessionNotFound, a.checkSession(ctx, another.Value))
+	assert.Equal(t, checkSessionOK, a.checkSession(ctx, current.Value))
+	assert.Len(t, a.userSessions(ctx, "kid", ""), 1)
+}
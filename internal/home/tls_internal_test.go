@@ -130,6 +130,7 @@ func storeGlobals(tb testing.TB) {
 	prevConfig := config
 	prefGLFilePrefix := glFilePrefix
 	auth := globalContext.auth
+	auditLog := globalContext.audit
 	storage := globalContext.clients.storage
 	dnsServer := globalContext.dnsServer
 	firstRun := globalContext.firstRun
@@ -141,6 +142,7 @@ func storeGlobals(tb testing.TB) {
 		config = prevConfig
 		glFilePrefix = prefGLFilePrefix
 		globalContext.auth = auth
+		globalContext.audit = auditLog
 		globalContext.clients.storage = storage
 		globalContext.dnsServer = dnsServer
 		globalContext.firstRun = firstRun
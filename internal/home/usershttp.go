@@ -0,0 +1,395 @@
+package home
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// errLastAdmin is returned when a change would leave no local user with the
+// administrator role.
+const errLastAdmin errors.Error = "cannot remove the last administrator"
+
+// isAdmin returns true if u has the administrator role.
+func isAdmin(u *aghuser.User) (ok bool) {
+	return u.Role == "" || u.Role == aghuser.RoleAdmin
+}
+
+// checkLastAdmin returns [errLastAdmin] if u is the only local administrator.
+func (a *Auth) checkLastAdmin(ctx context.Context, u *aghuser.User) (err error) {
+	if !isAdmin(u) {
+		return nil
+	}
+
+	admins := 0
+	for _, lu := range a.localUsers(ctx) {
+		if isAdmin(lu) {
+			admins++
+		}
+	}
+
+	if admins <= 1 {
+		return errLastAdmin
+	}
+
+	return nil
+}
+
+// updateUser sets the role and the clients of the local user with the name of
+// upd and, if password isn't empty, its password.  It returns
+// [aghuser.ErrNotFound] if there is no such user.
+func (a *Auth) updateUser(ctx context.Context, upd *webUser, password string) (err error) {
+	u := a.localUser(ctx, upd.Name)
+	if u == nil || u.External {
+		return fmt.Errorf("user %q: %w", upd.Name, aghuser.ErrNotFound)
+	}
+
+	if isAdmin(u) && !isAdmin(&aghuser.User{Role: upd.Role}) {
+		err = a.checkLastAdmin(ctx, u)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+	}
+
+	nu := u.Clone()
+	nu.Role = upd.Role
+	nu.Clients = slices.Clone(upd.Clients)
+
+	if password != "" {
+		var hash string
+		hash, err = hashPassword(password)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		nu.Password = aghuser.NewDefaultPassword(hash)
+	}
+
+	err = a.users.Update(ctx, nu)
+	if err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+
+	log.Debug("auth: updated user with login %q", upd.Name)
+
+	return nil
+}
+
+// deleteUser removes the local user with name together with its sessions, API
+// tokens, and second factors.  It returns [aghuser.ErrNotFound] if there is no
+// such user.
+func (a *Auth) deleteUser(ctx context.Context, name string) (err error) {
+	u := a.localUser(ctx, name)
+	if u == nil || u.External {
+		return fmt.Errorf("user %q: %w", name, aghuser.ErrNotFound)
+	}
+
+	err = a.checkLastAdmin(ctx, u)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	err = a.users.Delete(ctx, u.ID)
+	if err != nil {
+		return fmt.Errorf("deleting user: %w", err)
+	}
+
+	a.removeUserSessions(ctx, name, func(_ string) (ok bool) { return true })
+
+	var errs []error
+	for id, t := range a.apiTokensList() {
+		if t.UserName != name {
+			continue
+		}
+
+		_, err = a.removeAPIToken(id)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	func() {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		errs = append(errs, a.storeMFA(name, nil))
+	}()
+
+	log.Debug("auth: deleted user with login %q", name)
+
+	return errors.Annotate(errors.Join(errs...), "cleaning up user %q: %w", name)
+}
+
+// userJSON is the information about a local web user for the HTTP API.  It
+// never contains the password.
+type userJSON struct {
+	Name    string       `json:"name"`
+	Role    aghuser.Role `json:"role"`
+	Clients []string     `json:"clients"`
+}
+
+// usersResp is the response to the GET /control/users HTTP API.
+type usersResp struct {
+	Users []*userJSON `json:"users"`
+}
+
+// userAddReq is the request to the POST /control/users/add HTTP API.
+type userAddReq struct {
+	Name     string       `json:"name"`
+	Password string       `json:"password"`
+	Role     aghuser.Role `json:"role"`
+	Clients  []string     `json:"clients"`
+}
+
+// userUpdateReq is the request to the POST /control/users/update HTTP API.
+type userUpdateReq struct {
+	Name string `json:"name"`
+
+	// Password is the new password of the user.  An empty string means that
+	// the password isn't changed.
+	Password string `json:"password"`
+
+	Role    aghuser.Role `json:"role"`
+	Clients []string     `json:"clients"`
+}
+
+// userDeleteReq is the request to the POST /control/users/delete HTTP API.
+type userDeleteReq struct {
+	Name string `json:"name"`
+}
+
+// registerUsersHandlers registers the HTTP API handlers for managing the local
+// web users.
+func registerUsersHandlers() {
+	httpRegister(http.MethodGet, "/control/users", handleUsers)
+	httpRegister(http.MethodPost, "/control/users/add", handleUserAdd)
+	httpRegister(http.MethodPost, "/control/users/update", handleUserUpdate)
+	httpRegister(http.MethodPost, "/control/users/delete", handleUserDelete)
+}
+
+// rejectUsersAPITokenAuth writes an error and returns true if r is
+// authenticated with an API token, since the tokens must not be able to manage
+// the credentials.
+func rejectUsersAPITokenAuth(w http.ResponseWriter, r *http.Request) (rejected bool) {
+	if _, ok := apiTokenFromContext(r.Context()); !ok {
+		return false
+	}
+
+	aghhttp.Error(r, w, http.StatusForbidden, "users cannot be managed with api tokens")
+
+	return true
+}
+
+// validatePassword returns an error if password is too short.
+func validatePassword(password string) (err error) {
+	if utf8.RuneCountInString(password) < PasswordMinRunes {
+		return fmt.Errorf("password must be at least %d symbols long", PasswordMinRunes)
+	}
+
+	return nil
+}
+
+// handleUsers is the handler for the GET /control/users HTTP API.
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	if rejectUsersAPITokenAuth(w, r) {
+		return
+	}
+
+	resp := &usersResp{
+		Users: []*userJSON{},
+	}
+
+	if globalContext.auth != nil {
+		for _, u := range globalContext.auth.localUsers(r.Context()) {
+			uj := &userJSON{
+				Name:    string(u.Login),
+				Role:    u.Role,
+				Clients: slices.Clone(u.Clients),
+			}
+
+			if uj.Role == "" {
+				uj.Role = aghuser.RoleAdmin
+			}
+
+			if uj.Clients == nil {
+				uj.Clients = []string{}
+			}
+
+			resp.Users = append(resp.Users, uj)
+		}
+	}
+
+	slices.SortFunc(resp.Users, func(a, b *userJSON) (res int) {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleUserAdd is the handler for the POST /control/users/add HTTP API.
+func handleUserAdd(w http.ResponseWriter, r *http.Request) {
+	if rejectUsersAPITokenAuth(w, r) {
+		return
+	}
+
+	req := &userAddReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	u := &webUser{
+		Name:    req.Name,
+		Role:    req.Role,
+		Clients: req.Clients,
+	}
+
+	err = errors.Join(u.Validate(), validatePassword(req.Password))
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	} else if globalContext.auth == nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "authentication is not initialized")
+
+		return
+	}
+
+	err = globalContext.auth.addUser(r.Context(), u, req.Password)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	log.Info("auth: added user %q with role %q", u.Name, u.Role)
+
+	onConfigModified()
+
+	aghhttp.OK(w)
+}
+
+// handleUserUpdate is the handler for the POST /control/users/update HTTP API.
+// If the password is changed, all sessions of the user except the current one
+// are revoked.
+func handleUserUpdate(w http.ResponseWriter, r *http.Request) {
+	if rejectUsersAPITokenAuth(w, r) {
+		return
+	}
+
+	req := &userUpdateReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	u := &webUser{
+		Name:    req.Name,
+		Role:    req.Role,
+		Clients: req.Clients,
+	}
+
+	err = u.Validate()
+	if err == nil && req.Password != "" {
+		err = validatePassword(req.Password)
+	}
+
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	} else if globalContext.auth == nil {
+		aghhttp.Error(r, w, http.StatusNotFound, "user %q: %s", req.Name, aghuser.ErrNotFound)
+
+		return
+	}
+
+	ctx := r.Context()
+	err = globalContext.auth.updateUser(ctx, u, req.Password)
+	if err != nil {
+		aghhttp.Error(r, w, userErrorStatus(err), "%s", err)
+
+		return
+	}
+
+	if req.Password != "" {
+		var current string
+		if c, cErr := r.Cookie(sessionCookieName); cErr == nil {
+			current = c.Value
+		}
+
+		n := globalContext.auth.removeUserSessions(ctx, u.Name, func(sess string) (ok bool) {
+			return sess != current
+		})
+
+		log.Info("auth: changed password of user %q, revoked %d sessions", u.Name, n)
+	}
+
+	onConfigModified()
+
+	aghhttp.OK(w)
+}
+
+// handleUserDelete is the handler for the POST /control/users/delete HTTP API.
+func handleUserDelete(w http.ResponseWriter, r *http.Request) {
+	if rejectUsersAPITokenAuth(w, r) {
+		return
+	}
+
+	req := &userDeleteReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	if cur, ok := authUserFromContext(r.Context()); ok && cur != nil && cur.Name == req.Name {
+		aghhttp.Error(r, w, http.StatusBadRequest, "cannot delete the current user")
+
+		return
+	} else if globalContext.auth == nil {
+		aghhttp.Error(r, w, http.StatusNotFound, "user %q: %s", req.Name, aghuser.ErrNotFound)
+
+		return
+	}
+
+	err = globalContext.auth.deleteUser(r.Context(), req.Name)
+	if err != nil {
+		aghhttp.Error(r, w, userErrorStatus(err), "%s", err)
+
+		return
+	}
+
+	log.Info("auth: deleted user %q", req.Name)
+
+	onConfigModified()
+
+	aghhttp.OK(w)
+}
+
+// userErrorStatus returns the HTTP status code for the error of changing
+// a user.
+func userErrorStatus(err error) (code int) {
+	if errors.Is(err, aghuser.ErrNotFound) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusBadRequest
+}
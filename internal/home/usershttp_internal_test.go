@@ -0,0 +1,167 @@
+package home
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsersHandlers(t *testing.T) {
+	storeGlobals(t)
+
+	prevConfPath := globalContext.confFilePath
+	t.Cleanup(func() { globalContext.confFilePath = prevConfPath })
+
+	dir := t.TempDir()
+	globalContext.confFilePath = filepath.Join(dir, "AdGuardHome.yaml")
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	var err error
+	globalContext.clients.storage, err = client.NewStorage(ctx, &client.StorageConfig{
+		Logger: testLogger,
+		Clock:  timeutil.SystemClock{},
+	})
+	require.NoError(t, err)
+
+	a := InitAuth(
+		ctx,
+		testLogger,
+		filepath.Join(dir, "sessions.db"),
+		[]webUser{{Name: "admin"}, {Name: "viewer", Role: aghuser.RoleReadOnly}},
+		60,
+		nil,
+		netutil.SliceSubnetSet(nil),
+	)
+	require.NotNil(t, a)
+	testutil.CleanupAndRequireSuccess(t, func() (err error) {
+		a.Close()
+
+		return nil
+	})
+
+	globalContext.auth = a
+
+	// do calls h with the JSON-encoded body as the administrator and returns
+	// the response.
+	do := func(
+		t *testing.T,
+		h http.HandlerFunc,
+		method string,
+		body any,
+	) (w *httptest.ResponseRecorder) {
+		t.Helper()
+
+		var data []byte
+		if body != nil {
+			data, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+
+		r := httptest.NewRequest(method, "/control/users", bytes.NewReader(data))
+		r = r.WithContext(withAuthUser(r.Context(), &webUser{Name: "admin"}))
+
+		w = httptest.NewRecorder()
+		h(w, r)
+
+		return w
+	}
+
+	t.Run("list", func(t *testing.T) {
+		w := do(t, handleUsers, http.MethodGet, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		resp := &usersResp{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+
+		assert.Equal(t, []*userJSON{{
+			Name:    "admin",
+			Role:    aghuser.RoleAdmin,
+			Clients: []string{},
+		}, {
+			Name:    "viewer",
+			Role:    aghuser.RoleReadOnly,
+			Clients: []string{},
+		}}, resp.Users)
+	})
+
+	t.Run("add", func(t *testing.T) {
+		req := &userAddReq{
+			Name:     "parent",
+			Password: "password1",
+			Role:     aghuser.RoleParent,
+			Clients:  []string{"tablet"},
+		}
+
+		w := do(t, handleUserAdd, http.MethodPost, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		u, ok := a.findUser(ctx, "parent", "password1")
+		require.True(t, ok)
+
+		assert.Equal(t, aghuser.RoleParent, u.Role)
+		assert.Equal(t, []string{"tablet"}, u.Clients)
+
+		w = do(t, handleUserAdd, http.MethodPost, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		req.Name, req.Password = "other", "short"
+		w = do(t, handleUserAdd, http.MethodPost, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("update_password", func(t *testing.T) {
+		c, cErr := a.newSessionCookie(ctx, "viewer", newSessionClient(nil))
+		require.NoError(t, cErr)
+
+		w := do(t, handleUserUpdate, http.MethodPost, &userUpdateReq{
+			Name:     "viewer",
+			Password: "new password",
+			Role:     aghuser.RoleReadOnly,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, checkSessionNotFound, a.checkSession(ctx, c.Value))
+
+		_, ok := a.findUser(ctx, "viewer", "new password")
+		assert.True(t, ok)
+	})
+
+	t.Run("last_admin", func(t *testing.T) {
+		w := do(t, handleUserUpdate, http.MethodPost, &userUpdateReq{
+			Name: "admin",
+			Role: aghuser.RoleReadOnly,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = do(t, handleUserDelete, http.MethodPost, &userDeleteReq{Name: "admin"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		assert.NotNil(t, a.localUser(ctx, "admin"))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		_, cErr := a.newSessionCookie(ctx, "viewer", newSessionClient(nil))
+		require.NoError(t, cErr)
+
+		w := do(t, handleUserDelete, http.MethodPost, &userDeleteReq{Name: "viewer"})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Nil(t, a.localUser(ctx, "viewer"))
+		assert.Empty(t, a.userSessions(ctx, "viewer", ""))
+
+		w = do(t, handleUserDelete, http.MethodPost, &userDeleteReq{Name: "viewer"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,144 @@
+// Package lanname discovers the names of the devices in the local network
+// using multicast DNS, LLMNR, and NetBIOS name service.
+package lanname
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/bluele/gcache"
+)
+
+// Interface looks up the names of the devices by their addresses.
+type Interface interface {
+	// Process looks up the name of the device with ip and returns it.  changed
+	// indicates that the name was updated since the last request.
+	Process(ctx context.Context, ip netip.Addr) (host string, changed bool)
+}
+
+// Empty is an empty [Interface] implementation which does nothing.
+type Empty struct{}
+
+// type check
+var _ Interface = Empty{}
+
+// Process implements the [Interface] interface for Empty.
+func (Empty) Process(_ context.Context, _ netip.Addr) (host string, changed bool) {
+	return "", false
+}
+
+// Resolver resolves the address of a device to its name using a particular
+// protocol.
+type Resolver interface {
+	// Resolve returns the name of the device with ip.  host is empty if the
+	// device hasn't responded.
+	Resolve(ctx context.Context, ip netip.Addr) (host string, err error)
+}
+
+// Config is the configuration structure for [Default].
+type Config struct {
+	// Logger is used for logging the operation of the lookups.  It must not be
+	// nil.
+	Logger *slog.Logger
+
+	// Resolver resolves the addresses.  It must not be nil.
+	Resolver Resolver
+
+	// CacheSize is the maximum size of the cache.  It must be greater than
+	// zero.
+	CacheSize int
+
+	// CacheTTL is the Time to Live duration for cached addresses.
+	CacheTTL time.Duration
+}
+
+// Default is the default [Interface] implementation caching the results of the
+// resolver.
+type Default struct {
+	// logger is used for logging the operation of the lookups.
+	logger *slog.Logger
+
+	// cache contains the names of the addresses.  An address is resolved once
+	// again after it expires.  The addresses that couldn't be resolved also
+	// stay here for some time to prevent further attempts to resolve those.
+	cache gcache.Cache
+
+	// resolver resolves the addresses.
+	resolver Resolver
+
+	// cacheTTL is the Time to Live duration for cached addresses.
+	cacheTTL time.Duration
+}
+
+// New returns a new properly initialized *Default.  c must not be nil.
+func New(c *Config) (d *Default) {
+	return &Default{
+		logger:   c.Logger,
+		cache:    gcache.New(c.CacheSize).LRU().Build(),
+		resolver: c.Resolver,
+		cacheTTL: c.CacheTTL,
+	}
+}
+
+// type check
+var _ Interface = (*Default)(nil)
+
+// Process implements the [Interface] interface for *Default.
+func (d *Default) Process(ctx context.Context, ip netip.Addr) (host string, changed bool) {
+	fromCache, expired := d.findInCache(ctx, ip)
+	if !expired {
+		return fromCache, false
+	}
+
+	host, err := d.resolver.Resolve(ctx, ip)
+	if err != nil {
+		d.logger.DebugContext(ctx, "resolving", "ip", ip, slogutil.KeyError, err)
+	}
+
+	item := &cacheItem{
+		expiry: time.Now().Add(d.cacheTTL),
+		host:   host,
+	}
+
+	err = d.cache.Set(ip, item)
+	if err != nil {
+		d.logger.DebugContext(ctx, "adding item to cache", "key", ip, slogutil.KeyError, err)
+	}
+
+	return host, host != "" && host != fromCache
+}
+
+// findInCache finds the name in the cache.  expired is true if host is not
+// valid anymore.
+func (d *Default) findInCache(ctx context.Context, ip netip.Addr) (host string, expired bool) {
+	val, err := d.cache.Get(ip)
+	if err != nil {
+		if !errors.Is(err, gcache.KeyNotFoundError) {
+			d.logger.DebugContext(
+				ctx,
+				"retrieving item from cache",
+				"key", ip,
+				slogutil.KeyError, err,
+			)
+		}
+
+		return "", true
+	}
+
+	item := val.(*cacheItem)
+
+	return item.host, time.Now().After(item.expiry)
+}
+
+// cacheItem is an item stored in the cache.
+type cacheItem struct {
+	// expiry is the time when the item expires.
+	expiry time.Time
+
+	// host is the name of the device.
+	host string
+}
@@ -0,0 +1,202 @@
+package lanname
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newNodeStatusResponse returns a node status response to the request with id
+// containing the names.
+func newNodeStatusResponse(tb testing.TB, id uint16, names ...[nbNameEntryLen]byte) (b []byte) {
+	tb.Helper()
+
+	b = binary.BigEndian.AppendUint16(nil, id)
+	b = append(b, 0x84, 0x00, 0, 0, 0, 1, 0, 0, 0, 0)
+
+	// Use the compressed name.
+	b = append(b, 0xc0, 0x0c)
+	b = binary.BigEndian.AppendUint16(b, nbTypeNBSTAT)
+	b = binary.BigEndian.AppendUint16(b, nbClassIN)
+	b = append(b, 0, 0, 0, 0)
+
+	rdLen := 1 + len(names)*nbNameEntryLen
+	b = binary.BigEndian.AppendUint16(b, uint16(rdLen))
+	b = append(b, byte(len(names)))
+	for _, n := range names {
+		b = append(b, n[:]...)
+	}
+
+	return b
+}
+
+// newNameEntry returns a new node status name entry.
+func newNameEntry(name string, suffix byte, flags uint16) (e [nbNameEntryLen]byte) {
+	copy(e[:], name+"               ")
+	e[nbNameLen-1] = suffix
+	binary.BigEndian.PutUint16(e[nbNameLen:], flags)
+
+	return e
+}
+
+func TestNewNodeStatusRequest(t *testing.T) {
+	req := newNodeStatusRequest(0x1234)
+	require.Len(t, req, nbHeaderLen+nbEncodedNameLen+6)
+
+	assert.Equal(t, []byte{0x12, 0x34}, req[:2])
+	assert.Equal(t, byte(nbEncodedNameLen), req[nbHeaderLen])
+
+	// "*" is encoded as "CK" and the zero padding as "AA".
+	assert.Equal(t, "CKAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", string(req[nbHeaderLen+1:nbHeaderLen+33]))
+}
+
+func TestParseNodeStatusResponse(t *testing.T) {
+	const id = 0x1234
+
+	testCases := []struct {
+		name       string
+		wantHost   string
+		wantErrMsg string
+		resp       []byte
+	}{{
+		name:       "workstation",
+		wantHost:   "DESKTOP-1",
+		wantErrMsg: "",
+		resp: newNodeStatusResponse(
+			t,
+			id,
+			newNameEntry("WORKGROUP", 0x00, nbFlagGroup),
+			newNameEntry("DESKTOP-1", 0x20, 0),
+			newNameEntry("DESKTOP-1", 0x00, 0),
+		),
+	}, {
+		name:       "no_workstation",
+		wantHost:   "",
+		wantErrMsg: "",
+		resp:       newNodeStatusResponse(t, id, newNameEntry("WORKGROUP", 0x00, nbFlagGroup)),
+	}, {
+		name:       "bad_id",
+		wantHost:   "",
+		wantErrMsg: "unexpected id 1",
+		resp:       newNodeStatusResponse(t, 1),
+	}, {
+		name:       "short",
+		wantHost:   "",
+		wantErrMsg: "response is too short",
+		resp:       []byte{0x12, 0x34},
+	}, {
+		name:       "truncated",
+		wantHost:   "",
+		wantErrMsg: "response is too short",
+		resp: newNodeStatusResponse(
+			t,
+			id,
+			newNameEntry("DESKTOP-1", 0x00, 0),
+		)[:nbHeaderLen+20],
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			host, err := parseNodeStatusResponse(id, tc.resp)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.wantHost, host)
+		})
+	}
+}
+
+func TestParseAnnouncements(t *testing.T) {
+	src := netip.MustParseAddr("192.168.1.5")
+
+	newHdr := func(name string, typ uint16, ttl uint32) (hdr dns.RR_Header) {
+		return dns.RR_Header{
+			Name:   name,
+			Rrtype: typ,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		}
+	}
+
+	deviceInfo := &dns.TXT{
+		Hdr: newHdr(`John\226\128\153s\ MacBook._device-info._tcp.local.`, dns.TypeTXT, 4500),
+		Txt: []string{"model=MacBookPro18,1"},
+	}
+
+	testCases := []struct {
+		msg  *dns.Msg
+		name string
+		want []*Announcement
+	}{{
+		msg: &dns.Msg{
+			MsgHdr: dns.MsgHdr{Response: true},
+			Answer: []dns.RR{&dns.A{
+				Hdr: newHdr("printer.local.", dns.TypeA, 120),
+				A:   net.IP{192, 168, 1, 6},
+			}},
+			Extra: []dns.RR{deviceInfo},
+		},
+		name: "address",
+		want: []*Announcement{{
+			Addr: netip.MustParseAddr("192.168.1.6"),
+			Host: "printer.local",
+			TTL:  2 * time.Minute,
+		}, {
+			Addr: src,
+			Host: "John’s MacBook",
+			TTL:  75 * time.Minute,
+		}},
+	}, {
+		msg: &dns.Msg{
+			MsgHdr: dns.MsgHdr{Response: true},
+			Answer: []dns.RR{&dns.AAAA{
+				Hdr:  newHdr("MacBook.local.", dns.TypeAAAA, 0),
+				AAAA: net.ParseIP("fe80::1"),
+			}, &dns.A{
+				Hdr: newHdr("MacBook.local.", dns.TypeA, 0),
+				A:   src.AsSlice(),
+			}, deviceInfo},
+		},
+		name: "goodbye",
+		want: []*Announcement{{
+			Addr: netip.MustParseAddr("fe80::1"),
+			Host: "MacBook.local",
+			TTL:  0,
+		}, {
+			Addr: src,
+			Host: "MacBook.local",
+			TTL:  0,
+		}},
+	}, {
+		msg: &dns.Msg{
+			Answer: []dns.RR{&dns.A{
+				Hdr: newHdr("printer.local.", dns.TypeA, 120),
+				A:   net.IP{192, 168, 1, 6},
+			}},
+		},
+		name: "query",
+		want: nil,
+	}, {
+		msg: &dns.Msg{
+			MsgHdr: dns.MsgHdr{Response: true},
+			Answer: []dns.RR{&dns.A{
+				Hdr: newHdr("example.com.", dns.TypeA, 120),
+				A:   net.IP{192, 168, 1, 6},
+			}},
+		},
+		name: "not_local",
+		want: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseAnnouncements(tc.msg, src))
+		})
+	}
+}
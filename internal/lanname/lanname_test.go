@@ -0,0 +1,129 @@
+package lanname_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/lanname"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is a common timeout for tests and contexts.
+const testTimeout = 1 * time.Second
+
+// testResolver is a mock implementation of the [lanname.Resolver] interface.
+type testResolver struct {
+	onResolve func(ctx context.Context, ip netip.Addr) (host string, err error)
+}
+
+// type check
+var _ lanname.Resolver = (*testResolver)(nil)
+
+// Resolve implements the [lanname.Resolver] interface for *testResolver.
+func (r *testResolver) Resolve(ctx context.Context, ip netip.Addr) (host string, err error) {
+	return r.onResolve(ctx, ip)
+}
+
+func TestDefault_Process(t *testing.T) {
+	const testHost = "desktop"
+
+	var (
+		knownIP   = netip.MustParseAddr("192.168.1.2")
+		unknownIP = netip.MustParseAddr("192.168.1.3")
+	)
+
+	hits := 0
+	d := lanname.New(&lanname.Config{
+		Logger: slogutil.NewDiscardLogger(),
+		Resolver: &testResolver{
+			onResolve: func(_ context.Context, ip netip.Addr) (host string, err error) {
+				hits++
+				if ip == knownIP {
+					return testHost, nil
+				}
+
+				return "", errors.Error("timeout")
+			},
+		},
+		CacheSize: 10,
+		CacheTTL:  time.Hour,
+	})
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	host, changed := d.Process(ctx, knownIP)
+	assert.True(t, changed)
+	assert.Equal(t, testHost, host)
+
+	host, changed = d.Process(ctx, knownIP)
+	assert.False(t, changed)
+	assert.Equal(t, testHost, host)
+
+	host, changed = d.Process(ctx, unknownIP)
+	assert.False(t, changed)
+	assert.Empty(t, host)
+
+	// The failed lookups are cached as well.
+	_, _ = d.Process(ctx, unknownIP)
+	assert.Equal(t, 2, hits)
+}
+
+func TestLLMNR_Resolve(t *testing.T) {
+	const testHost = "desktop"
+
+	localhost := netip.MustParseAddr("127.0.0.1")
+	arpa, err := netutil.IPToReversedAddr(localhost.AsSlice())
+	require.NoError(t, err)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			resp := (&dns.Msg{}).SetReply(req)
+			if req.RecursionDesired {
+				resp.Rcode = dns.RcodeRefused
+			} else if req.Question[0].Name == dns.Fqdn(arpa) {
+				resp.Answer = append(resp.Answer, &dns.PTR{
+					Hdr: dns.RR_Header{
+						Name:   req.Question[0].Name,
+						Rrtype: dns.TypePTR,
+						Class:  dns.ClassINET,
+						Ttl:    30,
+					},
+					Ptr: dns.Fqdn(testHost),
+				})
+			}
+
+			_ = w.WriteMsg(resp)
+		}),
+	}
+
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+
+	go func() { _ = srv.ActivateAndServe() }()
+	testutil.CleanupAndRequireSuccess(t, srv.Shutdown)
+
+	_, _ = testutil.RequireReceive(t, started, testTimeout)
+
+	r := &lanname.LLMNR{
+		Timeout: testTimeout,
+		Port:    uint16(pc.LocalAddr().(*net.UDPAddr).Port),
+	}
+
+	host, err := r.Resolve(testutil.ContextWithTimeout(t, testTimeout), localhost)
+	require.NoError(t, err)
+
+	assert.Equal(t, testHost, host)
+}
@@ -0,0 +1,68 @@
+package lanname
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// DefaultLLMNRPort is the port LLMNR responders listen on.
+const DefaultLLMNRPort uint16 = 5355
+
+// LLMNR is the [Resolver] sending reverse queries directly to the LLMNR
+// responders of the devices.  See RFC 4795.
+type LLMNR struct {
+	// Timeout is the timeout for a single query.
+	Timeout time.Duration
+
+	// Port is the port of the responders, usually [DefaultLLMNRPort].
+	Port uint16
+}
+
+// type check
+var _ Resolver = (*LLMNR)(nil)
+
+// Resolve implements the [Resolver] interface for *LLMNR.
+func (r *LLMNR) Resolve(ctx context.Context, ip netip.Addr) (host string, err error) {
+	arpa, err := netutil.IPToReversedAddr(ip.AsSlice())
+	if err != nil {
+		return "", fmt.Errorf("reversing %s: %w", ip, err)
+	}
+
+	// LLMNR requests must not set the RD bit, so don't use [dns.Msg.SetQuestion].
+	req := &dns.Msg{
+		MsgHdr: dns.MsgHdr{
+			Id: dns.Id(),
+		},
+		Question: []dns.Question{{
+			Name:   dns.Fqdn(arpa),
+			Qtype:  dns.TypePTR,
+			Qclass: dns.ClassINET,
+		}},
+	}
+
+	c := &dns.Client{
+		Net:     "udp",
+		Timeout: r.Timeout,
+	}
+
+	resp, _, err := c.ExchangeContext(ctx, req, netip.AddrPortFrom(ip, r.Port).String())
+	if err != nil {
+		return "", fmt.Errorf("exchanging: %w", err)
+	} else if resp.Rcode != dns.RcodeSuccess {
+		return "", fmt.Errorf("unexpected rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	for _, rr := range resp.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return strings.TrimSuffix(ptr.Ptr, "."), nil
+		}
+	}
+
+	return "", nil
+}
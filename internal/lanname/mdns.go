@@ -0,0 +1,297 @@
+package lanname
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/service"
+	"github.com/miekg/dns"
+)
+
+// mDNS constants.  See RFC 6762 and RFC 6763.
+const (
+	// mdnsPort is the port of multicast DNS.
+	mdnsPort = 5353
+
+	// mdnsDomain is the domain of the multicast DNS names.
+	mdnsDomain = "local."
+
+	// mdnsDeviceInfo is the suffix of the names of the service instances
+	// describing the devices.
+	mdnsDeviceInfo = "._device-info._tcp." + mdnsDomain
+
+	// mdnsMaxPacketLen is the maximum length of a multicast DNS packet.
+	mdnsMaxPacketLen = 9000
+
+	// updatesBufferSize is the size of the buffer of the announcements
+	// channel.
+	updatesBufferSize = 64
+)
+
+// Multicast DNS group addresses.
+var (
+	mdnsGroupV4 = netip.MustParseAddr("224.0.0.251")
+	mdnsGroupV6 = netip.MustParseAddr("ff02::fb")
+)
+
+// Announcement is the name of a device announced using multicast DNS.
+type Announcement struct {
+	// Addr is the address of the device.
+	Addr netip.Addr
+
+	// Host is the announced name of the device.
+	Host string
+
+	// TTL is the time the announcement is valid for.  Zero means that the
+	// device is leaving the network.
+	TTL time.Duration
+}
+
+// MDNSConfig is the configuration structure for [MDNS].
+type MDNSConfig struct {
+	// Logger is used for logging the operation of the listener.  It must not
+	// be nil.
+	Logger *slog.Logger
+}
+
+// MDNS passively listens for the multicast DNS responses and announcements in
+// the local network.
+type MDNS struct {
+	// logger is used for logging the operation of the listener.
+	logger *slog.Logger
+
+	// updates is the channel of the received announcements.
+	updates chan *Announcement
+
+	// mu protects conns.
+	mu *sync.Mutex
+
+	// conns are the connections listening to the multicast groups.
+	conns []*net.UDPConn
+}
+
+// NewMDNS returns a new properly initialized *MDNS.  c must not be nil.
+func NewMDNS(c *MDNSConfig) (m *MDNS) {
+	return &MDNS{
+		logger:  c.Logger,
+		updates: make(chan *Announcement, updatesBufferSize),
+		mu:      &sync.Mutex{},
+	}
+}
+
+// type check
+var _ service.Interface = (*MDNS)(nil)
+
+// Start implements the [service.Interface] interface for *MDNS.  It only fails
+// if the IPv4 group can't be joined.
+func (m *MDNS) Start(ctx context.Context) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c4, err := net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{
+		IP:   mdnsGroupV4.AsSlice(),
+		Port: mdnsPort,
+	})
+	if err != nil {
+		return fmt.Errorf("listening ipv4 mdns: %w", err)
+	}
+
+	m.conns = append(m.conns, c4)
+
+	c6, err := net.ListenMulticastUDP("udp6", nil, &net.UDPAddr{
+		IP:   mdnsGroupV6.AsSlice(),
+		Port: mdnsPort,
+	})
+	if err != nil {
+		m.logger.WarnContext(ctx, "listening ipv6 mdns", slogutil.KeyError, err)
+	} else {
+		m.conns = append(m.conns, c6)
+	}
+
+	for _, c := range m.conns {
+		go m.listen(c)
+	}
+
+	m.logger.InfoContext(ctx, "listening for mdns announcements", "conns", len(m.conns))
+
+	return nil
+}
+
+// Shutdown implements the [service.Interface] interface for *MDNS.
+func (m *MDNS) Shutdown(_ context.Context) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, c := range m.conns {
+		errs = append(errs, c.Close())
+	}
+
+	m.conns = nil
+
+	return errors.Join(errs...)
+}
+
+// Upd returns the channel of the received announcements.
+func (m *MDNS) Upd() (updates <-chan *Announcement) {
+	return m.updates
+}
+
+// listen reads the packets from c until it's closed.  It's intended to be used
+// as a goroutine.
+func (m *MDNS) listen(c *net.UDPConn) {
+	ctx := context.Background()
+	defer slogutil.RecoverAndLog(ctx, m.logger)
+
+	buf := make([]byte, mdnsMaxPacketLen)
+	for {
+		n, src, err := c.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				m.logger.WarnContext(ctx, "reading mdns", slogutil.KeyError, err)
+			}
+
+			return
+		}
+
+		msg := &dns.Msg{}
+		err = msg.Unpack(buf[:n])
+		if err != nil {
+			m.logger.DebugContext(ctx, "unpacking mdns", "src", src, slogutil.KeyError, err)
+
+			continue
+		}
+
+		for _, a := range parseAnnouncements(msg, src.Addr().Unmap()) {
+			m.send(ctx, a)
+		}
+	}
+}
+
+// send sends a without blocking, dropping it if nobody receives the
+// announcements.
+func (m *MDNS) send(ctx context.Context, a *Announcement) {
+	select {
+	case m.updates <- a:
+	default:
+		m.logger.DebugContext(ctx, "dropping announcement", "addr", a.Addr, "host", a.Host)
+	}
+}
+
+// parseAnnouncements returns the names announced in msg sent from src.  The
+// addresses of the names are taken from the address records, and the names of
+// the device information service instances are attributed to src.
+func parseAnnouncements(msg *dns.Msg, src netip.Addr) (anns []*Announcement) {
+	if !msg.Response {
+		return nil
+	}
+
+	rrs := append(msg.Answer[:len(msg.Answer):len(msg.Answer)], msg.Extra...)
+
+	covered := container.NewMapSet[netip.Addr]()
+	for _, rr := range rrs {
+		a := addrAnnouncement(rr)
+		if a != nil {
+			covered.Add(a.Addr)
+			anns = append(anns, a)
+		}
+	}
+
+	if covered.Has(src) {
+		return anns
+	}
+
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		name := dns.CanonicalName(hdr.Name)
+		if hdr.Rrtype != dns.TypeTXT || !strings.HasSuffix(name, mdnsDeviceInfo) {
+			continue
+		}
+
+		instance := unescapeLabel(dns.SplitDomainName(hdr.Name)[0])
+		if instance != "" {
+			anns = append(anns, &Announcement{
+				Addr: src,
+				Host: instance,
+				TTL:  time.Duration(hdr.Ttl) * time.Second,
+			})
+
+			break
+		}
+	}
+
+	return anns
+}
+
+// addrAnnouncement returns the announcement of the address record rr within
+// the multicast DNS domain, or nil.
+func addrAnnouncement(rr dns.RR) (a *Announcement) {
+	var ip net.IP
+	switch rr := rr.(type) {
+	case *dns.A:
+		ip = rr.A
+	case *dns.AAAA:
+		ip = rr.AAAA
+	default:
+		return nil
+	}
+
+	hdr := rr.Header()
+	if !dns.IsSubDomain(mdnsDomain, dns.CanonicalName(hdr.Name)) {
+		return nil
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok || addr.IsUnspecified() {
+		return nil
+	}
+
+	return &Announcement{
+		Addr: addr.Unmap(),
+		Host: strings.TrimSuffix(hdr.Name, "."),
+		TTL:  time.Duration(hdr.Ttl) * time.Second,
+	}
+}
+
+// unescapeLabel returns the label in the presentation format without the
+// escape sequences.
+func unescapeLabel(label string) (unescaped string) {
+	if !strings.Contains(label, `\`) {
+		return label
+	}
+
+	b := &strings.Builder{}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if c != '\\' || i+1 == len(label) {
+			b.WriteByte(c)
+
+			continue
+		}
+
+		// Handle the \DDD form.
+		if i+3 < len(label) {
+			if n, err := strconv.ParseUint(label[i+1:i+4], 10, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+
+				continue
+			}
+		}
+
+		b.WriteByte(label[i+1])
+		i++
+	}
+
+	return b.String()
+}
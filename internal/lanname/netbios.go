@@ -0,0 +1,219 @@
+package lanname
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// DefaultNetBIOSPort is the port of the NetBIOS name service.
+const DefaultNetBIOSPort uint16 = 137
+
+// NetBIOS name service constants.  See RFC 1002.
+const (
+	// nbHeaderLen is the length of the name service packet header.
+	nbHeaderLen = 12
+
+	// nbNameLen is the length of a NetBIOS name including the suffix.
+	nbNameLen = 16
+
+	// nbEncodedNameLen is the length of the first-level encoded NetBIOS name.
+	nbEncodedNameLen = 2 * nbNameLen
+
+	// nbTypeNBSTAT is the NODE STATUS resource record type.
+	nbTypeNBSTAT uint16 = 0x21
+
+	// nbClassIN is the Internet class.
+	nbClassIN uint16 = 0x01
+
+	// nbFlagResponse is the flag set in responses.
+	nbFlagResponse uint16 = 0x8000
+
+	// nbFlagGroup is the flag of group names in the node status response.
+	nbFlagGroup uint16 = 0x8000
+
+	// nbNameEntryLen is the length of a name entry of the node status
+	// response.
+	nbNameEntryLen = nbNameLen + 2
+
+	// nbSuffixWorkstation is the suffix of the workstation service name.
+	nbSuffixWorkstation byte = 0x00
+
+	// nbMaxPacketLen is the maximum length of a name service packet.
+	nbMaxPacketLen = 576
+)
+
+// errNBShort is returned when the NetBIOS response is too short.
+const errNBShort errors.Error = "response is too short"
+
+// NetBIOS is the [Resolver] sending NetBIOS node status requests to the
+// devices.  It only resolves IPv4 addresses.
+type NetBIOS struct {
+	// Timeout is the timeout for a single request.
+	Timeout time.Duration
+
+	// Port is the port of the name service, usually [DefaultNetBIOSPort].
+	Port uint16
+}
+
+// type check
+var _ Resolver = (*NetBIOS)(nil)
+
+// Resolve implements the [Resolver] interface for *NetBIOS.
+func (r *NetBIOS) Resolve(ctx context.Context, ip netip.Addr) (host string, err error) {
+	ip = ip.Unmap()
+	if !ip.Is4() {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	d := &net.Dialer{}
+	conn, err := d.DialContext(ctx, "udp", netip.AddrPortFrom(ip, r.Port).String())
+	if err != nil {
+		return "", fmt.Errorf("dialing: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return "", fmt.Errorf("setting deadline: %w", err)
+	}
+
+	id := dns.Id()
+	_, err = conn.Write(newNodeStatusRequest(id))
+	if err != nil {
+		return "", fmt.Errorf("writing request: %w", err)
+	}
+
+	buf := make([]byte, nbMaxPacketLen)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("reading response: %w", err)
+	}
+
+	return parseNodeStatusResponse(id, buf[:n])
+}
+
+// newNodeStatusRequest returns a new node status request for the wildcard
+// name.
+func newNodeStatusRequest(id uint16) (req []byte) {
+	req = make([]byte, 0, nbHeaderLen+nbEncodedNameLen+6)
+
+	// Header with a single question and no flags.
+	req = binary.BigEndian.AppendUint16(req, id)
+	req = append(req, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0)
+
+	// The wildcard name "*" padded with zeroes, first-level encoded.
+	name := [nbNameLen]byte{'*'}
+	req = append(req, nbEncodedNameLen)
+	for _, b := range name {
+		req = append(req, 'A'+b>>4, 'A'+b&0x0f)
+	}
+	req = append(req, 0)
+
+	req = binary.BigEndian.AppendUint16(req, nbTypeNBSTAT)
+	req = binary.BigEndian.AppendUint16(req, nbClassIN)
+
+	return req
+}
+
+// parseNodeStatusResponse returns the workstation name from the node status
+// response to the request with id.
+func parseNodeStatusResponse(id uint16, resp []byte) (host string, err error) {
+	if len(resp) < nbHeaderLen {
+		return "", errNBShort
+	}
+
+	if respID := binary.BigEndian.Uint16(resp); respID != id {
+		return "", fmt.Errorf("unexpected id %d", respID)
+	}
+
+	flags := binary.BigEndian.Uint16(resp[2:])
+	if flags&nbFlagResponse == 0 {
+		return "", errors.Error("not a response")
+	} else if rcode := flags & 0x0f; rcode != 0 {
+		return "", fmt.Errorf("unexpected rcode %d", rcode)
+	}
+
+	if ancount := binary.BigEndian.Uint16(resp[6:]); ancount == 0 {
+		return "", errors.Error("no answers")
+	}
+
+	rdata, err := nodeStatusRData(resp[nbHeaderLen:])
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	num := int(rdata[0])
+	entries := rdata[1:]
+	for i := range num {
+		if len(entries) < (i+1)*nbNameEntryLen {
+			return "", errNBShort
+		}
+
+		e := entries[i*nbNameEntryLen : (i+1)*nbNameEntryLen]
+		entryFlags := binary.BigEndian.Uint16(e[nbNameLen:])
+		if e[nbNameLen-1] == nbSuffixWorkstation && entryFlags&nbFlagGroup == 0 {
+			return strings.TrimRight(string(e[:nbNameLen-1]), " \x00"), nil
+		}
+	}
+
+	return "", nil
+}
+
+// nodeStatusRData returns the non-empty data of the NBSTAT resource record at
+// the beginning of ans.
+func nodeStatusRData(ans []byte) (rdata []byte, err error) {
+	off, err := skipNBName(ans)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	// Type, class, TTL, and data length.
+	if len(ans) < off+10 {
+		return nil, errNBShort
+	}
+
+	if typ := binary.BigEndian.Uint16(ans[off:]); typ != nbTypeNBSTAT {
+		return nil, fmt.Errorf("unexpected record type %d", typ)
+	}
+
+	rdLen := int(binary.BigEndian.Uint16(ans[off+8:]))
+	off += 10
+	if rdLen == 0 || len(ans) < off+rdLen {
+		return nil, errNBShort
+	}
+
+	return ans[off : off+rdLen], nil
+}
+
+// skipNBName returns the offset right after the encoded name at the beginning
+// of b.
+func skipNBName(b []byte) (off int, err error) {
+	for off < len(b) {
+		l := int(b[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			// A compression pointer ends the name.
+			return off + 2, nil
+		default:
+			off += l + 1
+		}
+	}
+
+	return 0, errNBShort
+}
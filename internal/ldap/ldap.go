@@ -0,0 +1,372 @@
+// Package ldap contains an [aghuser.DB] authenticating the web users with the
+// simple bind to an LDAP directory, such as OpenLDAP or Active Directory.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/validate"
+	"github.com/google/uuid"
+)
+
+// LoginPlaceholder is replaced with the escaped login of the user in
+// [Config.BindDN].
+const LoginPlaceholder = "{login}"
+
+// Schemes of the directory URLs.
+const (
+	SchemeLDAP  = "ldap"
+	SchemeLDAPS = "ldaps"
+)
+
+// Default ports of the schemes.
+const (
+	defaultPortLDAP  = "389"
+	defaultPortLDAPS = "636"
+)
+
+// maxLoginLen is the maximum length of a login in bytes.
+const maxLoginLen = 256
+
+// Config is the configuration of the directory.
+type Config struct {
+	// Logger is used for logging the operation of the directory client.  It
+	// must not be nil.
+	Logger *slog.Logger
+
+	// TLSConfig is used for the ldaps connections.  If it's nil, the system
+	// roots are used to verify the certificate of the server.
+	TLSConfig *tls.Config
+
+	// URL is the URL of the directory with the ldaps or the ldap scheme.  The
+	// unencrypted ldap scheme is only allowed for the loopback addresses, so
+	// that the passwords aren't sent in the clear.  It must not be nil.
+	URL *url.URL
+
+	// BindDN is the template of the distinguished names of the users, for
+	// example "uid={login},ou=people,dc=example,dc=org".  It must contain
+	// [LoginPlaceholder] exactly once.
+	BindDN string
+
+	// Role is the role of the users authenticated by the directory.  It must
+	// be valid.
+	Role aghuser.Role
+
+	// Timeout is the timeout for a bind.  It must be positive.
+	Timeout time.Duration
+}
+
+// type check
+var _ validate.Interface = (*Config)(nil)
+
+// Validate implements the [validate.Interface] interface for *Config.
+func (c *Config) Validate() (err error) {
+	if c == nil {
+		return errors.ErrNoValue
+	}
+
+	errs := []error{
+		validate.NotNil("logger", c.Logger),
+		validate.Positive("timeout", c.Timeout),
+		c.Role.Validate(),
+	}
+
+	if n := strings.Count(c.BindDN, LoginPlaceholder); n != 1 {
+		errs = append(errs, fmt.Errorf("bind_dn: must contain %q once, got %d", LoginPlaceholder, n))
+	}
+
+	if c.URL == nil {
+		errs = append(errs, fmt.Errorf("url: %w", errors.ErrNoValue))
+	} else {
+		errs = append(errs, validateURL(c.URL))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateURL returns an error if u isn't a proper directory URL.
+func validateURL(u *url.URL) (err error) {
+	if u.Hostname() == "" {
+		return fmt.Errorf("url: host: %w", errors.ErrEmptyValue)
+	}
+
+	switch u.Scheme {
+	case SchemeLDAPS:
+		return nil
+	case SchemeLDAP:
+		if !isLoopback(u.Hostname()) {
+			return fmt.Errorf("url: scheme %q is only allowed for loopback hosts", u.Scheme)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("url: scheme %q: %w", u.Scheme, errors.ErrBadEnumValue)
+	}
+}
+
+// isLoopback returns true if host is a loopback IP address or localhost.
+func isLoopback(host string) (ok bool) {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip, err := netip.ParseAddr(host)
+
+	return err == nil && ip.IsLoopback()
+}
+
+// DB is the read-only [aghuser.DB] of the users of an LDAP directory.  The
+// directory isn't searched, so any login is considered existing, and it's up
+// to [aghuser.Password.Authenticate] to check it with a bind.
+type DB struct {
+	logger    *slog.Logger
+	tlsConfig *tls.Config
+	url       *url.URL
+	addr      string
+	bindDN    string
+	role      aghuser.Role
+	timeout   time.Duration
+}
+
+// New returns a new properly initialized *DB.  c must not be nil and must be
+// valid.
+func New(c *Config) (db *DB, err error) {
+	err = c.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("ldap: %w", err)
+	}
+
+	db = &DB{
+		logger:  c.Logger,
+		url:     c.URL,
+		bindDN:  c.BindDN,
+		role:    c.Role,
+		timeout: c.Timeout,
+	}
+
+	port := c.URL.Port()
+	if c.URL.Scheme == SchemeLDAPS {
+		db.tlsConfig = c.TLSConfig
+		if db.tlsConfig == nil {
+			db.tlsConfig = &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			}
+		}
+
+		db.tlsConfig = db.tlsConfig.Clone()
+		if db.tlsConfig.ServerName == "" {
+			db.tlsConfig.ServerName = c.URL.Hostname()
+		}
+
+		if port == "" {
+			port = defaultPortLDAPS
+		}
+	} else if port == "" {
+		port = defaultPortLDAP
+	}
+
+	db.addr = net.JoinHostPort(c.URL.Hostname(), port)
+
+	return db, nil
+}
+
+// type check
+var _ aghuser.DB = (*DB)(nil)
+
+// All implements the [aghuser.DB] interface for *DB.  The directory isn't
+// enumerated, so it always returns nil.
+func (db *DB) All(_ context.Context) (users []*aghuser.User, err error) {
+	return nil, nil
+}
+
+// ByLogin implements the [aghuser.DB] interface for *DB.  It returns a user for
+// any valid login, since the existence of the user is checked with a bind.
+func (db *DB) ByLogin(_ context.Context, login aghuser.Login) (u *aghuser.User, err error) {
+	if !isValidLogin(login) {
+		return nil, nil
+	}
+
+	return &aghuser.User{
+		Password: &password{
+			db: db,
+			dn: strings.Replace(db.bindDN, LoginPlaceholder, escapeDN(string(login)), 1),
+		},
+		Login:    login,
+		Role:     db.role,
+		ID:       db.userID(login),
+		External: true,
+	}, nil
+}
+
+// ByUUID implements the [aghuser.DB] interface for *DB.  The directory can't be
+// searched by the IDs, so it always returns nil.
+func (db *DB) ByUUID(_ context.Context, _ aghuser.UserID) (u *aghuser.User, err error) {
+	return nil, nil
+}
+
+// Create implements the [aghuser.DB] interface for *DB.  It always returns
+// [errors.ErrUnsupported].
+func (db *DB) Create(_ context.Context, _ *aghuser.User) (err error) {
+	return errors.ErrUnsupported
+}
+
+// Update implements the [aghuser.DB] interface for *DB.  It always returns
+// [errors.ErrUnsupported].
+func (db *DB) Update(_ context.Context, _ *aghuser.User) (err error) {
+	return errors.ErrUnsupported
+}
+
+// Delete implements the [aghuser.DB] interface for *DB.  It always returns
+// [errors.ErrUnsupported].
+func (db *DB) Delete(_ context.Context, _ aghuser.UserID) (err error) {
+	return errors.ErrUnsupported
+}
+
+// userID returns the stable ID of the user with login.
+func (db *DB) userID(login aghuser.Login) (id aghuser.UserID) {
+	name := db.url.String() + "#" + string(login)
+
+	return aghuser.UserID(uuid.NewSHA1(uuid.NameSpaceURL, []byte(name)))
+}
+
+// isValidLogin returns true if login may be sent to the directory.
+func isValidLogin(login aghuser.Login) (ok bool) {
+	if login == "" || len(login) > maxLoginLen || !utf8.ValidString(string(login)) {
+		return false
+	}
+
+	return !strings.ContainsFunc(string(login), unicode.IsControl)
+}
+
+// escapeDN escapes the special characters of s for use as an attribute value
+// in a distinguished name, see RFC 4514.
+func escapeDN(s string) (escaped string) {
+	b := &strings.Builder{}
+	for i, r := range s {
+		switch {
+		case
+			strings.ContainsRune(`"+,;<=>\`, r),
+			r == '#' && i == 0,
+			r == ' ' && (i == 0 || i == len(s)-1):
+			b.WriteByte('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// bind performs the simple bind with dn and password.
+func (db *DB) bind(ctx context.Context, dn, password string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, db.timeout)
+	defer cancel()
+
+	conn, err := db.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+
+	const bindID = 1
+	req, err := marshalBindRequest(bindID, dn, password)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return fmt.Errorf("sending bind request: %w", err)
+	}
+
+	resp, err := readMessage(conn)
+	if err != nil {
+		return fmt.Errorf("reading bind response: %w", err)
+	}
+
+	err = parseBindResponse(resp, bindID)
+	if err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+
+	unbind, err := marshalUnbindRequest(bindID + 1)
+	if err == nil {
+		// The server closes the connection without a response, so ignore the
+		// errors.
+		_, _ = conn.Write(unbind)
+	}
+
+	return nil
+}
+
+// dial connects to the directory.
+func (db *DB) dial(ctx context.Context) (conn net.Conn, err error) {
+	if db.tlsConfig == nil {
+		d := &net.Dialer{}
+
+		return d.DialContext(ctx, "tcp", db.addr)
+	}
+
+	d := &tls.Dialer{Config: db.tlsConfig}
+
+	return d.DialContext(ctx, "tcp", db.addr)
+}
+
+// password is the [aghuser.Password] of a directory user.
+type password struct {
+	db *DB
+	dn string
+}
+
+// type check
+var _ aghuser.Password = (*password)(nil)
+
+// Authenticate implements the [aghuser.Password] interface for *password.
+func (p *password) Authenticate(ctx context.Context, passwd string) (ok bool) {
+	// An empty password makes an unauthenticated bind, which the servers
+	// usually allow, so it must never be sent.
+	if passwd == "" {
+		return false
+	}
+
+	err := p.db.bind(ctx, p.dn, passwd)
+	if err == nil {
+		return true
+	}
+
+	resErr := &resultError{}
+	if errors.As(err, &resErr) && resErr.code == resultInvalidCredentials {
+		p.db.logger.DebugContext(ctx, "invalid credentials", "dn", p.dn)
+	} else {
+		p.db.logger.ErrorContext(ctx, "authenticating", "dn", p.dn, slogutil.KeyError, err)
+	}
+
+	return false
+}
+
+// Hash implements the [aghuser.Password] interface for *password.  The
+// passwords are stored by the directory, so it always returns nil.
+func (p *password) Hash() (b []byte) {
+	return nil
+}
@@ -0,0 +1,136 @@
+package ldap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeDN(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   string
+		want string
+	}{{
+		name: "plain",
+		in:   "user",
+		want: "user",
+	}, {
+		name: "special",
+		in:   `a"b+c,d;e<f=g>h\i`,
+		want: `a\"b\+c\,d\;e\<f\=g\>h\\i`,
+	}, {
+		name: "leading_hash",
+		in:   "#user#",
+		want: `\#user#`,
+	}, {
+		name: "spaces",
+		in:   " us er ",
+		want: `\ us er\ `,
+	}, {
+		name: "single_space",
+		in:   " ",
+		want: `\ `,
+	}, {
+		name: "injection",
+		in:   "user,ou=admins",
+		want: `user\,ou\=admins`,
+	}, {
+		name: "unicode",
+		in:   "пользователь",
+		want: "пользователь",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, escapeDN(tc.in))
+		})
+	}
+}
+
+func TestIsValidLogin(t *testing.T) {
+	testCases := []struct {
+		name  string
+		login aghuser.Login
+		want  bool
+	}{{
+		name:  "valid",
+		login: "user",
+		want:  true,
+	}, {
+		name:  "empty",
+		login: "",
+		want:  false,
+	}, {
+		name:  "too_long",
+		login: aghuser.Login(strings.Repeat("a", maxLoginLen+1)),
+		want:  false,
+	}, {
+		name:  "max_len",
+		login: aghuser.Login(strings.Repeat("a", maxLoginLen)),
+		want:  true,
+	}, {
+		name:  "nul",
+		login: "user\x00",
+		want:  false,
+	}, {
+		name:  "newline",
+		login: "user\n",
+		want:  false,
+	}, {
+		name:  "bad_utf8",
+		login: "user\xff",
+		want:  false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, isValidLogin(tc.login))
+		})
+	}
+}
+
+// unescapeDN is the reverse of [escapeDN] for tests.
+func unescapeDN(s string) (unescaped string) {
+	b := &strings.Builder{}
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+
+			continue
+		}
+
+		escaped = false
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func FuzzEscapeDN(f *testing.F) {
+	for _, seed := range []string{"user", `#a,b+c\ `, " ", "пользователь"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, login string) {
+		if !isValidLogin(aghuser.Login(login)) {
+			return
+		}
+
+		escaped := escapeDN(login)
+		assert.Equal(t, login, unescapeDN(escaped))
+
+		// The escaped value must not end a relative distinguished name.
+		for i := 0; i < len(escaped); i++ {
+			switch escaped[i] {
+			case '\\':
+				i++
+			case ',', '+', ';', '=':
+				t.Fatalf("unescaped %q at %d in %q", escaped[i], i, escaped)
+			}
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package ldap_test
+
+import (
+	"encoding/asn1"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghuser"
+	"github.com/AdguardTeam/AdGuardHome/internal/ldap"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// Test credentials of the directory.
+const (
+	testLogin    = `o'neil, jr`
+	testDN       = `uid=o'neil\, jr,ou=people,dc=example,dc=org`
+	testPassword = "password"
+)
+
+// bindRequest is the simple BindRequest as decoded by the test server.
+type bindRequest struct {
+	Version  int
+	Name     []byte
+	Password []byte `asn1:"tag:0"`
+}
+
+// bindResponse is the BindResponse sent by the test server.
+type bindResponse struct {
+	Code       asn1.Enumerated
+	MatchedDN  []byte
+	Diagnostic []byte
+}
+
+// message is the LDAPMessage envelope.
+type message struct {
+	ID int
+	Op asn1.RawValue
+}
+
+// startServer starts a test directory server that only accepts the bind of
+// [testDN] with [testPassword] and returns its URL.
+func startServer(t *testing.T) (u *url.URL) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	go func() {
+		for {
+			conn, aErr := l.Accept()
+			if aErr != nil {
+				return
+			}
+
+			go serveConn(conn)
+		}
+	}()
+
+	return &url.URL{Scheme: ldap.SchemeLDAP, Host: l.Addr().String()}
+}
+
+// serveConn handles a single bind request on conn.
+func serveConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return
+	}
+
+	msg := &message{}
+	_, err = asn1.Unmarshal(buf[:n], msg)
+	if err != nil {
+		return
+	}
+
+	req := &bindRequest{}
+	_, err = asn1.UnmarshalWithParams(msg.Op.FullBytes, req, "application,tag:0")
+	if err != nil {
+		return
+	}
+
+	resp := bindResponse{Code: 49, Diagnostic: []byte("invalid credentials")}
+	if string(req.Name) == testDN && string(req.Password) == testPassword {
+		resp = bindResponse{Code: 0}
+	}
+
+	op, err := asn1.MarshalWithParams(resp, "application,tag:1")
+	if err != nil {
+		return
+	}
+
+	data, err := asn1.Marshal(message{ID: msg.ID, Op: asn1.RawValue{FullBytes: op}})
+	if err != nil {
+		return
+	}
+
+	_, _ = conn.Write(data)
+}
+
+func TestDB(t *testing.T) {
+	db, err := ldap.New(&ldap.Config{
+		Logger:  slogutil.NewDiscardLogger(),
+		URL:     startServer(t),
+		BindDN:  "uid=" + ldap.LoginPlaceholder + ",ou=people,dc=example,dc=org",
+		Role:    aghuser.RoleReadOnly,
+		Timeout: testTimeout,
+	})
+	require.NoError(t, err)
+
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	u, err := db.ByLogin(ctx, testLogin)
+	require.NoError(t, err)
+	require.NotNil(t, u)
+
+	assert.Equal(t, aghuser.RoleReadOnly, u.Role)
+	assert.True(t, u.External)
+	assert.True(t, u.Password.Authenticate(ctx, testPassword))
+	assert.False(t, u.Password.Authenticate(ctx, "wrong"))
+	assert.False(t, u.Password.Authenticate(ctx, ""))
+
+	again, err := db.ByLogin(ctx, testLogin)
+	require.NoError(t, err)
+
+	assert.Equal(t, u.ID, again.ID)
+
+	u, err = db.ByLogin(ctx, "bad\nlogin")
+	require.NoError(t, err)
+
+	assert.Nil(t, u)
+
+	err = db.Create(ctx, &aghuser.User{Login: "new"})
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	const bindDN = "uid=" + ldap.LoginPlaceholder + ",dc=example,dc=org"
+
+	testCases := []struct {
+		url        *url.URL
+		name       string
+		bindDN     string
+		wantErrMsg string
+	}{{
+		url:        &url.URL{Scheme: ldap.SchemeLDAPS, Host: "ldap.example.org"},
+		name:       "ldaps",
+		bindDN:     bindDN,
+		wantErrMsg: "",
+	}, {
+		url:        &url.URL{Scheme: ldap.SchemeLDAP, Host: "localhost:389"},
+		name:       "ldap_loopback",
+		bindDN:     bindDN,
+		wantErrMsg: "",
+	}, {
+		url:        &url.URL{Scheme: ldap.SchemeLDAP, Host: "ldap.example.org"},
+		name:       "ldap_remote",
+		bindDN:     bindDN,
+		wantErrMsg: `url: scheme "ldap" is only allowed for loopback hosts`,
+	}, {
+		url:        &url.URL{Scheme: ldap.SchemeLDAPS, Host: "ldap.example.org"},
+		name:       "no_placeholder",
+		bindDN:     "uid=admin,dc=example,dc=org",
+		wantErrMsg: `bind_dn: must contain "{login}" once, got 0`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &ldap.Config{
+				Logger:  slogutil.NewDiscardLogger(),
+				URL:     tc.url,
+				BindDN:  tc.bindDN,
+				Role:    aghuser.RoleReadOnly,
+				Timeout: testTimeout,
+			}
+
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, c.Validate())
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package ldap
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"io"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// LDAP protocol constants, see RFC 4511.
+const (
+	// protocolVersion is the version of the LDAP protocol.
+	protocolVersion = 3
+
+	// tagBindRequest is the application tag of BindRequest.
+	tagBindRequest = 0
+
+	// tagBindResponse is the application tag of BindResponse.
+	tagBindResponse = 1
+
+	// tagUnbindRequest is the application tag of UnbindRequest.
+	tagUnbindRequest = 2
+
+	// tagSequence is the identifier octet of a constructed universal
+	// SEQUENCE, which every LDAPMessage is.
+	tagSequence = 0x30
+
+	// maxMessageLen is the maximum length of a response message.  The bind
+	// responses are much shorter.
+	maxMessageLen = 64 * 1024
+)
+
+// LDAP result codes.
+const (
+	resultSuccess            asn1.Enumerated = 0
+	resultInvalidCredentials asn1.Enumerated = 49
+)
+
+// message is the LDAPMessage envelope.  The optional controls are ignored.
+type message struct {
+	ID int
+	Op asn1.RawValue
+}
+
+// bindRequest is the simple BindRequest.
+type bindRequest struct {
+	Version  int
+	Name     []byte
+	Password []byte `asn1:"tag:0"`
+}
+
+// resultError is returned when the server responds with a non-success result
+// code.
+type resultError struct {
+	diagnostic string
+	code       asn1.Enumerated
+}
+
+// type check
+var _ error = (*resultError)(nil)
+
+// Error implements the error interface for *resultError.
+func (err *resultError) Error() (msg string) {
+	if err.diagnostic == "" {
+		return fmt.Sprintf("result code %d", err.code)
+	}
+
+	return fmt.Sprintf("result code %d: %s", err.code, err.diagnostic)
+}
+
+// marshalBindRequest returns the encoded simple bind request message.
+func marshalBindRequest(id int, dn, password string) (data []byte, err error) {
+	op, err := asn1.MarshalWithParams(bindRequest{
+		Version:  protocolVersion,
+		Name:     []byte(dn),
+		Password: []byte(password),
+	}, fmt.Sprintf("application,tag:%d", tagBindRequest))
+	if err != nil {
+		return nil, fmt.Errorf("encoding bind request: %w", err)
+	}
+
+	return asn1.Marshal(message{ID: id, Op: asn1.RawValue{FullBytes: op}})
+}
+
+// marshalUnbindRequest returns the encoded unbind request message.
+func marshalUnbindRequest(id int) (data []byte, err error) {
+	return asn1.Marshal(message{ID: id, Op: asn1.RawValue{
+		Class: asn1.ClassApplication,
+		Tag:   tagUnbindRequest,
+	}})
+}
+
+// readMessage reads a single encoded message from r.
+func readMessage(r io.Reader) (data []byte, err error) {
+	hdr := make([]byte, 2)
+	_, err = io.ReadFull(r, hdr)
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	if hdr[0] != tagSequence {
+		return nil, fmt.Errorf("unexpected tag %#x", hdr[0])
+	}
+
+	data = hdr
+	l := int(hdr[1])
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("bad length of length %d", n)
+		}
+
+		lenData := make([]byte, n)
+		_, err = io.ReadFull(r, lenData)
+		if err != nil {
+			return nil, fmt.Errorf("reading length: %w", err)
+		}
+
+		data = append(data, lenData...)
+
+		// Use uint64 to not overflow int on 32-bit platforms.
+		var ul uint64
+		for _, b := range lenData {
+			ul = ul<<8 | uint64(b)
+		}
+
+		if ul > maxMessageLen {
+			return nil, fmt.Errorf("message length %d: %w", ul, errors.ErrOutOfRange)
+		}
+
+		l = int(ul)
+	}
+
+	body := make([]byte, l)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+
+	return append(data, body...), nil
+}
+
+// parseBindResponse returns nil if data is the successful response to the
+// bind request with id.  If the server has refused the bind, the error is
+// a *resultError.
+func parseBindResponse(data []byte, id int) (err error) {
+	msg := &message{}
+	_, err = asn1.Unmarshal(data, msg)
+	if err != nil {
+		return fmt.Errorf("decoding message: %w", err)
+	}
+
+	if msg.ID != id {
+		return fmt.Errorf("message id: got %d, want %d", msg.ID, id)
+	} else if msg.Op.Class != asn1.ClassApplication || msg.Op.Tag != tagBindResponse {
+		return fmt.Errorf("unexpected operation %d of class %d", msg.Op.Tag, msg.Op.Class)
+	}
+
+	var code asn1.Enumerated
+	rest, err := asn1.Unmarshal(msg.Op.Bytes, &code)
+	if err != nil {
+		return fmt.Errorf("decoding result code: %w", err)
+	}
+
+	if code == resultSuccess {
+		return nil
+	}
+
+	resErr := &resultError{code: code}
+
+	var matchedDN, diagnostic []byte
+	rest, err = asn1.Unmarshal(rest, &matchedDN)
+	if err == nil {
+		_, err = asn1.Unmarshal(rest, &diagnostic)
+	}
+
+	if err == nil {
+		resErr.diagnostic = string(diagnostic)
+	}
+
+	return resErr
+}
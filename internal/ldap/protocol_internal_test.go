@@ -0,0 +1,226 @@
+package ldap
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMessage(t *testing.T) {
+	longBody := bytes.Repeat([]byte{0x04}, 0x100)
+	longMsg := append([]byte{tagSequence, 0x82, 0x01, 0x00}, longBody...)
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		in         []byte
+		want       []byte
+	}{{
+		name:       "short",
+		wantErrMsg: "",
+		in:         []byte{tagSequence, 0x03, 0x02, 0x01, 0x01, 0xff},
+		want:       []byte{tagSequence, 0x03, 0x02, 0x01, 0x01},
+	}, {
+		name:       "long",
+		wantErrMsg: "",
+		in:         longMsg,
+		want:       longMsg,
+	}, {
+		name:       "empty",
+		wantErrMsg: "reading header: EOF",
+		in:         nil,
+		want:       nil,
+	}, {
+		name:       "truncated_header",
+		wantErrMsg: "reading header: unexpected EOF",
+		in:         []byte{tagSequence},
+		want:       nil,
+	}, {
+		name:       "wrong_tag",
+		wantErrMsg: "unexpected tag 0x31",
+		in:         []byte{0x31, 0x00},
+		want:       nil,
+	}, {
+		name:       "primitive_tag",
+		wantErrMsg: "unexpected tag 0x10",
+		in:         []byte{0x10, 0x00},
+		want:       nil,
+	}, {
+		name:       "indefinite_length",
+		wantErrMsg: "bad length of length 0",
+		in:         []byte{tagSequence, 0x80, 0x02, 0x01, 0x01, 0x00, 0x00},
+		want:       nil,
+	}, {
+		name:       "length_of_length_too_big",
+		wantErrMsg: "bad length of length 5",
+		in:         []byte{tagSequence, 0x85, 0x00, 0x00, 0x00, 0x00, 0x01},
+		want:       nil,
+	}, {
+		name:       "truncated_length",
+		wantErrMsg: "reading length: unexpected EOF",
+		in:         []byte{tagSequence, 0x82, 0x01},
+		want:       nil,
+	}, {
+		name:       "oversized",
+		wantErrMsg: "message length 65537: out of range",
+		in:         []byte{tagSequence, 0x83, 0x01, 0x00, 0x01},
+		want:       nil,
+	}, {
+		name:       "oversized_max",
+		wantErrMsg: "message length 4294967295: out of range",
+		in:         []byte{tagSequence, 0x84, 0xff, 0xff, 0xff, 0xff},
+		want:       nil,
+	}, {
+		name:       "truncated_body",
+		wantErrMsg: "reading body: unexpected EOF",
+		in:         longMsg[:len(longMsg)-1],
+		want:       nil,
+	}, {
+		name:       "no_body",
+		wantErrMsg: "reading body: EOF",
+		in:         []byte{tagSequence, 0x01},
+		want:       nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := readMessage(bytes.NewReader(tc.in))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, data)
+		})
+	}
+}
+
+// newTestBindResponse returns an encoded BindResponse message with the given
+// message ID, operation tag, and operation contents.
+func newTestBindResponse(tb testing.TB, id, tag int, contents []byte) (data []byte) {
+	tb.Helper()
+
+	data, err := asn1.Marshal(message{
+		ID: id,
+		Op: asn1.RawValue{
+			Class:      asn1.ClassApplication,
+			Tag:        tag,
+			IsCompound: true,
+			Bytes:      contents,
+		},
+	})
+	require.NoError(tb, err)
+
+	return data
+}
+
+func TestParseBindResponse(t *testing.T) {
+	const testID = 1
+
+	// The encoded result code, matched DN, and diagnostic message.
+	success := []byte{0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00}
+	invalidCreds := []byte{0x0a, 0x01, 0x31, 0x04, 0x00, 0x04, 0x03, 'b', 'a', 'd'}
+
+	validMsg := newTestBindResponse(t, testID, tagBindResponse, success)
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		in         []byte
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		in:         validMsg,
+	}, {
+		name:       "invalid_credentials",
+		wantErrMsg: "result code 49: bad",
+		in:         newTestBindResponse(t, testID, tagBindResponse, invalidCreds),
+	}, {
+		name:       "no_diagnostic",
+		wantErrMsg: "result code 49",
+		in:         newTestBindResponse(t, testID, tagBindResponse, invalidCreds[:3]),
+	}, {
+		name:       "truncated_diagnostic",
+		wantErrMsg: "result code 49",
+		in: newTestBindResponse(
+			t,
+			testID,
+			tagBindResponse,
+			invalidCreds[:len(invalidCreds)-1],
+		),
+	}, {
+		name:       "empty",
+		wantErrMsg: "decoding message: asn1: syntax error: sequence truncated",
+		in:         nil,
+	}, {
+		name:       "truncated",
+		wantErrMsg: "decoding message: asn1: syntax error: data truncated",
+		in:         validMsg[:len(validMsg)-1],
+	}, {
+		name:       "oversized_length",
+		wantErrMsg: "decoding message: asn1: syntax error: data truncated",
+		in:         append([]byte{tagSequence, 0x84, 0x7f, 0xff, 0xff, 0xff}, validMsg[2:]...),
+	}, {
+		name:       "indefinite_length",
+		wantErrMsg: "decoding message: asn1: syntax error: indefinite length found (not DER)",
+		in:         append([]byte{tagSequence, 0x80}, append(validMsg[2:], 0x00, 0x00)...),
+	}, {
+		name:       "wrong_id",
+		wantErrMsg: "message id: got 2, want 1",
+		in:         newTestBindResponse(t, testID+1, tagBindResponse, success),
+	}, {
+		name:       "wrong_operation",
+		wantErrMsg: "unexpected operation 0 of class 1",
+		in:         newTestBindResponse(t, testID, tagBindRequest, success),
+	}, {
+		name:       "no_result_code",
+		wantErrMsg: "decoding result code: asn1: syntax error: sequence truncated",
+		in:         newTestBindResponse(t, testID, tagBindResponse, nil),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, parseBindResponse(tc.in, testID))
+		})
+	}
+}
+
+func FuzzReadMessage(f *testing.F) {
+	f.Add([]byte{tagSequence, 0x03, 0x02, 0x01, 0x01})
+	f.Add([]byte{tagSequence, 0x82, 0x00, 0x03, 0x02, 0x01, 0x01})
+	f.Add([]byte{tagSequence, 0x84, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{tagSequence, 0x80, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		data, err := readMessage(bytes.NewReader(in))
+		if err != nil {
+			return
+		}
+
+		// The message must be a prefix of the input and not exceed the limit.
+		require.True(t, bytes.HasPrefix(in, data))
+
+		assert.LessOrEqual(t, len(data), maxMessageLen+6)
+	})
+}
+
+func FuzzParseBindResponse(f *testing.F) {
+	f.Add(newTestBindResponse(f, 1, tagBindResponse, []byte{0x0a, 0x01, 0x00}))
+	f.Add(newTestBindResponse(
+		f,
+		1,
+		tagBindResponse,
+		[]byte{0x0a, 0x01, 0x31, 0x04, 0x00, 0x04, 0x03, 'b', 'a', 'd'},
+	))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		err := parseBindResponse(data, 1)
+		if err == nil {
+			return
+		}
+
+		// Make sure that the error message can be built.
+		assert.NotEmpty(t, err.Error())
+	})
+}
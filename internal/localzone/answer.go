@@ -0,0 +1,146 @@
+package localzone
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// SOA timers of the zone, in seconds.  Those are only used by the secondary
+// servers.
+const (
+	soaRefresh = 3600
+	soaRetry   = 600
+	soaExpire  = 604800
+)
+
+// Answer returns the authoritative response to req, if the zone is
+// responsible for the question.  ok is false if the zone knows nothing about
+// the requested name, so that the request should be processed further.  req
+// must contain exactly one question.
+func (z *Zone) Answer(ctx context.Context, req *dns.Msg) (resp *dns.Msg, ok bool) {
+	q := req.Question[0]
+	if q.Qclass != dns.ClassINET || isTransferType(q.Qtype) {
+		return nil, false
+	}
+
+	name := dns.CanonicalName(q.Name)
+	v := z.load(ctx)
+	now := time.Now()
+
+	if strings.HasSuffix(name, ".arpa.") {
+		return z.answerPTR(req, v, name, now)
+	}
+
+	if !dns.IsSubDomain(z.origin, name) {
+		return nil, false
+	}
+
+	resp = z.newResponse(req)
+	if name == z.origin {
+		if q.Qtype == dns.TypeSOA {
+			resp.Answer = append(resp.Answer, z.soa(v.serial))
+		} else {
+			resp.Ns = append(resp.Ns, z.soa(v.serial))
+		}
+
+		return resp, true
+	}
+
+	entries, ok := v.byName[name]
+	if !ok {
+		// Let the rewrites and upstreams process the names unknown to the
+		// zone.
+		return nil, false
+	}
+
+	for _, e := range entries {
+		if (q.Qtype == dns.TypeA && e.addr.Is4()) || (q.Qtype == dns.TypeAAAA && e.addr.Is6()) {
+			rr := z.newAddrRR(e, now)
+			rr.Header().Name = q.Name
+			resp.Answer = append(resp.Answer, rr)
+		}
+	}
+
+	if len(resp.Answer) == 0 {
+		// Respond with NODATA.
+		resp.Ns = append(resp.Ns, z.soa(v.serial))
+	}
+
+	return resp, true
+}
+
+// answerPTR returns the response to the PTR request for the reversed address
+// arpa, if the address belongs to the zone.
+func (z *Zone) answerPTR(
+	req *dns.Msg,
+	v *version,
+	arpa string,
+	now time.Time,
+) (resp *dns.Msg, ok bool) {
+	addr, err := netutil.IPFromReversedAddr(arpa)
+	if err != nil {
+		return nil, false
+	}
+
+	e, ok := v.byAddr[addr.Unmap()]
+	if !ok {
+		return nil, false
+	}
+
+	resp = z.newResponse(req)
+
+	q := req.Question[0]
+	if q.Qtype == dns.TypePTR {
+		rr := z.newAddrRR(e, now)
+		resp.Answer = append(resp.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   q.Name,
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    rr.Header().Ttl,
+			},
+			Ptr: e.name,
+		})
+	}
+
+	return resp, true
+}
+
+// newResponse returns a new authoritative response to req.
+func (z *Zone) newResponse(req *dns.Msg) (resp *dns.Msg) {
+	resp = (&dns.Msg{}).SetReply(req)
+	resp.Authoritative = true
+	resp.RecursionAvailable = true
+
+	return resp
+}
+
+// soa returns the SOA record of the zone with the given serial number.
+func (z *Zone) soa(serial uint32) (rr *dns.SOA) {
+	ttl := uint32(z.maxTTL.Seconds())
+
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   z.origin,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Ns:      z.origin,
+		Mbox:    "hostmaster." + z.origin,
+		Serial:  serial,
+		Refresh: soaRefresh,
+		Retry:   soaRetry,
+		Expire:  soaExpire,
+		Minttl:  ttl,
+	}
+}
+
+// isTransferType returns true if qtype is a type of the zone transfer request.
+func isTransferType(qtype uint16) (ok bool) {
+	return qtype == dns.TypeAXFR || qtype == dns.TypeIXFR
+}
@@ -0,0 +1,482 @@
+// Package localzone contains an authoritative DNS zone of the local network
+// built from the DHCP leases, static rewrites, and system hosts files.
+package localzone
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/validate"
+	"github.com/miekg/dns"
+)
+
+// Source is the kind of the record source.
+type Source string
+
+// Valid sources.
+const (
+	SourceRewrite Source = "rewrite"
+	SourceHosts   Source = "hosts"
+	SourceDHCP    Source = "dhcp"
+)
+
+// Record is an address of a host within the local zone.
+type Record struct {
+	// Expiry is the time the record expires, for example the expiration time
+	// of the DHCP lease.  The zero value means that the record never expires.
+	Expiry time.Time
+
+	// Addr is the address of the host.
+	Addr netip.Addr
+
+	// Host is the hostname, either a single label or a fully-qualified name
+	// within the zone.  The records having other names are ignored.
+	Host string
+
+	// Owner identifies the device the record belongs to, for example the
+	// hardware address of a DHCP client.  Records of the same source having
+	// the same hostname but different owners conflict with each other.
+	Owner string
+
+	// Source is the kind of the record source.
+	Source Source
+}
+
+// RecordSource provides the records of the zone.
+type RecordSource interface {
+	// Records returns the current records.  The returned records must not be
+	// modified by the caller.
+	Records(ctx context.Context) (recs []*Record)
+}
+
+// RecordSourceFunc is a function implementing the [RecordSource] interface.
+type RecordSourceFunc func(ctx context.Context) (recs []*Record)
+
+// type check
+var _ RecordSource = RecordSourceFunc(nil)
+
+// Records implements the [RecordSource] interface for RecordSourceFunc.
+func (f RecordSourceFunc) Records(ctx context.Context) (recs []*Record) {
+	return f(ctx)
+}
+
+// Config is the configuration of the local zone.
+type Config struct {
+	// Logger is used to log the zone changes.  It must not be nil.
+	Logger *slog.Logger
+
+	// Origin is the name of the zone, for example "lan".  It must be a valid
+	// domain name.
+	Origin string
+
+	// Sources are the sources of the records in the order of priority, so
+	// that the records from the former ones keep their names in case of
+	// conflicts.
+	Sources []RecordSource
+
+	// TransferAllowed are the networks of secondary servers allowed to
+	// transfer the zone.  If empty, zone transfers are refused.
+	TransferAllowed []netip.Prefix
+
+	// MaxTTL is the TTL of the records that never expire and the upper bound
+	// for the TTL of the others.  It must be positive.
+	MaxTTL time.Duration
+
+	// RefreshInterval is the minimum interval between rebuilding the zone from
+	// the sources.  It must be positive.
+	RefreshInterval time.Duration
+
+	// JournalSize is the number of the latest zone changes kept for
+	// incremental zone transfers.  It must not be negative.
+	JournalSize int
+}
+
+// type check
+var _ validate.Interface = (*Config)(nil)
+
+// Validate implements the [validate.Interface] interface for *Config.
+func (c *Config) Validate() (err error) {
+	if c == nil {
+		return errors.ErrNoValue
+	}
+
+	errs := []error{
+		validate.NotNil("Logger", c.Logger),
+		validate.Positive("MaxTTL", c.MaxTTL),
+		validate.Positive("RefreshInterval", c.RefreshInterval),
+		validate.NotNegative("JournalSize", c.JournalSize),
+	}
+
+	err = netutil.ValidateDomainName(c.Origin)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("origin: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Zone is the authoritative DNS zone of the local network.
+type Zone struct {
+	// logger is used to log the zone changes.
+	logger *slog.Logger
+
+	// mu protects the fields below it.
+	mu *sync.Mutex
+
+	// current is the latest version of the zone.
+	current *version
+
+	// journal are the latest changes of the zone, from the oldest to the
+	// newest.
+	journal []*change
+
+	// lastRefresh is the time of the latest rebuilding of the zone.
+	lastRefresh time.Time
+
+	// origin is the fully-qualified lowercased name of the zone.
+	origin string
+
+	// sources are the sources of the records.
+	sources []RecordSource
+
+	// transferAllowed are the networks allowed to transfer the zone.
+	transferAllowed []netip.Prefix
+
+	// maxTTL is the TTL for the static records.
+	maxTTL time.Duration
+
+	// refreshIvl is the minimum interval between rebuilds.
+	refreshIvl time.Duration
+
+	// journalSize is the maximum length of journal.
+	journalSize int
+}
+
+// New returns a new local zone.  c must be valid.
+func New(c *Config) (z *Zone) {
+	z = &Zone{
+		logger:          c.Logger,
+		mu:              &sync.Mutex{},
+		origin:          dns.CanonicalName(c.Origin),
+		sources:         c.Sources,
+		transferAllowed: c.TransferAllowed,
+		maxTTL:          c.MaxTTL,
+		refreshIvl:      c.RefreshInterval,
+		journalSize:     c.JournalSize,
+	}
+	z.current = &version{
+		serial: uint32(time.Now().Unix()),
+		byName: map[string][]*entry{},
+		byAddr: map[netip.Addr]*entry{},
+	}
+
+	return z
+}
+
+// Origin returns the fully-qualified name of the zone.
+func (z *Zone) Origin() (origin string) {
+	return z.origin
+}
+
+// entry is a single address record within the zone.
+type entry struct {
+	// expiry is the time the record expires, if any.
+	expiry time.Time
+
+	// addr is the address of the host.
+	addr netip.Addr
+
+	// name is the lowercased fully-qualified name of the host.
+	name string
+}
+
+// compareEntries compares a and b by their names and then by their addresses.
+func compareEntries(a, b *entry) (res int) {
+	if res = strings.Compare(a.name, b.name); res != 0 {
+		return res
+	}
+
+	return a.addr.Compare(b.addr)
+}
+
+// version is a single version of the zone.
+type version struct {
+	// byName are the address records by their lowercased fully-qualified
+	// names.
+	byName map[string][]*entry
+
+	// byAddr are the records by the addresses.  If several hosts share the
+	// same address, the first one by priority is used.
+	byAddr map[netip.Addr]*entry
+
+	// entries are all the address records sorted with [compareEntries].
+	entries []*entry
+
+	// serial is the serial number of the version.
+	serial uint32
+}
+
+// change is the difference between two consequent versions of the zone.
+type change struct {
+	// deleted are the records removed in the newer version.
+	deleted []*entry
+
+	// added are the records added in the newer version.
+	added []*entry
+
+	// from is the serial number of the older version.
+	from uint32
+
+	// to is the serial number of the newer version.
+	to uint32
+}
+
+// load returns the current version of the zone, rebuilding it from the
+// sources if needed.
+func (z *Zone) load(ctx context.Context) (v *version) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(z.lastRefresh) < z.refreshIvl {
+		return z.current
+	}
+
+	z.lastRefresh = now
+
+	next := z.build(ctx, now)
+	deleted, added := diff(z.current.entries, next.entries)
+	if len(deleted) == 0 && len(added) == 0 {
+		// Still update the expiration times of the records.
+		next.serial = z.current.serial
+		z.current = next
+
+		return next
+	}
+
+	// Keep the serial increasing even if the zone changes more often than
+	// once a second.
+	next.serial = max(uint32(now.Unix()), z.current.serial+1)
+
+	if z.journalSize > 0 {
+		z.journal = append(z.journal, &change{
+			deleted: deleted,
+			added:   added,
+			from:    z.current.serial,
+			to:      next.serial,
+		})
+		if len(z.journal) > z.journalSize {
+			z.journal = slices.Delete(z.journal, 0, len(z.journal)-z.journalSize)
+		}
+	}
+
+	z.logger.DebugContext(
+		ctx,
+		"zone changed",
+		"serial", next.serial,
+		"added", len(added),
+		"deleted", len(deleted),
+	)
+
+	z.current = next
+
+	return next
+}
+
+// owner is a set of records of a single device under a single hostname.
+type owner struct {
+	// host is the lowercased hostname relative to the zone origin.
+	host string
+
+	// recs are the records of the owner.
+	recs []*Record
+
+	// priority is the index of the source of the records.
+	priority int
+
+	// static is true if none of the records expires.
+	static bool
+}
+
+// build returns a new version of the zone built from the sources.  The serial
+// number of the returned version isn't set.
+func (z *Zone) build(ctx context.Context, now time.Time) (v *version) {
+	var owners []*owner
+	byKey := map[string]*owner{}
+	for i, src := range z.sources {
+		for _, r := range src.Records(ctx) {
+			host, ok := z.relativeHost(r.Host)
+			if !ok || !isServable(r, now) {
+				continue
+			}
+
+			key := strconv.Itoa(i) + "/" + string(r.Source) + "/" + r.Owner + "/" + host
+			o := byKey[key]
+			if o == nil {
+				o = &owner{
+					host:     host,
+					priority: i,
+					static:   true,
+				}
+				byKey[key] = o
+				owners = append(owners, o)
+			}
+
+			o.recs = append(o.recs, r)
+			o.static = o.static && r.Expiry.IsZero()
+		}
+	}
+
+	// Sort owners so that the ones of the higher priority, static ones, and
+	// then the ones expiring later get the names without suffixes.
+	slices.SortStableFunc(owners, func(a, b *owner) (res int) {
+		if a.priority != b.priority {
+			return a.priority - b.priority
+		} else if a.static != b.static {
+			if a.static {
+				return -1
+			}
+
+			return 1
+		}
+
+		return strings.Compare(a.host+a.recs[0].Owner, b.host+b.recs[0].Owner)
+	})
+
+	v = &version{
+		byName: map[string][]*entry{},
+		byAddr: map[netip.Addr]*entry{},
+	}
+
+	taken := map[string]struct{}{}
+	for _, o := range owners {
+		name := z.uniqueName(ctx, o.host, taken)
+		taken[name] = struct{}{}
+
+		fqdn := name + "." + z.origin
+		for _, r := range o.recs {
+			e := &entry{
+				expiry: r.Expiry,
+				addr:   r.Addr,
+				name:   fqdn,
+			}
+			v.byName[fqdn] = append(v.byName[fqdn], e)
+			v.entries = append(v.entries, e)
+
+			if _, ok := v.byAddr[r.Addr]; !ok {
+				v.byAddr[r.Addr] = e
+			}
+		}
+	}
+
+	slices.SortFunc(v.entries, compareEntries)
+
+	return v
+}
+
+// isServable returns true if r should be added into the zone at now.
+func isServable(r *Record, now time.Time) (ok bool) {
+	if !r.Addr.IsValid() || r.Addr.IsLoopback() || r.Addr.IsUnspecified() {
+		return false
+	}
+
+	return r.Expiry.IsZero() || r.Expiry.After(now)
+}
+
+// relativeHost returns the lowercased hostname relative to the zone origin.
+// ok is false if host doesn't belong to the zone.
+func (z *Zone) relativeHost(host string) (rel string, ok bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return "", false
+	}
+
+	if rel, ok = strings.CutSuffix(host, "."+strings.TrimSuffix(z.origin, ".")); ok {
+		host = rel
+	}
+
+	if strings.Contains(host, ".") || netutil.ValidateHostnameLabel(host) != nil {
+		return "", false
+	}
+
+	return host, true
+}
+
+// uniqueName returns host, if it isn't taken yet, or host with the first
+// numeric suffix not taken.
+func (z *Zone) uniqueName(
+	ctx context.Context,
+	host string,
+	taken map[string]struct{},
+) (name string) {
+	if _, ok := taken[host]; !ok {
+		return host
+	}
+
+	for i := 2; ; i++ {
+		name = host + "-" + strconv.Itoa(i)
+		if _, ok := taken[name]; !ok {
+			z.logger.DebugContext(ctx, "hostname conflict", "host", host, "renamed", name)
+
+			return name
+		}
+	}
+}
+
+// newAddrRR returns a new A or AAAA record for e.  The TTL of the record
+// doesn't exceed the time left until e expires.
+func (z *Zone) newAddrRR(e *entry, now time.Time) (rr dns.RR) {
+	ttl := z.maxTTL
+	if !e.expiry.IsZero() {
+		ttl = max(min(ttl, e.expiry.Sub(now)), 0)
+	}
+
+	hdr := dns.RR_Header{
+		Name:  e.name,
+		Class: dns.ClassINET,
+		Ttl:   uint32(ttl.Seconds()),
+	}
+
+	if e.addr.Is4() {
+		hdr.Rrtype = dns.TypeA
+
+		return &dns.A{Hdr: hdr, A: e.addr.AsSlice()}
+	}
+
+	hdr.Rrtype = dns.TypeAAAA
+
+	return &dns.AAAA{Hdr: hdr, AAAA: e.addr.AsSlice()}
+}
+
+// diff returns the entries of prev absent in next and the entries of next
+// absent in prev.  Both prev and next must be sorted with [compareEntries].
+func diff(prev, next []*entry) (deleted, added []*entry) {
+	i, j := 0, 0
+	for i < len(prev) && j < len(next) {
+		switch c := compareEntries(prev[i], next[j]); {
+		case c < 0:
+			deleted = append(deleted, prev[i])
+			i++
+		case c > 0:
+			added = append(added, next[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+
+	deleted = append(deleted, prev[i:]...)
+	added = append(added, next[j:]...)
+
+	return deleted, added
+}
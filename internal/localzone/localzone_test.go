@@ -0,0 +1,345 @@
+package localzone_test
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/localzone"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testMaxTTL is the maximum TTL of the records in tests.
+const testMaxTTL = 1 * time.Hour
+
+// testSource is a [localzone.RecordSource] for tests.
+type testSource struct {
+	recs []*localzone.Record
+}
+
+// Records implements the [localzone.RecordSource] interface for *testSource.
+func (s *testSource) Records(_ context.Context) (recs []*localzone.Record) {
+	return s.recs
+}
+
+// newTestZone returns a new zone with the given sources, which is rebuilt on
+// each request.
+func newTestZone(tb testing.TB, srcs ...localzone.RecordSource) (z *localzone.Zone) {
+	tb.Helper()
+
+	conf := &localzone.Config{
+		Logger:          slogutil.NewDiscardLogger(),
+		Origin:          "lan",
+		Sources:         srcs,
+		TransferAllowed: []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+		MaxTTL:          testMaxTTL,
+		RefreshInterval: time.Nanosecond,
+		JournalSize:     4,
+	}
+	require.NoError(tb, conf.Validate())
+
+	return localzone.New(conf)
+}
+
+// newReq returns a new request for the given name and type.
+func newReq(name string, qtype uint16) (req *dns.Msg) {
+	return (&dns.Msg{}).SetQuestion(dns.Fqdn(name), qtype)
+}
+
+func TestZone_Answer(t *testing.T) {
+	expiry := time.Now().Add(10 * time.Minute)
+
+	rewrites := &testSource{recs: []*localzone.Record{{
+		Addr:   netip.MustParseAddr("192.168.1.2"),
+		Host:   "nas.lan",
+		Source: localzone.SourceRewrite,
+	}, {
+		Addr:   netip.MustParseAddr("1.2.3.4"),
+		Host:   "example.com",
+		Source: localzone.SourceRewrite,
+	}}}
+	leases := &testSource{recs: []*localzone.Record{{
+		Expiry: expiry,
+		Addr:   netip.MustParseAddr("192.168.1.100"),
+		Host:   "laptop",
+		Owner:  "02:00:00:00:00:01",
+		Source: localzone.SourceDHCP,
+	}, {
+		Expiry: expiry,
+		Addr:   netip.MustParseAddr("2001:db8::100"),
+		Host:   "laptop",
+		Owner:  "02:00:00:00:00:01",
+		Source: localzone.SourceDHCP,
+	}, {
+		Expiry: expiry,
+		Addr:   netip.MustParseAddr("192.168.1.101"),
+		Host:   "NAS",
+		Owner:  "02:00:00:00:00:02",
+		Source: localzone.SourceDHCP,
+	}, {
+		Expiry: time.Now().Add(-time.Minute),
+		Addr:   netip.MustParseAddr("192.168.1.102"),
+		Host:   "expired",
+		Owner:  "02:00:00:00:00:03",
+		Source: localzone.SourceDHCP,
+	}}}
+
+	z := newTestZone(t, rewrites, leases)
+
+	testCases := []struct {
+		name      string
+		qname     string
+		wantAns   []string
+		qtype     uint16
+		wantOK    bool
+		wantRcode int
+	}{{
+		name:      "a_lease",
+		qname:     "laptop.lan",
+		qtype:     dns.TypeA,
+		wantAns:   []string{"192.168.1.100"},
+		wantOK:    true,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "aaaa_lease",
+		qname:     "Laptop.LAN",
+		qtype:     dns.TypeAAAA,
+		wantAns:   []string{"2001:db8::100"},
+		wantOK:    true,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "rewrite_wins",
+		qname:     "nas.lan",
+		qtype:     dns.TypeA,
+		wantAns:   []string{"192.168.1.2"},
+		wantOK:    true,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "conflict_suffixed",
+		qname:     "nas-2.lan",
+		qtype:     dns.TypeA,
+		wantAns:   []string{"192.168.1.101"},
+		wantOK:    true,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "ptr",
+		qname:     "101.1.168.192.in-addr.arpa",
+		qtype:     dns.TypePTR,
+		wantAns:   []string{"nas-2.lan."},
+		wantOK:    true,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "ptr_ipv6",
+		qname:     "0.0.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+		qtype:     dns.TypePTR,
+		wantAns:   []string{"laptop.lan."},
+		wantOK:    true,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "nodata",
+		qname:     "laptop.lan",
+		qtype:     dns.TypeTXT,
+		wantAns:   nil,
+		wantOK:    true,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "expired",
+		qname:     "expired.lan",
+		qtype:     dns.TypeA,
+		wantAns:   nil,
+		wantOK:    false,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "outside",
+		qname:     "example.com",
+		qtype:     dns.TypeA,
+		wantAns:   nil,
+		wantOK:    false,
+		wantRcode: dns.RcodeSuccess,
+	}, {
+		name:      "unknown_ptr",
+		qname:     "1.1.168.192.in-addr.arpa",
+		qtype:     dns.TypePTR,
+		wantAns:   nil,
+		wantOK:    false,
+		wantRcode: dns.RcodeSuccess,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := testutil.ContextWithTimeout(t, testTimeout)
+			resp, ok := z.Answer(ctx, newReq(tc.qname, tc.qtype))
+			require.Equal(t, tc.wantOK, ok)
+
+			if !ok {
+				return
+			}
+
+			assert.True(t, resp.Authoritative)
+			assert.Equal(t, tc.wantRcode, resp.Rcode)
+
+			var ans []string
+			for _, rr := range resp.Answer {
+				switch rr := rr.(type) {
+				case *dns.A:
+					ans = append(ans, rr.A.String())
+				case *dns.AAAA:
+					ans = append(ans, rr.AAAA.String())
+				case *dns.PTR:
+					ans = append(ans, rr.Ptr)
+				}
+
+				assert.LessOrEqual(t, rr.Header().Ttl, uint32(testMaxTTL.Seconds()))
+			}
+			assert.Equal(t, tc.wantAns, ans)
+
+			if len(ans) == 0 {
+				require.Len(t, resp.Ns, 1)
+				assert.IsType(t, &dns.SOA{}, resp.Ns[0])
+			}
+		})
+	}
+
+	t.Run("lease_ttl", func(t *testing.T) {
+		ctx := testutil.ContextWithTimeout(t, testTimeout)
+		resp, ok := z.Answer(ctx, newReq("laptop.lan", dns.TypeA))
+		require.True(t, ok)
+		require.Len(t, resp.Answer, 1)
+
+		assert.InDelta(t, (10 * time.Minute).Seconds(), resp.Answer[0].Header().Ttl, 2)
+	})
+}
+
+// transferOne returns the single message of the zone transfer of z requested
+// by req from remote.
+func transferOne(tb testing.TB, z *localzone.Zone, req *dns.Msg, remote netip.Addr) (resp *dns.Msg) {
+	tb.Helper()
+
+	ctx := testutil.ContextWithTimeout(tb, testTimeout)
+	resps := z.Transfer(ctx, req, remote)
+	require.Len(tb, resps, 1)
+
+	return resps[0]
+}
+
+func TestZone_Transfer(t *testing.T) {
+	src := &testSource{recs: []*localzone.Record{{
+		Addr:   netip.MustParseAddr("192.168.1.2"),
+		Host:   "nas",
+		Source: localzone.SourceHosts,
+	}}}
+	z := newTestZone(t, src)
+
+	allowed := netip.MustParseAddr("192.168.1.53")
+
+	axfr := newReq("lan", dns.TypeAXFR)
+	require.True(t, z.IsTransfer(axfr))
+	require.False(t, z.IsTransfer(newReq("nas.lan", dns.TypeAXFR)))
+
+	t.Run("refused", func(t *testing.T) {
+		resp := transferOne(t, z, axfr, netip.MustParseAddr("10.0.0.1"))
+		assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+		assert.Empty(t, resp.Answer)
+	})
+
+	resp := transferOne(t, z, axfr, allowed)
+	require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	require.Len(t, resp.Answer, 3)
+
+	soa := testutil.RequireTypeAssert[*dns.SOA](t, resp.Answer[0])
+	assert.IsType(t, &dns.A{}, resp.Answer[1])
+	assert.Equal(t, soa, resp.Answer[2])
+
+	oldSerial := soa.Serial
+
+	src.recs = append(src.recs, &localzone.Record{
+		Addr:   netip.MustParseAddr("192.168.1.3"),
+		Host:   "printer",
+		Source: localzone.SourceHosts,
+	})
+
+	ixfr := newReq("lan", dns.TypeIXFR)
+	ixfr.Ns = []dns.RR{&dns.SOA{
+		Hdr:    dns.RR_Header{Name: "lan.", Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+		Serial: oldSerial,
+	}}
+
+	t.Run("incremental", func(t *testing.T) {
+		resp = transferOne(t, z, ixfr, allowed)
+		require.Equal(t, dns.RcodeSuccess, resp.Rcode)
+
+		// Current SOA, old SOA, new SOA, added record, current SOA.
+		require.Len(t, resp.Answer, 5)
+
+		cur := testutil.RequireTypeAssert[*dns.SOA](t, resp.Answer[0])
+		assert.Greater(t, cur.Serial, oldSerial)
+
+		from := testutil.RequireTypeAssert[*dns.SOA](t, resp.Answer[1])
+		assert.Equal(t, oldSerial, from.Serial)
+
+		added := testutil.RequireTypeAssert[*dns.A](t, resp.Answer[3])
+		assert.Equal(t, "printer.lan.", added.Hdr.Name)
+	})
+
+	t.Run("up_to_date", func(t *testing.T) {
+		cur := testutil.RequireTypeAssert[*dns.SOA](t, resp.Answer[0])
+		ixfr.Ns[0].(*dns.SOA).Serial = cur.Serial
+
+		resp = transferOne(t, z, ixfr, allowed)
+		require.Len(t, resp.Answer, 1)
+		assert.Equal(t, cur.Serial, resp.Answer[0].(*dns.SOA).Serial)
+	})
+
+	t.Run("unknown_serial", func(t *testing.T) {
+		ixfr.Ns[0].(*dns.SOA).Serial = 1
+
+		resp = transferOne(t, z, ixfr, allowed)
+
+		// Falls back to the full transfer.
+		require.Len(t, resp.Answer, 4)
+	})
+}
+
+func TestZone_Transfer_large(t *testing.T) {
+	const numRecs = 2_000
+
+	src := &testSource{}
+	for i := range numRecs {
+		src.recs = append(src.recs, &localzone.Record{
+			Addr:   netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)}),
+			Host:   fmt.Sprintf("host-with-a-rather-long-name-%04d", i),
+			Source: localzone.SourceHosts,
+		})
+	}
+
+	z := newTestZone(t, src)
+	ctx := testutil.ContextWithTimeout(t, testTimeout)
+
+	resps := z.Transfer(ctx, newReq("lan", dns.TypeAXFR), netip.MustParseAddr("192.168.1.53"))
+	require.Greater(t, len(resps), 1)
+
+	var rrs []dns.RR
+	for _, resp := range resps {
+		b, err := resp.Pack()
+		require.NoError(t, err)
+
+		assert.LessOrEqual(t, len(b), dns.MaxMsgSize)
+		assert.Equal(t, resps[0].Id, resp.Id)
+
+		rrs = append(rrs, resp.Answer...)
+	}
+
+	require.Len(t, rrs, numRecs+2)
+
+	soa := testutil.RequireTypeAssert[*dns.SOA](t, rrs[0])
+	assert.Equal(t, soa, rrs[len(rrs)-1])
+}
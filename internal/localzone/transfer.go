@@ -0,0 +1,156 @@
+package localzone
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// IsTransfer returns true if req is a request for the transfer of the zone.
+// req must contain exactly one question.
+func (z *Zone) IsTransfer(req *dns.Msg) (ok bool) {
+	q := req.Question[0]
+
+	return isTransferType(q.Qtype) && dns.CanonicalName(q.Name) == z.origin
+}
+
+// maxTransferMsgSize is the maximum size of a single message of the zone
+// transfer, which is limited by the two-byte length prefix of DNS over TCP.
+const maxTransferMsgSize = dns.MaxMsgSize
+
+// Transfer returns the responses to the zone transfer request req from the
+// secondary server with the address remote.  The records are split into
+// several messages, each fitting into [dns.MaxMsgSize], so the responses
+// should only be sent over TCP.  resps always contain at least one message.
+// req must be a transfer request, see [Zone.IsTransfer].
+//
+// See https://datatracker.ietf.org/doc/html/rfc5936 and
+// https://datatracker.ietf.org/doc/html/rfc1995.
+func (z *Zone) Transfer(ctx context.Context, req *dns.Msg, remote netip.Addr) (resps []*dns.Msg) {
+	remote = remote.Unmap()
+	if !slices.ContainsFunc(z.transferAllowed, func(p netip.Prefix) (ok bool) {
+		return p.Contains(remote)
+	}) {
+		z.logger.DebugContext(ctx, "zone transfer refused", "remote", remote)
+
+		return []*dns.Msg{(&dns.Msg{}).SetRcode(req, dns.RcodeRefused)}
+	}
+
+	v := z.load(ctx)
+	now := time.Now()
+
+	soa := z.soa(v.serial)
+	if req.Question[0].Qtype == dns.TypeIXFR {
+		changes, ok := z.changesSince(req, v.serial)
+		if ok {
+			z.logger.DebugContext(ctx, "incremental zone transfer", "remote", remote, "changes", len(changes))
+
+			return z.split(req, z.incremental(soa, changes, now))
+		}
+	}
+
+	z.logger.DebugContext(ctx, "full zone transfer", "remote", remote, "serial", v.serial)
+
+	rrs := make([]dns.RR, 0, len(v.entries)+2)
+	rrs = append(rrs, soa)
+	for _, e := range v.entries {
+		rrs = append(rrs, z.newAddrRR(e, now))
+	}
+	rrs = append(rrs, soa)
+
+	return z.split(req, rrs)
+}
+
+// split returns the responses to req containing rrs in order, each fitting
+// into [maxTransferMsgSize].  The sizes of the records are calculated without
+// compression, so the actual messages may be smaller.
+func (z *Zone) split(req *dns.Msg, rrs []dns.RR) (resps []*dns.Msg) {
+	resp := z.newTransferResponse(req)
+	size := resp.Len()
+	for _, rr := range rrs {
+		l := dns.Len(rr)
+		if size+l > maxTransferMsgSize && len(resp.Answer) > 0 {
+			resps = append(resps, resp)
+			resp = z.newTransferResponse(req)
+			size = resp.Len()
+		}
+
+		resp.Answer = append(resp.Answer, rr)
+		size += l
+	}
+
+	return append(resps, resp)
+}
+
+// newTransferResponse returns a new message of the zone transfer response to
+// req.
+func (z *Zone) newTransferResponse(req *dns.Msg) (resp *dns.Msg) {
+	resp = z.newResponse(req)
+	resp.RecursionAvailable = false
+
+	return resp
+}
+
+// changesSince returns the journaled changes since the serial number of the
+// IXFR request req up to the serial number cur.  ok is false if the changes
+// aren't available and the full transfer is needed.
+func (z *Zone) changesSince(req *dns.Msg, cur uint32) (changes []*change, ok bool) {
+	if len(req.Ns) == 0 {
+		return nil, false
+	}
+
+	clientSOA, ok := req.Ns[0].(*dns.SOA)
+	if !ok {
+		return nil, false
+	}
+
+	from := clientSOA.Serial
+	if from == cur {
+		return nil, true
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	i := slices.IndexFunc(z.journal, func(c *change) (found bool) { return c.from == from })
+	if i < 0 {
+		return nil, false
+	}
+
+	for _, c := range z.journal[i:] {
+		changes = append(changes, c)
+		if c.to == cur {
+			return changes, true
+		}
+	}
+
+	// The zone has changed after the version requested, so the journal
+	// doesn't match it.
+	return nil, false
+}
+
+// incremental returns the answer section of the incremental zone transfer with
+// the given changes, ending with the current SOA record.
+func (z *Zone) incremental(soa *dns.SOA, changes []*change, now time.Time) (rrs []dns.RR) {
+	rrs = append(rrs, soa)
+	for _, c := range changes {
+		rrs = append(rrs, z.soa(c.from))
+		for _, e := range c.deleted {
+			rrs = append(rrs, z.newAddrRR(e, now))
+		}
+
+		rrs = append(rrs, z.soa(c.to))
+		for _, e := range c.added {
+			rrs = append(rrs, z.newAddrRR(e, now))
+		}
+	}
+
+	if len(changes) > 0 {
+		rrs = append(rrs, soa)
+	}
+
+	return rrs
+}
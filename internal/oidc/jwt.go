@@ -0,0 +1,225 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// JWS algorithms supported for ID tokens.
+const (
+	algES256 = "ES256"
+	algRS256 = "RS256"
+)
+
+// minRSABits is the minimum size of RSA keys accepted.
+const minRSABits = 2048
+
+// jwtHeader is the JOSE header of an ID token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwt is a parsed, but not yet verified, JSON Web Token.
+type jwt struct {
+	header jwtHeader
+
+	// claims are the raw claims of the token.
+	claims map[string]any
+
+	// signed is the signed part of the token.
+	signed string
+
+	// sig is the signature of signed.
+	sig []byte
+}
+
+// parseJWT parses the compact serialization of a JWS.
+func parseJWT(raw string) (t *jwt, err error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("jwt: got %d parts, want 3", len(parts))
+	}
+
+	hdrData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: header: %w", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: payload: %w", err)
+	}
+
+	t = &jwt{
+		signed: parts[0] + "." + parts[1],
+	}
+
+	t.sig, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: signature: %w", err)
+	}
+
+	err = json.Unmarshal(hdrData, &t.header)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: header: %w", err)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(payload)))
+	dec.UseNumber()
+	err = dec.Decode(&t.claims)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: payload: %w", err)
+	}
+
+	return t, nil
+}
+
+// verify returns an error if the signature of t isn't valid for key.
+func (t *jwt) verify(key crypto.PublicKey) (err error) {
+	sum := sha256.Sum256([]byte(t.signed))
+
+	switch t.header.Alg {
+	case algRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt: key type %T for alg %s", key, t.header.Alg)
+		}
+
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], t.sig)
+	case algES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt: key type %T for alg %s", key, t.header.Alg)
+		}
+
+		err = verifyES256(pub, sum[:], t.sig)
+	default:
+		return fmt.Errorf("jwt: alg %q: %w", t.header.Alg, errors.ErrUnsupported)
+	}
+
+	if err != nil {
+		return fmt.Errorf("jwt: invalid signature: %w", err)
+	}
+
+	return nil
+}
+
+// verifyES256 verifies the JWS ES256 signature, which is the concatenation of
+// R and S instead of the ASN.1 structure.
+func verifyES256(pub *ecdsa.PublicKey, hash, sig []byte) (err error) {
+	const size = 32
+	if len(sig) != 2*size {
+		return fmt.Errorf("signature length %d, want %d", len(sig), 2*size)
+	}
+
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+	if !ecdsa.Verify(pub, hash, r, s) {
+		return errors.Error("ecdsa verification failed")
+	}
+
+	return nil
+}
+
+// jwk is a JSON Web Key from the key set of the issuer.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA parameters.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC parameters.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwks is a JSON Web Key Set.
+type jwks struct {
+	Keys []*jwk `json:"keys"`
+}
+
+// publicKey returns the public key from k.
+func (k *jwk) publicKey() (pub crypto.PublicKey, err error) {
+	switch k.Kty {
+	case "RSA":
+		return k.rsaKey()
+	case "EC":
+		return k.ecKey()
+	default:
+		return nil, fmt.Errorf("key type %q: %w", k.Kty, errors.ErrUnsupported)
+	}
+}
+
+// rsaKey returns the RSA public key from k.
+func (k *jwk) rsaKey() (pub *rsa.PublicKey, err error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	} else if len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("e: bad length %d", len(e))
+	}
+
+	pub = &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+
+	if bits := pub.N.BitLen(); bits < minRSABits {
+		return nil, fmt.Errorf("rsa key of %d bits is too short", bits)
+	}
+
+	return pub, nil
+}
+
+// ecKey returns the P-256 public key from k.
+func (k *jwk) ecKey() (pub *ecdsa.PublicKey, err error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("curve %q: %w", k.Crv, errors.ErrUnsupported)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	} else if len(x) != 32 || len(y) != 32 {
+		return nil, errors.Error("bad p-256 coordinates length")
+	}
+
+	// Use package crypto/ecdh to make sure that the point is on the curve.
+	_, err = ecdh.P256().NewPublicKey(append(append([]byte{0x04}, x...), y...))
+	if err != nil {
+		return nil, fmt.Errorf("p-256 point: %w", err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
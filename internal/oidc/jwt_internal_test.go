@@ -0,0 +1,368 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// b64 is a shorthand for the encoding used in JWTs.
+var b64 = base64.RawURLEncoding
+
+// newTestToken returns a compact JWS with the given header and payload, signed
+// with key, if it isn't nil.
+func newTestToken(tb testing.TB, hdr, payload string, key crypto.Signer) (raw string) {
+	tb.Helper()
+
+	signed := b64.EncodeToString([]byte(hdr)) + "." + b64.EncodeToString([]byte(payload))
+	if key == nil {
+		return signed + "."
+	}
+
+	sum := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, sum[:])
+		require.NoError(tb, err)
+
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		var err error
+		sig, err = key.Sign(rand.Reader, sum[:], crypto.SHA256)
+		require.NoError(tb, err)
+	}
+
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestParseJWT(t *testing.T) {
+	validHdr := b64.EncodeToString([]byte(`{"alg":"ES256","kid":"1"}`))
+	validPayload := b64.EncodeToString([]byte(`{"sub":"user","exp":1700000000}`))
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		in         string
+	}{{
+		name:       "valid",
+		wantErrMsg: "",
+		in:         validHdr + "." + validPayload + ".AAAA",
+	}, {
+		name:       "empty",
+		wantErrMsg: "jwt: got 1 parts, want 3",
+		in:         "",
+	}, {
+		name:       "two_parts",
+		wantErrMsg: "jwt: got 2 parts, want 3",
+		in:         validHdr + "." + validPayload,
+	}, {
+		name:       "four_parts",
+		wantErrMsg: "jwt: got 4 parts, want 3",
+		in:         validHdr + "." + validPayload + ".AAAA.AAAA",
+	}, {
+		name:       "bad_header_base64",
+		wantErrMsg: "jwt: header: illegal base64 data at input byte 0",
+		in:         "!!." + validPayload + ".AAAA",
+	}, {
+		name:       "padded_header",
+		wantErrMsg: "jwt: header: illegal base64 data at input byte 3",
+		in:         "e30=." + validPayload + ".AAAA",
+	}, {
+		name:       "bad_payload_base64",
+		wantErrMsg: "jwt: payload: illegal base64 data at input byte 0",
+		in:         validHdr + ".*." + "AAAA",
+	}, {
+		name:       "bad_signature_base64",
+		wantErrMsg: "jwt: signature: illegal base64 data at input byte 0",
+		in:         validHdr + "." + validPayload + ".A",
+	}, {
+		name:       "bad_header_json",
+		wantErrMsg: "jwt: header: unexpected end of JSON input",
+		in:         b64.EncodeToString([]byte(`{"alg":`)) + "." + validPayload + ".AAAA",
+	}, {
+		name: "header_not_object",
+		wantErrMsg: "jwt: header: json: cannot unmarshal array into Go value of type " +
+			"oidc.jwtHeader",
+		in: b64.EncodeToString([]byte(`[]`)) + "." + validPayload + ".AAAA",
+	}, {
+		name:       "bad_payload_json",
+		wantErrMsg: "jwt: payload: unexpected EOF",
+		in:         validHdr + "." + b64.EncodeToString([]byte(`{"sub":`)) + ".AAAA",
+	}, {
+		name: "payload_not_object",
+		wantErrMsg: "jwt: payload: json: cannot unmarshal string into Go value of type " +
+			"map[string]interface {}",
+		in: validHdr + "." + b64.EncodeToString([]byte(`"sub"`)) + ".AAAA",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tok, err := parseJWT(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg != "" {
+				return
+			}
+
+			require.NotNil(t, tok)
+
+			assert.Equal(t, algES256, tok.header.Alg)
+			assert.Equal(t, "user", tok.claims["sub"])
+			assert.Equal(t, json.Number("1700000000"), tok.claims["exp"])
+		})
+	}
+}
+
+func TestJWT_verify(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	otherECKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	require.NoError(t, err)
+
+	const payload = `{"sub":"user"}`
+
+	esToken := newTestToken(t, `{"alg":"ES256"}`, payload, ecKey)
+	rsToken := newTestToken(t, `{"alg":"RS256"}`, payload, rsaKey)
+
+	// Cut the signature of the ES256 token in half.
+	truncToken := esToken[:len(esToken)-43]
+
+	testCases := []struct {
+		key        crypto.PublicKey
+		name       string
+		wantErrMsg string
+		in         string
+	}{{
+		key:        &ecKey.PublicKey,
+		name:       "es256",
+		wantErrMsg: "",
+		in:         esToken,
+	}, {
+		key:        &rsaKey.PublicKey,
+		name:       "rs256",
+		wantErrMsg: "",
+		in:         rsToken,
+	}, {
+		key:        &otherECKey.PublicKey,
+		name:       "es256_wrong_key",
+		wantErrMsg: "jwt: invalid signature: ecdsa verification failed",
+		in:         esToken,
+	}, {
+		key:        &rsaKey.PublicKey,
+		name:       "es256_rsa_key",
+		wantErrMsg: "jwt: key type *rsa.PublicKey for alg ES256",
+		in:         esToken,
+	}, {
+		key:        &ecKey.PublicKey,
+		name:       "rs256_ec_key",
+		wantErrMsg: "jwt: key type *ecdsa.PublicKey for alg RS256",
+		in:         rsToken,
+	}, {
+		key:        &ecKey.PublicKey,
+		name:       "none",
+		wantErrMsg: `jwt: alg "none": unsupported operation`,
+		in:         newTestToken(t, `{"alg":"none"}`, payload, nil),
+	}, {
+		key:        &ecKey.PublicKey,
+		name:       "no_alg",
+		wantErrMsg: `jwt: alg "": unsupported operation`,
+		in:         newTestToken(t, `{}`, payload, nil),
+	}, {
+		key:        &rsaKey.PublicKey,
+		name:       "hs256",
+		wantErrMsg: `jwt: alg "HS256": unsupported operation`,
+		in:         newTestToken(t, `{"alg":"HS256"}`, payload, nil),
+	}, {
+		key:        &ecKey.PublicKey,
+		name:       "es256_no_signature",
+		wantErrMsg: "jwt: invalid signature: signature length 0, want 64",
+		in:         newTestToken(t, `{"alg":"ES256"}`, payload, nil),
+	}, {
+		key:        &ecKey.PublicKey,
+		name:       "es256_truncated_signature",
+		wantErrMsg: "jwt: invalid signature: signature length 32, want 64",
+		in:         truncToken,
+	}, {
+		key:        &rsaKey.PublicKey,
+		name:       "rs256_truncated_signature",
+		wantErrMsg: "jwt: invalid signature: crypto/rsa: verification error",
+		in:         rsToken[:len(rsToken)-8],
+	}, {
+		key:        &rsaKey.PublicKey,
+		name:       "rs256_modified_payload",
+		wantErrMsg: "jwt: invalid signature: crypto/rsa: verification error",
+		in: strings.Replace(
+			rsToken,
+			b64.EncodeToString([]byte(payload)),
+			b64.EncodeToString([]byte(`{"sub":"admin"}`)),
+			1,
+		),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tok, err := parseJWT(tc.in)
+			require.NoError(t, err)
+
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tok.verify(tc.key))
+		})
+	}
+}
+
+func TestJWK_publicKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	require.NoError(t, err)
+
+	shortRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	x := b64.EncodeToString(ecKey.X.FillBytes(make([]byte, 32)))
+	y := b64.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32)))
+	n := b64.EncodeToString(rsaKey.N.Bytes())
+	e := b64.EncodeToString([]byte{0x01, 0x00, 0x01})
+
+	testCases := []struct {
+		key        *jwk
+		name       string
+		wantErrMsg string
+	}{{
+		key:        &jwk{Kty: "EC", Crv: "P-256", X: x, Y: y},
+		name:       "ec",
+		wantErrMsg: "",
+	}, {
+		key:        &jwk{Kty: "RSA", N: n, E: e},
+		name:       "rsa",
+		wantErrMsg: "",
+	}, {
+		key:        &jwk{Kty: "oct"},
+		name:       "oct",
+		wantErrMsg: `key type "oct": unsupported operation`,
+	}, {
+		key:        &jwk{Kty: "EC", Crv: "P-384", X: x, Y: y},
+		name:       "ec_wrong_curve",
+		wantErrMsg: `curve "P-384": unsupported operation`,
+	}, {
+		key:        &jwk{Kty: "EC", Crv: "P-256", X: "!", Y: y},
+		name:       "ec_bad_x",
+		wantErrMsg: "x: illegal base64 data at input byte 0",
+	}, {
+		key:        &jwk{Kty: "EC", Crv: "P-256", X: x, Y: "!"},
+		name:       "ec_bad_y",
+		wantErrMsg: "y: illegal base64 data at input byte 0",
+	}, {
+		key:        &jwk{Kty: "EC", Crv: "P-256", X: x[1:], Y: y},
+		name:       "ec_short_x",
+		wantErrMsg: "bad p-256 coordinates length",
+	}, {
+		key:        &jwk{Kty: "EC", Crv: "P-256", X: x, Y: b64.EncodeToString(make([]byte, 33))},
+		name:       "ec_long_y",
+		wantErrMsg: "bad p-256 coordinates length",
+	}, {
+		key:        &jwk{Kty: "EC", Crv: "P-256", X: x, Y: x},
+		name:       "ec_not_on_curve",
+		wantErrMsg: "p-256 point: P256 point not on curve",
+	}, {
+		key:        &jwk{Kty: "RSA", N: "!", E: e},
+		name:       "rsa_bad_n",
+		wantErrMsg: "n: illegal base64 data at input byte 0",
+	}, {
+		key:        &jwk{Kty: "RSA", N: n, E: "!"},
+		name:       "rsa_bad_e",
+		wantErrMsg: "e: illegal base64 data at input byte 0",
+	}, {
+		key:        &jwk{Kty: "RSA", N: n, E: ""},
+		name:       "rsa_empty_e",
+		wantErrMsg: "e: bad length 0",
+	}, {
+		key:        &jwk{Kty: "RSA", N: n, E: b64.EncodeToString(make([]byte, 5))},
+		name:       "rsa_long_e",
+		wantErrMsg: "e: bad length 5",
+	}, {
+		key:        &jwk{Kty: "RSA", N: b64.EncodeToString(shortRSAKey.N.Bytes()), E: e},
+		name:       "rsa_short",
+		wantErrMsg: "rsa key of 1024 bits is too short",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pub, err := tc.key.publicKey()
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg == "" {
+				assert.NotNil(t, pub)
+			}
+		})
+	}
+}
+
+func FuzzParseJWT(f *testing.F) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(f, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSABits)
+	require.NoError(f, err)
+
+	f.Add(newTestToken(f, `{"alg":"ES256"}`, `{"sub":"user"}`, ecKey))
+	f.Add(newTestToken(f, `{"alg":"RS256"}`, `{"sub":"user"}`, rsaKey))
+	f.Add(newTestToken(f, `{"alg":"none"}`, `{}`, nil))
+	f.Add("..")
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		tok, parseErr := parseJWT(raw)
+		if parseErr != nil {
+			return
+		}
+
+		// Neither key signed the fuzzed tokens, except for the seeds, so only
+		// make sure that the verification doesn't panic.
+		_ = tok.verify(&ecKey.PublicKey)
+		_ = tok.verify(&rsaKey.PublicKey)
+	})
+}
+
+func FuzzJWK_publicKey(f *testing.F) {
+	f.Add([]byte(`{"kty":"EC","crv":"P-256","x":"AAAA","y":"AAAA"}`))
+	f.Add([]byte(`{"kty":"RSA","n":"AAAA","e":"AQAB"}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		k := &jwk{}
+		if json.Unmarshal(data, k) != nil {
+			return
+		}
+
+		pub, keyErr := k.publicKey()
+		if keyErr != nil {
+			return
+		}
+
+		require.NotNil(t, pub)
+
+		tok := &jwt{
+			header: jwtHeader{Alg: algRS256},
+			sig:    data,
+		}
+
+		_ = tok.verify(pub)
+
+		tok.header.Alg = algES256
+		_ = tok.verify(pub)
+	})
+}
@@ -0,0 +1,498 @@
+// Package oidc implements the relying party side of the OpenID Connect
+// authorization code flow used for the single sign-on into the web UI.
+//
+// See https://openid.net/specs/openid-connect-core-1_0.html.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+)
+
+// ScopeOpenID is the scope required for any OpenID Connect request.
+const ScopeOpenID = "openid"
+
+// DefaultScopes are the scopes requested when none are configured.
+var DefaultScopes = []string{ScopeOpenID, "profile", "email"}
+
+// Limits and intervals.
+const (
+	// maxRespSize is the maximum size of the responses of the issuer.
+	maxRespSize = 1 << 20
+
+	// keysRefreshIvl is the minimum interval between the refetches of the key
+	// set caused by unknown key IDs.
+	keysRefreshIvl = 1 * time.Minute
+
+	// clockLeeway is the tolerated clock skew between the issuer and the
+	// server.
+	clockLeeway = 1 * time.Minute
+
+	// randSize is the size of the random state, nonce, and PKCE verifier
+	// values, in bytes.
+	randSize = 32
+)
+
+// Config is the configuration structure for a *Provider.
+type Config struct {
+	// Logger is used for logging the operation of the provider.  It must not
+	// be nil.
+	Logger *slog.Logger
+
+	// HTTPClient is used for the requests to the issuer.  It must not be nil.
+	HTTPClient *http.Client
+
+	// Issuer is the URL of the issuer as in the "iss" claim.  The discovery
+	// document is fetched from it.  It must not be nil.
+	Issuer *url.URL
+
+	// ClientID is the ID of the client registered at the issuer.  It must not
+	// be empty.
+	ClientID string
+
+	// ClientSecret is the secret of the confidential client.  It may be empty
+	// for public clients, which rely on PKCE only.
+	ClientSecret string
+
+	// Scopes are the requested scopes.  [ScopeOpenID] is added if missing.  If
+	// empty, [DefaultScopes] are used.
+	Scopes []string
+}
+
+// discovery is the part of the OpenID Provider metadata used by the provider.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider client.  The metadata of the issuer is
+// discovered lazily, so that an unavailable issuer doesn't prevent the start.
+type Provider struct {
+	logger       *slog.Logger
+	client       *http.Client
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	// mu protects the fields below.
+	mu *sync.Mutex
+
+	// meta is the discovered metadata.  It's nil until it's discovered.
+	meta *discovery
+
+	// keys are the signing keys of the issuer by their key IDs.
+	keys map[string]crypto.PublicKey
+
+	// keysUpdated is the time of the last fetch of keys.
+	keysUpdated time.Time
+}
+
+// New returns a new properly initialized *Provider.  c must be valid.
+func New(c *Config) (p *Provider) {
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	} else if !slices.Contains(scopes, ScopeOpenID) {
+		scopes = append([]string{ScopeOpenID}, scopes...)
+	}
+
+	return &Provider{
+		logger:       c.Logger,
+		client:       c.HTTPClient,
+		issuer:       strings.TrimSuffix(c.Issuer.String(), "/"),
+		clientID:     c.ClientID,
+		clientSecret: c.ClientSecret,
+		scopes:       scopes,
+		mu:           &sync.Mutex{},
+	}
+}
+
+// RandomString returns a new random URL-safe string suitable for the state,
+// nonce, and PKCE code verifier values.
+func RandomString() (s string) {
+	b := make([]byte, randSize)
+	// Don't check the error, since crypto/rand.Read never returns one.
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CodeChallenge returns the S256 PKCE code challenge for verifier.
+func CodeChallenge(verifier string) (challenge string) {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthURL returns the URL of the authorization endpoint to redirect the user
+// to.  verifier is the PKCE code verifier, which must later be passed to
+// [Provider.Exchange].
+func (p *Provider) AuthURL(
+	ctx context.Context,
+	redirectURL string,
+	state string,
+	nonce string,
+	verifier string,
+) (u string, err error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		// Don't wrap the error, since it's informative enough as is.
+		return "", err
+	}
+
+	q := url.Values{
+		"client_id":             {p.clientID},
+		"code_challenge":        {CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+		"nonce":                 {nonce},
+		"redirect_uri":          {redirectURL},
+		"response_type":         {"code"},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+	}
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// tokenResponse is the successful response of the token endpoint.
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+// tokenError is the error response of the token endpoint.
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// Exchange exchanges the authorization code for the raw ID token.
+func (p *Provider) Exchange(
+	ctx context.Context,
+	code string,
+	redirectURL string,
+	verifier string,
+) (rawIDToken string, err error) {
+	defer func() { err = errors.Annotate(err, "exchanging code: %w") }()
+
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"code":          {code},
+		"code_verifier": {verifier},
+		"grant_type":    {"authorization_code"},
+		"redirect_uri":  {redirectURL},
+	}
+
+	if p.clientSecret == "" {
+		form.Set("client_id", p.clientID)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		meta.TokenEndpoint,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting token: %w", err)
+	}
+	defer slogutil.CloseAndLog(ctx, p.logger, resp.Body, slog.LevelDebug)
+
+	body, err := io.ReadAll(ioutil.LimitReader(resp.Body, maxRespSize))
+	if err != nil {
+		return "", fmt.Errorf("reading token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		te := &tokenError{}
+		_ = json.Unmarshal(body, te)
+
+		return "", fmt.Errorf("token endpoint: status %d: %q %q", resp.StatusCode, te.Error, te.Description)
+	}
+
+	tr := &tokenResponse{}
+	err = json.Unmarshal(body, tr)
+	if err != nil {
+		return "", fmt.Errorf("decoding token response: %w", err)
+	} else if tr.IDToken == "" {
+		return "", errors.Error("no id_token in token response")
+	}
+
+	return tr.IDToken, nil
+}
+
+// Claims are the verified claims of an ID token.
+type Claims map[string]any
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() (sub string) {
+	return c.String("sub")
+}
+
+// String returns the string claim with the given name or an empty string if
+// there is no such claim or it's not a string.
+func (c Claims) String(name string) (s string) {
+	s, _ = c[name].(string)
+
+	return s
+}
+
+// Strings returns the claim with the given name as a list of strings.  A
+// single string value is returned as a one-element list.  Non-string elements
+// are ignored.
+func (c Claims) Strings(name string) (ss []string) {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		for _, elem := range v {
+			if s, ok := elem.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+	}
+
+	return ss
+}
+
+// VerifyIDToken verifies the signature and the claims of the raw ID token and
+// returns its claims.  nonce must be the nonce passed to [Provider.AuthURL].
+func (p *Provider) VerifyIDToken(
+	ctx context.Context,
+	raw string,
+	nonce string,
+	now time.Time,
+) (c Claims, err error) {
+	defer func() { err = errors.Annotate(err, "verifying id token: %w") }()
+
+	t, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := p.key(ctx, t.header.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.verify(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c = Claims(t.claims)
+	err = p.verifyClaims(c, nonce, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// verifyClaims checks the standard claims of an ID token.
+func (p *Provider) verifyClaims(c Claims, nonce string, now time.Time) (err error) {
+	if iss := c.String("iss"); iss != p.issuer {
+		return fmt.Errorf("issuer %q, want %q", iss, p.issuer)
+	}
+
+	aud := c.Strings("aud")
+	if !slices.Contains(aud, p.clientID) {
+		return fmt.Errorf("audience %q doesn't contain client id", aud)
+	} else if azp := c.String("azp"); len(aud) > 1 && azp != p.clientID {
+		return fmt.Errorf("authorized party %q isn't the client", azp)
+	}
+
+	exp, err := timeClaim(c, "exp")
+	if err != nil {
+		return err
+	} else if !now.Before(exp.Add(clockLeeway)) {
+		return errors.Error("token has expired")
+	}
+
+	iat, err := timeClaim(c, "iat")
+	if err != nil {
+		return err
+	} else if iat.After(now.Add(clockLeeway)) {
+		return errors.Error("token is issued in the future")
+	}
+
+	if got := c.String("nonce"); got != nonce {
+		return errors.Error("nonce mismatch")
+	}
+
+	if c.Subject() == "" {
+		return errors.Error("no subject")
+	}
+
+	return nil
+}
+
+// timeClaim returns the NumericDate claim with the given name.
+func timeClaim(c Claims, name string) (t time.Time, err error) {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, fmt.Errorf("claim %q: missing or not a number", name)
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("claim %q: %w", name, err)
+	}
+
+	return time.Unix(int64(f), 0), nil
+}
+
+// metadata returns the discovered metadata of the issuer, fetching it if
+// necessary.
+func (p *Provider) metadata(ctx context.Context) (meta *discovery, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	meta = &discovery{}
+	err = p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", meta)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	if meta.Issuer != p.issuer {
+		return nil, fmt.Errorf("discovery: issuer %q, want %q", meta.Issuer, p.issuer)
+	} else if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.Error("discovery: missing endpoints")
+	}
+
+	p.meta = meta
+
+	return meta, nil
+}
+
+// key returns the signing key with the given ID.  An empty kid is only
+// accepted if the issuer has exactly one key.
+func (p *Provider) key(ctx context.Context, kid string, now time.Time) (k crypto.PublicKey, err error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k = p.findKey(kid)
+	if k != nil {
+		return k, nil
+	}
+
+	if now.Sub(p.keysUpdated) < keysRefreshIvl {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	set := &jwks{}
+	err = p.getJSON(ctx, meta.JWKSURI, set)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+
+	p.keysUpdated = now
+	p.keys = make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, sk := range set.Keys {
+		if sk.Use != "" && sk.Use != "sig" {
+			continue
+		}
+
+		pub, kerr := sk.publicKey()
+		if kerr != nil {
+			p.logger.DebugContext(ctx, "skipping key", "kid", sk.Kid, slogutil.KeyError, kerr)
+
+			continue
+		}
+
+		p.keys[sk.Kid] = pub
+	}
+
+	k = p.findKey(kid)
+	if k == nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	return k, nil
+}
+
+// findKey returns the cached key with the given ID.  p.mu must be locked.
+func (p *Provider) findKey(kid string) (k crypto.PublicKey) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k = range p.keys {
+			return k
+		}
+	}
+
+	return p.keys[kid]
+}
+
+// getJSON fetches the JSON document at u and decodes it into v.
+func (p *Provider) getJSON(ctx context.Context, u string, v any) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting %q: %w", u, err)
+	}
+	defer slogutil.CloseAndLog(ctx, p.logger, resp.Body, slog.LevelDebug)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("requesting %q: status %d", u, resp.StatusCode)
+	}
+
+	err = json.NewDecoder(ioutil.LimitReader(resp.Body, maxRespSize)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("decoding %q: %w", u, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package oidc_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/oidc"
+	"github.com/AdguardTeam/golibs/logutil/slogutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClientID is the client ID used in tests.
+const testClientID = "nullprivate"
+
+// testIssuer is a fake OpenID Connect issuer.
+type testIssuer struct {
+	srv    *httptest.Server
+	ecKey  *ecdsa.PrivateKey
+	rsaKey *rsa.PrivateKey
+
+	// idToken is returned from the token endpoint.
+	idToken string
+
+	// gotForm is the last form received by the token endpoint.
+	gotForm url.Values
+}
+
+// newTestIssuer returns a new running *testIssuer.
+func newTestIssuer(t *testing.T) (iss *testIssuer) {
+	t.Helper()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	iss = &testIssuer{
+		ecKey:  ecKey,
+		rsaKey: rsaKey,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss.srv.URL,
+			"authorization_endpoint": iss.srv.URL + "/authorize",
+			"token_endpoint":         iss.srv.URL + "/token",
+			"jwks_uri":               iss.srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "EC",
+				"kid": "ec",
+				"crv": "P-256",
+				"x":   b64(ecKey.X.FillBytes(make([]byte, 32))),
+				"y":   b64(ecKey.Y.FillBytes(make([]byte, 32))),
+			}, {
+				"kty": "RSA",
+				"kid": "rsa",
+				"use": "sig",
+				"n":   b64(rsaKey.N.Bytes()),
+				"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		iss.gotForm = r.PostForm
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": iss.idToken})
+	})
+
+	iss.srv = httptest.NewServer(mux)
+	t.Cleanup(iss.srv.Close)
+
+	return iss
+}
+
+// b64 is a shorthand for the unpadded URL-safe base64 encoding.
+func b64(b []byte) (s string) {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign returns a signed JWT with the given claims.
+func (iss *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]any) (raw string) {
+	t.Helper()
+
+	hdr, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := b64(hdr) + "." + b64(payload)
+	sum := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "ES256":
+		r, s, sErr := ecdsa.Sign(rand.Reader, iss.ecKey, sum[:])
+		require.NoError(t, sErr)
+
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, sum[:])
+		require.NoError(t, err)
+	}
+
+	return signed + "." + b64(sig)
+}
+
+func TestProvider(t *testing.T) {
+	iss := newTestIssuer(t)
+
+	issURL, err := url.Parse(iss.srv.URL)
+	require.NoError(t, err)
+
+	p := oidc.New(&oidc.Config{
+		Logger:       slogutil.NewDiscardLogger(),
+		HTTPClient:   iss.srv.Client(),
+		Issuer:       issURL,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		Scopes:       []string{"groups"},
+	})
+
+	ctx := testutil.ContextWithTimeout(t, 5*time.Second)
+	verifier := oidc.RandomString()
+
+	authURL, err := p.AuthURL(ctx, "https://dns.example/cb", "state", "nonce", verifier)
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+
+	q := u.Query()
+	assert.Equal(t, "openid groups", q.Get("scope"))
+	assert.Equal(t, oidc.CodeChallenge(verifier), q.Get("code_challenge"))
+	assert.Equal(t, "state", q.Get("state"))
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":    iss.srv.URL,
+		"aud":    testClientID,
+		"sub":    "user-1",
+		"exp":    now.Add(time.Hour).Unix(),
+		"iat":    now.Unix(),
+		"nonce":  "nonce",
+		"groups": []string{"admins", "users"},
+	}
+
+	iss.idToken = iss.sign(t, "ES256", "ec", claims)
+	raw, err := p.Exchange(ctx, "code", "https://dns.example/cb", verifier)
+	require.NoError(t, err)
+
+	assert.Equal(t, verifier, iss.gotForm.Get("code_verifier"))
+
+	c, err := p.VerifyIDToken(ctx, raw, "nonce", now)
+	require.NoError(t, err)
+
+	assert.Equal(t, "user-1", c.Subject())
+	assert.Equal(t, []string{"admins", "users"}, c.Strings("groups"))
+
+	c, err = p.VerifyIDToken(ctx, iss.sign(t, "RS256", "rsa", claims), "nonce", now)
+	require.NoError(t, err)
+
+	assert.Equal(t, "user-1", c.Subject())
+
+	modify := func(k string, v any) (m map[string]any) {
+		m = map[string]any{}
+		for ck, cv := range claims {
+			m[ck] = cv
+		}
+
+		m[k] = v
+
+		return m
+	}
+
+	testCases := []struct {
+		name       string
+		raw        string
+		wantErrMsg string
+	}{{
+		name:       "bad_nonce",
+		raw:        iss.sign(t, "ES256", "ec", modify("nonce", "other")),
+		wantErrMsg: "verifying id token: nonce mismatch",
+	}, {
+		name:       "expired",
+		raw:        iss.sign(t, "ES256", "ec", modify("exp", now.Add(-time.Hour).Unix())),
+		wantErrMsg: "verifying id token: token has expired",
+	}, {
+		name:       "bad_audience",
+		raw:        iss.sign(t, "ES256", "ec", modify("aud", "other")),
+		wantErrMsg: `verifying id token: audience ["other"] doesn't contain client id`,
+	}, {
+		name:       "bad_issuer",
+		raw:        iss.sign(t, "ES256", "ec", modify("iss", "https://evil.example")),
+		wantErrMsg: `verifying id token: issuer "https://evil.example", want "` + iss.srv.URL + `"`,
+	}, {
+		name:       "wrong_key",
+		raw:        iss.sign(t, "ES256", "rsa", claims),
+		wantErrMsg: "verifying id token: jwt: key type *rsa.PublicKey for alg ES256",
+	}, {
+		name:       "unknown_key",
+		raw:        iss.sign(t, "ES256", "none", claims),
+		wantErrMsg: `verifying id token: unknown key id "none"`,
+	}, {
+		name:       "alg_none",
+		raw:        iss.sign(t, "none", "ec", claims),
+		wantErrMsg: `verifying id token: jwt: alg "none": unsupported operation`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, vErr := p.VerifyIDToken(ctx, tc.raw, "nonce", now)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, vErr)
+		})
+	}
+}
@@ -672,6 +672,16 @@ var resultHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
+	"Category": func(t json.Token, ent *logEntry) error {
+		s, ok := t.(string)
+		if !ok {
+			return nil
+		}
+
+		ent.Result.Category = s
+
+		return nil
+	},
 	"CanonName": func(t json.Token, ent *logEntry) error {
 		s, ok := t.(string)
 		if !ok {
@@ -107,6 +107,10 @@ func (l *queryLog) entryToJSON(
 		jsonEntry["service_name"] = entry.Result.ServiceName
 	}
 
+	if entry.Result.Category != "" {
+		jsonEntry["category"] = entry.Result.Category
+	}
+
 	l.setMsgData(ctx, entry, jsonEntry)
 	l.setOrigAns(ctx, entry, jsonEntry)
 
@@ -0,0 +1,167 @@
+package ruleset
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// CacheExpire is the time after which a downloaded ruleset is considered
+// stale and is downloaded again.
+const CacheExpire = 7 * 24 * time.Hour
+
+// downloadTimeout is the timeout for downloading a single ruleset.
+const downloadTimeout = 30 * time.Second
+
+// Download downloads a ruleset from rawURL and saves it to a file within dir.
+// If the file already exists and is not older than [CacheExpire], it is not
+// downloaded again.  filename is the path to the saved file.
+func Download(dir, rawURL string) (filename string, err error) {
+	if err = os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("creating rulesets directory: %w", err)
+	}
+
+	// Security check for URL
+	if err = isURLAllowed(rawURL); err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	filename = filepath.Join(dir, FilenameFromURL(rawURL))
+	if isFileExistAndFresh(filename) {
+		log.Debug("ruleset: %s is fresh, not downloading", rawURL)
+
+		return filename, nil
+	}
+
+	log.Debug("ruleset: downloading from %s", rawURL)
+
+	return fetchAndSave(rawURL, filename)
+}
+
+// isURLAllowed checks if the URL is safe to download from.
+// It implements basic validation to prevent potential security issues.
+func isURLAllowed(rawURL string) error {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parsing URL: %w", err)
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", parsedURL.Scheme)
+	}
+
+	return nil
+}
+
+// isFileExistAndFresh checks if the file exists and is not older than
+// CacheExpire.
+func isFileExistAndFresh(filename string) bool {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+
+	return time.Since(info.ModTime()) < CacheExpire
+}
+
+// fetchAndSave downloads a ruleset from URL and saves it to filename.
+func fetchAndSave(rawURL, filename string) (string, error) {
+	client := &http.Client{
+		Timeout: downloadTimeout,
+	}
+
+	resp, err := makeRequest(client, rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Error("ruleset: failed to close response body: %s", closeErr)
+		}
+	}()
+
+	return saveToFile(resp.Body, filename)
+}
+
+// makeRequest creates and executes an HTTP request.
+func makeRequest(client *http.Client, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, doErr := client.Do(req)
+	if doErr != nil {
+		return nil, fmt.Errorf("downloading ruleset: %w", doErr)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			log.Error("ruleset: failed to close response body: %s", closeErr)
+		}
+
+		return nil, fmt.Errorf("downloading ruleset: HTTP status %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// saveToFile saves the ruleset content to a file.
+func saveToFile(content io.Reader, filename string) (res string, err error) {
+	f, err := os.OpenFile(filepath.Clean(filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("creating ruleset file: %w", err)
+	}
+	defer cleanupIncompleteFile(f, filename, &err)
+
+	if _, err = io.Copy(f, content); err != nil {
+		return "", fmt.Errorf("writing ruleset file: %w", err)
+	}
+
+	return filename, nil
+}
+
+// cleanupIncompleteFile closes the file and removes it if there was an error.
+func cleanupIncompleteFile(f *os.File, filename string, opErr *error) {
+	closeErr := f.Close()
+	if *opErr == nil && closeErr != nil {
+		*opErr = fmt.Errorf("closing ruleset file: %w", closeErr)
+	}
+
+	if *opErr != nil {
+		if removeErr := os.Remove(filepath.Clean(filename)); removeErr != nil {
+			log.Error("ruleset: failed to remove incomplete file %s: %s", filename, removeErr)
+		} else {
+			log.Debug("ruleset: removed incomplete file %s, error: %s", filename, *opErr)
+		}
+	}
+}
+
+// FilenameFromURL generates a safe filename from a URL.
+func FilenameFromURL(url string) string {
+	// Remove common prefixes
+	url = strings.TrimPrefix(url, "http://")
+	url = strings.TrimPrefix(url, "https://")
+
+	// Replace special characters with underscore
+	replacer := strings.NewReplacer(
+		"/", "_",
+		":", "_",
+		"?", "_",
+		"&", "_",
+		"=", "_",
+		" ", "_",
+		"..", "_", // Prevent path traversal
+		"\\", "_", // Prevent path traversal
+	)
+
+	return replacer.Replace(url)
+}
@@ -28,6 +28,10 @@ type StatsResp struct {
 	TopClients []topAddrs `json:"top_clients"`
 	TopBlocked []topAddrs `json:"top_blocked_domains"`
 
+	// TopBlockedCategories are the domain categories with the most blocked
+	// requests.
+	TopBlockedCategories []topAddrs `json:"top_blocked_categories"`
+
 	TopUpstreamsResponses []topAddrs      `json:"top_upstreams_responses"`
 	TopUpstreamsAvgTime   []topAddrsFloat `json:"top_upstreams_avg_time"`
 
@@ -73,9 +73,11 @@ func TestStats(t *testing.T) {
 	t.Run("data", func(t *testing.T) {
 		const reqDomain = "domain"
 		const respUpstream = "upstream"
+		const reqCategory = "gambling"
 
 		entries := []*stats.Entry{{
 			Domain:         reqDomain,
+			Category:       reqCategory,
 			Client:         cliIPStr,
 			Result:         stats.RFiltered,
 			ProcessingTime: time.Microsecond * 123456,
@@ -99,6 +101,7 @@ func TestStats(t *testing.T) {
 			TopQueried:            []map[string]uint64{0: {reqDomain: 1}},
 			TopClients:            []map[string]uint64{0: {cliIPStr: 2}},
 			TopBlocked:            []map[string]uint64{0: {reqDomain: 1}},
+			TopBlockedCategories:  []map[string]uint64{0: {reqCategory: 1}},
 			TopUpstreamsResponses: []map[string]uint64{0: {respUpstream: 2}},
 			TopUpstreamsAvgTime:   []map[string]float64{0: {respUpstream: 0.222222}},
 			DNSQueries: []uint64{
@@ -153,6 +156,7 @@ func TestStats(t *testing.T) {
 			TopQueried:            []map[string]uint64{},
 			TopClients:            []map[string]uint64{},
 			TopBlocked:            []map[string]uint64{},
+			TopBlockedCategories:  []map[string]uint64{},
 			TopUpstreamsResponses: []map[string]uint64{},
 			TopUpstreamsAvgTime:   []map[string]float64{},
 			DNSQueries:            _24zeroes[:],
@@ -25,6 +25,9 @@ const (
 
 	// maxUpstreams is the max number of top upstreams to return.
 	maxUpstreams = 100
+
+	// maxCategories is the max number of top blocked categories to return.
+	maxCategories = 64
 )
 
 // UnitIDGenFunc is the signature of a function that generates a unique ID for
@@ -63,6 +66,11 @@ type Entry struct {
 	// Domain is the domain name requested.
 	Domain string
 
+	// Category is the name of the domain category the request has been
+	// blocked by.  It's empty unless the request has been blocked by a
+	// category.
+	Category string
+
 	// UpstreamStats contains the DNS query statistics for both the upstream and
 	// fallback DNS servers.  Don't modify items in the slice.
 	UpstreamStats []*proxy.UpstreamStatistics
@@ -100,6 +108,10 @@ type unit struct {
 	// been blocked.
 	blockedDomains map[string]uint64
 
+	// blockedCategories stores the number of requests blocked by each domain
+	// category.
+	blockedCategories map[string]uint64
+
 	// clients stores the number of requests from each client.
 	clients map[string]uint64
 
@@ -133,6 +145,7 @@ func newUnit(id uint32) (u *unit) {
 	return &unit{
 		domains:            map[string]uint64{},
 		blockedDomains:     map[string]uint64{},
+		blockedCategories:  map[string]uint64{},
 		clients:            map[string]uint64{},
 		upstreamsResponses: map[string]uint64{},
 		upstreamsTimeSum:   map[string]uint64{},
@@ -172,6 +185,10 @@ type unitDB struct {
 	// responses from each upstream.
 	UpstreamsTimeSum []countPair
 
+	// BlockedCategories is the number of requests blocked by each domain
+	// category.
+	BlockedCategories []countPair
+
 	// NTotal is the total number of requests.
 	NTotal uint64
 
@@ -269,6 +286,7 @@ func (u *unit) serialize() (udb *unitDB) {
 		Clients:            convertMapToSlice(u.clients, maxClients),
 		UpstreamsResponses: convertMapToSlice(u.upstreamsResponses, maxUpstreams),
 		UpstreamsTimeSum:   convertMapToSlice(u.upstreamsTimeSum, maxUpstreams),
+		BlockedCategories:  convertMapToSlice(u.blockedCategories, maxCategories),
 		TimeAvg:            timeAvg,
 	}
 }
@@ -308,6 +326,7 @@ func (u *unit) deserialize(udb *unitDB) {
 	copy(u.nResult, udb.NResult)
 	u.domains = convertSliceToMap(udb.Domains)
 	u.blockedDomains = convertSliceToMap(udb.BlockedDomains)
+	u.blockedCategories = convertSliceToMap(udb.BlockedCategories)
 	u.clients = convertSliceToMap(udb.Clients)
 	u.upstreamsResponses = convertSliceToMap(udb.UpstreamsResponses)
 	u.upstreamsTimeSum = convertSliceToMap(udb.UpstreamsTimeSum)
@@ -323,6 +342,10 @@ func (u *unit) add(e *Entry) {
 		u.blockedDomains[e.Domain]++
 	}
 
+	if e.Category != "" {
+		u.blockedCategories[e.Category]++
+	}
+
 	u.clients[e.Client]++
 	pt := uint64(e.ProcessingTime.Microseconds())
 	u.timeSum += pt
@@ -415,6 +438,7 @@ func (s *StatsCtx) getData(limit uint32) (resp *StatsResp, ok bool) {
 			TimeUnits: "days",
 
 			TopBlocked:            []topAddrs{},
+			TopBlockedCategories:  []topAddrs{},
 			TopClients:            []topAddrs{},
 			TopQueried:            []topAddrs{},
 			TopUpstreamsResponses: []topAddrs{},
@@ -445,6 +469,12 @@ func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp
 		TopUpstreamsResponses: topUpstreamsResponses,
 		TopUpstreamsAvgTime:   topUpstreamsAvgTime,
 		TopClients:            topsCollector(units, maxClients, nil, topClientPairs(s)),
+		TopBlockedCategories: topsCollector(
+			units,
+			maxCategories,
+			nil,
+			func(u *unitDB) (pairs []countPair) { return u.BlockedCategories },
+		),
 	}
 
 	s.fillCollectedStats(resp, units, curID)
@@ -17,6 +17,7 @@ func TestUnit_Deserialize(t *testing.T) {
 		want: unit{
 			domains:            map[string]uint64{},
 			blockedDomains:     map[string]uint64{},
+			blockedCategories:  map[string]uint64{},
 			clients:            map[string]uint64{},
 			nResult:            []uint64{0, 0, 0, 0, 0, 0},
 			id:                 0,
@@ -44,6 +45,9 @@ func TestUnit_Deserialize(t *testing.T) {
 			blockedDomains: map[string]uint64{
 				"example.net": 1,
 			},
+			blockedCategories: map[string]uint64{
+				"gambling": 1,
+			},
 			clients: map[string]uint64{
 				"127.0.0.1": 2,
 			},
@@ -66,6 +70,9 @@ func TestUnit_Deserialize(t *testing.T) {
 			BlockedDomains: []countPair{{
 				"example.net", 1,
 			}},
+			BlockedCategories: []countPair{{
+				"gambling", 1,
+			}},
 			Clients: []countPair{{
 				"127.0.0.1", 2,
 			}},
@@ -0,0 +1,199 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// CBOR major types, see RFC 8949, Section 3.1.
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// CBOR simple values, see RFC 8949, Section 3.3.
+const (
+	cborFalse = 20
+	cborTrue  = 21
+	cborNull  = 22
+)
+
+// cborMaxDepth is the maximum nesting level of CBOR data items.  WebAuthn
+// structures are never nested deeper than a few levels.
+const cborMaxDepth = 8
+
+// errCBORTruncated is returned when the CBOR data ends unexpectedly.
+const errCBORTruncated errors.Error = "cbor: unexpected end of data"
+
+// decodeCBOR decodes a single CBOR data item from data and returns the
+// remaining data.  Integers are decoded as int64, byte strings as []byte, text
+// strings as string, arrays as []any, and maps as map[any]any.  Only the
+// definite-length items used by WebAuthn are supported.  Tags are skipped.
+func decodeCBOR(data []byte) (v any, rest []byte, err error) {
+	return decodeCBORItem(data, 0)
+}
+
+// decodeCBORItem decodes a single CBOR data item at the nesting level depth.
+func decodeCBORItem(data []byte, depth int) (v any, rest []byte, err error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.Error("cbor: data nested too deeply")
+	}
+
+	major, arg, rest, err := decodeCBORHead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("cbor: integer %d overflows int64", arg)
+		}
+
+		return int64(arg), rest, nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("cbor: negative integer -1-%d overflows int64", arg)
+		}
+
+		return -1 - int64(arg), rest, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+
+		if major == cborText {
+			return string(rest[:arg]), rest[arg:], nil
+		}
+
+		return rest[:arg:arg], rest[arg:], nil
+	case cborArray:
+		return decodeCBORArray(rest, arg, depth)
+	case cborMap:
+		return decodeCBORMap(rest, arg, depth)
+	case cborTag:
+		return decodeCBORItem(rest, depth+1)
+	default:
+		return decodeCBORSimple(arg, rest)
+	}
+}
+
+// decodeCBORHead decodes the initial byte and the argument of a CBOR data item.
+func decodeCBORHead(data []byte) (major byte, arg uint64, rest []byte, err error) {
+	if len(data) == 0 {
+		return 0, 0, nil, errCBORTruncated
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	rest = data[1:]
+
+	var n int
+	switch {
+	case info < 24:
+		return major, uint64(info), rest, nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default:
+		return 0, 0, nil, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+
+	if len(rest) < n {
+		return 0, 0, nil, errCBORTruncated
+	}
+
+	buf := make([]byte, 8)
+	copy(buf[8-n:], rest[:n])
+
+	return major, binary.BigEndian.Uint64(buf), rest[n:], nil
+}
+
+// decodeCBORArray decodes n items of a CBOR array from data.
+func decodeCBORArray(data []byte, n uint64, depth int) (v any, rest []byte, err error) {
+	// Each item takes at least one byte, so don't trust n to allocate.
+	if n > uint64(len(data)) {
+		return nil, nil, errCBORTruncated
+	}
+
+	arr := make([]any, 0, n)
+	rest = data
+	for range n {
+		var item any
+		item, rest, err = decodeCBORItem(rest, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		arr = append(arr, item)
+	}
+
+	return arr, rest, nil
+}
+
+// decodeCBORMap decodes n pairs of a CBOR map from data.  Only integer and text
+// keys are supported.
+func decodeCBORMap(data []byte, n uint64, depth int) (v any, rest []byte, err error) {
+	// Each pair takes at least two bytes, so don't trust n to allocate.
+	if n > uint64(len(data)/2) {
+		return nil, nil, errCBORTruncated
+	}
+
+	m := make(map[any]any, n)
+	rest = data
+	for range n {
+		var key, val any
+		key, rest, err = decodeCBORItem(rest, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch key.(type) {
+		case int64, string:
+			// Go on.
+		default:
+			return nil, nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+		}
+
+		if _, ok := m[key]; ok {
+			return nil, nil, fmt.Errorf("cbor: duplicate map key %v", key)
+		}
+
+		val, rest, err = decodeCBORItem(rest, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		m[key] = val
+	}
+
+	return m, rest, nil
+}
+
+// decodeCBORSimple decodes the CBOR simple value arg.  Floating-point numbers
+// are not supported.
+func decodeCBORSimple(arg uint64, rest []byte) (v any, _ []byte, err error) {
+	switch arg {
+	case cborFalse:
+		return false, rest, nil
+	case cborTrue:
+		return true, rest, nil
+	case cborNull:
+		return nil, rest, nil
+	default:
+		return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", arg)
+	}
+}
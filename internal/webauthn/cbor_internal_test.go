@@ -0,0 +1,156 @@
+package webauthn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	testCases := []struct {
+		want       any
+		name       string
+		wantErrMsg string
+		in         []byte
+	}{{
+		want:       int64(500),
+		name:       "uint",
+		wantErrMsg: "",
+		in:         []byte{0x19, 0x01, 0xf4},
+	}, {
+		want:       int64(-257),
+		name:       "negative",
+		wantErrMsg: "",
+		in:         []byte{0x39, 0x01, 0x00},
+	}, {
+		want:       map[any]any{int64(1): []byte{0xab}, "a": "b"},
+		name:       "map",
+		wantErrMsg: "",
+		in:         []byte{0xa2, 0x01, 0x41, 0xab, 0x61, 'a', 0x61, 'b'},
+	}, {
+		want:       []any{true, nil},
+		name:       "array",
+		wantErrMsg: "",
+		in:         []byte{0x82, 0xf5, 0xf6},
+	}, {
+		want:       nil,
+		name:       "truncated_bytes",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{0x45, 0x01},
+	}, {
+		want:       nil,
+		name:       "huge_array",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}, {
+		want:       nil,
+		name:       "indefinite",
+		wantErrMsg: "cbor: unsupported additional information 31",
+		in:         []byte{0x9f, 0xff},
+	}, {
+		want:       nil,
+		name:       "duplicate_key",
+		wantErrMsg: "cbor: duplicate map key 1",
+		in:         []byte{0xa2, 0x01, 0x01, 0x01, 0x02},
+	}, {
+		want:       nil,
+		name:       "float",
+		wantErrMsg: "cbor: unsupported simple value 0",
+		in:         []byte{0xf9, 0x00, 0x00},
+	}, {
+		want:       nil,
+		name:       "empty",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{},
+	}, {
+		want:       nil,
+		name:       "truncated_head",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{0x1a, 0x00, 0x01},
+	}, {
+		want:       nil,
+		name:       "truncated_length",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{0x5b, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x01},
+	}, {
+		want:       nil,
+		name:       "truncated_array",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{0x83, 0x01, 0x02},
+	}, {
+		want:       nil,
+		name:       "truncated_map",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{0xa2, 0x01, 0x02, 0x03},
+	}, {
+		want:       nil,
+		name:       "huge_map",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         []byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02},
+	}, {
+		want:       nil,
+		name:       "uint_overflow",
+		wantErrMsg: "cbor: integer 18446744073709551615 overflows int64",
+		in:         []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}, {
+		want:       nil,
+		name:       "negative_overflow",
+		wantErrMsg: "cbor: negative integer -1-9223372036854775808 overflows int64",
+		in:         []byte{0x3b, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	}, {
+		want:       nil,
+		name:       "bytes_map_key",
+		wantErrMsg: "cbor: unsupported map key type []uint8",
+		in:         []byte{0xa1, 0x41, 0x01, 0x01},
+	}, {
+		want:       nil,
+		name:       "reserved_info",
+		wantErrMsg: "cbor: unsupported additional information 28",
+		in:         []byte{0x1c},
+	}, {
+		want:       nil,
+		name:       "too_deep",
+		wantErrMsg: "cbor: data nested too deeply",
+		in:         append(bytes.Repeat([]byte{0x81}, cborMaxDepth+1), 0x01),
+	}, {
+		want:       nil,
+		name:       "too_deep_tags",
+		wantErrMsg: "cbor: data nested too deeply",
+		in:         append(bytes.Repeat([]byte{0xc1}, cborMaxDepth+1), 0x01),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _, err := decodeCBOR(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func FuzzDecodeCBOR(f *testing.F) {
+	for _, seed := range [][]byte{
+		{0x19, 0x01, 0xf4},
+		{0xa2, 0x01, 0x41, 0xab, 0x61, 'a', 0x61, 'b'},
+		{0x82, 0xf5, 0xf6},
+		{0xc1, 0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		{0xbf, 0xff},
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, rest, err := decodeCBOR(data)
+		if err != nil {
+			return
+		}
+
+		// The remaining data must be a suffix of the input.
+		require.LessOrEqual(t, len(rest), len(data))
+		assert.Equal(t, data[len(data)-len(rest):], rest)
+	})
+}
@@ -0,0 +1,178 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// COSE algorithm identifiers, see the IANA COSE Algorithms registry.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms are the COSE algorithms of the public keys supported
+// by this package in the order of preference.
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters, see RFC 9053.
+const (
+	coseKeyKty = 1
+	coseKeyAlg = 3
+
+	// coseKeyCrv is also the modulus of RSA keys.
+	coseKeyCrv = -1
+
+	// coseKeyX is also the exponent of RSA keys.
+	coseKeyX = -2
+
+	coseKeyY = -3
+)
+
+// COSE key types and curves.
+const (
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// minRSABits is the minimum size of RSA keys accepted.
+const minRSABits = 2048
+
+// coseKey is a parsed COSE public key.
+type coseKey struct {
+	pub crypto.PublicKey
+	alg int64
+}
+
+// parseCOSEKey parses the COSE_Key structure from data and returns the rest of
+// the data.
+func parseCOSEKey(data []byte) (k *coseKey, rest []byte, err error) {
+	v, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("cose key: unexpected type %T", v)
+	}
+
+	kty, _ := m[int64(coseKeyKty)].(int64)
+	alg, _ := m[int64(coseKeyAlg)].(int64)
+
+	k = &coseKey{
+		alg: alg,
+	}
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		k.pub, err = parseCOSEKeyEC2(m)
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		k.pub, err = parseCOSEKeyOKP(m)
+	case kty == coseKtyRSA && alg == AlgRS256:
+		k.pub, err = parseCOSEKeyRSA(m)
+	default:
+		err = fmt.Errorf("key type %d with algorithm %d: %w", kty, alg, errors.ErrUnsupported)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("cose key: %w", err)
+	}
+
+	return k, rest, nil
+}
+
+// parseCOSEKeyEC2 parses a P-256 public key from the COSE_Key parameters m.
+func parseCOSEKeyEC2(m map[any]any) (pub *ecdsa.PublicKey, err error) {
+	crv, _ := m[int64(coseKeyCrv)].(int64)
+	x, _ := m[int64(coseKeyX)].([]byte)
+	y, _ := m[int64(coseKeyY)].([]byte)
+	if crv != coseCrvP256 {
+		return nil, fmt.Errorf("curve %d: %w", crv, errors.ErrUnsupported)
+	} else if len(x) != 32 || len(y) != 32 {
+		return nil, errors.Error("bad p-256 coordinates length")
+	}
+
+	// Use package crypto/ecdh to make sure that the point is on the curve.
+	uncompressed := append(append([]byte{0x04}, x...), y...)
+	_, err = ecdh.P256().NewPublicKey(uncompressed)
+	if err != nil {
+		return nil, fmt.Errorf("p-256 point: %w", err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// parseCOSEKeyOKP parses an Ed25519 public key from the COSE_Key parameters m.
+func parseCOSEKeyOKP(m map[any]any) (pub ed25519.PublicKey, err error) {
+	crv, _ := m[int64(coseKeyCrv)].(int64)
+	x, _ := m[int64(coseKeyX)].([]byte)
+	if crv != coseCrvEd25519 {
+		return nil, fmt.Errorf("curve %d: %w", crv, errors.ErrUnsupported)
+	} else if len(x) != ed25519.PublicKeySize {
+		return nil, errors.Error("bad ed25519 key length")
+	}
+
+	return ed25519.PublicKey(x), nil
+}
+
+// parseCOSEKeyRSA parses an RSA public key from the COSE_Key parameters m.
+func parseCOSEKeyRSA(m map[any]any) (pub *rsa.PublicKey, err error) {
+	n, _ := m[int64(coseKeyCrv)].([]byte)
+	e, _ := m[int64(coseKeyX)].([]byte)
+	if len(e) == 0 || len(e) > 4 {
+		return nil, errors.Error("bad rsa exponent length")
+	}
+
+	pub = &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+
+	if bits := pub.N.BitLen(); bits < minRSABits {
+		return nil, fmt.Errorf("rsa key of %d bits is too short", bits)
+	}
+
+	return pub, nil
+}
+
+// verify returns an error if sig isn't a valid signature of data made with k.
+func (k *coseKey) verify(data, sig []byte) (err error) {
+	sum := sha256.Sum256(data)
+
+	var ok bool
+	switch pub := k.pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, sum[:], sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, data, sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	default:
+		// Must not happen, since parseCOSEKey only returns the keys above.
+		panic(fmt.Errorf("cose key: unexpected key type %T", pub))
+	}
+
+	if !ok {
+		return errors.Error("invalid signature")
+	}
+
+	return nil
+}
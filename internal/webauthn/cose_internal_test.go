@@ -0,0 +1,207 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCBORBytes returns b encoded as a CBOR byte string.
+func testCBORBytes(b []byte) (enc []byte) {
+	switch l := len(b); {
+	case l < 24:
+		enc = []byte{0x40 | byte(l)}
+	case l < 0x100:
+		enc = []byte{0x58, byte(l)}
+	default:
+		enc = binary.BigEndian.AppendUint16([]byte{0x59}, uint16(l))
+	}
+
+	return append(enc, b...)
+}
+
+// newTestCOSEKeyEC2 returns an encoded EC2 COSE_Key with the given algorithm,
+// curve, and coordinates.  alg and crv must be already encoded as CBOR.
+func newTestCOSEKeyEC2(alg, crv byte, x, y []byte) (data []byte) {
+	data = []byte{0xa5, 0x01, 0x02, 0x03, alg, 0x20, crv, 0x21}
+	data = append(data, testCBORBytes(x)...)
+	data = append(data, 0x22)
+
+	return append(data, testCBORBytes(y)...)
+}
+
+// newTestCOSEKeyRSA returns an encoded RSA COSE_Key with the given modulus and
+// exponent.
+func newTestCOSEKeyRSA(n, e []byte) (data []byte) {
+	data = []byte{0xa4, 0x01, 0x03, 0x03, 0x39, 0x01, 0x00, 0x20}
+	data = append(data, testCBORBytes(n)...)
+	data = append(data, 0x21)
+
+	return append(data, testCBORBytes(e)...)
+}
+
+// newTestP256Coords returns the coordinates of a new random P-256 key.
+func newTestP256Coords(tb testing.TB) (x, y []byte) {
+	tb.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(tb, err)
+
+	pub, err := priv.PublicKey.ECDH()
+	require.NoError(tb, err)
+
+	point := pub.Bytes()
+
+	return point[1:33], point[33:]
+}
+
+func TestParseCOSEKey(t *testing.T) {
+	const (
+		cborAlgES256 = 0x26
+		cborAlgEdDSA = 0x27
+		cborCrvP256  = 0x01
+		cborCrvP384  = 0x02
+	)
+
+	x, y := newTestP256Coords(t)
+	validEC2 := newTestCOSEKeyEC2(cborAlgES256, cborCrvP256, x, y)
+
+	okpPrefix := []byte{0xa4, 0x01, 0x01, 0x03, cborAlgEdDSA, 0x20, 0x06, 0x21}
+	validOKP := append(bytes.Clone(okpPrefix), testCBORBytes(make([]byte, 32))...)
+	shortOKP := append(bytes.Clone(okpPrefix), testCBORBytes(make([]byte, 31))...)
+
+	longN := append([]byte{0x80}, make([]byte, minRSABits/8-1)...)
+	shortN := append([]byte{0x80}, make([]byte, 1024/8-1)...)
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		in         []byte
+		wantAlg    int64
+	}{{
+		name:       "ec2",
+		wantErrMsg: "",
+		in:         validEC2,
+		wantAlg:    AlgES256,
+	}, {
+		name:       "okp",
+		wantErrMsg: "",
+		in:         validOKP,
+		wantAlg:    AlgEdDSA,
+	}, {
+		name:       "rsa",
+		wantErrMsg: "",
+		in:         newTestCOSEKeyRSA(longN, []byte{0x01, 0x00, 0x01}),
+		wantAlg:    AlgRS256,
+	}, {
+		name:       "not_map",
+		wantErrMsg: "cose key: unexpected type int64",
+		in:         []byte{0x01},
+		wantAlg:    0,
+	}, {
+		name:       "empty_map",
+		wantErrMsg: "cose key: key type 0 with algorithm 0: unsupported operation",
+		in:         []byte{0xa0},
+		wantAlg:    0,
+	}, {
+		name:       "ec2_wrong_alg",
+		wantErrMsg: "cose key: key type 2 with algorithm -8: unsupported operation",
+		in:         newTestCOSEKeyEC2(cborAlgEdDSA, cborCrvP256, x, y),
+		wantAlg:    0,
+	}, {
+		name:       "unknown_kty",
+		wantErrMsg: "cose key: key type 4 with algorithm -7: unsupported operation",
+		in:         []byte{0xa2, 0x01, 0x04, 0x03, cborAlgES256},
+		wantAlg:    0,
+	}, {
+		name:       "ec2_wrong_curve",
+		wantErrMsg: "cose key: curve 2: unsupported operation",
+		in:         newTestCOSEKeyEC2(cborAlgES256, cborCrvP384, x, y),
+		wantAlg:    0,
+	}, {
+		name:       "ec2_short_x",
+		wantErrMsg: "cose key: bad p-256 coordinates length",
+		in:         newTestCOSEKeyEC2(cborAlgES256, cborCrvP256, x[1:], y),
+		wantAlg:    0,
+	}, {
+		name:       "ec2_long_y",
+		wantErrMsg: "cose key: bad p-256 coordinates length",
+		in:         newTestCOSEKeyEC2(cborAlgES256, cborCrvP256, x, append(y, 0x00)),
+		wantAlg:    0,
+	}, {
+		name:       "ec2_not_on_curve",
+		wantErrMsg: "cose key: p-256 point: P256 point not on curve",
+		in:         newTestCOSEKeyEC2(cborAlgES256, cborCrvP256, x, x),
+		wantAlg:    0,
+	}, {
+		name:       "okp_short",
+		wantErrMsg: "cose key: bad ed25519 key length",
+		in:         shortOKP,
+		wantAlg:    0,
+	}, {
+		name:       "rsa_short",
+		wantErrMsg: "cose key: rsa key of 1024 bits is too short",
+		in:         newTestCOSEKeyRSA(shortN, []byte{0x01, 0x00, 0x01}),
+		wantAlg:    0,
+	}, {
+		name:       "rsa_no_exponent",
+		wantErrMsg: "cose key: bad rsa exponent length",
+		in:         newTestCOSEKeyRSA(longN, nil),
+		wantAlg:    0,
+	}, {
+		name:       "rsa_long_exponent",
+		wantErrMsg: "cose key: bad rsa exponent length",
+		in:         newTestCOSEKeyRSA(longN, []byte{0x01, 0x00, 0x00, 0x00, 0x01}),
+		wantAlg:    0,
+	}, {
+		name:       "truncated",
+		wantErrMsg: "cbor: unexpected end of data",
+		in:         validEC2[:len(validEC2)-1],
+		wantAlg:    0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			k, rest, err := parseCOSEKey(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg != "" {
+				return
+			}
+
+			require.NotNil(t, k)
+
+			assert.Equal(t, tc.wantAlg, k.alg)
+			assert.Empty(t, rest)
+		})
+	}
+}
+
+func FuzzParseCOSEKey(f *testing.F) {
+	x, y := newTestP256Coords(f)
+
+	f.Add(newTestCOSEKeyEC2(0x26, 0x01, x, y))
+	f.Add(newTestCOSEKeyRSA(make([]byte, 256), []byte{0x01, 0x00, 0x01}))
+	f.Add([]byte{0xa4, 0x01, 0x01, 0x03, 0x27, 0x20, 0x06, 0x21, 0x41, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		k, rest, err := parseCOSEKey(data)
+		if err != nil {
+			return
+		}
+
+		require.NotNil(t, k)
+
+		assert.NotNil(t, k.pub)
+		assert.LessOrEqual(t, len(rest), len(data))
+
+		// Verifying a bogus signature must not panic.
+		assert.Error(t, k.verify(data, data))
+	})
+}
@@ -0,0 +1,311 @@
+// Package webauthn implements the verification of the Web Authentication
+// registration and authentication ceremonies performed by browsers and
+// authenticators, such as passkeys and security keys.
+//
+// See https://www.w3.org/TR/webauthn-2.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// ChallengeSize is the size of challenges in bytes.
+const ChallengeSize = 32
+
+// NewChallenge returns a new random challenge for a ceremony.
+func NewChallenge() (c []byte) {
+	c = make([]byte, ChallengeSize)
+
+	// Since Go 1.24, crypto/rand.Read doesn't return an error and crashes
+	// unrecoverably instead.
+	_, _ = rand.Read(c)
+
+	return c
+}
+
+// Credential is a public key credential registered by an authenticator.
+type Credential struct {
+	// ID is the credential identifier chosen by the authenticator.
+	ID []byte `json:"id"`
+
+	// PublicKey is the public key of the credential in the COSE_Key format.
+	PublicKey []byte `json:"public_key"`
+
+	// SignCount is the last signature counter reported by the authenticator.
+	// Zero means that the authenticator doesn't support counters.
+	SignCount uint32 `json:"sign_count"`
+}
+
+// Client data types, see https://www.w3.org/TR/webauthn-2/#dom-collectedclientdata-type.
+const (
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+)
+
+// clientData is the part of CollectedClientData used for the verification.
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// verifyClientData returns an error if the CollectedClientData JSON in data
+// isn't of type typ, for challenge, and from an origin of rpID.
+func verifyClientData(data []byte, typ string, challenge []byte, rpID string) (err error) {
+	cd := &clientData{}
+	err = json.Unmarshal(data, cd)
+	if err != nil {
+		return fmt.Errorf("client data: %w", err)
+	}
+
+	if cd.Type != typ {
+		return fmt.Errorf("client data: type %q, want %q", cd.Type, typ)
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil {
+		return fmt.Errorf("client data: challenge: %w", err)
+	} else if subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return errors.Error("client data: challenge mismatch")
+	}
+
+	return verifyOrigin(cd.Origin, rpID)
+}
+
+// verifyOrigin returns an error if origin isn't a secure origin with the
+// domain equal to rpID or its subdomain.  Plain HTTP is only allowed for
+// localhost, as in browsers.
+func verifyOrigin(origin, rpID string) (err error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("client data: origin: %w", err)
+	}
+
+	host := u.Hostname()
+	if host != rpID && !strings.HasSuffix(host, "."+rpID) {
+		return fmt.Errorf("client data: origin %q doesn't match rp id %q", origin, rpID)
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && host == "localhost") {
+		return fmt.Errorf("client data: origin %q is not secure", origin)
+	}
+
+	return nil
+}
+
+// Authenticator data flags, see https://www.w3.org/TR/webauthn-2/#flags.
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// authDataMinLen is the length of the authenticator data without the attested
+// credential data and extensions.
+const authDataMinLen = sha256.Size + 1 + 4
+
+// authData is the parsed authenticator data.
+type authData struct {
+	// cred is not nil if the data contains the attested credential data.
+	cred *Credential
+
+	signCount uint32
+	flags     byte
+}
+
+// parseAuthData parses the authenticator data and verifies the hash of the
+// relying party identifier and the flags.
+func parseAuthData(data []byte, rpID string, requireUV bool) (ad *authData, err error) {
+	if len(data) < authDataMinLen {
+		return nil, fmt.Errorf("authenticator data: length %d is too short", len(data))
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(data[:sha256.Size], rpIDHash[:]) {
+		return nil, errors.Error("authenticator data: rp id hash mismatch")
+	}
+
+	ad = &authData{
+		flags:     data[sha256.Size],
+		signCount: binary.BigEndian.Uint32(data[sha256.Size+1 : authDataMinLen]),
+	}
+
+	if ad.flags&flagUserPresent == 0 {
+		return nil, errors.Error("authenticator data: user is not present")
+	} else if requireUV && ad.flags&flagUserVerified == 0 {
+		return nil, errors.Error("authenticator data: user is not verified")
+	}
+
+	if ad.flags&flagAttestedCredData == 0 {
+		return ad, nil
+	}
+
+	ad.cred, err = parseAttestedCredData(data[authDataMinLen:])
+	if err != nil {
+		return nil, fmt.Errorf("authenticator data: %w", err)
+	}
+
+	ad.cred.SignCount = ad.signCount
+
+	return ad, nil
+}
+
+// parseAttestedCredData parses the attested credential data and makes sure that
+// the public key is supported.  The extensions following it, if any, are
+// ignored.
+func parseAttestedCredData(data []byte) (cred *Credential, err error) {
+	const (
+		aaguidLen = 16
+		idLenLen  = 2
+	)
+
+	if len(data) < aaguidLen+idLenLen {
+		return nil, errors.Error("attested credential data: too short")
+	}
+
+	data = data[aaguidLen:]
+	idLen := int(binary.BigEndian.Uint16(data))
+	data = data[idLenLen:]
+	if idLen == 0 || len(data) < idLen {
+		return nil, fmt.Errorf("attested credential data: bad id length %d", idLen)
+	}
+
+	id := data[:idLen]
+	data = data[idLen:]
+
+	_, rest, err := parseCOSEKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("attested credential data: %w", err)
+	}
+
+	return &Credential{
+		ID:        bytes.Clone(id),
+		PublicKey: bytes.Clone(data[:len(data)-len(rest)]),
+	}, nil
+}
+
+// RegistrationParams are the parameters of a registration ceremony.
+type RegistrationParams struct {
+	// ClientDataJSON is the JSON-serialized client data from the
+	// AuthenticatorAttestationResponse.
+	ClientDataJSON []byte
+
+	// AttestationObject is the CBOR-encoded attestation object from the
+	// AuthenticatorAttestationResponse.
+	AttestationObject []byte
+
+	// Challenge is the challenge sent to the browser.
+	Challenge []byte
+
+	// RPID is the identifier of the relying party, which is the domain name
+	// the browser has used.
+	RPID string
+
+	// RequireUserVerification, if true, requires the authenticator to verify
+	// the user, for example with a PIN or biometrics.
+	RequireUserVerification bool
+}
+
+// VerifyRegistration verifies the result of a registration ceremony and returns
+// the new credential.  Attestation statements are not verified, since the
+// relying party is expected to request no attestation.
+func VerifyRegistration(p *RegistrationParams) (c *Credential, err error) {
+	err = verifyClientData(p.ClientDataJSON, clientDataTypeCreate, p.Challenge, p.RPID)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _, err := decodeCBOR(p.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("attestation object: %w", err)
+	}
+
+	attObj, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("attestation object: unexpected type %T", v)
+	}
+
+	data, ok := attObj["authData"].([]byte)
+	if !ok {
+		return nil, errors.Error("attestation object: no authenticator data")
+	}
+
+	ad, err := parseAuthData(data, p.RPID, p.RequireUserVerification)
+	if err != nil {
+		return nil, err
+	} else if ad.cred == nil {
+		return nil, errors.Error("authenticator data: no attested credential data")
+	}
+
+	return ad.cred, nil
+}
+
+// AssertionParams are the parameters of an authentication ceremony.
+type AssertionParams struct {
+	// ClientDataJSON is the JSON-serialized client data from the
+	// AuthenticatorAssertionResponse.
+	ClientDataJSON []byte
+
+	// AuthenticatorData is the authenticator data from the
+	// AuthenticatorAssertionResponse.
+	AuthenticatorData []byte
+
+	// Signature is the signature from the AuthenticatorAssertionResponse.
+	Signature []byte
+
+	// Challenge is the challenge sent to the browser.
+	Challenge []byte
+
+	// RPID is the identifier of the relying party, which is the domain name
+	// the browser has used.
+	RPID string
+
+	// RequireUserVerification, if true, requires the authenticator to verify
+	// the user, for example with a PIN or biometrics.
+	RequireUserVerification bool
+}
+
+// VerifyAssertion verifies the result of an authentication ceremony with c and
+// returns the new value of the signature counter, which should be stored in c.
+func VerifyAssertion(c *Credential, p *AssertionParams) (signCount uint32, err error) {
+	err = verifyClientData(p.ClientDataJSON, clientDataTypeGet, p.Challenge, p.RPID)
+	if err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthData(p.AuthenticatorData, p.RPID, p.RequireUserVerification)
+	if err != nil {
+		return 0, err
+	}
+
+	key, _, err := parseCOSEKey(c.PublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("credential: %w", err)
+	}
+
+	clientDataHash := sha256.Sum256(p.ClientDataJSON)
+	signed := append(bytes.Clone(p.AuthenticatorData), clientDataHash[:]...)
+	err = key.verify(signed, p.Signature)
+	if err != nil {
+		return 0, err
+	}
+
+	if (ad.signCount != 0 || c.SignCount != 0) && ad.signCount <= c.SignCount {
+		return 0, fmt.Errorf(
+			"signature counter %d is not greater than %d, authenticator may be cloned",
+			ad.signCount,
+			c.SignCount,
+		)
+	}
+
+	return ad.signCount, nil
+}
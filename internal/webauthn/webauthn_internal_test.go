@@ -0,0 +1,191 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRPID is the relying party identifier for tests.
+const testRPID = "example.com"
+
+// newTestAuthData returns the authenticator data for [testRPID] with the given
+// flags and attested credential data.
+func newTestAuthData(flags byte, credData []byte) (data []byte) {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data = append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, 42)
+
+	return append(data, credData...)
+}
+
+// newTestCredData returns the attested credential data with the given
+// credential ID length, ID, and public key.
+func newTestCredData(idLen uint16, id, key []byte) (data []byte) {
+	data = make([]byte, 16)
+	data = binary.BigEndian.AppendUint16(data, idLen)
+	data = append(data, id...)
+
+	return append(data, key...)
+}
+
+func TestParseAuthData(t *testing.T) {
+	x, y := newTestP256Coords(t)
+	key := newTestCOSEKeyEC2(0x26, 0x01, x, y)
+
+	const (
+		flagsUP   = flagUserPresent
+		flagsUPAT = flagUserPresent | flagAttestedCredData
+	)
+
+	wrongRP := newTestAuthData(flagsUP, nil)
+	wrongRP[0] ^= 0xff
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		in         []byte
+		requireUV  bool
+		wantCred   bool
+	}{{
+		name:       "assertion",
+		wantErrMsg: "",
+		in:         newTestAuthData(flagsUP, nil),
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "attestation",
+		wantErrMsg: "",
+		in:         newTestAuthData(flagsUPAT, newTestCredData(1, []byte{0x01}, key)),
+		requireUV:  false,
+		wantCred:   true,
+	}, {
+		name:       "verified",
+		wantErrMsg: "",
+		in:         newTestAuthData(flagsUP|flagUserVerified, nil),
+		requireUV:  true,
+		wantCred:   false,
+	}, {
+		name:       "empty",
+		wantErrMsg: "authenticator data: length 0 is too short",
+		in:         nil,
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "too_short",
+		wantErrMsg: "authenticator data: length 36 is too short",
+		in:         newTestAuthData(flagsUP, nil)[:authDataMinLen-1],
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "rp_id_mismatch",
+		wantErrMsg: "authenticator data: rp id hash mismatch",
+		in:         wrongRP,
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "not_present",
+		wantErrMsg: "authenticator data: user is not present",
+		in:         newTestAuthData(flagUserVerified, nil),
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "not_verified",
+		wantErrMsg: "authenticator data: user is not verified",
+		in:         newTestAuthData(flagsUP, nil),
+		requireUV:  true,
+		wantCred:   false,
+	}, {
+		name:       "no_cred_data",
+		wantErrMsg: "authenticator data: attested credential data: too short",
+		in:         newTestAuthData(flagsUPAT, nil),
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "zero_id_len",
+		wantErrMsg: "authenticator data: attested credential data: bad id length 0",
+		in:         newTestAuthData(flagsUPAT, newTestCredData(0, nil, key)),
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "id_len_overflow",
+		wantErrMsg: "authenticator data: attested credential data: bad id length 65535",
+		in:         newTestAuthData(flagsUPAT, newTestCredData(0xffff, []byte{0x01}, key)),
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "no_key",
+		wantErrMsg: "authenticator data: attested credential data: cbor: unexpected end of data",
+		in:         newTestAuthData(flagsUPAT, newTestCredData(1, []byte{0x01}, nil)),
+		requireUV:  false,
+		wantCred:   false,
+	}, {
+		name:       "truncated_key",
+		wantErrMsg: "authenticator data: attested credential data: cbor: unexpected end of data",
+		in: newTestAuthData(
+			flagsUPAT,
+			newTestCredData(1, []byte{0x01}, key[:len(key)-1]),
+		),
+		requireUV: false,
+		wantCred:  false,
+	}, {
+		name:       "bad_key",
+		wantErrMsg: "authenticator data: attested credential data: cose key: unexpected type int64",
+		in:         newTestAuthData(flagsUPAT, newTestCredData(1, []byte{0x01}, []byte{0x01})),
+		requireUV:  false,
+		wantCred:   false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ad, err := parseAuthData(tc.in, testRPID, tc.requireUV)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg != "" {
+				return
+			}
+
+			require.NotNil(t, ad)
+
+			assert.Equal(t, uint32(42), ad.signCount)
+			if !tc.wantCred {
+				assert.Nil(t, ad.cred)
+
+				return
+			}
+
+			require.NotNil(t, ad.cred)
+
+			assert.Equal(t, []byte{0x01}, ad.cred.ID)
+			assert.Equal(t, key, ad.cred.PublicKey)
+			assert.Equal(t, uint32(42), ad.cred.SignCount)
+		})
+	}
+}
+
+func FuzzParseAuthData(f *testing.F) {
+	x, y := newTestP256Coords(f)
+	key := newTestCOSEKeyEC2(0x26, 0x01, x, y)
+
+	f.Add(newTestAuthData(flagUserPresent, nil))
+	f.Add(newTestAuthData(
+		flagUserPresent|flagAttestedCredData,
+		newTestCredData(1, []byte{0x01}, key),
+	))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ad, err := parseAuthData(data, testRPID, false)
+		if err != nil || ad.cred == nil {
+			return
+		}
+
+		// The stored public key must be parsed again without errors.
+		_, rest, err := parseCOSEKey(ad.cred.PublicKey)
+		require.NoError(t, err)
+
+		assert.Empty(t, rest)
+	})
+}
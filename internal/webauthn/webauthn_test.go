@@ -0,0 +1,331 @@
+package webauthn_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/webauthn"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRPID is the relying party identifier for tests.
+const testRPID = "abcdef0123456789.nullprivate.com"
+
+// testOrigin is the origin of the web UI for tests.
+const testOrigin = "https://" + testRPID
+
+// cborHead returns the encoded head of a CBOR data item.
+func cborHead(major byte, arg int) (b []byte) {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg < 0x100:
+		return []byte{major<<5 | 24, byte(arg)}
+	default:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	}
+}
+
+// cborEncode encodes v into CBOR.  It only supports the types used in tests.
+// Map keys are encoded in the order given in pairs.
+func cborEncode(tb testing.TB, v any) (b []byte) {
+	tb.Helper()
+
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, -1-v)
+		}
+
+		return cborHead(0, v)
+	case []byte:
+		return append(cborHead(2, len(v)), v...)
+	case string:
+		return append(cborHead(3, len(v)), v...)
+	case cborPairs:
+		b = cborHead(5, len(v)/2)
+		for _, item := range v {
+			b = append(b, cborEncode(tb, item)...)
+		}
+
+		return b
+	default:
+		require.FailNowf(tb, "unsupported type", "%T", v)
+
+		return nil
+	}
+}
+
+// cborPairs is a CBOR map encoded as keys followed by their values.
+type cborPairs []any
+
+// testAuthenticator is a software authenticator for tests.
+type testAuthenticator struct {
+	signer    crypto.Signer
+	coseKey   cborPairs
+	credID    []byte
+	signCount uint32
+}
+
+// newES256Authenticator returns a new authenticator with a P-256 key.
+func newES256Authenticator(tb testing.TB) (a *testAuthenticator) {
+	tb.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(tb, err)
+
+	return &testAuthenticator{
+		signer: key,
+		coseKey: cborPairs{
+			1, 2,
+			3, -7,
+			-1, 1,
+			-2, key.X.FillBytes(make([]byte, 32)),
+			-3, key.Y.FillBytes(make([]byte, 32)),
+		},
+		credID: []byte("es256-credential"),
+	}
+}
+
+// newEdDSAAuthenticator returns a new authenticator with an Ed25519 key.
+func newEdDSAAuthenticator(tb testing.TB) (a *testAuthenticator) {
+	tb.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(tb, err)
+
+	return &testAuthenticator{
+		signer: priv,
+		coseKey: cborPairs{
+			1, 1,
+			3, -8,
+			-1, 6,
+			-2, []byte(pub),
+		},
+		credID: []byte("eddsa-credential"),
+	}
+}
+
+// authData returns the authenticator data for rpID.
+func (a *testAuthenticator) authData(tb testing.TB, rpID string, attested bool) (data []byte) {
+	tb.Helper()
+
+	const (
+		flagUP = 0x01
+		flagUV = 0x04
+		flagAT = 0x40
+	)
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data = append(data, rpIDHash[:]...)
+
+	flags := byte(flagUP | flagUV)
+	if attested {
+		flags |= flagAT
+	}
+
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credID)))
+	data = append(data, a.credID...)
+
+	return append(data, cborEncode(tb, a.coseKey)...)
+}
+
+// sign returns the signature of authData and clientDataJSON.
+func (a *testAuthenticator) sign(tb testing.TB, authData, clientDataJSON []byte) (sig []byte) {
+	tb.Helper()
+
+	sum := sha256.Sum256(clientDataJSON)
+	signed := slices.Concat(authData, sum[:])
+
+	var err error
+	if _, ok := a.signer.(ed25519.PrivateKey); ok {
+		sig, err = a.signer.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(signed)
+		sig, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	require.NoError(tb, err)
+
+	return sig
+}
+
+// newClientDataJSON returns the client data for a ceremony.
+func newClientDataJSON(tb testing.TB, typ, origin string, challenge []byte) (data []byte) {
+	tb.Helper()
+
+	data, err := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+	require.NoError(tb, err)
+
+	return data
+}
+
+// register performs a registration ceremony with a and returns the
+// credential.
+func register(tb testing.TB, a *testAuthenticator) (c *webauthn.Credential) {
+	tb.Helper()
+
+	challenge := webauthn.NewChallenge()
+	attObj := cborEncode(tb, cborPairs{
+		"fmt", "none",
+		"attStmt", cborPairs{},
+		"authData", a.authData(tb, testRPID, true),
+	})
+
+	c, err := webauthn.VerifyRegistration(&webauthn.RegistrationParams{
+		ClientDataJSON:          newClientDataJSON(tb, "webauthn.create", testOrigin, challenge),
+		AttestationObject:       attObj,
+		Challenge:               challenge,
+		RPID:                    testRPID,
+		RequireUserVerification: true,
+	})
+	require.NoError(tb, err)
+
+	return c
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	a := newES256Authenticator(t)
+	c := register(t, a)
+
+	assert.Equal(t, a.credID, c.ID)
+	assert.Equal(t, cborEncode(t, a.coseKey), c.PublicKey)
+
+	challenge := webauthn.NewChallenge()
+	attObj := cborEncode(t, cborPairs{
+		"fmt", "none",
+		"attStmt", cborPairs{},
+		"authData", a.authData(t, testRPID, true),
+	})
+
+	testCases := []struct {
+		name       string
+		typ        string
+		origin     string
+		rpID       string
+		challenge  []byte
+		wantErrMsg string
+	}{{
+		name:       "bad_type",
+		typ:        "webauthn.get",
+		origin:     testOrigin,
+		rpID:       testRPID,
+		challenge:  challenge,
+		wantErrMsg: `client data: type "webauthn.get", want "webauthn.create"`,
+	}, {
+		name:       "bad_challenge",
+		typ:        "webauthn.create",
+		origin:     testOrigin,
+		rpID:       testRPID,
+		challenge:  webauthn.NewChallenge(),
+		wantErrMsg: "client data: challenge mismatch",
+	}, {
+		name:   "bad_origin",
+		typ:    "webauthn.create",
+		origin: "https://evil.example",
+		rpID:   testRPID,
+		wantErrMsg: `client data: origin "https://evil.example" doesn't match rp id "` +
+			testRPID + `"`,
+		challenge: challenge,
+	}, {
+		name:       "insecure_origin",
+		typ:        "webauthn.create",
+		origin:     "http://" + testRPID,
+		rpID:       testRPID,
+		challenge:  challenge,
+		wantErrMsg: `client data: origin "http://` + testRPID + `" is not secure`,
+	}, {
+		name:       "bad_rp_id",
+		typ:        "webauthn.create",
+		origin:     testOrigin,
+		rpID:       "nullprivate.com",
+		challenge:  challenge,
+		wantErrMsg: "authenticator data: rp id hash mismatch",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := webauthn.VerifyRegistration(&webauthn.RegistrationParams{
+				ClientDataJSON:    newClientDataJSON(t, tc.typ, tc.origin, challenge),
+				AttestationObject: attObj,
+				Challenge:         tc.challenge,
+				RPID:              tc.rpID,
+			})
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	testCases := []struct {
+		auth *testAuthenticator
+		name string
+	}{{
+		auth: newES256Authenticator(t),
+		name: "es256",
+	}, {
+		auth: newEdDSAAuthenticator(t),
+		name: "eddsa",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := tc.auth
+			c := register(t, a)
+
+			a.signCount = 5
+			challenge := webauthn.NewChallenge()
+			clientData := newClientDataJSON(t, "webauthn.get", testOrigin, challenge)
+			authData := a.authData(t, testRPID, false)
+
+			params := &webauthn.AssertionParams{
+				ClientDataJSON:          clientData,
+				AuthenticatorData:       authData,
+				Signature:               a.sign(t, authData, clientData),
+				Challenge:               challenge,
+				RPID:                    testRPID,
+				RequireUserVerification: true,
+			}
+
+			signCount, err := webauthn.VerifyAssertion(c, params)
+			require.NoError(t, err)
+
+			assert.Equal(t, uint32(5), signCount)
+
+			c.SignCount = signCount
+			_, err = webauthn.VerifyAssertion(c, params)
+			testutil.AssertErrorMsg(
+				t,
+				"signature counter 5 is not greater than 5, authenticator may be cloned",
+				err,
+			)
+
+			c.SignCount = 0
+			params.Signature = a.sign(t, authData, []byte("{}"))
+			_, err = webauthn.VerifyAssertion(c, params)
+			testutil.AssertErrorMsg(t, "invalid signature", err)
+		})
+	}
+}